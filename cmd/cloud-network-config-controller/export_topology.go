@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	cloudnetworkclientset "github.com/openshift/client-go/cloudnetwork/clientset/versioned"
+	topology "github.com/openshift/cloud-network-config-controller/pkg/topology"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// exportTopologyCommand is the subcommand writing the egress IP topology to
+// stdout, e.g. for support bundles, instead of running the controller.
+const exportTopologyCommand = "export-topology"
+
+// isExportTopology returns true if the binary is run as the export-topology
+// subcommand.
+func isExportTopology() bool {
+	return len(os.Args) > 1 && os.Args[1] == exportTopologyCommand
+}
+
+// exportTopology writes the topology of the egress IPs, built out of the nodes
+// and CloudPrivateIPConfigs of the cluster, as JSON or as a Graphviz graph.
+func exportTopology(args []string) error {
+	flags := flag.NewFlagSet(exportTopologyCommand, flag.ExitOnError)
+	kubeConfig := flags.String("kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
+	format := flags.String("format", "json", "Output format, one of: json, dot")
+	flags.Parse(args)
+	if *format != "json" && *format != "dot" {
+		return fmt.Errorf("invalid format %q, must be one of: json, dot", *format)
+	}
+
+	cfg, err := clientcmd.BuildConfigFromFlags("", *kubeConfig)
+	if err != nil {
+		return fmt.Errorf("error building kubeconfig, err: %v", err)
+	}
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("error building kubernetes clientset, err: %v", err)
+	}
+	cloudNetworkClient, err := cloudnetworkclientset.NewForConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("error building cloudnetwork clientset, err: %v", err)
+	}
+
+	ctx := context.Background()
+	nodeList, err := kubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing nodes, err: %v", err)
+	}
+	cloudPrivateIPConfigList, err := cloudNetworkClient.CloudV1().CloudPrivateIPConfigs().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing CloudPrivateIPConfigs, err: %v", err)
+	}
+	nodes := make([]*corev1.Node, 0, len(nodeList.Items))
+	for i := range nodeList.Items {
+		nodes = append(nodes, &nodeList.Items[i])
+	}
+	cloudPrivateIPConfigs := make([]*cloudnetworkv1.CloudPrivateIPConfig, 0, len(cloudPrivateIPConfigList.Items))
+	for i := range cloudPrivateIPConfigList.Items {
+		cloudPrivateIPConfigs = append(cloudPrivateIPConfigs, &cloudPrivateIPConfigList.Items[i])
+	}
+
+	t, err := topology.Build(nodes, cloudPrivateIPConfigs)
+	if err != nil {
+		return err
+	}
+	if *format == "dot" {
+		return t.WriteDOT(os.Stdout)
+	}
+	return t.WriteJSON(os.Stdout)
+}
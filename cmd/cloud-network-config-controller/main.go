@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"flag"
+	"net/http"
 	"os"
 	"sync"
 	"time"
@@ -10,29 +11,72 @@ import (
 	cloudnetworkclientset "github.com/openshift/client-go/cloudnetwork/clientset/versioned"
 	cloudnetworkinformers "github.com/openshift/client-go/cloudnetwork/informers/externalversions"
 	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	config "github.com/openshift/cloud-network-config-controller/pkg/config"
+	controller "github.com/openshift/cloud-network-config-controller/pkg/controller"
 	cloudprivateipconfigcontroller "github.com/openshift/cloud-network-config-controller/pkg/controller/cloudprivateipconfig"
 	configmapcontroller "github.com/openshift/cloud-network-config-controller/pkg/controller/configmap"
+	gccontroller "github.com/openshift/cloud-network-config-controller/pkg/controller/gc"
 	nodecontroller "github.com/openshift/cloud-network-config-controller/pkg/controller/node"
 	secretcontroller "github.com/openshift/cloud-network-config-controller/pkg/controller/secret"
+	debug "github.com/openshift/cloud-network-config-controller/pkg/debug"
+	health "github.com/openshift/cloud-network-config-controller/pkg/health"
+	journal "github.com/openshift/cloud-network-config-controller/pkg/journal"
+	metrics "github.com/openshift/cloud-network-config-controller/pkg/metrics"
+	notifier "github.com/openshift/cloud-network-config-controller/pkg/notifier"
 	signals "github.com/openshift/cloud-network-config-controller/pkg/signals"
+	topology "github.com/openshift/cloud-network-config-controller/pkg/topology"
+	tracing "github.com/openshift/cloud-network-config-controller/pkg/tracing"
+	webhook "github.com/openshift/cloud-network-config-controller/pkg/webhook"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/dynamic"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/leaderelection"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 )
 
 const (
-	// The name of the configmap used for leader election
+	// The name of the lease used for leader election
 	resourceLockName          = "cloud-network-config-controller-lock"
 	controllerNameEnvVar      = "CONTROLLER_NAME"
 	controllerNamespaceEnvVar = "CONTROLLER_NAMESPACE"
+	// The name of the ControllerJournal persisting the pending releases of
+	// OpenStack reservation ports
+	openstackJournalName = "openstack-pending-releases"
 )
 
 var (
 	kubeConfig          string
+	leaseDuration       time.Duration
+	renewDeadline       time.Duration
+	retryPeriod         time.Duration
 	platformCfg         cloudprovider.CloudProviderConfig
+	verifyCfg           cloudprivateipconfigcontroller.VerifyConfig
+	startupResyncWindow time.Duration
+	interfaceResync     time.Duration
+	nodeBatchWindow     time.Duration
+	cpicRetryPolicy     = controller.DefaultRetryPolicy()
+	nodeRetryPolicy     = controller.DefaultRetryPolicy()
+	orphanGCPeriod      time.Duration
+	orphanGCGracePeriod time.Duration
+	recordReservations  bool
+	recordEvents        bool
+	auditRetention      time.Duration
+	validateCredentials bool
+	webhookPort         int
+	metricsPort         int
+	healthPort          int
+	cloudProbePeriod    time.Duration
+	stuckTimeout        time.Duration
+	pprofAddress        string
+	tracingEndpoint     string
+	tracingSampleRatio  float64
+	webhookCertDir      string
 	secretName          string
 	configName          string
 	controllerName      string
@@ -40,6 +84,19 @@ var (
 )
 
 func main() {
+	if isExportTopology() {
+		if err := exportTopology(os.Args[2:]); err != nil {
+			klog.Exitf("Error exporting the egress IP topology: %s", err.Error())
+		}
+		return
+	}
+	if isProbeReachability() {
+		if err := probeReachability(os.Args[2:]); err != nil {
+			klog.Exitf("Error probing the reachability: %s", err.Error())
+		}
+		return
+	}
+
 	// set up wait group used for spawning all our individual controllers
 	// on the bottom of this function
 	wg := &sync.WaitGroup{}
@@ -59,13 +116,45 @@ func main() {
 		klog.Exitf("Error building kubeconfig: %s", err.Error())
 	}
 
+	if tracingEndpoint != "" {
+		if err := tracing.Init(stopCh, tracingEndpoint, tracingSampleRatio); err != nil {
+			klog.Exitf("Error setting up tracing: %s", err.Error())
+		}
+		// Only trace the requests to the API server sent on behalf of a
+		// sync, not those of the informers and the leader election.
+		cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return tracing.NewTransport(rt)
+		})
+	}
+
 	kubeClient, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
 		klog.Exitf("Error building kubernetes clientset: %s", err.Error())
 	}
 
+	// The admission webhook is served by all replicas, not only the leader,
+	// so that creations of CloudPrivateIPConfigs don't depend on the leader
+	// election. So are metrics, most of which only the leader reports, and
+	// the health probes, which only check the cloud and the workers of the
+	// leader.
+	healthChecker := health.NewChecker()
+	if webhookPort > 0 {
+		go webhook.Serve(stopCh, webhookPort, webhookCertDir)
+	}
+	if metricsPort > 0 {
+		go metrics.Serve(stopCh, metricsPort)
+	}
+	if healthPort > 0 {
+		go health.Serve(stopCh, healthPort, healthChecker)
+	}
+	if pprofAddress != "" {
+		go debug.Serve(stopCh, pprofAddress)
+	}
+
+	// Previous versions held both a config map and a lease of the same name,
+	// which they kept in sync: the lease alone is enough to exclude them.
 	rl, err := resourcelock.New(
-		resourcelock.ConfigMapsLeasesResourceLock,
+		resourcelock.LeasesResourceLock,
 		controllerNamespace,
 		resourceLockName,
 		kubeClient.CoreV1(),
@@ -83,12 +172,15 @@ func main() {
 	// stops on one node while another starts on another. In such a case we
 	// could have both running at the same time. This prevents that from
 	// happening and ensures we only have one replica "controlling", always.
+	// A replica only takes over a lease which wasn't renewed for
+	// leaseDuration, how long egress IPs aren't reconciled after the leader
+	// crashed; a leader shutting down releases it right away.
 	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
 		Lock:            rl,
 		ReleaseOnCancel: true,
-		LeaseDuration:   137 * time.Second, // leader election values from https://github.com/openshift/library-go/pull/1104
-		RenewDeadline:   107 * time.Second,
-		RetryPeriod:     26 * time.Second,
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
 		Callbacks: leaderelection.LeaderCallbacks{
 			OnStartedLeading: func(ctx context.Context) {
 				cloudNetworkClient, err := cloudnetworkclientset.NewForConfig(cfg)
@@ -96,6 +188,64 @@ func main() {
 					klog.Exitf("Error building cloudnetwork clientset: %s", err.Error())
 				}
 
+				dynamicClient, err := dynamic.NewForConfig(cfg)
+				if err != nil {
+					klog.Exitf("Error building dynamic client: %s", err.Error())
+				}
+
+				var reservationClient dynamic.Interface
+				if recordReservations {
+					reservationClient = dynamicClient
+				}
+
+				auditCfg := cloudprivateipconfigcontroller.AuditConfig{Retention: auditRetention}
+				if auditRetention > 0 {
+					auditCfg.Client = dynamicClient
+				}
+
+				// A ControllerConfig which fails to load doesn't stop the
+				// controller, which runs without it until it's fixed.
+				configLoader := &config.Loader{
+					Client:    dynamicClient,
+					Secrets:   kubeClient.CoreV1(),
+					Namespace: controllerNamespace,
+				}
+				controllerConfig, err := configLoader.Load(ctx)
+				if err != nil {
+					klog.Errorf("Error loading the controller configuration, err: %v", err)
+					controllerConfig = &config.Config{}
+				}
+
+				var sinks []notifier.Sink
+				for _, sinkCfg := range controllerConfig.NotificationSinks {
+					sink, err := notifier.NewSink(sinkCfg.Kind, sinkCfg.URL, "/namespaces/"+controllerNamespace+"/cloud-network-config-controller")
+					if err != nil {
+						klog.Errorf("Ignoring notification sink of ControllerConfig: %q, err: %v", config.Name, err)
+						continue
+					}
+					sinks = append(sinks, sink)
+				}
+				notificationDispatcher := notifier.NewDispatcher(sinks...)
+				maintenanceWindows := controllerConfig.MaintenanceWindows
+
+				var eventRecorder record.EventRecorder
+				if recordEvents {
+					eventBroadcaster := record.NewBroadcaster()
+					eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+					eventRecorder = eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "cloud-network-config-controller", Host: controllerName})
+				}
+
+				if platformCfg.PlatformType == cloudprovider.PlatformTypeOpenStack {
+					platformCfg.OpenStackJournalStore = &journal.CustomResourceStore{
+						Client: dynamicClient,
+						Name:   openstackJournalName,
+					}
+				}
+
+				verifyCfg.Pods = kubeClient.CoreV1()
+				verifyCfg.Namespace = controllerNamespace
+
+				platformCfg.ShutdownContext = ctx
 				cloudProviderClient, err := cloudprovider.NewCloudProviderClient(platformCfg)
 				if err != nil {
 					klog.Fatalf("Error building cloud provider client, err: %v", err)
@@ -110,13 +260,64 @@ func main() {
 					cloudNetworkClient,
 					cloudNetworkInformerFactory.Cloud().V1().CloudPrivateIPConfigs(),
 					kubeInformerFactory.Core().V1().Nodes(),
+					verifyCfg,
+					reservationClient,
+					auditCfg,
+					notificationDispatcher,
+					maintenanceWindows,
+					nodeBatchWindow,
+					eventRecorder,
 				)
 				nodeController := nodecontroller.NewNodeController(
 					ctx,
 					kubeClient,
 					cloudProviderClient,
 					kubeInformerFactory.Core().V1().Nodes(),
+					notificationDispatcher,
+					maintenanceWindows,
+					interfaceResync,
 				)
+				topology.RegisterRemainingCapacityMetric(
+					kubeInformerFactory.Core().V1().Nodes().Lister(),
+					cloudNetworkInformerFactory.Cloud().V1().CloudPrivateIPConfigs().Lister(),
+				)
+				garbageCollector := gccontroller.NewGarbageCollector(
+					cloudProviderClient,
+					cloudNetworkInformerFactory.Cloud().V1().CloudPrivateIPConfigs(),
+					kubeInformerFactory.Core().V1().Nodes(),
+					maintenanceWindows,
+					orphanGCPeriod,
+					orphanGCGracePeriod,
+				)
+				cloudPrivateIPConfigController.StartupResyncWindow = startupResyncWindow
+				nodeController.StartupResyncWindow = startupResyncWindow
+				cloudPrivateIPConfigController.RetryPolicy = cpicRetryPolicy
+				nodeController.RetryPolicy = nodeRetryPolicy
+				cloudPrivateIPConfigController.OnDrop = func(key string, err error) {
+					notificationDispatcher.Notify(notifier.Event{
+						Type:    notifier.EventQuarantined,
+						Object:  key,
+						Message: cloudprovider.WithRemediationHint(err.Error(), err),
+					})
+				}
+				// All platforms but AWS, unless its CA is overridden, use a configmap "kube-cloud-config"
+				// to keep track of additional data such as the ca-bundle.pem.
+				watchConfigMap := configName != "" && (platformCfg.PlatformType != cloudprovider.PlatformTypeAWS || platformCfg.AWSCAOverride != "")
+
+				var credentialValidator *controller.CredentialValidator
+				if validateCredentials {
+					credentialValidator = &controller.CredentialValidator{
+						PlatformCfg:  platformCfg,
+						SecretLister: kubeInformerFactory.Core().V1().Secrets().Lister(),
+						SecretName:   secretName,
+						Namespace:    controllerNamespace,
+						NodeLister:   kubeInformerFactory.Core().V1().Nodes().Lister(),
+					}
+					if watchConfigMap {
+						credentialValidator.ConfigMapLister = kubeInformerFactory.Core().V1().ConfigMaps().Lister()
+						credentialValidator.ConfigMapName = configName
+					}
+				}
 				secretController := secretcontroller.NewSecretController(
 					ctx,
 					cancelFunc,
@@ -124,18 +325,31 @@ func main() {
 					kubeInformerFactory.Core().V1().Secrets(),
 					secretName,
 					controllerNamespace,
+					credentialValidator,
 				)
 
+				healthChecker.AddLivenessCheck("cloud-private-ip-config", func() error { return cloudPrivateIPConfigController.Stuck(stuckTimeout) })
+				healthChecker.AddLivenessCheck("node", func() error { return nodeController.Stuck(stuckTimeout) })
+
+				go notificationDispatcher.Run(stopCh)
+				// The controllers are restarted on configuration changes,
+				// like on rotations of the cloud credentials.
+				go configLoader.Watch(ctx, controllerConfig, cancelFunc)
+				go healthChecker.RunCloudProbe(stopCh, cloudProviderClient, kubeInformerFactory.Core().V1().Nodes(), cloudProbePeriod)
+				go cloudprivateipconfigcontroller.RunAssignmentRecordPruner(ctx, auditCfg)
+				go garbageCollector.Run(stopCh)
 				cloudNetworkInformerFactory.Start(stopCh)
 				kubeInformerFactory.Start(stopCh)
 
-				wg.Add(1)
-				go func() {
-					defer wg.Done()
-					if err = secretController.Run(stopCh); err != nil {
-						klog.Exitf("Error running Secret controller: %s", err.Error())
-					}
-				}()
+				if secretName != "" {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						if err = secretController.Run(stopCh); err != nil {
+							klog.Exitf("Error running Secret controller: %s", err.Error())
+						}
+					}()
+				}
 				wg.Add(1)
 				go func() {
 					defer wg.Done()
@@ -145,11 +359,8 @@ func main() {
 				}()
 				wg.Add(1)
 
-				// AWS and OpenStack use a configmap "kube-cloud-config" to keep track of additional
-				// data such as the ca-bundle.pem. Add a controller that restarts the operator if that configmap
-				// changes.
-				if configName != "" && ((platformCfg.PlatformType == cloudprovider.PlatformTypeAWS && platformCfg.AWSCAOverride != "") ||
-					platformCfg.PlatformType == cloudprovider.PlatformTypeOpenStack) {
+				// Add a controller that restarts the operator if the configmap changes.
+				if watchConfigMap {
 					klog.Infof("Starting the ConfigMap operator to monitor '%s'", configName)
 					configMapController := configmapcontroller.NewConfigMapController(
 						ctx,
@@ -158,6 +369,7 @@ func main() {
 						kubeInformerFactory.Core().V1().ConfigMaps(),
 						configName,
 						controllerNamespace,
+						credentialValidator,
 					)
 					wg.Add(1)
 					go func() {
@@ -176,8 +388,9 @@ func main() {
 				}()
 			},
 			// There are two cases to consider for shutting down our controller.
-			//  1. Cloud credential or configmap rotation - which our secret controller
-			//     and configmap controller watch for and cancel the global context.
+			//  1. Cloud credential or configmap rotation, or a ControllerConfig
+			//     change - which our secret controller, configmap controller and
+			//     config loader watch for and cancel the global context.
 			//     That will trigger an end to the leader election loop and call
 			//     OnStoppedLeading which will send a SIGTERM and shut down all controllers.
 			//  2. Leader election rotation - which will send a SIGTERM and
@@ -196,6 +409,11 @@ func main() {
 func init() {
 	klog.InitFlags(nil)
 
+	// The subcommand parses its own arguments
+	if isExportTopology() || isProbeReachability() {
+		return
+	}
+
 	// These are arguments for this controller
 	flag.StringVar(&secretName, "secret-name", "", "The cloud provider secret name - used for talking to the cloud API.")
 	flag.StringVar(&configName, "config-name", "kube-cloud-config", "The cloud provider config name - used for talking to the cloud API.")
@@ -204,16 +422,147 @@ func init() {
 	flag.StringVar(&platformCfg.APIOverride, "platform-api-url", "", "The cloud provider API URL to use (instead of whatever default).")
 	flag.StringVar(&platformCfg.CredentialDir, "secret-override", "/etc/secret/cloudprovider", "The cloud provider secret location override, useful when running this component locally against a cluster")
 	flag.StringVar(&platformCfg.ConfigDir, "config-override", "/kube-cloud-config", "The cloud provider config location override, useful when running this component locally against a cluster")
-	flag.StringVar(&platformCfg.AzureEnvironment, "platform-azure-environment", "AzurePublicCloud", "The Azure environment name, used to select API endpoints")
+	flag.StringVar(&platformCfg.ClusterID, "cluster-id", "", "The ID of the cluster, used to describe resources created on the cloud so that they can be mapped back to the cluster.")
+	flag.BoolVar(&platformCfg.ReadOnly, "read-only", false, "Only read from the cloud API and log the changes which would be performed, useful with read-only cloud credentials")
+	flag.BoolVar(&platformCfg.DryRun, "dry-run", false, "Like -read-only, but validate every assignment which would be performed against the node's egress IP configuration on the cloud: its interface, subnets and capacity left, to plan a rollout on production")
+	flag.IntVar(&platformCfg.MaxInflightCloudMutations, "max-inflight-cloud-mutations", 0, "Maximum number of changes performed concurrently on the cloud, independently of the number of workers; unlimited if 0")
+	flag.IntVar(&platformCfg.MaxInflightCloudMutationsPerNode, "max-inflight-cloud-mutations-per-node", 0, "Maximum number of changes performed concurrently on the cloud for each node; unlimited if 0")
+	flag.StringVar(&platformCfg.GCPNetworkProjectID, "platform-gcp-network-project-id", "", "Project of the subnets of the GCP instances, i.e. the host project of a shared VPC, used if the subnet URLs of the network interfaces don't name it; defaults to the instance's project")
+	flag.StringVar(&platformCfg.GCPFederatedTokenFile, "platform-gcp-federated-token-file", "", "Path to the federated token (e.g. a projected service account token) to exchange for Compute API access tokens when service_account.json of the secret holds external account credentials (workload identity federation); defaults to the credential source file those name")
+	flag.IntVar(&platformCfg.GCPAliasIPRangesPerInterface, "platform-gcp-alias-ip-ranges-per-interface", 0, "Number of alias IP ranges a GCP network interface can hold, whatever their IP family, if the limit of the project is other than GCP's default; 10 if 0")
+	flag.StringVar(&platformCfg.GCPNetworkInterfaceSelector, "platform-gcp-network-interface-selector", "", "Select the network interface egress IPs are assigned to on instances with several, one of: subnetwork=<URL>, name=<pattern>, network=<URL>, URLs matching by any trailing part; the first one if empty. Overridden per node by the cloud.network.openshift.io/gcp-network-interface-selector annotation")
+	flag.DurationVar(&platformCfg.GCPUpdateBatchWindow, "platform-gcp-update-batch-window", 0, "Wait that long for concurrent alias IP changes to the same GCP network interface, to apply them in a single update instead of one slow zone operation each; disabled if 0")
+	flag.DurationVar(&platformCfg.GCPOperationPollInterval, "platform-gcp-operation-poll-interval", time.Second, "First interval between polls of the GCP zone operations of the changes, doubling after every poll")
+	flag.DurationVar(&platformCfg.GCPOperationPollMaxInterval, "platform-gcp-operation-poll-max-interval", 10*time.Second, "Longest interval between polls of the GCP zone operations of the changes")
+	flag.DurationVar(&platformCfg.GCPOperationTimeout, "platform-gcp-operation-timeout", 5*time.Minute, "Deadline of the GCP zone operations of the changes, failing the change if not done by then")
+	flag.BoolVar(&platformCfg.GCPLabelResources, "platform-gcp-label-resources", false, "Label the GCP instances whose network interfaces are changed by the controller with the cluster ID and the controller")
+	flag.StringVar(&platformCfg.GCPResourceLabels, "platform-gcp-resource-labels", "", "Comma separated <key>=<value> extra labels of the GCP instances whose network interfaces are changed by the controller, e.g. for cost allocation")
+	flag.StringVar(&platformCfg.AzureEnvironment, "platform-azure-environment", "AzurePublicCloud", "The Azure environment name, used to select API endpoints: AzurePublicCloud, AzureUSGovernmentCloud, AzureChinaCloud, AzureGermanCloud (or the Azure CLI names of these), or AzureStackCloud for Azure Stack Hub")
+	flag.StringVar(&platformCfg.AzureEnvironmentFile, "platform-azure-environment-file", "", "Path to the JSON file describing the API endpoints of the AzureStackCloud environment; defaults to the AZURE_ENVIRONMENT_FILEPATH environment variable")
+	flag.StringVar(&platformCfg.AzureFederatedTokenFile, "platform-azure-federated-token-file", "", "Path to a federated token (e.g. a projected service account token, with Azure AD workload identity) to exchange for ARM credentials, instead of the client secret of the secret; defaults to the azure_federated_token_file key of the secret")
+	flag.StringVar(&platformCfg.AzureManagedIdentityClientID, "platform-azure-managed-identity-client-id", "", "Client ID of a user-assigned managed identity of the node's VM to authenticate with through the instance metadata service, instead of the application of the secret; azure_client_id, azure_tenant_id and azure_client_secret aren't needed then")
+	flag.StringVar(&platformCfg.AzureNetworkInterfaceSelector, "platform-azure-network-interface-selector", "", "Select the network interface egress IPs are assigned to on VMs with several, one of: subnet=<subnet ID>, name=<pattern>, tag=<key>[=<value>]; the primary one if empty. Overridden per node by the cloud.network.openshift.io/azure-network-interface-selector annotation")
+	flag.DurationVar(&platformCfg.AzureUpdateBatchWindow, "platform-azure-update-batch-window", 0, "Wait that long for concurrent IP configuration changes to the same Azure network interface, to apply them in a single update instead of one slow ARM operation each; disabled if 0")
+	flag.StringVar(&platformCfg.AzurePublicIPTagKey, "platform-azure-public-ip-tag-key", "", "Associate the public IP of the cluster's resource group tagged <key>=<egress IP> with every egress IP, for it to egress to the internet with that public IP")
+	flag.StringVar(&platformCfg.AzurePublicIPNamePrefix, "platform-azure-public-ip-name-prefix", "", "Associate the public IP of the cluster's resource group named <prefix><egress IP> (colons of IPv6 addresses replaced by dashes) with every egress IP, for it to egress to the internet with that public IP")
+	flag.BoolVar(&platformCfg.AzureTagResources, "platform-azure-tag-resources", false, "Tag the Azure network interfaces and public IPs changed by the controller with the cluster ID, the controller and the node they're used by")
+	flag.StringVar(&platformCfg.AzureResourceTags, "platform-azure-resource-tags", "", "Comma separated <key>=<value> extra tags of the Azure network interfaces and public IPs changed by the controller, e.g. for cost allocation")
 	flag.StringVar(&platformCfg.AWSCAOverride, "platform-aws-ca-override", "", "Path to a separate CA bundle to use when connecting to the AWS API")
+	flag.BoolVar(&platformCfg.AWSIMDSFallback, "platform-aws-imds-fallback", false, "Resolve the AWS region if not set, and the instance of the local node if its providerID can't be parsed, through the instance metadata service (IMDSv2); the local instance is also described through it while DescribeInstances is throttled")
+	flag.BoolVar(&platformCfg.AWSPrefixDelegation, "platform-aws-prefix-delegation", false, "Assign IPv4 egress IPs out of /28 prefixes delegated to the instance's network interface, instead of as secondary private IP addresses")
+	flag.StringVar(&platformCfg.AWSEndpointOverrides, "platform-aws-endpoint-overrides", "", "Comma separated <service>=<URL> overrides of the AWS service endpoints, e.g. for interface VPC endpoints, GovCloud or C2S; service one of: ec2, sts")
+	flag.StringVar(&platformCfg.AWSElasticIPTagKey, "platform-aws-elastic-ip-tag-key", "", "Associate the Elastic IP tagged <key>=<egress IP> with every IPv4 egress IP, for it to egress to the internet with that public IP")
+	flag.StringVar(&platformCfg.AWSElasticIPPool, "platform-aws-elastic-ip-pool", "", "Associate an Elastic IP of this public IPv4 (e.g. BYOIP) pool with every IPv4 egress IP, for it to egress to the internet with that public IP")
+	flag.StringVar(&platformCfg.AWSNetworkInterfaceSelector, "platform-aws-network-interface-selector", "", "Select the network interface egress IPs are assigned to on instances with several, one of: subnet=<subnet ID>, security-group=<security group ID>, tag=<key>[=<value>]; the first one if empty. Overridden per node by the cloud.network.openshift.io/aws-network-interface-selector annotation")
+	flag.DurationVar(&platformCfg.AWSAssignmentBatchWindow, "platform-aws-assignment-batch-window", 0, "Wait that long for concurrent assignments to the same AWS network interface, to assign them in a single API call and reduce throttling on large rollouts; disabled if 0")
+	flag.Float64Var(&platformCfg.AWSMaxRequestRate, "platform-aws-max-request-rate", 0, "Maximum rate of EC2 API requests per second, lowered adaptively while AWS throttles requests and recovering afterwards, unlimited if 0")
+	flag.StringVar(&platformCfg.AWSRetryMode, "platform-aws-retry-mode", "", "Retry mode of the AWS SDK, one of: standard, adaptive (client-side rate limiting of throttled requests); the SDK's default (standard) if empty")
+	flag.DurationVar(&platformCfg.AWSDescribeCacheTTL, "platform-aws-describe-cache-ttl", 0, "Reuse the descriptions of AWS instances and their network interfaces that long, so that bursts of CloudPrivateIPConfigs of the same node don't multiply describe calls; they're described afresh after the controller changes them. Disabled if 0")
+	flag.BoolVar(&platformCfg.AWSTagResources, "platform-aws-tag-resources", false, "Tag the AWS network interfaces and Elastic IPs changed by the controller with the cluster ID, the controller and the node they're used by")
+	flag.StringVar(&platformCfg.AWSResourceTags, "platform-aws-resource-tags", "", "Comma separated <key>=<value> extra tags of the AWS network interfaces and Elastic IPs changed by the controller, e.g. for cost allocation")
+	flag.StringVar(&platformCfg.AWSRoleARN, "platform-aws-role-arn", "", "ARN of the AWS IAM role to assume, with the credentials of the secret or with -platform-aws-web-identity-token-file")
+	flag.StringVar(&platformCfg.AWSRoleExternalID, "platform-aws-role-external-id", "", "External ID to pass when assuming the AWS IAM role")
+	flag.StringVar(&platformCfg.AWSWebIdentityTokenFile, "platform-aws-web-identity-token-file", "", "Path to a web identity token (e.g. a projected service account token) to assume the AWS IAM role with, instead of the credentials of the secret")
+	flag.StringVar(&platformCfg.AWSNetworkRoleARN, "platform-aws-network-role-arn", "", "ARN of an AWS IAM role of the account owning the VPC, if it's shared with the instances' account, to look up subnets with; assumed with the credentials of the instances' account")
+	flag.StringVar(&platformCfg.AWSNetworkRoleExternalID, "platform-aws-network-role-external-id", "", "External ID to pass when assuming the AWS IAM role of the account owning the VPC")
+	flag.StringVar(&platformCfg.OpenStackTokenCacheDir, "platform-openstack-token-cache-dir", "", "Directory (e.g. an emptyDir) in which to persist the keystone token and service catalog across restarts, disabled if empty")
+	flag.BoolVar(&platformCfg.OpenStackStrictAZMatching, "platform-openstack-strict-az-matching", false, "Refuse to assign egress IPs on OpenStack networks which are scoped to another availability zone than the node's")
+	flag.StringVar(&platformCfg.OpenStackPortSecurityDisabledPolicy, "platform-openstack-port-security-disabled-policy", cloudprovider.OpenStackPortSecurityDisabledPolicyFail, "How to handle OpenStack networks with port security disabled: 'fail' assignments, or 'skip' allowed_address_pairs and only reserve the IP address")
+	flag.DurationVar(&platformCfg.OpenStackRequestTimeout, "platform-openstack-request-timeout", 30*time.Second, "Timeout of every call to the OpenStack API, all pages of a listing included, disabled if 0")
+	flag.BoolVar(&platformCfg.OpenStackIncludeExternalNetworks, "platform-openstack-include-external-networks", false, "Report node ports on OpenStack external (router:external) networks as capable of hosting egress IPs")
+	flag.StringVar(&platformCfg.OpenStackPinnedSubnets, "platform-openstack-pinned-subnets", "", "Comma separated IDs of the OpenStack subnets to use for egress IPs on networks with several subnets of the same address family")
+	flag.BoolVar(&platformCfg.OpenStackStandbyAssignments, "platform-openstack-standby-assignments", false, "Pre-allow egress IPs on the OpenStack standby server designated by each node's annotation, so that failing over to it doesn't require updating its port")
+	flag.StringVar(&platformCfg.OpenStackVerificationPool, "platform-openstack-verification-pool", "", "ID of an Octavia pool with a health monitor; with -verify-assignments, every assigned egress IP is added to it as member until the health monitor reports it reachable from within the cloud; disabled if empty")
+	flag.IntVar(&platformCfg.OpenStackVerificationPort, "platform-openstack-verification-port", 0, "Port of the members of the OpenStack verification pool, for TCP or HTTP health monitors; may be 0 for PING health monitors")
+	flag.StringVar(&platformCfg.IBMCloudRegion, "platform-ibmcloud-region", "", "IBM Cloud region of the VPC, e.g. us-south, whose VPC API endpoint to use; required unless -platform-api-url is set")
+	flag.StringVar(&platformCfg.IBMCloudIAMURL, "platform-ibmcloud-iam-url", "", "IBM Cloud IAM endpoint to exchange the API key of the secret for access tokens at, on IBM Cloud VPC and Power VS, e.g. https://private.iam.cloud.ibm.com; defaults to https://iam.cloud.ibm.com")
+	flag.IntVar(&platformCfg.IBMCloudIPsPerInterface, "platform-ibmcloud-ips-per-interface", 0, "Number of secondary IP addresses an IBM Cloud virtual network interface can hold, if the quota of the account is other than the default; 10 if 0")
+	flag.StringVar(&platformCfg.PowerVSRegion, "platform-powervs-region", "", "Power VS region of the workspace, e.g. us-south, whose Power VS API endpoint to use; required unless -platform-api-url is set")
+	flag.StringVar(&platformCfg.PowerVSCloudInstanceCRN, "platform-powervs-cloud-instance-crn", "", "CRN of the Power VS workspace of the cluster, crn:v1:bluemix:public:power-iaas:<zone>:a/<account ID>:<workspace ID>::")
+	flag.IntVar(&platformCfg.PowerVSIPsPerInstance, "platform-powervs-ips-per-instance", 0, "Number of egress IPs a Power VS PVM instance can hold; 8 if 0")
+	flag.DurationVar(&platformCfg.PowerVSOperationTimeout, "platform-powervs-operation-timeout", 10*time.Minute, "Deadline of attaching and detaching the Power VS network ports of egress IPs, failing the change if not done by then")
+	flag.StringVar(&platformCfg.VSphereNSXTManagerURL, "platform-vsphere-nsxt-manager-url", "", "URL of the NSX-T manager of the segments of the vSphere VMs, e.g. https://nsxt.example.com; egress IPs are only supported on vSphere with NSX-T")
+	flag.StringVar(&platformCfg.OVirtMachineNetworks, "platform-ovirt-machine-networks", "", "Comma separated CIDRs of the machine networks of the oVirt VMs, e.g. 192.168.0.0/24, which oVirt networks have no notion of")
+	flag.StringVar(&platformCfg.AlibabaCloudRegion, "platform-alibabacloud-region", "", "Alibaba Cloud region of the cluster, e.g. cn-hangzhou, whose ECS and VPC API endpoints to use")
+	flag.StringVar(&platformCfg.AlibabaCloudVPCAPIURL, "platform-alibabacloud-vpc-api-url", "", "URL of the Alibaba Cloud VPC API, e.g. https://vpc-vpc.cn-hangzhou.aliyuncs.com, overriding the one of the region as -platform-api-url does for the ECS API")
+	flag.StringVar(&platformCfg.OCIRegion, "platform-oci-region", "", "OCI region of the cluster, e.g. us-ashburn-1, whose Core Services API and authentication service to use")
+	flag.BoolVar(&platformCfg.OCIInstancePrincipal, "platform-oci-instance-principal", false, "Authenticate to OCI as the instance the controller runs on, which must be part of a dynamic group granted the policies, rather than with the API key of the secret")
+	flag.StringVar(&platformCfg.OCIShapeIPLimits, "platform-oci-shape-ip-limits", "", "Comma separated <shape>=<limit> numbers of addresses of each address family a VNIC of instances of the shape can hold, e.g. VM.Standard.E4.Flex=16; 32 for other shapes")
+	flag.StringVar(&platformCfg.NutanixPrismCentralURL, "platform-nutanix-prism-central-url", "", "URL of the Prism Central of the Nutanix clusters of the VMs, e.g. https://prism-central.example.com:9440")
+	flag.DurationVar(&platformCfg.NutanixTaskTimeout, "platform-nutanix-task-timeout", 10*time.Minute, "Deadline of the Nutanix tasks updating VMs and IP address reservations, failing the change if not done by then")
+	flag.IntVar(&platformCfg.NoneCapacity, "platform-none-capacity", 0, "Number of egress IPs reported per node, whatever their address family, with -platform-type=None; 64 if 0")
+	flag.BoolVar(&verifyCfg.Enabled, "verify-assignments", false, "Verify every successful assignment on the cloud and record the result in the Verified condition of the CloudPrivateIPConfig")
+	flag.IntVar(&verifyCfg.ProbePort, "verify-probe-port", 0, "TCP port to probe the IP address on after a verified assignment, from a verifier pod on another node of its network, disabled if 0")
+	flag.DurationVar(&verifyCfg.ProbeTimeout, "verify-probe-timeout", 3*time.Second, "Timeout of the TCP probe of the IP address")
+	flag.StringVar(&verifyCfg.ProbeImage, "verify-probe-image", "", "Image of the verifier pods, the controller's own; required with -verify-probe-port")
+	flag.DurationVar(&verifyCfg.ResyncPeriod, "cloud-state-resync-period", 0, "Compare the IP addresses the cloud lists for each node with the assigned CloudPrivateIPConfigs at this period, and report the IP addresses missing on the cloud or assigned without a CloudPrivateIPConfig; disabled if 0")
+	flag.BoolVar(&verifyCfg.ResyncRepair, "cloud-state-resync-repair", false, "Re-assign the IP addresses the cloud state resync finds missing on the cloud, e.g. removed out of band in the cloud's console, rather than only reporting them")
+	flag.BoolVar(&recordReservations, "record-reservations", false, "Mirror every assignment and the cloud resources backing it into a CloudIPReservation owned by the CloudPrivateIPConfig, the CRD must be installed")
+	flag.BoolVar(&recordEvents, "record-events", true, "Record the assignments, moves and releases of CloudPrivateIPConfigs, their start, success or failure with the cloud error, as Kubernetes Events on the CloudPrivateIPConfig and the node")
+	flag.DurationVar(&auditRetention, "record-assignments-retention", 0, "Document every successful assignment, move and release in a CloudIPAssignmentRecord kept for this long, the CRD must be installed; disabled if 0")
+	flag.DurationVar(&startupResyncWindow, "startup-resync-window", 0, "Spread the processing of all nodes and CloudPrivateIPConfigs on startup over this window, to avoid a burst of cloud API calls on large clusters; disabled if 0")
+	flag.DurationVar(&nodeBatchWindow, "node-batch-window", 0, "Wait that long for concurrent assignments, or releases, of CloudPrivateIPConfigs to the same node, to hand them to the cloud provider at once; only applies to the platforms batching changes to network interfaces (see -platform-aws-assignment-batch-window, -platform-azure-update-batch-window, -platform-gcp-update-batch-window), which then apply them in a single call without waiting for their own window; disabled if 0")
+	flag.DurationVar(&interfaceResync, "network-interface-resync-period", 0, "Check the network interfaces of annotated nodes' instances for changes at this period, and update their egress IP configuration when interfaces got attached or detached (AWS); disabled if 0")
+	flag.DurationVar(&orphanGCPeriod, "orphan-gc-period", 0, "List the cloud resources the controller created for assignments (e.g. reservation ports, IP configurations) at this period, and delete those no CloudPrivateIPConfig or node uses anymore, e.g. left behind by failed rollbacks; disabled if 0")
+	flag.DurationVar(&orphanGCGracePeriod, "orphan-gc-grace-period", time.Hour, "How long a cloud resource must be found orphaned before the garbage collector deletes it")
+	flag.DurationVar(&cpicRetryPolicy.BaseDelay, "cloud-private-ip-config-retry-base-delay", cpicRetryPolicy.BaseDelay, "Delay before retrying a CloudPrivateIPConfig which failed to sync, doubling on every failure in a row")
+	flag.DurationVar(&cpicRetryPolicy.MaxDelay, "cloud-private-ip-config-retry-max-delay", cpicRetryPolicy.MaxDelay, "Longest delay before retrying a CloudPrivateIPConfig which failed to sync")
+	flag.IntVar(&cpicRetryPolicy.MaxRetries, "cloud-private-ip-config-max-retries", cpicRetryPolicy.MaxRetries, "Number of retries of a CloudPrivateIPConfig failing to sync before giving up on it until its next change")
+	flag.DurationVar(&nodeRetryPolicy.BaseDelay, "node-retry-base-delay", nodeRetryPolicy.BaseDelay, "Delay before retrying a node which failed to sync, doubling on every failure in a row")
+	flag.DurationVar(&nodeRetryPolicy.MaxDelay, "node-retry-max-delay", nodeRetryPolicy.MaxDelay, "Longest delay before retrying a node which failed to sync")
+	flag.IntVar(&nodeRetryPolicy.MaxRetries, "node-max-retries", nodeRetryPolicy.MaxRetries, "Number of retries of a node failing to sync before giving up on it until its next change")
+	flag.DurationVar(&cpicRetryPolicy.InterventionBaseDelay, "quota-error-retry-base-delay", cpicRetryPolicy.InterventionBaseDelay, "Delay before retrying an object which failed to sync with an exhausted cloud quota or a missing permission, doubling on every failure in a row, for both CloudPrivateIPConfigs and nodes")
+	flag.DurationVar(&cpicRetryPolicy.InterventionMaxDelay, "quota-error-retry-max-delay", cpicRetryPolicy.InterventionMaxDelay, "Longest delay before retrying an object which failed to sync with an exhausted cloud quota or a missing permission")
+	flag.BoolVar(&validateCredentials, "validate-credentials", false, "Validate rotated cloud credentials and CA bundle in a lightweight side client before restarting to pick them up, keep serving with the current ones until validation passes")
+	flag.IntVar(&webhookPort, "webhook-port", 0, "Serve the mutating admission webhook normalizing the names of IPv6 CloudPrivateIPConfigs, see manifests/cloud-network-config-controller-webhook.yaml, over TLS on this port; disabled if 0")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "/etc/secrets/webhook", "Directory holding the tls.crt and tls.key serving certificate and key of the admission webhook")
+	flag.IntVar(&metricsPort, "metrics-port", 0, "Serve Prometheus metrics on /metrics over HTTP on this port; disabled if 0")
+	flag.IntVar(&healthPort, "health-port", 0, "Serve the liveness probe on /healthz and the readiness probe on /readyz over HTTP on this port; disabled if 0")
+	flag.DurationVar(&cloudProbePeriod, "health-cloud-probe-period", time.Minute, "Call the cloud API about a node at this period with the cloud credentials, the leader isn't ready while the last call failed or is older than 3 periods")
+	flag.DurationVar(&stuckTimeout, "health-stuck-timeout", 15*time.Minute, "Fail the liveness probe once the workers of a controller made no progress for this long while there's work queued or in progress; must exceed the deadlines of the cloud operations, e.g. -platform-gcp-operation-timeout")
+	flag.StringVar(&pprofAddress, "pprof-address", "", "Serve the pprof profiles, e.g. of the goroutines, heap and mutex contention, on /debug/pprof/ over HTTP on this address, e.g. 127.0.0.1:6060 to only reach it through oc port-forward; disabled if empty")
+	flag.StringVar(&tracingEndpoint, "tracing-otlp-endpoint", "", "Trace the syncs, the cloud calls and the requests to the cloud API and the API server, exporting the spans over OTLP/HTTP to the collector at this URL, e.g. http://otel-collector:4318; disabled if empty")
+	flag.Float64Var(&tracingSampleRatio, "tracing-sample-ratio", 1, "Fraction of the traces to record and export, between 0 and 1")
+	// The default leader election values are from
+	// https://github.com/openshift/library-go/pull/1104, which tolerate a 60s
+	// disruption of the API server without the leader stepping down.
+	flag.DurationVar(&leaseDuration, "leader-election-lease-duration", 137*time.Second, "How long a replica waits after the last renewal of the leader election lease before taking it over, i.e. how long egress IPs aren't reconciled after the leader crashed")
+	flag.DurationVar(&renewDeadline, "leader-election-renew-deadline", 107*time.Second, "How long the leader retries to renew the leader election lease before stepping down, i.e. the API server disruption it tolerates; must be shorter than -leader-election-lease-duration")
+	flag.DurationVar(&retryPeriod, "leader-election-retry-period", 26*time.Second, "Interval between the attempts to acquire or renew the leader election lease; -leader-election-renew-deadline must exceed 1.2 times this period")
 	flag.StringVar(&kubeConfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
 	flag.Parse()
 
 	// Verify required arguments
-	if secretName == "" || platformCfg.PlatformType == "" {
+	// There's no cloud API, nor credentials, on platforms of type None, nor
+	// with the in-memory cloud, which replaces the platform's.
+	_, fakeCloud := os.LookupEnv(cloudprovider.FakeCloudProviderEnvVar)
+	if !fakeCloud && ((secretName == "" && platformCfg.PlatformType != cloudprovider.PlatformTypeNone) || platformCfg.PlatformType == "") {
 		klog.Exit("-secret-name or -platform-type is empty, cannot initialize controller")
 	}
 
+	// The retries of errors needing intervention are configured for both
+	// controllers at once.
+	nodeRetryPolicy.InterventionBaseDelay = cpicRetryPolicy.InterventionBaseDelay
+	nodeRetryPolicy.InterventionMaxDelay = cpicRetryPolicy.InterventionMaxDelay
+	for name, policy := range map[string]controller.RetryPolicy{"cloud-private-ip-config": cpicRetryPolicy, "node": nodeRetryPolicy} {
+		if policy.BaseDelay <= 0 || policy.MaxDelay < policy.BaseDelay || policy.MaxRetries < 0 {
+			klog.Exitf("Invalid %s retry policy: the base delay must be positive and at most the max delay, and the max retries not negative", name)
+		}
+	}
+	if cpicRetryPolicy.InterventionBaseDelay <= 0 || cpicRetryPolicy.InterventionMaxDelay < cpicRetryPolicy.InterventionBaseDelay {
+		klog.Exit("Invalid -quota-error-retry-base-delay or -quota-error-retry-max-delay: the base delay must be positive and at most the max delay")
+	}
+
+	if retryPeriod <= 0 || renewDeadline <= time.Duration(leaderelection.JitterFactor*float64(retryPeriod)) || leaseDuration <= renewDeadline {
+		klog.Exit("Invalid leader election timings: -leader-election-lease-duration must exceed -leader-election-renew-deadline, which must exceed 1.2 times a positive -leader-election-retry-period")
+	}
+	if verifyCfg.ProbePort != 0 && verifyCfg.ProbeImage == "" {
+		klog.Exit("-verify-probe-image is required with -verify-probe-port")
+	}
+	if cloudProbePeriod <= 0 || stuckTimeout <= 0 {
+		klog.Exit("Invalid -health-cloud-probe-period or -health-stuck-timeout: both must be positive")
+	}
+
 	// These are populated by the downward API
 	controllerNamespace = os.Getenv(controllerNamespaceEnvVar)
 	controllerName = os.Getenv(controllerNameEnvVar)
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	cloudprivateipconfigcontroller "github.com/openshift/cloud-network-config-controller/pkg/controller/cloudprivateipconfig"
+)
+
+// isProbeReachability returns true if the binary is run as the subcommand of
+// the verifier pods, see -verify-probe-port.
+func isProbeReachability() bool {
+	return len(os.Args) > 1 && os.Args[1] == cloudprivateipconfigcontroller.ProbeReachabilityCommand
+}
+
+// probeReachability probes the reachability of an IP address on a TCP port
+// from where the verifier pod runs.
+func probeReachability(args []string) error {
+	flags := flag.NewFlagSet(cloudprivateipconfigcontroller.ProbeReachabilityCommand, flag.ExitOnError)
+	ip := flags.String("ip", "", "IP address to probe")
+	port := flags.Int("port", 0, "TCP port to probe the IP address on")
+	timeout := flags.Duration("timeout", 3*time.Second, "Timeout of the probe")
+	flags.Parse(args)
+	parsedIP := net.ParseIP(*ip)
+	if parsedIP == nil || *port <= 0 {
+		return fmt.Errorf("invalid IP address %q or port %d", *ip, *port)
+	}
+	if err := cloudprivateipconfigcontroller.ProbeTCP(parsedIP, *port, *timeout); err != nil {
+		return fmt.Errorf("IP address %s is unreachable on port %d, err: %v", parsedIP, *port, err)
+	}
+	return nil
+}
@@ -0,0 +1,367 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+// PlatformTypeAlibabaCloud is the string representation for the Alibaba
+// Cloud platform type.
+const PlatformTypeAlibabaCloud = "AlibabaCloud"
+
+// AlibabaCloud implements the API wrapper for talking to the Alibaba Cloud ECS
+// and VPC APIs. Egress IPs are secondary private IP addresses of the primary
+// ENI of the instance.
+type AlibabaCloud struct {
+	CloudProvider
+	noOwnedResources
+	client      *alibabaClient
+	region      string
+	ecsEndpoint string
+	vpcEndpoint string
+
+	// instanceTypes caches the number of IPv4 and IPv6 addresses the ENIs of
+	// each instance type can hold, which never changes.
+	instanceTypesLock sync.Mutex
+	instanceTypes     map[string]alibabaInstanceType
+}
+
+type alibabaInstanceType struct {
+	InstanceTypeID              string `json:"InstanceTypeId"`
+	EniPrivateIPAddressQuantity int    `json:"EniPrivateIpAddressQuantity"`
+	EniIPv6AddressQuantity      int    `json:"EniIpv6AddressQuantity"`
+}
+
+type alibabaNetworkInterface struct {
+	NetworkInterfaceID string `json:"NetworkInterfaceId"`
+	Type               string `json:"Type"`
+	InstanceID         string `json:"InstanceId"`
+	VSwitchID          string `json:"VSwitchId"`
+	MacAddress         string `json:"MacAddress"`
+	PrivateIPSets      struct {
+		PrivateIPSet []struct {
+			PrivateIPAddress string `json:"PrivateIpAddress"`
+			Primary          bool   `json:"Primary"`
+		} `json:"PrivateIpSet"`
+	} `json:"PrivateIpSets"`
+	IPv6Sets struct {
+		IPv6Set []struct {
+			IPv6Address string `json:"Ipv6Address"`
+		} `json:"Ipv6Set"`
+	} `json:"Ipv6Sets"`
+}
+
+func (a *AlibabaCloud) initCredentials() error {
+	accessKeyID, err := a.readSecretData("alibabacloud_access_key_id")
+	if err != nil {
+		return err
+	}
+	accessKeySecret, err := a.readSecretData("alibabacloud_access_key_secret")
+	if err != nil {
+		return err
+	}
+	if a.cfg.AlibabaCloudRegion == "" {
+		return fmt.Errorf("the Alibaba Cloud region is needed to reach the ECS and VPC APIs of the region")
+	}
+	httpClient, err := newHTTPClient(a.cfg.ConfigDir)
+	if err != nil {
+		return err
+	}
+	a.region = a.cfg.AlibabaCloudRegion
+	a.ecsEndpoint = a.cfg.APIOverride
+	if a.ecsEndpoint == "" {
+		a.ecsEndpoint = fmt.Sprintf("https://ecs.%s.aliyuncs.com", a.region)
+	}
+	a.vpcEndpoint = a.cfg.AlibabaCloudVPCAPIURL
+	if a.vpcEndpoint == "" {
+		a.vpcEndpoint = fmt.Sprintf("https://vpc.%s.aliyuncs.com", a.region)
+	}
+	a.client = &alibabaClient{
+		httpClient:      httpClient,
+		accessKeyID:     strings.TrimSpace(accessKeyID),
+		accessKeySecret: strings.TrimSpace(accessKeySecret),
+	}
+	klog.Infof("Using the Alibaba Cloud ECS API at %s and VPC API at %s", a.ecsEndpoint, a.vpcEndpoint)
+	return nil
+}
+
+// AssignPrivateIP assigns ip to the primary ENI of the node's instance as a
+// secondary private IP address, or IPv6 address.
+func (a *AlibabaCloud) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	networkInterface, err := a.getNetworkInterface(ctx, node)
+	if err != nil {
+		return err
+	}
+	if hasAlibabaIP(networkInterface, ip) {
+		return AlreadyExistingIPError
+	}
+	action, param := "AssignPrivateIpAddresses", "PrivateIpAddress.1"
+	if utilnet.IsIPv6(ip) {
+		action, param = "AssignIpv6Addresses", "Ipv6Address.1"
+	}
+	if err := a.client.do(ctx, a.ecsEndpoint, alibabaECSVersion, action, map[string]string{
+		"RegionId":           a.region,
+		"NetworkInterfaceId": networkInterface.NetworkInterfaceID,
+		param:                ip.String(),
+	}, nil); err != nil {
+		return fmt.Errorf("error assigning IP address %s to ENI %s, err: %v", ip, networkInterface.NetworkInterfaceID, err)
+	}
+	return nil
+}
+
+func (a *AlibabaCloud) AllowsMovePrivateIP() bool {
+	return false
+}
+
+func (a *AlibabaCloud) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+	return nil
+}
+
+// ReleasePrivateIP unassigns ip from the primary ENI of the node's instance.
+func (a *AlibabaCloud) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	networkInterface, err := a.getNetworkInterface(ctx, node)
+	if err != nil {
+		return err
+	}
+	if !hasAlibabaIP(networkInterface, ip) {
+		return NonExistingIPError
+	}
+	// IPv6 addresses aren't primary, the ones of the node are kept.
+	for _, nodeIP := range nodeInternalIPs(node) {
+		if nodeIP.Equal(ip) {
+			return NonExistingIPError
+		}
+	}
+	action, param := "UnassignPrivateIpAddresses", "PrivateIpAddress.1"
+	if utilnet.IsIPv6(ip) {
+		action, param = "UnassignIpv6Addresses", "Ipv6Address.1"
+	}
+	return a.client.do(ctx, a.ecsEndpoint, alibabaECSVersion, action, map[string]string{
+		"RegionId":           a.region,
+		"NetworkInterfaceId": networkInterface.NetworkInterfaceID,
+		param:                ip.String(),
+	}, nil)
+}
+
+func (a *AlibabaCloud) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, a.AssignPrivateIP)
+}
+
+func (a *AlibabaCloud) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, a.ReleasePrivateIP)
+}
+
+// GetNodeEgressIPConfiguration returns the configuration of the primary ENI of
+// the node's instance, keyed by ID. Its capacity is the number of addresses
+// the ENIs of the instance type can hold but the ones assigned.
+func (a *AlibabaCloud) GetNodeEgressIPConfiguration(ctx context.Context, node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
+	networkInterface, err := a.getNetworkInterface(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	vSwitch := &struct {
+		CidrBlock     string `json:"CidrBlock"`
+		IPv6CidrBlock string `json:"Ipv6CidrBlock"`
+	}{}
+	if err := a.client.do(ctx, a.vpcEndpoint, alibabaVPCVersion, "DescribeVSwitchAttributes", map[string]string{
+		"RegionId":  a.region,
+		"VSwitchId": networkInterface.VSwitchID,
+	}, vSwitch); err != nil {
+		return nil, fmt.Errorf("error retrieving vSwitch %s, err: %v", networkInterface.VSwitchID, err)
+	}
+	instanceType, err := a.getInstanceType(ctx, networkInterface.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+	config := &NodeEgressIPConfiguration{
+		Interface: networkInterface.NetworkInterfaceID,
+		MAC:       normalizeMAC(networkInterface.MacAddress),
+	}
+	if vSwitch.CidrBlock != "" {
+		_, cidr, err := net.ParseCIDR(vSwitch.CidrBlock)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the CIDR %q of vSwitch %s, err: %v", vSwitch.CidrBlock, networkInterface.VSwitchID, err)
+		}
+		config.IFAddr.IPv4 = cidr.String()
+		config.Capacity.IPv4 = instanceType.EniPrivateIPAddressQuantity - len(networkInterface.PrivateIPSets.PrivateIPSet)
+	}
+	if vSwitch.IPv6CidrBlock != "" {
+		_, cidr, err := net.ParseCIDR(vSwitch.IPv6CidrBlock)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the IPv6 CIDR %q of vSwitch %s, err: %v", vSwitch.IPv6CidrBlock, networkInterface.VSwitchID, err)
+		}
+		config.IFAddr.IPv6 = cidr.String()
+		config.Capacity.IPv6 = instanceType.EniIPv6AddressQuantity - len(networkInterface.IPv6Sets.IPv6Set)
+	}
+	if config.Capacity.IPv4 < 0 {
+		config.Capacity.IPv4 = 0
+	}
+	if config.Capacity.IPv6 < 0 {
+		config.Capacity.IPv6 = 0
+	}
+	return []*NodeEgressIPConfiguration{config}, nil
+}
+
+// CleanupNode is a no-op, private IPs are deleted together with the instance.
+func (a *AlibabaCloud) CleanupNode(ctx context.Context, node *corev1.Node) error {
+	return nil
+}
+
+// VerifyPrivateIP verifies that ip is still assigned to the primary ENI of the
+// node's instance, wrapping a MissingIPError otherwise.
+func (a *AlibabaCloud) VerifyPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	networkInterface, err := a.getNetworkInterface(ctx, node)
+	if err != nil {
+		return err
+	}
+	if !hasAlibabaIP(networkInterface, ip) {
+		return fmt.Errorf("%w: IP address %s is not assigned to ENI %s", MissingIPError, ip, networkInterface.NetworkInterfaceID)
+	}
+	return nil
+}
+
+// GetPrivateIPReservations returns nil, secondary private IP addresses aren't
+// resources of their own.
+func (a *AlibabaCloud) GetPrivateIPReservations(ctx context.Context, ip net.IP, node *corev1.Node) ([]PrivateIPReservation, error) {
+	return nil, nil
+}
+
+// GetNodeNetworkInterfaces returns nil, the secondary ENIs of instances aren't
+// tracked.
+func (a *AlibabaCloud) GetNodeNetworkInterfaces(ctx context.Context, node *corev1.Node) ([]string, error) {
+	return nil, nil
+}
+
+// ListPrivateIPs returns the secondary private IPv4 addresses and the IPv6
+// addresses of the node's ENI.
+func (a *AlibabaCloud) ListPrivateIPs(ctx context.Context, node *corev1.Node) ([]net.IP, error) {
+	networkInterface, err := a.getNetworkInterface(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	ips := []net.IP{}
+	for _, privateIP := range networkInterface.PrivateIPSets.PrivateIPSet {
+		if !privateIP.Primary {
+			ips = append(ips, ParseIP(privateIP.PrivateIPAddress))
+		}
+	}
+	for _, ipv6 := range networkInterface.IPv6Sets.IPv6Set {
+		ips = append(ips, ParseIP(ipv6.IPv6Address))
+	}
+	return ips, nil
+}
+
+// CheckHealth retrieves the primary ENI of the node's instance.
+func (a *AlibabaCloud) CheckHealth(ctx context.Context, node *corev1.Node) error {
+	_, err := a.getNetworkInterface(ctx, node)
+	return err
+}
+
+// getNetworkInterface returns the primary ENI of the node's instance.
+func (a *AlibabaCloud) getNetworkInterface(ctx context.Context, node *corev1.Node) (*alibabaNetworkInterface, error) {
+	instanceID, err := getAlibabaInstanceID(node)
+	if err != nil {
+		return nil, err
+	}
+	response := &struct {
+		NetworkInterfaceSets struct {
+			NetworkInterfaceSet []alibabaNetworkInterface `json:"NetworkInterfaceSet"`
+		} `json:"NetworkInterfaceSets"`
+	}{}
+	if err := a.client.do(ctx, a.ecsEndpoint, alibabaECSVersion, "DescribeNetworkInterfaces", map[string]string{
+		"RegionId":   a.region,
+		"InstanceId": instanceID,
+		"Type":       "Primary",
+	}, response); err != nil {
+		return nil, fmt.Errorf("error retrieving the ENIs of instance %s of node %s, err: %v", instanceID, node.Name, err)
+	}
+	for _, networkInterface := range response.NetworkInterfaceSets.NetworkInterfaceSet {
+		if networkInterface.Type == "Primary" && networkInterface.InstanceID == instanceID {
+			return &networkInterface, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: instance %s of node %s has no primary ENI", NoNetworkInterfaceError, instanceID, node.Name)
+}
+
+// getInstanceType returns the type of the instance, from the cache or the ECS
+// API.
+func (a *AlibabaCloud) getInstanceType(ctx context.Context, instanceID string) (alibabaInstanceType, error) {
+	instances := &struct {
+		Instances struct {
+			Instance []struct {
+				InstanceType string `json:"InstanceType"`
+			} `json:"Instance"`
+		} `json:"Instances"`
+	}{}
+	ids, _ := json.Marshal([]string{instanceID})
+	if err := a.client.do(ctx, a.ecsEndpoint, alibabaECSVersion, "DescribeInstances", map[string]string{
+		"RegionId":    a.region,
+		"InstanceIds": string(ids),
+	}, instances); err != nil {
+		return alibabaInstanceType{}, fmt.Errorf("error retrieving instance %s, err: %v", instanceID, err)
+	}
+	if len(instances.Instances.Instance) != 1 {
+		return alibabaInstanceType{}, fmt.Errorf("instance %s doesn't exist", instanceID)
+	}
+	typeID := instances.Instances.Instance[0].InstanceType
+
+	a.instanceTypesLock.Lock()
+	defer a.instanceTypesLock.Unlock()
+	if instanceType, ok := a.instanceTypes[typeID]; ok {
+		return instanceType, nil
+	}
+	types := &struct {
+		InstanceTypes struct {
+			InstanceType []alibabaInstanceType `json:"InstanceType"`
+		} `json:"InstanceTypes"`
+	}{}
+	if err := a.client.do(ctx, a.ecsEndpoint, alibabaECSVersion, "DescribeInstanceTypes", map[string]string{
+		"InstanceTypes.1": typeID,
+	}, types); err != nil {
+		return alibabaInstanceType{}, fmt.Errorf("error retrieving instance type %s, err: %v", typeID, err)
+	}
+	for _, instanceType := range types.InstanceTypes.InstanceType {
+		if instanceType.InstanceTypeID == typeID {
+			if a.instanceTypes == nil {
+				a.instanceTypes = map[string]alibabaInstanceType{}
+			}
+			a.instanceTypes[typeID] = instanceType
+			return instanceType, nil
+		}
+	}
+	return alibabaInstanceType{}, fmt.Errorf("instance type %s doesn't exist", typeID)
+}
+
+// hasAlibabaIP returns true if ip is a secondary private IP address, or an
+// IPv6 address, of the ENI.
+func hasAlibabaIP(networkInterface *alibabaNetworkInterface, ip net.IP) bool {
+	for _, privateIP := range networkInterface.PrivateIPSets.PrivateIPSet {
+		if !privateIP.Primary && ParseIP(privateIP.PrivateIPAddress).Equal(ip) {
+			return true
+		}
+	}
+	for _, ipv6 := range networkInterface.IPv6Sets.IPv6Set {
+		if ParseIP(ipv6.IPv6Address).Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// getAlibabaInstanceID returns the ID of the node's instance, out of its
+// providerID, which looks like <region>.<instance ID>.
+func getAlibabaInstanceID(node *corev1.Node) (string, error) {
+	instanceID := node.Spec.ProviderID[strings.LastIndex(node.Spec.ProviderID, ".")+1:]
+	if !strings.HasPrefix(instanceID, "i-") || instanceID == node.Spec.ProviderID {
+		return "", fmt.Errorf("failed to parse node %s provider id %q, expected <region>.<instance ID>", node.Name, node.Spec.ProviderID)
+	}
+	return instanceID, nil
+}
@@ -0,0 +1,190 @@
+package cloudprovider
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// alibabaECSVersion and alibabaVPCVersion are the versions of the ECS and
+	// VPC APIs requested.
+	alibabaECSVersion = "2014-05-26"
+	alibabaVPCVersion = "2016-04-28"
+
+	// alibabaMaxRetries is the number of times throttled requests are retried,
+	// after alibabaRetryBaseDelay at first, the delay doubling with every
+	// retry up to alibabaRetryMaxDelay.
+	alibabaMaxRetries     = 4
+	alibabaRetryBaseDelay = time.Second
+	alibabaRetryMaxDelay  = 16 * time.Second
+)
+
+// alibabaClient sends the RPC style requests of the ECS and VPC APIs, signed
+// with the AccessKey pair of the secret, and retries the throttled ones.
+type alibabaClient struct {
+	httpClient      *http.Client
+	accessKeyID     string
+	accessKeySecret string
+	// baseDelay is the delay of the first retry, alibabaRetryBaseDelay if 0.
+	baseDelay time.Duration
+}
+
+// alibabaError is the body of the responses of failed requests.
+type alibabaError struct {
+	RequestID string `json:"RequestId"`
+	Code      string `json:"Code"`
+	Message   string `json:"Message"`
+}
+
+// do sends the action of the API at endpoint, of version, with params, and
+// decodes the JSON of the response into out, if not nil. Requests failing
+// with a Throttling error code, or answered with 503 Service Unavailable, are
+// retried with exponential backoff: they weren't carried out.
+func (c *alibabaClient) do(ctx context.Context, endpoint, version, action string, params map[string]string, out interface{}) error {
+	delay := c.baseDelay
+	if delay <= 0 {
+		delay = alibabaRetryBaseDelay
+	}
+	for retry := 0; ; retry++ {
+		err := c.send(ctx, endpoint, version, action, params, out)
+		if err == nil || retry >= alibabaMaxRetries || !isAlibabaRetryable(err) {
+			return err
+		}
+		// Full jitter, so that the workers throttled together don't retry
+		// together as well.
+		wait := time.Duration(mathrand.Int63n(int64(delay)) + 1)
+		klog.Warningf("Alibaba Cloud request %s was throttled, retrying in %v, err: %v", action, wait, err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		if delay *= 2; delay > alibabaRetryMaxDelay {
+			delay = alibabaRetryMaxDelay
+		}
+	}
+}
+
+func (c *alibabaClient) send(ctx context.Context, endpoint, version, action string, params map[string]string, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, restRequestTimeout)
+	defer cancel()
+
+	query, err := c.sign(http.MethodGet, version, action, params)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(endpoint, "/")+"/?"+query, nil)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("User-Agent", UserAgent)
+	resp, err := c.httpClient.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &restError{method: http.MethodGet, url: action, statusCode: resp.StatusCode, body: string(body)}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("error decoding the response of %s, err: %v", action, err)
+	}
+	return nil
+}
+
+// sign returns the query of the request, signed with version 1.0 of the
+// signature of RPC style APIs: the HMAC-SHA1 of the method and the sorted,
+// percent-encoded parameters, keyed by the AccessKey secret followed by an
+// ampersand.
+func (c *alibabaClient) sign(method, version, action string, params map[string]string) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	values := map[string]string{
+		"Action":           action,
+		"Version":          version,
+		"Format":           "JSON",
+		"AccessKeyId":      c.accessKeyID,
+		"SignatureMethod":  "HMAC-SHA1",
+		"SignatureVersion": "1.0",
+		"SignatureNonce":   hex.EncodeToString(nonce),
+		"Timestamp":        time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	for key, value := range params {
+		values[key] = value
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, alibabaPercentEncode(key)+"="+alibabaPercentEncode(values[key]))
+	}
+	query := strings.Join(pairs, "&")
+	stringToSign := method + "&" + alibabaPercentEncode("/") + "&" + alibabaPercentEncode(query)
+	mac := hmac.New(sha1.New, []byte(c.accessKeySecret+"&"))
+	mac.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return query + "&Signature=" + alibabaPercentEncode(signature), nil
+}
+
+// alibabaPercentEncode percent-encodes s as RFC 3986 does, as the signature
+// requires: spaces are %20, asterisks %2A and tildes aren't encoded.
+func alibabaPercentEncode(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.ReplaceAll(s, "+", "%20")
+	s = strings.ReplaceAll(s, "*", "%2A")
+	return strings.ReplaceAll(s, "%7E", "~")
+}
+
+// isAlibabaRetryable returns true if the request failed with a Throttling
+// error code, e.g. Throttling.User, or was answered with 503 Service
+// Unavailable.
+func isAlibabaRetryable(err error) bool {
+	if isRESTStatus(err, http.StatusServiceUnavailable) {
+		return true
+	}
+	return strings.HasPrefix(getAlibabaErrorCode(err), "Throttling")
+}
+
+// getAlibabaErrorCode returns the error code of the failed request, e.g.
+// InvalidIp.Address.Duplicate, empty if it's no error of the API.
+func getAlibabaErrorCode(err error) string {
+	var restErr *restError
+	if !errors.As(err, &restErr) {
+		return ""
+	}
+	body := &alibabaError{}
+	if err := json.Unmarshal([]byte(restErr.body), body); err != nil {
+		return ""
+	}
+	return body.Code
+}
@@ -0,0 +1,251 @@
+package cloudprovider
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeAlibabaCloud serves the ECS and VPC API requests of instance i-0 of type
+// ecs.g6.large, whose primary ENI eni-0 is in vSwitch vsw-0.
+type fakeAlibabaCloud struct {
+	mu         sync.Mutex
+	privateIPs []string
+	ipv6s      []string
+	actions    []string
+	// throttled is the number of requests answered with Throttling.User
+	// before the others are served.
+	throttled int
+}
+
+// verifyAlibabaSignature returns true if the request is signed with the
+// secret.
+func verifyAlibabaSignature(r *http.Request, secret string) bool {
+	values := r.URL.Query()
+	signature := values.Get("Signature")
+	values.Del("Signature")
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := []string{}
+	for _, key := range keys {
+		pairs = append(pairs, alibabaPercentEncode(key)+"="+alibabaPercentEncode(values.Get(key)))
+	}
+	mac := hmac.New(sha1.New, []byte(secret+"&"))
+	mac.Write([]byte("GET&%2F&" + alibabaPercentEncode(strings.Join(pairs, "&"))))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)) == signature
+}
+
+func (f *fakeAlibabaCloud) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	query := r.URL.Query()
+	if query.Get("AccessKeyId") != "access-key-id" || !verifyAlibabaSignature(r, "access-key-secret") {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"Code": "SignatureDoesNotMatch"}`))
+		return
+	}
+	action := query.Get("Action")
+	f.actions = append(f.actions, action)
+	if f.throttled > 0 {
+		f.throttled--
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"Code": "Throttling.User", "Message": "Request was denied due to user flow control."}`))
+		return
+	}
+	switch action {
+	case "DescribeNetworkInterfaces":
+		if query.Get("InstanceId") != "i-0" || query.Get("Type") != "Primary" {
+			_, _ = w.Write([]byte(`{"NetworkInterfaceSets": {"NetworkInterfaceSet": []}}`))
+			return
+		}
+		networkInterface := alibabaNetworkInterface{NetworkInterfaceID: "eni-0", Type: "Primary", InstanceID: "i-0", VSwitchID: "vsw-0", MacAddress: "00:16:3e:00:00:01"}
+		for i, ip := range f.privateIPs {
+			networkInterface.PrivateIPSets.PrivateIPSet = append(networkInterface.PrivateIPSets.PrivateIPSet, struct {
+				PrivateIPAddress string `json:"PrivateIpAddress"`
+				Primary          bool   `json:"Primary"`
+			}{PrivateIPAddress: ip, Primary: i == 0})
+		}
+		for _, ip := range f.ipv6s {
+			networkInterface.IPv6Sets.IPv6Set = append(networkInterface.IPv6Sets.IPv6Set, struct {
+				IPv6Address string `json:"Ipv6Address"`
+			}{IPv6Address: ip})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"NetworkInterfaceSets": map[string]interface{}{"NetworkInterfaceSet": []alibabaNetworkInterface{networkInterface}},
+		})
+	case "AssignPrivateIpAddresses":
+		f.privateIPs = append(f.privateIPs, query.Get("PrivateIpAddress.1"))
+	case "AssignIpv6Addresses":
+		f.ipv6s = append(f.ipv6s, query.Get("Ipv6Address.1"))
+	case "UnassignPrivateIpAddresses":
+		for i, ip := range f.privateIPs {
+			if ip == query.Get("PrivateIpAddress.1") {
+				f.privateIPs = append(f.privateIPs[:i], f.privateIPs[i+1:]...)
+			}
+		}
+	case "UnassignIpv6Addresses":
+		for i, ip := range f.ipv6s {
+			if ip == query.Get("Ipv6Address.1") {
+				f.ipv6s = append(f.ipv6s[:i], f.ipv6s[i+1:]...)
+			}
+		}
+	case "DescribeVSwitchAttributes":
+		_, _ = w.Write([]byte(`{"VSwitchId": "vsw-0", "CidrBlock": "172.16.0.0/24", "Ipv6CidrBlock": "2408:4000::/64"}`))
+	case "DescribeInstances":
+		_, _ = w.Write([]byte(`{"Instances": {"Instance": [{"InstanceId": "i-0", "InstanceType": "ecs.g6.large"}]}}`))
+	case "DescribeInstanceTypes":
+		_, _ = w.Write([]byte(`{"InstanceTypes": {"InstanceType": [{"InstanceTypeId": "ecs.g6.large", "EniPrivateIpAddressQuantity": 6, "EniIpv6AddressQuantity": 1}]}}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeAlibabaCloudProvider(server *httptest.Server) *AlibabaCloud {
+	return &AlibabaCloud{
+		CloudProvider: CloudProvider{ctx: context.Background()},
+		client: &alibabaClient{
+			httpClient:      server.Client(),
+			accessKeyID:     "access-key-id",
+			accessKeySecret: "access-key-secret",
+			baseDelay:       time.Millisecond,
+		},
+		region:      "cn-hangzhou",
+		ecsEndpoint: server.URL,
+		vpcEndpoint: server.URL,
+	}
+}
+
+func newAlibabaCloudNode() *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0"},
+		Spec:       corev1.NodeSpec{ProviderID: "cn-hangzhou.i-0"},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "172.16.0.10"}},
+		},
+	}
+}
+
+// newAlibabaCloudFakeCloud plugs the fake API into the tests shared by the
+// clouds.
+func newAlibabaCloudFakeCloud(t *testing.T) *fakeCloud {
+	fake := &fakeAlibabaCloud{privateIPs: []string{"172.16.0.10"}}
+	server := httptest.NewServer(fake)
+	return &fakeCloud{
+		CloudProviderIntf: newFakeAlibabaCloudProvider(server),
+		assigned: func() []string {
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			// The first private IP address is the primary one.
+			return append(append([]string{}, fake.privateIPs[1:]...), fake.ipv6s...)
+		},
+		close: server.Close,
+	}
+}
+
+func TestAlibabaCloudAssignPrivateIP(t *testing.T) {
+	tcs := []struct {
+		ip        string
+		throttled int
+		expectErr bool
+		// expectedRequests is the number of requests sent, retries included.
+		expectedRequests int
+	}{
+		{ip: "172.16.0.20", throttled: 2, expectedRequests: 4},
+		// Requests are retried at most alibabaMaxRetries times.
+		{ip: "172.16.0.20", throttled: 10, expectErr: true, expectedRequests: alibabaMaxRetries + 1},
+	}
+	for i, tc := range tcs {
+		fake := &fakeAlibabaCloud{privateIPs: []string{"172.16.0.10"}, throttled: tc.throttled}
+		server := httptest.NewServer(fake)
+		provider := newFakeAlibabaCloudProvider(server)
+		err := provider.AssignPrivateIP(context.Background(), net.ParseIP(tc.ip), newAlibabaCloudNode())
+		server.Close()
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestAlibabaCloudAssignPrivateIP(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		if len(fake.actions) != tc.expectedRequests {
+			t.Fatalf("TestAlibabaCloudAssignPrivateIP(%d): expected %d requests, got %v", i, tc.expectedRequests, fake.actions)
+		}
+		if !tc.expectErr && !strings.Contains(strings.Join(append(fake.privateIPs, fake.ipv6s...), ","), tc.ip) {
+			t.Fatalf("TestAlibabaCloudAssignPrivateIP(%d): expected IP address %s to be assigned, got %v and %v", i, tc.ip, fake.privateIPs, fake.ipv6s)
+		}
+	}
+}
+
+func TestAlibabaCloudDescribeInstanceTypeOnce(t *testing.T) {
+	fake := &fakeAlibabaCloud{privateIPs: []string{"172.16.0.10"}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	provider := newFakeAlibabaCloudProvider(server)
+
+	for i := 0; i < 2; i++ {
+		if _, err := provider.GetNodeEgressIPConfiguration(context.Background(), newAlibabaCloudNode()); err != nil {
+			t.Fatalf("received unexpected error, err: %v", err)
+		}
+	}
+	described := 0
+	for _, action := range fake.actions {
+		if action == "DescribeInstanceTypes" {
+			described++
+		}
+	}
+	if described != 1 {
+		t.Fatalf("expected the instance type to be described once, got %v", fake.actions)
+	}
+}
+
+func TestAlibabaPercentEncode(t *testing.T) {
+	tcs := []struct {
+		s        string
+		expected string
+	}{
+		{s: "2024-01-01T00:00:00Z", expected: "2024-01-01T00%3A00%3A00Z"},
+		{s: "a b*c~d", expected: "a%20b%2Ac~d"},
+		{s: `["i-0"]`, expected: "%5B%22i-0%22%5D"},
+		{s: "/", expected: "%2F"},
+	}
+	for i, tc := range tcs {
+		if encoded := alibabaPercentEncode(tc.s); encoded != tc.expected {
+			t.Fatalf("TestAlibabaPercentEncode(%d): expected %q, got %q", i, tc.expected, encoded)
+		}
+	}
+}
+
+func TestGetAlibabaInstanceID(t *testing.T) {
+	tcs := []struct {
+		providerID string
+		expected   string
+		expectErr  bool
+	}{
+		{providerID: "cn-hangzhou.i-bp67acfmxazb4ph3", expected: "i-bp67acfmxazb4ph3"},
+		{providerID: "i-bp67acfmxazb4ph3", expectErr: true},
+		{providerID: "cn-hangzhou.bp67acfmxazb4ph3", expectErr: true},
+		{providerID: "", expectErr: true},
+	}
+	for i, tc := range tcs {
+		node := &corev1.Node{Spec: corev1.NodeSpec{ProviderID: tc.providerID}}
+		instanceID, err := getAlibabaInstanceID(node)
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestGetAlibabaInstanceID(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		if instanceID != tc.expected {
+			t.Fatalf("TestGetAlibabaInstanceID(%d): expected instance ID %q, got %q", i, tc.expected, instanceID)
+		}
+	}
+}
@@ -1,16 +1,27 @@
 package cloudprovider
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
-	awsapi "github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ec2"
+	awsapi "github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/openshift/cloud-network-config-controller/pkg/tracing"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -20,120 +31,355 @@ import (
 
 const (
 	PlatformTypeAWS = "AWS"
+	// awsRoleSessionName identifies the controller in the sessions of the
+	// IAM roles it assumes, i.e. in CloudTrail.
+	awsRoleSessionName = "cloud-network-config-controller"
+	// defaultAWSOperationTimeout is the timeout of all AWS API calls, retries
+	// of throttled requests included.
+	defaultAWSOperationTimeout = time.Minute
 )
 
 // AWS implements the API wrapper for talking to the AWS cloud API
 type AWS struct {
 	CloudProvider
-	client *ec2.EC2
+	client *ec2.Client
+	// networkClient looks up subnets in the account owning the VPC, if it's
+	// shared and AWSNetworkRoleARN is set. It's nil otherwise, see
+	// subnetClient.
+	networkClient *ec2.Client
+	// metadata is the client of the instance metadata service of the instance
+	// the controller runs on. It's nil unless the IMDS fallback is enabled.
+	metadata *imds.Client
+	// instanceTypeCapacities caches the IPv4 and IPv6 capacity per network
+	// interface of the instance types, as an awsInstanceTypeCapacity keyed
+	// by instance type. These never change for a given instance type.
+	instanceTypeCapacities sync.Map
+	// zones caches the *ec2types.AvailabilityZone of the subnets' zones, keyed
+	// by zone name, see getPlacement.
+	zones sync.Map
+	// instances caches the descriptions of the instances for
+	// AWSDescribeCacheTTL, see getInstance.
+	instances awsInstanceCache
+	// networkInterfaceSelector selects the network interface egress IPs are
+	// assigned to on nodes without selector annotation, the first one if nil.
+	networkInterfaceSelector *awsNetworkInterfaceSelector
+	// batches collect concurrent assignments to the same network interface,
+	// if AWSAssignmentBatchWindow is set.
+	batches awsAssignmentBatches
+	// calls are the AssignPrivateIPs calls in progress, whose IP addresses
+	// are sent without waiting for the batch window.
+	calls batchCalls
+	// resourceTags are the extra tags set on the resources the controller
+	// changes, parsed from AWSResourceTags.
+	resourceTags map[string]string
+}
+
+// awsInstanceTypeCapacity is the number of IPv4 and IPv6 addresses which can
+// be assigned to each network interface of an instance type.
+type awsInstanceTypeCapacity struct {
+	ipv4 int
+	ipv6 int
 }
 
 func (a *AWS) initCredentials() error {
-	sessionOpts := session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-		SharedConfigFiles: []string{filepath.Join(a.cfg.CredentialDir, "credentials")},
+	credentialsFile := filepath.Join(a.cfg.CredentialDir, "credentials")
+	loadOpts := []func(*config.LoadOptions) error{
+		config.WithRegion(a.cfg.Region),
+		config.WithSharedConfigFiles([]string{credentialsFile}),
+		config.WithSharedCredentialsFiles([]string{credentialsFile}),
+	}
+	if a.cfg.AWSEndpointOverrides != "" {
+		overrides, err := parseAWSEndpointOverrides(a.cfg.AWSEndpointOverrides)
+		if err != nil {
+			return err
+		}
+		// Set on the configuration, so that it applies to the STS client as
+		// well.
+		loadOpts = append(loadOpts, config.WithEndpointResolverWithOptions(awsEndpointResolver(overrides)))
 	}
-	c := awsapi.NewConfig().WithRegion(a.cfg.Region)
-	if a.cfg.APIOverride != "" {
-		c = c.WithEndpoint(a.cfg.APIOverride)
+	if a.cfg.AWSRetryMode != "" {
+		retryMode, err := awsapi.ParseRetryMode(a.cfg.AWSRetryMode)
+		if err != nil {
+			return fmt.Errorf("invalid AWS retry mode %q, expected one of: %s, %s", a.cfg.AWSRetryMode, awsapi.RetryModeStandard, awsapi.RetryModeAdaptive)
+		}
+		loadOpts = append(loadOpts, config.WithRetryMode(retryMode))
 	}
 	if a.cfg.AWSCAOverride != "" {
-		var err error
-		sessionOpts.CustomCABundle, err = os.Open(a.cfg.AWSCAOverride)
+		caBundle, err := os.Open(a.cfg.AWSCAOverride)
 		if err != nil {
 			return fmt.Errorf("could not open AWS CA bundle %s: %w", a.cfg.AWSCAOverride, err)
 		}
+		defer caBundle.Close()
+		loadOpts = append(loadOpts, config.WithCustomCABundle(caBundle))
 	}
 
-	mySession, err := session.NewSessionWithOptions(sessionOpts)
+	ctx, cancel := context.WithTimeout(a.ctx, defaultAWSOperationTimeout)
+	defer cancel()
+	c, err := config.LoadDefaultConfig(ctx, loadOpts...)
 	if err != nil {
-		return fmt.Errorf("could not initialize AWS session: %w", err)
+		return fmt.Errorf("could not load AWS configuration: %w", err)
 	}
+	c.HTTPClient = newTracedAWSHTTPClient(c.HTTPClient)
 
-	a.client = ec2.New(mySession, c)
+	if a.cfg.AWSIMDSFallback {
+		// The SDK authenticates to the metadata service with IMDSv2 session
+		// tokens.
+		a.metadata = imds.NewFromConfig(c)
+		if a.cfg.Region == "" {
+			output, err := a.metadata.GetRegion(ctx, &imds.GetRegionInput{})
+			if err != nil {
+				return fmt.Errorf("could not resolve AWS region through the instance metadata service: %w", err)
+			}
+			klog.Infof("Resolved AWS region %s through the instance metadata service", output.Region)
+			c.Region = output.Region
+		}
+	}
+
+	creds, err := a.assumeRoleCredentials(c)
+	if err != nil {
+		return err
+	}
+	if creds != nil {
+		c.Credentials = creds
+	}
+
+	if a.networkInterfaceSelector, err = parseAWSNetworkInterfaceSelector(a.cfg.AWSNetworkInterfaceSelector); err != nil {
+		return err
+	}
+
+	if a.resourceTags, err = parseAWSResourceTags(a.cfg.AWSResourceTags); err != nil {
+		return err
+	}
+
+	if a.cfg.AWSMaxRequestRate < 0 {
+		return fmt.Errorf("invalid maximum EC2 API request rate %v, expected a positive rate or 0", a.cfg.AWSMaxRequestRate)
+	}
+	a.client = a.newEC2Client(c)
+	a.initNetworkClient(c)
 	return nil
 }
 
+// newEC2Client returns an EC2 client with configuration c, reaching the API
+// override if set. If AWSMaxRequestRate is set, each client gets its own rate
+// limiter: request rates are limited per account.
+func (a *AWS) newEC2Client(c awsapi.Config) *ec2.Client {
+	return ec2.NewFromConfig(c, func(o *ec2.Options) {
+		if a.cfg.APIOverride != "" {
+			o.EndpointResolver = ec2.EndpointResolverFromURL(a.cfg.APIOverride)
+		}
+		if a.cfg.AWSMaxRequestRate > 0 {
+			o.APIOptions = append(o.APIOptions, newAWSAdaptiveRateLimiter(a.cfg.AWSMaxRequestRate).install)
+		}
+	})
+}
+
+// awsEndpointOverrideServices are the services whose endpoint can be
+// overridden, keyed by the lower case ID their endpoint is resolved with.
+var awsEndpointOverrideServices = sets.NewString(strings.ToLower(ec2.ServiceID), strings.ToLower(sts.ServiceID))
+
+// parseAWSEndpointOverrides parses a comma separated list of
+// <service>=<URL> endpoint overrides.
+func parseAWSEndpointOverrides(s string) (map[string]string, error) {
+	overrides := map[string]string{}
+	for _, override := range strings.Split(s, ",") {
+		override = strings.TrimSpace(override)
+		if override == "" {
+			continue
+		}
+		service, endpoint, ok := strings.Cut(override, "=")
+		service = strings.ToLower(strings.TrimSpace(service))
+		if !ok || !awsEndpointOverrideServices.Has(service) {
+			return nil, fmt.Errorf("invalid AWS endpoint override %q, expected <service>=<URL> with service one of: %s", override, strings.Join(awsEndpointOverrideServices.List(), ", "))
+		}
+		u, err := url.Parse(strings.TrimSpace(endpoint))
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, fmt.Errorf("invalid AWS endpoint override %q, expected an http(s) URL", override)
+		}
+		overrides[service] = u.String()
+	}
+	return overrides, nil
+}
+
+// awsEndpointResolver resolves the endpoints of the services in overrides to
+// their override, and lets the SDK resolve the endpoints of all other
+// services. Requests to overridden endpoints are still signed for the
+// configured region, as required by interface VPC endpoints.
+func awsEndpointResolver(overrides map[string]string) awsapi.EndpointResolverWithOptions {
+	return awsapi.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (awsapi.Endpoint, error) {
+		if endpoint, ok := overrides[strings.ToLower(service)]; ok {
+			return awsapi.Endpoint{
+				URL:           endpoint,
+				SigningRegion: region,
+				Source:        awsapi.EndpointSourceCustom,
+			}, nil
+		}
+		return awsapi.Endpoint{}, &awsapi.EndpointNotFoundError{}
+	})
+}
+
+// assumeRoleCredentials returns the credentials of the IAM role to assume, if
+// one is configured, or nil to use the credentials of the mounted secret. The
+// role is assumed with a web identity token if a token file is configured, and
+// with the credentials of the mounted secret, c being their configuration,
+// otherwise. The returned credentials are refreshed automatically before they
+// expire.
+func (a *AWS) assumeRoleCredentials(c awsapi.Config) (awsapi.CredentialsProvider, error) {
+	if a.cfg.AWSRoleARN == "" {
+		if a.cfg.AWSWebIdentityTokenFile != "" {
+			return nil, fmt.Errorf("a role to assume must be set to authenticate with web identity token file %s", a.cfg.AWSWebIdentityTokenFile)
+		}
+		return nil, nil
+	}
+	// STS is reached on its own endpoint, not on the API override, unless an
+	// endpoint override is configured for it.
+	stsClient := sts.NewFromConfig(c)
+	if a.cfg.AWSWebIdentityTokenFile != "" {
+		klog.Infof("Assuming AWS role %s with web identity token file %s", a.cfg.AWSRoleARN, a.cfg.AWSWebIdentityTokenFile)
+		return awsapi.NewCredentialsCache(stscreds.NewWebIdentityRoleProvider(stsClient, a.cfg.AWSRoleARN, stscreds.IdentityTokenFile(a.cfg.AWSWebIdentityTokenFile), func(o *stscreds.WebIdentityRoleOptions) {
+			o.RoleSessionName = awsRoleSessionName
+		})), nil
+	}
+	klog.Infof("Assuming AWS role %s", a.cfg.AWSRoleARN)
+	return awsapi.NewCredentialsCache(stscreds.NewAssumeRoleProvider(stsClient, a.cfg.AWSRoleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = awsRoleSessionName
+		if a.cfg.AWSRoleExternalID != "" {
+			o.ExternalID = awsapi.String(a.cfg.AWSRoleExternalID)
+		}
+	})), nil
+}
+
 // AssignPrivateIP assigns the IP address to the node by re-providing all
 // existing ones + the new one. It does this on a per-IP-family basis (since the
 // AWS API is separated per family). If the IP is already existing: it returns an
-// AlreadyExistingIPError.
-func (a *AWS) AssignPrivateIP(ip net.IP, node *corev1.Node) error {
-	instance, err := a.getInstance(node)
+// AlreadyExistingIPError. If Elastic IPs are configured, one is associated
+// with the IP address once assigned, even if it was already. The network
+// interface and Elastic IP are then tagged, if configured.
+func (a *AWS) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	instance, err := a.getInstance(ctx, node)
 	if err != nil {
 		return err
 	}
-	networkInterfaces, err := a.getNetworkInterfaces(instance)
+	defer a.instances.invalidate(awsapi.ToString(instance.InstanceId))
+	networkInterface, err := a.getNetworkInterface(ctx, node, instance)
 	if err != nil {
 		return err
 	}
-	// Perform the operation against the first interface listed following the
-	// order AWS specifies.
-	networkInterface := networkInterfaces[0]
-	addIP := ip.String()
+	var placement *awsPlacement
+	if a.usesElasticIPs(ip) {
+		// Refuse before assigning the IP address rather than fail
+		// associating its Elastic IP.
+		if placement, err = a.getPlacement(ctx, networkInterface); err != nil {
+			return err
+		}
+		if !placement.supportsElasticIPs() {
+			return fmt.Errorf("cannot assign IP address %s to node %s: Elastic IPs can't be associated in %s, its traffic egresses through carrier IPs", ip, node.Name, placement)
+		}
+	}
+	err = a.assignPrivateIP(ctx, ip, node, networkInterface)
+	if err != nil && !errors.Is(err, AlreadyExistingIPError) {
+		return err
+	}
+	resourceIDs := []string{awsapi.ToString(networkInterface.NetworkInterfaceId)}
+	if a.usesElasticIPs(ip) {
+		address, eipErr := a.associateElasticIP(ctx, ip, awsapi.ToString(networkInterface.NetworkInterfaceId), placement.networkBorderGroup)
+		if eipErr != nil {
+			return eipErr
+		}
+		resourceIDs = append(resourceIDs, awsapi.ToString(address.AllocationId))
+	}
+	a.tagResources(ctx, node, resourceIDs...)
+	return err
+}
+
+func (a *AWS) assignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node, networkInterface *ec2types.InstanceNetworkInterface) error {
 	if utilnet.IsIPv6(ip) {
 		for _, assignedIPv6 := range networkInterface.Ipv6Addresses {
-			if assignedIP := net.ParseIP(*assignedIPv6.Ipv6Address); assignedIP != nil && assignedIP.Equal(ip) {
+			if assignedIP := ParseIP(*assignedIPv6.Ipv6Address); assignedIP != nil && assignedIP.Equal(ip) {
 				return AlreadyExistingIPError
 			}
 		}
-		input := ec2.AssignIpv6AddressesInput{
-			NetworkInterfaceId: networkInterface.NetworkInterfaceId,
-			Ipv6Addresses:      []*string{&addIP},
-		}
-		_, err = a.client.AssignIpv6Addresses(&input)
-		if err != nil {
-			klog.Errorf("error: %s, tried to assign IP '%s' to interface: %s.", err, addIP, *networkInterface)
+		if err := a.checkIPv6Subnet(ctx, ip, networkInterface); err != nil {
 			return err
 		}
-		return a.waitForCompletion(node, []string{addIP}, false)
+		return a.assignPrivateIPAddresses(ctx, ip, node, networkInterface)
+	} else if a.usesPrefixDelegation(ip) {
+		return a.assignPrivateIPFromPrefix(ctx, ip, awsapi.ToString(networkInterface.NetworkInterfaceId))
 	} else {
 		for _, assignedIPv4 := range networkInterface.PrivateIpAddresses {
-			if assignedIP := net.ParseIP(*assignedIPv4.PrivateIpAddress); assignedIP != nil && assignedIP.Equal(ip) {
+			if assignedIP := ParseIP(*assignedIPv4.PrivateIpAddress); assignedIP != nil && assignedIP.Equal(ip) {
 				return AlreadyExistingIPError
 			}
 		}
-		inputV4 := ec2.AssignPrivateIpAddressesInput{
+		return a.assignPrivateIPAddresses(ctx, ip, node, networkInterface)
+	}
+}
+
+// sendAssignPrivateIPAddresses assigns the IP addresses, all of the same
+// family, to the network interface in a single call and waits until the
+// instance reports them all.
+func (a *AWS) sendAssignPrivateIPAddresses(ctx context.Context, ips []string, node *corev1.Node, networkInterface *ec2types.InstanceNetworkInterface) error {
+	var err error
+	callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+	defer cancel()
+	if utilnet.IsIPv6String(ips[0]) {
+		input := ec2.AssignIpv6AddressesInput{
 			NetworkInterfaceId: networkInterface.NetworkInterfaceId,
-			PrivateIpAddresses: []*string{&addIP},
+			Ipv6Addresses:      ips,
 		}
-		_, err = a.client.AssignPrivateIpAddresses(&inputV4)
-		if err != nil {
-			klog.Errorf("error: %s, tried to assign IP '%s' to interface: %s.", err, addIP, *networkInterface)
-			return err
+		_, err = a.client.AssignIpv6Addresses(callCtx, &input)
+	} else {
+		inputV4 := ec2.AssignPrivateIpAddressesInput{
+			NetworkInterfaceId: networkInterface.NetworkInterfaceId,
+			PrivateIpAddresses: ips,
 		}
-		return a.waitForCompletion(node, []string{addIP}, false)
+		_, err = a.client.AssignPrivateIpAddresses(callCtx, &inputV4)
+	}
+	if err != nil {
+		klog.Errorf("error: %s, tried to assign IPs '%s' to interface: %s.", err, strings.Join(ips, ", "), awsapi.ToString(networkInterface.NetworkInterfaceId))
+		return err
 	}
+	return a.waitForCompletion(ctx, node, ips, false)
 }
 
 func (a *AWS) AllowsMovePrivateIP() bool {
 	return false
 }
 
-func (a *AWS) MovePrivateIP(ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+func (a *AWS) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+	return nil
+}
+
+// CleanupNode is a no-op, private IPs are deleted together with the instance.
+func (a *AWS) CleanupNode(ctx context.Context, node *corev1.Node) error {
 	return nil
 }
 
 // ReleasePrivateIP un-assigns the IP address from the node. It does this on a
 // per-IP-family basis (since the AWS API is separated per family).  If the IP
-// is non-existant: it returns an NonExistingIPError.
-func (a *AWS) ReleasePrivateIP(ip net.IP, node *corev1.Node) error {
-	instance, err := a.getInstance(node)
+// is non-existant: it returns an NonExistingIPError. Elastic IPs associated
+// with the IP address are disassociated first.
+func (a *AWS) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	instance, err := a.getInstance(ctx, node)
 	if err != nil {
 		return err
 	}
-	networkInterfaces, err := a.getNetworkInterfaces(instance)
+	defer a.instances.invalidate(awsapi.ToString(instance.InstanceId))
+	networkInterface, err := a.getNetworkInterface(ctx, node, instance)
 	if err != nil {
 		return err
 	}
-	// Perform the operation against the first interface listed following the
-	// order AWS specifies.
-	networkInterface := networkInterfaces[0]
-	deleteIPs := []*string{}
+	if a.usesElasticIPs(ip) {
+		if err := a.disassociateElasticIPs(ctx, ip, awsapi.ToString(networkInterface.NetworkInterfaceId)); err != nil {
+			return err
+		}
+	}
+	deleteIPs := []string{}
+	callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+	defer cancel()
 	if utilnet.IsIPv6(ip) {
 		for _, assignedIPv6 := range networkInterface.Ipv6Addresses {
-			if assignedIP := net.ParseIP(*assignedIPv6.Ipv6Address); assignedIP != nil && assignedIP.Equal(ip) {
-				deleteIPs = append(deleteIPs, assignedIPv6.Ipv6Address)
+			if assignedIP := ParseIP(*assignedIPv6.Ipv6Address); assignedIP != nil && assignedIP.Equal(ip) {
+				deleteIPs = append(deleteIPs, awsapi.ToString(assignedIPv6.Ipv6Address))
 			}
 		}
 		if len(deleteIPs) == 0 {
@@ -143,15 +389,17 @@ func (a *AWS) ReleasePrivateIP(ip net.IP, node *corev1.Node) error {
 			NetworkInterfaceId: networkInterface.NetworkInterfaceId,
 			Ipv6Addresses:      deleteIPs,
 		}
-		_, err = a.client.UnassignIpv6Addresses(&input)
+		_, err = a.client.UnassignIpv6Addresses(callCtx, &input)
 		if err != nil {
 			return err
 		}
-		return a.waitForCompletion(node, awsapi.StringValueSlice(deleteIPs), true)
+		return a.waitForCompletion(ctx, node, deleteIPs, true)
+	} else if a.usesPrefixDelegation(ip) {
+		return a.releasePrivateIPFromPrefix(ctx, ip, awsapi.ToString(networkInterface.NetworkInterfaceId))
 	} else {
 		for _, assignedIPv4 := range networkInterface.PrivateIpAddresses {
-			if assignedIP := net.ParseIP(*assignedIPv4.PrivateIpAddress); assignedIP != nil && assignedIP.Equal(ip) {
-				deleteIPs = append(deleteIPs, assignedIPv4.PrivateIpAddress)
+			if assignedIP := ParseIP(*assignedIPv4.PrivateIpAddress); assignedIP != nil && assignedIP.Equal(ip) {
+				deleteIPs = append(deleteIPs, awsapi.ToString(assignedIPv4.PrivateIpAddress))
 			}
 		}
 		if len(deleteIPs) == 0 {
@@ -161,32 +409,197 @@ func (a *AWS) ReleasePrivateIP(ip net.IP, node *corev1.Node) error {
 			NetworkInterfaceId: networkInterface.NetworkInterfaceId,
 			PrivateIpAddresses: deleteIPs,
 		}
-		_, err = a.client.UnassignPrivateIpAddresses(&inputV4)
+		_, err = a.client.UnassignPrivateIpAddresses(callCtx, &inputV4)
 		if err != nil {
 			return err
 		}
-		return a.waitForCompletion(node, awsapi.StringValueSlice(deleteIPs), true)
+		return a.waitForCompletion(ctx, node, deleteIPs, true)
+	}
+}
+
+// AssignPrivateIPs assigns the IP addresses concurrently if assignments are
+// batched, for those to the same network interface to be sent in a single
+// call, and in turn otherwise.
+func (a *AWS) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	if a.cfg.AWSAssignmentBatchWindow > 0 {
+		return a.calls.apply(ctx, ips, node, a.AssignPrivateIP)
+	}
+	return eachPrivateIP(ctx, ips, node, a.AssignPrivateIP)
+}
+
+// BatchesAssignPrivateIPs returns true if assignments are batched.
+func (a *AWS) BatchesAssignPrivateIPs() bool {
+	return a.cfg.AWSAssignmentBatchWindow > 0
+}
+
+// ReleasePrivateIPs releases the IP addresses in turn, releases aren't
+// batched.
+func (a *AWS) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, a.ReleasePrivateIP)
+}
+
+// GetPrivateIPReservations returns nil, the IP address is held by the
+// instance's interface itself.
+func (a *AWS) GetPrivateIPReservations(ctx context.Context, ip net.IP, node *corev1.Node) ([]PrivateIPReservation, error) {
+	return nil, nil
+}
+
+// VerifyPrivateIP verifies that the interface the IP address was assigned to is
+// still attached to the instance and holds the IP address.
+func (a *AWS) VerifyPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	instance, err := a.getInstance(ctx, node)
+	if err != nil {
+		return err
+	}
+	networkInterface, err := a.getNetworkInterface(ctx, node, instance)
+	if err != nil {
+		return err
+	}
+	if networkInterface.Attachment == nil || networkInterface.Attachment.Status != ec2types.AttachmentStatusAttached {
+		return fmt.Errorf("network interface %s of node %s is not attached", awsapi.ToString(networkInterface.NetworkInterfaceId), node.Name)
+	}
+	if a.usesElasticIPs(ip) {
+		if err := a.verifyElasticIP(ctx, ip, awsapi.ToString(networkInterface.NetworkInterfaceId)); err != nil {
+			return err
+		}
+	}
+	if a.usesPrefixDelegation(ip) {
+		return a.verifyPrivateIPFromPrefix(ctx, ip, awsapi.ToString(networkInterface.NetworkInterfaceId))
+	}
+	var assignedIPs []string
+	if utilnet.IsIPv6(ip) {
+		for _, assignedIPv6 := range networkInterface.Ipv6Addresses {
+			assignedIPs = append(assignedIPs, awsapi.ToString(assignedIPv6.Ipv6Address))
+		}
+	} else {
+		for _, assignedIPv4 := range networkInterface.PrivateIpAddresses {
+			assignedIPs = append(assignedIPs, awsapi.ToString(assignedIPv4.PrivateIpAddress))
+		}
 	}
+	for _, assignedIP := range assignedIPs {
+		if ip.Equal(ParseIP(assignedIP)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: IP address %s is not assigned to network interface %s of node %s", MissingIPError, ip, awsapi.ToString(networkInterface.NetworkInterfaceId), node.Name)
 }
 
-func (a *AWS) GetNodeEgressIPConfiguration(node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
-	instance, err := a.getInstance(node)
+// ListPrivateIPs returns the secondary private IPv4 addresses and the IPv6
+// addresses of the network interface of the node. The IP addresses of
+// delegated prefixes aren't listed, the prefixes don't record which of their
+// addresses are in use.
+func (a *AWS) ListPrivateIPs(ctx context.Context, node *corev1.Node) ([]net.IP, error) {
+	instance, err := a.getInstance(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	networkInterface, err := a.getNetworkInterface(ctx, node, instance)
 	if err != nil {
 		return nil, err
 	}
-	instanceV4Capacity, instanceV6Capacity, err := a.getInstanceCapacity(instance)
+	return getAWSSecondaryIPs(networkInterface), nil
+}
+
+// getAWSSecondaryIPs returns the secondary IPv4 addresses and the IPv6
+// addresses of the network interface.
+func getAWSSecondaryIPs(networkInterface *ec2types.InstanceNetworkInterface) []net.IP {
+	ips := []net.IP{}
+	for _, assignedIPv4 := range networkInterface.PrivateIpAddresses {
+		if !awsapi.ToBool(assignedIPv4.Primary) {
+			ips = append(ips, ParseIP(awsapi.ToString(assignedIPv4.PrivateIpAddress)))
+		}
+	}
+	for _, assignedIPv6 := range networkInterface.Ipv6Addresses {
+		ips = append(ips, ParseIP(awsapi.ToString(assignedIPv6.Ipv6Address)))
+	}
+	return ips
+}
+
+// CheckHealth describes the node's instance, bypassing the cache of
+// descriptions.
+func (a *AWS) CheckHealth(ctx context.Context, node *corev1.Node) error {
+	instanceId, err := a.getInstanceId(ctx, node)
+	if err != nil {
+		return err
+	}
+	_, err = a.describeInstance(ctx, node, instanceId)
+	return err
+}
+
+// ListOwnedResources returns the secondary IP addresses of the selected
+// network interface of each node which the controller tagged, see
+// AWSTagResources. Secondary IP addresses can't be tagged themselves: all
+// those of the network interfaces the controller changed are taken as its
+// own, like ListPrivateIPs does. It returns an OwnedResourcesUnsupportedError
+// unless AWSTagResources is set. Nodes whose network interface can't be
+// retrieved are skipped.
+func (a *AWS) ListOwnedResources(ctx context.Context, nodes []*corev1.Node) ([]OwnedResource, error) {
+	if !a.cfg.AWSTagResources {
+		return nil, fmt.Errorf("%w: the network interfaces aren't tagged, see -platform-aws-tag-resources", OwnedResourcesUnsupportedError)
+	}
+	owned, err := a.getOwnedNetworkInterfaceIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resources := []OwnedResource{}
+	for _, node := range nodes {
+		instance, err := a.getInstance(ctx, node)
+		if err != nil {
+			klog.Warningf("Could not list the secondary IP addresses of node %s, err: %v", node.Name, err)
+			continue
+		}
+		networkInterface, err := a.getNetworkInterface(ctx, node, instance)
+		if err != nil {
+			klog.Warningf("Could not list the secondary IP addresses of node %s, err: %v", node.Name, err)
+			continue
+		}
+		networkInterfaceID := awsapi.ToString(networkInterface.NetworkInterfaceId)
+		if !owned[networkInterfaceID] {
+			continue
+		}
+		for _, ip := range getAWSSecondaryIPs(networkInterface) {
+			if ip == nil {
+				continue
+			}
+			resources = append(resources, OwnedResource{
+				ID:   fmt.Sprintf("%s/%s", networkInterfaceID, ip),
+				Kind: "secondary IP address",
+				IP:   ip,
+				Node: node.Name,
+				node: node,
+			})
+		}
+	}
+	return resources, nil
+}
+
+// DeleteOwnedResource releases the secondary IP address from its node,
+// disassociating its Elastic IPs.
+func (a *AWS) DeleteOwnedResource(ctx context.Context, resource OwnedResource) error {
+	if resource.node == nil {
+		return fmt.Errorf("cannot delete secondary IP address %s, it belongs to no node", resource.ID)
+	}
+	return a.ReleasePrivateIP(ctx, resource.IP, resource.node)
+}
+
+func (a *AWS) GetNodeEgressIPConfiguration(ctx context.Context, node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
+	instance, err := a.getInstance(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	instanceV4Capacity, instanceV6Capacity, err := a.getInstanceCapacity(ctx, instance)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving the instance capacities, err: %v", err)
 	}
-	networkInterfaces, err := a.getNetworkInterfaces(instance)
+	networkInterface, err := a.getNetworkInterface(ctx, node, instance)
 	if err != nil {
 		return nil, err
 	}
-	networkInterface := networkInterfaces[0]
 	config := &NodeEgressIPConfiguration{
 		Interface: *networkInterface.NetworkInterfaceId,
+		MAC:       normalizeMAC(awsapi.ToString(networkInterface.MacAddress)),
 	}
-	v4Subnet, v6Subnet, err := a.getSubnet(networkInterface)
+	v4Subnet, v6Subnet, err := a.getSubnet(ctx, networkInterface)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving the network interface subnets, err: %v", err)
 	}
@@ -198,6 +611,31 @@ func (a *AWS) GetNodeEgressIPConfiguration(node *corev1.Node) ([]*NodeEgressIPCo
 		config.IFAddr.IPv6 = v6Subnet.String()
 	}
 	capV4, capV6 := a.getCapacity(instanceV4Capacity, instanceV6Capacity, networkInterface)
+	if a.cfg.AWSPrefixDelegation {
+		if capV4, err = a.getPrefixCapacity(ctx, instanceV4Capacity, networkInterface); err != nil {
+			return nil, fmt.Errorf("error retrieving the delegated prefixes capacity, err: %v", err)
+		}
+	}
+	// Addresses of a family can't be assigned out of subnets without CIDR
+	// block of that family, e.g. IPv4 addresses out of IPv6-only subnets,
+	// whatever the instance type supports.
+	if v4Subnet == nil {
+		capV4 = 0
+	}
+	if v6Subnet == nil {
+		capV6 = 0
+	}
+	// Neither can IPv4 addresses requiring an Elastic IP, outside of zones
+	// supporting them.
+	if capV4 > 0 && a.configuresElasticIPs() {
+		placement, err := a.getPlacement(ctx, networkInterface)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving the network interface placement, err: %v", err)
+		}
+		if !placement.supportsElasticIPs() {
+			capV4 = 0
+		}
+	}
 	config.Capacity = capacity{
 		IPv4: capV4,
 		IPv6: capV6,
@@ -211,24 +649,33 @@ func (a *AWS) GetNodeEgressIPConfiguration(node *corev1.Node) ([]*NodeEgressIPCo
 // assert that all IPs except the IP being removed are there (which should
 // anyways be the case). Hence, use our own poller which verifies on ADD that
 // all IPs that we add are assigned to the node, and on DEL that all IPs being
-// removed have been completely removed from the node.
-func (a *AWS) waitForCompletion(node *corev1.Node, ips []string, deleteOp bool) error {
+// removed have been completely removed from the node. The instance is
+// described afresh on every poll, bypassing the cache.
+func (a *AWS) waitForCompletion(ctx context.Context, node *corev1.Node, ips []string, deleteOp bool) error {
+	instanceId, err := a.getInstanceId(ctx, node)
+	if err != nil {
+		return err
+	}
 	return wait.PollImmediate(time.Second*2, time.Minute, func() (done bool, err error) {
-		instance, err := a.getInstance(node)
+		instance, err := a.describeInstance(ctx, node, instanceId)
+		if err != nil {
+			return false, err
+		}
+		networkInterface, err := a.getNetworkInterface(ctx, node, instance)
 		if err != nil {
 			return false, err
 		}
 		sampleIP := ips[0]
 		assignedIPs := []string{}
 		if utilnet.IsIPv6String(sampleIP) {
-			for _, assignedIPv6 := range instance.NetworkInterfaces[0].Ipv6Addresses {
-				if assignedIP := net.ParseIP(*assignedIPv6.Ipv6Address); assignedIP != nil {
+			for _, assignedIPv6 := range networkInterface.Ipv6Addresses {
+				if assignedIP := ParseIP(*assignedIPv6.Ipv6Address); assignedIP != nil {
 					assignedIPs = append(assignedIPs, assignedIP.String())
 				}
 			}
 		} else {
-			for _, assignedIPv4 := range instance.NetworkInterfaces[0].PrivateIpAddresses {
-				if assignedIP := net.ParseIP(*assignedIPv4.PrivateIpAddress); assignedIP != nil {
+			for _, assignedIPv4 := range networkInterface.PrivateIpAddresses {
+				if assignedIP := ParseIP(*assignedIPv4.PrivateIpAddress); assignedIP != nil {
 					assignedIPs = append(assignedIPs, assignedIP.String())
 				}
 			}
@@ -241,19 +688,32 @@ func (a *AWS) waitForCompletion(node *corev1.Node, ips []string, deleteOp bool)
 	})
 }
 
-func (a *AWS) getSubnet(networkInterface *ec2.InstanceNetworkInterface) (*net.IPNet, *net.IPNet, error) {
-	describeOutput, err := a.client.DescribeSubnets(&ec2.DescribeSubnetsInput{
-		SubnetIds: []*string{networkInterface.SubnetId},
+// describeSubnet returns the subnet of the network interface.
+func (a *AWS) describeSubnet(ctx context.Context, networkInterface *ec2types.InstanceNetworkInterface) (*ec2types.Subnet, error) {
+	callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+	defer cancel()
+	describeOutput, err := a.subnetClient().DescribeSubnets(callCtx, &ec2.DescribeSubnetsInput{
+		SubnetIds: []string{awsapi.ToString(networkInterface.SubnetId)},
 	})
 	if err != nil {
-		return nil, nil, fmt.Errorf("error: cannot list ec2 subnets, err: %v", err)
+		return nil, fmt.Errorf("error: cannot list ec2 subnets, err: %v", err)
 	}
 	if len(describeOutput.Subnets) > 1 {
-		return nil, nil, fmt.Errorf("error: multiple subnets found for the subnet ID: %s", *networkInterface.SubnetId)
+		return nil, fmt.Errorf("error: multiple subnets found for the subnet ID: %s", awsapi.ToString(networkInterface.SubnetId))
+	}
+	if len(describeOutput.Subnets) == 0 {
+		return nil, fmt.Errorf("error: no subnet found for the subnet ID: %s", awsapi.ToString(networkInterface.SubnetId))
+	}
+	return &describeOutput.Subnets[0], nil
+}
+
+func (a *AWS) getSubnet(ctx context.Context, networkInterface *ec2types.InstanceNetworkInterface) (*net.IPNet, *net.IPNet, error) {
+	subnet, err := a.describeSubnet(ctx, networkInterface)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	var v4Subnet, v6Subnet *net.IPNet
-	subnet := describeOutput.Subnets[0]
 	if subnet.CidrBlock != nil && *subnet.CidrBlock != "" {
 		_, subnet, err := net.ParseCIDR(*subnet.CidrBlock)
 		if err != nil {
@@ -280,70 +740,122 @@ func (a *AWS) getSubnet(networkInterface *ec2.InstanceNetworkInterface) (*net.IP
 // AWS uses a variable capacity per instance type, see:
 // https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/using-eni.html#AvailableIpPerENI
 // Hence we need to retrieve that and then subtract the amount already assigned
-// by default.
-func (a *AWS) getCapacity(instanceV4Capacity, instanceV6Capacity int, networkInterface *ec2.InstanceNetworkInterface) (int, int) {
-	currentIPv4Usage, currentIPv6Usage := 0, 0
+// by default. The limits are per IP family and differ on many instance types,
+// the capacities are computed separately. Delegated prefixes, e.g. by the VPC
+// CNI, take one address slot of their family each.
+func (a *AWS) getCapacity(instanceV4Capacity, instanceV6Capacity int, networkInterface *ec2types.InstanceNetworkInterface) (int, int) {
+	currentIPv4Usage, currentIPv6Usage := len(networkInterface.Ipv4Prefixes), len(networkInterface.Ipv6Prefixes)
 	for _, assignedIPv6 := range networkInterface.Ipv6Addresses {
-		if assignedIP := net.ParseIP(*assignedIPv6.Ipv6Address); assignedIP != nil {
+		if assignedIP := ParseIP(awsapi.ToString(assignedIPv6.Ipv6Address)); assignedIP != nil {
 			currentIPv6Usage++
 		}
 	}
 	for _, assignedIPv4 := range networkInterface.PrivateIpAddresses {
-		if assignedIP := net.ParseIP(*assignedIPv4.PrivateIpAddress); assignedIP != nil {
+		if assignedIP := ParseIP(awsapi.ToString(assignedIPv4.PrivateIpAddress)); assignedIP != nil {
 			currentIPv4Usage++
 		}
 	}
-	return instanceV4Capacity - currentIPv4Usage, instanceV6Capacity - currentIPv6Usage
+	// The usage exceeds the capacity if the instance type's limits were
+	// lowered after the addresses were assigned.
+	capV4, capV6 := instanceV4Capacity-currentIPv4Usage, instanceV6Capacity-currentIPv6Usage
+	if capV4 < 0 {
+		capV4 = 0
+	}
+	if capV6 < 0 {
+		capV6 = 0
+	}
+	return capV4, capV6
 }
 
-func (a *AWS) getNetworkInterfaces(instance *ec2.Instance) ([]*ec2.InstanceNetworkInterface, error) {
+func (a *AWS) getNetworkInterfaces(instance *ec2types.Instance) ([]*ec2types.InstanceNetworkInterface, error) {
 	if len(instance.NetworkInterfaces) == 0 {
 		return nil, NoNetworkInterfaceError
 	}
-	if instance.NetworkInterfaces[0] == nil {
-		return nil, NoNetworkInterfaceError
+	networkInterfaces := make([]*ec2types.InstanceNetworkInterface, 0, len(instance.NetworkInterfaces))
+	for i := range instance.NetworkInterfaces {
+		networkInterfaces = append(networkInterfaces, &instance.NetworkInterfaces[i])
 	}
-	return instance.NetworkInterfaces, nil
+	return networkInterfaces, nil
 }
 
-func (a *AWS) getInstanceCapacity(instance *ec2.Instance) (int, int, error) {
+// getInstanceCapacity returns the IPv4 and IPv6 capacity per network interface
+// of the instance's type. The capacities are queried from the API, so that new
+// instance types are supported as soon as AWS ships them, and cached.
+func (a *AWS) getInstanceCapacity(ctx context.Context, instance *ec2types.Instance) (int, int, error) {
+	instanceTypeName := string(instance.InstanceType)
+	if cached, ok := a.instanceTypeCapacities.Load(instanceTypeName); ok {
+		capacity := cached.(awsInstanceTypeCapacity)
+		return capacity.ipv4, capacity.ipv6, nil
+	}
 	input := &ec2.DescribeInstanceTypesInput{
-		InstanceTypes: []*string{instance.InstanceType},
+		InstanceTypes: []ec2types.InstanceType{instance.InstanceType},
 	}
-	output, err := a.client.DescribeInstanceTypes(input)
+	callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+	defer cancel()
+	output, err := a.client.DescribeInstanceTypes(callCtx, input)
 	if err != nil {
 		return -1, -1, err
 	}
 	if len(output.InstanceTypes) != 1 {
 		return -1, -1, fmt.Errorf("multiple or no instance types found")
 	}
-	var instanceIPv4Capacity, instanceIPv6Capacity int
+	var capacity awsInstanceTypeCapacity
 	for _, instanceType := range output.InstanceTypes {
 		if networkInfo := instanceType.NetworkInfo; networkInfo != nil {
-			instanceIPv4Capacity = int(awsapi.Int64Value(networkInfo.Ipv4AddressesPerInterface))
-			instanceIPv6Capacity = int(awsapi.Int64Value(networkInfo.Ipv6AddressesPerInterface))
+			capacity.ipv4 = int(awsapi.ToInt32(networkInfo.Ipv4AddressesPerInterface))
+			if awsapi.ToBool(networkInfo.Ipv6Supported) {
+				capacity.ipv6 = int(awsapi.ToInt32(networkInfo.Ipv6AddressesPerInterface))
+			}
 		}
 	}
-	return instanceIPv4Capacity, instanceIPv6Capacity, nil
+	a.instanceTypeCapacities.Store(instanceTypeName, capacity)
+	return capacity.ipv4, capacity.ipv6, nil
 }
 
-// getInstance returns the EC2 Instance for the given node.
-func (a *AWS) getInstance(node *corev1.Node) (*ec2.Instance, error) {
-	instanceId, err := getInstanceIdFromProviderId(node.Spec.ProviderID)
+// getInstance returns the EC2 Instance for the given node. Its description is
+// cached for AWSDescribeCacheTTL, until the controller changes its network
+// interfaces.
+func (a *AWS) getInstance(ctx context.Context, node *corev1.Node) (*ec2types.Instance, error) {
+	instanceId, err := a.getInstanceId(ctx, node)
 	if err != nil {
 		return nil, err
 	}
+	if instance := a.instances.getInstance(instanceId); instance != nil {
+		return instance, nil
+	}
+	instance, err := a.describeInstance(ctx, node, instanceId)
+	if err != nil {
+		if a.metadata == nil || !isAWSThrottled(err) {
+			return nil, err
+		}
+		// The local instance can be described out of its metadata instead,
+		// which isn't cached so that the next call describes it fully.
+		instance, errIMDS := a.describeLocalInstance(ctx, node, instanceId)
+		if errIMDS != nil {
+			return nil, fmt.Errorf("%v, and the instance metadata service could not describe it, err: %v", err, errIMDS)
+		}
+		klog.Warningf("DescribeInstances is throttled, described local instance %s of node %s through the instance metadata service", instanceId, node.Name)
+		return instance, nil
+	}
+	a.instances.storeInstance(instanceId, instance, a.cfg.AWSDescribeCacheTTL)
+	return instance, nil
+}
+
+// describeInstance describes the instance of the given node.
+func (a *AWS) describeInstance(ctx context.Context, node *corev1.Node, instanceId string) (*ec2types.Instance, error) {
 	input := &ec2.DescribeInstancesInput{
-		InstanceIds: []*string{awsapi.String(instanceId)},
+		InstanceIds: []string{instanceId},
 	}
-	result, err := a.client.DescribeInstances(input)
+	callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+	defer cancel()
+	result, err := a.client.DescribeInstances(callCtx, input)
 	if err != nil {
-		return nil, fmt.Errorf("error: cannot list ec2 instance for node: %s, err: %v", node.Name, err)
+		return nil, fmt.Errorf("error: cannot list ec2 instance for node: %s, err: %w", node.Name, err)
 	}
-	instances := []*ec2.Instance{}
+	instances := []*ec2types.Instance{}
 	for _, reservation := range result.Reservations {
-		for _, instance := range reservation.Instances {
-			instances = append(instances, instance)
+		for i := range reservation.Instances {
+			instances = append(instances, &reservation.Instances[i])
 		}
 	}
 	if len(instances) != 1 {
@@ -352,6 +864,45 @@ func (a *AWS) getInstance(node *corev1.Node) (*ec2.Instance, error) {
 	return instances[0], nil
 }
 
+// getInstanceId returns the instance id of the node, extracted from its
+// provider id. If that fails and the IMDS fallback is enabled, the instance the
+// controller runs on is used, as long as the private IP address of its
+// identity document is one of the node's: the providerID is only set by the
+// cloud provider once the node is initialized. The metadata service only
+// describes the local instance, other nodes can't be resolved without their
+// providerID. The identity document isn't verified against its signature, it's
+// trusted like the metadata service serving it.
+func (a *AWS) getInstanceId(ctx context.Context, node *corev1.Node) (string, error) {
+	instanceId, err := getInstanceIdFromProviderId(node.Spec.ProviderID)
+	if err == nil || a.metadata == nil {
+		return instanceId, err
+	}
+	identity, errIMDS := a.getLocalIdentity(ctx)
+	if errIMDS != nil {
+		return "", fmt.Errorf("%v, and the instance metadata service could not be queried, err: %v", err, errIMDS)
+	}
+	if !isLocalInstance(node, identity) {
+		return "", fmt.Errorf("%v, and node %s is not the local instance %s", err, node.Name, identity.InstanceID)
+	}
+	klog.Infof("Node %s has no valid providerID, using local instance %s", node.Name, identity.InstanceID)
+	return identity.InstanceID, nil
+}
+
+// isLocalInstance returns true if one of the internal IP addresses of node is
+// the private IP address of the instance described by identity.
+func isLocalInstance(node *corev1.Node, identity imds.InstanceIdentityDocument) bool {
+	privateIP := ParseIP(identity.PrivateIP)
+	if privateIP == nil {
+		return false
+	}
+	for _, address := range node.Status.Addresses {
+		if address.Type == corev1.NodeInternalIP && privateIP.Equal(ParseIP(address.Address)) {
+			return true
+		}
+	}
+	return false
+}
+
 // getInstanceIdFromProviderId extracts the instance id from a given provider id.
 // The provider ID should normally be passed in with aws:///<zone>/<instanceID>
 // But it might also be passed in as aws://<zone>/<instanceID> and the zone might
@@ -378,3 +929,32 @@ func getInstanceIdFromProviderId(providerId string) (string, error) {
 
 	return instanceId, nil
 }
+
+// tracedAWSHTTPClient traces the requests of the AWS SDK's HTTP client, which
+// isn't an http.Client: it's configured, e.g. with the custom CA bundle,
+// through options of its own.
+type tracedAWSHTTPClient struct {
+	transport *tracing.Transport
+}
+
+// awsRoundTripper sends requests with the AWS SDK's HTTP client.
+type awsRoundTripper struct {
+	awsapi.HTTPClient
+}
+
+func (a awsRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return a.Do(r)
+}
+
+// newTracedAWSHTTPClient returns client, the SDK's default one if nil,
+// tracing those sent on behalf of a traced call, as children of its span.
+func newTracedAWSHTTPClient(client awsapi.HTTPClient) awsapi.HTTPClient {
+	if client == nil {
+		client = awshttp.NewBuildableClient()
+	}
+	return tracedAWSHTTPClient{transport: tracing.NewTransport(awsRoundTripper{client})}
+}
+
+func (t tracedAWSHTTPClient) Do(r *http.Request) (*http.Response, error) {
+	return t.transport.RoundTrip(r)
+}
@@ -0,0 +1,95 @@
+package cloudprovider
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	awsapi "github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+// awsAssignmentBatch collects the IP addresses of concurrent assignments to the
+// same network interface and IP family, to assign them in a single call.
+type awsAssignmentBatch struct {
+	ips []string
+	// errs holds the result of the assignment of each IP address once done
+	// is closed.
+	errs map[string]error
+	done chan struct{}
+}
+
+// awsAssignmentBatches are the batches collecting IP addresses, keyed by
+// network interface ID and IP family.
+type awsAssignmentBatches struct {
+	sync.Mutex
+	pending map[string]*awsAssignmentBatch
+}
+
+// assignPrivateIPAddresses assigns ip to the network interface. If batching is
+// enabled, the first assignment to the network interface waits for the batch
+// window, or for the other IP addresses of its AssignPrivateIPs call, and all
+// assignments to the same network interface and IP family queued meanwhile
+// are sent along in the same call, on the context of the first, whose trace
+// the call is part of.
+func (a *AWS) assignPrivateIPAddresses(ctx context.Context, ip net.IP, node *corev1.Node, networkInterface *ec2types.InstanceNetworkInterface) error {
+	if a.cfg.AWSAssignmentBatchWindow <= 0 {
+		return a.sendAssignPrivateIPAddresses(ctx, []string{ip.String()}, node, networkInterface)
+	}
+	key := awsapi.ToString(networkInterface.NetworkInterfaceId) + "/IPv4"
+	if utilnet.IsIPv6(ip) {
+		key = awsapi.ToString(networkInterface.NetworkInterfaceId) + "/IPv6"
+	}
+
+	a.batches.Lock()
+	if a.batches.pending == nil {
+		a.batches.pending = map[string]*awsAssignmentBatch{}
+	}
+	batch, ok := a.batches.pending[key]
+	if !ok {
+		batch = &awsAssignmentBatch{done: make(chan struct{})}
+		a.batches.pending[key] = batch
+	}
+	batch.ips = append(batch.ips, ip.String())
+	a.batches.Unlock()
+
+	if ok {
+		a.calls.join(ip)
+		<-batch.done
+		return batch.errs[ip.String()]
+	}
+
+	a.calls.wait(ip, a.cfg.AWSAssignmentBatchWindow)
+	a.batches.Lock()
+	delete(a.batches.pending, key)
+	a.batches.Unlock()
+	batch.errs = a.sendAssignmentBatch(ctx, batch.ips, node, networkInterface)
+	close(batch.done)
+	return batch.errs[ip.String()]
+}
+
+// sendAssignmentBatch assigns the IP addresses in a single call. The call
+// succeeds or fails as a whole: if it fails, each IP address is assigned on
+// its own, so that an IP address which can't be assigned doesn't fail the
+// others.
+func (a *AWS) sendAssignmentBatch(ctx context.Context, ips []string, node *corev1.Node, networkInterface *ec2types.InstanceNetworkInterface) map[string]error {
+	errs := map[string]error{}
+	if len(ips) > 1 {
+		klog.Infof("Assigning %d IP addresses to network interface %s in a single call", len(ips), awsapi.ToString(networkInterface.NetworkInterfaceId))
+	}
+	err := a.sendAssignPrivateIPAddresses(ctx, ips, node, networkInterface)
+	if err == nil || len(ips) == 1 {
+		for _, ip := range ips {
+			errs[ip] = err
+		}
+		return errs
+	}
+	klog.Warningf("Could not assign IP addresses %v to network interface %s in a single call, assigning them one by one, err: %v", ips, awsapi.ToString(networkInterface.NetworkInterfaceId), err)
+	for _, ip := range ips {
+		errs[ip] = a.sendAssignPrivateIPAddresses(ctx, []string{ip}, node, networkInterface)
+	}
+	return errs
+}
@@ -0,0 +1,135 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	awsapi "github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeEC2Assignments serves the EC2 API operations assigning secondary private
+// IP addresses to the single network interface of a single instance. It
+// refuses to assign the IP addresses in refused.
+type fakeEC2Assignments struct {
+	mu       sync.Mutex
+	assigned []string
+	refused  map[string]bool
+	// calls holds the IP addresses of every AssignPrivateIpAddresses call.
+	calls [][]string
+}
+
+func (f *fakeEC2Assignments) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r.ParseForm()
+	switch r.Form.Get("Action") {
+	case "DescribeInstances":
+		var ips []string
+		for _, ip := range f.assigned {
+			ips = append(ips, fmt.Sprintf("<item><privateIpAddress>%s</privateIpAddress></item>", ip))
+		}
+		fmt.Fprintf(w, `<DescribeInstancesResponse><reservationSet><item><instancesSet><item>
+<instanceId>i-0123456789abcdef0</instanceId><networkInterfaceSet><item>
+<networkInterfaceId>eni-0123456789abcdef0</networkInterfaceId><privateIpAddressesSet>%s</privateIpAddressesSet>
+</item></networkInterfaceSet></item></instancesSet></item></reservationSet></DescribeInstancesResponse>`, strings.Join(ips, ""))
+	case "AssignPrivateIpAddresses":
+		var ips []string
+		for i := 1; r.Form.Get(fmt.Sprintf("PrivateIpAddress.%d", i)) != ""; i++ {
+			ips = append(ips, r.Form.Get(fmt.Sprintf("PrivateIpAddress.%d", i)))
+		}
+		sort.Strings(ips)
+		f.calls = append(f.calls, ips)
+		for _, ip := range ips {
+			if f.refused[ip] {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, `<Response><Errors><Error><Code>InvalidParameterValue</Code><Message>Address %s is in use.</Message></Error></Errors></Response>`, ip)
+				return
+			}
+		}
+		f.assigned = append(f.assigned, ips...)
+		fmt.Fprint(w, `<AssignPrivateIpAddressesResponse><return>true</return></AssignPrivateIpAddressesResponse>`)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestAssignPrivateIPAddressesBatch(t *testing.T) {
+	tcs := []struct {
+		window  time.Duration
+		ips     []string
+		refused map[string]bool
+		calls   [][]string
+	}{
+		// Without batch window, every IP address is assigned on its own.
+		{
+			ips:   []string{"10.0.0.10"},
+			calls: [][]string{{"10.0.0.10"}},
+		},
+		// Concurrent assignments are sent in a single call.
+		{
+			window: 500 * time.Millisecond,
+			ips:    []string{"10.0.0.10", "10.0.0.11", "10.0.0.12"},
+			calls:  [][]string{{"10.0.0.10", "10.0.0.11", "10.0.0.12"}},
+		},
+		// If the call fails, the IP addresses are assigned one by one.
+		{
+			window:  500 * time.Millisecond,
+			ips:     []string{"10.0.0.10", "10.0.0.11", "10.0.0.12"},
+			refused: map[string]bool{"10.0.0.11": true},
+			calls:   [][]string{{"10.0.0.10", "10.0.0.11", "10.0.0.12"}, {"10.0.0.10"}, {"10.0.0.11"}, {"10.0.0.12"}},
+		},
+	}
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0"},
+		Spec:       corev1.NodeSpec{ProviderID: "aws:///us-west-2a/i-0123456789abcdef0"},
+	}
+	networkInterface := &ec2types.InstanceNetworkInterface{NetworkInterfaceId: awsapi.String("eni-0123456789abcdef0")}
+	for i, tc := range tcs {
+		fake := &fakeEC2Assignments{refused: tc.refused}
+		server := httptest.NewServer(fake)
+		client := newTestEC2Client(server.URL)
+		a := &AWS{
+			CloudProvider: CloudProvider{ctx: context.Background(), cfg: CloudProviderConfig{AWSAssignmentBatchWindow: tc.window}},
+			client:        client,
+		}
+
+		errs := make([]error, len(tc.ips))
+		wg := sync.WaitGroup{}
+		for j, ip := range tc.ips {
+			j, ip := j, ip
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[j] = a.assignPrivateIPAddresses(context.Background(), net.ParseIP(ip), node, networkInterface)
+			}()
+		}
+		wg.Wait()
+		server.Close()
+
+		for j, ip := range tc.ips {
+			if (errs[j] != nil) != tc.refused[ip] {
+				t.Fatalf("TestAssignPrivateIPAddressesBatch(%d): unexpected result for %s, err: %v", i, ip, errs[j])
+			}
+		}
+		// The order of the individual calls depends on the order of the
+		// batch.
+		sort.Slice(fake.calls, func(j, k int) bool {
+			return len(fake.calls[j]) > len(fake.calls[k]) || (len(fake.calls[j]) == len(fake.calls[k]) && fake.calls[j][0] < fake.calls[k][0])
+		})
+		if fmt.Sprint(fake.calls) != fmt.Sprint(tc.calls) {
+			t.Fatalf("TestAssignPrivateIPAddressesBatch(%d): expected calls %v, got %v", i, tc.calls, fake.calls)
+		}
+	}
+}
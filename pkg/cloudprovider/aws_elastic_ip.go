@@ -0,0 +1,155 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+
+	awsapi "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"k8s.io/klog/v2"
+)
+
+// usesElasticIPs returns true if an Elastic IP is associated with ip, so that
+// it egresses to the internet with that public IP. Only IPv4 addresses have
+// Elastic IPs.
+func (a *AWS) usesElasticIPs(ip net.IP) bool {
+	return a.configuresElasticIPs() && ip.To4() != nil
+}
+
+// configuresElasticIPs returns true if Elastic IPs are associated with the
+// IPv4 egress IPs.
+func (a *AWS) configuresElasticIPs() bool {
+	return a.cfg.AWSElasticIPTagKey != "" || a.cfg.AWSElasticIPPool != ""
+}
+
+// getAssociatedElasticIPs returns the Elastic IPs associated with ip on the
+// network interface.
+func (a *AWS) getAssociatedElasticIPs(ctx context.Context, ip net.IP, networkInterfaceID string) ([]ec2types.Address, error) {
+	callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+	defer cancel()
+	output, err := a.client.DescribeAddresses(callCtx, &ec2.DescribeAddressesInput{
+		Filters: []ec2types.Filter{
+			{Name: awsapi.String("network-interface-id"), Values: []string{networkInterfaceID}},
+			{Name: awsapi.String("private-ip-address"), Values: []string{ip.String()}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error describing the Elastic IPs associated with IP address %s, err: %v", ip, err)
+	}
+	return output.Addresses, nil
+}
+
+// findElasticIP returns the Elastic IP to associate with ip: the one tagged
+// AWSElasticIPTagKey=<ip> if the tag key is set, otherwise the first one of
+// AWSElasticIPPool not associated yet. If both are set, the tagged Elastic IP
+// must also belong to the pool. If networkBorderGroup is set, the Elastic IP
+// must be advertised from it.
+func (a *AWS) findElasticIP(ctx context.Context, ip net.IP, networkBorderGroup string) (*ec2types.Address, error) {
+	input := &ec2.DescribeAddressesInput{
+		Filters: []ec2types.Filter{{Name: awsapi.String("domain"), Values: []string{string(ec2types.DomainTypeVpc)}}},
+	}
+	if a.cfg.AWSElasticIPTagKey != "" {
+		input.Filters = append(input.Filters, ec2types.Filter{Name: awsapi.String("tag:" + a.cfg.AWSElasticIPTagKey), Values: []string{ip.String()}})
+	}
+	callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+	defer cancel()
+	output, err := a.client.DescribeAddresses(callCtx, input)
+	if err != nil {
+		return nil, fmt.Errorf("error describing the Elastic IPs available for IP address %s, err: %v", ip, err)
+	}
+	candidates := []*ec2types.Address{}
+	for i := range output.Addresses {
+		address := &output.Addresses[i]
+		if a.cfg.AWSElasticIPPool != "" && awsapi.ToString(address.PublicIpv4Pool) != a.cfg.AWSElasticIPPool {
+			continue
+		}
+		if networkBorderGroup != "" && address.NetworkBorderGroup != nil && awsapi.ToString(address.NetworkBorderGroup) != networkBorderGroup {
+			continue
+		}
+		// An Elastic IP tagged for ip is dedicated to it, it's taken over
+		// even if still associated elsewhere.
+		if a.cfg.AWSElasticIPTagKey == "" && address.AssociationId != nil {
+			continue
+		}
+		candidates = append(candidates, address)
+	}
+	if len(candidates) == 0 {
+		inGroup := ""
+		if networkBorderGroup != "" {
+			inGroup = " in network border group " + networkBorderGroup
+		}
+		if a.cfg.AWSElasticIPTagKey != "" {
+			return nil, fmt.Errorf("no Elastic IP tagged %s=%s found%s", a.cfg.AWSElasticIPTagKey, ip, inGroup)
+		}
+		return nil, fmt.Errorf("no Elastic IP of pool %s is available for IP address %s%s", a.cfg.AWSElasticIPPool, ip, inGroup)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return awsapi.ToString(candidates[i].PublicIp) < awsapi.ToString(candidates[j].PublicIp)
+	})
+	return candidates[0], nil
+}
+
+// associateElasticIP associates an Elastic IP of the network border group with
+// ip on the network interface, unless one already is, and returns it.
+func (a *AWS) associateElasticIP(ctx context.Context, ip net.IP, networkInterfaceID, networkBorderGroup string) (*ec2types.Address, error) {
+	associated, err := a.getAssociatedElasticIPs(ctx, ip, networkInterfaceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(associated) > 0 {
+		return &associated[0], nil
+	}
+	address, err := a.findElasticIP(ctx, ip, networkBorderGroup)
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("Associating Elastic IP %s with IP address %s of network interface %s", awsapi.ToString(address.PublicIp), ip, networkInterfaceID)
+	callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+	defer cancel()
+	_, err = a.client.AssociateAddress(callCtx, &ec2.AssociateAddressInput{
+		AllocationId:       address.AllocationId,
+		NetworkInterfaceId: awsapi.String(networkInterfaceID),
+		PrivateIpAddress:   awsapi.String(ip.String()),
+		AllowReassociation: awsapi.Bool(a.cfg.AWSElasticIPTagKey != ""),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error associating Elastic IP %s with IP address %s, err: %v", awsapi.ToString(address.PublicIp), ip, err)
+	}
+	return address, nil
+}
+
+// disassociateElasticIPs disassociates all Elastic IPs from ip on the network
+// interface, and removes their node tag.
+func (a *AWS) disassociateElasticIPs(ctx context.Context, ip net.IP, networkInterfaceID string) error {
+	associated, err := a.getAssociatedElasticIPs(ctx, ip, networkInterfaceID)
+	if err != nil {
+		return err
+	}
+	for _, address := range associated {
+		klog.Infof("Disassociating Elastic IP %s from IP address %s of network interface %s", awsapi.ToString(address.PublicIp), ip, networkInterfaceID)
+		callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+		_, err := a.client.DisassociateAddress(callCtx, &ec2.DisassociateAddressInput{AssociationId: address.AssociationId})
+		cancel()
+		if err != nil {
+			return fmt.Errorf("error disassociating Elastic IP %s from IP address %s, err: %v", awsapi.ToString(address.PublicIp), ip, err)
+		}
+		a.untagNode(ctx, awsapi.ToString(address.AllocationId))
+	}
+	return nil
+}
+
+// verifyElasticIP verifies that an Elastic IP is associated with ip on the
+// network interface.
+func (a *AWS) verifyElasticIP(ctx context.Context, ip net.IP, networkInterfaceID string) error {
+	associated, err := a.getAssociatedElasticIPs(ctx, ip, networkInterfaceID)
+	if err != nil {
+		return err
+	}
+	if len(associated) == 0 {
+		return fmt.Errorf("%w: no Elastic IP is associated with IP address %s of network interface %s", MissingIPError, ip, networkInterfaceID)
+	}
+	return nil
+}
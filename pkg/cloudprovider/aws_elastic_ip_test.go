@@ -0,0 +1,211 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	awsapi "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+type fakeElasticIP struct {
+	allocationID       string
+	publicIP           string
+	pool               string
+	tags               map[string]string
+	associationID      string
+	networkInterfaceID string
+	privateIP          string
+	networkBorderGroup string
+}
+
+// fakeEC2Addresses serves the EC2 API operations dealing with Elastic IPs.
+type fakeEC2Addresses struct {
+	mu        sync.Mutex
+	addresses []*fakeElasticIP
+}
+
+func (f *fakeEC2Addresses) matches(r *http.Request, address *fakeElasticIP) bool {
+	for i := 1; r.Form.Get(fmt.Sprintf("Filter.%d.Name", i)) != ""; i++ {
+		name, value := r.Form.Get(fmt.Sprintf("Filter.%d.Name", i)), r.Form.Get(fmt.Sprintf("Filter.%d.Value.1", i))
+		switch {
+		case name == "network-interface-id" && address.networkInterfaceID != value,
+			name == "private-ip-address" && address.privateIP != value,
+			strings.HasPrefix(name, "tag:") && address.tags[strings.TrimPrefix(name, "tag:")] != value:
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeEC2Addresses) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r.ParseForm()
+	switch r.Form.Get("Action") {
+	case "DescribeAddresses":
+		var items []string
+		for _, address := range f.addresses {
+			if !f.matches(r, address) {
+				continue
+			}
+			item := fmt.Sprintf("<allocationId>%s</allocationId><publicIp>%s</publicIp><publicIpv4Pool>%s</publicIpv4Pool>", address.allocationID, address.publicIP, address.pool)
+			if address.networkBorderGroup != "" {
+				item += fmt.Sprintf("<networkBorderGroup>%s</networkBorderGroup>", address.networkBorderGroup)
+			}
+			if address.associationID != "" {
+				item += fmt.Sprintf("<associationId>%s</associationId><networkInterfaceId>%s</networkInterfaceId><privateIpAddress>%s</privateIpAddress>",
+					address.associationID, address.networkInterfaceID, address.privateIP)
+			}
+			items = append(items, "<item>"+item+"</item>")
+		}
+		fmt.Fprintf(w, `<DescribeAddressesResponse><addressesSet>%s</addressesSet></DescribeAddressesResponse>`, strings.Join(items, ""))
+	case "AssociateAddress":
+		for _, address := range f.addresses {
+			if address.allocationID != r.Form.Get("AllocationId") {
+				continue
+			}
+			if address.associationID != "" && r.Form.Get("AllowReassociation") != "true" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `<Response><Errors><Error><Code>Resource.AlreadyAssociated</Code><Message>already associated</Message></Error></Errors></Response>`)
+				return
+			}
+			address.associationID = "eipassoc-" + address.allocationID
+			address.networkInterfaceID = r.Form.Get("NetworkInterfaceId")
+			address.privateIP = r.Form.Get("PrivateIpAddress")
+			fmt.Fprintf(w, `<AssociateAddressResponse><associationId>%s</associationId></AssociateAddressResponse>`, address.associationID)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	case "DisassociateAddress":
+		for _, address := range f.addresses {
+			if address.associationID != "" && address.associationID == r.Form.Get("AssociationId") {
+				address.associationID, address.networkInterfaceID, address.privateIP = "", "", ""
+			}
+		}
+		fmt.Fprint(w, `<DisassociateAddressResponse><return>true</return></DisassociateAddressResponse>`)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestElasticIP(t *testing.T) {
+	networkInterfaceID := "eni-0123456789abcdef0"
+	tcs := []struct {
+		cfg                CloudProviderConfig
+		addresses          []*fakeElasticIP
+		networkBorderGroup string
+		ip                 string
+		publicIP           string
+		err                bool
+	}{
+		// The tagged Elastic IP is associated, even if associated elsewhere.
+		{
+			cfg: CloudProviderConfig{AWSElasticIPTagKey: "egress-ip"},
+			addresses: []*fakeElasticIP{
+				{allocationID: "eipalloc-1", publicIP: "198.51.100.1", tags: map[string]string{"egress-ip": "10.0.0.11"}},
+				{allocationID: "eipalloc-2", publicIP: "198.51.100.2", tags: map[string]string{"egress-ip": "10.0.0.10"}, associationID: "eipassoc-old", networkInterfaceID: "eni-old", privateIP: "10.0.0.10"},
+			},
+			ip:       "10.0.0.10",
+			publicIP: "198.51.100.2",
+		},
+		// Without a tagged Elastic IP, nothing is associated.
+		{
+			cfg:       CloudProviderConfig{AWSElasticIPTagKey: "egress-ip"},
+			addresses: []*fakeElasticIP{{allocationID: "eipalloc-1", publicIP: "198.51.100.1", tags: map[string]string{"egress-ip": "10.0.0.11"}}},
+			ip:        "10.0.0.10",
+			err:       true,
+		},
+		// The first Elastic IP of the pool not associated yet is associated.
+		{
+			cfg: CloudProviderConfig{AWSElasticIPPool: "ipv4pool-ec2-byoip"},
+			addresses: []*fakeElasticIP{
+				{allocationID: "eipalloc-1", publicIP: "203.0.113.1", pool: "amazon"},
+				{allocationID: "eipalloc-2", publicIP: "198.51.100.1", pool: "ipv4pool-ec2-byoip", associationID: "eipassoc-2", networkInterfaceID: "eni-other", privateIP: "10.0.0.20"},
+				{allocationID: "eipalloc-4", publicIP: "198.51.100.3", pool: "ipv4pool-ec2-byoip"},
+				{allocationID: "eipalloc-3", publicIP: "198.51.100.2", pool: "ipv4pool-ec2-byoip"},
+			},
+			ip:       "10.0.0.10",
+			publicIP: "198.51.100.2",
+		},
+		// Only Elastic IPs of the network border group of the interface's
+		// zone can be associated, e.g. in Local Zones.
+		{
+			cfg: CloudProviderConfig{AWSElasticIPPool: "ipv4pool-ec2-byoip"},
+			addresses: []*fakeElasticIP{
+				{allocationID: "eipalloc-1", publicIP: "198.51.100.1", pool: "ipv4pool-ec2-byoip", networkBorderGroup: "us-west-2"},
+				{allocationID: "eipalloc-2", publicIP: "198.51.100.2", pool: "ipv4pool-ec2-byoip", networkBorderGroup: "us-west-2-lax-1"},
+			},
+			networkBorderGroup: "us-west-2-lax-1",
+			ip:                 "10.0.0.10",
+			publicIP:           "198.51.100.2",
+		},
+		{
+			cfg:                CloudProviderConfig{AWSElasticIPTagKey: "egress-ip"},
+			addresses:          []*fakeElasticIP{{allocationID: "eipalloc-1", publicIP: "198.51.100.1", tags: map[string]string{"egress-ip": "10.0.0.10"}, networkBorderGroup: "us-west-2"}},
+			networkBorderGroup: "us-west-2-lax-1",
+			ip:                 "10.0.0.10",
+			err:                true,
+		},
+		// With the pool exhausted, nothing is associated.
+		{
+			cfg:       CloudProviderConfig{AWSElasticIPPool: "ipv4pool-ec2-byoip"},
+			addresses: []*fakeElasticIP{{allocationID: "eipalloc-1", publicIP: "203.0.113.1", pool: "amazon"}},
+			ip:        "10.0.0.10",
+			err:       true,
+		},
+	}
+
+	for i, tc := range tcs {
+		fake := &fakeEC2Addresses{addresses: tc.addresses}
+		server := httptest.NewServer(fake)
+		client := newTestEC2Client(server.URL)
+		a := &AWS{
+			CloudProvider: CloudProvider{ctx: context.Background(), cfg: tc.cfg},
+			client:        client,
+		}
+		ip := net.ParseIP(tc.ip)
+		if !a.usesElasticIPs(ip) || a.usesElasticIPs(net.ParseIP("fd00::10")) {
+			t.Fatalf("TestElasticIP(%d): expected Elastic IPs to be used for IPv4 addresses only", i)
+		}
+
+		_, err := a.associateElasticIP(context.Background(), ip, networkInterfaceID, tc.networkBorderGroup)
+		if tc.err {
+			if err == nil {
+				t.Fatalf("TestElasticIP(%d): expected an error", i)
+			}
+			if err := a.verifyElasticIP(context.Background(), ip, networkInterfaceID); err == nil {
+				t.Fatalf("TestElasticIP(%d): expected no Elastic IP to be associated", i)
+			}
+			server.Close()
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestElasticIP(%d): received unexpected error, err: %q", i, err)
+		}
+		// Associating again is a no-op.
+		if _, err := a.associateElasticIP(context.Background(), ip, networkInterfaceID, tc.networkBorderGroup); err != nil {
+			t.Fatalf("TestElasticIP(%d): received unexpected error, err: %q", i, err)
+		}
+		associated, err := a.getAssociatedElasticIPs(context.Background(), ip, networkInterfaceID)
+		if err != nil || len(associated) != 1 || awsapi.ToString(associated[0].PublicIp) != tc.publicIP {
+			t.Fatalf("TestElasticIP(%d): expected Elastic IP %s to be associated, got: %v, err: %v", i, tc.publicIP, associated, err)
+		}
+		if err := a.verifyElasticIP(context.Background(), ip, networkInterfaceID); err != nil {
+			t.Fatalf("TestElasticIP(%d): expected the association to be verified, err: %q", i, err)
+		}
+
+		if err := a.disassociateElasticIPs(context.Background(), ip, networkInterfaceID); err != nil {
+			t.Fatalf("TestElasticIP(%d): received unexpected error, err: %q", i, err)
+		}
+		if err := a.verifyElasticIP(context.Background(), ip, networkInterfaceID); err == nil {
+			t.Fatalf("TestElasticIP(%d): expected the Elastic IP to be disassociated", i)
+		}
+		server.Close()
+	}
+}
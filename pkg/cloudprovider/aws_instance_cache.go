@@ -0,0 +1,96 @@
+package cloudprovider
+
+import (
+	"sync"
+	"time"
+
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// awsInstanceCache caches the descriptions of the instances, their network
+// interfaces included, keyed by instance ID, for AWSDescribeCacheTTL: the
+// CloudPrivateIPConfigs of a node are often synced in bursts, each of them
+// describing the same instance. Entries are invalidated whenever the
+// controller changes the instance's network interfaces. It's disabled if the
+// TTL is 0.
+type awsInstanceCache struct {
+	sync.Mutex
+	entries map[string]*awsInstanceCacheEntry
+}
+
+type awsInstanceCacheEntry struct {
+	instance *ec2types.Instance
+	// tagged holds the IDs of the network interfaces matching each tag
+	// selector, keyed by selector, see getTaggedNetworkInterfaceIDs.
+	tagged  map[string]map[string]bool
+	expires time.Time
+}
+
+// getInstance returns the cached description of the instance, nil if there's
+// none or it expired.
+func (c *awsInstanceCache) getInstance(instanceID string) *ec2types.Instance {
+	if entry := c.get(instanceID); entry != nil {
+		return entry.instance
+	}
+	return nil
+}
+
+// getTagged returns the cached IDs of the instance's network interfaces
+// matching the tag selector, nil if there are none or they expired.
+func (c *awsInstanceCache) getTagged(instanceID string, selector *awsNetworkInterfaceSelector) map[string]bool {
+	if entry := c.get(instanceID); entry != nil {
+		return entry.tagged[selector.String()]
+	}
+	return nil
+}
+
+func (c *awsInstanceCache) get(instanceID string) *awsInstanceCacheEntry {
+	c.Lock()
+	defer c.Unlock()
+	entry, ok := c.entries[instanceID]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, instanceID)
+		return nil
+	}
+	return entry
+}
+
+// storeInstance caches the description of the instance for ttl, along with
+// the tagged network interfaces cached meanwhile.
+func (c *awsInstanceCache) storeInstance(instanceID string, instance *ec2types.Instance, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]*awsInstanceCacheEntry{}
+	}
+	entry, ok := c.entries[instanceID]
+	if !ok || time.Now().After(entry.expires) {
+		entry = &awsInstanceCacheEntry{tagged: map[string]map[string]bool{}, expires: time.Now().Add(ttl)}
+		c.entries[instanceID] = entry
+	}
+	entry.instance = instance
+}
+
+// storeTagged caches the IDs of the instance's network interfaces matching
+// the tag selector, as long as its description is.
+func (c *awsInstanceCache) storeTagged(instanceID string, selector *awsNetworkInterfaceSelector, tagged map[string]bool) {
+	c.Lock()
+	defer c.Unlock()
+	if entry, ok := c.entries[instanceID]; ok {
+		entry.tagged[selector.String()] = tagged
+	}
+}
+
+// invalidate drops the cached description of the instance, after its network
+// interfaces were changed.
+func (c *awsInstanceCache) invalidate(instanceID string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.entries, instanceID)
+}
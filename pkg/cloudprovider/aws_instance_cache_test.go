@@ -0,0 +1,71 @@
+package cloudprovider
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAWSInstanceCache(t *testing.T) {
+	fake := &fakeEC2IPv6{subnetV6: "2600:1f14:e12:4600::/64", capacityV6: 15}
+	describeInstances := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("Action") == "DescribeInstances" {
+			describeInstances++
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0"},
+		Spec:       corev1.NodeSpec{ProviderID: "aws:///us-west-2a/i-0123456789abcdef0"},
+	}
+	ttl := 200 * time.Millisecond
+	a := &AWS{CloudProvider: CloudProvider{ctx: context.Background(), cfg: CloudProviderConfig{AWSDescribeCacheTTL: ttl}}, client: newTestEC2Client(server.URL)}
+
+	tcs := []struct {
+		// assign is the IPv6 address assigned before getting the
+		// configuration, if any.
+		assign string
+		// wait is waited before getting the configuration.
+		wait     time.Duration
+		capacity int
+		calls    int
+	}{
+		{capacity: 15, calls: 1},
+		// Served from the cache.
+		{capacity: 15, calls: 1},
+		// Waiting for the assignment bypasses the cache, which the
+		// assignment invalidates.
+		{assign: "2600:1f14:e12:4600::10", capacity: 14, calls: 3},
+		{capacity: 14, calls: 3},
+		// The cached description expired.
+		{wait: 2 * ttl, capacity: 14, calls: 4},
+	}
+	for i, tc := range tcs {
+		if tc.assign != "" {
+			if err := a.AssignPrivateIP(context.Background(), net.ParseIP(tc.assign), node); err != nil {
+				t.Fatalf("TestAWSInstanceCache(%d): received unexpected error, err: %v", i, err)
+			}
+		}
+		time.Sleep(tc.wait)
+		configs, err := a.GetNodeEgressIPConfiguration(context.Background(), node)
+		if err != nil {
+			t.Fatalf("TestAWSInstanceCache(%d): received unexpected error, err: %v", i, err)
+		}
+		if configs[0].Capacity.IPv6 != tc.capacity {
+			t.Fatalf("TestAWSInstanceCache(%d): expected IPv6 capacity %d, got %d", i, tc.capacity, configs[0].Capacity.IPv6)
+		}
+		if describeInstances != tc.calls {
+			t.Fatalf("TestAWSInstanceCache(%d): expected %d DescribeInstances calls, got %d", i, tc.calls, describeInstances)
+		}
+	}
+}
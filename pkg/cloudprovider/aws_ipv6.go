@@ -0,0 +1,30 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	awsapi "github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// checkIPv6Subnet checks that the IPv6 address can be assigned to the network
+// interface, i.e. that it's in the IPv6 CIDR block of the interface's subnet.
+// EC2 refuses it otherwise, with an error not telling which subnet is at fault
+// nor whether it has an IPv6 CIDR block at all.
+func (a *AWS) checkIPv6Subnet(ctx context.Context, ip net.IP, networkInterface *ec2types.InstanceNetworkInterface) error {
+	_, v6Subnet, err := a.getSubnet(ctx, networkInterface)
+	if err != nil {
+		return err
+	}
+	if v6Subnet == nil {
+		return fmt.Errorf("cannot assign IPv6 address %s to network interface %s: subnet %s has no IPv6 CIDR block",
+			ip, awsapi.ToString(networkInterface.NetworkInterfaceId), awsapi.ToString(networkInterface.SubnetId))
+	}
+	if !v6Subnet.Contains(ip) {
+		return fmt.Errorf("cannot assign IPv6 address %s to network interface %s: it's outside of the IPv6 CIDR block %s of subnet %s",
+			ip, awsapi.ToString(networkInterface.NetworkInterfaceId), v6Subnet, awsapi.ToString(networkInterface.SubnetId))
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeEC2IPv6 serves the EC2 API operations assigning IPv6 addresses to the
+// single network interface of a single instance, in a subnet with the IPv6
+// CIDR block subnetV6 (none if empty) and of an instance type allowing
+// capacityV6 IPv6 addresses per network interface.
+type fakeEC2IPv6 struct {
+	mu         sync.Mutex
+	subnetV6   string
+	capacityV6 int
+	assigned   []string
+}
+
+func (f *fakeEC2IPv6) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r.ParseForm()
+	switch r.Form.Get("Action") {
+	case "DescribeInstances":
+		var ips []string
+		for _, ip := range f.assigned {
+			ips = append(ips, fmt.Sprintf("<item><ipv6Address>%s</ipv6Address></item>", ip))
+		}
+		fmt.Fprintf(w, `<DescribeInstancesResponse><reservationSet><item><instancesSet><item>
+<instanceId>i-0123456789abcdef0</instanceId><instanceType>m5.xlarge</instanceType><networkInterfaceSet><item>
+<networkInterfaceId>eni-0123456789abcdef0</networkInterfaceId><subnetId>subnet-1</subnetId>
+<privateIpAddressesSet><item><privateIpAddress>10.0.0.5</privateIpAddress><primary>true</primary></item></privateIpAddressesSet>
+<ipv6AddressesSet>%s</ipv6AddressesSet>
+</item></networkInterfaceSet></item></instancesSet></item></reservationSet></DescribeInstancesResponse>`, strings.Join(ips, ""))
+	case "DescribeSubnets":
+		v6 := ""
+		if f.subnetV6 != "" {
+			v6 = fmt.Sprintf("<item><ipv6CidrBlock>%s</ipv6CidrBlock></item>", f.subnetV6)
+		}
+		fmt.Fprintf(w, `<DescribeSubnetsResponse><subnetSet><item><subnetId>subnet-1</subnetId><cidrBlock>10.0.0.0/24</cidrBlock>
+<ipv6CidrBlockAssociationSet>%s</ipv6CidrBlockAssociationSet></item></subnetSet></DescribeSubnetsResponse>`, v6)
+	case "DescribeInstanceTypes":
+		fmt.Fprintf(w, `<DescribeInstanceTypesResponse><instanceTypeSet><item><instanceType>m5.xlarge</instanceType><networkInfo>
+<ipv4AddressesPerInterface>15</ipv4AddressesPerInterface><ipv6AddressesPerInterface>%d</ipv6AddressesPerInterface><ipv6Supported>true</ipv6Supported>
+</networkInfo></item></instanceTypeSet></DescribeInstanceTypesResponse>`, f.capacityV6)
+	case "AssignIpv6Addresses":
+		f.assigned = append(f.assigned, r.Form.Get("Ipv6Addresses.1"))
+		fmt.Fprint(w, `<AssignIpv6AddressesResponse><networkInterfaceId>eni-0123456789abcdef0</networkInterfaceId></AssignIpv6AddressesResponse>`)
+	case "UnassignIpv6Addresses":
+		var assigned []string
+		for _, ip := range f.assigned {
+			if ip != r.Form.Get("Ipv6Addresses.1") {
+				assigned = append(assigned, ip)
+			}
+		}
+		f.assigned = assigned
+		fmt.Fprint(w, `<UnassignIpv6AddressesResponse><networkInterfaceId>eni-0123456789abcdef0</networkInterfaceId></UnassignIpv6AddressesResponse>`)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestAWSIPv6(t *testing.T) {
+	tcs := []struct {
+		subnetV6   string
+		capacityV6 int
+		assigned   []string
+		ip         string
+		// capacity is the IPv6 capacity before the assignment.
+		capacity  int
+		assignErr bool
+	}{
+		{
+			subnetV6:   "2600:1f14:e12:4600::/64",
+			capacityV6: 15,
+			assigned:   []string{"2600:1f14:e12:4600::5"},
+			ip:         "2600:1f14:e12:4600::10",
+			capacity:   14,
+		},
+		// The assigned addresses can't exceed the capacity.
+		{
+			subnetV6:   "2600:1f14:e12:4600::/64",
+			capacityV6: 1,
+			assigned:   []string{"2600:1f14:e12:4600::5", "2600:1f14:e12:4600::6"},
+			ip:         "2600:1f14:e12:4600::10",
+			capacity:   0,
+		},
+		// Subnets without IPv6 CIDR block have no IPv6 capacity.
+		{
+			capacityV6: 15,
+			ip:         "2600:1f14:e12:4600::10",
+			capacity:   0,
+			assignErr:  true,
+		},
+		// IPv6 addresses outside of the subnet are refused.
+		{
+			subnetV6:   "2600:1f14:e12:4600::/64",
+			capacityV6: 15,
+			ip:         "2600:1f14:e12:4601::10",
+			capacity:   15,
+			assignErr:  true,
+		},
+	}
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0"},
+		Spec:       corev1.NodeSpec{ProviderID: "aws:///us-west-2a/i-0123456789abcdef0"},
+	}
+	for i, tc := range tcs {
+		fake := &fakeEC2IPv6{subnetV6: tc.subnetV6, capacityV6: tc.capacityV6, assigned: tc.assigned}
+		server := httptest.NewServer(fake)
+		client := newTestEC2Client(server.URL)
+		a := &AWS{CloudProvider: CloudProvider{ctx: context.Background()}, client: client}
+		ip := net.ParseIP(tc.ip)
+
+		configs, err := a.GetNodeEgressIPConfiguration(context.Background(), node)
+		if err != nil {
+			t.Fatalf("TestAWSIPv6(%d): received unexpected error, err: %v", i, err)
+		}
+		if configs[0].Capacity.IPv6 != tc.capacity || configs[0].IFAddr.IPv6 != tc.subnetV6 {
+			t.Fatalf("TestAWSIPv6(%d): expected IPv6 capacity %d on subnet %q, got %d on %q", i, tc.capacity, tc.subnetV6, configs[0].Capacity.IPv6, configs[0].IFAddr.IPv6)
+		}
+
+		err = a.AssignPrivateIP(context.Background(), ip, node)
+		if tc.assignErr {
+			if err == nil {
+				t.Fatalf("TestAWSIPv6(%d): expected an error", i)
+			}
+			if len(fake.assigned) != len(tc.assigned) {
+				t.Fatalf("TestAWSIPv6(%d): expected no IPv6 address to be assigned, got %v", i, fake.assigned)
+			}
+			server.Close()
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestAWSIPv6(%d): received unexpected error, err: %v", i, err)
+		}
+		if err := a.AssignPrivateIP(context.Background(), ip, node); !errors.Is(err, AlreadyExistingIPError) {
+			t.Fatalf("TestAWSIPv6(%d): expected AlreadyExistingIPError, got: %v", i, err)
+		}
+		if err := a.ReleasePrivateIP(context.Background(), ip, node); err != nil {
+			t.Fatalf("TestAWSIPv6(%d): received unexpected error, err: %v", i, err)
+		}
+		if err := a.ReleasePrivateIP(context.Background(), ip, node); !errors.Is(err, NonExistingIPError) {
+			t.Fatalf("TestAWSIPv6(%d): expected NonExistingIPError, got: %v", i, err)
+		}
+		if len(fake.assigned) != len(tc.assigned) {
+			t.Fatalf("TestAWSIPv6(%d): expected %v to be assigned, got %v", i, tc.assigned, fake.assigned)
+		}
+		server.Close()
+	}
+}
@@ -0,0 +1,142 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	awsapi "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// isAWSThrottled returns true if EC2 throttled the request, e.g. with
+// RequestLimitExceeded, and the SDK gave up retrying it.
+func isAWSThrottled(err error) bool {
+	return retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err).Bool()
+}
+
+// getLocalIdentity returns the identity document of the instance the
+// controller runs on. It's served by the instance's own metadata service,
+// which isn't reachable from any other instance: it only tells about the
+// node of the controller.
+func (a *AWS) getLocalIdentity(ctx context.Context) (imds.InstanceIdentityDocument, error) {
+	callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+	defer cancel()
+	output, err := a.metadata.GetInstanceIdentityDocument(callCtx, &imds.GetInstanceIdentityDocumentInput{})
+	if err != nil {
+		return imds.InstanceIdentityDocument{}, err
+	}
+	return output.InstanceIdentityDocument, nil
+}
+
+// describeLocalInstance describes the instance the controller runs on, with
+// instanceId, out of its metadata, while DescribeInstances is throttled. The
+// metadata only has the attached network interfaces, without their tags.
+func (a *AWS) describeLocalInstance(ctx context.Context, node *corev1.Node, instanceId string) (*ec2types.Instance, error) {
+	identity, err := a.getLocalIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if identity.InstanceID != instanceId {
+		return nil, fmt.Errorf("node %s is not the local instance %s", node.Name, identity.InstanceID)
+	}
+	instance := &ec2types.Instance{
+		InstanceId:   awsapi.String(identity.InstanceID),
+		InstanceType: ec2types.InstanceType(identity.InstanceType),
+	}
+	macs, err := a.getMetadataList(ctx, "network/interfaces/macs/")
+	if err != nil {
+		return nil, err
+	}
+	for _, mac := range macs {
+		networkInterface, err := a.describeLocalNetworkInterface(ctx, strings.TrimSuffix(mac, "/"))
+		if err != nil {
+			return nil, err
+		}
+		instance.NetworkInterfaces = append(instance.NetworkInterfaces, *networkInterface)
+	}
+	sort.Slice(instance.NetworkInterfaces, func(i, j int) bool {
+		return awsapi.ToInt32(instance.NetworkInterfaces[i].Attachment.DeviceIndex) < awsapi.ToInt32(instance.NetworkInterfaces[j].Attachment.DeviceIndex)
+	})
+	return instance, nil
+}
+
+// describeLocalNetworkInterface describes the network interface of the local
+// instance with the MAC address mac out of its metadata.
+func (a *AWS) describeLocalNetworkInterface(ctx context.Context, mac string) (*ec2types.InstanceNetworkInterface, error) {
+	path := "network/interfaces/macs/" + mac + "/"
+	values := map[string][]string{}
+	for _, key := range []string{"interface-id", "device-number", "subnet-id", "local-ipv4s", "ipv6s", "security-group-ids", "ipv4-prefix", "ipv6-prefix"} {
+		list, err := a.getMetadataList(ctx, path+key)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = list
+	}
+	if len(values["interface-id"]) != 1 || len(values["device-number"]) != 1 {
+		return nil, fmt.Errorf("the metadata of network interface %s has no ID or device number", mac)
+	}
+	deviceIndex, err := strconv.ParseInt(values["device-number"][0], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid device number of network interface %s, err: %v", mac, err)
+	}
+	networkInterface := &ec2types.InstanceNetworkInterface{
+		NetworkInterfaceId: awsapi.String(values["interface-id"][0]),
+		MacAddress:         awsapi.String(mac),
+		Attachment: &ec2types.InstanceNetworkInterfaceAttachment{
+			DeviceIndex: awsapi.Int32(int32(deviceIndex)),
+			Status:      ec2types.AttachmentStatusAttached,
+		},
+	}
+	if subnets := values["subnet-id"]; len(subnets) == 1 {
+		networkInterface.SubnetId = awsapi.String(subnets[0])
+	}
+	// The primary IP address is listed first.
+	for i, ip := range values["local-ipv4s"] {
+		networkInterface.PrivateIpAddresses = append(networkInterface.PrivateIpAddresses, ec2types.InstancePrivateIpAddress{
+			PrivateIpAddress: awsapi.String(ip),
+			Primary:          awsapi.Bool(i == 0),
+		})
+	}
+	for _, ip := range values["ipv6s"] {
+		networkInterface.Ipv6Addresses = append(networkInterface.Ipv6Addresses, ec2types.InstanceIpv6Address{Ipv6Address: awsapi.String(ip)})
+	}
+	for _, group := range values["security-group-ids"] {
+		networkInterface.Groups = append(networkInterface.Groups, ec2types.GroupIdentifier{GroupId: awsapi.String(group)})
+	}
+	for _, prefix := range values["ipv4-prefix"] {
+		networkInterface.Ipv4Prefixes = append(networkInterface.Ipv4Prefixes, ec2types.InstanceIpv4Prefix{Ipv4Prefix: awsapi.String(prefix)})
+	}
+	for _, prefix := range values["ipv6-prefix"] {
+		networkInterface.Ipv6Prefixes = append(networkInterface.Ipv6Prefixes, ec2types.InstanceIpv6Prefix{Ipv6Prefix: awsapi.String(prefix)})
+	}
+	return networkInterface, nil
+}
+
+// getMetadataList returns the lines of the metadata at path, none if there's
+// no such metadata, e.g. the IPv6 addresses of an interface without any.
+func (a *AWS) getMetadataList(ctx context.Context, path string) ([]string, error) {
+	callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+	defer cancel()
+	output, err := a.metadata.GetMetadata(callCtx, &imds.GetMetadataInput{Path: path})
+	var responseErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == http.StatusNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting instance metadata %s, err: %v", path, err)
+	}
+	defer output.Content.Close()
+	content, err := ioutil.ReadAll(output.Content)
+	if err != nil {
+		return nil, fmt.Errorf("error reading instance metadata %s, err: %v", path, err)
+	}
+	return strings.Fields(string(content)), nil
+}
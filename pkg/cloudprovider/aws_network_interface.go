@@ -0,0 +1,164 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	awsapi "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// AWSNetworkInterfaceSelectorAnnotation can be set on a node to the
+	// selector of the network interface egress IPs are assigned to, overriding
+	// -platform-aws-network-interface-selector for that node.
+	AWSNetworkInterfaceSelectorAnnotation = "cloud.network.openshift.io/aws-network-interface-selector"
+
+	awsNetworkInterfaceSelectorSubnet        = "subnet"
+	awsNetworkInterfaceSelectorSecurityGroup = "security-group"
+	awsNetworkInterfaceSelectorTag           = "tag"
+)
+
+// awsNetworkInterfaceSelector selects the network interface of multi-ENI
+// instances egress IPs are assigned to, by subnet ID, security group ID or tag.
+type awsNetworkInterfaceSelector struct {
+	kind string
+	// value is the subnet or security group ID, or the tag key.
+	value string
+	// tagValue is the value of the tag, any value matches if empty.
+	tagValue string
+}
+
+func (s *awsNetworkInterfaceSelector) String() string {
+	if s.tagValue != "" {
+		return fmt.Sprintf("%s=%s=%s", s.kind, s.value, s.tagValue)
+	}
+	return fmt.Sprintf("%s=%s", s.kind, s.value)
+}
+
+// parseAWSNetworkInterfaceSelector parses a network interface selector, one of:
+// subnet=<subnet ID>, security-group=<security group ID>, tag=<key>[=<value>].
+// It returns nil for an empty selector.
+func parseAWSNetworkInterfaceSelector(s string) (*awsNetworkInterfaceSelector, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	kind, value, ok := strings.Cut(s, "=")
+	if !ok || value == "" {
+		return nil, fmt.Errorf("invalid AWS network interface selector %q, expected <kind>=<value>", s)
+	}
+	selector := &awsNetworkInterfaceSelector{kind: kind, value: value}
+	switch kind {
+	case awsNetworkInterfaceSelectorSubnet, awsNetworkInterfaceSelectorSecurityGroup:
+	case awsNetworkInterfaceSelectorTag:
+		selector.value, selector.tagValue, _ = strings.Cut(value, "=")
+	default:
+		return nil, fmt.Errorf("invalid AWS network interface selector %q, kind must be one of: %s, %s, %s", s,
+			awsNetworkInterfaceSelectorSubnet, awsNetworkInterfaceSelectorSecurityGroup, awsNetworkInterfaceSelectorTag)
+	}
+	return selector, nil
+}
+
+// GetNodeNetworkInterfaces returns the sorted IDs of the network interfaces
+// attached to the node's instance. Interfaces being detached are left out,
+// they won't host egress IPs anymore.
+func (a *AWS) GetNodeNetworkInterfaces(ctx context.Context, node *corev1.Node) ([]string, error) {
+	instance, err := a.getInstance(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	networkInterfaceIDs := []string{}
+	for _, networkInterface := range instance.NetworkInterfaces {
+		if attachment := networkInterface.Attachment; attachment != nil {
+			if attachment.Status == ec2types.AttachmentStatusDetaching || attachment.Status == ec2types.AttachmentStatusDetached {
+				continue
+			}
+		}
+		networkInterfaceIDs = append(networkInterfaceIDs, awsapi.ToString(networkInterface.NetworkInterfaceId))
+	}
+	sort.Strings(networkInterfaceIDs)
+	return networkInterfaceIDs, nil
+}
+
+// getNetworkInterface returns the network interface of the instance egress IPs
+// are assigned to: the first one matching the node's selector annotation, or
+// the global selector. Without selector, it's the first interface listed
+// following the order AWS specifies.
+func (a *AWS) getNetworkInterface(ctx context.Context, node *corev1.Node, instance *ec2types.Instance) (*ec2types.InstanceNetworkInterface, error) {
+	networkInterfaces, err := a.getNetworkInterfaces(instance)
+	if err != nil {
+		return nil, err
+	}
+	selector := a.networkInterfaceSelector
+	if annotation, ok := node.Annotations[AWSNetworkInterfaceSelectorAnnotation]; ok {
+		if selector, err = parseAWSNetworkInterfaceSelector(annotation); err != nil {
+			return nil, fmt.Errorf("error parsing annotation %s of node %s, err: %v", AWSNetworkInterfaceSelectorAnnotation, node.Name, err)
+		}
+	}
+	if selector == nil {
+		return networkInterfaces[0], nil
+	}
+	var tagged map[string]bool
+	if selector.kind == awsNetworkInterfaceSelectorTag {
+		if tagged, err = a.getTaggedNetworkInterfaceIDs(ctx, instance, selector); err != nil {
+			return nil, err
+		}
+	}
+	for _, networkInterface := range networkInterfaces {
+		if selector.matches(networkInterface, tagged) {
+			return networkInterface, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no network interface of node %s matches selector %s", NoNetworkInterfaceError, node.Name, selector)
+}
+
+// matches returns true if the network interface matches the selector, tagged
+// being the IDs of the network interfaces matching a tag selector.
+func (s *awsNetworkInterfaceSelector) matches(networkInterface *ec2types.InstanceNetworkInterface, tagged map[string]bool) bool {
+	switch s.kind {
+	case awsNetworkInterfaceSelectorSubnet:
+		return awsapi.ToString(networkInterface.SubnetId) == s.value
+	case awsNetworkInterfaceSelectorSecurityGroup:
+		for _, group := range networkInterface.Groups {
+			if awsapi.ToString(group.GroupId) == s.value {
+				return true
+			}
+		}
+		return false
+	default:
+		return tagged[awsapi.ToString(networkInterface.NetworkInterfaceId)]
+	}
+}
+
+// getTaggedNetworkInterfaceIDs returns the IDs of the network interfaces of the
+// instance matching the tag selector: the instance description doesn't include
+// the tags of its network interfaces. They're cached along with the instance
+// description.
+func (a *AWS) getTaggedNetworkInterfaceIDs(ctx context.Context, instance *ec2types.Instance, selector *awsNetworkInterfaceSelector) (map[string]bool, error) {
+	if tagged := a.instances.getTagged(awsapi.ToString(instance.InstanceId), selector); tagged != nil {
+		return tagged, nil
+	}
+	filters := []ec2types.Filter{{Name: awsapi.String("attachment.instance-id"), Values: []string{awsapi.ToString(instance.InstanceId)}}}
+	if selector.tagValue != "" {
+		filters = append(filters, ec2types.Filter{Name: awsapi.String("tag:" + selector.value), Values: []string{selector.tagValue}})
+	} else {
+		filters = append(filters, ec2types.Filter{Name: awsapi.String("tag-key"), Values: []string{selector.value}})
+	}
+	callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+	defer cancel()
+	output, err := a.client.DescribeNetworkInterfaces(callCtx, &ec2.DescribeNetworkInterfacesInput{Filters: filters})
+	if err != nil {
+		return nil, fmt.Errorf("error describing the network interfaces of instance %s, err: %v", awsapi.ToString(instance.InstanceId), err)
+	}
+	tagged := map[string]bool{}
+	for _, networkInterface := range output.NetworkInterfaces {
+		tagged[awsapi.ToString(networkInterface.NetworkInterfaceId)] = true
+	}
+	a.instances.storeTagged(awsapi.ToString(instance.InstanceId), selector, tagged)
+	return tagged, nil
+}
@@ -0,0 +1,83 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+
+	awsapi "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const (
+	// awsZoneTypeLocalZone and awsZoneTypeWavelengthZone are the types of
+	// the zones extending a region, next to regular availability zones.
+	awsZoneTypeLocalZone      = "local-zone"
+	awsZoneTypeWavelengthZone = "wavelength-zone"
+)
+
+// awsPlacement is where the subnet of a network interface lives: in a regular
+// availability zone, a Local Zone or Wavelength Zone extending the region, or
+// on an Outpost. API calls for all of them go to the parent region's
+// endpoints, but they differ in what can be associated with their IP
+// addresses.
+type awsPlacement struct {
+	zone     string
+	zoneType string
+	// networkBorderGroup is the group of zones public IPv4 addresses are
+	// advertised from. Elastic IPs can only be associated within their
+	// network border group: the region for availability zones, their own one
+	// for Local Zones and Wavelength Zones.
+	networkBorderGroup string
+	outpostARN         string
+}
+
+func (p *awsPlacement) String() string {
+	switch {
+	case p.outpostARN != "":
+		return fmt.Sprintf("Outpost %s in zone %s", p.outpostARN, p.zone)
+	case p.zoneType == awsZoneTypeLocalZone:
+		return fmt.Sprintf("Local Zone %s", p.zone)
+	case p.zoneType == awsZoneTypeWavelengthZone:
+		return fmt.Sprintf("Wavelength Zone %s", p.zone)
+	default:
+		return fmt.Sprintf("availability zone %s", p.zone)
+	}
+}
+
+// supportsElasticIPs returns false in Wavelength Zones: their traffic egresses
+// to the carrier network through carrier IPs, Elastic IPs can't be associated.
+func (p *awsPlacement) supportsElasticIPs() bool {
+	return p.zoneType != awsZoneTypeWavelengthZone
+}
+
+// getPlacement returns the placement of the network interface's subnet. The
+// zones are cached, they never change.
+func (a *AWS) getPlacement(ctx context.Context, networkInterface *ec2types.InstanceNetworkInterface) (*awsPlacement, error) {
+	subnet, err := a.describeSubnet(ctx, networkInterface)
+	if err != nil {
+		return nil, err
+	}
+	zoneName := awsapi.ToString(subnet.AvailabilityZone)
+	zone, ok := a.zones.Load(zoneName)
+	if !ok {
+		callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+		defer cancel()
+		output, err := a.subnetClient().DescribeAvailabilityZones(callCtx, &ec2.DescribeAvailabilityZonesInput{
+			ZoneNames: []string{zoneName},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error describing zone %s of subnet %s, err: %v", zoneName, awsapi.ToString(subnet.SubnetId), err)
+		}
+		if len(output.AvailabilityZones) != 1 {
+			return nil, fmt.Errorf("multiple or no zones found for zone %s of subnet %s", zoneName, awsapi.ToString(subnet.SubnetId))
+		}
+		zone, _ = a.zones.LoadOrStore(zoneName, &output.AvailabilityZones[0])
+	}
+	return &awsPlacement{
+		zone:               zoneName,
+		zoneType:           awsapi.ToString(zone.(*ec2types.AvailabilityZone).ZoneType),
+		networkBorderGroup: awsapi.ToString(zone.(*ec2types.AvailabilityZone).NetworkBorderGroup),
+		outpostARN:         awsapi.ToString(subnet.OutpostArn),
+	}, nil
+}
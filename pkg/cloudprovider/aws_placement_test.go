@@ -0,0 +1,157 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	awsapi "github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeEC2Placement serves the EC2 API operations describing a single instance
+// whose single network interface lives in a subnet of zone, of type zoneType
+// in networkBorderGroup, and on outpostARN if set.
+type fakeEC2Placement struct {
+	mu                 sync.Mutex
+	zone               string
+	zoneType           string
+	networkBorderGroup string
+	outpostARN         string
+	// describedZones counts the DescribeAvailabilityZones calls.
+	describedZones int
+	assigned       []string
+}
+
+func (f *fakeEC2Placement) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r.ParseForm()
+	switch r.Form.Get("Action") {
+	case "DescribeInstances":
+		var ips []string
+		for _, ip := range f.assigned {
+			ips = append(ips, fmt.Sprintf("<item><privateIpAddress>%s</privateIpAddress><primary>false</primary></item>", ip))
+		}
+		fmt.Fprintf(w, `<DescribeInstancesResponse><reservationSet><item><instancesSet><item>
+<instanceId>i-0123456789abcdef0</instanceId><instanceType>m5.xlarge</instanceType><networkInterfaceSet><item>
+<networkInterfaceId>eni-0123456789abcdef0</networkInterfaceId><subnetId>subnet-1</subnetId>
+<privateIpAddressesSet><item><privateIpAddress>10.0.0.5</privateIpAddress><primary>true</primary></item>%s</privateIpAddressesSet>
+</item></networkInterfaceSet></item></instancesSet></item></reservationSet></DescribeInstancesResponse>`, strings.Join(ips, ""))
+	case "DescribeSubnets":
+		outpost := ""
+		if f.outpostARN != "" {
+			outpost = fmt.Sprintf("<outpostArn>%s</outpostArn>", f.outpostARN)
+		}
+		fmt.Fprintf(w, `<DescribeSubnetsResponse><subnetSet><item><subnetId>subnet-1</subnetId><cidrBlock>10.0.0.0/24</cidrBlock>
+<availabilityZone>%s</availabilityZone>%s</item></subnetSet></DescribeSubnetsResponse>`, f.zone, outpost)
+	case "DescribeAvailabilityZones":
+		f.describedZones++
+		if r.Form.Get("ZoneName.1") != f.zone {
+			fmt.Fprint(w, `<DescribeAvailabilityZonesResponse><availabilityZoneInfo></availabilityZoneInfo></DescribeAvailabilityZonesResponse>`)
+			return
+		}
+		fmt.Fprintf(w, `<DescribeAvailabilityZonesResponse><availabilityZoneInfo><item><zoneName>%s</zoneName><zoneType>%s</zoneType>
+<networkBorderGroup>%s</networkBorderGroup></item></availabilityZoneInfo></DescribeAvailabilityZonesResponse>`, f.zone, f.zoneType, f.networkBorderGroup)
+	case "DescribeInstanceTypes":
+		fmt.Fprint(w, `<DescribeInstanceTypesResponse><instanceTypeSet><item><instanceType>m5.xlarge</instanceType><networkInfo>
+<ipv4AddressesPerInterface>15</ipv4AddressesPerInterface><ipv6AddressesPerInterface>15</ipv6AddressesPerInterface><ipv6Supported>true</ipv6Supported>
+</networkInfo></item></instanceTypeSet></DescribeInstanceTypesResponse>`)
+	case "AssignPrivateIpAddresses":
+		f.assigned = append(f.assigned, r.Form.Get("PrivateIpAddress.1"))
+		fmt.Fprint(w, `<AssignPrivateIpAddressesResponse><networkInterfaceId>eni-0123456789abcdef0</networkInterfaceId></AssignPrivateIpAddressesResponse>`)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestAWSPlacement(t *testing.T) {
+	tcs := []struct {
+		zone               string
+		zoneType           string
+		networkBorderGroup string
+		outpostARN         string
+		placement          string
+		// capacity is the IPv4 capacity with Elastic IPs configured.
+		capacity int
+	}{
+		{
+			zone:               "us-west-2a",
+			zoneType:           "availability-zone",
+			networkBorderGroup: "us-west-2",
+			placement:          "availability zone us-west-2a",
+			capacity:           14,
+		},
+		{
+			zone:               "us-west-2-lax-1a",
+			zoneType:           "local-zone",
+			networkBorderGroup: "us-west-2-lax-1",
+			placement:          "Local Zone us-west-2-lax-1a",
+			capacity:           14,
+		},
+		{
+			zone:               "us-west-2a",
+			zoneType:           "availability-zone",
+			networkBorderGroup: "us-west-2",
+			outpostARN:         "arn:aws:outposts:us-west-2:123456789012:outpost/op-0123456789abcdef0",
+			placement:          "Outpost arn:aws:outposts:us-west-2:123456789012:outpost/op-0123456789abcdef0 in zone us-west-2a",
+			capacity:           14,
+		},
+		// Elastic IPs can't be associated in Wavelength Zones.
+		{
+			zone:               "us-west-2-wl1-sfo-wlz-1",
+			zoneType:           "wavelength-zone",
+			networkBorderGroup: "us-west-2-wl1-sfo-wlz-1",
+			placement:          "Wavelength Zone us-west-2-wl1-sfo-wlz-1",
+			capacity:           0,
+		},
+	}
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0"},
+		Spec:       corev1.NodeSpec{ProviderID: "aws:///us-west-2a/i-0123456789abcdef0"},
+	}
+	networkInterface := &ec2types.InstanceNetworkInterface{SubnetId: awsapi.String("subnet-1")}
+	for i, tc := range tcs {
+		fake := &fakeEC2Placement{zone: tc.zone, zoneType: tc.zoneType, networkBorderGroup: tc.networkBorderGroup, outpostARN: tc.outpostARN}
+		server := httptest.NewServer(fake)
+		client := newTestEC2Client(server.URL)
+		a := &AWS{
+			CloudProvider: CloudProvider{ctx: context.Background(), cfg: CloudProviderConfig{AWSElasticIPPool: "ipv4pool-ec2-byoip"}},
+			client:        client,
+		}
+
+		placement, err := a.getPlacement(context.Background(), networkInterface)
+		if err != nil {
+			t.Fatalf("TestAWSPlacement(%d): received unexpected error, err: %v", i, err)
+		}
+		if placement.String() != tc.placement || placement.networkBorderGroup != tc.networkBorderGroup {
+			t.Fatalf("TestAWSPlacement(%d): expected %s in network border group %s, got %s in %s", i, tc.placement, tc.networkBorderGroup, placement, placement.networkBorderGroup)
+		}
+		// The zone is only described once.
+		if _, err := a.getPlacement(context.Background(), networkInterface); err != nil || fake.describedZones != 1 {
+			t.Fatalf("TestAWSPlacement(%d): expected the zone to be described once, got %d times, err: %v", i, fake.describedZones, err)
+		}
+
+		configs, err := a.GetNodeEgressIPConfiguration(context.Background(), node)
+		if err != nil {
+			t.Fatalf("TestAWSPlacement(%d): received unexpected error, err: %v", i, err)
+		}
+		if configs[0].Capacity.IPv4 != tc.capacity {
+			t.Fatalf("TestAWSPlacement(%d): expected IPv4 capacity %d, got %d", i, tc.capacity, configs[0].Capacity.IPv4)
+		}
+		if !placement.supportsElasticIPs() {
+			if err := a.AssignPrivateIP(context.Background(), net.ParseIP("10.0.0.10"), node); err == nil || len(fake.assigned) != 0 {
+				t.Fatalf("TestAWSPlacement(%d): expected the assignment to be refused, got %v assigned, err: %v", i, fake.assigned, err)
+			}
+		}
+		server.Close()
+	}
+}
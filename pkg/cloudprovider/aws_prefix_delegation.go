@@ -0,0 +1,216 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	awsapi "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// awsPrefixLength is the length of the IPv4 prefixes AWS delegates to
+	// network interfaces.
+	awsPrefixLength = 28
+	// awsEgressIPPrefixTagKeyPrefix prefixes the keys of the tags recording,
+	// on the network interface, the delegated prefix each egress IP is
+	// assigned out of: <prefix><egress IP> = <delegated prefix>.
+	awsEgressIPPrefixTagKeyPrefix = "cloud.network.openshift.io/egress-ip-prefix/"
+	// awsDelegatedPrefixTagKeyPrefix prefixes the keys of the tags recording,
+	// on the network interface, the prefixes the controller delegated itself,
+	// and thus releases once no egress IP is assigned out of them anymore.
+	awsDelegatedPrefixTagKeyPrefix = "cloud.network.openshift.io/delegated-prefix/"
+)
+
+// awsPrefixState is the state of the delegated prefixes of a network
+// interface.
+type awsPrefixState struct {
+	// prefixes are the delegated prefixes.
+	prefixes []string
+	// egressIPs maps the egress IPs to the delegated prefix they're assigned
+	// out of.
+	egressIPs map[string]string
+	// delegated are the prefixes the controller delegated itself.
+	delegated map[string]bool
+}
+
+// awsIPv4PrefixOf returns the /28 prefix holding ip.
+func awsIPv4PrefixOf(ip net.IP) string {
+	mask := net.CIDRMask(awsPrefixLength, 32)
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+}
+
+// usesPrefixDelegation returns true if ip is assigned out of delegated
+// prefixes, rather than as a secondary private IP address. Only IPv4 prefixes
+// are supported.
+func (a *AWS) usesPrefixDelegation(ip net.IP) bool {
+	return a.cfg.AWSPrefixDelegation && ip.To4() != nil
+}
+
+// getPrefixState returns the state of the delegated prefixes of the network
+// interface.
+func (a *AWS) getPrefixState(ctx context.Context, networkInterfaceID string) (*awsPrefixState, error) {
+	callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+	defer cancel()
+	output, err := a.client.DescribeNetworkInterfaces(callCtx, &ec2.DescribeNetworkInterfacesInput{NetworkInterfaceIds: []string{networkInterfaceID}})
+	if err != nil {
+		return nil, fmt.Errorf("error describing network interface %s, err: %v", networkInterfaceID, err)
+	}
+	if len(output.NetworkInterfaces) != 1 {
+		return nil, fmt.Errorf("error describing network interface %s, found %d network interfaces", networkInterfaceID, len(output.NetworkInterfaces))
+	}
+	networkInterface := output.NetworkInterfaces[0]
+	state := &awsPrefixState{
+		egressIPs: map[string]string{},
+		delegated: map[string]bool{},
+	}
+	for _, prefix := range networkInterface.Ipv4Prefixes {
+		state.prefixes = append(state.prefixes, awsapi.ToString(prefix.Ipv4Prefix))
+	}
+	for _, tag := range networkInterface.TagSet {
+		key := awsapi.ToString(tag.Key)
+		switch {
+		case strings.HasPrefix(key, awsEgressIPPrefixTagKeyPrefix):
+			state.egressIPs[strings.TrimPrefix(key, awsEgressIPPrefixTagKeyPrefix)] = awsapi.ToString(tag.Value)
+		case strings.HasPrefix(key, awsDelegatedPrefixTagKeyPrefix):
+			state.delegated[strings.TrimPrefix(key, awsDelegatedPrefixTagKeyPrefix)] = true
+		}
+	}
+	return state, nil
+}
+
+func (s *awsPrefixState) hasPrefix(prefix string) bool {
+	for _, p := range s.prefixes {
+		if p == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// assignPrivateIPFromPrefix assigns ip out of the /28 prefix holding it,
+// delegating that prefix to the network interface first if it isn't yet. The
+// assignment is recorded as a tag of the network interface. If the IP is
+// already assigned: it returns an AlreadyExistingIPError.
+func (a *AWS) assignPrivateIPFromPrefix(ctx context.Context, ip net.IP, networkInterfaceID string) error {
+	state, err := a.getPrefixState(ctx, networkInterfaceID)
+	if err != nil {
+		return err
+	}
+	prefix := awsIPv4PrefixOf(ip)
+	if state.egressIPs[ip.String()] == prefix && state.hasPrefix(prefix) {
+		return AlreadyExistingIPError
+	}
+	tags := []ec2types.Tag{{Key: awsapi.String(awsEgressIPPrefixTagKeyPrefix + ip.String()), Value: awsapi.String(prefix)}}
+	if !state.hasPrefix(prefix) {
+		klog.Infof("Delegating prefix %s to network interface %s for IP address %s", prefix, networkInterfaceID, ip)
+		input := &ec2.AssignPrivateIpAddressesInput{NetworkInterfaceId: awsapi.String(networkInterfaceID), Ipv4Prefixes: []string{prefix}}
+		callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+		_, err := a.client.AssignPrivateIpAddresses(callCtx, input)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("error delegating prefix %s to network interface %s, err: %v", prefix, networkInterfaceID, err)
+		}
+		if err := a.waitForPrefix(ctx, networkInterfaceID, prefix, false); err != nil {
+			return err
+		}
+		tags = append(tags, ec2types.Tag{Key: awsapi.String(awsDelegatedPrefixTagKeyPrefix + prefix), Value: awsapi.String("")})
+	}
+	callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+	defer cancel()
+	_, err = a.client.CreateTags(callCtx, &ec2.CreateTagsInput{
+		Resources: []string{networkInterfaceID},
+		Tags:      tags,
+	})
+	return err
+}
+
+// releasePrivateIPFromPrefix releases ip, and the prefix it's assigned out of
+// if the controller delegated it and no other egress IP is assigned out of it.
+// If the IP is not assigned: it returns a NonExistingIPError.
+func (a *AWS) releasePrivateIPFromPrefix(ctx context.Context, ip net.IP, networkInterfaceID string) error {
+	state, err := a.getPrefixState(ctx, networkInterfaceID)
+	if err != nil {
+		return err
+	}
+	prefix, ok := state.egressIPs[ip.String()]
+	if !ok {
+		return NonExistingIPError
+	}
+	tags := []ec2types.Tag{{Key: awsapi.String(awsEgressIPPrefixTagKeyPrefix + ip.String())}}
+	inUse := false
+	for egressIP, egressIPPrefix := range state.egressIPs {
+		if egressIP != ip.String() && egressIPPrefix == prefix {
+			inUse = true
+		}
+	}
+	if !inUse && state.delegated[prefix] && state.hasPrefix(prefix) {
+		klog.Infof("Releasing prefix %s from network interface %s, no egress IP is assigned out of it anymore", prefix, networkInterfaceID)
+		input := &ec2.UnassignPrivateIpAddressesInput{NetworkInterfaceId: awsapi.String(networkInterfaceID), Ipv4Prefixes: []string{prefix}}
+		callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+		_, err := a.client.UnassignPrivateIpAddresses(callCtx, input)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("error releasing prefix %s from network interface %s, err: %v", prefix, networkInterfaceID, err)
+		}
+		if err := a.waitForPrefix(ctx, networkInterfaceID, prefix, true); err != nil {
+			return err
+		}
+		tags = append(tags, ec2types.Tag{Key: awsapi.String(awsDelegatedPrefixTagKeyPrefix + prefix)})
+	}
+	callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+	defer cancel()
+	_, err = a.client.DeleteTags(callCtx, &ec2.DeleteTagsInput{
+		Resources: []string{networkInterfaceID},
+		Tags:      tags,
+	})
+	return err
+}
+
+// verifyPrivateIPFromPrefix verifies that ip is assigned out of a prefix
+// still delegated to the network interface.
+func (a *AWS) verifyPrivateIPFromPrefix(ctx context.Context, ip net.IP, networkInterfaceID string) error {
+	state, err := a.getPrefixState(ctx, networkInterfaceID)
+	if err != nil {
+		return err
+	}
+	prefix, ok := state.egressIPs[ip.String()]
+	if !ok || !state.hasPrefix(prefix) {
+		return fmt.Errorf("%w: IP address %s is not assigned out of a prefix delegated to network interface %s", MissingIPError, ip, networkInterfaceID)
+	}
+	return nil
+}
+
+// waitForPrefix waits until the prefix is delegated to the network interface,
+// or, if deleteOp is set, until it no longer is.
+func (a *AWS) waitForPrefix(ctx context.Context, networkInterfaceID, prefix string, deleteOp bool) error {
+	return wait.PollImmediate(time.Second*2, time.Minute, func() (done bool, err error) {
+		state, err := a.getPrefixState(ctx, networkInterfaceID)
+		if err != nil {
+			return false, err
+		}
+		return state.hasPrefix(prefix) != deleteOp, nil
+	})
+}
+
+// getPrefixCapacity returns the number of IPv4 addresses which can still be
+// assigned out of delegated prefixes: every address slot of the network
+// interface not taken by a secondary private IP address holds a prefix, either
+// already delegated or to be delegated.
+func (a *AWS) getPrefixCapacity(ctx context.Context, instanceV4Capacity int, networkInterface *ec2types.InstanceNetworkInterface) (int, error) {
+	state, err := a.getPrefixState(ctx, awsapi.ToString(networkInterface.NetworkInterfaceId))
+	if err != nil {
+		return 0, err
+	}
+	addressesPerPrefix := 1 << (32 - awsPrefixLength)
+	if capacity := (instanceV4Capacity-len(networkInterface.PrivateIpAddresses))*addressesPerPrefix - len(state.egressIPs); capacity > 0 {
+		return capacity, nil
+	}
+	return 0, nil
+}
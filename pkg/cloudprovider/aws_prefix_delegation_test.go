@@ -0,0 +1,142 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	awsapi "github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// fakeEC2Prefixes serves the EC2 API operations dealing with the delegated
+// prefixes and the tags of a single network interface.
+type fakeEC2Prefixes struct {
+	mu          sync.Mutex
+	prefixes    map[string]bool
+	tags        map[string]string
+	delegations int
+	releases    int
+}
+
+func (f *fakeEC2Prefixes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r.ParseForm()
+	switch r.Form.Get("Action") {
+	case "DescribeNetworkInterfaces":
+		var prefixes, tags []string
+		for prefix := range f.prefixes {
+			prefixes = append(prefixes, fmt.Sprintf("<item><ipv4Prefix>%s</ipv4Prefix></item>", prefix))
+		}
+		for key, value := range f.tags {
+			tags = append(tags, fmt.Sprintf("<item><key>%s</key><value>%s</value></item>", key, value))
+		}
+		sort.Strings(prefixes)
+		fmt.Fprintf(w, `<DescribeNetworkInterfacesResponse><networkInterfaceSet><item>
+<networkInterfaceId>%s</networkInterfaceId><ipv4PrefixSet>%s</ipv4PrefixSet><tagSet>%s</tagSet>
+</item></networkInterfaceSet></DescribeNetworkInterfacesResponse>`, r.Form.Get("NetworkInterfaceId.1"), strings.Join(prefixes, ""), strings.Join(tags, ""))
+	case "AssignPrivateIpAddresses":
+		f.prefixes[r.Form.Get("Ipv4Prefix.1")] = true
+		f.delegations++
+		fmt.Fprint(w, `<AssignPrivateIpAddressesResponse><return>true</return></AssignPrivateIpAddressesResponse>`)
+	case "UnassignPrivateIpAddresses":
+		delete(f.prefixes, r.Form.Get("Ipv4Prefix.1"))
+		f.releases++
+		fmt.Fprint(w, `<UnassignPrivateIpAddressesResponse><return>true</return></UnassignPrivateIpAddressesResponse>`)
+	case "CreateTags":
+		for i := 1; r.Form.Get(fmt.Sprintf("Tag.%d.Key", i)) != ""; i++ {
+			f.tags[r.Form.Get(fmt.Sprintf("Tag.%d.Key", i))] = r.Form.Get(fmt.Sprintf("Tag.%d.Value", i))
+		}
+		fmt.Fprint(w, `<CreateTagsResponse><return>true</return></CreateTagsResponse>`)
+	case "DeleteTags":
+		for i := 1; r.Form.Get(fmt.Sprintf("Tag.%d.Key", i)) != ""; i++ {
+			delete(f.tags, r.Form.Get(fmt.Sprintf("Tag.%d.Key", i)))
+		}
+		fmt.Fprint(w, `<DeleteTagsResponse><return>true</return></DeleteTagsResponse>`)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestPrivateIPFromPrefix(t *testing.T) {
+	// 10.0.0.16/28 was delegated out of band, e.g. at launch.
+	fake := &fakeEC2Prefixes{
+		prefixes: map[string]bool{"10.0.0.16/28": true},
+		tags:     map[string]string{},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client := newTestEC2Client(server.URL)
+	a := &AWS{
+		CloudProvider: CloudProvider{ctx: context.Background(), cfg: CloudProviderConfig{AWSPrefixDelegation: true}},
+		client:        client,
+	}
+	networkInterfaceID := "eni-0123456789abcdef0"
+
+	tcs := []struct {
+		release     bool
+		ip          string
+		err         error
+		prefixes    []string
+		delegations int
+		releases    int
+	}{
+		// Assigned out of the prefix delegated out of band.
+		{ip: "10.0.0.17", prefixes: []string{"10.0.0.16/28"}},
+		{ip: "10.0.0.17", err: AlreadyExistingIPError, prefixes: []string{"10.0.0.16/28"}},
+		// The prefix is delegated once, for the first IP address out of it.
+		{ip: "10.0.0.33", prefixes: []string{"10.0.0.16/28", "10.0.0.32/28"}, delegations: 1},
+		{ip: "10.0.0.34", prefixes: []string{"10.0.0.16/28", "10.0.0.32/28"}, delegations: 1},
+		// And released once no IP address is assigned out of it anymore.
+		{release: true, ip: "10.0.0.33", prefixes: []string{"10.0.0.16/28", "10.0.0.32/28"}, delegations: 1},
+		{release: true, ip: "10.0.0.34", prefixes: []string{"10.0.0.16/28"}, delegations: 1, releases: 1},
+		// Prefixes delegated out of band are never released.
+		{release: true, ip: "10.0.0.17", prefixes: []string{"10.0.0.16/28"}, delegations: 1, releases: 1},
+		{release: true, ip: "10.0.0.17", err: NonExistingIPError, prefixes: []string{"10.0.0.16/28"}, delegations: 1, releases: 1},
+	}
+	for i, tc := range tcs {
+		ip := net.ParseIP(tc.ip)
+		var err error
+		if tc.release {
+			err = a.releasePrivateIPFromPrefix(context.Background(), ip, networkInterfaceID)
+		} else {
+			err = a.assignPrivateIPFromPrefix(context.Background(), ip, networkInterfaceID)
+		}
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("TestPrivateIPFromPrefix(%d): expected error %v, got: %v", i, tc.err, err)
+		}
+		if tc.err == nil && !tc.release {
+			if err := a.verifyPrivateIPFromPrefix(context.Background(), ip, networkInterfaceID); err != nil {
+				t.Fatalf("TestPrivateIPFromPrefix(%d): expected %s to be verified, err: %q", i, ip, err)
+			}
+		}
+		state, err := a.getPrefixState(context.Background(), networkInterfaceID)
+		if err != nil {
+			t.Fatalf("TestPrivateIPFromPrefix(%d): received unexpected error, err: %q", i, err)
+		}
+		if fmt.Sprint(state.prefixes) != fmt.Sprint(tc.prefixes) || fake.delegations != tc.delegations || fake.releases != tc.releases {
+			t.Fatalf("TestPrivateIPFromPrefix(%d): expected prefixes %v after %d delegations and %d releases, got %v after %d delegations and %d releases",
+				i, tc.prefixes, tc.delegations, tc.releases, state.prefixes, fake.delegations, fake.releases)
+		}
+	}
+
+	// 10 address slots, of which the primary IP address takes one: the other 9
+	// hold a prefix of 16 addresses each.
+	fake.tags[awsEgressIPPrefixTagKeyPrefix+"10.0.0.17"] = "10.0.0.16/28"
+	capacity, err := a.getPrefixCapacity(context.Background(), 10, &ec2types.InstanceNetworkInterface{
+		NetworkInterfaceId: awsapi.String(networkInterfaceID),
+		PrivateIpAddresses: []ec2types.InstancePrivateIpAddress{{PrivateIpAddress: awsapi.String("10.0.0.10")}},
+	})
+	if err != nil || capacity != 9*16-1 {
+		t.Fatalf("TestPrivateIPFromPrefix: expected a capacity of %d, got %d, err: %v", 9*16-1, capacity, err)
+	}
+}
@@ -0,0 +1,45 @@
+package cloudprovider
+
+import (
+	awsapi "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"k8s.io/klog/v2"
+)
+
+// initNetworkClient creates the client of the account owning the VPC, if it's
+// shared with the account of the instances and AWSNetworkRoleARN is set. The
+// role is assumed with the credentials of the instances' account, c being
+// their configuration.
+func (a *AWS) initNetworkClient(c awsapi.Config) {
+	if a.cfg.AWSNetworkRoleARN == "" {
+		return
+	}
+	klog.Infof("Assuming AWS role %s of the account owning the VPC to look up subnets", a.cfg.AWSNetworkRoleARN)
+	networkConfig := c.Copy()
+	networkConfig.Credentials = a.networkRoleCredentials(c)
+	a.networkClient = a.newEC2Client(networkConfig)
+}
+
+// networkRoleCredentials returns the credentials of AWSNetworkRoleARN, which
+// are refreshed automatically before they expire. Like for AWSRoleARN, STS is
+// reached on its own endpoint.
+func (a *AWS) networkRoleCredentials(c awsapi.Config) awsapi.CredentialsProvider {
+	return awsapi.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(c), a.cfg.AWSNetworkRoleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = awsRoleSessionName
+		if a.cfg.AWSNetworkRoleExternalID != "" {
+			o.ExternalID = awsapi.String(a.cfg.AWSNetworkRoleExternalID)
+		}
+	}))
+}
+
+// subnetClient returns the client to look up subnets and their zones with: in
+// shared VPCs, the subnets belong to the account owning the VPC, and zone
+// names are mapped to different zones in each account.
+func (a *AWS) subnetClient() *ec2.Client {
+	if a.networkClient != nil {
+		return a.networkClient
+	}
+	return a.client
+}
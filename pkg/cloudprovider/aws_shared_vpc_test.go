@@ -0,0 +1,83 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	awsapi "github.com/aws/aws-sdk-go-v2/aws"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAWSSharedVPC(t *testing.T) {
+	// The instances' account can't describe the shared subnet.
+	instanceAccount := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.Form.Get("Action") {
+		case "DescribeInstances":
+			fmt.Fprint(w, `<DescribeInstancesResponse><reservationSet><item><instancesSet><item>
+<instanceId>i-0123456789abcdef0</instanceId><instanceType>m5.xlarge</instanceType><networkInterfaceSet><item>
+<networkInterfaceId>eni-0123456789abcdef0</networkInterfaceId><subnetId>subnet-shared</subnetId>
+<privateIpAddressesSet><item><privateIpAddress>10.0.0.5</privateIpAddress><primary>true</primary></item></privateIpAddressesSet>
+</item></networkInterfaceSet></item></instancesSet></item></reservationSet></DescribeInstancesResponse>`)
+		case "DescribeInstanceTypes":
+			fmt.Fprint(w, `<DescribeInstanceTypesResponse><instanceTypeSet><item><instanceType>m5.xlarge</instanceType><networkInfo>
+<ipv4AddressesPerInterface>15</ipv4AddressesPerInterface></networkInfo></item></instanceTypeSet></DescribeInstanceTypesResponse>`)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<Response><Errors><Error><Code>UnauthorizedOperation</Code><Message>not authorized</Message></Error></Errors></Response>`)
+		}
+	}))
+	defer instanceAccount.Close()
+	networkAccount := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.Form.Get("Action") {
+		case "DescribeSubnets":
+			fmt.Fprint(w, `<DescribeSubnetsResponse><subnetSet><item><subnetId>subnet-shared</subnetId><cidrBlock>10.0.0.0/24</cidrBlock>
+<availabilityZone>us-west-2a</availabilityZone></item></subnetSet></DescribeSubnetsResponse>`)
+		case "DescribeAvailabilityZones":
+			fmt.Fprint(w, `<DescribeAvailabilityZonesResponse><availabilityZoneInfo><item><zoneName>us-west-2a</zoneName><zoneType>availability-zone</zoneType>
+<networkBorderGroup>us-west-2</networkBorderGroup></item></availabilityZoneInfo></DescribeAvailabilityZonesResponse>`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer networkAccount.Close()
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0"},
+		Spec:       corev1.NodeSpec{ProviderID: "aws:///us-west-2a/i-0123456789abcdef0"},
+	}
+	cfg := CloudProviderConfig{AWSElasticIPPool: "ipv4pool-ec2-byoip"}
+
+	a := &AWS{CloudProvider: CloudProvider{ctx: context.Background(), cfg: cfg}, client: newTestEC2Client(instanceAccount.URL)}
+	if _, err := a.GetNodeEgressIPConfiguration(context.Background(), node); err == nil {
+		t.Fatalf("TestAWSSharedVPC: expected looking up the subnet in the instances' account to fail")
+	}
+
+	a = &AWS{CloudProvider: CloudProvider{ctx: context.Background(), cfg: cfg}, client: newTestEC2Client(instanceAccount.URL), networkClient: newTestEC2Client(networkAccount.URL)}
+	configs, err := a.GetNodeEgressIPConfiguration(context.Background(), node)
+	if err != nil {
+		t.Fatalf("TestAWSSharedVPC: received unexpected error, err: %v", err)
+	}
+	if configs[0].IFAddr.IPv4 != "10.0.0.0/24" || configs[0].Capacity.IPv4 != 14 {
+		t.Fatalf("TestAWSSharedVPC: expected subnet 10.0.0.0/24 with IPv4 capacity 14, got %s with %d", configs[0].IFAddr.IPv4, configs[0].Capacity.IPv4)
+	}
+}
+
+func TestInitNetworkClient(t *testing.T) {
+	c := awsapi.Config{Region: "us-west-2"}
+	a := &AWS{}
+	a.initNetworkClient(c)
+	if a.networkClient != nil || a.subnetClient() != a.client {
+		t.Fatalf("TestInitNetworkClient: expected no network client without role")
+	}
+	a = &AWS{CloudProvider: CloudProvider{ctx: context.Background(), cfg: CloudProviderConfig{AWSNetworkRoleARN: "arn:aws:iam::210987654321:role/cncc-network", AWSNetworkRoleExternalID: "external"}}}
+	a.initNetworkClient(c)
+	if a.networkClient == nil || a.subnetClient() != a.networkClient {
+		t.Fatalf("TestInitNetworkClient: expected subnets to be looked up with the network client")
+	}
+}
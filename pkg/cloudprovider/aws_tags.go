@@ -0,0 +1,131 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	awsapi "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// awsClusterIDTagKey, awsOwnedByTagKey and awsNodeTagKey are the keys of
+	// the tags set on the network interfaces and Elastic IPs the controller
+	// changes, if AWSTagResources is set: the ID of the cluster, the
+	// controller, and the node the resource is used by.
+	awsClusterIDTagKey = "cloud.network.openshift.io/cluster-id"
+	awsOwnedByTagKey   = "cloud.network.openshift.io/owned-by"
+	awsNodeTagKey      = "cloud.network.openshift.io/node"
+)
+
+// parseAWSResourceTags parses a comma separated list of <key>=<value> tags.
+func parseAWSResourceTags(s string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(tag, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.HasPrefix(key, "aws:") {
+			return nil, fmt.Errorf("invalid AWS resource tag %q, expected <key>=<value> with a key not starting with aws:", tag)
+		}
+		tags[key] = strings.TrimSpace(value)
+	}
+	return tags, nil
+}
+
+// tagsResources returns true if the resources the controller changes are
+// tagged.
+func (a *AWS) tagsResources() bool {
+	return a.cfg.AWSTagResources || len(a.resourceTags) > 0
+}
+
+// getResourceTags returns the tags of the resources the controller changes for
+// node, sorted by key.
+func (a *AWS) getResourceTags(node *corev1.Node) []ec2types.Tag {
+	tags := map[string]string{}
+	for key, value := range a.resourceTags {
+		tags[key] = value
+	}
+	if a.cfg.AWSTagResources {
+		if a.cfg.ClusterID != "" {
+			tags[awsClusterIDTagKey] = a.cfg.ClusterID
+		}
+		tags[awsOwnedByTagKey] = UserAgent
+		tags[awsNodeTagKey] = node.Name
+	}
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	ec2Tags := make([]ec2types.Tag, 0, len(keys))
+	for _, key := range keys {
+		ec2Tags = append(ec2Tags, ec2types.Tag{Key: awsapi.String(key), Value: awsapi.String(tags[key])})
+	}
+	return ec2Tags
+}
+
+// tagResources tags the resources changed for node. The tags are informative,
+// failing to set them doesn't fail the change.
+func (a *AWS) tagResources(ctx context.Context, node *corev1.Node, resourceIDs ...string) {
+	if !a.tagsResources() || len(resourceIDs) == 0 {
+		return
+	}
+	callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+	defer cancel()
+	_, err := a.client.CreateTags(callCtx, &ec2.CreateTagsInput{
+		Resources: resourceIDs,
+		Tags:      a.getResourceTags(node),
+	})
+	if err != nil {
+		klog.Warningf("Could not tag AWS resources %v of node %s, err: %v", resourceIDs, node.Name, err)
+	}
+}
+
+// untagNode removes the node tag from resources no longer used by the node,
+// e.g. Elastic IPs disassociated from it.
+func (a *AWS) untagNode(ctx context.Context, resourceIDs ...string) {
+	if !a.cfg.AWSTagResources || len(resourceIDs) == 0 {
+		return
+	}
+	callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+	defer cancel()
+	_, err := a.client.DeleteTags(callCtx, &ec2.DeleteTagsInput{
+		Resources: resourceIDs,
+		Tags:      []ec2types.Tag{{Key: awsapi.String(awsNodeTagKey)}},
+	})
+	if err != nil {
+		klog.Warningf("Could not remove tag %s from AWS resources %v, err: %v", awsNodeTagKey, resourceIDs, err)
+	}
+}
+
+// getOwnedNetworkInterfaceIDs returns the IDs of the network interfaces the
+// controller of the cluster tagged.
+func (a *AWS) getOwnedNetworkInterfaceIDs(ctx context.Context) (map[string]bool, error) {
+	filters := []ec2types.Filter{{Name: awsapi.String("tag:" + awsOwnedByTagKey), Values: []string{UserAgent}}}
+	if a.cfg.ClusterID != "" {
+		filters = append(filters, ec2types.Filter{Name: awsapi.String("tag:" + awsClusterIDTagKey), Values: []string{a.cfg.ClusterID}})
+	}
+	callCtx, cancel := context.WithTimeout(ctx, defaultAWSOperationTimeout)
+	defer cancel()
+	owned := map[string]bool{}
+	paginator := ec2.NewDescribeNetworkInterfacesPaginator(a.client, &ec2.DescribeNetworkInterfacesInput{Filters: filters})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(callCtx)
+		if err != nil {
+			return nil, fmt.Errorf("error describing the network interfaces tagged by the controller, err: %v", err)
+		}
+		for _, networkInterface := range output.NetworkInterfaces {
+			owned[awsapi.ToString(networkInterface.NetworkInterfaceId)] = true
+		}
+	}
+	return owned, nil
+}
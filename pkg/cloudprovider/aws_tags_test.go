@@ -0,0 +1,205 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseAWSResourceTags(t *testing.T) {
+	tcs := []struct {
+		tags     string
+		expected map[string]string
+		err      bool
+	}{
+		{
+			tags:     "",
+			expected: map[string]string{},
+		},
+		{
+			tags:     "cost-center=net, team = sdn ,empty=",
+			expected: map[string]string{"cost-center": "net", "team": "sdn", "empty": ""},
+		},
+		{
+			tags: "cost-center",
+			err:  true,
+		},
+		{
+			tags: "=net",
+			err:  true,
+		},
+		{
+			tags: "aws:cloudformation:stack-name=x",
+			err:  true,
+		},
+	}
+
+	for i, tc := range tcs {
+		tags, err := parseAWSResourceTags(tc.tags)
+		if tc.err {
+			if err == nil {
+				t.Fatalf("TestParseAWSResourceTags(%d): expected an error for %q", i, tc.tags)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestParseAWSResourceTags(%d): received unexpected error, err: %v", i, err)
+		}
+		if !reflect.DeepEqual(tags, tc.expected) {
+			t.Fatalf("TestParseAWSResourceTags(%d): expected %v, got %v", i, tc.expected, tags)
+		}
+	}
+}
+
+func TestAWSTagResources(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}}
+	tcs := []struct {
+		cfg          CloudProviderConfig
+		resourceTags map[string]string
+		// expected form values of the CreateTags and DeleteTags requests
+		expectedCreate map[string]string
+		expectedDelete map[string]string
+	}{
+		// Nothing is tagged unless configured.
+		{
+			cfg: CloudProviderConfig{ClusterID: "cluster-x7k2p"},
+		},
+		{
+			cfg:          CloudProviderConfig{ClusterID: "cluster-x7k2p", AWSTagResources: true},
+			resourceTags: map[string]string{"cost-center": "net"},
+			expectedCreate: map[string]string{
+				"ResourceId.1": "eni-1",
+				"ResourceId.2": "eipalloc-1",
+				"Tag.1.Key":    awsClusterIDTagKey,
+				"Tag.1.Value":  "cluster-x7k2p",
+				"Tag.2.Key":    awsNodeTagKey,
+				"Tag.2.Value":  "node-a",
+				"Tag.3.Key":    awsOwnedByTagKey,
+				"Tag.3.Value":  UserAgent,
+				"Tag.4.Key":    "cost-center",
+				"Tag.4.Value":  "net",
+			},
+			expectedDelete: map[string]string{
+				"ResourceId.1": "eipalloc-1",
+				"Tag.1.Key":    awsNodeTagKey,
+			},
+		},
+		// Only the extra tags are set, without cluster ID nor node.
+		{
+			resourceTags: map[string]string{"cost-center": "net"},
+			expectedCreate: map[string]string{
+				"ResourceId.1": "eni-1",
+				"ResourceId.2": "eipalloc-1",
+				"Tag.1.Key":    "cost-center",
+				"Tag.1.Value":  "net",
+			},
+		},
+	}
+
+	for i, tc := range tcs {
+		requests := map[string]map[string]string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			action := r.Form.Get("Action")
+			form := map[string]string{}
+			for key := range r.Form {
+				if key != "Action" && key != "Version" {
+					form[key] = r.Form.Get(key)
+				}
+			}
+			requests[action] = form
+			fmt.Fprintf(w, `<%sResponse><return>true</return></%sResponse>`, action, action)
+		}))
+		client := newTestEC2Client(server.URL)
+		a := &AWS{
+			CloudProvider: CloudProvider{ctx: context.Background(), cfg: tc.cfg},
+			client:        client,
+			resourceTags:  tc.resourceTags,
+		}
+
+		a.tagResources(context.Background(), node, "eni-1", "eipalloc-1")
+		a.untagNode(context.Background(), "eipalloc-1")
+		server.Close()
+		if !reflect.DeepEqual(requests["CreateTags"], tc.expectedCreate) {
+			t.Fatalf("TestAWSTagResources(%d): expected CreateTags %v, got %v", i, tc.expectedCreate, requests["CreateTags"])
+		}
+		if !reflect.DeepEqual(requests["DeleteTags"], tc.expectedDelete) {
+			t.Fatalf("TestAWSTagResources(%d): expected DeleteTags %v, got %v", i, tc.expectedDelete, requests["DeleteTags"])
+		}
+	}
+}
+
+func TestAWSListOwnedResources(t *testing.T) {
+	var ownedFilters map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.Form.Get("Action") {
+		case "DescribeInstances":
+			// Both instances have secondary IP addresses, only the network
+			// interface of i-a was tagged by the controller.
+			instanceID := r.Form.Get("InstanceId.1")
+			networkInterface := map[string]string{
+				"i-a": `<networkInterfaceId>eni-a</networkInterfaceId>
+<privateIpAddressesSet><item><privateIpAddress>10.0.0.10</privateIpAddress><primary>true</primary></item><item><privateIpAddress>10.0.0.11</privateIpAddress><primary>false</primary></item></privateIpAddressesSet>
+<ipv6AddressesSet><item><ipv6Address>2600:1f14::11</ipv6Address></item></ipv6AddressesSet>`,
+				"i-b": `<networkInterfaceId>eni-b</networkInterfaceId>
+<privateIpAddressesSet><item><privateIpAddress>10.0.0.20</privateIpAddress><primary>true</primary></item><item><privateIpAddress>10.0.0.21</privateIpAddress><primary>false</primary></item></privateIpAddressesSet>`,
+			}[instanceID]
+			fmt.Fprintf(w, `<DescribeInstancesResponse><reservationSet><item><instancesSet><item>
+<instanceId>%s</instanceId><networkInterfaceSet><item>%s</item></networkInterfaceSet>
+</item></instancesSet></item></reservationSet></DescribeInstancesResponse>`, instanceID, networkInterface)
+		case "DescribeNetworkInterfaces":
+			ownedFilters = map[string]string{}
+			for i := 1; r.Form.Get(fmt.Sprintf("Filter.%d.Name", i)) != ""; i++ {
+				ownedFilters[r.Form.Get(fmt.Sprintf("Filter.%d.Name", i))] = r.Form.Get(fmt.Sprintf("Filter.%d.Value.1", i))
+			}
+			fmt.Fprint(w, `<DescribeNetworkInterfacesResponse><networkInterfaceSet><item><networkInterfaceId>eni-a</networkInterfaceId></item></networkInterfaceSet></DescribeNetworkInterfacesResponse>`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	nodes := []*corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}, Spec: corev1.NodeSpec{ProviderID: "aws:///us-west-2a/i-a"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-b"}, Spec: corev1.NodeSpec{ProviderID: "aws:///us-west-2a/i-b"}},
+	}
+	a := &AWS{
+		CloudProvider: CloudProvider{ctx: context.Background()},
+		client:        newTestEC2Client(server.URL),
+	}
+	if _, err := a.ListOwnedResources(context.Background(), nodes); !errors.Is(err, OwnedResourcesUnsupportedError) {
+		t.Fatalf("TestAWSListOwnedResources: expected an OwnedResourcesUnsupportedError without tags, got err: %v", err)
+	}
+
+	a.cfg = CloudProviderConfig{ClusterID: "cluster-x7k2p", AWSTagResources: true}
+	resources, err := a.ListOwnedResources(context.Background(), nodes)
+	if err != nil {
+		t.Fatalf("TestAWSListOwnedResources: received unexpected error, err: %v", err)
+	}
+	expectedFilters := map[string]string{
+		"tag:" + awsOwnedByTagKey:   UserAgent,
+		"tag:" + awsClusterIDTagKey: "cluster-x7k2p",
+	}
+	if !reflect.DeepEqual(ownedFilters, expectedFilters) {
+		t.Fatalf("TestAWSListOwnedResources: expected the network interfaces to be filtered by %v, got %v", expectedFilters, ownedFilters)
+	}
+	found := []string{}
+	for _, resource := range resources {
+		if resource.Node != "node-a" || resource.node != nodes[0] {
+			t.Fatalf("TestAWSListOwnedResources: expected %s to belong to node-a, got %q", resource.ID, resource.Node)
+		}
+		found = append(found, resource.ID+"="+resource.IP.String())
+	}
+	expected := []string{"eni-a/10.0.0.11=10.0.0.11", "eni-a/2600:1f14::11=2600:1f14::11"}
+	if !reflect.DeepEqual(found, expected) {
+		t.Fatalf("TestAWSListOwnedResources: expected %v, got %v", expected, found)
+	}
+}
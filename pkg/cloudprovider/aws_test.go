@@ -1,9 +1,35 @@
 package cloudprovider
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+
+	awsapi "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	corev1 "k8s.io/api/core/v1"
 )
 
+// newTestEC2Client returns an EC2 client sending its requests to the test
+// server at url.
+func newTestEC2Client(url string, optFns ...func(*ec2.Options)) *ec2.Client {
+	return ec2.New(ec2.Options{
+		Region:           "us-west-2",
+		Credentials:      credentials.NewStaticCredentialsProvider("id", "secret", ""),
+		EndpointResolver: ec2.EndpointResolverFromURL(url),
+	}, optFns...)
+}
+
 func TestGetInstanceIdFromProviderId(t *testing.T) {
 	tcs := []struct {
 		input     string
@@ -70,3 +96,444 @@ func TestGetInstanceIdFromProviderId(t *testing.T) {
 		}
 	}
 }
+
+func TestGetInstanceIdIMDSFallback(t *testing.T) {
+	// Serve IMDSv2: a session token must be requested before any metadata.
+	const token = "imds-token"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+			fmt.Fprint(w, token)
+		case r.Header.Get("X-Aws-Ec2-Metadata-Token") != token:
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/latest/dynamic/instance-identity/document":
+			fmt.Fprint(w, `{"instanceId": "i-008447f243eead273", "privateIp": "10.0.0.10", "region": "us-west-2"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	a := &AWS{
+		CloudProvider: CloudProvider{ctx: context.Background()},
+		metadata:      imds.New(imds.Options{Endpoint: server.URL}),
+	}
+
+	tcs := []struct {
+		providerID string
+		internalIP string
+		output     string
+		expectErr  bool
+	}{
+		{
+			providerID: "aws:///us-west-2a/i-0a1b2c3d4e5f60718",
+			internalIP: "10.0.0.10",
+			output:     "i-0a1b2c3d4e5f60718",
+		},
+		{
+			internalIP: "10.0.0.10",
+			output:     "i-008447f243eead273",
+		},
+		{
+			internalIP: "10.0.0.11",
+			expectErr:  true,
+		},
+	}
+	for i, tc := range tcs {
+		node := &corev1.Node{}
+		node.Name = "node"
+		node.Spec.ProviderID = tc.providerID
+		node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: tc.internalIP}}
+		out, err := a.getInstanceId(context.Background(), node)
+		if tc.expectErr {
+			if err == nil {
+				t.Fatalf("TestGetInstanceIdIMDSFallback(%d): expected an error, got %s", i, out)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestGetInstanceIdIMDSFallback(%d): received unexpected error, err: %q", i, err)
+		}
+		if out != tc.output {
+			t.Fatalf("TestGetInstanceIdIMDSFallback(%d): expected instance id %s, got %s", i, tc.output, out)
+		}
+	}
+}
+
+func TestGetInstanceThrottledIMDSFallback(t *testing.T) {
+	const token = "imds-token"
+	metadata := map[string]string{
+		"/latest/dynamic/instance-identity/document":                                     `{"instanceId": "i-008447f243eead273", "instanceType": "m5.large", "privateIp": "10.0.0.10", "region": "us-west-2"}`,
+		"/latest/meta-data/network/interfaces/macs/":                                     "0a:00:00:00:00:02/\n0a:00:00:00:00:01/",
+		"/latest/meta-data/network/interfaces/macs/0a:00:00:00:00:01/interface-id":       "eni-1",
+		"/latest/meta-data/network/interfaces/macs/0a:00:00:00:00:01/device-number":      "0",
+		"/latest/meta-data/network/interfaces/macs/0a:00:00:00:00:01/subnet-id":          "subnet-1",
+		"/latest/meta-data/network/interfaces/macs/0a:00:00:00:00:01/local-ipv4s":        "10.0.0.10\n10.0.0.20",
+		"/latest/meta-data/network/interfaces/macs/0a:00:00:00:00:01/security-group-ids": "sg-1",
+		"/latest/meta-data/network/interfaces/macs/0a:00:00:00:00:02/interface-id":       "eni-2",
+		"/latest/meta-data/network/interfaces/macs/0a:00:00:00:00:02/device-number":      "1",
+		"/latest/meta-data/network/interfaces/macs/0a:00:00:00:00:02/subnet-id":          "subnet-2",
+		"/latest/meta-data/network/interfaces/macs/0a:00:00:00:00:02/local-ipv4s":        "10.0.1.10",
+		"/latest/meta-data/network/interfaces/macs/0a:00:00:00:00:02/ipv6s":              "fd00::10",
+	}
+	metadataServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+			fmt.Fprint(w, token)
+		case r.Header.Get("X-Aws-Ec2-Metadata-Token") != token:
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			value, ok := metadata[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, value)
+		}
+	}))
+	defer metadataServer.Close()
+	ec2Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `<Response><Errors><Error><Code>RequestLimitExceeded</Code><Message>Request limit exceeded.</Message></Error></Errors></Response>`)
+	}))
+	defer ec2Server.Close()
+
+	a := &AWS{
+		CloudProvider: CloudProvider{ctx: context.Background()},
+		metadata:      imds.New(imds.Options{Endpoint: metadataServer.URL}),
+		client: newTestEC2Client(ec2Server.URL, func(o *ec2.Options) {
+			o.Retryer = retry.NewStandard(func(o *retry.StandardOptions) {
+				o.MaxAttempts = 1
+			})
+		}),
+	}
+	node := &corev1.Node{}
+	node.Name = "node"
+	node.Spec.ProviderID = "aws:///us-west-2a/i-008447f243eead273"
+	instance, err := a.getInstance(context.Background(), node)
+	if err != nil {
+		t.Fatalf("TestGetInstanceThrottledIMDSFallback: unexpected error, err: %v", err)
+	}
+	if instance.InstanceType != "m5.large" || len(instance.NetworkInterfaces) != 2 {
+		t.Fatalf("TestGetInstanceThrottledIMDSFallback: unexpected instance %+v", instance)
+	}
+	primary, secondary := instance.NetworkInterfaces[0], instance.NetworkInterfaces[1]
+	if awsapi.ToString(primary.NetworkInterfaceId) != "eni-1" || awsapi.ToString(primary.SubnetId) != "subnet-1" ||
+		len(primary.PrivateIpAddresses) != 2 || !awsapi.ToBool(primary.PrivateIpAddresses[0].Primary) ||
+		len(primary.Groups) != 1 || len(primary.Ipv6Addresses) != 0 {
+		t.Fatalf("TestGetInstanceThrottledIMDSFallback: unexpected primary network interface %+v", primary)
+	}
+	if awsapi.ToString(secondary.NetworkInterfaceId) != "eni-2" || awsapi.ToInt32(secondary.Attachment.DeviceIndex) != 1 ||
+		len(secondary.Ipv6Addresses) != 1 || awsapi.ToString(secondary.Ipv6Addresses[0].Ipv6Address) != "fd00::10" {
+		t.Fatalf("TestGetInstanceThrottledIMDSFallback: unexpected secondary network interface %+v", secondary)
+	}
+	if a.instances.getInstance("i-008447f243eead273") != nil {
+		t.Fatalf("TestGetInstanceThrottledIMDSFallback: expected the instance described through the metadata service not to be cached")
+	}
+
+	// Other nodes can't be described through the local metadata service.
+	node.Spec.ProviderID = "aws:///us-west-2a/i-0a1b2c3d4e5f60718"
+	if _, err := a.getInstance(context.Background(), node); err == nil || !strings.Contains(err.Error(), "is not the local instance") {
+		t.Fatalf("TestGetInstanceThrottledIMDSFallback: expected another node not to be described, err: %v", err)
+	}
+}
+
+func TestAssumeRoleCredentials(t *testing.T) {
+	tcs := []struct {
+		cfg         CloudProviderConfig
+		expectCreds bool
+		expectErr   bool
+	}{
+		{},
+		{
+			cfg:       CloudProviderConfig{AWSWebIdentityTokenFile: "/var/run/secrets/token"},
+			expectErr: true,
+		},
+		{
+			cfg:         CloudProviderConfig{AWSRoleARN: "arn:aws:iam::123456789012:role/cncc", AWSRoleExternalID: "external"},
+			expectCreds: true,
+		},
+		{
+			cfg:         CloudProviderConfig{AWSRoleARN: "arn:aws:iam::123456789012:role/cncc", AWSWebIdentityTokenFile: "/var/run/secrets/token"},
+			expectCreds: true,
+		},
+	}
+	for i, tc := range tcs {
+		a := &AWS{CloudProvider: CloudProvider{ctx: context.Background(), cfg: tc.cfg}}
+		creds, err := a.assumeRoleCredentials(awsapi.Config{Region: "us-west-2"})
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestAssumeRoleCredentials(%d): expected error: %t, got: %v", i, tc.expectErr, err)
+		}
+		if tc.expectCreds != (creds != nil) {
+			t.Fatalf("TestAssumeRoleCredentials(%d): expected credentials: %t, got: %v", i, tc.expectCreds, creds)
+		}
+	}
+}
+
+func TestParseAWSEndpointOverrides(t *testing.T) {
+	tcs := []struct {
+		input     string
+		output    map[string]string
+		errString bool
+	}{
+		{
+			input: "ec2=https://vpce-0123.ec2.us-east-1.vpce.amazonaws.com, STS=https://sts-fips.us-east-1.amazonaws.com",
+			output: map[string]string{
+				"ec2": "https://vpce-0123.ec2.us-east-1.vpce.amazonaws.com",
+				"sts": "https://sts-fips.us-east-1.amazonaws.com",
+			},
+		},
+		{
+			input:     "s3=https://s3.us-east-1.amazonaws.com",
+			errString: true,
+		},
+		{
+			input:     "ec2=ec2.us-east-1.amazonaws.com",
+			errString: true,
+		},
+		{
+			input:     "ec2",
+			errString: true,
+		},
+	}
+
+	for i, tc := range tcs {
+		overrides, err := parseAWSEndpointOverrides(tc.input)
+		if tc.errString {
+			if err == nil {
+				t.Fatalf("TestParseAWSEndpointOverrides(%d): expected an error for %q", i, tc.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestParseAWSEndpointOverrides(%d): unexpected error, err: %q", i, err)
+		}
+		if !reflect.DeepEqual(overrides, tc.output) {
+			t.Fatalf("TestParseAWSEndpointOverrides(%d): expected %v, got %v", i, tc.output, overrides)
+		}
+	}
+
+	// Overridden services are signed for the configured region, all others
+	// are resolved as usual.
+	resolver := awsEndpointResolver(map[string]string{"ec2": "https://vpce-0123.ec2.us-gov-west-1.vpce.amazonaws.com"})
+	resolved, err := resolver.ResolveEndpoint(ec2.ServiceID, "us-gov-west-1")
+	if err != nil || resolved.URL != "https://vpce-0123.ec2.us-gov-west-1.vpce.amazonaws.com" || resolved.SigningRegion != "us-gov-west-1" {
+		t.Fatalf("TestParseAWSEndpointOverrides: unexpected ec2 endpoint %v, err: %v", resolved, err)
+	}
+	var notFound *awsapi.EndpointNotFoundError
+	if _, err = resolver.ResolveEndpoint(sts.ServiceID, "us-gov-west-1"); !errors.As(err, &notFound) {
+		t.Fatalf("TestParseAWSEndpointOverrides: expected the sts endpoint to be left to the SDK, err: %v", err)
+	}
+}
+
+func TestGetInstanceCapacity(t *testing.T) {
+	describeInstanceTypes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("Action") != "DescribeInstanceTypes" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		describeInstanceTypes++
+		fmt.Fprintf(w, `<DescribeInstanceTypesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+  <instanceTypeSet>
+    <item>
+      <instanceType>%s</instanceType>
+      <networkInfo>
+        <ipv4AddressesPerInterface>15</ipv4AddressesPerInterface>
+        <ipv6AddressesPerInterface>15</ipv6AddressesPerInterface>
+        <ipv6Supported>%t</ipv6Supported>
+      </networkInfo>
+    </item>
+  </instanceTypeSet>
+</DescribeInstanceTypesResponse>`, r.Form.Get("InstanceType.1"), r.Form.Get("InstanceType.1") != "x9z.large")
+	}))
+	defer server.Close()
+
+	client := newTestEC2Client(server.URL)
+	a := &AWS{CloudProvider: CloudProvider{ctx: context.Background()}, client: client}
+
+	tcs := []struct {
+		instanceType string
+		ipv4         int
+		ipv6         int
+		calls        int
+	}{
+		{instanceType: "m5.xlarge", ipv4: 15, ipv6: 15, calls: 1},
+		// Served from the cache.
+		{instanceType: "m5.xlarge", ipv4: 15, ipv6: 15, calls: 1},
+		// Instance types without IPv6 support have no IPv6 capacity.
+		{instanceType: "x9z.large", ipv4: 15, ipv6: 0, calls: 2},
+	}
+	for i, tc := range tcs {
+		ipv4, ipv6, err := a.getInstanceCapacity(context.Background(), &ec2types.Instance{InstanceType: ec2types.InstanceType(tc.instanceType)})
+		if err != nil {
+			t.Fatalf("TestGetInstanceCapacity(%d): received unexpected error, err: %q", i, err)
+		}
+		if ipv4 != tc.ipv4 || ipv6 != tc.ipv6 {
+			t.Fatalf("TestGetInstanceCapacity(%d): expected capacities %d/%d, got %d/%d", i, tc.ipv4, tc.ipv6, ipv4, ipv6)
+		}
+		if describeInstanceTypes != tc.calls {
+			t.Fatalf("TestGetInstanceCapacity(%d): expected %d DescribeInstanceTypes calls, got %d", i, tc.calls, describeInstanceTypes)
+		}
+	}
+}
+
+func TestGetCapacity(t *testing.T) {
+	tcs := []struct {
+		instanceV4Capacity int
+		instanceV6Capacity int
+		networkInterface   *ec2types.InstanceNetworkInterface
+		capV4              int
+		capV6              int
+	}{
+		// The limits differ per IP family.
+		{
+			instanceV4Capacity: 10,
+			instanceV6Capacity: 30,
+			networkInterface: &ec2types.InstanceNetworkInterface{
+				PrivateIpAddresses: []ec2types.InstancePrivateIpAddress{{PrivateIpAddress: awsapi.String("10.0.0.5")}},
+				Ipv6Addresses:      []ec2types.InstanceIpv6Address{{Ipv6Address: awsapi.String("2600:1f14:e12:4600::5")}},
+			},
+			capV4: 9,
+			capV6: 29,
+		},
+		// Delegated prefixes take an address slot of their family.
+		{
+			instanceV4Capacity: 10,
+			instanceV6Capacity: 10,
+			networkInterface: &ec2types.InstanceNetworkInterface{
+				PrivateIpAddresses: []ec2types.InstancePrivateIpAddress{{PrivateIpAddress: awsapi.String("10.0.0.5")}},
+				Ipv4Prefixes:       []ec2types.InstanceIpv4Prefix{{Ipv4Prefix: awsapi.String("10.0.0.16/28")}, {Ipv4Prefix: awsapi.String("10.0.0.32/28")}},
+				Ipv6Prefixes:       []ec2types.InstanceIpv6Prefix{{Ipv6Prefix: awsapi.String("2600:1f14:e12:4600:1::/80")}},
+			},
+			capV4: 7,
+			capV6: 9,
+		},
+		// The usage exceeds lowered limits.
+		{
+			instanceV4Capacity: 1,
+			instanceV6Capacity: 0,
+			networkInterface: &ec2types.InstanceNetworkInterface{
+				PrivateIpAddresses: []ec2types.InstancePrivateIpAddress{{PrivateIpAddress: awsapi.String("10.0.0.5")}, {PrivateIpAddress: awsapi.String("10.0.0.6")}},
+				Ipv6Addresses:      []ec2types.InstanceIpv6Address{{Ipv6Address: awsapi.String("2600:1f14:e12:4600::5")}},
+			},
+			capV4: 0,
+			capV6: 0,
+		},
+	}
+	a := &AWS{}
+	for i, tc := range tcs {
+		capV4, capV6 := a.getCapacity(tc.instanceV4Capacity, tc.instanceV6Capacity, tc.networkInterface)
+		if capV4 != tc.capV4 || capV6 != tc.capV6 {
+			t.Fatalf("TestGetCapacity(%d): expected capacities %d/%d, got %d/%d", i, tc.capV4, tc.capV6, capV4, capV6)
+		}
+	}
+}
+
+func TestGetNetworkInterface(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("Action") != "DescribeNetworkInterfaces" || r.Form.Get("Filter.1.Name") != "attachment.instance-id" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// eni-2 is tagged egress=true, eni-3 egress=false.
+		tagged := ""
+		switch r.Form.Get("Filter.2.Name") + "=" + r.Form.Get("Filter.2.Value.1") {
+		case "tag-key=egress":
+			tagged = "<item><networkInterfaceId>eni-2</networkInterfaceId></item><item><networkInterfaceId>eni-3</networkInterfaceId></item>"
+		case "tag:egress=true":
+			tagged = "<item><networkInterfaceId>eni-2</networkInterfaceId></item>"
+		case "tag:egress=false":
+			tagged = "<item><networkInterfaceId>eni-3</networkInterfaceId></item>"
+		}
+		fmt.Fprintf(w, `<DescribeNetworkInterfacesResponse><networkInterfaceSet>%s</networkInterfaceSet></DescribeNetworkInterfacesResponse>`, tagged)
+	}))
+	defer server.Close()
+
+	client := newTestEC2Client(server.URL)
+	instance := &ec2types.Instance{
+		InstanceId: awsapi.String("i-0123456789abcdef0"),
+		NetworkInterfaces: []ec2types.InstanceNetworkInterface{
+			{NetworkInterfaceId: awsapi.String("eni-1"), SubnetId: awsapi.String("subnet-machine"), Groups: []ec2types.GroupIdentifier{{GroupId: awsapi.String("sg-machine")}}},
+			{NetworkInterfaceId: awsapi.String("eni-2"), SubnetId: awsapi.String("subnet-egress"), Groups: []ec2types.GroupIdentifier{{GroupId: awsapi.String("sg-machine")}, {GroupId: awsapi.String("sg-egress")}}},
+			{NetworkInterfaceId: awsapi.String("eni-3"), SubnetId: awsapi.String("subnet-storage")},
+		},
+	}
+
+	tcs := []struct {
+		selector   string
+		annotation *string
+		expected   string
+		err        bool
+	}{
+		{expected: "eni-1"},
+		{selector: "subnet=subnet-egress", expected: "eni-2"},
+		{selector: "security-group=sg-egress", expected: "eni-2"},
+		{selector: "tag=egress", expected: "eni-2"},
+		{selector: "tag=egress=false", expected: "eni-3"},
+		{selector: "subnet=subnet-unknown", err: true},
+		// The node's annotation overrides the global selector, even if empty.
+		{selector: "subnet=subnet-egress", annotation: awsapi.String("subnet=subnet-storage"), expected: "eni-3"},
+		{selector: "subnet=subnet-egress", annotation: awsapi.String(""), expected: "eni-1"},
+		{annotation: awsapi.String("device-index=1"), err: true},
+	}
+	for i, tc := range tcs {
+		selector, err := parseAWSNetworkInterfaceSelector(tc.selector)
+		if err != nil {
+			t.Fatalf("TestGetNetworkInterface(%d): received unexpected error, err: %q", i, err)
+		}
+		a := &AWS{CloudProvider: CloudProvider{ctx: context.Background()}, client: client, networkInterfaceSelector: selector}
+		node := &corev1.Node{}
+		node.Name = "worker-0"
+		if tc.annotation != nil {
+			node.Annotations = map[string]string{AWSNetworkInterfaceSelectorAnnotation: *tc.annotation}
+		}
+		networkInterface, err := a.getNetworkInterface(context.Background(), node, instance)
+		if tc.err {
+			if err == nil {
+				t.Fatalf("TestGetNetworkInterface(%d): expected an error, got %s", i, awsapi.ToString(networkInterface.NetworkInterfaceId))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestGetNetworkInterface(%d): received unexpected error, err: %q", i, err)
+		}
+		if id := awsapi.ToString(networkInterface.NetworkInterfaceId); id != tc.expected {
+			t.Fatalf("TestGetNetworkInterface(%d): expected network interface %s, got %s", i, tc.expected, id)
+		}
+	}
+}
+
+func TestGetNodeNetworkInterfaces(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("Action") != "DescribeInstances" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// eni-1 was hot-attached after eni-3, eni-2 is being detached.
+		fmt.Fprint(w, `<DescribeInstancesResponse><reservationSet><item><instancesSet><item>
+<instanceId>i-0123456789abcdef0</instanceId><networkInterfaceSet>
+<item><networkInterfaceId>eni-3</networkInterfaceId><attachment><status>attached</status></attachment></item>
+<item><networkInterfaceId>eni-2</networkInterfaceId><attachment><status>detaching</status></attachment></item>
+<item><networkInterfaceId>eni-1</networkInterfaceId><attachment><status>attaching</status></attachment></item>
+</networkInterfaceSet></item></instancesSet></item></reservationSet></DescribeInstancesResponse>`)
+	}))
+	defer server.Close()
+
+	client := newTestEC2Client(server.URL)
+	a := &AWS{CloudProvider: CloudProvider{ctx: context.Background()}, client: client}
+	node := &corev1.Node{Spec: corev1.NodeSpec{ProviderID: "aws:///us-west-2a/i-0123456789abcdef0"}}
+
+	networkInterfaceIDs, err := a.GetNodeNetworkInterfaces(context.Background(), node)
+	if err != nil {
+		t.Fatalf("TestGetNodeNetworkInterfaces: received unexpected error, err: %q", err)
+	}
+	if expected := []string{"eni-1", "eni-3"}; !reflect.DeepEqual(networkInterfaceIDs, expected) {
+		t.Fatalf("TestGetNodeNetworkInterfaces: expected network interfaces %v, got %v", expected, networkInterfaceIDs)
+	}
+}
@@ -0,0 +1,96 @@
+package cloudprovider
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/openshift/cloud-network-config-controller/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// awsMinRequestRate is the rate, in requests per second, the adaptive
+	// rate limiter never goes below, however often EC2 throttles.
+	awsMinRequestRate = 1
+	// awsThrottleBackoff is the factor the rate is multiplied by on every
+	// throttled request, and awsRecoveryStep the rate added back, in requests
+	// per second, on every successful one.
+	awsThrottleBackoff = 0.5
+	awsRecoveryStep    = 0.1
+)
+
+var awsThrottledRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Name:      "aws_throttled_requests_total",
+	Help:      "Number of EC2 API requests throttled by AWS, e.g. with RequestLimitExceeded.",
+}, []string{"operation"})
+
+func init() {
+	metrics.Registry.MustRegister(awsThrottledRequestsTotal)
+}
+
+// awsAdaptiveRateLimiter is a token bucket shared across all EC2 API calls,
+// retries included, whose rate adapts to the throttling observed: it's cut on
+// every throttled request and slowly recovers on successful ones, up to
+// maxRate. Under bulk changes, requests thus get spread out on our side rather
+// than piling up retries against EC2's request rate limit.
+type awsAdaptiveRateLimiter struct {
+	mu      sync.Mutex
+	limiter *rate.Limiter
+	maxRate float64
+}
+
+func newAWSAdaptiveRateLimiter(maxRate float64) *awsAdaptiveRateLimiter {
+	return &awsAdaptiveRateLimiter{
+		limiter: rate.NewLimiter(rate.Limit(maxRate), int(math.Max(1, math.Ceil(maxRate)))),
+		maxRate: maxRate,
+	}
+}
+
+// install makes the EC2 client wait for the rate limiter before sending every
+// request, retries included, and adapt it to the outcome.
+func (l *awsAdaptiveRateLimiter) install(stack *middleware.Stack) error {
+	return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("AWSAdaptiveRateLimiter", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		if err := l.limiter.Wait(ctx); err != nil {
+			return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+		}
+		out, metadata, err := next.HandleFinalize(ctx, in)
+		switch {
+		case err == nil:
+			l.succeeded()
+		case retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err).Bool():
+			awsThrottledRequestsTotal.WithLabelValues(awsmiddleware.GetOperationName(ctx)).Inc()
+			l.throttled()
+		}
+		return out, metadata, err
+	}), (&retry.Attempt{}).ID(), middleware.After)
+}
+
+// rate returns the current rate, in requests per second.
+func (l *awsAdaptiveRateLimiter) rate() float64 {
+	return float64(l.limiter.Limit())
+}
+
+func (l *awsAdaptiveRateLimiter) throttled() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	newRate := math.Max(awsMinRequestRate, l.rate()*awsThrottleBackoff)
+	if newRate < l.rate() {
+		klog.Warningf("EC2 API request throttled, lowering request rate to %.1f/s", newRate)
+		l.limiter.SetLimit(rate.Limit(newRate))
+	}
+}
+
+func (l *awsAdaptiveRateLimiter) succeeded() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate() < l.maxRate {
+		l.limiter.SetLimit(rate.Limit(math.Min(l.maxRate, l.rate()+awsRecoveryStep)))
+	}
+}
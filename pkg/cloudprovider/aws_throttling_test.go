@@ -0,0 +1,67 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAWSAdaptiveRateLimiter(t *testing.T) {
+	// Throttle the first request.
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `<Response><Errors><Error><Code>RequestLimitExceeded</Code><Message>Request limit exceeded.</Message></Error></Errors></Response>`)
+			return
+		}
+		fmt.Fprint(w, `<DescribeInstancesResponse><reservationSet></reservationSet></DescribeInstancesResponse>`)
+	}))
+	defer server.Close()
+	limiter := newAWSAdaptiveRateLimiter(10)
+	client := newTestEC2Client(server.URL, func(o *ec2.Options) {
+		o.Retryer = retry.NewStandard(func(o *retry.StandardOptions) {
+			o.MaxAttempts = 2
+			o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+		})
+		o.APIOptions = append(o.APIOptions, limiter.install)
+	})
+	throttled := testutil.ToFloat64(awsThrottledRequestsTotal.WithLabelValues("DescribeInstances"))
+
+	if _, err := client.DescribeInstances(context.TODO(), &ec2.DescribeInstancesInput{}); err != nil {
+		t.Fatalf("TestAWSAdaptiveRateLimiter: expected the throttled request to be retried, err: %v", err)
+	}
+	if requests != 2 {
+		t.Fatalf("TestAWSAdaptiveRateLimiter: expected 2 requests, got %d", requests)
+	}
+	if value := testutil.ToFloat64(awsThrottledRequestsTotal.WithLabelValues("DescribeInstances")) - throttled; value != 1 {
+		t.Fatalf("TestAWSAdaptiveRateLimiter: expected 1 throttled request to be counted, got %v", value)
+	}
+	// Halved on the throttled request, increased on the successful retry.
+	if expected := 10*awsThrottleBackoff + awsRecoveryStep; math.Abs(limiter.rate()-expected) > 1e-9 {
+		t.Fatalf("TestAWSAdaptiveRateLimiter: expected rate %v, got %v", expected, limiter.rate())
+	}
+
+	// The rate doesn't go below the minimum, nor recover beyond the maximum.
+	for i := 0; i < 10; i++ {
+		limiter.throttled()
+	}
+	if limiter.rate() != awsMinRequestRate {
+		t.Fatalf("TestAWSAdaptiveRateLimiter: expected minimum rate %v, got %v", awsMinRequestRate, limiter.rate())
+	}
+	for i := 0; i < 1000; i++ {
+		limiter.succeeded()
+	}
+	if limiter.rate() != 10 {
+		t.Fatalf("TestAWSAdaptiveRateLimiter: expected maximum rate 10, got %v", limiter.rate())
+	}
+}
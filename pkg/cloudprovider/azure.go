@@ -4,16 +4,21 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/http"
 	"strings"
 	"time"
 
-	compute "github.com/Azure/azure-sdk-for-go/profiles/2020-09-01/compute/mgmt/compute"
-	"github.com/Azure/azure-sdk-for-go/profiles/2020-09-01/network/mgmt/network"
-	"github.com/Azure/go-autorest/autorest"
-	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
 	azureapi "github.com/Azure/go-autorest/autorest/azure"
-	"github.com/Azure/go-autorest/autorest/azure/auth"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
 	utilnet "k8s.io/utils/net"
 )
 
@@ -25,6 +30,10 @@ const (
 	defaultAzurePrivateIPCapacity = 256
 	// defaultAzureOperationTimeout is the timeout for all Azure operations
 	defaultAzureOperationTimeout = 10 * time.Second
+	// Azure Stack Hub lags behind Azure: the ARM clients request the API
+	// versions of its 2020-09-01-hybrid profile there, rather than their own.
+	azureStackComputeAPIVersion = "2020-06-01"
+	azureStackNetworkAPIVersion = "2018-11-01"
 )
 
 // Azure implements the API wrapper for talking
@@ -32,167 +41,432 @@ const (
 type Azure struct {
 	CloudProvider
 	resourceGroup        string
-	env                  azure.Environment
-	vmClient             compute.VirtualMachinesClient
-	virtualNetworkClient network.VirtualNetworksClient
-	networkClient        network.InterfacesClient
+	env                  azureapi.Environment
+	vmClient             *armcompute.VirtualMachinesClient
+	vmssVMClient         *armcompute.VirtualMachineScaleSetVMsClient
+	virtualNetworkClient *armnetwork.VirtualNetworksClient
+	networkClient        *armnetwork.InterfacesClient
+	publicIPClient       *armnetwork.PublicIPAddressesClient
+	// transport sends the requests of the ARM clients and credentials, see
+	// newTransport.
+	transport policy.Transporter
+	// networkInterfaceSelector selects the network interface egress IPs are
+	// assigned to on nodes without selector annotation, the primary one if
+	// nil.
+	networkInterfaceSelector *azureNetworkInterfaceSelector
+	// resourceTags are the extra tags set on the resources the controller
+	// changes, parsed from AzureResourceTags.
+	resourceTags map[string]string
+	// updates collect concurrent changes to the same network interface, if
+	// AzureUpdateBatchWindow is set.
+	updates azureNetworkInterfaceUpdates
+	// calls are the AssignPrivateIPs and ReleasePrivateIPs calls in
+	// progress, whose changes are applied without waiting for the batch
+	// window.
+	calls batchCalls
+	// networkInterfaceLocks serializes the updates of each network interface,
+	// keyed by lower-cased ID. Those are read-modify-write cycles of the whole
+	// network interface, which take tens of seconds to complete, so concurrent
+	// updates of the same network interface would overwrite each other's IP
+	// configurations. Updates of different network interfaces, i.e. of
+	// different nodes, still run in parallel.
+	networkInterfaceLocks keyedMutex
+	// throttle is shared by all ARM clients, ARM throttling requests per
+	// subscription.
+	throttle azureThrottle
 }
 
 func (a *Azure) initCredentials() error {
-	clientID, err := a.readSecretData("azure_client_id")
+	subscriptionID, err := a.readSecretData("azure_subscription_id")
 	if err != nil {
 		return err
 	}
-	tenantID, err := a.readSecretData("azure_tenant_id")
+	a.resourceGroup, err = a.readSecretData("azure_resourcegroup")
 	if err != nil {
 		return err
 	}
-	clientSecret, err := a.readSecretData("azure_client_secret")
-	if err != nil {
+
+	if a.networkInterfaceSelector, err = parseAzureNetworkInterfaceSelector(a.cfg.AzureNetworkInterfaceSelector); err != nil {
 		return err
 	}
-	subscriptionID, err := a.readSecretData("azure_subscription_id")
+	if a.resourceTags, err = parseAzureResourceTags(a.cfg.AzureResourceTags); err != nil {
+		return err
+	}
+
+	a.env, err = a.getEnvironment()
 	if err != nil {
+		return fmt.Errorf("failed to initialize Azure environment: %w", err)
+	}
+
+	if a.transport, err = a.newTransport(); err != nil {
 		return err
 	}
-	a.resourceGroup, err = a.readSecretData("azure_resourcegroup")
+
+	credential, err := a.newCredential()
 	if err != nil {
 		return err
 	}
+	return a.initClients(subscriptionID, credential)
+}
 
-	// Pick the Azure "Environment", which is just a named set of API endpoints.
-	if a.cfg.APIOverride != "" {
-		a.env, err = azure.EnvironmentFromURL(a.cfg.APIOverride)
-	} else {
-		name := a.cfg.AzureEnvironment
-		if name == "" {
-			name = "AzurePublicCloud"
-		}
-		a.env, err = azure.EnvironmentFromName(name)
+// initClients initializes the ARM clients of the subscription, which
+// authenticate with credential.
+func (a *Azure) initClients(subscriptionID string, credential azcore.TokenCredential) error {
+	computeClients, err := armcompute.NewClientFactory(subscriptionID, credential, a.getClientOptions(azureStackComputeAPIVersion))
+	if err != nil {
+		return fmt.Errorf("failed to initialize Azure compute clients: %w", err)
 	}
+	networkClients, err := armnetwork.NewClientFactory(subscriptionID, credential, a.getClientOptions(azureStackNetworkAPIVersion))
 	if err != nil {
-		return fmt.Errorf("failed to initialize Azure environment: %w", err)
+		return fmt.Errorf("failed to initialize Azure network clients: %w", err)
 	}
+	a.vmClient = computeClients.NewVirtualMachinesClient()
+	a.vmssVMClient = computeClients.NewVirtualMachineScaleSetVMsClient()
+	a.networkClient = networkClients.NewInterfacesClient()
+	a.virtualNetworkClient = networkClients.NewVirtualNetworksClient()
+	a.publicIPClient = networkClients.NewPublicIPAddressesClient()
+	return nil
+}
 
-	authorizer, err := a.getAuthorizer(a.env, clientID, clientSecret, tenantID)
-	if err != nil {
-		return err
+// getClientOptions returns the options of the ARM clients, which request
+// apiVersion on Azure Stack Hub. All the clients share the throttling of ARM,
+// which throttles requests per subscription.
+func (a *Azure) getClientOptions(apiVersion string) *arm.ClientOptions {
+	options := &arm.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			Cloud:            getCloudConfiguration(a.env),
+			Retry:            policy.RetryOptions{StatusCodes: azureRetryStatusCodes},
+			Transport:        a.transport,
+			PerCallPolicies:  []policy.Policy{azureUserAgentPolicy{}},
+			PerRetryPolicies: []policy.Policy{&a.throttle},
+		},
+	}
+	if strings.EqualFold(a.cfg.AzureEnvironment, azureStackCloudName) {
+		options.APIVersion = apiVersion
 	}
+	return options
+}
 
-	a.vmClient = compute.NewVirtualMachinesClientWithBaseURI(a.env.ResourceManagerEndpoint, subscriptionID)
-	a.vmClient.Authorizer = authorizer
-	_ = a.vmClient.AddToUserAgent(UserAgent)
+// getCredentialOptions returns the options of the credentials, which request
+// their tokens from the identity provider of the environment.
+func (a *Azure) getCredentialOptions() azcore.ClientOptions {
+	return azcore.ClientOptions{
+		Cloud:     getCloudConfiguration(a.env),
+		Transport: a.transport,
+	}
+}
 
-	a.networkClient = network.NewInterfacesClientWithBaseURI(a.env.ResourceManagerEndpoint, subscriptionID)
-	a.networkClient.Authorizer = authorizer
-	_ = a.networkClient.AddToUserAgent(UserAgent)
+// azureUserAgentPolicy prefixes the User-Agent of the ARM requests with ours,
+// the SDK's application ID being limited to 24 characters.
+type azureUserAgentPolicy struct{}
 
-	a.virtualNetworkClient = network.NewVirtualNetworksClientWithBaseURI(a.env.ResourceManagerEndpoint, subscriptionID)
-	a.virtualNetworkClient.Authorizer = authorizer
-	_ = a.virtualNetworkClient.AddToUserAgent(UserAgent)
-	return nil
+// Do implements policy.Policy.
+func (azureUserAgentPolicy) Do(req *policy.Request) (*http.Response, error) {
+	req.Raw().Header.Set("User-Agent", strings.TrimSpace(UserAgent+" "+req.Raw().Header.Get("User-Agent")))
+	return req.Next()
 }
 
-func (a *Azure) AssignPrivateIP(ip net.IP, node *corev1.Node) error {
-	instance, err := a.getInstance(node)
+func (a *Azure) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	scaleSetInstance, err := parseAzureScaleSetInstance(node.Spec.ProviderID)
 	if err != nil {
 		return err
 	}
-	networkInterfaces, err := a.getNetworkInterfaces(instance)
+	if scaleSetInstance != nil {
+		return fmt.Errorf("node %s is an instance of scale set %s in Uniform orchestration mode, whose IP configurations can't have static private IP addresses", node.Name, scaleSetInstance.scaleSet)
+	}
+	networkProfile, zones, err := a.getNetworkProfile(ctx, node)
 	if err != nil {
 		return err
 	}
-	// Perform the operation against the first interface listed, which will be
-	// the primary interface (if it's defined as such) or the first one returned
-	// following the order Azure specifies.
-	networkInterface := networkInterfaces[0]
+	networkInterfaces, err := a.getNetworkInterfaces(ctx, networkProfile)
+	if err != nil {
+		return err
+	}
+	// Perform the operation against the selected interface, by default the
+	// first interface listed, which will be the primary interface (if it's
+	// defined as such) or the first one returned following the order Azure
+	// specifies.
+	networkInterface, err := a.selectNetworkInterface(node, networkInterfaces)
+	if err != nil {
+		return err
+	}
+	if getIPConfiguration(networkInterface, ip) != nil {
+		return AlreadyExistingIPError
+	}
 	// Assign the IP
-	ipConfigurations := *networkInterface.IPConfigurations
+	if networkInterface.Properties == nil || len(networkInterface.Properties.IPConfigurations) == 0 || networkInterface.Properties.IPConfigurations[0].Properties == nil {
+		return fmt.Errorf("network interface %s has no IP configuration", *networkInterface.Name)
+	}
+	primaryIPConfiguration := networkInterface.Properties.IPConfigurations[0].Properties
 	name := fmt.Sprintf("%s_%s", node.Name, ip.String())
-	ipc := ip.String()
-	untrue := false
-	newIPConfiguration := network.InterfaceIPConfiguration{
+	newIPConfiguration := armnetwork.InterfaceIPConfiguration{
 		Name: &name,
-		InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
-			PrivateIPAddress:                &ipc,
-			PrivateIPAllocationMethod:       network.Static,
-			Subnet:                          (*networkInterface.IPConfigurations)[0].Subnet,
-			Primary:                         &untrue,
-			LoadBalancerBackendAddressPools: (*networkInterface.IPConfigurations)[0].LoadBalancerBackendAddressPools,
+		Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{
+			PrivateIPAddress:                to.Ptr(ip.String()),
+			PrivateIPAllocationMethod:       to.Ptr(armnetwork.IPAllocationMethodStatic),
+			Subnet:                          primaryIPConfiguration.Subnet,
+			Primary:                         to.Ptr(false),
+			LoadBalancerBackendAddressPools: primaryIPConfiguration.LoadBalancerBackendAddressPools,
 		},
 	}
-	ipConfigurations = append(ipConfigurations, newIPConfiguration)
-	networkInterface.IPConfigurations = &ipConfigurations
-	// Send the request
-	result, err := a.createOrUpdate(networkInterface)
-	if err != nil {
+	var publicIP *armnetwork.PublicIPAddress
+	if a.usesPublicIPs() {
+		if publicIP, err = a.findPublicIP(ctx, ip, name); err != nil {
+			return err
+		}
+		if err := checkPublicIPZones(publicIP, node, zones); err != nil {
+			return err
+		}
+		newIPConfiguration.Properties.PublicIPAddress = &armnetwork.PublicIPAddress{ID: publicIP.ID}
+	}
+	if err := a.updateNetworkInterface(ctx, networkInterface, azureIPConfigurationChange{ip: ip, add: &newIPConfiguration, node: node.Name}); err != nil {
 		return err
 	}
-	return a.waitForCompletion(result)
+	if publicIP != nil {
+		a.tagPublicIP(ctx, publicIP, node.Name)
+	}
+	return nil
 }
 
 func (a *Azure) AllowsMovePrivateIP() bool {
 	return false
 }
 
-func (a *Azure) MovePrivateIP(ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+func (a *Azure) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+	return nil
+}
+
+// CleanupNode is a no-op, private IPs are deleted together with the instance.
+func (a *Azure) CleanupNode(ctx context.Context, node *corev1.Node) error {
 	return nil
 }
 
-func (a *Azure) ReleasePrivateIP(ip net.IP, node *corev1.Node) error {
-	instance, err := a.getInstance(node)
+// VerifyPrivateIP verifies that the IP configuration of ip is still on the
+// network interface of the node, wrapping a MissingIPError otherwise, e.g. if
+// it was deleted in the portal, and that a public IP is associated with it, if
+// public IPs are.
+func (a *Azure) VerifyPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	networkProfile, _, err := a.getNetworkProfile(ctx, node)
 	if err != nil {
 		return err
 	}
-	networkInterfaces, err := a.getNetworkInterfaces(instance)
+	networkInterfaces, err := a.getNetworkInterfaces(ctx, networkProfile)
 	if err != nil {
 		return err
 	}
-	// Perform the operation against the first interface listed, which will be
-	// the primary interface (if it's defined as such) or the first one returned
-	// following the order Azure specifies.
-	networkInterface := networkInterfaces[0]
-	// Release the IP
-	keepIPConfiguration := []network.InterfaceIPConfiguration{}
-	ipAssigned := false
-	for _, ipConfiguration := range *networkInterface.IPConfigurations {
-		if assignedIP := net.ParseIP(*ipConfiguration.PrivateIPAddress); assignedIP != nil && !assignedIP.Equal(ip) {
-			keepIPConfiguration = append(keepIPConfiguration, ipConfiguration)
-		} else if assignedIP != nil && assignedIP.Equal(ip) {
-			ipAssigned = true
+	networkInterface, err := a.selectNetworkInterface(node, networkInterfaces)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimPrefix(getNameFromResourceID(*networkInterface.ID), "/")
+	ipConfiguration := getIPConfiguration(networkInterface, ip)
+	if ipConfiguration == nil {
+		return fmt.Errorf("%w: IP address %s is not assigned to network interface %s", MissingIPError, ip, name)
+	}
+	if a.usesPublicIPs() && (ipConfiguration.Properties.PublicIPAddress == nil || ipConfiguration.Properties.PublicIPAddress.ID == nil) {
+		return fmt.Errorf("no public IP is associated with IP address %s of network interface %s", ip, name)
+	}
+	return nil
+}
+
+// GetPrivateIPReservations returns nil, the IP address is held by the
+// instance's interface itself.
+func (a *Azure) GetPrivateIPReservations(ctx context.Context, ip net.IP, node *corev1.Node) ([]PrivateIPReservation, error) {
+	return nil, nil
+}
+
+// GetNodeNetworkInterfaces returns nil, network interfaces can only be
+// attached to and detached from stopped instances.
+func (a *Azure) GetNodeNetworkInterfaces(ctx context.Context, node *corev1.Node) ([]string, error) {
+	return nil, nil
+}
+
+// ListPrivateIPs returns the private IP addresses of the secondary IP
+// configurations of the node's network interface.
+func (a *Azure) ListPrivateIPs(ctx context.Context, node *corev1.Node) ([]net.IP, error) {
+	networkProfile, _, err := a.getNetworkProfile(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	networkInterfaces, err := a.getNetworkInterfaces(ctx, networkProfile)
+	if err != nil {
+		return nil, err
+	}
+	networkInterface, err := a.selectNetworkInterface(node, networkInterfaces)
+	if err != nil {
+		return nil, err
+	}
+	ips := []net.IP{}
+	if networkInterface.Properties == nil {
+		return ips, nil
+	}
+	for _, ipConfiguration := range networkInterface.Properties.IPConfigurations {
+		if ipConfiguration == nil || ipConfiguration.Properties == nil || ipConfiguration.Properties.PrivateIPAddress == nil {
+			continue
+		}
+		if ipConfiguration.Properties.Primary != nil && *ipConfiguration.Properties.Primary {
+			continue
 		}
+		ips = append(ips, ParseIP(*ipConfiguration.Properties.PrivateIPAddress))
 	}
+	return ips, nil
+}
+
+// CheckHealth retrieves the node's VM, or scale set instance.
+func (a *Azure) CheckHealth(ctx context.Context, node *corev1.Node) error {
+	_, _, err := a.getNetworkProfile(ctx, node)
+	return err
+}
+
+// ListOwnedResources returns the IP configurations the controller added to the
+// selected network interface of each node, named <node>_<IP address>. Nodes
+// whose network interface can't be retrieved are skipped.
+func (a *Azure) ListOwnedResources(ctx context.Context, nodes []*corev1.Node) ([]OwnedResource, error) {
+	resources := []OwnedResource{}
+	for _, node := range nodes {
+		networkInterface, err := a.getSelectedNetworkInterface(ctx, node)
+		if err != nil {
+			klog.Warningf("Could not list the IP configurations of node %s, err: %v", node.Name, err)
+			continue
+		}
+		if networkInterface.Properties == nil {
+			continue
+		}
+		for _, ipConfiguration := range networkInterface.Properties.IPConfigurations {
+			if ipConfiguration == nil || ipConfiguration.Name == nil || ipConfiguration.Properties == nil || ipConfiguration.Properties.PrivateIPAddress == nil {
+				continue
+			}
+			ip := ParseIP(*ipConfiguration.Properties.PrivateIPAddress)
+			if ip == nil || *ipConfiguration.Name != fmt.Sprintf("%s_%s", node.Name, ip.String()) {
+				continue
+			}
+			resources = append(resources, OwnedResource{
+				ID:   fmt.Sprintf("%s/ipConfigurations/%s", *networkInterface.ID, *ipConfiguration.Name),
+				Kind: "IP configuration",
+				IP:   ip,
+				Node: node.Name,
+				node: node,
+			})
+		}
+	}
+	return resources, nil
+}
+
+// getSelectedNetworkInterface returns the network interface of the node the
+// IP addresses are assigned to.
+func (a *Azure) getSelectedNetworkInterface(ctx context.Context, node *corev1.Node) (armnetwork.Interface, error) {
+	networkProfile, _, err := a.getNetworkProfile(ctx, node)
+	if err != nil {
+		return armnetwork.Interface{}, err
+	}
+	networkInterfaces, err := a.getNetworkInterfaces(ctx, networkProfile)
+	if err != nil {
+		return armnetwork.Interface{}, err
+	}
+	return a.selectNetworkInterface(node, networkInterfaces)
+}
+
+// DeleteOwnedResource releases the IP address of the IP configuration from
+// its node.
+func (a *Azure) DeleteOwnedResource(ctx context.Context, resource OwnedResource) error {
+	if resource.node == nil {
+		return fmt.Errorf("cannot delete IP configuration %s, it belongs to no node", resource.ID)
+	}
+	return a.ReleasePrivateIP(ctx, resource.IP, resource.node)
+}
+
+func (a *Azure) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	networkProfile, _, err := a.getNetworkProfile(ctx, node)
+	if err != nil {
+		return err
+	}
+	networkInterfaces, err := a.getNetworkInterfaces(ctx, networkProfile)
+	if err != nil {
+		return err
+	}
+	// Perform the operation against the selected interface, by default the
+	// first interface listed, which will be the primary interface (if it's
+	// defined as such) or the first one returned following the order Azure
+	// specifies.
+	networkInterface, err := a.selectNetworkInterface(node, networkInterfaces)
+	if err != nil {
+		return err
+	}
+	// Release the IP
+	ipConfiguration := getIPConfiguration(networkInterface, ip)
 	// Short-circuit if the IP never existed to begin with
-	if !ipAssigned {
+	if ipConfiguration == nil {
 		return NonExistingIPError
 	}
-	networkInterface.IPConfigurations = &keepIPConfiguration
-	// Send the request
-	result, err := a.createOrUpdate(networkInterface)
+	if scaleSetInstance, _ := parseAzureScaleSetInstance(node.Spec.ProviderID); scaleSetInstance != nil {
+		err = a.releaseScaleSetPrivateIP(ctx, scaleSetInstance, networkInterface, ipConfiguration)
+	} else {
+		err = a.updateNetworkInterface(ctx, networkInterface, azureIPConfigurationChange{ip: ip})
+	}
 	if err != nil {
 		return err
 	}
-	return a.waitForCompletion(result)
+	if ipConfiguration.Properties != nil && ipConfiguration.Properties.PublicIPAddress != nil && ipConfiguration.Properties.PublicIPAddress.ID != nil {
+		a.untagPublicIP(ctx, *ipConfiguration.Properties.PublicIPAddress.ID)
+	}
+	return nil
+}
+
+// AssignPrivateIPs assigns the IP addresses concurrently if updates are
+// batched, for their IP configurations to be added in a single update of the
+// network interface, and in turn otherwise.
+func (a *Azure) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	if a.cfg.AzureUpdateBatchWindow > 0 {
+		return a.calls.apply(ctx, ips, node, a.AssignPrivateIP)
+	}
+	return eachPrivateIP(ctx, ips, node, a.AssignPrivateIP)
+}
+
+// ReleasePrivateIPs releases the IP addresses concurrently if updates are
+// batched, for their IP configurations to be removed in a single update, and
+// in turn otherwise.
+func (a *Azure) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	if a.cfg.AzureUpdateBatchWindow > 0 {
+		return a.calls.apply(ctx, ips, node, a.ReleasePrivateIP)
+	}
+	return eachPrivateIP(ctx, ips, node, a.ReleasePrivateIP)
+}
+
+// BatchesAssignPrivateIPs returns true if updates are batched.
+func (a *Azure) BatchesAssignPrivateIPs() bool {
+	return a.cfg.AzureUpdateBatchWindow > 0
+}
+
+// BatchesReleasePrivateIPs returns true if updates are batched.
+func (a *Azure) BatchesReleasePrivateIPs() bool {
+	return a.cfg.AzureUpdateBatchWindow > 0
 }
 
-func (a *Azure) GetNodeEgressIPConfiguration(node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
-	instance, err := a.getInstance(node)
+func (a *Azure) GetNodeEgressIPConfiguration(ctx context.Context, node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
+	networkProfile, _, err := a.getNetworkProfile(ctx, node)
 	if err != nil {
 		return nil, err
 	}
-	networkInterfaces, err := a.getNetworkInterfaces(instance)
+	networkInterfaces, err := a.getNetworkInterfaces(ctx, networkProfile)
+	if err != nil {
+		return nil, err
+	}
+	// Perform the operation against the selected interface, by default the
+	// first interface listed, which will be the primary interface (if it's
+	// defined as such) or the first one returned following the order Azure
+	// specifies.
+	networkInterface, err := a.selectNetworkInterface(node, networkInterfaces)
 	if err != nil {
 		return nil, err
 	}
-	// Perform the operation against the first interface listed, which will be
-	// the primary interface (if it's defined as such) or the first one returned
-	// following the order Azure specifies.
-	networkInterface := networkInterfaces[0]
 	// Prepare the config
 	config := &NodeEgressIPConfiguration{
 		Interface: strings.TrimPrefix(getNameFromResourceID(*networkInterface.ID), "/"),
 	}
-	v4Subnet, v6Subnet, err := a.getSubnet(networkInterface)
+	if networkInterface.Properties != nil && networkInterface.Properties.MacAddress != nil {
+		config.MAC = normalizeMAC(*networkInterface.Properties.MacAddress)
+	}
+	v4Subnet, v6Subnet, err := a.getSubnet(ctx, networkInterface)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving the network interface subnets, err: %v", err)
 	}
@@ -206,24 +480,30 @@ func (a *Azure) GetNodeEgressIPConfiguration(node *corev1.Node) ([]*NodeEgressIP
 	config.Capacity = capacity{
 		IP: a.getCapacity(networkInterface),
 	}
+	// Egress IPs can't be assigned to the instances of scale sets in Uniform
+	// orchestration mode, see AssignPrivateIP.
+	if scaleSetInstance, _ := parseAzureScaleSetInstance(node.Spec.ProviderID); scaleSetInstance != nil {
+		config.Capacity.IP = 0
+	}
 	return []*NodeEgressIPConfiguration{config}, nil
 }
 
-func (a *Azure) createOrUpdate(networkInterface network.Interface) (network.InterfacesCreateOrUpdateFuture, error) {
-	ctx, cancel := context.WithTimeout(a.ctx, defaultAzureOperationTimeout)
+func (a *Azure) createOrUpdate(ctx context.Context, networkInterface armnetwork.Interface) (*runtime.Poller[armnetwork.InterfacesClientCreateOrUpdateResponse], error) {
+	callCtx, cancel := context.WithTimeout(ctx, defaultAzureOperationTimeout)
 	defer cancel()
-	return a.networkClient.CreateOrUpdate(ctx, a.resourceGroup, *networkInterface.Name, networkInterface)
+	return a.networkClient.BeginCreateOrUpdate(callCtx, a.resourceGroup, *networkInterface.Name, networkInterface, nil)
 }
 
-func (a *Azure) waitForCompletion(result network.InterfacesCreateOrUpdateFuture) error {
+func (a *Azure) waitForCompletion(ctx context.Context, poller *runtime.Poller[armnetwork.InterfacesClientCreateOrUpdateResponse]) error {
 	// No specified timeout for this operation, because a valid value doesn't
-	// seem possible to estimate. Note: Azure has some defaults defined here:
-	// https://github.com/Azure/go-autorest/blob/master/autorest/client.go#L32-L44
-	return result.WaitForCompletionRef(context.TODO(), a.networkClient.Client)
+	// seem possible to estimate: the operation is only canceled when the
+	// controller stops.
+	_, err := poller.PollUntilDone(ctx, nil)
+	return err
 }
 
-func (a *Azure) getSubnet(networkInterface network.Interface) (*net.IPNet, *net.IPNet, error) {
-	addressPrefixes, err := a.getAddressPrefixes(networkInterface)
+func (a *Azure) getSubnet(ctx context.Context, networkInterface armnetwork.Interface) (*net.IPNet, *net.IPNet, error) {
+	addressPrefixes, err := a.getAddressPrefixes(ctx, networkInterface)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error retrieving associated address prefix for network interface, err: %v", err)
 	}
@@ -248,55 +528,94 @@ func (a *Azure) getSubnet(networkInterface network.Interface) (*net.IPNet, *net.
 
 // We need to retrieve the amounts assigned to the node by default and subtract
 // that from the default 256 value. Note: there is also a "Private IP addresses
-// per virtual network" quota, but that's 65.536, so we can skip that.
-func (a *Azure) getCapacity(networkInterface network.Interface) int {
-	currentIPv4Usage, currentIPv6Usage := 0, 0
-	for _, ipConfiguration := range *networkInterface.IPConfigurations {
-		if assignedIP := net.ParseIP(*ipConfiguration.PrivateIPAddress); assignedIP != nil {
-			if utilnet.IsIPv4(assignedIP) {
-				currentIPv4Usage++
-			} else {
-				currentIPv6Usage++
-			}
-		}
-	}
-	return defaultAzurePrivateIPCapacity - currentIPv4Usage - currentIPv6Usage
+// per virtual network" quota, but that's 65.536, so we can skip that. The limit
+// per network interface doesn't depend on the VM size: the Resource SKUs API
+// only exposes the number of network interfaces per VM size, not of IP
+// configurations per network interface, hence no lookup. Every IP
+// configuration takes one of the 256, whatever its IP family, including those
+// whose dynamic address isn't allocated yet.
+func (a *Azure) getCapacity(networkInterface armnetwork.Interface) int {
+	usage := 0
+	if networkInterface.Properties != nil {
+		usage = len(networkInterface.Properties.IPConfigurations)
+	}
+	if usage > defaultAzurePrivateIPCapacity {
+		return 0
+	}
+	return defaultAzurePrivateIPCapacity - usage
 }
 
 // This is what the node's providerID looks like on Azure
 // spec:
 //   providerID: azure:///subscriptions/ee2e2172-e246-4d4b-a72a-f62fbf924238/resourceGroups/ovn-qgwkn-rg/providers/Microsoft.Compute/virtualMachines/ovn-qgwkn-worker-canadacentral1-bskbf
 // getInstance also validates that the instance has a (or several) NICs
-func (a *Azure) getInstance(node *corev1.Node) (*compute.VirtualMachine, error) {
+func (a *Azure) getInstance(ctx context.Context, node *corev1.Node) (*armcompute.VirtualMachine, error) {
 	providerData := strings.Split(node.Spec.ProviderID, "/")
 	if len(providerData) != 11 {
 		return nil, UnexpectedURIError(node.Spec.ProviderID)
 	}
-	ctx, cancel := context.WithTimeout(a.ctx, defaultAzureOperationTimeout)
+	callCtx, cancel := context.WithTimeout(ctx, defaultAzureOperationTimeout)
 	defer cancel()
-	instance, err := a.vmClient.Get(ctx, a.resourceGroup, providerData[len(providerData)-1], "")
+	result, err := a.vmClient.Get(callCtx, a.resourceGroup, providerData[len(providerData)-1], nil)
 	if err != nil {
 		return nil, err
 	}
-	return &instance, nil
+	return &result.VirtualMachine, nil
+}
+
+// getNetworkProfile returns the network profile and the availability zones of
+// the node's VM, or scale set instance. The zones are empty for regional VMs.
+func (a *Azure) getNetworkProfile(ctx context.Context, node *corev1.Node) (*armcompute.NetworkProfile, []string, error) {
+	scaleSetInstance, err := parseAzureScaleSetInstance(node.Spec.ProviderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if scaleSetInstance != nil {
+		instance, err := a.getScaleSetInstance(ctx, scaleSetInstance)
+		if err != nil {
+			return nil, nil, err
+		}
+		if instance.Properties == nil {
+			return nil, nil, NoNetworkInterfaceError
+		}
+		return instance.Properties.NetworkProfile, getAzureZones(instance.Zones), nil
+	}
+	instance, err := a.getInstance(ctx, node)
+	if err != nil {
+		return nil, nil, err
+	}
+	if instance.Properties == nil {
+		return nil, nil, NoNetworkInterfaceError
+	}
+	return instance.Properties.NetworkProfile, getAzureZones(instance.Zones), nil
 }
 
-// getNetworkInterfaces returns a slice of network.Interface with the
+func getAzureZones(zones []*string) []string {
+	var values []string
+	for _, zone := range zones {
+		if zone != nil {
+			values = append(values, *zone)
+		}
+	}
+	return values
+}
+
+// getNetworkInterfaces returns a slice of armnetwork.Interface with the
 // primary one first, if it exists, else in the order assigned by Azure.
-func (a *Azure) getNetworkInterfaces(instance *compute.VirtualMachine) ([]network.Interface, error) {
-	if instance.NetworkProfile == nil {
+func (a *Azure) getNetworkInterfaces(ctx context.Context, networkProfile *armcompute.NetworkProfile) ([]armnetwork.Interface, error) {
+	if networkProfile == nil {
 		return nil, NoNetworkInterfaceError
 	}
-	if instance.NetworkProfile.NetworkInterfaces == nil || len(*instance.NetworkProfile.NetworkInterfaces) == 0 {
+	if len(networkProfile.NetworkInterfaces) == 0 {
 		return nil, NoNetworkInterfaceError
 	}
-	networkInterfaces := []network.Interface{}
+	networkInterfaces := []armnetwork.Interface{}
 	// Try to get the ID corresponding to the "primary" NIC and put that first
 	// in the slice. Do it like this because it's assumed to not be guaranteed
 	// to be first in the slice returned by the Azure API?
-	for _, netif := range *instance.NetworkProfile.NetworkInterfaces {
-		if netif.NetworkInterfaceReferenceProperties != nil && netif.Primary != nil && *netif.Primary {
-			intf, err := a.getNetworkInterface(*netif.ID)
+	for _, netif := range networkProfile.NetworkInterfaces {
+		if netif.Properties != nil && netif.Properties.Primary != nil && *netif.Properties.Primary {
+			intf, err := a.getNetworkInterface(ctx, *netif.ID)
 			if err != nil {
 				return nil, err
 			}
@@ -305,9 +624,9 @@ func (a *Azure) getNetworkInterfaces(instance *compute.VirtualMachine) ([]networ
 		}
 	}
 	// Get the rest and append that.
-	for _, netif := range *instance.NetworkProfile.NetworkInterfaces {
-		if netif.NetworkInterfaceReferenceProperties != nil && ((netif.Primary != nil && !*netif.Primary) || netif.Primary == nil) {
-			intf, err := a.getNetworkInterface(*netif.ID)
+	for _, netif := range networkProfile.NetworkInterfaces {
+		if netif.Properties != nil && ((netif.Properties.Primary != nil && !*netif.Properties.Primary) || netif.Properties.Primary == nil) {
+			intf, err := a.getNetworkInterface(ctx, *netif.ID)
 			if err != nil {
 				return nil, err
 			}
@@ -317,23 +636,38 @@ func (a *Azure) getNetworkInterfaces(instance *compute.VirtualMachine) ([]networ
 	if len(networkInterfaces) == 0 {
 		// Due to security restrictions access, the NIC's "primary" field is not enumerable.
 		// If we have NICs, then select the first in the list.
-		if len(*instance.NetworkProfile.NetworkInterfaces) > 0 {
-			intf, err := a.getNetworkInterface(*(*instance.NetworkProfile.NetworkInterfaces)[0].ID)
-			if err != nil {
-				return nil, err
-			}
-			networkInterfaces = append(networkInterfaces, intf)
-			return networkInterfaces, nil
+		intf, err := a.getNetworkInterface(ctx, *networkProfile.NetworkInterfaces[0].ID)
+		if err != nil {
+			return nil, err
 		}
-		return nil, NoNetworkInterfaceError
+		networkInterfaces = append(networkInterfaces, intf)
 	}
 	return networkInterfaces, nil
 }
 
-func (a *Azure) getNetworkInterface(id string) (network.Interface, error) {
-	ctx, cancel := context.WithTimeout(a.ctx, defaultAzureOperationTimeout)
+func (a *Azure) getNetworkInterface(ctx context.Context, id string) (armnetwork.Interface, error) {
+	callCtx, cancel := context.WithTimeout(ctx, defaultAzureOperationTimeout)
 	defer cancel()
-	return a.networkClient.Get(ctx, a.resourceGroup, getNameFromResourceID(id), "")
+	if scaleSet, instanceID, name, ok := parseAzureScaleSetNetworkInterfaceID(id); ok {
+		result, err := a.networkClient.GetVirtualMachineScaleSetNetworkInterface(callCtx, a.resourceGroup, scaleSet, instanceID, name, nil)
+		return result.Interface, err
+	}
+	result, err := a.networkClient.Get(callCtx, a.resourceGroup, strings.TrimPrefix(getNameFromResourceID(id), "/"), nil)
+	return result.Interface, err
+}
+
+// getIPConfiguration returns the IP configuration of ip on the network
+// interface, or nil if ip isn't assigned to it.
+func getIPConfiguration(networkInterface armnetwork.Interface, ip net.IP) *armnetwork.InterfaceIPConfiguration {
+	if networkInterface.Properties == nil {
+		return nil
+	}
+	for _, ipConfiguration := range networkInterface.Properties.IPConfigurations {
+		if ipConfiguration != nil && ipConfiguration.Properties != nil && ipConfiguration.Properties.PrivateIPAddress != nil && ip.Equal(ParseIP(*ipConfiguration.Properties.PrivateIPAddress)) {
+			return ipConfiguration
+		}
+	}
+	return nil
 }
 
 // This is what the subnet ID looks like on Azure:
@@ -346,62 +680,93 @@ func (a *Azure) getNetworkResourceGroupAndSubnetAndNetnames(subnetID string) (st
 	return providerData[4], providerData[len(providerData)-3], providerData[len(providerData)-1], nil
 }
 
-func (a *Azure) getAddressPrefixes(networkInterface network.Interface) ([]string, error) {
+func (a *Azure) getAddressPrefixes(ctx context.Context, networkInterface armnetwork.Interface) ([]string, error) {
 	var virtualNetworkResourceGroup string
 	var virtualNetworkName string
 	var subnetName string
 	var err error
-	for _, ipConfiguration := range *networkInterface.IPConfigurations {
-		if *ipConfiguration.Primary {
+	if networkInterface.Properties == nil {
+		return nil, fmt.Errorf("network interface %s has no IP configuration", *networkInterface.Name)
+	}
+	for _, ipConfiguration := range networkInterface.Properties.IPConfigurations {
+		if ipConfiguration.Properties != nil && ipConfiguration.Properties.Primary != nil && *ipConfiguration.Properties.Primary {
 			virtualNetworkResourceGroup, virtualNetworkName, subnetName, err =
-				a.getNetworkResourceGroupAndSubnetAndNetnames(*ipConfiguration.Subnet.ID)
+				a.getNetworkResourceGroupAndSubnetAndNetnames(*ipConfiguration.Properties.Subnet.ID)
 			if err != nil {
 				return nil, err
 			}
 			break
 		}
 	}
-	ctx, cancel := context.WithTimeout(a.ctx, defaultAzureOperationTimeout)
+	callCtx, cancel := context.WithTimeout(ctx, defaultAzureOperationTimeout)
 	defer cancel()
-	virtualNetwork, err := a.virtualNetworkClient.Get(ctx, virtualNetworkResourceGroup, virtualNetworkName, "")
+	result, err := a.virtualNetworkClient.Get(callCtx, virtualNetworkResourceGroup, virtualNetworkName, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving subnet IP configuration, err: %v", err)
 	}
+	if result.Properties == nil {
+		return nil, fmt.Errorf("nil subnet address space")
+	}
+	virtualNetwork := result.Properties
 	// Check the list of subnets first. If a subnet with the subnet name is found, then use that
 	// instead of virtualNetwork.AddressSpace.AddressPrefixes which only contains the main subnet's
 	// address prefix.
 	// FIXME: This might not work for IPv6.
-	if virtualNetwork.Subnets != nil {
-		for _, vns := range *virtualNetwork.Subnets {
-			if vns.Name != nil && vns.AddressPrefix != nil &&
-				*vns.Name == subnetName {
-				return []string{*vns.AddressPrefix}, nil
-			}
+	for _, vns := range virtualNetwork.Subnets {
+		if vns.Name != nil && vns.Properties != nil && vns.Properties.AddressPrefix != nil &&
+			*vns.Name == subnetName {
+			return []string{*vns.Properties.AddressPrefix}, nil
 		}
 	}
 
 	if virtualNetwork.AddressSpace == nil {
 		return nil, fmt.Errorf("nil subnet address space")
 	}
-	if virtualNetwork.AddressSpace.AddressPrefixes == nil || len(*virtualNetwork.AddressSpace.AddressPrefixes) == 0 {
+	addressPrefixes := []string{}
+	for _, addressPrefix := range virtualNetwork.AddressSpace.AddressPrefixes {
+		if addressPrefix != nil {
+			addressPrefixes = append(addressPrefixes, *addressPrefix)
+		}
+	}
+	if len(addressPrefixes) == 0 {
 		return nil, fmt.Errorf("no subnet address prefixes defined")
 	}
-	return *virtualNetwork.AddressSpace.AddressPrefixes, nil
+	return addressPrefixes, nil
 }
 
-func (a *Azure) getAuthorizer(env azureapi.Environment, clientID, clientSecret, tenantID string) (autorest.Authorizer, error) {
-	c := &auth.ClientCredentialsConfig{
-		TenantID:     tenantID,
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		AADEndpoint:  env.ActiveDirectoryEndpoint,
+// newCredential returns the credential of the ARM clients: the user-assigned
+// managed identity's if one is configured, the secret's application's
+// otherwise. The application authenticates with a federated token if there's
+// one (workload identity), with its client secret otherwise.
+func (a *Azure) newCredential() (azcore.TokenCredential, error) {
+	if a.cfg.AzureManagedIdentityClientID != "" {
+		if a.cfg.AzureFederatedTokenFile != "" {
+			return nil, fmt.Errorf("a managed identity and a federated token file can't be both used to authenticate")
+		}
+		return a.getManagedIdentityCredential(a.cfg.AzureManagedIdentityClientID)
 	}
-	c.Resource = env.TokenAudience
-	authorizer, err := c.Authorizer()
+	clientID, err := a.readSecretData("azure_client_id")
+	if err != nil {
+		return nil, err
+	}
+	tenantID, err := a.readSecretData("azure_tenant_id")
+	if err != nil {
+		return nil, err
+	}
+	tenantID = getTenantID(a.env, tenantID)
+	// With workload identity, no client secret is mounted: the projected
+	// service account token is exchanged for ARM credentials instead.
+	if federatedTokenFile := a.getFederatedTokenFile(); federatedTokenFile != "" {
+		return a.getFederatedCredential(clientID, tenantID, federatedTokenFile)
+	}
+	clientSecret, err := a.readSecretData("azure_client_secret")
 	if err != nil {
 		return nil, err
 	}
-	return authorizer, nil
+	return azidentity.NewClientSecretCredential(tenantID, clientID, clientSecret, &azidentity.ClientSecretCredentialOptions{
+		ClientOptions:            a.getCredentialOptions(),
+		DisableInstanceDiscovery: usesADFS(a.env),
+	})
 }
 
 func getNameFromResourceID(id string) string {
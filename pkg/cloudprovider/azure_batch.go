@@ -0,0 +1,151 @@
+package cloudprovider
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
+	"k8s.io/klog/v2"
+)
+
+// azureIPConfigurationChange is an IP configuration to add to a network
+// interface, or the IP address whose IP configuration to remove from it if
+// add is nil. node is the node the IP configuration is added for, the network
+// interface is tagged with, if resources are tagged.
+type azureIPConfigurationChange struct {
+	ip   net.IP
+	add  *armnetwork.InterfaceIPConfiguration
+	node string
+}
+
+// azureNetworkInterfaceUpdate collects the concurrent changes to the same
+// network interface, to apply them in a single update.
+type azureNetworkInterfaceUpdate struct {
+	changes []azureIPConfigurationChange
+	// errs holds the result of each change, by index, once done is closed.
+	errs []error
+	done chan struct{}
+}
+
+// azureNetworkInterfaceUpdates are the updates collecting changes, keyed by
+// network interface ID.
+type azureNetworkInterfaceUpdates struct {
+	sync.Mutex
+	pending map[string]*azureNetworkInterfaceUpdate
+}
+
+// updateNetworkInterface applies the change to the network interface. If
+// batching is enabled, the first change to the network interface waits for
+// the batch window, or for the other IP addresses of its AssignPrivateIPs or
+// ReleasePrivateIPs call, and all changes to the same network interface queued
+// meanwhile are applied along in the same update, each update of a network
+// interface being a full PUT serialized behind the previous ones by ARM.
+// Either way, the change is applied to the network interface as it is once its
+// previous updates completed, see networkInterfaceLocks. A batch is applied
+// on the context of its first change, whose trace the update is part of.
+func (a *Azure) updateNetworkInterface(ctx context.Context, networkInterface armnetwork.Interface, change azureIPConfigurationChange) error {
+	if a.cfg.AzureUpdateBatchWindow <= 0 {
+		return a.sendNetworkInterfaceUpdateBatch(ctx, *networkInterface.ID, []azureIPConfigurationChange{change})[0]
+	}
+	key := *networkInterface.ID
+
+	a.updates.Lock()
+	if a.updates.pending == nil {
+		a.updates.pending = map[string]*azureNetworkInterfaceUpdate{}
+	}
+	update, ok := a.updates.pending[key]
+	if !ok {
+		update = &azureNetworkInterfaceUpdate{done: make(chan struct{})}
+		a.updates.pending[key] = update
+	}
+	index := len(update.changes)
+	update.changes = append(update.changes, change)
+	a.updates.Unlock()
+
+	if ok {
+		a.calls.join(change.ip)
+		<-update.done
+		return update.errs[index]
+	}
+
+	a.calls.wait(change.ip, a.cfg.AzureUpdateBatchWindow)
+	a.updates.Lock()
+	delete(a.updates.pending, key)
+	a.updates.Unlock()
+	update.errs = a.sendNetworkInterfaceUpdateBatch(ctx, key, update.changes)
+	close(update.done)
+	return update.errs[index]
+}
+
+// sendNetworkInterfaceUpdateBatch applies the changes in a single update, to
+// the network interface as it is after the batch window. The update succeeds
+// or fails as a whole: if it fails, each change is applied on its own, so that
+// a change which can't be applied doesn't fail the others.
+func (a *Azure) sendNetworkInterfaceUpdateBatch(ctx context.Context, id string, changes []azureIPConfigurationChange) []error {
+	// Updates of the network interface must be ordered, see
+	// networkInterfaceLocks.
+	defer a.networkInterfaceLocks.Lock(strings.ToLower(id))()
+	errs := make([]error, len(changes))
+	name := strings.TrimPrefix(getNameFromResourceID(id), "/")
+	if len(changes) > 1 {
+		klog.Infof("Applying %d IP configuration changes to network interface %s in a single update", len(changes), name)
+	}
+	err := a.getAndUpdateNetworkInterface(ctx, id, changes)
+	if err == nil || len(changes) == 1 {
+		for i := range changes {
+			errs[i] = err
+		}
+		return errs
+	}
+	klog.Warningf("Could not apply %d IP configuration changes to network interface %s in a single update, applying them one by one, err: %v", len(changes), name, err)
+	for i, change := range changes {
+		errs[i] = a.getAndUpdateNetworkInterface(ctx, id, []azureIPConfigurationChange{change})
+	}
+	return errs
+}
+
+func (a *Azure) getAndUpdateNetworkInterface(ctx context.Context, id string, changes []azureIPConfigurationChange) error {
+	networkInterface, err := a.getNetworkInterface(ctx, id)
+	if err != nil {
+		return err
+	}
+	return a.sendNetworkInterfaceUpdate(ctx, networkInterface, changes)
+}
+
+// sendNetworkInterfaceUpdate applies the changes, in order, to the IP
+// configurations of the network interface and waits for the update to
+// complete.
+func (a *Azure) sendNetworkInterfaceUpdate(ctx context.Context, networkInterface armnetwork.Interface, changes []azureIPConfigurationChange) error {
+	// The properties are copied not to change the caller's network interface.
+	properties := armnetwork.InterfacePropertiesFormat{}
+	if networkInterface.Properties != nil {
+		properties = *networkInterface.Properties
+	}
+	networkInterface.Properties = &properties
+	ipConfigurations := append([]*armnetwork.InterfaceIPConfiguration{}, properties.IPConfigurations...)
+	for _, change := range changes {
+		if change.add != nil {
+			ipConfigurations = append(ipConfigurations, change.add)
+			if change.node != "" && a.tagsResources() {
+				networkInterface.Tags = a.getResourceTags(networkInterface.Tags, change.node)
+			}
+			continue
+		}
+		keepIPConfigurations := []*armnetwork.InterfaceIPConfiguration{}
+		for _, ipConfiguration := range ipConfigurations {
+			if ipConfiguration.Properties == nil || ipConfiguration.Properties.PrivateIPAddress == nil || !change.ip.Equal(ParseIP(*ipConfiguration.Properties.PrivateIPAddress)) {
+				keepIPConfigurations = append(keepIPConfigurations, ipConfiguration)
+			}
+		}
+		ipConfigurations = keepIPConfigurations
+	}
+	networkInterface.Properties.IPConfigurations = ipConfigurations
+	// Send the request
+	result, err := a.createOrUpdate(ctx, networkInterface)
+	if err != nil {
+		return err
+	}
+	return a.waitForCompletion(ctx, result)
+}
@@ -0,0 +1,304 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const fakeAzureNetworkInterfaceID = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/nic-0"
+
+// fakeAzureNetworkInterfaces serves the ARM operations getting and updating a
+// single network interface holding the IP configurations of ips, refusing
+// updates with refusedIP. If putDelay is set, updates take that long to be
+// applied, as they read the IP configurations first, like ARM, which takes a
+// full PUT.
+type fakeAzureNetworkInterfaces struct {
+	mu        sync.Mutex
+	ips       []string
+	refusedIP string
+	puts      int
+	putDelay  time.Duration
+	// inflightPuts are the updates in progress, and maxInflightPuts the most
+	// of them at once.
+	inflightPuts    int
+	maxInflightPuts int
+}
+
+func (f *fakeAzureNetworkInterfaces) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut && f.putDelay > 0 {
+		f.mu.Lock()
+		f.inflightPuts++
+		if f.inflightPuts > f.maxInflightPuts {
+			f.maxInflightPuts = f.inflightPuts
+		}
+		f.mu.Unlock()
+		time.Sleep(f.putDelay)
+		defer func() {
+			f.mu.Lock()
+			f.inflightPuts--
+			f.mu.Unlock()
+		}()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		f.puts++
+		var body struct {
+			Properties struct {
+				IPConfigurations []struct {
+					Properties struct {
+						PrivateIPAddress string `json:"privateIPAddress"`
+					} `json:"properties"`
+				} `json:"ipConfigurations"`
+			} `json:"properties"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		ips := []string{}
+		for _, ipConfiguration := range body.Properties.IPConfigurations {
+			if ipConfiguration.Properties.PrivateIPAddress == f.refusedIP {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error": {"code": "PrivateIPAddressInUse", "message": "IP address is in use"}}`)
+				return
+			}
+			ips = append(ips, ipConfiguration.Properties.PrivateIPAddress)
+		}
+		f.ips = ips
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ipConfigurations := []string{}
+	for _, ip := range f.ips {
+		ipConfigurations = append(ipConfigurations, fmt.Sprintf(`{"name": "%s", "properties": {"privateIPAddress": "%s"}}`, ip, ip))
+	}
+	fmt.Fprintf(w, `{"id": "%s", "name": "%s", "properties": {"provisioningState": "Succeeded", "ipConfigurations": [%s]}}`,
+		r.URL.Path, getNameFromResourceID(r.URL.Path)[1:], strings.Join(ipConfigurations, ","))
+}
+
+func TestAzureUpdateNetworkInterface(t *testing.T) {
+	tcs := []struct {
+		window    time.Duration
+		assigned  []string
+		refusedIP string
+		add       []string
+		remove    []string
+		expected  []string
+		puts      int
+		failedIPs []string
+	}{
+		{
+			assigned: []string{"10.0.0.4"},
+			add:      []string{"10.0.0.10"},
+			expected: []string{"10.0.0.10", "10.0.0.4"},
+			puts:     1,
+		},
+		// Concurrent changes are applied in a single update.
+		{
+			window:   100 * time.Millisecond,
+			assigned: []string{"10.0.0.4", "10.0.0.5"},
+			add:      []string{"10.0.0.10", "10.0.0.11", "10.0.0.12"},
+			remove:   []string{"10.0.0.5"},
+			expected: []string{"10.0.0.10", "10.0.0.11", "10.0.0.12", "10.0.0.4"},
+			puts:     1,
+		},
+		// If the update fails, the changes are applied one by one.
+		{
+			window:    100 * time.Millisecond,
+			assigned:  []string{"10.0.0.4"},
+			refusedIP: "10.0.0.66",
+			add:       []string{"10.0.0.10", "10.0.0.66"},
+			expected:  []string{"10.0.0.10", "10.0.0.4"},
+			puts:      3,
+			failedIPs: []string{"10.0.0.66"},
+		},
+	}
+	for i, tc := range tcs {
+		fake := &fakeAzureNetworkInterfaces{ips: tc.assigned, refusedIP: tc.refusedIP}
+		server := httptest.NewTLSServer(fake)
+		a := newFakeAzure(t, server, CloudProviderConfig{AzureUpdateBatchWindow: tc.window})
+		networkInterface, err := a.getNetworkInterface(context.Background(), fakeAzureNetworkInterfaceID)
+		if err != nil {
+			t.Fatalf("TestAzureUpdateNetworkInterface(%d): received unexpected error, err: %v", i, err)
+		}
+
+		var mu sync.Mutex
+		failedIPs := []string{}
+		var wg sync.WaitGroup
+		change := func(ip string, add bool) {
+			defer wg.Done()
+			c := azureIPConfigurationChange{ip: net.ParseIP(ip)}
+			if add {
+				name := ip
+				c.add = &armnetwork.InterfaceIPConfiguration{
+					Name:       &name,
+					Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{PrivateIPAddress: &name},
+				}
+			}
+			if err := a.updateNetworkInterface(context.Background(), networkInterface, c); err != nil {
+				mu.Lock()
+				failedIPs = append(failedIPs, ip)
+				mu.Unlock()
+			}
+		}
+		for _, ip := range tc.add {
+			wg.Add(1)
+			go change(ip, true)
+		}
+		for _, ip := range tc.remove {
+			wg.Add(1)
+			go change(ip, false)
+		}
+		wg.Wait()
+		server.Close()
+
+		sort.Strings(fake.ips)
+		if fmt.Sprint(fake.ips) != fmt.Sprint(tc.expected) {
+			t.Fatalf("TestAzureUpdateNetworkInterface(%d): expected IP configurations %v, got %v", i, tc.expected, fake.ips)
+		}
+		if fake.puts != tc.puts {
+			t.Fatalf("TestAzureUpdateNetworkInterface(%d): expected %d updates, got %d", i, tc.puts, fake.puts)
+		}
+		if fmt.Sprint(failedIPs) != fmt.Sprint(tc.failedIPs) {
+			t.Fatalf("TestAzureUpdateNetworkInterface(%d): expected changes of %v to fail, got %v", i, tc.failedIPs, failedIPs)
+		}
+	}
+}
+
+// TestAzureBatchCalls verifies that the changes of a single AssignPrivateIPs
+// or ReleasePrivateIPs call are applied in a single update, without waiting
+// for the batch window.
+func TestAzureBatchCalls(t *testing.T) {
+	fake := &fakeAzureNetworkInterfaces{ips: []string{"10.0.0.4"}}
+	server := httptest.NewTLSServer(fake)
+	defer server.Close()
+	a := newFakeAzure(t, server, CloudProviderConfig{AzureUpdateBatchWindow: time.Hour})
+	networkInterface, err := a.getNetworkInterface(context.Background(), fakeAzureNetworkInterfaceID)
+	if err != nil {
+		t.Fatalf("TestAzureBatchCalls: received unexpected error, err: %v", err)
+	}
+
+	ips := []net.IP{net.ParseIP("10.0.0.10"), net.ParseIP("10.0.0.11"), net.ParseIP("10.0.0.12")}
+	done := make(chan []error)
+	go func() {
+		done <- a.calls.apply(context.Background(), ips, nil, func(ctx context.Context, ip net.IP, _ *corev1.Node) error {
+			name := ip.String()
+			return a.updateNetworkInterface(ctx, networkInterface, azureIPConfigurationChange{ip: ip, add: &armnetwork.InterfaceIPConfiguration{
+				Name:       &name,
+				Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{PrivateIPAddress: &name},
+			}})
+		})
+	}()
+	select {
+	case errs := <-done:
+		for _, err := range errs {
+			if err != nil {
+				t.Fatalf("TestAzureBatchCalls: received unexpected error, err: %v", err)
+			}
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("TestAzureBatchCalls: expected the changes not to wait for the batch window")
+	}
+	if fake.puts != 1 {
+		t.Fatalf("TestAzureBatchCalls: expected a single update, got %d", fake.puts)
+	}
+	sort.Strings(fake.ips)
+	if expected := "[10.0.0.10 10.0.0.11 10.0.0.12 10.0.0.4]"; fmt.Sprint(fake.ips) != expected {
+		t.Fatalf("TestAzureBatchCalls: expected IP configurations %v, got %v", expected, fake.ips)
+	}
+}
+
+func TestAzureNetworkInterfaceLocks(t *testing.T) {
+	fakes := map[string]*fakeAzureNetworkInterfaces{}
+	var mu sync.Mutex
+	inflightPuts, maxInflightPuts := 0, 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			mu.Lock()
+			inflightPuts++
+			if inflightPuts > maxInflightPuts {
+				maxInflightPuts = inflightPuts
+			}
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				inflightPuts--
+				mu.Unlock()
+			}()
+		}
+		fake, ok := fakes[strings.ToLower(getNameFromResourceID(r.URL.Path)[1:])]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	a := newFakeAzure(t, server, CloudProviderConfig{})
+
+	networkInterfaces := map[string]armnetwork.Interface{}
+	for _, name := range []string{"nic-0", "nic-1"} {
+		fakes[name] = &fakeAzureNetworkInterfaces{ips: []string{"10.0.0.4"}, putDelay: 200 * time.Millisecond}
+		networkInterface, err := a.getNetworkInterface(context.Background(), strings.TrimSuffix(fakeAzureNetworkInterfaceID, "nic-0")+name)
+		if err != nil {
+			t.Fatalf("TestAzureNetworkInterfaceLocks: received unexpected error, err: %v", err)
+		}
+		networkInterfaces[name] = networkInterface
+	}
+
+	// The changes are sent with the network interfaces as they were before any
+	// of them, but none is lost.
+	changes := map[string][]string{
+		"nic-0": {"10.0.0.10", "10.0.0.11", "10.0.0.12"},
+		"nic-1": {"10.0.0.20"},
+	}
+	var wg sync.WaitGroup
+	for name, ips := range changes {
+		for _, ip := range ips {
+			wg.Add(1)
+			go func(name, ip string) {
+				defer wg.Done()
+				c := azureIPConfigurationChange{ip: net.ParseIP(ip), add: &armnetwork.InterfaceIPConfiguration{
+					Name:       &ip,
+					Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{PrivateIPAddress: &ip},
+				}}
+				if err := a.updateNetworkInterface(context.Background(), networkInterfaces[name], c); err != nil {
+					t.Errorf("TestAzureNetworkInterfaceLocks: received unexpected error, err: %v", err)
+				}
+			}(name, ip)
+		}
+	}
+	wg.Wait()
+
+	for name, ips := range changes {
+		fake := fakes[name]
+		expected := append([]string{"10.0.0.4"}, ips...)
+		sort.Strings(fake.ips)
+		sort.Strings(expected)
+		if fmt.Sprint(fake.ips) != fmt.Sprint(expected) {
+			t.Fatalf("TestAzureNetworkInterfaceLocks: expected IP configurations %v on %s, got %v", expected, name, fake.ips)
+		}
+		if fake.maxInflightPuts != 1 {
+			t.Fatalf("TestAzureNetworkInterfaceLocks: expected the updates of %s to be serialized, got %d at once", name, fake.maxInflightPuts)
+		}
+	}
+	if maxInflightPuts < 2 {
+		t.Fatalf("TestAzureNetworkInterfaceLocks: expected the updates of different network interfaces to run in parallel")
+	}
+}
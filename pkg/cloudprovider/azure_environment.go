@@ -0,0 +1,102 @@
+package cloudprovider
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	azureapi "github.com/Azure/go-autorest/autorest/azure"
+)
+
+const (
+	// azureStackCloudName is the environment of Azure Stack Hub, whose
+	// endpoints are specific to each installation.
+	azureStackCloudName = "AzureStackCloud"
+	// azureADFSTenantID is the tenant of the tokens issued by AD FS, the
+	// identity provider of disconnected Azure Stack Hub installations.
+	azureADFSTenantID = "adfs"
+)
+
+// azureEnvironmentAliases maps the names the Azure CLI gives the clouds, in
+// upper case, to the environment names of go-autorest.
+var azureEnvironmentAliases = map[string]string{
+	"AZURECLOUD":        "AzurePublicCloud",
+	"AZUREUSGOVERNMENT": "AzureUSGovernmentCloud",
+	"AZURECHINA":        "AzureChinaCloud",
+	"AZUREGERMANY":      "AzureGermanCloud",
+}
+
+// getEnvironment returns the Azure "Environment", which is just a named set
+// of API endpoints: the ones the API override's metadata endpoint lists if
+// set, else the ones of the named environment. The endpoints of Azure Stack
+// Hub are read from the environment file. go-autorest still catalogs the
+// environments, getCloudConfiguration configures the SDK with them.
+func (a *Azure) getEnvironment() (azureapi.Environment, error) {
+	if a.cfg.APIOverride != "" {
+		return azureapi.EnvironmentFromURL(a.cfg.APIOverride)
+	}
+	name := a.cfg.AzureEnvironment
+	if name == "" {
+		name = "AzurePublicCloud"
+	}
+	if !strings.EqualFold(name, azureStackCloudName) {
+		if alias, ok := azureEnvironmentAliases[strings.ToUpper(name)]; ok {
+			name = alias
+		}
+		return azureapi.EnvironmentFromName(name)
+	}
+	environmentFile := a.cfg.AzureEnvironmentFile
+	if environmentFile == "" {
+		environmentFile = os.Getenv(azureapi.EnvironmentFilepathName)
+	}
+	if environmentFile == "" {
+		return azureapi.Environment{}, fmt.Errorf("the endpoints of environment %s must be described in an environment file, set -platform-azure-environment-file", azureStackCloudName)
+	}
+	env, err := azureapi.EnvironmentFromFile(environmentFile)
+	if err != nil {
+		return env, fmt.Errorf("unable to read environment file %s, err: %v", environmentFile, err)
+	}
+	if env.ResourceManagerEndpoint == "" || env.ActiveDirectoryEndpoint == "" {
+		return env, fmt.Errorf("environment file %s lacks the resourceManagerEndpoint or activeDirectoryEndpoint", environmentFile)
+	}
+	// The ARM access tokens are issued for the resource manager unless the
+	// installation has an audience of its own.
+	if env.TokenAudience == "" {
+		env.TokenAudience = env.ResourceManagerEndpoint
+	}
+	return env, nil
+}
+
+// usesADFS returns true if the environment's identity provider is AD FS.
+func usesADFS(env azureapi.Environment) bool {
+	return strings.HasSuffix(strings.TrimSuffix(env.ActiveDirectoryEndpoint, "/"), "/"+azureADFSTenantID)
+}
+
+// getTenantID returns the tenant to request tokens from: always adfs if the
+// environment's identity provider is AD FS, whatever the secret holds.
+func getTenantID(env azureapi.Environment, tenantID string) string {
+	if usesADFS(env) {
+		return azureADFSTenantID
+	}
+	return tenantID
+}
+
+// getCloudConfiguration returns the configuration of the ARM clients and
+// credentials for the environment. The credentials append the tenant to the
+// authority host, which is stripped of it for AD FS.
+func getCloudConfiguration(env azureapi.Environment) cloud.Configuration {
+	authorityHost := env.ActiveDirectoryEndpoint
+	if usesADFS(env) {
+		authorityHost = strings.TrimSuffix(strings.TrimSuffix(authorityHost, "/"), azureADFSTenantID)
+	}
+	return cloud.Configuration{
+		ActiveDirectoryAuthorityHost: authorityHost,
+		Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+			cloud.ResourceManager: {
+				Endpoint: env.ResourceManagerEndpoint,
+				Audience: env.TokenAudience,
+			},
+		},
+	}
+}
@@ -0,0 +1,78 @@
+package cloudprovider
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	azureapi "github.com/Azure/go-autorest/autorest/azure"
+)
+
+func TestAzureGetEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	stackFile := filepath.Join(dir, "azurestackcloud.json")
+	if err := ioutil.WriteFile(stackFile, []byte(`{
+  "name": "AzureStackCloud",
+  "resourceManagerEndpoint": "https://management.local.azurestack.external/",
+  "activeDirectoryEndpoint": "https://adfs.local.azurestack.external/adfs/"
+}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	incompleteFile := filepath.Join(dir, "incomplete.json")
+	if err := ioutil.WriteFile(incompleteFile, []byte(`{"name": "AzureStackCloud"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		name            string
+		environmentFile string
+		resourceManager string
+		tokenAudience   string
+		tenantID        string
+		authorityHost   string
+		expectErr       bool
+	}{
+		{resourceManager: azureapi.PublicCloud.ResourceManagerEndpoint, tokenAudience: azureapi.PublicCloud.TokenAudience, tenantID: "tenant-1", authorityHost: azureapi.PublicCloud.ActiveDirectoryEndpoint},
+		{name: "AzureUSGovernmentCloud", resourceManager: azureapi.USGovernmentCloud.ResourceManagerEndpoint, tokenAudience: azureapi.USGovernmentCloud.TokenAudience, tenantID: "tenant-1", authorityHost: azureapi.USGovernmentCloud.ActiveDirectoryEndpoint},
+		// The Azure CLI names of the clouds are accepted as well.
+		{name: "AzureUSGovernment", resourceManager: azureapi.USGovernmentCloud.ResourceManagerEndpoint, tokenAudience: azureapi.USGovernmentCloud.TokenAudience, tenantID: "tenant-1", authorityHost: azureapi.USGovernmentCloud.ActiveDirectoryEndpoint},
+		{name: "AzureChina", resourceManager: azureapi.ChinaCloud.ResourceManagerEndpoint, tokenAudience: azureapi.ChinaCloud.TokenAudience, tenantID: "tenant-1", authorityHost: azureapi.ChinaCloud.ActiveDirectoryEndpoint},
+		{name: "AzureMarsCloud", expectErr: true},
+		// Azure Stack Hub's endpoints come from the environment file, its
+		// identity provider is AD FS.
+		{
+			name:            "AzureStackCloud",
+			environmentFile: stackFile,
+			resourceManager: "https://management.local.azurestack.external/",
+			tokenAudience:   "https://management.local.azurestack.external/",
+			tenantID:        azureADFSTenantID,
+			// The credentials append the adfs tenant themselves.
+			authorityHost: "https://adfs.local.azurestack.external/",
+		},
+		{name: "AzureStackCloud", expectErr: true},
+		{name: "AzureStackCloud", environmentFile: incompleteFile, expectErr: true},
+	}
+	for i, tc := range tcs {
+		t.Setenv(azureapi.EnvironmentFilepathName, "")
+		a := &Azure{CloudProvider: CloudProvider{cfg: CloudProviderConfig{AzureEnvironment: tc.name, AzureEnvironmentFile: tc.environmentFile}}}
+		env, err := a.getEnvironment()
+		if tc.expectErr {
+			if err == nil {
+				t.Fatalf("TestAzureGetEnvironment(%d): expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestAzureGetEnvironment(%d): received unexpected error, err: %v", i, err)
+		}
+		if env.ResourceManagerEndpoint != tc.resourceManager || env.TokenAudience != tc.tokenAudience {
+			t.Fatalf("TestAzureGetEnvironment(%d): expected endpoint %s and audience %s, got %s and %s", i, tc.resourceManager, tc.tokenAudience, env.ResourceManagerEndpoint, env.TokenAudience)
+		}
+		if tenantID := getTenantID(env, "tenant-1"); tenantID != tc.tenantID {
+			t.Fatalf("TestAzureGetEnvironment(%d): expected tenant %s, got %s", i, tc.tenantID, tenantID)
+		}
+		if authorityHost := getCloudConfiguration(env).ActiveDirectoryAuthorityHost; authorityHost != tc.authorityHost {
+			t.Fatalf("TestAzureGetEnvironment(%d): expected authority host %s, got %s", i, tc.authorityHost, authorityHost)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package cloudprovider
+
+import (
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"k8s.io/klog/v2"
+)
+
+// getManagedIdentityCredential returns a credential with the ARM access tokens
+// of the user-assigned managed identity clientID, issued by the instance
+// metadata service of the VM the controller runs on: no service principal
+// secret is needed. The identity must be assigned to the VMs of the nodes the
+// controller can run on. The access tokens are refreshed automatically before
+// they expire.
+func (a *Azure) getManagedIdentityCredential(clientID string) (azcore.TokenCredential, error) {
+	credential, err := azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{
+		ClientOptions: a.getCredentialOptions(),
+		ID:            azidentity.ClientID(clientID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize managed identity %s, err: %v", clientID, err)
+	}
+	klog.Infof("Authenticating to Azure with user-assigned managed identity %s", clientID)
+	return credential, nil
+}
@@ -0,0 +1,69 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	azureapi "github.com/Azure/go-autorest/autorest/azure"
+)
+
+// fakeAzureTransport sends all requests to the fake server, whatever their
+// host, e.g. the instance metadata service's.
+type fakeAzureTransport struct {
+	server *httptest.Server
+}
+
+func (f fakeAzureTransport) Do(r *http.Request) (*http.Response, error) {
+	serverURL, _ := url.Parse(f.server.URL)
+	r.URL.Scheme, r.URL.Host = serverURL.Scheme, serverURL.Host
+	return f.server.Client().Do(r)
+}
+
+func TestAzureManagedIdentityCredential(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" || r.URL.Query().Get("client_id") != "identity-1" || r.URL.Query().Get("resource") != azureapi.PublicCloud.TokenAudience {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token": "access-1", "token_type": "Bearer", "expires_in": "3600", "expires_on": "%d", "resource": "%s", "client_id": "identity-1"}`,
+			time.Now().Add(time.Hour).Unix(), r.URL.Query().Get("resource"))
+	}))
+	defer server.Close()
+
+	a := &Azure{env: azureapi.PublicCloud, transport: fakeAzureTransport{server: server}}
+	credential, err := a.getManagedIdentityCredential("identity-1")
+	if err != nil {
+		t.Fatalf("TestAzureManagedIdentityCredential: received unexpected error, err: %v", err)
+	}
+	token, err := credential.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{azureapi.PublicCloud.TokenAudience + "/.default"}})
+	if err != nil {
+		t.Fatalf("TestAzureManagedIdentityCredential: received unexpected error, err: %v", err)
+	}
+	if token.Token != "access-1" {
+		t.Fatalf("TestAzureManagedIdentityCredential: expected access token %q, got %q", "access-1", token.Token)
+	}
+}
+
+func TestAzureNewCredential(t *testing.T) {
+	a := &Azure{CloudProvider: CloudProvider{cfg: CloudProviderConfig{
+		CredentialDir:                t.TempDir(),
+		AzureManagedIdentityClientID: "identity-1",
+		AzureFederatedTokenFile:      "/var/run/secrets/azure/tokens/azure-identity-token",
+	}}}
+	if _, err := a.newCredential(); err == nil {
+		t.Fatalf("TestAzureNewCredential: expected an error for a managed identity combined with a federated token file")
+	}
+
+	// The managed identity doesn't need the secret's application.
+	a.cfg.AzureFederatedTokenFile = ""
+	a.env = azureapi.PublicCloud
+	if _, err := a.newCredential(); err != nil {
+		t.Fatalf("TestAzureNewCredential: received unexpected error, err: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package cloudprovider
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// AzureNetworkInterfaceSelectorAnnotation can be set on a node to the
+	// selector of the network interface egress IPs are assigned to,
+	// overriding -platform-azure-network-interface-selector for that node.
+	AzureNetworkInterfaceSelectorAnnotation = "cloud.network.openshift.io/azure-network-interface-selector"
+
+	azureNetworkInterfaceSelectorSubnet = "subnet"
+	azureNetworkInterfaceSelectorName   = "name"
+	azureNetworkInterfaceSelectorTag    = "tag"
+)
+
+// azureNetworkInterfaceSelector selects the network interface of multi-NIC
+// VMs egress IPs are assigned to, by subnet ID, name pattern or tag.
+type azureNetworkInterfaceSelector struct {
+	kind string
+	// value is the subnet ID, the name pattern or the tag key.
+	value string
+	// tagValue is the value of the tag, any value matches if empty.
+	tagValue string
+}
+
+func (s *azureNetworkInterfaceSelector) String() string {
+	if s.tagValue != "" {
+		return fmt.Sprintf("%s=%s=%s", s.kind, s.value, s.tagValue)
+	}
+	return fmt.Sprintf("%s=%s", s.kind, s.value)
+}
+
+// parseAzureNetworkInterfaceSelector parses a network interface selector, one
+// of: subnet=<subnet ID>, name=<pattern>, tag=<key>[=<value>]. The pattern
+// follows the syntax of path.Match. It returns nil for an empty selector.
+func parseAzureNetworkInterfaceSelector(s string) (*azureNetworkInterfaceSelector, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	kind, value, ok := strings.Cut(s, "=")
+	if !ok || value == "" {
+		return nil, fmt.Errorf("invalid Azure network interface selector %q, expected <kind>=<value>", s)
+	}
+	selector := &azureNetworkInterfaceSelector{kind: kind, value: value}
+	switch kind {
+	case azureNetworkInterfaceSelectorSubnet:
+	case azureNetworkInterfaceSelectorName:
+		if _, err := path.Match(value, ""); err != nil {
+			return nil, fmt.Errorf("invalid Azure network interface selector %q, bad name pattern: %v", s, err)
+		}
+	case azureNetworkInterfaceSelectorTag:
+		selector.value, selector.tagValue, _ = strings.Cut(value, "=")
+	default:
+		return nil, fmt.Errorf("invalid Azure network interface selector %q, kind must be one of: %s, %s, %s", s,
+			azureNetworkInterfaceSelectorSubnet, azureNetworkInterfaceSelectorName, azureNetworkInterfaceSelectorTag)
+	}
+	return selector, nil
+}
+
+// selectNetworkInterface returns the network interface egress IPs are
+// assigned to, out of the VM's network interfaces as ordered by
+// getNetworkInterfaces: the first one matching the node's selector
+// annotation, or the global selector. Without selector, it's the primary
+// interface, or the first one listed.
+func (a *Azure) selectNetworkInterface(node *corev1.Node, networkInterfaces []armnetwork.Interface) (armnetwork.Interface, error) {
+	selector := a.networkInterfaceSelector
+	if annotation, ok := node.Annotations[AzureNetworkInterfaceSelectorAnnotation]; ok {
+		var err error
+		if selector, err = parseAzureNetworkInterfaceSelector(annotation); err != nil {
+			return armnetwork.Interface{}, fmt.Errorf("error parsing annotation %s of node %s, err: %v", AzureNetworkInterfaceSelectorAnnotation, node.Name, err)
+		}
+	}
+	if selector == nil {
+		return networkInterfaces[0], nil
+	}
+	for _, networkInterface := range networkInterfaces {
+		if selector.matches(networkInterface) {
+			return networkInterface, nil
+		}
+	}
+	return armnetwork.Interface{}, fmt.Errorf("%w: no network interface of node %s matches selector %s", NoNetworkInterfaceError, node.Name, selector)
+}
+
+// matches returns true if the network interface matches the selector. Subnet
+// IDs, like all Azure resource IDs, are compared case-insensitively.
+func (s *azureNetworkInterfaceSelector) matches(networkInterface armnetwork.Interface) bool {
+	switch s.kind {
+	case azureNetworkInterfaceSelectorSubnet:
+		if networkInterface.Properties == nil {
+			return false
+		}
+		for _, ipConfiguration := range networkInterface.Properties.IPConfigurations {
+			if ipConfiguration.Properties != nil && ipConfiguration.Properties.Subnet != nil &&
+				ipConfiguration.Properties.Subnet.ID != nil && strings.EqualFold(*ipConfiguration.Properties.Subnet.ID, s.value) {
+				return true
+			}
+		}
+		return false
+	case azureNetworkInterfaceSelectorName:
+		if networkInterface.Name == nil {
+			return false
+		}
+		matched, _ := path.Match(s.value, *networkInterface.Name)
+		return matched
+	default:
+		value, ok := networkInterface.Tags[s.value]
+		return ok && (s.tagValue == "" || (value != nil && *value == s.tagValue))
+	}
+}
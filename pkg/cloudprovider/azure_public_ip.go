@@ -0,0 +1,94 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// usesPublicIPs returns true if a public IP is associated with every egress
+// IP, for it to egress to the internet with that public IP.
+func (a *Azure) usesPublicIPs() bool {
+	return a.cfg.AzurePublicIPTagKey != "" || a.cfg.AzurePublicIPNamePrefix != ""
+}
+
+// getPublicIPName returns the name of the public IP of ip:
+// AzurePublicIPNamePrefix followed by ip, the colons of IPv6 addresses, which
+// resource names can't hold, replaced by dashes.
+func (a *Azure) getPublicIPName(ip net.IP) string {
+	return a.cfg.AzurePublicIPNamePrefix + strings.ReplaceAll(ip.String(), ":", "-")
+}
+
+// findPublicIP returns the public IP to associate with ip, in the cluster's
+// resource group: the one named after ip if AzurePublicIPNamePrefix is set,
+// otherwise the one tagged AzurePublicIPTagKey=<ip>. If both are set, the named
+// public IP must be tagged as well. The public IP must not be associated with
+// an IP configuration other than ipConfigurationName yet, the association
+// being part of the IP configuration.
+func (a *Azure) findPublicIP(ctx context.Context, ip net.IP, ipConfigurationName string) (*armnetwork.PublicIPAddress, error) {
+	callCtx, cancel := context.WithTimeout(ctx, defaultAzureOperationTimeout)
+	defer cancel()
+	var publicIP *armnetwork.PublicIPAddress
+	if a.cfg.AzurePublicIPNamePrefix != "" {
+		name := a.getPublicIPName(ip)
+		result, err := a.publicIPClient.Get(callCtx, a.resourceGroup, name, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving public IP %s, err: %v", name, err)
+		}
+		if a.cfg.AzurePublicIPTagKey != "" && !hasAzureTag(result.Tags, a.cfg.AzurePublicIPTagKey, ip.String()) {
+			return nil, fmt.Errorf("public IP %s isn't tagged %s=%s", name, a.cfg.AzurePublicIPTagKey, ip)
+		}
+		publicIP = &result.PublicIPAddress
+	} else {
+		pager := a.publicIPClient.NewListPager(a.resourceGroup, nil)
+		for publicIP == nil && pager.More() {
+			page, err := pager.NextPage(callCtx)
+			if err != nil {
+				return nil, fmt.Errorf("error listing public IPs, err: %v", err)
+			}
+			for _, result := range page.Value {
+				if hasAzureTag(result.Tags, a.cfg.AzurePublicIPTagKey, ip.String()) {
+					publicIP = result
+					break
+				}
+			}
+		}
+		if publicIP == nil {
+			return nil, fmt.Errorf("no public IP tagged %s=%s found in resource group %s", a.cfg.AzurePublicIPTagKey, ip, a.resourceGroup)
+		}
+	}
+	if publicIP.Properties != nil && publicIP.Properties.IPConfiguration != nil && publicIP.Properties.IPConfiguration.ID != nil &&
+		!strings.EqualFold(strings.TrimPrefix(getNameFromResourceID(*publicIP.Properties.IPConfiguration.ID), "/"), ipConfigurationName) {
+		return nil, fmt.Errorf("public IP %s is still associated with IP configuration %s", *publicIP.Name, *publicIP.Properties.IPConfiguration.ID)
+	}
+	return publicIP, nil
+}
+
+func hasAzureTag(tags map[string]*string, key, value string) bool {
+	tagValue, ok := tags[key]
+	return ok && tagValue != nil && *tagValue == value
+}
+
+// checkPublicIPZones returns a ZoneMismatchError if the public IP is zonal
+// and the node's VM is in another zone, or regional. Zone-redundant public
+// IPs, i.e. in all the zones of the region, and public IPs without zone fit
+// all VMs.
+func checkPublicIPZones(publicIP *armnetwork.PublicIPAddress, node *corev1.Node, zones []string) error {
+	publicIPZones := getAzureZones(publicIP.Zones)
+	if len(publicIPZones) != 1 {
+		return nil
+	}
+	if len(zones) == 0 {
+		return fmt.Errorf("%w: public IP %s is in zone %s, node %s isn't in any zone", ZoneMismatchError, *publicIP.Name, publicIPZones[0], node.Name)
+	}
+	for _, zone := range zones {
+		if zone == publicIPZones[0] {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: public IP %s is in zone %s, node %s in zone %s", ZoneMismatchError, *publicIP.Name, publicIPZones[0], node.Name, strings.Join(zones, ", "))
+}
@@ -0,0 +1,123 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestAzureFindPublicIP(t *testing.T) {
+	publicIPs := []map[string]interface{}{
+		{
+			"id":         "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/egress-10.0.0.10",
+			"name":       "egress-10.0.0.10",
+			"tags":       map[string]string{"egress-ip": "10.0.0.10"},
+			"properties": map[string]interface{}{"ipAddress": "203.0.113.10"},
+		},
+		{
+			"id":         "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/egress-fd00--10",
+			"name":       "egress-fd00--10",
+			"properties": map[string]interface{}{"ipAddress": "2001:db8::10"},
+		},
+		{
+			"id":   "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/egress-10.0.0.11",
+			"name": "egress-10.0.0.11",
+			"tags": map[string]string{"egress-ip": "10.0.0.11"},
+			"properties": map[string]interface{}{
+				"ipAddress":       "203.0.113.11",
+				"ipConfiguration": map[string]string{"id": fakeAzureNetworkInterfaceID + "/ipConfigurations/worker-1_10.0.0.11"},
+			},
+		},
+	}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Base(r.URL.Path)
+		if name == "publicIPAddresses" {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"value": publicIPs})
+			return
+		}
+		for _, publicIP := range publicIPs {
+			if publicIP["name"] == name {
+				_ = json.NewEncoder(w).Encode(publicIP)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	tcs := []struct {
+		tagKey              string
+		namePrefix          string
+		ip                  string
+		ipConfigurationName string
+		expected            string
+	}{
+		{tagKey: "egress-ip", ip: "10.0.0.10", ipConfigurationName: "worker-0_10.0.0.10", expected: "egress-10.0.0.10"},
+		{tagKey: "egress-ip", ip: "10.0.0.12", ipConfigurationName: "worker-0_10.0.0.12"},
+		{namePrefix: "egress-", ip: "10.0.0.10", ipConfigurationName: "worker-0_10.0.0.10", expected: "egress-10.0.0.10"},
+		{namePrefix: "egress-", ip: "fd00::10", ipConfigurationName: "worker-0_fd00::10", expected: "egress-fd00--10"},
+		// With both, the named public IP must be tagged as well.
+		{tagKey: "egress-ip", namePrefix: "egress-", ip: "10.0.0.10", ipConfigurationName: "worker-0_10.0.0.10", expected: "egress-10.0.0.10"},
+		{tagKey: "egress-ip", namePrefix: "egress-", ip: "fd00::10", ipConfigurationName: "worker-0_fd00::10"},
+		// Public IPs associated with another IP configuration can't be
+		// associated, but can be again with the same one.
+		{tagKey: "egress-ip", ip: "10.0.0.11", ipConfigurationName: "worker-0_10.0.0.11"},
+		{tagKey: "egress-ip", ip: "10.0.0.11", ipConfigurationName: "worker-1_10.0.0.11", expected: "egress-10.0.0.11"},
+	}
+	for i, tc := range tcs {
+		a := newFakeAzure(t, server, CloudProviderConfig{AzurePublicIPTagKey: tc.tagKey, AzurePublicIPNamePrefix: tc.namePrefix})
+		publicIP, err := a.findPublicIP(context.Background(), net.ParseIP(tc.ip), tc.ipConfigurationName)
+		if tc.expected == "" {
+			if err == nil {
+				t.Fatalf("TestAzureFindPublicIP(%d): expected an error, got public IP %s", i, *publicIP.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestAzureFindPublicIP(%d): received unexpected error, err: %v", i, err)
+		}
+		if *publicIP.Name != tc.expected {
+			t.Fatalf("TestAzureFindPublicIP(%d): expected public IP %s, got %s", i, tc.expected, *publicIP.Name)
+		}
+	}
+}
+
+func TestCheckPublicIPZones(t *testing.T) {
+	tcs := []struct {
+		publicIPZones []string
+		zones         []string
+		expectErr     bool
+	}{
+		{},
+		{zones: []string{"1"}},
+		{publicIPZones: []string{"2"}, zones: []string{"2"}},
+		{publicIPZones: []string{"1"}, zones: []string{"2"}, expectErr: true},
+		{publicIPZones: []string{"1"}, expectErr: true},
+		// Zone-redundant public IPs fit all VMs.
+		{publicIPZones: []string{"1", "2", "3"}, zones: []string{"2"}},
+	}
+	node := &corev1.Node{}
+	node.Name = "worker-0"
+	for i, tc := range tcs {
+		publicIP := &armnetwork.PublicIPAddress{Name: to.Ptr("egress-10.0.0.10")}
+		for _, zone := range tc.publicIPZones {
+			publicIP.Zones = append(publicIP.Zones, to.Ptr(zone))
+		}
+		err := checkPublicIPZones(publicIP, node, tc.zones)
+		if tc.expectErr && !errors.Is(err, ZoneMismatchError) {
+			t.Fatalf("TestCheckPublicIPZones(%d): expected a ZoneMismatchError, got %v", i, err)
+		}
+		if !tc.expectErr && err != nil {
+			t.Fatalf("TestCheckPublicIPZones(%d): received unexpected error, err: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// azureClusterIDTagKey, azureOwnedByTagKey and azureNodeTagKey are the keys
+	// of the tags set on the network interfaces and public IPs the controller
+	// changes, if AzureTagResources is set: the ID of the cluster, the
+	// controller, and the node the resource is used by. Azure tag names can't
+	// hold slashes, hence the underscores, like kubernetes.io_cluster.<ID> of
+	// the installer.
+	azureClusterIDTagKey = "cloud.network.openshift.io_cluster-id"
+	azureOwnedByTagKey   = "cloud.network.openshift.io_owned-by"
+	azureNodeTagKey      = "cloud.network.openshift.io_node"
+)
+
+// parseAzureResourceTags parses a comma separated list of <key>=<value> tags.
+// Azure reserves the keys starting with microsoft, azure or windows, and
+// refuses keys holding any of <>%&\?/.
+func parseAzureResourceTags(s string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(tag, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, `<>%&\?/`) {
+			return nil, fmt.Errorf("invalid Azure resource tag %q, expected <key>=<value> with a key without any of <>%%&\\?/", tag)
+		}
+		for _, prefix := range []string{"microsoft", "azure", "windows"} {
+			if strings.HasPrefix(strings.ToLower(key), prefix) {
+				return nil, fmt.Errorf("invalid Azure resource tag %q, keys starting with %s are reserved", tag, prefix)
+			}
+		}
+		tags[key] = strings.TrimSpace(value)
+	}
+	return tags, nil
+}
+
+// tagsResources returns true if the resources the controller changes are
+// tagged.
+func (a *Azure) tagsResources() bool {
+	return a.cfg.AzureTagResources || len(a.resourceTags) > 0
+}
+
+// getResourceTags returns tags, the current tags of a resource, with the tags
+// of the resources the controller changes for node set. tags isn't changed.
+func (a *Azure) getResourceTags(tags map[string]*string, node string) map[string]*string {
+	resourceTags := map[string]*string{}
+	for key, value := range tags {
+		resourceTags[key] = value
+	}
+	for key, value := range a.resourceTags {
+		resourceTags[key] = to.Ptr(value)
+	}
+	if a.cfg.AzureTagResources {
+		if a.cfg.ClusterID != "" {
+			resourceTags[azureClusterIDTagKey] = to.Ptr(a.cfg.ClusterID)
+		}
+		resourceTags[azureOwnedByTagKey] = to.Ptr(UserAgent)
+		resourceTags[azureNodeTagKey] = to.Ptr(node)
+	}
+	return resourceTags
+}
+
+// tagPublicIP tags the public IP associated for node. Its tags are replaced as
+// a whole, the ones it has, e.g. AzurePublicIPTagKey, are kept. The tags are
+// informative, failing to set them doesn't fail the association.
+func (a *Azure) tagPublicIP(ctx context.Context, publicIP *armnetwork.PublicIPAddress, node string) {
+	if !a.tagsResources() {
+		return
+	}
+	a.updatePublicIPTags(ctx, *publicIP.ID, a.getResourceTags(publicIP.Tags, node))
+}
+
+// untagPublicIP removes the node tag from the public IP publicIPID, no longer
+// associated with the node.
+func (a *Azure) untagPublicIP(ctx context.Context, publicIPID string) {
+	if !a.cfg.AzureTagResources {
+		return
+	}
+	resourceID, err := arm.ParseResourceID(publicIPID)
+	if err != nil {
+		klog.Warningf("Could not remove tag %s from public IP %s, err: %v", azureNodeTagKey, publicIPID, err)
+		return
+	}
+	callCtx, cancel := context.WithTimeout(ctx, defaultAzureOperationTimeout)
+	defer cancel()
+	result, err := a.publicIPClient.Get(callCtx, resourceID.ResourceGroupName, resourceID.Name, nil)
+	if err != nil {
+		klog.Warningf("Could not remove tag %s from public IP %s, err: %v", azureNodeTagKey, publicIPID, err)
+		return
+	}
+	if _, ok := result.Tags[azureNodeTagKey]; !ok {
+		return
+	}
+	tags := map[string]*string{}
+	for key, value := range result.Tags {
+		if key != azureNodeTagKey {
+			tags[key] = value
+		}
+	}
+	a.updatePublicIPTags(ctx, publicIPID, tags)
+}
+
+func (a *Azure) updatePublicIPTags(ctx context.Context, publicIPID string, tags map[string]*string) {
+	resourceID, err := arm.ParseResourceID(publicIPID)
+	if err == nil {
+		callCtx, cancel := context.WithTimeout(ctx, defaultAzureOperationTimeout)
+		defer cancel()
+		_, err = a.publicIPClient.UpdateTags(callCtx, resourceID.ResourceGroupName, resourceID.Name, armnetwork.TagsObject{Tags: tags}, nil)
+	}
+	if err != nil {
+		klog.Warningf("Could not update the tags of public IP %s, err: %v", publicIPID, err)
+	}
+}
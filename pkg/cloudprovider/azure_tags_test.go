@@ -0,0 +1,174 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
+)
+
+func TestParseAzureResourceTags(t *testing.T) {
+	tcs := []struct {
+		tags     string
+		expected map[string]string
+		err      bool
+	}{
+		{
+			tags:     "",
+			expected: map[string]string{},
+		},
+		{
+			tags:     "cost-center=net, team = sdn ,empty=",
+			expected: map[string]string{"cost-center": "net", "team": "sdn", "empty": ""},
+		},
+		{
+			tags: "cost-center",
+			err:  true,
+		},
+		{
+			tags: "=net",
+			err:  true,
+		},
+		{
+			tags: "cloud.network.openshift.io/team=sdn",
+			err:  true,
+		},
+		{
+			tags: "Microsoft.Cost=net",
+			err:  true,
+		},
+	}
+
+	for i, tc := range tcs {
+		tags, err := parseAzureResourceTags(tc.tags)
+		if tc.err {
+			if err == nil {
+				t.Fatalf("TestParseAzureResourceTags(%d): expected an error for %q", i, tc.tags)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestParseAzureResourceTags(%d): received unexpected error, err: %v", i, err)
+		}
+		if !reflect.DeepEqual(tags, tc.expected) {
+			t.Fatalf("TestParseAzureResourceTags(%d): expected %v, got %v", i, tc.expected, tags)
+		}
+	}
+}
+
+func TestAzureTagResources(t *testing.T) {
+	const publicIPID = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/egress-10.0.0.10"
+	tcs := []struct {
+		cfg          CloudProviderConfig
+		resourceTags map[string]string
+		// expected tags of the network interface once updated, and of the
+		// public IP once associated and once released.
+		expectedNetworkInterface map[string]string
+		expectedAssociated       map[string]string
+		expectedReleased         map[string]string
+	}{
+		// Nothing is tagged unless configured, the tags are kept.
+		{
+			cfg:                      CloudProviderConfig{ClusterID: "cluster-x7k2p"},
+			expectedNetworkInterface: map[string]string{"team": "sdn"},
+			expectedAssociated:       map[string]string{"egress-ip": "10.0.0.10"},
+			expectedReleased:         map[string]string{"egress-ip": "10.0.0.10"},
+		},
+		{
+			cfg:          CloudProviderConfig{ClusterID: "cluster-x7k2p", AzureTagResources: true},
+			resourceTags: map[string]string{"cost-center": "net"},
+			expectedNetworkInterface: map[string]string{
+				"team":               "sdn",
+				"cost-center":        "net",
+				azureClusterIDTagKey: "cluster-x7k2p",
+				azureOwnedByTagKey:   UserAgent,
+				azureNodeTagKey:      "node-a",
+			},
+			expectedAssociated: map[string]string{
+				"egress-ip":          "10.0.0.10",
+				"cost-center":        "net",
+				azureClusterIDTagKey: "cluster-x7k2p",
+				azureOwnedByTagKey:   UserAgent,
+				azureNodeTagKey:      "node-a",
+			},
+			expectedReleased: map[string]string{
+				"egress-ip":          "10.0.0.10",
+				"cost-center":        "net",
+				azureClusterIDTagKey: "cluster-x7k2p",
+				azureOwnedByTagKey:   UserAgent,
+			},
+		},
+		// Only the extra tags are set, without cluster ID nor node.
+		{
+			resourceTags:             map[string]string{"cost-center": "net"},
+			expectedNetworkInterface: map[string]string{"team": "sdn", "cost-center": "net"},
+			expectedAssociated:       map[string]string{"egress-ip": "10.0.0.10", "cost-center": "net"},
+			expectedReleased:         map[string]string{"egress-ip": "10.0.0.10", "cost-center": "net"},
+		},
+	}
+
+	for i, tc := range tcs {
+		networkInterfaceTags := map[string]string{"team": "sdn"}
+		publicIPTags := map[string]string{"egress-ip": "10.0.0.10"}
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				Tags map[string]string `json:"tags"`
+			}
+			if r.Method != http.MethodGet {
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+			}
+			switch r.URL.Path {
+			case fakeAzureNetworkInterfaceID:
+				if r.Method == http.MethodPut {
+					networkInterfaceTags = body.Tags
+				}
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"id": fakeAzureNetworkInterfaceID, "name": "nic-0", "tags": networkInterfaceTags,
+					"properties": map[string]interface{}{"provisioningState": "Succeeded"},
+				})
+			case publicIPID:
+				if r.Method == http.MethodPatch {
+					publicIPTags = body.Tags
+				}
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": publicIPID, "name": "egress-10.0.0.10", "tags": publicIPTags})
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		a := newFakeAzure(t, server, tc.cfg)
+		a.resourceTags = tc.resourceTags
+
+		networkInterface, err := a.getNetworkInterface(context.Background(), fakeAzureNetworkInterfaceID)
+		if err != nil {
+			t.Fatalf("TestAzureTagResources(%d): received unexpected error, err: %v", i, err)
+		}
+		change := azureIPConfigurationChange{ip: net.ParseIP("10.0.0.10"), node: "node-a", add: &armnetwork.InterfaceIPConfiguration{
+			Name:       to.Ptr("node-a_10.0.0.10"),
+			Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{PrivateIPAddress: to.Ptr("10.0.0.10")},
+		}}
+		if err := a.updateNetworkInterface(context.Background(), networkInterface, change); err != nil {
+			t.Fatalf("TestAzureTagResources(%d): received unexpected error, err: %v", i, err)
+		}
+		if !reflect.DeepEqual(networkInterfaceTags, tc.expectedNetworkInterface) {
+			t.Fatalf("TestAzureTagResources(%d): expected network interface tags %v, got %v", i, tc.expectedNetworkInterface, networkInterfaceTags)
+		}
+		a.tagPublicIP(context.Background(), &armnetwork.PublicIPAddress{ID: to.Ptr(publicIPID), Tags: map[string]*string{"egress-ip": to.Ptr("10.0.0.10")}}, "node-a")
+		if !reflect.DeepEqual(publicIPTags, tc.expectedAssociated) {
+			t.Fatalf("TestAzureTagResources(%d): expected public IP tags %v once associated, got %v", i, tc.expectedAssociated, publicIPTags)
+		}
+		a.untagPublicIP(context.Background(), publicIPID)
+		if !reflect.DeepEqual(publicIPTags, tc.expectedReleased) {
+			t.Fatalf("TestAzureTagResources(%d): expected public IP tags %v once released, got %v", i, tc.expectedReleased, publicIPTags)
+		}
+		server.Close()
+	}
+}
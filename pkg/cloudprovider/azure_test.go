@@ -0,0 +1,180 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/fake"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
+	azureapi "github.com/Azure/go-autorest/autorest/azure"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// newFakeAzure returns an Azure whose ARM clients send their requests to the
+// fake ARM server, a TLS one as the clients only send their access tokens
+// over TLS.
+func newFakeAzure(t *testing.T, server *httptest.Server, cfg CloudProviderConfig) *Azure {
+	a := &Azure{
+		CloudProvider: CloudProvider{ctx: context.Background(), cfg: cfg},
+		resourceGroup: "rg",
+		env:           azureapi.Environment{ResourceManagerEndpoint: server.URL, TokenAudience: server.URL},
+		transport:     server.Client(),
+	}
+	if err := a.initClients("sub", &fake.TokenCredential{}); err != nil {
+		t.Fatalf("failed to initialize the fake Azure clients, err: %v", err)
+	}
+	return a
+}
+
+func TestAzureGetCapacity(t *testing.T) {
+	address := func(ip string) *armnetwork.InterfaceIPConfiguration {
+		return &armnetwork.InterfaceIPConfiguration{
+			Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{PrivateIPAddress: &ip},
+		}
+	}
+	tcs := []struct {
+		ipConfigurations []*armnetwork.InterfaceIPConfiguration
+		capacity         int
+	}{
+		{capacity: 256},
+		// Both IP families take from the same limit.
+		{ipConfigurations: []*armnetwork.InterfaceIPConfiguration{address("10.0.0.5"), address("fd00::5")}, capacity: 254},
+		// IP configurations without allocated address yet count as well.
+		{ipConfigurations: []*armnetwork.InterfaceIPConfiguration{address("10.0.0.5"), {Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{}}}, capacity: 254},
+	}
+	a := &Azure{}
+	for i, tc := range tcs {
+		if capacity := a.getCapacity(armnetwork.Interface{Properties: &armnetwork.InterfacePropertiesFormat{IPConfigurations: tc.ipConfigurations}}); capacity != tc.capacity {
+			t.Fatalf("TestAzureGetCapacity(%d): expected capacity %d, got %d", i, tc.capacity, capacity)
+		}
+	}
+}
+
+func TestAzureSelectNetworkInterface(t *testing.T) {
+	nic := func(name, subnetID string, tags map[string]string) armnetwork.Interface {
+		networkInterface := armnetwork.Interface{
+			Name: &name,
+			Tags: map[string]*string{},
+			Properties: &armnetwork.InterfacePropertiesFormat{
+				IPConfigurations: []*armnetwork.InterfaceIPConfiguration{{
+					Properties: &armnetwork.InterfaceIPConfigurationPropertiesFormat{Subnet: &armnetwork.Subnet{ID: &subnetID}},
+				}},
+			},
+		}
+		for key, value := range tags {
+			value := value
+			networkInterface.Tags[key] = &value
+		}
+		return networkInterface
+	}
+	subnetID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/vnet/subnets/"
+	networkInterfaces := []armnetwork.Interface{
+		nic("worker-0-nic", subnetID+"machine", nil),
+		nic("worker-0-egress-nic", subnetID+"egress", map[string]string{"egress": "true"}),
+		nic("worker-0-storage-nic", subnetID+"storage", map[string]string{"egress": "false"}),
+	}
+	annotation := func(s string) *string { return &s }
+
+	tcs := []struct {
+		selector   string
+		annotation *string
+		expected   string
+		err        bool
+	}{
+		{expected: "worker-0-nic"},
+		{selector: "subnet=" + subnetID + "egress", expected: "worker-0-egress-nic"},
+		// Resource IDs are case-insensitive.
+		{selector: "subnet=" + strings.ToUpper(subnetID+"egress"), expected: "worker-0-egress-nic"},
+		{selector: "name=*-storage-nic", expected: "worker-0-storage-nic"},
+		{selector: "tag=egress", expected: "worker-0-egress-nic"},
+		{selector: "tag=egress=false", expected: "worker-0-storage-nic"},
+		{selector: "subnet=" + subnetID + "unknown", err: true},
+		// The node's annotation overrides the global selector, even if empty.
+		{selector: "tag=egress=true", annotation: annotation("name=*-storage-nic"), expected: "worker-0-storage-nic"},
+		{selector: "tag=egress=true", annotation: annotation(""), expected: "worker-0-nic"},
+		{annotation: annotation("lun=1"), err: true},
+		{annotation: annotation("name=[worker"), err: true},
+	}
+	for i, tc := range tcs {
+		selector, err := parseAzureNetworkInterfaceSelector(tc.selector)
+		if err != nil {
+			t.Fatalf("TestAzureSelectNetworkInterface(%d): received unexpected error, err: %q", i, err)
+		}
+		a := &Azure{networkInterfaceSelector: selector}
+		node := &corev1.Node{}
+		node.Name = "worker-0"
+		if tc.annotation != nil {
+			node.Annotations = map[string]string{AzureNetworkInterfaceSelectorAnnotation: *tc.annotation}
+		}
+		networkInterface, err := a.selectNetworkInterface(node, networkInterfaces)
+		if tc.err {
+			if err == nil {
+				t.Fatalf("TestAzureSelectNetworkInterface(%d): expected an error, got %s", i, *networkInterface.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestAzureSelectNetworkInterface(%d): received unexpected error, err: %q", i, err)
+		}
+		if *networkInterface.Name != tc.expected {
+			t.Fatalf("TestAzureSelectNetworkInterface(%d): expected network interface %s, got %s", i, tc.expected, *networkInterface.Name)
+		}
+	}
+}
+
+func TestAzureVerifyPrivateIP(t *testing.T) {
+	vmPath := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/worker-0"
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.EqualFold(r.URL.Path, vmPath):
+			fmt.Fprintf(w, `{"id": "%s", "properties": {"networkProfile": {"networkInterfaces": [{"id": "%s", "properties": {"primary": true}}]}}}`, vmPath, fakeAzureNetworkInterfaceID)
+		case strings.EqualFold(r.URL.Path, fakeAzureNetworkInterfaceID):
+			fmt.Fprintf(w, `{"id": "%s", "name": "nic-0", "properties": {"ipConfigurations": [
+				{"name": "ipconfig1", "properties": {"privateIPAddress": "10.0.0.4", "primary": true}},
+				{"name": "worker-0_10.0.0.10", "properties": {"privateIPAddress": "10.0.0.10", "publicIPAddress": {"id": "egress-10.0.0.10"}}},
+				{"name": "worker-0_10.0.0.11", "properties": {"privateIPAddress": "10.0.0.11"}}]}}`, fakeAzureNetworkInterfaceID)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tcs := []struct {
+		ip          string
+		publicIPs   bool
+		expectErr   bool
+		expectMiss  bool
+		expectExist bool
+	}{
+		{ip: "10.0.0.10", expectExist: true},
+		{ip: "10.0.0.11", expectExist: true},
+		// The IP configuration was deleted out of band.
+		{ip: "10.0.0.12", expectErr: true, expectMiss: true},
+		{ip: "10.0.0.10", publicIPs: true, expectExist: true},
+		{ip: "10.0.0.11", publicIPs: true, expectErr: true, expectExist: true},
+	}
+	node := &corev1.Node{}
+	node.Name = "worker-0"
+	node.Spec.ProviderID = "azure://" + vmPath
+	for i, tc := range tcs {
+		cfg := CloudProviderConfig{}
+		if tc.publicIPs {
+			cfg.AzurePublicIPTagKey = "egress-ip"
+		}
+		a := newFakeAzure(t, server, cfg)
+		err := a.VerifyPrivateIP(context.Background(), net.ParseIP(tc.ip), node)
+		if tc.expectErr != (err != nil) || tc.expectMiss != errors.Is(err, MissingIPError) {
+			t.Fatalf("TestAzureVerifyPrivateIP(%d): unexpected verification result, err: %v", i, err)
+		}
+		// IP addresses still assigned are not assigned again.
+		if err := a.AssignPrivateIP(context.Background(), net.ParseIP(tc.ip), node); tc.expectExist != errors.Is(err, AlreadyExistingIPError) {
+			t.Fatalf("TestAzureVerifyPrivateIP(%d): unexpected assignment result, err: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package cloudprovider
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/openshift/cloud-network-config-controller/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// azureMaxThrottledRetries is the number of times a request throttled by
+	// ARM is retried, after the delay of its Retry-After header.
+	azureMaxThrottledRetries = 3
+	// azureDefaultRetryAfter is the delay before retrying a throttled request
+	// whose response has no Retry-After header.
+	azureDefaultRetryAfter = 10 * time.Second
+	// azureRateLimitRemainingHeaderPrefix prefixes the headers ARM reports the
+	// remaining request budget with, e.g.
+	// x-ms-ratelimit-remaining-subscription-writes: 1199, or, for resource
+	// provider specific limits,
+	// x-ms-ratelimit-remaining-resource: Microsoft.Compute/GetVM3Min;238.
+	azureRateLimitRemainingHeaderPrefix = "X-Ms-Ratelimit-Remaining-"
+
+	azureThrottleReads  = "reads"
+	azureThrottleWrites = "writes"
+)
+
+var (
+	// azureRetryStatusCodes are the status codes of the transient failures the
+	// SDK retries, its default ones but 429 Too Many Requests: throttled
+	// requests are retried by azureThrottle, which doesn't blindly wait for
+	// Retry-After past the deadline of the request.
+	azureRetryStatusCodes = []int{
+		http.StatusRequestTimeout,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+
+	azureThrottledRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "azure_throttled_requests_total",
+		Help:      "Number of ARM requests throttled by Azure with 429 Too Many Requests.",
+	}, []string{"method"})
+	azureRateLimitRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Name:      "azure_ratelimit_remaining",
+		Help:      "Remaining ARM request budget, as reported by the x-ms-ratelimit-remaining-* headers of the last response.",
+	}, []string{"scope"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		azureThrottledRequestsTotal,
+		azureRateLimitRemaining,
+	)
+}
+
+// azureThrottle tracks until when ARM throttles our requests, separately for
+// reads and writes as ARM budgets them separately. While throttled, requests
+// wait for the end of the throttling rather than being sent only to be
+// throttled again, which would further delay the recovery of the budget.
+type azureThrottle struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+// Do implements policy.Policy, the ARM clients sending all their requests
+// through azureThrottle, long-running operation polls included. Throttled
+// requests are retried after their Retry-After delay, while it fits in the
+// deadline of the request.
+func (t *azureThrottle) Do(req *policy.Request) (*http.Response, error) {
+	r := req.Raw()
+	kind := azureThrottleWrites
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		kind = azureThrottleReads
+	}
+	for attempt := 0; ; attempt++ {
+		if err := t.wait(r, kind); err != nil {
+			return nil, err
+		}
+		resp, err := req.Next()
+		if err != nil {
+			return resp, err
+		}
+		recordAzureRateLimitRemaining(resp.Header)
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return resp, nil
+		}
+		azureThrottledRequestsTotal.WithLabelValues(r.Method).Inc()
+		retryAfter := getAzureRetryAfter(resp)
+		t.throttled(kind, retryAfter)
+		if attempt >= azureMaxThrottledRetries || !fitsDeadline(r, retryAfter) {
+			return resp, nil
+		}
+		klog.Warningf("ARM request %s %s throttled, retrying in %v", r.Method, r.URL.Path, retryAfter)
+		runtime.Drain(resp)
+		if err := req.RewindBody(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// wait waits until ARM stops throttling requests of that kind. If that's
+// after the deadline of the request, it fails right away instead.
+func (t *azureThrottle) wait(r *http.Request, kind string) error {
+	t.mu.Lock()
+	delay := time.Until(t.until[kind])
+	t.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	if !fitsDeadline(r, delay) {
+		return fmt.Errorf("ARM %s throttled for another %v, beyond the deadline of request %s %s", kind, delay.Round(time.Second), r.Method, r.URL.Path)
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-r.Context().Done():
+		return r.Context().Err()
+	}
+}
+
+func (t *azureThrottle) throttled(kind string, retryAfter time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.until == nil {
+		t.until = map[string]time.Time{}
+	}
+	if until := time.Now().Add(retryAfter); until.After(t.until[kind]) {
+		t.until[kind] = until
+	}
+}
+
+// fitsDeadline returns true if the request can wait for delay before its
+// context's deadline.
+func fitsDeadline(r *http.Request, delay time.Duration) bool {
+	deadline, ok := r.Context().Deadline()
+	return !ok || time.Now().Add(delay).Before(deadline)
+}
+
+// getAzureRetryAfter returns the delay of the Retry-After header, either a
+// number of seconds or an HTTP date, or azureDefaultRetryAfter.
+func getAzureRetryAfter(resp *http.Response) time.Duration {
+	retryAfter := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(retryAfter); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+		return 0
+	}
+	return azureDefaultRetryAfter
+}
+
+// recordAzureRateLimitRemaining records the remaining request budget of the
+// x-ms-ratelimit-remaining-* headers. The scope is the header's suffix, e.g.
+// subscription-writes, followed by the policy for resource provider specific
+// limits, e.g. resource:Microsoft.Compute/GetVM3Min.
+func recordAzureRateLimitRemaining(header http.Header) {
+	for key, values := range header {
+		if !strings.HasPrefix(key, azureRateLimitRemainingHeaderPrefix) || len(values) == 0 {
+			continue
+		}
+		scope := strings.ToLower(strings.TrimPrefix(key, azureRateLimitRemainingHeaderPrefix))
+		if remaining, err := strconv.ParseFloat(strings.TrimSpace(values[0]), 64); err == nil {
+			azureRateLimitRemaining.WithLabelValues(scope).Set(remaining)
+			continue
+		}
+		for _, policy := range strings.Split(values[0], ",") {
+			name, value, ok := strings.Cut(strings.TrimSpace(policy), ";")
+			if !ok {
+				continue
+			}
+			if remaining, err := strconv.ParseFloat(value, 64); err == nil {
+				azureRateLimitRemaining.WithLabelValues(scope + ":" + name).Set(remaining)
+			}
+		}
+	}
+}
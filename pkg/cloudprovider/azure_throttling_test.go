@@ -0,0 +1,100 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAzureThrottle(t *testing.T) {
+	tcs := []struct {
+		// throttled is the number of requests throttled before one succeeds.
+		throttled  int
+		retryAfter string
+		requests   int
+		expectErr  bool
+	}{
+		{requests: 1},
+		{throttled: 2, retryAfter: "0", requests: 3},
+		// Requests are retried at most azureMaxThrottledRetries times.
+		{throttled: 10, retryAfter: "0", requests: azureMaxThrottledRetries + 1, expectErr: true},
+		// Retrying after the deadline of the operation is pointless.
+		{throttled: 1, retryAfter: "60", requests: 1, expectErr: true},
+		{throttled: 1, retryAfter: "Wed, 21 Oct 2015 07:28:00 GMT", requests: 2},
+	}
+	for i, tc := range tcs {
+		var mu sync.Mutex
+		requests := 0
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			requests++
+			w.Header().Set("x-ms-ratelimit-remaining-subscription-reads", fmt.Sprint(12000-requests))
+			w.Header().Set("x-ms-ratelimit-remaining-resource", "Microsoft.Network/GetNetworkInterface3Min;100,Microsoft.Network/GetNetworkInterface30Min;1000")
+			if requests <= tc.throttled {
+				w.Header().Set("Retry-After", tc.retryAfter)
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			fmt.Fprintf(w, `{"id": "%s", "name": "nic-0", "properties": {}}`, fakeAzureNetworkInterfaceID)
+		}))
+		a := newFakeAzure(t, server, CloudProviderConfig{})
+		throttledBefore := testutil.ToFloat64(azureThrottledRequestsTotal.WithLabelValues(http.MethodGet))
+
+		_, err := a.getNetworkInterface(context.Background(), fakeAzureNetworkInterfaceID)
+		server.Close()
+		if tc.expectErr && err == nil {
+			t.Fatalf("TestAzureThrottle(%d): expected an error", i)
+		}
+		if !tc.expectErr && err != nil {
+			t.Fatalf("TestAzureThrottle(%d): received unexpected error, err: %v", i, err)
+		}
+		if requests != tc.requests {
+			t.Fatalf("TestAzureThrottle(%d): expected %d requests, got %d", i, tc.requests, requests)
+		}
+		expectedThrottled := tc.throttled
+		if expectedThrottled > tc.requests {
+			expectedThrottled = tc.requests
+		}
+		if throttled := testutil.ToFloat64(azureThrottledRequestsTotal.WithLabelValues(http.MethodGet)) - throttledBefore; throttled != float64(expectedThrottled) {
+			t.Fatalf("TestAzureThrottle(%d): expected %d throttled requests, got %v", i, expectedThrottled, throttled)
+		}
+		if remaining := testutil.ToFloat64(azureRateLimitRemaining.WithLabelValues("subscription-reads")); remaining != float64(12000-requests) {
+			t.Fatalf("TestAzureThrottle(%d): expected remaining reads %d, got %v", i, 12000-requests, remaining)
+		}
+		if remaining := testutil.ToFloat64(azureRateLimitRemaining.WithLabelValues("resource:Microsoft.Network/GetNetworkInterface3Min")); remaining != 100 {
+			t.Fatalf("TestAzureThrottle(%d): expected remaining resource reads 100, got %v", i, remaining)
+		}
+	}
+}
+
+// TestAzureThrottleWait checks that, while ARM throttles a kind of requests,
+// they wait for the end of the throttling and the others don't.
+func TestAzureThrottleWait(t *testing.T) {
+	throttle := &azureThrottle{}
+	throttle.throttled(azureThrottleWrites, 200*time.Millisecond)
+
+	request := func(kind string, timeout time.Duration) (time.Duration, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		r, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://management.azure.com/", nil)
+		start := time.Now()
+		err := throttle.wait(r, kind)
+		return time.Since(start), err
+	}
+	if elapsed, err := request(azureThrottleReads, time.Second); err != nil || elapsed > 100*time.Millisecond {
+		t.Fatalf("TestAzureThrottleWait: expected reads not to wait, waited %v, err: %v", elapsed, err)
+	}
+	if elapsed, err := request(azureThrottleWrites, 10*time.Millisecond); err == nil || elapsed > 100*time.Millisecond {
+		t.Fatalf("TestAzureThrottleWait: expected writes to fail right away past their deadline, waited %v, err: %v", elapsed, err)
+	}
+	if elapsed, err := request(azureThrottleWrites, time.Second); err != nil || elapsed < 100*time.Millisecond {
+		t.Fatalf("TestAzureThrottleWait: expected writes to wait, waited %v, err: %v", elapsed, err)
+	}
+}
@@ -0,0 +1,12 @@
+package cloudprovider
+
+import (
+	"net/http"
+)
+
+// newTransport returns the HTTP client of the ARM clients and credentials, see
+// newHTTPClient: disconnected clusters reach ARM through the cluster-wide
+// proxy.
+func (a *Azure) newTransport() (*http.Client, error) {
+	return newHTTPClient(a.cfg.ConfigDir)
+}
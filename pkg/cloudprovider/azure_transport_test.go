@@ -0,0 +1,60 @@
+package cloudprovider
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/openshift/cloud-network-config-controller/pkg/tracing"
+)
+
+func TestAzureNewTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	serverCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	tcs := []struct {
+		// caBundle is the content of ca-bundle.pem, which doesn't exist if
+		// nil.
+		caBundle  []byte
+		expectErr bool
+		trusted   bool
+	}{
+		{},
+		{caBundle: []byte{}},
+		{caBundle: serverCA, trusted: true},
+		{caBundle: []byte("not a certificate"), expectErr: true},
+	}
+	for i, tc := range tcs {
+		dir := t.TempDir()
+		if tc.caBundle != nil {
+			if err := ioutil.WriteFile(filepath.Join(dir, "ca-bundle.pem"), tc.caBundle, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		a := &Azure{CloudProvider: CloudProvider{cfg: CloudProviderConfig{ConfigDir: dir}}}
+		client, err := a.newTransport()
+		if tc.expectErr {
+			if err == nil {
+				t.Fatalf("TestAzureNewTransport(%d): expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestAzureNewTransport(%d): received unexpected error, err: %v", i, err)
+		}
+		if client.Transport.(*tracing.Transport).Base.(*http.Transport).Proxy == nil {
+			t.Fatalf("TestAzureNewTransport(%d): expected the transport to go through the proxy of the environment", i)
+		}
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if tc.trusted != (err == nil) {
+			t.Fatalf("TestAzureNewTransport(%d): expected the server to be trusted: %v, err: %v", i, tc.trusted, err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v4"
+)
+
+// azureScaleSetInstance is a VM instance of a scale set in Uniform
+// orchestration mode, whose network interfaces are owned by the scale set
+// rather than standalone resources. Its providerID looks like:
+//
+//	azure:///subscriptions/<subscription>/resourceGroups/<resource group>/providers/Microsoft.Compute/virtualMachineScaleSets/<scale set>/virtualMachines/<instance ID>
+//
+// The instances of scale sets in Flexible orchestration mode are standalone
+// VMs, with standalone network interfaces, and the providerID of any VM.
+type azureScaleSetInstance struct {
+	scaleSet   string
+	instanceID string
+}
+
+// parseAzureScaleSetInstance returns the scale set instance of the
+// providerID, or nil if it's the providerID of a standalone VM.
+func parseAzureScaleSetInstance(providerID string) (*azureScaleSetInstance, error) {
+	providerData := strings.Split(providerID, "/")
+	switch {
+	case len(providerData) == 11:
+		return nil, nil
+	case len(providerData) == 13 && strings.EqualFold(providerData[9], "virtualMachineScaleSets") && strings.EqualFold(providerData[11], "virtualMachines"):
+		return &azureScaleSetInstance{scaleSet: providerData[10], instanceID: providerData[12]}, nil
+	default:
+		return nil, UnexpectedURIError(providerID)
+	}
+}
+
+// parseAzureScaleSetNetworkInterfaceID returns the scale set, instance ID and
+// name of the network interface ID of a scale set instance, which looks like:
+//
+//	/subscriptions/<subscription>/resourceGroups/<resource group>/providers/Microsoft.Compute/virtualMachineScaleSets/<scale set>/virtualMachines/<instance ID>/networkInterfaces/<name>
+//
+// ok is false for the IDs of standalone network interfaces.
+func parseAzureScaleSetNetworkInterfaceID(id string) (scaleSet, instanceID, name string, ok bool) {
+	data := strings.Split(id, "/")
+	if len(data) != 13 || !strings.EqualFold(data[7], "virtualMachineScaleSets") || !strings.EqualFold(data[9], "virtualMachines") {
+		return "", "", "", false
+	}
+	return data[8], data[10], data[12], true
+}
+
+func (a *Azure) getScaleSetInstance(ctx context.Context, scaleSetInstance *azureScaleSetInstance) (*armcompute.VirtualMachineScaleSetVM, error) {
+	callCtx, cancel := context.WithTimeout(ctx, defaultAzureOperationTimeout)
+	defer cancel()
+	result, err := a.vmssVMClient.Get(callCtx, a.resourceGroup, scaleSetInstance.scaleSet, scaleSetInstance.instanceID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &result.VirtualMachineScaleSetVM, nil
+}
+
+// releaseScaleSetPrivateIP removes the IP configuration from the network
+// interface of the scale set instance. The network interfaces of scale set
+// instances can't be updated, the network profile configuration of the
+// instance, which they're generated from, is updated instead.
+func (a *Azure) releaseScaleSetPrivateIP(ctx context.Context, scaleSetInstance *azureScaleSetInstance, networkInterface armnetwork.Interface, ipConfiguration *armnetwork.InterfaceIPConfiguration) error {
+	// Updates of the network interface must be ordered, see
+	// networkInterfaceLocks.
+	defer a.networkInterfaceLocks.Lock(strings.ToLower(*networkInterface.ID))()
+	var ipConfigurationName string
+	if ipConfiguration.Name != nil {
+		ipConfigurationName = *ipConfiguration.Name
+	}
+	instance, err := a.getScaleSetInstance(ctx, scaleSetInstance)
+	if err != nil {
+		return err
+	}
+	if instance.Properties == nil || instance.Properties.NetworkProfileConfiguration == nil {
+		return fmt.Errorf("scale set instance %s_%s has no network profile configuration", scaleSetInstance.scaleSet, scaleSetInstance.instanceID)
+	}
+	released := false
+	for _, networkConfiguration := range instance.Properties.NetworkProfileConfiguration.NetworkInterfaceConfigurations {
+		if networkConfiguration.Name == nil || !strings.EqualFold(*networkConfiguration.Name, *networkInterface.Name) || networkConfiguration.Properties == nil {
+			continue
+		}
+		keepIPConfigurations := []*armcompute.VirtualMachineScaleSetIPConfiguration{}
+		for _, ipConfiguration := range networkConfiguration.Properties.IPConfigurations {
+			if ipConfiguration.Name != nil && strings.EqualFold(*ipConfiguration.Name, ipConfigurationName) {
+				released = true
+				continue
+			}
+			keepIPConfigurations = append(keepIPConfigurations, ipConfiguration)
+		}
+		networkConfiguration.Properties.IPConfigurations = keepIPConfigurations
+	}
+	if !released {
+		return fmt.Errorf("IP configuration %s of IP address %s not found in the network profile configuration of scale set instance %s_%s",
+			ipConfigurationName, *ipConfiguration.Properties.PrivateIPAddress, scaleSetInstance.scaleSet, scaleSetInstance.instanceID)
+	}
+	callCtx, cancel := context.WithTimeout(ctx, defaultAzureOperationTimeout)
+	defer cancel()
+	poller, err := a.vmssVMClient.BeginUpdate(callCtx, a.resourceGroup, scaleSetInstance.scaleSet, scaleSetInstance.instanceID, *instance, nil)
+	if err != nil {
+		return err
+	}
+	// No specified timeout, like for network interface updates.
+	_, err = poller.PollUntilDone(ctx, nil)
+	return err
+}
@@ -0,0 +1,100 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParseAzureScaleSetInstance(t *testing.T) {
+	tcs := []struct {
+		providerID string
+		expected   *azureScaleSetInstance
+		expectErr  bool
+	}{
+		{providerID: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/worker-0"},
+		{
+			providerID: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/workers/virtualMachines/3",
+			expected:   &azureScaleSetInstance{scaleSet: "workers", instanceID: "3"},
+		},
+		{providerID: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/availabilitySets/workers/virtualMachines/3", expectErr: true},
+		{providerID: "aws:///us-east-1a/i-0123456789", expectErr: true},
+	}
+	for i, tc := range tcs {
+		scaleSetInstance, err := parseAzureScaleSetInstance(tc.providerID)
+		if tc.expectErr {
+			if err == nil {
+				t.Fatalf("TestParseAzureScaleSetInstance(%d): expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestParseAzureScaleSetInstance(%d): received unexpected error, err: %v", i, err)
+		}
+		if fmt.Sprint(scaleSetInstance) != fmt.Sprint(tc.expected) {
+			t.Fatalf("TestParseAzureScaleSetInstance(%d): expected %v, got %v", i, tc.expected, scaleSetInstance)
+		}
+	}
+}
+
+func TestAzureScaleSetInstance(t *testing.T) {
+	instancePath := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/workers/virtualMachines/3"
+	networkInterfaceID := instancePath + "/networkInterfaces/workers-nic"
+	ipConfigurations := []string{"ipconfig1", "worker-3_10.0.0.10"}
+	var updatedIPConfigurations []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Resource IDs are case-insensitive, and the SDK's paths differ in
+		// case from the IDs ARM returns.
+		switch {
+		case r.Method == http.MethodGet && strings.EqualFold(r.URL.Path, networkInterfaceID):
+			fmt.Fprintf(w, `{"id": "%s", "name": "workers-nic", "properties": {"ipConfigurations": [
+				{"name": "ipconfig1", "properties": {"privateIPAddress": "10.0.0.4", "primary": true}},
+				{"name": "worker-3_10.0.0.10", "properties": {"privateIPAddress": "10.0.0.10"}}]}}`, networkInterfaceID)
+		case r.Method == http.MethodGet && strings.EqualFold(r.URL.Path, instancePath):
+			names := []string{}
+			for _, name := range ipConfigurations {
+				names = append(names, fmt.Sprintf(`{"name": "%s", "properties": {}}`, name))
+			}
+			fmt.Fprintf(w, `{"id": "%s", "properties": {
+				"networkProfile": {"networkInterfaces": [{"id": "%s", "properties": {"primary": true}}]},
+				"networkProfileConfiguration": {"networkInterfaceConfigurations": [{"name": "workers-nic", "properties": {"primary": true, "ipConfigurations": [%s]}}]}}}`,
+				instancePath, networkInterfaceID, strings.Join(names, ","))
+		case r.Method == http.MethodPut && strings.EqualFold(r.URL.Path, instancePath):
+			var instance armcompute.VirtualMachineScaleSetVM
+			if err := json.NewDecoder(r.Body).Decode(&instance); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			for _, ipConfiguration := range instance.Properties.NetworkProfileConfiguration.NetworkInterfaceConfigurations[0].Properties.IPConfigurations {
+				updatedIPConfigurations = append(updatedIPConfigurations, *ipConfiguration.Name)
+			}
+			fmt.Fprintf(w, `{"id": "%s", "properties": {"provisioningState": "Succeeded"}}`, instancePath)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	a := newFakeAzure(t, server, CloudProviderConfig{})
+	node := &corev1.Node{}
+	node.Name = "worker-3"
+	node.Spec.ProviderID = "azure://" + instancePath
+
+	if err := a.AssignPrivateIP(context.Background(), net.ParseIP("10.0.0.11"), node); err == nil {
+		t.Fatalf("TestAzureScaleSetInstance: expected assigning a static private IP address to fail")
+	}
+	if err := a.ReleasePrivateIP(context.Background(), net.ParseIP("10.0.0.10"), node); err != nil {
+		t.Fatalf("TestAzureScaleSetInstance: received unexpected error, err: %v", err)
+	}
+	if fmt.Sprint(updatedIPConfigurations) != "[ipconfig1]" {
+		t.Fatalf("TestAzureScaleSetInstance: expected IP configurations [ipconfig1], got %v", updatedIPConfigurations)
+	}
+}
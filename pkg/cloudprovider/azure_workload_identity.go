@@ -0,0 +1,56 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"k8s.io/klog/v2"
+)
+
+// getFederatedTokenFile returns the federated token file to authenticate
+// with: the one configured, or the one named by the azure_federated_token_file
+// key of the secret, as set up for workload identity. It's empty if neither
+// is, the client secret is used then.
+func (a *Azure) getFederatedTokenFile() string {
+	if a.cfg.AzureFederatedTokenFile != "" {
+		return a.cfg.AzureFederatedTokenFile
+	}
+	tokenFile, err := a.readSecretData("azure_federated_token_file")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(tokenFile)
+}
+
+// getFederatedCredential returns a credential exchanging the federated token
+// of tokenFile, e.g. a projected service account token trusted by the
+// application's federated identity credential, as client assertion for ARM
+// access tokens of the application clientID. The token file is read again on
+// every token refresh: the kubelet rotates the token well before it expires.
+// The access tokens are refreshed automatically before they expire.
+func (a *Azure) getFederatedCredential(clientID, tenantID, tokenFile string) (azcore.TokenCredential, error) {
+	if _, err := os.Stat(tokenFile); err != nil {
+		return nil, fmt.Errorf("unable to access federated token file %s, err: %v", tokenFile, err)
+	}
+	getAssertion := func(context.Context) (string, error) {
+		token, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("unable to read federated token file %s, err: %v", tokenFile, err)
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+	credential, err := azidentity.NewClientAssertionCredential(tenantID, clientID, getAssertion, &azidentity.ClientAssertionCredentialOptions{
+		ClientOptions:            a.getCredentialOptions(),
+		DisableInstanceDiscovery: usesADFS(a.env),
+	})
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("Authenticating to Azure as application %s with federated token file %s", clientID, tokenFile)
+	return credential, nil
+}
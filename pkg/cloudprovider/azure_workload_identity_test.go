@@ -0,0 +1,80 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	azureapi "github.com/Azure/go-autorest/autorest/azure"
+)
+
+func TestAzureFederatedCredential(t *testing.T) {
+	var assertions []string
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/common/discovery/instance":
+			fmt.Fprintf(w, `{"tenant_discovery_endpoint": "%s/tenant-1/v2.0/.well-known/openid-configuration"}`, server.URL)
+			return
+		case "/tenant-1/v2.0/.well-known/openid-configuration":
+			fmt.Fprintf(w, `{"token_endpoint": "%[1]s/tenant-1/oauth2/v2.0/token", "authorization_endpoint": "%[1]s/tenant-1/oauth2/v2.0/authorize", "issuer": "%[1]s/tenant-1/v2.0"}`, server.URL)
+			return
+		}
+		r.ParseForm()
+		if r.URL.Path != "/tenant-1/oauth2/v2.0/token" || r.Form.Get("client_id") != "client-1" || r.Form.Get("client_secret") != "" ||
+			r.Form.Get("client_assertion_type") != "urn:ietf:params:oauth:client-assertion-type:jwt-bearer" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		assertions = append(assertions, r.Form.Get("client_assertion"))
+		// The access tokens expire within the refresh window, so that
+		// every request refreshes them.
+		fmt.Fprintf(w, `{"access_token": "access-%d", "token_type": "Bearer", "expires_in": 60}`, len(assertions))
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	env := azureapi.PublicCloud
+	env.ActiveDirectoryEndpoint = server.URL + "/"
+	a := &Azure{env: env, transport: fakeAzureTransport{server: server}}
+	if _, err := a.getFederatedCredential("client-1", "tenant-1", tokenFile); err == nil {
+		t.Fatalf("TestAzureFederatedCredential: expected an error for a missing token file")
+	}
+
+	if err := ioutil.WriteFile(tokenFile, []byte("token-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	credential, err := a.getFederatedCredential("client-1", "tenant-1", tokenFile)
+	if err != nil {
+		t.Fatalf("TestAzureFederatedCredential: received unexpected error, err: %v", err)
+	}
+	tcs := []struct {
+		// token is the content of the token file, rotated by the kubelet.
+		token       string
+		accessToken string
+		assertions  []string
+	}{
+		{token: "token-1\n", accessToken: "access-1", assertions: []string{"token-1"}},
+		{token: "token-2\n", accessToken: "access-2", assertions: []string{"token-1", "token-2"}},
+	}
+	for i, tc := range tcs {
+		if err := ioutil.WriteFile(tokenFile, []byte(tc.token), 0600); err != nil {
+			t.Fatal(err)
+		}
+		token, err := credential.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{env.TokenAudience + "/.default"}})
+		if err != nil {
+			t.Fatalf("TestAzureFederatedCredential(%d): received unexpected error, err: %v", i, err)
+		}
+		if token.Token != tc.accessToken {
+			t.Fatalf("TestAzureFederatedCredential(%d): expected access token %q, got %q", i, tc.accessToken, token.Token)
+		}
+		if fmt.Sprint(assertions) != fmt.Sprint(tc.assertions) {
+			t.Fatalf("TestAzureFederatedCredential(%d): expected client assertions %v, got %v", i, tc.assertions, assertions)
+		}
+	}
+}
@@ -6,24 +6,41 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
+	"github.com/openshift/cloud-network-config-controller/pkg/journal"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
 )
 
 var (
 	NoNetworkInterfaceError  = errors.New("no retrievable network interface")
 	AlreadyExistingIPError   = errors.New("the requested IP for assignment is already assigned")
 	NonExistingIPError       = errors.New("the requested IP for removal is not assigned")
+	MissingIPError           = errors.New("the assigned IP is missing on the cloud")
+	ReadOnlyError            = errors.New("the cloud provider is in read-only mode")
+	ZoneMismatchError        = errors.New("the requested IP can't be used in the zone of the node")
+	InstanceExistsError      = errors.New("the instance of the deleted node still exists")
 	UnexpectedURIErrorString = "the URI is not expected"
 )
 
+// OwnedResourcesUnsupportedError is returned by ListOwnedResources on the
+// clouds where the controller can't recognize its resources.
+var OwnedResourcesUnsupportedError = errors.New("the cloud provider can't list the resources it owns")
+
 const UserAgent = "cloud-network-config-controller"
 
 func UnexpectedURIError(uri string) error {
 	return errors.New(fmt.Sprintf("%s: %s", UnexpectedURIErrorString, uri))
 }
 
+// CloudProviderIntf is the interface of the cloud providers. The requests to
+// the cloud are sent with the ctx of the call, which carries the span they're
+// traced under, if any. Some providers bound them by their own timeouts, or
+// cancel them on shutdown, on top of it.
 type CloudProviderIntf interface {
 	// initCredentials initializes the cloud API credentials by reading the
 	// secret data which has been mounted in cloudProviderSecretLocation. The
@@ -39,20 +56,42 @@ type CloudProviderIntf interface {
 	// cluster is deployed on. NOTE: this operation is only performed against
 	// the first network interface defined for the VM. It will return an
 	// AlreadyExistingIPError if the IP provided is already associated with the
-	// node, it's up to the caller to decide what to do with that.
-	AssignPrivateIP(ip net.IP, node *corev1.Node) error
+	// node, it's up to the caller to decide what to do with that. It returns a
+	// ZoneMismatchError if the IP can't be used in the zone of the node, the
+	// assignment would succeed but the traffic would break (Azure).
+	AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error
 
 	// TODO(dulek): This comment
 	AllowsMovePrivateIP() bool
 
 	// TODO(dulek): This comment
-	MovePrivateIP(ip net.IP, nodeToAdd *corev1.Node, nodeToDel *corev1.Node) error
+	MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd *corev1.Node, nodeToDel *corev1.Node) error
 
 	// ReleasePrivateIP attempts to releasing the IP address provided from the
 	// VM instance corresponding to the corev1.Node provided on the cloud the
 	// cluster is deployed on. NOTE: this operation is only performed against
 	// the first network interface defined for the VM.
-	ReleasePrivateIP(ip net.IP, node *corev1.Node) error
+	ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error
+
+	// AssignPrivateIPs assigns the IP addresses provided to the node, as
+	// AssignPrivateIP would one by one, and returns the error of each by
+	// index. Clouds batching concurrent changes to the same network
+	// interface (AWS, Azure, GCP, if their batch window is set) apply them
+	// all at once, in a single call, without waiting for their batch window;
+	// others assign them in turn.
+	AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error
+
+	// ReleasePrivateIPs is AssignPrivateIPs' counterpart for
+	// ReleasePrivateIP.
+	ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error
+
+	// BatchesAssignPrivateIPs returns true if AssignPrivateIPs applies the
+	// IP addresses in a single call, rather than in turn.
+	BatchesAssignPrivateIPs() bool
+
+	// BatchesReleasePrivateIPs is BatchesAssignPrivateIPs' counterpart for
+	// ReleasePrivateIPs.
+	BatchesReleasePrivateIPs() bool
 
 	// GetNodeEgressIPConfiguration retrieves the egress IP configuration for
 	// the node, following the convention the cloud uses. This means
@@ -62,21 +101,188 @@ type CloudProviderIntf interface {
 	// (GCP) or ID (Azure, AWS). Note: this function should only be called when
 	// no egress IPs have been added to the node, it will return an incorrect
 	// "egress IP capacity" otherwise
-	GetNodeEgressIPConfiguration(node *corev1.Node) ([]*NodeEgressIPConfiguration, error)
+	GetNodeEgressIPConfiguration(ctx context.Context, node *corev1.Node) ([]*NodeEgressIPConfiguration, error)
+
+	// CleanupNode releases all private IPs of a node which was deleted. This
+	// is only needed on clouds which keep state for private IPs (OpenStack)
+	// which is not deleted together with the VM instance, it's a no-op on all
+	// others. It returns an InstanceExistsError while the instance of the
+	// node still exists.
+	CleanupNode(ctx context.Context, node *corev1.Node) error
+
+	// VerifyPrivateIP verifies on the cloud that the IP address assigned to
+	// the node is not only accepted by the cloud's control plane, but also
+	// programmed on the VM's interface. It returns an error describing what
+	// is off otherwise, wrapping a MissingIPError if the IP address was
+	// removed from the interface out of band (AWS, Azure). It's a no-op on
+	// clouds which don't expose anything beyond the assignment itself (GCP).
+	VerifyPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error
+
+	// ProbeReachability verifies that the IP address assigned to the node is
+	// reachable on the data plane from within the cloud. Unlike
+	// VerifyPrivateIP it changes the cloud, i.e: it adds the IP address to a
+	// load balancer pool for its health monitor to check (OpenStack), so it's
+	// refused in read-only and dry-run mode. It may take minutes, it's meant
+	// to run in the background. It returns nil on clouds where reachability
+	// can't be probed, or isn't configured to be.
+	ProbeReachability(ctx context.Context, ip net.IP, node *corev1.Node) error
+
+	// GetPrivateIPReservations returns the cloud resources created to back
+	// the assignment of the IP address to the node, i.e: the reservation
+	// ports on OpenStack. It returns nil on clouds where the assignment
+	// doesn't create any resource of its own (AWS, GCP, Azure).
+	GetPrivateIPReservations(ctx context.Context, ip net.IP, node *corev1.Node) ([]PrivateIPReservation, error)
+
+	// ListPrivateIPs returns the IP addresses the cloud actually has assigned
+	// to the node on top of its own, i.e: the secondary IPs of its network
+	// interface (AWS, Azure) or its alias IPs (GCP), regardless of whether
+	// they were assigned by us. It returns nil on clouds where those can't be
+	// enumerated (None) and an empty list if there are none, which lets the
+	// periodic resync tell both apart.
+	ListPrivateIPs(ctx context.Context, node *corev1.Node) ([]net.IP, error)
+
+	// CheckHealth performs the cheapest read-only call to the cloud API
+	// about the node, bypassing any cache, i.e: retrieves its instance. It
+	// returns an error if the cloud can't be reached or rejects the
+	// credentials, which is what the readiness probe relies on. It returns
+	// nil on clouds without an API (None).
+	CheckHealth(ctx context.Context, node *corev1.Node) error
+
+	// ListOwnedResources returns the cloud resources the controller created
+	// for assignments, which outlive them if their release or rollback
+	// failed, i.e: the reservation ports (OpenStack), the IP configurations
+	// (Azure), the secondary IP addresses of tagged network interfaces (AWS)
+	// and the alias IP ranges (GCP), each with the node of nodes it belongs
+	// to. It returns an OwnedResourcesUnsupportedError on clouds where
+	// assignments create no resource the controller can recognize as its
+	// own.
+	ListOwnedResources(ctx context.Context, nodes []*corev1.Node) ([]OwnedResource, error)
+
+	// DeleteOwnedResource deletes a resource ListOwnedResources returned. It
+	// returns a NonExistingIPError if it doesn't exist anymore.
+	DeleteOwnedResource(ctx context.Context, resource OwnedResource) error
+
+	// GetNodeNetworkInterfaces returns the sorted IDs of the network
+	// interfaces attached to the node's VM instance, on clouds where those
+	// can be attached and detached while it runs (AWS), i.e: after the
+	// node's egress IP configuration was computed. It returns nil on all
+	// others (GCP, Azure), and where they aren't tracked (OpenStack).
+	GetNodeNetworkInterfaces(ctx context.Context, node *corev1.Node) ([]string, error)
 }
 
 // CloudProviderConfig is all the command-line options needed to initialize
 // a cloud provider client.
 type CloudProviderConfig struct {
-	PlatformType  string // one of AWS, Azure, GCP
+	PlatformType  string // one of AWS, Azure, GCP, OpenStack, IBMCloud, PowerVS, VSphere, oVirt, AlibabaCloud, OCI, Nutanix, None, EquinixMetal, Hetzner
 	APIOverride   string // override the API endpoint URL. Used by all platforms.
 	CredentialDir string // override the default credential directory
 	ConfigDir     string // override the default config directory
+	ReadOnly      bool   // refuse all changes on the cloud, only log them
+	DryRun        bool   // refuse all changes on the cloud like ReadOnly, planning assignments against the nodes' egress IP configuration
+	ClusterID     string // ID of the cluster, used to describe resources created on the cloud
+
+	MaxInflightCloudMutations        int // maximum number of concurrent changes on the cloud, unlimited if 0
+	MaxInflightCloudMutationsPerNode int // maximum number of concurrent changes on the cloud per node, unlimited if 0
+
+	Region              string // region, only used by AWS
+	AWSCAOverride       string
+	AWSIMDSFallback     bool // resolve the region and the local instance through the instance metadata service (IMDSv2)
+	AWSPrefixDelegation bool // assign IPv4 addresses out of /28 prefixes delegated to the network interface
+
+	AWSEndpointOverrides string // comma separated <service>=<URL> endpoint overrides, service one of: ec2, sts
+
+	AWSElasticIPTagKey string // associate the Elastic IP tagged <key>=<egress IP> with every IPv4 egress IP
+	AWSElasticIPPool   string // associate an Elastic IP of this public IPv4 (BYOIP) pool with every IPv4 egress IP
+
+	AWSNetworkInterfaceSelector string // select the network interface of multi-ENI instances: subnet=<ID>, security-group=<ID> or tag=<key>[=<value>]
+
+	AWSAssignmentBatchWindow time.Duration // wait that long for concurrent assignments to the same network interface, to assign them in a single call; disabled if 0
+	AWSMaxRequestRate        float64       // maximum rate of EC2 API requests per second, lowered adaptively while throttled; unlimited if 0
+	AWSRetryMode             string        // retry mode of the AWS SDK, one of: standard, adaptive; the SDK's default if empty
+	AWSDescribeCacheTTL      time.Duration // reuse the descriptions of instances that long, unless the controller changes them; disabled if 0
+
+	AWSTagResources bool   // tag the network interfaces and Elastic IPs changed with the cluster ID, the controller and the node
+	AWSResourceTags string // comma separated <key>=<value> extra tags of the network interfaces and Elastic IPs changed
+
+	AWSRoleARN              string // IAM role to assume instead of using the credentials of the secret directly
+	AWSRoleExternalID       string // external ID to pass when assuming AWSRoleARN
+	AWSWebIdentityTokenFile string // web identity token to assume AWSRoleARN with, instead of the credentials of the secret
+
+	AWSNetworkRoleARN        string // IAM role of the account owning the (shared) VPC, assumed to look up subnets; disabled if empty
+	AWSNetworkRoleExternalID string // external ID to pass when assuming AWSNetworkRoleARN
+
+	GCPNetworkProjectID   string // project of the subnets (shared VPC host project) if their URLs don't name it; the instance's project if empty
+	GCPFederatedTokenFile string // subject token file of the external account (workload identity federation) credentials, instead of the one they name
+
+	GCPNetworkInterfaceSelector  string        // select the network interface of multi-NIC instances: subnetwork=<URL>, name=<pattern> or network=<URL>
+	GCPUpdateBatchWindow         time.Duration // wait that long for concurrent changes to the same network interface, to apply them in a single operation; disabled if 0
+	GCPAliasIPRangesPerInterface int           // alias IP ranges a network interface can hold, whatever their IP family; 10 if 0
+
+	GCPOperationPollInterval    time.Duration // first interval between polls of the zone operations, doubling after every poll; 1s if 0
+	GCPOperationPollMaxInterval time.Duration // longest interval between polls of the zone operations; 10s if 0
+	GCPOperationTimeout         time.Duration // deadline of the zone operations, once sent; 5m if 0
+
+	GCPLabelResources bool   // label the instances whose network interfaces are changed with the cluster ID and the controller
+	GCPResourceLabels string // comma separated <key>=<value> extra labels of the instances whose network interfaces are changed
+
+	AzureEnvironment             string // The azure "environment", which is a set of API endpoints
+	AzureEnvironmentFile         string // JSON file describing the endpoints of the AzureStackCloud environment; AZURE_ENVIRONMENT_FILEPATH if empty
+	AzureFederatedTokenFile      string // federated token (workload identity) to exchange for ARM credentials, instead of the client secret of the secret
+	AzureManagedIdentityClientID string // client ID of the user-assigned managed identity to authenticate with through IMDS, instead of the secret's application
+
+	AzureNetworkInterfaceSelector string        // select the network interface of multi-NIC VMs: subnet=<ID>, name=<pattern> or tag=<key>[=<value>]
+	AzureUpdateBatchWindow        time.Duration // wait that long for concurrent changes to the same network interface, to apply them in a single update; disabled if 0
+
+	AzurePublicIPTagKey     string // associate the public IP tagged <key>=<egress IP> with every egress IP
+	AzurePublicIPNamePrefix string // associate the public IP named <prefix><egress IP> with every egress IP
+
+	AzureTagResources bool   // tag the network interfaces and public IPs changed with the cluster ID, the controller and the node
+	AzureResourceTags string // comma separated <key>=<value> extra tags of the network interfaces and public IPs changed
 
-	Region        string // region, only used by AWS
-	AWSCAOverride string
+	OpenStackTokenCacheDir    string // directory in which the keystone token is persisted across restarts, disabled if empty
+	OpenStackStrictAZMatching bool   // never assign egress IPs on networks outside of the server's availability zone
 
-	AzureEnvironment string // The azure "environment", which is a set of API endpoints
+	OpenStackPortSecurityDisabledPolicy string        // how to handle networks with port security disabled, one of: fail, skip
+	OpenStackRequestTimeout             time.Duration // timeout of every call to the OpenStack API, all pages of a listing included, disabled if 0
+	OpenStackIncludeExternalNetworks    bool          // report node ports on external (router:external) networks as egress IP capable
+	OpenStackPinnedSubnets              string        // comma separated IDs of the subnets to use on networks with several subnets of the same address family
+	OpenStackStandbyAssignments         bool          // pre-allow egress IPs on the standby server designated by the node's annotation
+
+	OpenStackJournalStore journal.Store // store persisting the pending releases of reservation ports across restarts, disabled if nil
+
+	OpenStackVerificationPool string // ID of an Octavia pool with a health monitor, egress IPs are verified reachable through once assigned; disabled if empty
+	OpenStackVerificationPort int    // port of the verification pool members, for TCP and HTTP health monitors; unused by PING ones if 0
+
+	IBMCloudRegion          string // region of the VPC API endpoint, e.g. us-south; required unless APIOverride is set
+	IBMCloudIAMURL          string // IAM endpoint the API key is exchanged for access tokens at; https://iam.cloud.ibm.com if empty
+	IBMCloudIPsPerInterface int    // secondary IP addresses a virtual network interface can hold; 10 if 0
+
+	PowerVSRegion           string        // region of the Power VS API endpoint, e.g. us-south; required unless APIOverride is set
+	PowerVSCloudInstanceCRN string        // CRN of the Power VS workspace of the cluster
+	PowerVSIPsPerInstance   int           // egress IPs a PVM instance can hold; 8 if 0
+	PowerVSOperationTimeout time.Duration // deadline of attaching and detaching network ports, once requested; 10m if 0
+
+	VSphereNSXTManagerURL string // URL of the NSX-T manager of the segments of the VMs, e.g. https://nsxt.example.com
+
+	OVirtMachineNetworks string // comma separated CIDRs of the machine networks, which oVirt networks don't know
+
+	AlibabaCloudRegion    string // region of the ECS and VPC API endpoints, e.g. cn-hangzhou
+	AlibabaCloudVPCAPIURL string // URL of the VPC API, overriding the one of the region, as APIOverride does for the ECS API
+
+	OCIRegion            string // region of the Core Services API and authentication service endpoints, e.g. us-ashburn-1
+	OCIInstancePrincipal bool   // authenticate as the instance the controller runs on rather than with the API key of the secret
+	OCIShapeIPLimits     string // comma separated <shape>=<limit> addresses a VNIC of instances of the shape can hold per address family; 32 for other shapes
+
+	NutanixPrismCentralURL string        // URL of Prism Central, e.g. https://prism-central.example.com:9440
+	NutanixTaskTimeout     time.Duration // deadline of the tasks of the changes, once requested; 10m if 0
+
+	NoneCapacity int // egress IPs reported per node, whatever their address family, on platforms without a cloud API; 64 if 0
+
+	// ShutdownContext is cancelled when the controller shuts down, abandoning
+	// the waits for cloud operations which complete on their own; never if nil.
+	// The requests themselves are sent on the context of the calls, but on
+	// OpenStack, whose requests are all cancelled on shutdown.
+	ShutdownContext context.Context
 }
 
 type CloudProvider struct {
@@ -108,9 +314,224 @@ type NodeEgressIPConfiguration struct {
 	Interface string   `json:"interface"`
 	IFAddr    ifAddr   `json:"ifaddr"`
 	Capacity  capacity `json:"capacity"`
+	// SecondaryIFAddrs are the CIDRs of the other subnets the interface has
+	// IP addresses on, next to the ones of IFAddr. Egress IPs are only
+	// assigned on the subnets of IFAddr.
+	SecondaryIFAddrs []string `json:"secondaryIfaddrs,omitempty"`
+	// MAC and VLAN allow correlating the interface with the node's netdevs.
+	// They are left empty where the cloud doesn't expose them.
+	MAC  string `json:"mac,omitempty"`
+	VLAN int    `json:"vlan,omitempty"`
+}
+
+// PrivateIPReservation is a cloud resource backing the assignment of an IP
+// address to a node.
+type PrivateIPReservation struct {
+	// ID is the ID of the resource on the cloud.
+	ID string `json:"id"`
+	// Subnet is the ID of the subnet the IP address is reserved on.
+	Subnet string `json:"subnet,omitempty"`
+}
+
+// OwnedResource is a cloud resource the controller created for the assignment
+// of an IP address, see ListOwnedResources.
+type OwnedResource struct {
+	// ID is the ID of the resource on the cloud.
+	ID string
+	// Kind names the type of the resource in logs, e.g. neutron port.
+	Kind string
+	// IP is the IP address the resource was created for.
+	IP net.IP
+	// Node is the name of the node the resource belongs to, empty if it
+	// belongs to none of the nodes it was listed for.
+	Node string
+	// ProviderID is the provider ID of the instance the resource was created
+	// for, set on the clouds where it outlives the instance, see CleanupNode.
+	ProviderID string
+	// node is the node the resource belongs to, for the clouds deleting it
+	// through the node's instance.
+	node *corev1.Node
+}
+
+// eachPrivateIP applies change to each IP address in turn, returning the
+// error of each by index. It implements AssignPrivateIPs and
+// ReleasePrivateIPs on the clouds which change IP addresses one at a time.
+func eachPrivateIP(ctx context.Context, ips []net.IP, node *corev1.Node, change func(context.Context, net.IP, *corev1.Node) error) []error {
+	errs := make([]error, len(ips))
+	for i, ip := range ips {
+		errs[i] = change(ctx, ip, node)
+	}
+	return errs
+}
+
+// concurrentPrivateIPs applies change to all IP addresses concurrently,
+// returning the error of each by index, for the clouds coalescing concurrent
+// changes to the same network interface into a single call.
+func concurrentPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node, change func(context.Context, net.IP, *corev1.Node) error) []error {
+	errs := make([]error, len(ips))
+	wg := &sync.WaitGroup{}
+	for i, ip := range ips {
+		wg.Add(1)
+		go func(i int, ip net.IP) {
+			defer wg.Done()
+			errs[i] = change(ctx, ip, node)
+		}(i, ip)
+	}
+	wg.Wait()
+	return errs
+}
+
+// batchCalls tracks the IP addresses of the AssignPrivateIPs and
+// ReleasePrivateIPs calls in progress, on the clouds batching concurrent
+// changes to the same network interface. The IP addresses of a call were
+// already collected by the caller, so the batches they join don't wait for the
+// batch window, but only for every IP address of the call to have joined its
+// batch, or to have been applied without one.
+type batchCalls struct {
+	sync.Mutex
+	pending map[string]*batchCall
+}
+
+// batchCall is an AssignPrivateIPs or ReleasePrivateIPs call in progress.
+type batchCall struct {
+	// joining counts the IP addresses which didn't join a batch yet.
+	joining sync.WaitGroup
+	joined  map[string]bool
+}
+
+// apply applies change to each IP address concurrently, returning the error
+// of each by index, see batchCalls.
+func (b *batchCalls) apply(ctx context.Context, ips []net.IP, node *corev1.Node, change func(context.Context, net.IP, *corev1.Node) error) []error {
+	call := &batchCall{joined: map[string]bool{}}
+	b.Lock()
+	if b.pending == nil {
+		b.pending = map[string]*batchCall{}
+	}
+	for _, ip := range ips {
+		if _, ok := b.pending[ip.String()]; !ok {
+			b.pending[ip.String()] = call
+			call.joining.Add(1)
+		}
+	}
+	b.Unlock()
+	defer func() {
+		b.Lock()
+		defer b.Unlock()
+		for _, ip := range ips {
+			if b.pending[ip.String()] == call {
+				delete(b.pending, ip.String())
+			}
+		}
+	}()
+	return concurrentPrivateIPs(ctx, ips, node, func(ctx context.Context, ip net.IP, node *corev1.Node) error {
+		// The IP address may be applied without joining a batch.
+		defer b.join(ip)
+		return change(ctx, ip, node)
+	})
+}
+
+// join records that ip joined its batch.
+func (b *batchCalls) join(ip net.IP) {
+	b.Lock()
+	defer b.Unlock()
+	call, ok := b.pending[ip.String()]
+	if ok && !call.joined[ip.String()] {
+		call.joined[ip.String()] = true
+		call.joining.Done()
+	}
+}
+
+// wait waits before sending the batch ip opened: for the window, unless ip
+// belongs to a call, for all IP addresses of the call to join their batch then.
+func (b *batchCalls) wait(ip net.IP, window time.Duration) {
+	b.Lock()
+	call, ok := b.pending[ip.String()]
+	b.Unlock()
+	if !ok {
+		time.Sleep(window)
+		return
+	}
+	b.join(ip)
+	call.joining.Wait()
+}
+
+// noOwnedResources implements ListOwnedResources and DeleteOwnedResource on
+// the clouds where the controller can't recognize its resources. Their
+// CloudProviderIntf implementations embed it.
+type noOwnedResources struct{}
+
+// ListOwnedResources returns an OwnedResourcesUnsupportedError.
+func (noOwnedResources) ListOwnedResources(ctx context.Context, nodes []*corev1.Node) ([]OwnedResource, error) {
+	return nil, OwnedResourcesUnsupportedError
+}
+
+// DeleteOwnedResource wraps an OwnedResourcesUnsupportedError, ListOwnedResources
+// returns no resource.
+func (noOwnedResources) DeleteOwnedResource(ctx context.Context, resource OwnedResource) error {
+	return fmt.Errorf("cannot delete %s %s: %w", resource.Kind, resource.ID, OwnedResourcesUnsupportedError)
+}
+
+// normalizeMAC returns mac in the format used by the kernel, lower case and
+// colon separated. It's returned as is if it can't be parsed.
+func normalizeMAC(mac string) string {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return mac
+	}
+	return hw.String()
 }
 
 func NewCloudProviderClient(cfg CloudProviderConfig) (CloudProviderIntf, error) {
+	cloudProviderIntf, platformType, err := newPlatformCloudProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	// The in-memory cloud is returned as is, it's shared by all clients.
+	if platformType != platformTypeInMemory {
+		cloudProviderIntf = &instrumentedCloudProvider{
+			CloudProviderIntf: cloudProviderIntf,
+			provider:          string(platformType),
+		}
+	}
+	if cfg.MaxInflightCloudMutations > 0 || cfg.MaxInflightCloudMutationsPerNode > 0 {
+		cloudProviderIntf = newLimitedCloudProvider(cloudProviderIntf, cfg.MaxInflightCloudMutations, cfg.MaxInflightCloudMutationsPerNode)
+	}
+	if cfg.DryRun {
+		klog.Info("Running in dry-run mode, changes will be planned but not performed on the cloud")
+		cloudProviderIntf = newDryRunCloudProvider(cloudProviderIntf)
+	} else if cfg.ReadOnly {
+		klog.Info("Running in read-only mode, no changes will be performed on the cloud")
+		cloudProviderIntf = &readOnlyCloudProvider{
+			CloudProviderIntf: cloudProviderIntf,
+		}
+	}
+	return cloudProviderIntf, cloudProviderIntf.initCredentials()
+}
+
+// NewCredentialValidationClient returns a read-only client of the platform,
+// authenticated with the credentials of cfg, to validate them before the
+// controller restarts with them. Unlike NewCloudProviderClient it's neither
+// instrumented nor limited, and it starts no background work: the OpenStack
+// token cache, journal of pending releases and verification pool are left out.
+func NewCredentialValidationClient(cfg CloudProviderConfig) (CloudProviderIntf, error) {
+	cfg.ReadOnly = true
+	cfg.DryRun = false
+	cfg.OpenStackTokenCacheDir = ""
+	cfg.OpenStackJournalStore = nil
+	cfg.OpenStackVerificationPool = ""
+	cloudProviderIntf, _, err := newPlatformCloudProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cloudProviderIntf = &readOnlyCloudProvider{
+		CloudProviderIntf: cloudProviderIntf,
+	}
+	return cloudProviderIntf, cloudProviderIntf.initCredentials()
+}
+
+// newPlatformCloudProvider returns the uninitialized client of the platform of
+// cfg, or the in-memory cloud if requested, along with its platform type.
+func newPlatformCloudProvider(cfg CloudProviderConfig) (CloudProviderIntf, string, error) {
 	var cloudProviderIntf CloudProviderIntf
 
 	// Initialize a separate context from the main context, rationale: cloud
@@ -125,7 +546,20 @@ func NewCloudProviderClient(cfg CloudProviderConfig) (CloudProviderIntf, error)
 		cfg: cfg,
 	}
 
-	switch cfg.PlatformType {
+	// The in-memory cloud replaces the platform's when requested, for testing
+	// the controllers on any cluster.
+	platformType := cfg.PlatformType
+	spec, fake := os.LookupEnv(FakeCloudProviderEnvVar)
+	if fake {
+		platformType = platformTypeInMemory
+	}
+	switch platformType {
+	case platformTypeInMemory:
+		inMemory, err := newSharedInMemoryCloudProvider(spec)
+		if err != nil {
+			return nil, "", fmt.Errorf("error parsing %s, err: %v", FakeCloudProviderEnvVar, err)
+		}
+		cloudProviderIntf = inMemory
 	case PlatformTypeAzure:
 		cloudProviderIntf = &Azure{
 			CloudProvider: cp,
@@ -142,10 +576,68 @@ func NewCloudProviderClient(cfg CloudProviderConfig) (CloudProviderIntf, error)
 		cloudProviderIntf = &OpenStack{
 			CloudProvider: cp,
 		}
+	case PlatformTypeIBMCloud:
+		cloudProviderIntf = &IBMCloud{
+			CloudProvider: cp,
+		}
+	case PlatformTypePowerVS:
+		cloudProviderIntf = &PowerVS{
+			CloudProvider: cp,
+		}
+	case PlatformTypeVSphere:
+		cloudProviderIntf = &VSphere{
+			CloudProvider: cp,
+		}
+	case PlatformTypeOVirt:
+		cloudProviderIntf = &OVirt{
+			CloudProvider: cp,
+		}
+	case PlatformTypeAlibabaCloud:
+		cloudProviderIntf = &AlibabaCloud{
+			CloudProvider: cp,
+		}
+	case PlatformTypeOCI:
+		cloudProviderIntf = &OCI{
+			CloudProvider: cp,
+		}
+	case PlatformTypeNutanix:
+		cloudProviderIntf = &Nutanix{
+			CloudProvider: cp,
+		}
+	case PlatformTypeNone:
+		cloudProviderIntf = &None{
+			CloudProvider: cp,
+		}
+	case PlatformTypeEquinixMetal:
+		cloudProviderIntf = &EquinixMetal{
+			CloudProvider: cp,
+		}
+	case PlatformTypeHetzner:
+		cloudProviderIntf = &Hetzner{
+			CloudProvider: cp,
+		}
 	default:
-		return nil, fmt.Errorf("unsupported cloud provider platform type: %s", cfg.PlatformType)
+		return nil, "", fmt.Errorf("unsupported cloud provider platform type: %s", platformType)
 	}
-	return cloudProviderIntf, cloudProviderIntf.initCredentials()
+	return cloudProviderIntf, platformType, nil
+}
+
+// BatchesAssignPrivateIPs returns false, AssignPrivateIPs assigns the IP
+// addresses in turn unless the cloud batches them.
+func (c *CloudProvider) BatchesAssignPrivateIPs() bool {
+	return false
+}
+
+// BatchesReleasePrivateIPs returns false, ReleasePrivateIPs releases the IP
+// addresses in turn unless the cloud batches them.
+func (c *CloudProvider) BatchesReleasePrivateIPs() bool {
+	return false
+}
+
+// ProbeReachability returns nil, only OpenStack probes reachability, through
+// an Octavia pool.
+func (c *CloudProvider) ProbeReachability(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	return nil
 }
 
 func (c *CloudProvider) readSecretData(secret string) (string, error) {
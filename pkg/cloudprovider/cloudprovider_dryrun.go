@@ -0,0 +1,114 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	utilnet "k8s.io/utils/net"
+)
+
+// dryRunCloudProvider wraps a cloud provider like readOnlyCloudProvider, but
+// plans every assignment it refuses against the node's egress IP
+// configuration on the cloud first: the interface it would be assigned to,
+// whether the IP address is on one of its subnets and whether the interface
+// has capacity left for it. This lets an EgressIP rollout be validated on
+// production before it's performed.
+type dryRunCloudProvider struct {
+	readOnlyCloudProvider
+	mu sync.Mutex
+	// planned holds the IP addresses planned for assignment, keyed by node
+	// name and IP address, which the cloud doesn't count against the
+	// capacity of their interface as they're never assigned.
+	planned map[string]map[string]bool
+}
+
+func newDryRunCloudProvider(cp CloudProviderIntf) *dryRunCloudProvider {
+	return &dryRunCloudProvider{
+		readOnlyCloudProvider: readOnlyCloudProvider{CloudProviderIntf: cp},
+		planned:               map[string]map[string]bool{},
+	}
+}
+
+func (d *dryRunCloudProvider) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	plan, err := d.plan(ctx, ip, node)
+	if err != nil {
+		return d.refuse("fail assigning IP address %s to node %s: %v", ip, node.Name, err)
+	}
+	return d.refuse("assign IP address %s to node %s %s", ip, node.Name, plan)
+}
+
+func (d *dryRunCloudProvider) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+	d.unplan(ip, nodeToDel)
+	plan, err := d.plan(ctx, ip, nodeToAdd)
+	if err != nil {
+		return d.refuse("fail moving IP address %s from node %s to node %s: %v", ip, nodeToDel.Name, nodeToAdd.Name, err)
+	}
+	return d.refuse("move IP address %s from node %s to node %s %s", ip, nodeToDel.Name, nodeToAdd.Name, plan)
+}
+
+func (d *dryRunCloudProvider) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	d.unplan(ip, node)
+	return d.readOnlyCloudProvider.ReleasePrivateIP(ctx, ip, node)
+}
+
+func (d *dryRunCloudProvider) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, d.AssignPrivateIP)
+}
+
+func (d *dryRunCloudProvider) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, d.ReleasePrivateIP)
+}
+
+// plan finds the interface of the node ip would be assigned to, checks its
+// capacity and records the IP address as planned for the node. It returns the
+// description of the plan, or why the assignment would fail.
+func (d *dryRunCloudProvider) plan(ctx context.Context, ip net.IP, node *corev1.Node) (string, error) {
+	configs, err := d.GetNodeEgressIPConfiguration(ctx, node)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving the egress IP configuration of the node, err: %v", err)
+	}
+	for _, config := range configs {
+		cidr, family, available := config.IFAddr.IPv4, "IPv4", config.Capacity.IPv4
+		if utilnet.IsIPv6(ip) {
+			cidr, family, available = config.IFAddr.IPv6, "IPv6", config.Capacity.IPv6
+		}
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil || !subnet.Contains(ip) {
+			continue
+		}
+		if config.Capacity.IP > 0 {
+			family, available = "IP", config.Capacity.IP
+		}
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		planned := d.planned[node.Name]
+		if planned == nil {
+			planned = map[string]bool{}
+			d.planned[node.Name] = planned
+		}
+		// The capacity of the other IP addresses planned for the node isn't
+		// used on the cloud.
+		for plannedIP := range planned {
+			if plannedIP != ip.String() && (family == "IP" || utilnet.IsIPv6String(plannedIP) == utilnet.IsIPv6(ip)) {
+				available--
+			}
+		}
+		if available <= 0 {
+			return "", fmt.Errorf("interface %s has no %s capacity left", config.Interface, family)
+		}
+		planned[ip.String()] = true
+		return fmt.Sprintf("on interface %s, leaving %d %s addresses", config.Interface, available-1, family), nil
+	}
+	return "", fmt.Errorf("the IP address is on none of the subnets of the node's interfaces")
+}
+
+// unplan forgets that ip was planned for the node.
+func (d *dryRunCloudProvider) unplan(ip net.IP, node *corev1.Node) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.planned[node.Name], ip.String())
+}
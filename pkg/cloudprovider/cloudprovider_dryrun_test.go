@@ -0,0 +1,82 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestDryRunCloudProvider(t *testing.T) {
+	fake := NewFakeCloudProvider(false, false, false, false, 0)
+	config := &NodeEgressIPConfiguration{Interface: "eni-1", IFAddr: ifAddr{IPv4: "10.0.0.0/24"}}
+	config.Capacity.IPv4 = 2
+	fake.MockNodeEgressIPConfigurations = map[string][]*NodeEgressIPConfiguration{"nodeA": {config}}
+	d := newDryRunCloudProvider(fake)
+
+	nodeA := &corev1.Node{}
+	nodeA.Name = "nodeA"
+	nodeB := &corev1.Node{}
+	nodeB.Name = "nodeB"
+
+	tcs := []struct {
+		name     string
+		change   func() error
+		expected string
+	}{
+		{
+			name:     "Should plan an assignment on the interface of the subnet",
+			change:   func() error { return d.AssignPrivateIP(context.Background(), net.ParseIP("10.0.0.5"), nodeA) },
+			expected: "would assign IP address 10.0.0.5 to node nodeA on interface eni-1, leaving 1 IPv4 addresses",
+		},
+		{
+			name:     "Should plan an assignment again without counting it twice",
+			change:   func() error { return d.AssignPrivateIP(context.Background(), net.ParseIP("10.0.0.5"), nodeA) },
+			expected: "leaving 1 IPv4 addresses",
+		},
+		{
+			name: "Should count the planned assignments against the capacity",
+			change: func() error {
+				return d.AssignPrivateIPs(context.Background(), []net.IP{net.ParseIP("10.0.0.6")}, nodeA)[0]
+			},
+			expected: "leaving 0 IPv4 addresses",
+		},
+		{
+			name:     "Should plan the failure of an assignment exceeding the capacity",
+			change:   func() error { return d.AssignPrivateIP(context.Background(), net.ParseIP("10.0.0.7"), nodeA) },
+			expected: "would fail assigning IP address 10.0.0.7 to node nodeA: interface eni-1 has no IPv4 capacity left",
+		},
+		{
+			name:     "Should release the capacity of planned releases",
+			change:   func() error { return d.ReleasePrivateIP(context.Background(), net.ParseIP("10.0.0.6"), nodeA) },
+			expected: "would release IP address 10.0.0.6 from node nodeA",
+		},
+		{
+			name:     "Should plan an assignment once capacity was released",
+			change:   func() error { return d.AssignPrivateIP(context.Background(), net.ParseIP("10.0.0.7"), nodeA) },
+			expected: "leaving 0 IPv4 addresses",
+		},
+		{
+			name:     "Should plan the failure of an assignment out of the node's subnets",
+			change:   func() error { return d.AssignPrivateIP(context.Background(), net.ParseIP("192.0.2.1"), nodeA) },
+			expected: "the IP address is on none of the subnets of the node's interfaces",
+		},
+		{
+			name:     "Should plan the failure of a move to a node without configuration",
+			change:   func() error { return d.MovePrivateIP(context.Background(), net.ParseIP("10.0.0.5"), nodeB, nodeA) },
+			expected: "would fail moving IP address 10.0.0.5 from node nodeA to node nodeB",
+		},
+	}
+	for i, tc := range tcs {
+		err := tc.change()
+		if !errors.Is(err, ReadOnlyError) || !strings.Contains(err.Error(), tc.expected) {
+			t.Fatalf("TestDryRunCloudProvider(%d): %s: expected a ReadOnlyError containing %q, got: %v", i, tc.name, tc.expected, err)
+		}
+	}
+	if len(fake.StateTracker) != 0 {
+		t.Fatalf("TestDryRunCloudProvider: expected no mutation to reach the cloud, got: %v", fake.StateTracker)
+	}
+}
@@ -1,6 +1,7 @@
 package cloudprovider
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"time"
@@ -16,6 +17,42 @@ type FakeCloudProvider struct {
 	mockErrorOnGetNodeEgressIPConfiguration  bool
 	delayedCompletion                        time.Duration
 	StateTracker                             []string
+	// MockErrorOnAssignIPs makes the assignment of those IP addresses only
+	// fail.
+	MockErrorOnAssignIPs map[string]bool
+	// MockZoneMismatchIPs makes the assignment of those IP addresses fail
+	// with a ZoneMismatchError.
+	MockZoneMismatchIPs map[string]bool
+	// MockNodeEgressIPConfigurations and MockNetworkInterfaces are the
+	// egress IP configuration and network interfaces of the nodes, keyed by
+	// node name.
+	MockNodeEgressIPConfigurations map[string][]*NodeEgressIPConfiguration
+	MockNetworkInterfaces          map[string][]string
+	// MockMissingIPs makes the verification of those IP addresses fail with
+	// a MissingIPError, until they're assigned again.
+	MockMissingIPs map[string]bool
+	// MockPrivateIPs are the IP addresses listed as assigned to the nodes,
+	// keyed by node name. Nodes without an entry can't be listed.
+	MockPrivateIPs map[string][]net.IP
+	// MockOwnedResources are the resources owned by the controller, which
+	// are dropped once deleted.
+	MockOwnedResources []OwnedResource
+	// MockOwnedResourcesError is returned by ListOwnedResources.
+	MockOwnedResourcesError error
+	// MockUnreachableIPs makes the reachability probe of those IP addresses
+	// fail.
+	MockUnreachableIPs map[string]bool
+	// MockUnbatched makes the fake cloud apply AssignPrivateIPs and
+	// ReleasePrivateIPs in turn, rather than in a single call.
+	MockUnbatched bool
+	// MockHealthError is returned by CheckHealth.
+	MockHealthError error
+	// MockAllowsMove makes the fake cloud move IP addresses between nodes in
+	// a single call.
+	MockAllowsMove bool
+	// MockExistingInstances makes the cleanup of those nodes, keyed by name,
+	// fail with an InstanceExistsError.
+	MockExistingInstances map[string]bool
 }
 
 func NewFakeCloudProvider(mockErrorOnAssign, mockErrorOnAssignWithExistingIPCondition, mockErrorOnRelease, mockErrorOnWait bool, delayedCompletion time.Duration) *FakeCloudProvider {
@@ -33,7 +70,7 @@ func (f *FakeCloudProvider) initCredentials() error {
 	return nil
 }
 
-func (f *FakeCloudProvider) AssignPrivateIP(ip net.IP, node *corev1.Node) error {
+func (f *FakeCloudProvider) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
 	f.StateTracker = append(f.StateTracker, fmt.Sprintf("assign-%v-%s", ip, node.Name))
 	if f.mockErrorOnAssign {
 		if f.mockErrorOnAssignWithExistingIPCondition {
@@ -41,10 +78,85 @@ func (f *FakeCloudProvider) AssignPrivateIP(ip net.IP, node *corev1.Node) error
 		}
 		return fmt.Errorf("Assign failed")
 	}
+	if f.MockErrorOnAssignIPs[ip.String()] {
+		return fmt.Errorf("Assign failed")
+	}
+	if f.MockZoneMismatchIPs[ip.String()] {
+		return fmt.Errorf("%w: Assign failed", ZoneMismatchError)
+	}
+	delete(f.MockMissingIPs, ip.String())
 	return f.waitForCompletion()
 }
 
-func (f *FakeCloudProvider) ReleasePrivateIP(ip net.IP, node *corev1.Node) error {
+func (f *FakeCloudProvider) AllowsMovePrivateIP() bool {
+	return f.MockAllowsMove
+}
+
+func (f *FakeCloudProvider) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+	f.StateTracker = append(f.StateTracker, fmt.Sprintf("move-%v-%s-%s", ip, nodeToDel.Name, nodeToAdd.Name))
+	return nil
+}
+
+func (f *FakeCloudProvider) CleanupNode(ctx context.Context, node *corev1.Node) error {
+	f.StateTracker = append(f.StateTracker, fmt.Sprintf("cleanup-%s", node.Name))
+	if f.MockExistingInstances[node.Name] {
+		return InstanceExistsError
+	}
+	return nil
+}
+
+func (f *FakeCloudProvider) VerifyPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	f.StateTracker = append(f.StateTracker, fmt.Sprintf("verify-%v-%s", ip, node.Name))
+	if f.MockMissingIPs[ip.String()] {
+		return MissingIPError
+	}
+	return nil
+}
+
+func (f *FakeCloudProvider) GetPrivateIPReservations(ctx context.Context, ip net.IP, node *corev1.Node) ([]PrivateIPReservation, error) {
+	return nil, nil
+}
+
+func (f *FakeCloudProvider) GetNodeNetworkInterfaces(ctx context.Context, node *corev1.Node) ([]string, error) {
+	return f.MockNetworkInterfaces[node.Name], nil
+}
+
+func (f *FakeCloudProvider) ListPrivateIPs(ctx context.Context, node *corev1.Node) ([]net.IP, error) {
+	f.StateTracker = append(f.StateTracker, fmt.Sprintf("list-%s", node.Name))
+	return f.MockPrivateIPs[node.Name], nil
+}
+
+func (f *FakeCloudProvider) ProbeReachability(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	f.StateTracker = append(f.StateTracker, fmt.Sprintf("probe-%s", ip))
+	if f.MockUnreachableIPs[ip.String()] {
+		return fmt.Errorf("IP address %s is unreachable", ip)
+	}
+	return nil
+}
+
+func (f *FakeCloudProvider) CheckHealth(ctx context.Context, node *corev1.Node) error {
+	return f.MockHealthError
+}
+
+func (f *FakeCloudProvider) ListOwnedResources(ctx context.Context, nodes []*corev1.Node) ([]OwnedResource, error) {
+	if f.MockOwnedResourcesError != nil {
+		return nil, f.MockOwnedResourcesError
+	}
+	return append([]OwnedResource{}, f.MockOwnedResources...), nil
+}
+
+func (f *FakeCloudProvider) DeleteOwnedResource(ctx context.Context, resource OwnedResource) error {
+	f.StateTracker = append(f.StateTracker, fmt.Sprintf("delete-%s", resource.ID))
+	for i := range f.MockOwnedResources {
+		if f.MockOwnedResources[i].ID == resource.ID {
+			f.MockOwnedResources = append(f.MockOwnedResources[:i], f.MockOwnedResources[i+1:]...)
+			return nil
+		}
+	}
+	return NonExistingIPError
+}
+
+func (f *FakeCloudProvider) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
 	f.StateTracker = append(f.StateTracker, fmt.Sprintf("release-%v-%s", ip, node.Name))
 	if f.mockErrorOnRelease {
 		return fmt.Errorf("Release failed")
@@ -52,6 +164,24 @@ func (f *FakeCloudProvider) ReleasePrivateIP(ip net.IP, node *corev1.Node) error
 	return f.waitForCompletion()
 }
 
+func (f *FakeCloudProvider) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	f.StateTracker = append(f.StateTracker, fmt.Sprintf("assign-batch-%d-%s", len(ips), node.Name))
+	return eachPrivateIP(ctx, ips, node, f.AssignPrivateIP)
+}
+
+func (f *FakeCloudProvider) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	f.StateTracker = append(f.StateTracker, fmt.Sprintf("release-batch-%d-%s", len(ips), node.Name))
+	return eachPrivateIP(ctx, ips, node, f.ReleasePrivateIP)
+}
+
+func (f *FakeCloudProvider) BatchesAssignPrivateIPs() bool {
+	return !f.MockUnbatched
+}
+
+func (f *FakeCloudProvider) BatchesReleasePrivateIPs() bool {
+	return !f.MockUnbatched
+}
+
 func (f *FakeCloudProvider) waitForCompletion() error {
 	if f.mockErrorOnWait {
 		return fmt.Errorf("Waiting failed")
@@ -62,9 +192,9 @@ func (f *FakeCloudProvider) waitForCompletion() error {
 	return nil
 }
 
-func (f *FakeCloudProvider) GetNodeEgressIPConfiguration(node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
+func (f *FakeCloudProvider) GetNodeEgressIPConfiguration(ctx context.Context, node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
 	if f.mockErrorOnGetNodeEgressIPConfiguration {
 		return nil, fmt.Errorf("Get node egress IP configuration failed")
 	}
-	return nil, nil
+	return f.MockNodeEgressIPConfigurations[node.Name], nil
 }
@@ -0,0 +1,587 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+const (
+	// FakeCloudProviderEnvVar selects the in-memory cloud provider, whatever
+	// the platform type, when set. Its value is the specification of the
+	// faults to inject, see ParseInMemoryFaults, e.g.
+	// latency=500ms,throttle-rate=0.1,partial-failure-rate=0.2.
+	FakeCloudProviderEnvVar = "FAKE_CLOUD_PROVIDER"
+
+	// platformTypeInMemory is the platform type of the in-memory cloud
+	// provider, which is only selected by FakeCloudProviderEnvVar.
+	platformTypeInMemory = "InMemory"
+
+	// defaultInMemoryCapacity is the number of egress IPs each node can hold
+	// if InMemoryFaults.Capacity isn't set.
+	defaultInMemoryCapacity = 64
+
+	// inMemoryInterface is the name of the only interface of the nodes.
+	inMemoryInterface = "eth0"
+)
+
+// InMemoryThrottlingError is returned by the calls the in-memory cloud
+// provider throttles. Its message carries the status code the REST APIs of the
+// clouds throttle with.
+var InMemoryThrottlingError = errors.New("StatusCode=429, the in-memory cloud throttled the request")
+
+// InMemoryFault is a fault the in-memory cloud provider injects in a call.
+type InMemoryFault int
+
+const (
+	// InMemoryFaultNone lets the call through.
+	InMemoryFaultNone InMemoryFault = iota
+	// InMemoryFaultThrottle fails the call with an InMemoryThrottlingError,
+	// before anything is changed.
+	InMemoryFaultThrottle
+	// InMemoryFaultFail fails the call before anything is changed.
+	InMemoryFaultFail
+	// InMemoryFaultPartial fails the assignment or release between its two
+	// steps: the IP address is left reserved for the node, but not assigned
+	// to it, as when OpenStack fails to add the reservation port to the
+	// allowed address pairs of the node's port.
+	InMemoryFaultPartial
+)
+
+// InMemoryFaults are the faults the in-memory cloud provider injects.
+type InMemoryFaults struct {
+	// Latency is added to every call. Assignments and releases spend it
+	// between their two steps, without holding the lock of the cloud, for
+	// concurrent calls to interleave as they do on the clouds.
+	Latency time.Duration
+	// ThrottleRate is the share of calls failed with an
+	// InMemoryThrottlingError.
+	ThrottleRate float64
+	// FailureRate is the share of assignments and releases failed before
+	// anything is changed.
+	FailureRate float64
+	// PartialFailureRate is the share of assignments and releases failed
+	// between their two steps.
+	PartialFailureRate float64
+	// Capacity is the number of egress IPs each node can hold; 64 if 0.
+	Capacity int
+	// Inject, if set, decides the fault of every call instead of the rates,
+	// for tests to inject them deterministically. op is the name of the
+	// method called, e.g. AssignPrivateIP; ip is nil for the calls without
+	// one.
+	Inject func(op string, ip net.IP, node *corev1.Node) InMemoryFault
+}
+
+// InMemoryCloudProvider is a cloud provider keeping the state of the cloud in
+// memory, with no cloud to talk to: nodes have a single interface, eth0, in
+// the subnets of their primary interface as reported by the network plugin,
+// or of their addresses otherwise. It's meant for testing the controllers
+// without a cloud, faults included.
+//
+// As on OpenStack, an assignment takes two steps: reserving the IP address for
+// the node, then assigning it to the node. A release takes them backwards. An
+// IP address can't be reserved for, nor assigned to, two nodes at once.
+type InMemoryCloudProvider struct {
+	faults InMemoryFaults
+	mu     sync.Mutex
+	rand   *rand.Rand
+	// reserved and assigned map the IP addresses reserved for, and assigned
+	// to, nodes to the names of the nodes.
+	reserved map[string]string
+	assigned map[string]string
+}
+
+var (
+	// inMemoryCloud is the cloud shared by all the clients built by
+	// NewCloudProviderClient, as the clients of a real cloud are.
+	inMemoryCloud     *InMemoryCloudProvider
+	inMemoryCloudOnce sync.Once
+)
+
+// NewInMemoryCloudProvider returns an in-memory cloud provider, with nothing
+// reserved nor assigned, injecting faults.
+func NewInMemoryCloudProvider(faults InMemoryFaults) *InMemoryCloudProvider {
+	return &InMemoryCloudProvider{
+		faults:   faults,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		reserved: map[string]string{},
+		assigned: map[string]string{},
+	}
+}
+
+// newSharedInMemoryCloudProvider returns the in-memory cloud of the process,
+// injecting the faults of the specification the first time it's called.
+func newSharedInMemoryCloudProvider(spec string) (*InMemoryCloudProvider, error) {
+	faults, err := ParseInMemoryFaults(spec)
+	if err != nil {
+		return nil, err
+	}
+	inMemoryCloudOnce.Do(func() {
+		klog.Warningf("Using the in-memory cloud provider, set by %s, injecting faults: %+v", FakeCloudProviderEnvVar, faults)
+		inMemoryCloud = NewInMemoryCloudProvider(faults)
+	})
+	return inMemoryCloud, nil
+}
+
+// ParseInMemoryFaults parses the comma separated <fault>=<value> faults of
+// spec, fault one of latency (a duration), throttle-rate, failure-rate,
+// partial-failure-rate (shares of calls, between 0 and 1) or capacity (a
+// number of egress IPs per node).
+func ParseInMemoryFaults(spec string) (InMemoryFaults, error) {
+	faults := InMemoryFaults{}
+	for _, pair := range strings.Split(spec, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return InMemoryFaults{}, fmt.Errorf("invalid fault %q, expected <fault>=<value>", pair)
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		var err error
+		switch key {
+		case "latency":
+			faults.Latency, err = time.ParseDuration(value)
+		case "throttle-rate":
+			faults.ThrottleRate, err = parseInMemoryRate(value)
+		case "failure-rate":
+			faults.FailureRate, err = parseInMemoryRate(value)
+		case "partial-failure-rate":
+			faults.PartialFailureRate, err = parseInMemoryRate(value)
+		case "capacity":
+			if faults.Capacity, err = strconv.Atoi(value); err == nil && faults.Capacity < 0 {
+				err = fmt.Errorf("negative capacity")
+			}
+		default:
+			return InMemoryFaults{}, fmt.Errorf("invalid fault %q, expected one of latency, throttle-rate, failure-rate, partial-failure-rate, capacity", pair)
+		}
+		if err != nil {
+			return InMemoryFaults{}, fmt.Errorf("invalid fault %q, err: %v", pair, err)
+		}
+	}
+	return faults, nil
+}
+
+func parseInMemoryRate(value string) (float64, error) {
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("rate out of [0, 1]")
+	}
+	return rate, nil
+}
+
+func (m *InMemoryCloudProvider) initCredentials() error {
+	return nil
+}
+
+// AssignPrivateIP reserves ip for the node, then assigns it. A reservation
+// left behind by a partially failed assignment is reused.
+func (m *InMemoryCloudProvider) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	fault := m.inject("AssignPrivateIP", ip, node)
+	if fault == InMemoryFaultThrottle {
+		return InMemoryThrottlingError
+	}
+	if err := m.validateIP(ip, node); err != nil {
+		return err
+	}
+	if err := m.reserve(ip, node, fault); err != nil {
+		return err
+	}
+	time.Sleep(m.faults.Latency)
+	if fault == InMemoryFaultPartial {
+		return fmt.Errorf("in-memory cloud failed assigning IP address %s reserved for node %s", ip, node.Name)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.reserved[ip.String()] != node.Name {
+		return fmt.Errorf("the reservation of IP address %s for node %s was released concurrently", ip, node.Name)
+	}
+	delete(m.reserved, ip.String())
+	m.assigned[ip.String()] = node.Name
+	return nil
+}
+
+// reserve reserves ip for the node, checking its capacity.
+func (m *InMemoryCloudProvider) reserve(ip net.IP, node *corev1.Node, fault InMemoryFault) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if owner, ok := m.assigned[ip.String()]; ok {
+		if owner == node.Name {
+			return AlreadyExistingIPError
+		}
+		return fmt.Errorf("IP address %s is assigned to node %s", ip, owner)
+	}
+	if owner, ok := m.reserved[ip.String()]; ok && owner != node.Name {
+		return fmt.Errorf("IP address %s is reserved for node %s", ip, owner)
+	}
+	if fault == InMemoryFaultFail {
+		return fmt.Errorf("in-memory cloud failed reserving IP address %s for node %s", ip, node.Name)
+	}
+	if m.countLocked(node) >= m.capacity() && m.reserved[ip.String()] != node.Name {
+		return fmt.Errorf("node %s holds %d IP addresses, its capacity", node.Name, m.capacity())
+	}
+	m.reserved[ip.String()] = node.Name
+	return nil
+}
+
+func (m *InMemoryCloudProvider) AllowsMovePrivateIP() bool {
+	return false
+}
+
+func (m *InMemoryCloudProvider) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+	return nil
+}
+
+// ReleasePrivateIP unassigns ip from the node, then deletes its reservation.
+// A reservation left behind by a partially failed assignment or release is
+// deleted.
+func (m *InMemoryCloudProvider) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	fault := m.inject("ReleasePrivateIP", ip, node)
+	if fault == InMemoryFaultThrottle {
+		return InMemoryThrottlingError
+	}
+	m.mu.Lock()
+	if m.assigned[ip.String()] != node.Name && m.reserved[ip.String()] != node.Name {
+		m.mu.Unlock()
+		return NonExistingIPError
+	}
+	if fault == InMemoryFaultFail {
+		m.mu.Unlock()
+		return fmt.Errorf("in-memory cloud failed releasing IP address %s from node %s", ip, node.Name)
+	}
+	if m.assigned[ip.String()] == node.Name {
+		delete(m.assigned, ip.String())
+		m.reserved[ip.String()] = node.Name
+	}
+	m.mu.Unlock()
+
+	time.Sleep(m.faults.Latency)
+	if fault == InMemoryFaultPartial {
+		return fmt.Errorf("in-memory cloud failed deleting the reservation of IP address %s for node %s", ip, node.Name)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.reserved[ip.String()] == node.Name {
+		delete(m.reserved, ip.String())
+	}
+	return nil
+}
+
+// AssignPrivateIPs assigns the IP addresses concurrently, paying the latency
+// once, as a cloud assigning them in a single call would.
+func (m *InMemoryCloudProvider) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return concurrentPrivateIPs(ctx, ips, node, m.AssignPrivateIP)
+}
+
+// ReleasePrivateIPs releases the IP addresses concurrently, see
+// AssignPrivateIPs.
+func (m *InMemoryCloudProvider) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return concurrentPrivateIPs(ctx, ips, node, m.ReleasePrivateIP)
+}
+
+// BatchesAssignPrivateIPs returns true, see AssignPrivateIPs.
+func (m *InMemoryCloudProvider) BatchesAssignPrivateIPs() bool {
+	return true
+}
+
+// BatchesReleasePrivateIPs returns true, see AssignPrivateIPs.
+func (m *InMemoryCloudProvider) BatchesReleasePrivateIPs() bool {
+	return true
+}
+
+// GetNodeEgressIPConfiguration returns the configuration of eth0, whose
+// capacity is the one of the nodes less the IP addresses reserved for, or
+// assigned to, the node.
+func (m *InMemoryCloudProvider) GetNodeEgressIPConfiguration(ctx context.Context, node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
+	if m.inject("GetNodeEgressIPConfiguration", nil, node) == InMemoryFaultThrottle {
+		return nil, InMemoryThrottlingError
+	}
+	subnets, err := getInMemorySubnets(node)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	available := m.capacity() - m.countLocked(node)
+	m.mu.Unlock()
+	if available < 0 {
+		available = 0
+	}
+	config := &NodeEgressIPConfiguration{
+		Interface: inMemoryInterface,
+		Capacity:  capacity{IP: available},
+	}
+	for _, subnet := range subnets {
+		if utilnet.IsIPv6CIDR(subnet) {
+			config.IFAddr.IPv6 = subnet.String()
+		} else {
+			config.IFAddr.IPv4 = subnet.String()
+		}
+	}
+	return []*NodeEgressIPConfiguration{config}, nil
+}
+
+// CleanupNode deletes all the reservations and assignments of the deleted
+// node.
+func (m *InMemoryCloudProvider) CleanupNode(ctx context.Context, node *corev1.Node) error {
+	if m.inject("CleanupNode", nil, node) == InMemoryFaultThrottle {
+		return InMemoryThrottlingError
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, ips := range []map[string]string{m.reserved, m.assigned} {
+		for ip, owner := range ips {
+			if owner == node.Name {
+				delete(ips, ip)
+			}
+		}
+	}
+	return nil
+}
+
+// VerifyPrivateIP verifies that ip is assigned to the node, wrapping a
+// MissingIPError otherwise. An IP address only reserved for the node is
+// missing too: it doesn't carry traffic.
+func (m *InMemoryCloudProvider) VerifyPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	if m.inject("VerifyPrivateIP", ip, node) == InMemoryFaultThrottle {
+		return InMemoryThrottlingError
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.assigned[ip.String()] != node.Name {
+		return fmt.Errorf("%w: IP address %s is not assigned to node %s", MissingIPError, ip, node.Name)
+	}
+	return nil
+}
+
+// GetPrivateIPReservations returns the reservation of ip for the node, whether
+// the IP address is assigned to it or not.
+func (m *InMemoryCloudProvider) GetPrivateIPReservations(ctx context.Context, ip net.IP, node *corev1.Node) ([]PrivateIPReservation, error) {
+	if m.inject("GetPrivateIPReservations", ip, node) == InMemoryFaultThrottle {
+		return nil, InMemoryThrottlingError
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.assigned[ip.String()] != node.Name && m.reserved[ip.String()] != node.Name {
+		return nil, nil
+	}
+	return []PrivateIPReservation{{ID: "reservation-" + ip.String()}}, nil
+}
+
+// GetNodeNetworkInterfaces returns eth0, the only interface of the nodes.
+func (m *InMemoryCloudProvider) GetNodeNetworkInterfaces(ctx context.Context, node *corev1.Node) ([]string, error) {
+	if m.inject("GetNodeNetworkInterfaces", nil, node) == InMemoryFaultThrottle {
+		return nil, InMemoryThrottlingError
+	}
+	return []string{inMemoryInterface}, nil
+}
+
+// ProbeReachability returns nil, assigned IP addresses are always reachable,
+// unless the call is throttled.
+func (m *InMemoryCloudProvider) ProbeReachability(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	if m.inject("ProbeReachability", ip, node) == InMemoryFaultThrottle {
+		return InMemoryThrottlingError
+	}
+	return nil
+}
+
+// CheckHealth returns nil, unless the call is throttled.
+func (m *InMemoryCloudProvider) CheckHealth(ctx context.Context, node *corev1.Node) error {
+	if m.inject("CheckHealth", nil, node) == InMemoryFaultThrottle {
+		return InMemoryThrottlingError
+	}
+	return nil
+}
+
+// ListPrivateIPs returns the IP addresses assigned to the node, sorted as
+// strings.
+func (m *InMemoryCloudProvider) ListPrivateIPs(ctx context.Context, node *corev1.Node) ([]net.IP, error) {
+	if m.inject("ListPrivateIPs", nil, node) == InMemoryFaultThrottle {
+		return nil, InMemoryThrottlingError
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	assigned := []string{}
+	for ip, nodeName := range m.assigned {
+		if nodeName == node.Name {
+			assigned = append(assigned, ip)
+		}
+	}
+	sort.Strings(assigned)
+	ips := []net.IP{}
+	for _, ip := range assigned {
+		ips = append(ips, ParseIP(ip))
+	}
+	return ips, nil
+}
+
+// ListOwnedResources returns the reservations and the assignments of IP
+// addresses, sorted by ID.
+func (m *InMemoryCloudProvider) ListOwnedResources(ctx context.Context, nodes []*corev1.Node) ([]OwnedResource, error) {
+	if m.inject("ListOwnedResources", nil, nil) == InMemoryFaultThrottle {
+		return nil, InMemoryThrottlingError
+	}
+	nodeNames := map[string]bool{}
+	for _, node := range nodes {
+		nodeNames[node.Name] = true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	resources := []OwnedResource{}
+	for kind, ips := range map[string]map[string]string{"reservation": m.reserved, "assignment": m.assigned} {
+		for ip, nodeName := range ips {
+			resource := OwnedResource{ID: kind + "-" + ip, Kind: kind, IP: ParseIP(ip)}
+			if nodeNames[nodeName] {
+				resource.Node = nodeName
+			}
+			resources = append(resources, resource)
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].ID < resources[j].ID })
+	return resources, nil
+}
+
+// DeleteOwnedResource drops the reservation or the assignment.
+func (m *InMemoryCloudProvider) DeleteOwnedResource(ctx context.Context, resource OwnedResource) error {
+	if m.inject("DeleteOwnedResource", resource.IP, nil) == InMemoryFaultThrottle {
+		return InMemoryThrottlingError
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ips := m.assigned
+	if resource.Kind == "reservation" {
+		ips = m.reserved
+	}
+	if _, ok := ips[resource.IP.String()]; !ok || resource.ID != resource.Kind+"-"+resource.IP.String() {
+		return NonExistingIPError
+	}
+	delete(ips, resource.IP.String())
+	return nil
+}
+
+// AssignedIPs returns the IP addresses assigned to the nodes, keyed by IP
+// address, for tests to check the state of the cloud.
+func (m *InMemoryCloudProvider) AssignedIPs() map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return copyInMemoryIPs(m.assigned)
+}
+
+// ReservedIPs returns the IP addresses reserved for the nodes but not
+// assigned to them, keyed by IP address, for tests to check the state of the
+// cloud.
+func (m *InMemoryCloudProvider) ReservedIPs() map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return copyInMemoryIPs(m.reserved)
+}
+
+// inject waits for the latency of the call, but for assignments and releases
+// which wait between their steps, and returns the fault to inject in it.
+func (m *InMemoryCloudProvider) inject(op string, ip net.IP, node *corev1.Node) InMemoryFault {
+	if op != "AssignPrivateIP" && op != "ReleasePrivateIP" {
+		time.Sleep(m.faults.Latency)
+	}
+	if m.faults.Inject != nil {
+		return m.faults.Inject(op, ip, node)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.rand.Float64() < m.faults.ThrottleRate {
+		return InMemoryFaultThrottle
+	}
+	if op != "AssignPrivateIP" && op != "ReleasePrivateIP" {
+		return InMemoryFaultNone
+	}
+	switch r := m.rand.Float64(); {
+	case r < m.faults.FailureRate:
+		return InMemoryFaultFail
+	case r < m.faults.FailureRate+m.faults.PartialFailureRate:
+		return InMemoryFaultPartial
+	}
+	return InMemoryFaultNone
+}
+
+// validateIP returns an error if ip isn't in a subnet of the node, or is an
+// address of the node.
+func (m *InMemoryCloudProvider) validateIP(ip net.IP, node *corev1.Node) error {
+	subnets, err := getInMemorySubnets(node)
+	if err != nil {
+		return err
+	}
+	for _, nodeIP := range nodeInternalIPs(node) {
+		if nodeIP.Equal(ip) {
+			return fmt.Errorf("IP address %s is an address of node %s", ip, node.Name)
+		}
+	}
+	for _, subnet := range subnets {
+		if subnet.Contains(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("IP address %s is in none of the subnets %v of node %s", ip, subnets, node.Name)
+}
+
+func (m *InMemoryCloudProvider) capacity() int {
+	if m.faults.Capacity > 0 {
+		return m.faults.Capacity
+	}
+	return defaultInMemoryCapacity
+}
+
+// countLocked returns the number of IP addresses reserved for, or assigned to,
+// the node. m.mu must be held.
+func (m *InMemoryCloudProvider) countLocked(node *corev1.Node) int {
+	count := 0
+	for _, ips := range []map[string]string{m.reserved, m.assigned} {
+		for _, owner := range ips {
+			if owner == node.Name {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// getInMemorySubnets returns the subnets of the node's primary interface, as
+// reported by the network plugin, or the /24 and /64 subnets of its addresses
+// if it didn't report them.
+func getInMemorySubnets(node *corev1.Node) ([]*net.IPNet, error) {
+	if _, ok := node.Annotations[NodePrimaryIfAddrAnnotation]; ok {
+		return getNoneIfAddrs(node)
+	}
+	var subnets []*net.IPNet
+	for _, ip := range nodeInternalIPs(node) {
+		bits := 24
+		if utilnet.IsIPv6(ip) {
+			bits = 64
+		}
+		_, subnet, _ := net.ParseCIDR(fmt.Sprintf("%s/%d", ip, bits))
+		subnets = append(subnets, subnet)
+	}
+	if len(subnets) == 0 {
+		return nil, fmt.Errorf("%w: node %s has no address", NoNetworkInterfaceError, node.Name)
+	}
+	return subnets, nil
+}
+
+func copyInMemoryIPs(ips map[string]string) map[string]string {
+	c := make(map[string]string, len(ips))
+	for ip, owner := range ips {
+		c[ip] = owner
+	}
+	return c
+}
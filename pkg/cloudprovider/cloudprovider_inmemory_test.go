@@ -0,0 +1,274 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newInMemoryNode(name, address string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: address}},
+		},
+	}
+}
+
+// injectInMemoryFaults returns an Inject hook injecting the faults in order in
+// the calls of op, and none afterwards.
+func injectInMemoryFaults(op string, faults ...InMemoryFault) func(string, net.IP, *corev1.Node) InMemoryFault {
+	return func(called string, ip net.IP, node *corev1.Node) InMemoryFault {
+		if called != op || len(faults) == 0 {
+			return InMemoryFaultNone
+		}
+		fault := faults[0]
+		faults = faults[1:]
+		return fault
+	}
+}
+
+func TestParseInMemoryFaults(t *testing.T) {
+	tcs := []struct {
+		spec      string
+		expected  InMemoryFaults
+		expectErr bool
+	}{
+		{spec: "", expected: InMemoryFaults{}},
+		{
+			spec:     "latency=500ms, throttle-rate=0.1,failure-rate=0,partial-failure-rate=1,capacity=10",
+			expected: InMemoryFaults{Latency: 500 * time.Millisecond, ThrottleRate: 0.1, PartialFailureRate: 1, Capacity: 10},
+		},
+		{spec: "latency=fast", expectErr: true},
+		{spec: "throttle-rate=2", expectErr: true},
+		{spec: "capacity=-1", expectErr: true},
+		{spec: "capacity", expectErr: true},
+		{spec: "jitter=1s", expectErr: true},
+	}
+	for i, tc := range tcs {
+		faults, err := ParseInMemoryFaults(tc.spec)
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestParseInMemoryFaults(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		if !tc.expectErr && fmt.Sprintf("%+v", faults) != fmt.Sprintf("%+v", tc.expected) {
+			t.Fatalf("TestParseInMemoryFaults(%d): expected faults %+v, got %+v", i, tc.expected, faults)
+		}
+	}
+}
+
+func TestInMemoryAssignAndReleasePrivateIP(t *testing.T) {
+	provider := NewInMemoryCloudProvider(InMemoryFaults{Capacity: 2})
+	node := newInMemoryNode("worker-0", "10.0.0.10")
+	other := newInMemoryNode("worker-1", "10.0.0.11")
+	ip := net.ParseIP("10.0.0.20")
+
+	if err := provider.AssignPrivateIP(context.Background(), ip, node); err != nil {
+		t.Fatalf("received unexpected error assigning IP address, err: %v", err)
+	}
+	if err := provider.AssignPrivateIP(context.Background(), ip, node); !errors.Is(err, AlreadyExistingIPError) {
+		t.Fatalf("expected an AlreadyExistingIPError assigning an assigned IP address, got %v", err)
+	}
+	if err := provider.AssignPrivateIP(context.Background(), ip, other); err == nil {
+		t.Fatalf("expected an error assigning an IP address assigned to another node")
+	}
+	for _, invalid := range []string{"10.0.1.20", "10.0.0.10"} {
+		if err := provider.AssignPrivateIP(context.Background(), net.ParseIP(invalid), node); err == nil {
+			t.Fatalf("expected an error assigning IP address %s", invalid)
+		}
+	}
+	if err := provider.AssignPrivateIP(context.Background(), net.ParseIP("10.0.0.21"), node); err != nil {
+		t.Fatalf("received unexpected error assigning IP address, err: %v", err)
+	}
+	if err := provider.AssignPrivateIP(context.Background(), net.ParseIP("10.0.0.22"), node); err == nil {
+		t.Fatalf("expected an error assigning an IP address beyond the capacity of the node")
+	}
+	configs, err := provider.GetNodeEgressIPConfiguration(context.Background(), node)
+	if err != nil || len(configs) != 1 || configs[0].Interface != "eth0" || configs[0].IFAddr.IPv4 != "10.0.0.0/24" || configs[0].Capacity.IP != 0 {
+		t.Fatalf("unexpected egress IP configuration %+v, err: %v", configs, err)
+	}
+	if err := provider.VerifyPrivateIP(context.Background(), ip, node); err != nil {
+		t.Fatalf("received unexpected error verifying IP address, err: %v", err)
+	}
+	if ips, err := provider.ListPrivateIPs(context.Background(), node); err != nil || fmt.Sprint(ips) != "[10.0.0.20 10.0.0.21]" {
+		t.Fatalf("expected IP addresses [10.0.0.20 10.0.0.21] to be listed, got %v, err: %v", ips, err)
+	}
+	if ips, err := provider.ListPrivateIPs(context.Background(), other); err != nil || ips == nil || len(ips) != 0 {
+		t.Fatalf("expected no IP address to be listed, got %v, err: %v", ips, err)
+	}
+	if err := provider.ReleasePrivateIP(context.Background(), ip, node); err != nil {
+		t.Fatalf("received unexpected error releasing IP address, err: %v", err)
+	}
+	if err := provider.VerifyPrivateIP(context.Background(), ip, node); !errors.Is(err, MissingIPError) {
+		t.Fatalf("expected a MissingIPError verifying a released IP address, got %v", err)
+	}
+	if err := provider.ReleasePrivateIP(context.Background(), ip, node); !errors.Is(err, NonExistingIPError) {
+		t.Fatalf("expected a NonExistingIPError releasing a released IP address, got %v", err)
+	}
+	if err := provider.CleanupNode(context.Background(), node); err != nil {
+		t.Fatalf("received unexpected error cleaning up node, err: %v", err)
+	}
+	if assigned := provider.AssignedIPs(); len(assigned) != 0 {
+		t.Fatalf("expected no IP address to be left, got %v", assigned)
+	}
+}
+
+func TestInMemoryPartialFailures(t *testing.T) {
+	node := newInMemoryNode("worker-0", "10.0.0.10")
+	other := newInMemoryNode("worker-1", "10.0.0.11")
+	ip := net.ParseIP("10.0.0.20")
+
+	// A partially failed assignment leaves the IP address reserved, which
+	// the retry reuses.
+	provider := NewInMemoryCloudProvider(InMemoryFaults{Inject: injectInMemoryFaults("AssignPrivateIP", InMemoryFaultPartial)})
+	if err := provider.AssignPrivateIP(context.Background(), ip, node); err == nil {
+		t.Fatalf("expected an error assigning an IP address partially")
+	}
+	if reserved := provider.ReservedIPs(); fmt.Sprint(reserved) != "map[10.0.0.20:worker-0]" {
+		t.Fatalf("expected IP address %s to be reserved for node %s, got %v", ip, node.Name, reserved)
+	}
+	if err := provider.VerifyPrivateIP(context.Background(), ip, node); !errors.Is(err, MissingIPError) {
+		t.Fatalf("expected a MissingIPError verifying a reserved IP address, got %v", err)
+	}
+	if reservations, err := provider.GetPrivateIPReservations(context.Background(), ip, node); err != nil || len(reservations) != 1 {
+		t.Fatalf("expected the reservation of a reserved IP address, got %v, err: %v", reservations, err)
+	}
+	if err := provider.AssignPrivateIP(context.Background(), ip, other); err == nil {
+		t.Fatalf("expected an error assigning an IP address reserved for another node")
+	}
+	resources, err := provider.ListOwnedResources(context.Background(), []*corev1.Node{other})
+	if err != nil || fmt.Sprintf("%+v", resources) != "[{ID:reservation-10.0.0.20 Kind:reservation IP:10.0.0.20 Node: ProviderID: node:<nil>}]" {
+		t.Fatalf("expected the reservation of IP address %s to belong to no node, got %+v, err: %v", ip, resources, err)
+	}
+	if err := provider.AssignPrivateIP(context.Background(), ip, node); err != nil {
+		t.Fatalf("received unexpected error retrying the assignment, err: %v", err)
+	}
+	if len(provider.ReservedIPs()) != 0 || fmt.Sprint(provider.AssignedIPs()) != "map[10.0.0.20:worker-0]" {
+		t.Fatalf("expected IP address %s to be assigned to node %s, got %v and %v", ip, node.Name, provider.ReservedIPs(), provider.AssignedIPs())
+	}
+
+	// A partially failed release leaves the IP address reserved, which the
+	// retry releases.
+	provider.faults.Inject = injectInMemoryFaults("ReleasePrivateIP", InMemoryFaultFail, InMemoryFaultPartial)
+	if err := provider.ReleasePrivateIP(context.Background(), ip, node); err == nil || len(provider.AssignedIPs()) != 1 {
+		t.Fatalf("expected the release to fail before anything is changed, got %v, err: %v", provider.AssignedIPs(), err)
+	}
+	if err := provider.ReleasePrivateIP(context.Background(), ip, node); err == nil || len(provider.ReservedIPs()) != 1 || len(provider.AssignedIPs()) != 0 {
+		t.Fatalf("expected the release to fail partially, got %v and %v, err: %v", provider.ReservedIPs(), provider.AssignedIPs(), err)
+	}
+	if err := provider.ReleasePrivateIP(context.Background(), ip, node); err != nil {
+		t.Fatalf("received unexpected error retrying the release, err: %v", err)
+	}
+	if len(provider.ReservedIPs()) != 0 || len(provider.AssignedIPs()) != 0 {
+		t.Fatalf("expected no IP address to be left, got %v and %v", provider.ReservedIPs(), provider.AssignedIPs())
+	}
+
+	// Reservations left behind are deleted as owned resources.
+	provider.faults.Inject = injectInMemoryFaults("AssignPrivateIP", InMemoryFaultPartial)
+	if err := provider.AssignPrivateIP(context.Background(), ip, node); err == nil {
+		t.Fatalf("expected an error assigning an IP address partially")
+	}
+	resources, err = provider.ListOwnedResources(context.Background(), []*corev1.Node{node, other})
+	if err != nil || len(resources) != 1 || resources[0].Node != node.Name {
+		t.Fatalf("expected the reservation of IP address %s for node %s, got %+v, err: %v", ip, node.Name, resources, err)
+	}
+	if err := provider.DeleteOwnedResource(context.Background(), resources[0]); err != nil {
+		t.Fatalf("received unexpected error deleting the reservation, err: %v", err)
+	}
+	if err := provider.DeleteOwnedResource(context.Background(), resources[0]); !errors.Is(err, NonExistingIPError) {
+		t.Fatalf("expected a NonExistingIPError deleting a deleted reservation, got %v", err)
+	}
+	if len(provider.ReservedIPs()) != 0 {
+		t.Fatalf("expected no reservation to be left, got %v", provider.ReservedIPs())
+	}
+}
+
+func TestInMemoryThrottling(t *testing.T) {
+	provider := NewInMemoryCloudProvider(InMemoryFaults{ThrottleRate: 1})
+	node := newInMemoryNode("worker-0", "10.0.0.10")
+	if err := provider.AssignPrivateIP(context.Background(), net.ParseIP("10.0.0.20"), node); !errors.Is(err, InMemoryThrottlingError) {
+		t.Fatalf("expected an InMemoryThrottlingError assigning an IP address, got %v", err)
+	}
+	if _, err := provider.GetNodeEgressIPConfiguration(context.Background(), node); !errors.Is(err, InMemoryThrottlingError) {
+		t.Fatalf("expected an InMemoryThrottlingError retrieving the egress IP configuration, got %v", err)
+	}
+	if RemediationHint(InMemoryThrottlingError) != "" {
+		t.Fatalf("expected no remediation hint for throttling")
+	}
+}
+
+// TestInMemoryConcurrentAssignments verifies that concurrent assignments of an
+// IP address to different nodes, interleaving during the latency, result in a
+// single assignment.
+func TestInMemoryConcurrentAssignments(t *testing.T) {
+	provider := NewInMemoryCloudProvider(InMemoryFaults{Latency: 10 * time.Millisecond})
+	ip := net.ParseIP("10.0.0.20")
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = provider.AssignPrivateIP(context.Background(), ip, newInMemoryNode(fmt.Sprintf("worker-%d", i), fmt.Sprintf("10.0.0.%d", 10+i)))
+		}(i)
+	}
+	wg.Wait()
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		}
+	}
+	if succeeded != 1 || len(provider.AssignedIPs()) != 1 || len(provider.ReservedIPs()) != 0 {
+		t.Fatalf("expected a single assignment, got %v and %v, errs: %v", provider.AssignedIPs(), provider.ReservedIPs(), errs)
+	}
+}
+
+// TestInMemoryBatchAssignments verifies that the IP addresses of a batch are
+// assigned and released independently, each with its own error.
+func TestInMemoryBatchAssignments(t *testing.T) {
+	provider := NewInMemoryCloudProvider(InMemoryFaults{Latency: 10 * time.Millisecond})
+	node := newInMemoryNode("worker-0", "10.0.0.10")
+	// The node's own address can't be assigned.
+	ips := []net.IP{net.ParseIP("10.0.0.20"), net.ParseIP("10.0.0.10"), net.ParseIP("10.0.0.21")}
+	errs := provider.AssignPrivateIPs(context.Background(), ips, node)
+	if errs[0] != nil || errs[1] == nil || errs[2] != nil {
+		t.Fatalf("expected only the node's address to fail, got: %v", errs)
+	}
+	if fmt.Sprint(provider.AssignedIPs()) != "map[10.0.0.20:worker-0 10.0.0.21:worker-0]" {
+		t.Fatalf("unexpected assigned IP addresses: %v", provider.AssignedIPs())
+	}
+	errs = provider.ReleasePrivateIPs(context.Background(), ips, node)
+	if errs[0] != nil || !errors.Is(errs[1], NonExistingIPError) || errs[2] != nil {
+		t.Fatalf("expected only the node's address not to exist, got: %v", errs)
+	}
+	if len(provider.AssignedIPs()) != 0 || len(provider.ReservedIPs()) != 0 {
+		t.Fatalf("expected all IP addresses to be released, got %v and %v", provider.AssignedIPs(), provider.ReservedIPs())
+	}
+}
+
+func TestNewCloudProviderClientInMemory(t *testing.T) {
+	t.Setenv(FakeCloudProviderEnvVar, "capacity=5")
+	provider, err := NewCloudProviderClient(CloudProviderConfig{PlatformType: PlatformTypeAWS})
+	if err != nil {
+		t.Fatalf("received unexpected error, err: %v", err)
+	}
+	if _, ok := provider.(*InMemoryCloudProvider); !ok {
+		t.Fatalf("expected the in-memory cloud provider, got %T", provider)
+	}
+	again, err := NewCloudProviderClient(CloudProviderConfig{PlatformType: PlatformTypeAWS})
+	if err != nil || again != provider {
+		t.Fatalf("expected the clients to share the in-memory cloud, err: %v", err)
+	}
+
+	t.Setenv(FakeCloudProviderEnvVar, "capacity=many")
+	if _, err := NewCloudProviderClient(CloudProviderConfig{PlatformType: PlatformTypeAWS}); err == nil {
+		t.Fatalf("expected an error parsing invalid faults")
+	}
+}
@@ -0,0 +1,176 @@
+package cloudprovider
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// limitedCloudProvider wraps a cloud provider, capping the number of calls
+// mutating the cloud which run concurrently, both overall and per node. Calls
+// only reading from the cloud aren't limited. This bounds the write pressure on
+// the cloud API independently of the number of controller workers.
+type limitedCloudProvider struct {
+	CloudProviderIntf
+	// global holds one slot per mutation in flight, it's nil if unlimited.
+	global chan struct{}
+	// nodes holds the per node slots, its size is 0 if unlimited.
+	nodes keyedSemaphore
+}
+
+func newLimitedCloudProvider(cp CloudProviderIntf, maxInflight, maxInflightPerNode int) *limitedCloudProvider {
+	l := &limitedCloudProvider{
+		CloudProviderIntf: cp,
+		nodes:             keyedSemaphore{size: maxInflightPerNode},
+	}
+	if maxInflight > 0 {
+		l.global = make(chan struct{}, maxInflight)
+	}
+	return l
+}
+
+// acquire blocks until a mutation on all given nodes may run and returns the
+// function releasing the slots taken. Node slots are taken first, so that no
+// global slot is held while waiting for a busy node.
+func (l *limitedCloudProvider) acquire(nodes ...*corev1.Node) func() {
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+	releaseNodes := l.nodes.Acquire(names...)
+	if l.global == nil {
+		return releaseNodes
+	}
+	l.global <- struct{}{}
+	return func() {
+		<-l.global
+		releaseNodes()
+	}
+}
+
+func (l *limitedCloudProvider) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	if node != nil {
+		defer l.acquire(node)()
+	}
+	return l.CloudProviderIntf.AssignPrivateIP(ctx, ip, node)
+}
+
+func (l *limitedCloudProvider) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+	if nodeToAdd != nil && nodeToDel != nil {
+		defer l.acquire(nodeToAdd, nodeToDel)()
+	}
+	return l.CloudProviderIntf.MovePrivateIP(ctx, ip, nodeToAdd, nodeToDel)
+}
+
+func (l *limitedCloudProvider) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	if node != nil {
+		defer l.acquire(node)()
+	}
+	return l.CloudProviderIntf.ReleasePrivateIP(ctx, ip, node)
+}
+
+// AssignPrivateIPs takes a single slot for all IP addresses, the cloud
+// assigning them in a single call if it batches changes.
+func (l *limitedCloudProvider) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	if node != nil {
+		defer l.acquire(node)()
+	}
+	return l.CloudProviderIntf.AssignPrivateIPs(ctx, ips, node)
+}
+
+// ReleasePrivateIPs takes a single slot for all IP addresses, see
+// AssignPrivateIPs.
+func (l *limitedCloudProvider) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	if node != nil {
+		defer l.acquire(node)()
+	}
+	return l.CloudProviderIntf.ReleasePrivateIPs(ctx, ips, node)
+}
+
+func (l *limitedCloudProvider) CleanupNode(ctx context.Context, node *corev1.Node) error {
+	if node != nil {
+		defer l.acquire(node)()
+	}
+	return l.CloudProviderIntf.CleanupNode(ctx, node)
+}
+
+func (l *limitedCloudProvider) DeleteOwnedResource(ctx context.Context, resource OwnedResource) error {
+	nodes := []*corev1.Node{}
+	if resource.node != nil {
+		nodes = append(nodes, resource.node)
+	}
+	defer l.acquire(nodes...)()
+	return l.CloudProviderIntf.DeleteOwnedResource(ctx, resource)
+}
+
+// keyedSemaphore hands out one semaphore with size slots per key, like
+// keyedMutex does with locks. It doesn't limit anything if size is 0.
+type keyedSemaphore struct {
+	size       int
+	mu         sync.Mutex
+	semaphores map[string]*refCountedSemaphore
+}
+
+type refCountedSemaphore struct {
+	slots chan struct{}
+	refs  int
+}
+
+// Acquire takes a slot of all given keys and returns the function releasing
+// them. Keys are always acquired in the same order, so that callers acquiring
+// overlapping sets of keys can't deadlock.
+func (k *keyedSemaphore) Acquire(keys ...string) func() {
+	if k.size <= 0 {
+		return func() {}
+	}
+	sorted := make([]string, 0, len(keys))
+	seen := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			sorted = append(sorted, key)
+		}
+	}
+	sort.Strings(sorted)
+
+	semaphores := make([]*refCountedSemaphore, 0, len(sorted))
+	for _, key := range sorted {
+		semaphore := k.get(key)
+		semaphore.slots <- struct{}{}
+		semaphores = append(semaphores, semaphore)
+	}
+	return func() {
+		for i := len(semaphores) - 1; i >= 0; i-- {
+			<-semaphores[i].slots
+			k.put(sorted[i])
+		}
+	}
+}
+
+func (k *keyedSemaphore) get(key string) *refCountedSemaphore {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.semaphores == nil {
+		k.semaphores = make(map[string]*refCountedSemaphore)
+	}
+	semaphore, ok := k.semaphores[key]
+	if !ok {
+		semaphore = &refCountedSemaphore{slots: make(chan struct{}, k.size)}
+		k.semaphores[key] = semaphore
+	}
+	semaphore.refs++
+	return semaphore
+}
+
+func (k *keyedSemaphore) put(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	semaphore := k.semaphores[key]
+	semaphore.refs--
+	if semaphore.refs == 0 {
+		delete(k.semaphores, key)
+	}
+}
@@ -0,0 +1,105 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// concurrencyTracker records the maximum number of concurrent assignments,
+// overall and per node.
+type concurrencyTracker struct {
+	*FakeCloudProvider
+	mu         sync.Mutex
+	inflight   map[string]int
+	total      int
+	maxTotal   int
+	maxPerNode int
+}
+
+func (c *concurrencyTracker) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	c.mu.Lock()
+	c.total++
+	c.inflight[node.Name]++
+	if c.total > c.maxTotal {
+		c.maxTotal = c.total
+	}
+	if c.inflight[node.Name] > c.maxPerNode {
+		c.maxPerNode = c.inflight[node.Name]
+	}
+	c.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	c.mu.Lock()
+	c.total--
+	c.inflight[node.Name]--
+	c.mu.Unlock()
+	return nil
+}
+
+func TestLimitedCloudProvider(t *testing.T) {
+	tcs := []struct {
+		maxInflight        int
+		maxInflightPerNode int
+		expectedTotal      int
+		expectedPerNode    int
+	}{
+		{maxInflight: 2, expectedTotal: 2, expectedPerNode: 2},
+		{maxInflightPerNode: 1, expectedTotal: 4, expectedPerNode: 1},
+		{maxInflight: 3, maxInflightPerNode: 1, expectedTotal: 3, expectedPerNode: 1},
+	}
+	for i, tc := range tcs {
+		tracker := &concurrencyTracker{
+			FakeCloudProvider: NewFakeCloudProvider(false, false, false, false, 0),
+			inflight:          make(map[string]int),
+		}
+		l := newLimitedCloudProvider(tracker, tc.maxInflight, tc.maxInflightPerNode)
+
+		var wg sync.WaitGroup
+		for n := 0; n < 4; n++ {
+			node := &corev1.Node{}
+			node.Name = fmt.Sprintf("node%d", n)
+			for j := 0; j < 5; j++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					l.AssignPrivateIP(context.Background(), net.ParseIP("192.0.2.1"), node)
+				}()
+			}
+		}
+		wg.Wait()
+
+		if tracker.maxTotal != tc.expectedTotal || tracker.maxPerNode != tc.expectedPerNode {
+			t.Fatalf("TestLimitedCloudProvider(%d): expected at most %d assignments in flight and %d per node, got %d and %d",
+				i, tc.expectedTotal, tc.expectedPerNode, tracker.maxTotal, tracker.maxPerNode)
+		}
+	}
+}
+
+func TestKeyedSemaphore(t *testing.T) {
+	k := keyedSemaphore{size: 1}
+
+	// Overlapping sets of keys acquired in different orders don't deadlock.
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			k.Acquire("a", "b")()
+		}()
+		go func() {
+			defer wg.Done()
+			k.Acquire("b", "a", "b")()
+		}()
+	}
+	wg.Wait()
+	if len(k.semaphores) != 0 {
+		t.Fatalf("TestKeyedSemaphore: expected all semaphores to be dropped, got %d", len(k.semaphores))
+	}
+}
@@ -0,0 +1,97 @@
+package cloudprovider
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/openshift/cloud-network-config-controller/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	cloudOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Name:      "cloud_operation_duration_seconds",
+		Help:      "Duration of the assignments, moves and releases of IP addresses on the cloud, batched ones counting once, by provider and operation.",
+		Buckets:   metrics.DefaultDurationBuckets,
+	}, []string{"provider", "operation"})
+	cloudOperationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "cloud_operations_total",
+		Help:      "Number of assignments, moves and releases of IP addresses on the cloud, by provider, operation and result: success or the class of the error.",
+	}, []string{"provider", "operation", "result"})
+	cloudOperationsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Name:      "cloud_operations_in_flight",
+		Help:      "Number of assignments, moves and releases of IP addresses running on the cloud, by provider and operation.",
+	}, []string{"provider", "operation"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		cloudOperationDuration,
+		cloudOperationsTotal,
+		cloudOperationsInFlight,
+	)
+}
+
+// instrumentedCloudProvider wraps a cloud provider, measuring the calls
+// mutating IP addresses on the cloud. It wraps the platform's provider
+// directly, so that the time spent waiting for the concurrency limits isn't
+// measured, nor the calls refused in read-only mode counted.
+type instrumentedCloudProvider struct {
+	CloudProviderIntf
+	// provider is the platform type labeling the metrics
+	provider string
+}
+
+// observe marks an operation as in flight and returns the function recording
+// its duration and the result of each of its IP addresses.
+func (i *instrumentedCloudProvider) observe(operation string) func(errs ...error) {
+	start := time.Now()
+	cloudOperationsInFlight.WithLabelValues(i.provider, operation).Inc()
+	return func(errs ...error) {
+		cloudOperationsInFlight.WithLabelValues(i.provider, operation).Dec()
+		cloudOperationDuration.WithLabelValues(i.provider, operation).Observe(time.Since(start).Seconds())
+		for _, err := range errs {
+			cloudOperationsTotal.WithLabelValues(i.provider, operation, ErrorClass(err)).Inc()
+		}
+	}
+}
+
+func (i *instrumentedCloudProvider) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	done := i.observe("assign")
+	err := i.CloudProviderIntf.AssignPrivateIP(ctx, ip, node)
+	done(err)
+	return err
+}
+
+func (i *instrumentedCloudProvider) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+	done := i.observe("move")
+	err := i.CloudProviderIntf.MovePrivateIP(ctx, ip, nodeToAdd, nodeToDel)
+	done(err)
+	return err
+}
+
+func (i *instrumentedCloudProvider) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	done := i.observe("release")
+	err := i.CloudProviderIntf.ReleasePrivateIP(ctx, ip, node)
+	done(err)
+	return err
+}
+
+func (i *instrumentedCloudProvider) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	done := i.observe("assign")
+	errs := i.CloudProviderIntf.AssignPrivateIPs(ctx, ips, node)
+	done(errs...)
+	return errs
+}
+
+func (i *instrumentedCloudProvider) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	done := i.observe("release")
+	errs := i.CloudProviderIntf.ReleasePrivateIPs(ctx, ips, node)
+	done(errs...)
+	return errs
+}
@@ -0,0 +1,61 @@
+package cloudprovider
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInstrumentedCloudProvider(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}
+	fake := NewFakeCloudProvider(false, false, false, false, 0)
+	fake.MockErrorOnAssignIPs = map[string]bool{"10.0.0.2": true}
+	instrumented := &instrumentedCloudProvider{CloudProviderIntf: fake, provider: "TestInstrumentedCloudProvider"}
+
+	if err := instrumented.AssignPrivateIP(context.Background(), net.ParseIP("10.0.0.1"), node); err != nil {
+		t.Fatalf("unexpected assignment error, err: %v", err)
+	}
+	if err := instrumented.AssignPrivateIP(context.Background(), net.ParseIP("10.0.0.2"), node); err == nil {
+		t.Fatal("expected an assignment error")
+	}
+	instrumented.ReleasePrivateIPs(context.Background(), []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.3")}, node)
+
+	for _, tc := range []struct {
+		operation string
+		result    string
+		expected  float64
+	}{
+		{operation: "assign", result: "success", expected: 1},
+		{operation: "assign", result: "unknown", expected: 1},
+		{operation: "release", result: "success", expected: 2},
+	} {
+		if value := testutil.ToFloat64(cloudOperationsTotal.WithLabelValues("TestInstrumentedCloudProvider", tc.operation, tc.result)); value != tc.expected {
+			t.Fatalf("expected %v %s operations with result %s, got %v", tc.expected, tc.operation, tc.result, value)
+		}
+	}
+	if count := histogramCount(cloudOperationDuration, "TestInstrumentedCloudProvider", "assign"); count != 2 {
+		t.Fatalf("expected the duration of 2 assignments, got %d", count)
+	}
+	if count := histogramCount(cloudOperationDuration, "TestInstrumentedCloudProvider", "release"); count != 1 {
+		t.Fatalf("expected the duration of 1 batch of releases, got %d", count)
+	}
+	if inFlight := testutil.ToFloat64(cloudOperationsInFlight.WithLabelValues("TestInstrumentedCloudProvider", "assign")); inFlight != 0 {
+		t.Fatalf("expected no assignment in flight, got %v", inFlight)
+	}
+}
+
+// histogramCount returns the number of observations of the histogram for the
+// label values.
+func histogramCount(h *prometheus.HistogramVec, labelValues ...string) uint64 {
+	metric := &dto.Metric{}
+	if err := h.WithLabelValues(labelValues...).(prometheus.Metric).Write(metric); err != nil {
+		return 0
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,57 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// readOnlyCloudProvider wraps a cloud provider, forwarding all calls which only
+// read from the cloud and refusing all calls which would mutate it. Refused
+// calls log and return the change they would have performed, wrapped in a
+// ReadOnlyError. This allows running with read-only cloud credentials, in
+// order to evaluate the controller before granting it write access.
+type readOnlyCloudProvider struct {
+	CloudProviderIntf
+}
+
+func (r *readOnlyCloudProvider) refuse(format string, args ...interface{}) error {
+	err := fmt.Errorf("%w, would %s", ReadOnlyError, fmt.Sprintf(format, args...))
+	klog.Infof("Planned change: %v", err)
+	return err
+}
+
+func (r *readOnlyCloudProvider) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	return r.refuse("assign IP address %s to node %s", ip, node.Name)
+}
+
+func (r *readOnlyCloudProvider) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+	return r.refuse("move IP address %s from node %s to node %s", ip, nodeToDel.Name, nodeToAdd.Name)
+}
+
+func (r *readOnlyCloudProvider) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	return r.refuse("release IP address %s from node %s", ip, node.Name)
+}
+
+func (r *readOnlyCloudProvider) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, r.AssignPrivateIP)
+}
+
+func (r *readOnlyCloudProvider) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, r.ReleasePrivateIP)
+}
+
+func (r *readOnlyCloudProvider) CleanupNode(ctx context.Context, node *corev1.Node) error {
+	return r.refuse("release all IP addresses of deleted node %s", node.Name)
+}
+
+func (r *readOnlyCloudProvider) ProbeReachability(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	return r.refuse("probe the reachability of IP address %s on node %s", ip, node.Name)
+}
+
+func (r *readOnlyCloudProvider) DeleteOwnedResource(ctx context.Context, resource OwnedResource) error {
+	return r.refuse("delete orphaned %s %s of IP address %s", resource.Kind, resource.ID, resource.IP)
+}
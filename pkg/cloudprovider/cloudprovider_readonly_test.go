@@ -0,0 +1,73 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestReadOnlyCloudProvider(t *testing.T) {
+	fake := NewFakeCloudProvider(false, false, false, false, 0)
+	r := &readOnlyCloudProvider{CloudProviderIntf: fake}
+
+	ip := net.ParseIP("192.0.2.1")
+	nodeA := &corev1.Node{}
+	nodeA.Name = "nodeA"
+	nodeB := &corev1.Node{}
+	nodeB.Name = "nodeB"
+
+	mutations := []error{
+		r.AssignPrivateIP(context.Background(), ip, nodeA),
+		r.MovePrivateIP(context.Background(), ip, nodeB, nodeA),
+		r.ReleasePrivateIP(context.Background(), ip, nodeA),
+		r.CleanupNode(context.Background(), nodeA),
+		r.ProbeReachability(context.Background(), ip, nodeA),
+		r.DeleteOwnedResource(context.Background(), OwnedResource{ID: "port-0", Kind: "neutron port", IP: ip}),
+		r.AssignPrivateIPs(context.Background(), []net.IP{ip}, nodeA)[0],
+		r.ReleasePrivateIPs(context.Background(), []net.IP{ip}, nodeA)[0],
+	}
+	for i, err := range mutations {
+		if !errors.Is(err, ReadOnlyError) {
+			t.Fatalf("TestReadOnlyCloudProvider(%d): expected '%s', got: %q", i, ReadOnlyError, err)
+		}
+	}
+	if len(fake.StateTracker) != 0 {
+		t.Fatalf("TestReadOnlyCloudProvider: expected no mutation to reach the cloud, got: %v", fake.StateTracker)
+	}
+
+	if err := r.VerifyPrivateIP(context.Background(), ip, nodeA); err != nil {
+		t.Fatalf("TestReadOnlyCloudProvider: received unexpected error, err: %q", err)
+	}
+	if _, err := r.GetNodeEgressIPConfiguration(context.Background(), nodeA); err != nil {
+		t.Fatalf("TestReadOnlyCloudProvider: received unexpected error, err: %q", err)
+	}
+	if len(fake.StateTracker) != 1 {
+		t.Fatalf("TestReadOnlyCloudProvider: expected reads to reach the cloud, got: %v", fake.StateTracker)
+	}
+}
+
+func TestNewCredentialValidationClient(t *testing.T) {
+	client, err := NewCredentialValidationClient(CloudProviderConfig{
+		PlatformType:              PlatformTypeNone,
+		MaxInflightCloudMutations: 1,
+		OpenStackTokenCacheDir:    t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("TestNewCredentialValidationClient: received unexpected error, err: %q", err)
+	}
+	// The client is neither instrumented nor limited, only read-only.
+	r, ok := client.(*readOnlyCloudProvider)
+	if !ok {
+		t.Fatalf("TestNewCredentialValidationClient: expected a read-only client, got: %T", client)
+	}
+	none, ok := r.CloudProviderIntf.(*None)
+	if !ok {
+		t.Fatalf("TestNewCredentialValidationClient: expected an uninstrumented client, got: %T", r.CloudProviderIntf)
+	}
+	if none.cfg.OpenStackTokenCacheDir != "" || none.cfg.OpenStackJournalStore != nil || !none.cfg.ReadOnly {
+		t.Fatalf("TestNewCredentialValidationClient: expected the background work to be disabled, got: %+v", none.cfg)
+	}
+}
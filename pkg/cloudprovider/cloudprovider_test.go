@@ -0,0 +1,270 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// fakeCloud is a cloud provider talking to the fake API of its cloud, for the
+// tests shared by the clouds.
+type fakeCloud struct {
+	CloudProviderIntf
+	// assigned returns the egress IPs the fake API holds for the node.
+	assigned func() []string
+	// close stops the fake API.
+	close func()
+}
+
+// fakeCloudTest plugs the fake API of a cloud into the tests shared by the
+// clouds. The tests of each cloud only cover its edge cases.
+type fakeCloudTest struct {
+	name string
+	// newCloud starts the fake API, with nothing assigned to the node.
+	newCloud func(t *testing.T) *fakeCloud
+	node     func() *corev1.Node
+	// ips are egress IPs of the node, assigned and released in turn.
+	ips []string
+	// nodeIP is an address of the node, which is no egress IP.
+	nodeIP string
+	// nodeIPAssignable is set if the cloud doesn't refuse to assign the
+	// address of the node.
+	nodeIPAssignable bool
+	// reservations are the reservations of ips[0] once assigned.
+	reservations []PrivateIPReservation
+	// configs are the egress IP configurations of the node once ips[0] is
+	// assigned.
+	configs []NodeEgressIPConfiguration
+}
+
+var fakeCloudTests = []fakeCloudTest{
+	{
+		name:         "IBMCloud",
+		newCloud:     newIBMCloudFakeCloud,
+		node:         func() *corev1.Node { return newIBMCloudNode("instance-0") },
+		ips:          []string{"10.240.0.10"},
+		nodeIP:       "10.240.0.4",
+		reservations: []PrivateIPReservation{{ID: "rip-10-240-0-10", Subnet: "subnet-0"}},
+		configs: []NodeEgressIPConfiguration{
+			{Interface: "vni-0", IFAddr: ifAddr{IPv4: "10.240.0.0/24"}, Capacity: capacity{IPv4: ibmCloudDefaultIPsPerInterface - 1}},
+		},
+	},
+	{
+		name:         "PowerVS",
+		newCloud:     newPowerVSFakeCloud,
+		node:         newPowerVSNode,
+		ips:          []string{"192.168.0.20"},
+		nodeIP:       "192.168.0.10",
+		reservations: []PrivateIPReservation{{ID: "port-192.168.0.20", Subnet: "net-0"}},
+		configs: []NodeEgressIPConfiguration{
+			{Interface: "net-0", IFAddr: ifAddr{IPv4: "192.168.0.0/24"}, Capacity: capacity{IPv4: powerVSDefaultIPsPerInstance - 1}},
+		},
+	},
+	{
+		name:     "VSphere",
+		newCloud: newVSphereFakeCloud,
+		node:     newVSphereNode,
+		ips:      []string{"192.168.0.20", "fd00::20"},
+		nodeIP:   "192.168.0.10",
+		// The subnets hold more addresses than the port can hold tags, less
+		// the tags of the cluster and of the egress IP.
+		configs: []NodeEgressIPConfiguration{
+			{Interface: "port-0", IFAddr: ifAddr{IPv4: "192.168.0.0/24", IPv6: "fd00::/64"}, Capacity: capacity{IPv4: nsxtMaxTags - 2, IPv6: nsxtMaxTags - 2}, MAC: "00:50:56:00:00:10"},
+		},
+	},
+	{
+		name:             "OVirt",
+		newCloud:         newOVirtFakeCloud,
+		node:             newOVirtNode,
+		ips:              []string{"192.168.0.20"},
+		nodeIP:           "192.168.0.10",
+		nodeIPAssignable: true,
+		configs: []NodeEgressIPConfiguration{
+			{Interface: "nic-1", IFAddr: ifAddr{IPv4: "192.168.0.0/24"}, Capacity: capacity{IPv4: ovirtMaxCapacity - 1}, MAC: "56:6f:00:00:00:01"},
+		},
+	},
+	{
+		name:             "AlibabaCloud",
+		newCloud:         newAlibabaCloudFakeCloud,
+		node:             newAlibabaCloudNode,
+		ips:              []string{"172.16.0.20", "2408:4000::20"},
+		nodeIP:           "172.16.0.10",
+		nodeIPAssignable: true,
+		configs: []NodeEgressIPConfiguration{
+			{Interface: "eni-0", IFAddr: ifAddr{IPv4: "172.16.0.0/24", IPv6: "2408:4000::/64"}, Capacity: capacity{IPv4: 4, IPv6: 1}, MAC: "00:16:3e:00:00:01"},
+		},
+	},
+	{
+		name:         "OCI",
+		newCloud:     newOCIFakeCloud,
+		node:         newOCINode,
+		ips:          []string{"10.0.0.20", "2603:c020::20"},
+		nodeIP:       "10.0.0.10",
+		reservations: []PrivateIPReservation{{ID: "ocid1.privateip.1", Subnet: "ocid1.subnet.a"}},
+		configs: []NodeEgressIPConfiguration{
+			{Interface: "ocid1.vnic.a", IFAddr: ifAddr{IPv4: "10.0.0.0/24", IPv6: "2603:c020::/64"}, Capacity: capacity{IPv4: ociMaxIPsPerVNIC - 1, IPv6: ociMaxIPsPerVNIC}, MAC: "02:00:17:00:00:0a"},
+		},
+	},
+	{
+		name:             "Nutanix overlay subnet",
+		newCloud:         newNutanixFakeCloud(nutanixTestOverlayUUID),
+		node:             newNutanixNode,
+		ips:              []string{"10.0.0.20"},
+		nodeIP:           "10.0.0.10",
+		nodeIPAssignable: true,
+		configs: []NodeEgressIPConfiguration{
+			{Interface: "nic-0", IFAddr: ifAddr{IPv4: "10.0.0.0/24"}, Capacity: capacity{IPv4: nutanixMaxCapacity - 1}, MAC: "50:6b:8d:00:00:01"},
+		},
+	},
+	{
+		name:             "Nutanix VLAN subnet",
+		newCloud:         newNutanixFakeCloud(nutanixTestVLANUUID),
+		node:             newNutanixNode,
+		ips:              []string{"10.0.0.20"},
+		nodeIP:           "10.0.0.10",
+		nodeIPAssignable: true,
+		configs: []NodeEgressIPConfiguration{
+			{Interface: "nic-0", IFAddr: ifAddr{IPv4: "10.0.0.0/24"}, Capacity: capacity{IPv4: nutanixMaxCapacity - 1}, MAC: "50:6b:8d:00:00:01"},
+		},
+	},
+	{
+		name:         "EquinixMetal",
+		newCloud:     newEquinixMetalFakeCloud,
+		node:         newEquinixMetalNode,
+		ips:          []string{"147.75.1.2"},
+		nodeIP:       "147.75.0.10",
+		reservations: []PrivateIPReservation{{ID: "assignment-1", Subnet: "147.75.1.0/30"}},
+		// The 4 addresses of the reservation of the metro and the 2 global
+		// ones, less the assigned one.
+		configs: []NodeEgressIPConfiguration{
+			{Interface: equinixMetalTestDeviceID, IFAddr: ifAddr{IPv4: "147.75.1.0/30"}, Capacity: capacity{IPv4: 5}, SecondaryIFAddrs: []string{"147.75.3.0/31"}},
+		},
+	},
+	{
+		name:     "Hetzner",
+		newCloud: newHetznerFakeCloud,
+		node:     newHetznerNode,
+		ips:      []string{"10.0.2.10"},
+		nodeIP:   "10.0.1.2",
+		// The subnets less their network, broadcast and gateway addresses,
+		// the address of the server and its alias IPs.
+		configs: []NodeEgressIPConfiguration{
+			{Interface: "1", IFAddr: ifAddr{IPv4: "10.0.1.0/24"}, Capacity: capacity{IPv4: 252}, MAC: "86:00:00:00:00:01"},
+			{Interface: "2", IFAddr: ifAddr{IPv4: "10.0.2.0/28"}, Capacity: capacity{IPv4: 11}, MAC: "86:00:00:00:00:02"},
+		},
+	},
+}
+
+// assignedIPs returns the egress IPs the fake API of the cloud holds, sorted.
+func (c *fakeCloud) assignedIPs() []string {
+	ips := c.assigned()
+	sort.Strings(ips)
+	return ips
+}
+
+func TestFakeCloudAssignPrivateIP(t *testing.T) {
+	for _, tc := range fakeCloudTests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, ip := range tc.ips {
+				cloud := tc.newCloud(t)
+				err := cloud.AssignPrivateIP(context.Background(), net.ParseIP(ip), tc.node())
+				assigned := cloud.assignedIPs()
+				cloud.close()
+				if err != nil {
+					t.Fatalf("received unexpected error assigning IP address %s, err: %v", ip, err)
+				}
+				if fmt.Sprint(assigned) != fmt.Sprint([]string{ip}) {
+					t.Fatalf("expected IP address %s to be assigned, got %v", ip, assigned)
+				}
+			}
+			if tc.nodeIPAssignable {
+				return
+			}
+			// The address of the node is no egress IP.
+			cloud := tc.newCloud(t)
+			err := cloud.AssignPrivateIP(context.Background(), net.ParseIP(tc.nodeIP), tc.node())
+			assigned := cloud.assignedIPs()
+			cloud.close()
+			if err == nil {
+				t.Fatalf("expected an error assigning the address %s of the node", tc.nodeIP)
+			}
+			if len(assigned) != 0 {
+				t.Fatalf("expected no IP address to be assigned, got %v", assigned)
+			}
+		})
+	}
+}
+
+func TestFakeCloudReleaseAndVerifyPrivateIP(t *testing.T) {
+	for _, tc := range fakeCloudTests {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := tc.newCloud(t)
+			defer cloud.close()
+			node := tc.node()
+
+			for i, s := range tc.ips {
+				ip := net.ParseIP(s)
+				if err := cloud.AssignPrivateIP(context.Background(), ip, node); err != nil {
+					t.Fatalf("received unexpected error assigning IP address %s, err: %v", ip, err)
+				}
+				if err := cloud.AssignPrivateIP(context.Background(), ip, node); !errors.Is(err, AlreadyExistingIPError) {
+					t.Fatalf("expected an AlreadyExistingIPError assigning assigned IP address %s, got %v", ip, err)
+				}
+				if err := cloud.VerifyPrivateIP(context.Background(), ip, node); err != nil {
+					t.Fatalf("received unexpected error verifying IP address %s, err: %v", ip, err)
+				}
+				if i == 0 {
+					reservations, err := cloud.GetPrivateIPReservations(context.Background(), ip, node)
+					if err != nil || fmt.Sprint(reservations) != fmt.Sprint(tc.reservations) {
+						t.Fatalf("expected the reservations %v of IP address %s, got %v, err: %v", tc.reservations, ip, reservations, err)
+					}
+				}
+				if err := cloud.ReleasePrivateIP(context.Background(), ip, node); err != nil {
+					t.Fatalf("received unexpected error releasing IP address %s, err: %v", ip, err)
+				}
+				if err := cloud.VerifyPrivateIP(context.Background(), ip, node); !errors.Is(err, MissingIPError) {
+					t.Fatalf("expected a MissingIPError verifying released IP address %s, got %v", ip, err)
+				}
+				if err := cloud.ReleasePrivateIP(context.Background(), ip, node); !errors.Is(err, NonExistingIPError) {
+					t.Fatalf("expected a NonExistingIPError releasing released IP address %s, got %v", ip, err)
+				}
+			}
+			if err := cloud.ReleasePrivateIP(context.Background(), net.ParseIP(tc.nodeIP), node); !errors.Is(err, NonExistingIPError) {
+				t.Fatalf("expected a NonExistingIPError releasing the address %s of the node, got %v", tc.nodeIP, err)
+			}
+			if assigned := cloud.assignedIPs(); len(assigned) != 0 {
+				t.Fatalf("expected no IP address to be left, got %v", assigned)
+			}
+		})
+	}
+}
+
+func TestFakeCloudGetNodeEgressIPConfiguration(t *testing.T) {
+	for _, tc := range fakeCloudTests {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := tc.newCloud(t)
+			defer cloud.close()
+			node := tc.node()
+
+			if err := cloud.AssignPrivateIP(context.Background(), net.ParseIP(tc.ips[0]), node); err != nil {
+				t.Fatalf("received unexpected error assigning IP address %s, err: %v", tc.ips[0], err)
+			}
+			configs, err := cloud.GetNodeEgressIPConfiguration(context.Background(), node)
+			if err != nil {
+				t.Fatalf("received unexpected error, err: %v", err)
+			}
+			found := []NodeEgressIPConfiguration{}
+			for _, config := range configs {
+				found = append(found, *config)
+			}
+			if fmt.Sprintf("%+v", found) != fmt.Sprintf("%+v", tc.configs) {
+				t.Fatalf("expected configurations %+v, got %+v", tc.configs, found)
+			}
+		})
+	}
+}
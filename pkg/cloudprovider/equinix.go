@@ -0,0 +1,426 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+const (
+	// PlatformTypeEquinixMetal is the string representation for the Equinix
+	// Metal platform type.
+	PlatformTypeEquinixMetal = "EquinixMetal"
+
+	equinixMetalDefaultAPIURL = "https://api.equinix.com/metal/v1"
+)
+
+// EquinixMetal implements the API wrapper for talking to the Equinix Metal
+// API. Egress IPs are /32 subranges of the elastic IP reservations of the
+// project, in the metro of the device or global, assigned to the device: the
+// network routes them to it.
+type EquinixMetal struct {
+	CloudProvider
+	noOwnedResources
+	client *restClient
+}
+
+type equinixMetalHref struct {
+	Href string `json:"href"`
+}
+
+type equinixMetalDevice struct {
+	ID    string `json:"id"`
+	Metro *struct {
+		Code string `json:"code"`
+	} `json:"metro"`
+	Project equinixMetalHref `json:"project"`
+}
+
+// equinixMetalIP is an elastic IP reservation of a project, or an IP address
+// assigned to a device.
+type equinixMetalIP struct {
+	ID            string `json:"id"`
+	Address       string `json:"address"`
+	Network       string `json:"network"`
+	CIDR          int    `json:"cidr"`
+	AddressFamily int    `json:"address_family"`
+	Management    bool   `json:"management"`
+	GlobalIP      bool   `json:"global_ip"`
+	Metro         *struct {
+		Code string `json:"code"`
+	} `json:"metro"`
+	ParentBlock *struct {
+		Network string `json:"network"`
+		CIDR    int    `json:"cidr"`
+	} `json:"parent_block"`
+}
+
+type equinixMetalIPList struct {
+	IPAddresses []equinixMetalIP `json:"ip_addresses"`
+}
+
+func (e *EquinixMetal) initCredentials() error {
+	apiKey, err := e.readSecretData("equinix_metal_api_key")
+	if err != nil {
+		return err
+	}
+	httpClient, err := newHTTPClient(e.cfg.ConfigDir)
+	if err != nil {
+		return err
+	}
+	baseURL := e.cfg.APIOverride
+	if baseURL == "" {
+		baseURL = equinixMetalDefaultAPIURL
+	}
+	apiKey = strings.TrimSpace(apiKey)
+	e.client = &restClient{
+		httpClient: httpClient,
+		baseURL:    baseURL,
+		authorize: func(r *http.Request) error {
+			r.Header.Set("X-Auth-Token", apiKey)
+			return nil
+		},
+	}
+	klog.Infof("Using the Equinix Metal API at %s", baseURL)
+	return nil
+}
+
+// AssignPrivateIP assigns ip, as a /32 subrange of the elastic IP reservation
+// holding it, to the node's device. It returns a ZoneMismatchError if the
+// reservation is in another metro than the device: the network wouldn't route
+// it there.
+func (e *EquinixMetal) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	if !utilnet.IsIPv4(ip) {
+		return fmt.Errorf("Equinix Metal elastic IPs are IPv4 only, can't assign IP address %s", ip)
+	}
+	device, err := e.getDevice(ctx, node)
+	if err != nil {
+		return err
+	}
+	assignment, err := e.getAssignment(ctx, device, ip)
+	if err != nil {
+		return err
+	}
+	if assignment != nil {
+		return AlreadyExistingIPError
+	}
+	reservations, err := e.listReservations(ctx, device)
+	if err != nil {
+		return err
+	}
+	var reservation *equinixMetalIP
+	for i := range reservations {
+		if getEquinixMetalCIDR(&reservations[i]).Contains(ip) {
+			reservation = &reservations[i]
+		}
+	}
+	if reservation == nil {
+		return fmt.Errorf("IP address %s is in no elastic IP reservation of the project of device %s", ip, device.ID)
+	}
+	if !isEquinixMetalReservationUsable(reservation, device) {
+		return fmt.Errorf("%w: elastic IP reservation %s of IP address %s is in metro %s, device %s in metro %s",
+			ZoneMismatchError, reservation.ID, ip, reservation.Metro.Code, device.ID, device.Metro.Code)
+	}
+	if err := e.client.do(ctx, http.MethodPost, fmt.Sprintf("/devices/%s/ips", device.ID), nil, map[string]interface{}{
+		"address":    ip.String() + "/32",
+		"manageable": true,
+	}, nil); err != nil {
+		return fmt.Errorf("error assigning IP address %s to device %s, err: %v", ip, device.ID, err)
+	}
+	return nil
+}
+
+func (e *EquinixMetal) AllowsMovePrivateIP() bool {
+	return false
+}
+
+func (e *EquinixMetal) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+	return nil
+}
+
+// ReleasePrivateIP deletes the assignment of ip to the node's device, which
+// returns it to its reservation.
+func (e *EquinixMetal) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	device, err := e.getDevice(ctx, node)
+	if err != nil {
+		return err
+	}
+	assignment, err := e.getAssignment(ctx, device, ip)
+	if err != nil {
+		return err
+	}
+	if assignment == nil {
+		return NonExistingIPError
+	}
+	return e.client.do(ctx, http.MethodDelete, "/ips/"+assignment.ID, nil, nil, nil)
+}
+
+func (e *EquinixMetal) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, e.AssignPrivateIP)
+}
+
+func (e *EquinixMetal) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, e.ReleasePrivateIP)
+}
+
+// GetNodeEgressIPConfiguration returns the configuration of the node's device,
+// keyed by ID. Its subnets are the elastic IP reservations usable in the metro
+// of the device, the first one as IFAddr. Its capacity is the number of
+// addresses left in those, or the number of prefixes the BGP sessions of the
+// device may still announce, if that's lower: on projects with BGP enabled,
+// elastic IPs are commonly announced by the device rather than routed to it.
+func (e *EquinixMetal) GetNodeEgressIPConfiguration(ctx context.Context, node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
+	device, err := e.getDevice(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	reservations, err := e.listReservations(ctx, device)
+	if err != nil {
+		return nil, err
+	}
+	var cidrs []string
+	available := 0
+	for i := range reservations {
+		if !isEquinixMetalReservationUsable(&reservations[i], device) || reservations[i].AddressFamily != 4 {
+			continue
+		}
+		cidrs = append(cidrs, getEquinixMetalCIDR(&reservations[i]).String())
+		response := &struct {
+			Available []string `json:"available"`
+		}{}
+		if err := e.client.do(ctx, http.MethodGet, fmt.Sprintf("/ips/%s/available", reservations[i].ID), url.Values{"cidr": {"32"}}, nil, response); err != nil {
+			return nil, fmt.Errorf("error retrieving the available addresses of elastic IP reservation %s, err: %v", reservations[i].ID, err)
+		}
+		available += len(response.Available)
+	}
+	if len(cidrs) == 0 {
+		return nil, fmt.Errorf("%w: the project of device %s has no elastic IP reservation usable in its metro", NoNetworkInterfaceError, device.ID)
+	}
+	sort.Strings(cidrs)
+	prefixes, err := e.getAnnouncablePrefixes(ctx, device)
+	if err != nil {
+		return nil, err
+	}
+	if prefixes >= 0 && prefixes < available {
+		available = prefixes
+	}
+	return []*NodeEgressIPConfiguration{
+		{
+			Interface:        device.ID,
+			IFAddr:           ifAddr{IPv4: cidrs[0]},
+			Capacity:         capacity{IPv4: available},
+			SecondaryIFAddrs: cidrs[1:],
+		},
+	}, nil
+}
+
+// CleanupNode is a no-op, the assignments are deleted together with the
+// device.
+func (e *EquinixMetal) CleanupNode(ctx context.Context, node *corev1.Node) error {
+	return nil
+}
+
+// VerifyPrivateIP verifies that ip is still assigned to the node's device,
+// wrapping a MissingIPError otherwise.
+func (e *EquinixMetal) VerifyPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	device, err := e.getDevice(ctx, node)
+	if err != nil {
+		return err
+	}
+	assignment, err := e.getAssignment(ctx, device, ip)
+	if err != nil {
+		return err
+	}
+	if assignment == nil {
+		return fmt.Errorf("%w: IP address %s is not assigned to device %s", MissingIPError, ip, device.ID)
+	}
+	return nil
+}
+
+// GetPrivateIPReservations returns the assignment of ip to the node's device.
+func (e *EquinixMetal) GetPrivateIPReservations(ctx context.Context, ip net.IP, node *corev1.Node) ([]PrivateIPReservation, error) {
+	device, err := e.getDevice(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	assignment, err := e.getAssignment(ctx, device, ip)
+	if err != nil || assignment == nil {
+		return nil, err
+	}
+	return []PrivateIPReservation{{ID: assignment.ID, Subnet: fmt.Sprintf("%s/%d", assignment.ParentBlock.Network, assignment.ParentBlock.CIDR)}}, nil
+}
+
+// GetNodeNetworkInterfaces returns nil, devices have no network interfaces of
+// their own on the API.
+func (e *EquinixMetal) GetNodeNetworkInterfaces(ctx context.Context, node *corev1.Node) ([]string, error) {
+	return nil, nil
+}
+
+// ListPrivateIPs returns the addresses of the elastic IP subranges assigned
+// to the node's device, its management addresses aside.
+func (e *EquinixMetal) ListPrivateIPs(ctx context.Context, node *corev1.Node) ([]net.IP, error) {
+	device, err := e.getDevice(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	list := &equinixMetalIPList{}
+	if err := e.client.do(ctx, http.MethodGet, fmt.Sprintf("/devices/%s/ips", device.ID), nil, nil, list); err != nil {
+		return nil, fmt.Errorf("error retrieving the IP addresses of device %s, err: %v", device.ID, err)
+	}
+	ips := []net.IP{}
+	for _, assignment := range list.IPAddresses {
+		if !assignment.Management && assignment.ParentBlock != nil {
+			ips = append(ips, ParseIP(assignment.Address))
+		}
+	}
+	return ips, nil
+}
+
+// CheckHealth retrieves the node's device.
+func (e *EquinixMetal) CheckHealth(ctx context.Context, node *corev1.Node) error {
+	_, err := e.getDevice(ctx, node)
+	return err
+}
+
+func (e *EquinixMetal) getDevice(ctx context.Context, node *corev1.Node) (*equinixMetalDevice, error) {
+	deviceID, err := getEquinixMetalDeviceID(node)
+	if err != nil {
+		return nil, err
+	}
+	device := &equinixMetalDevice{}
+	if err := e.client.do(ctx, http.MethodGet, "/devices/"+deviceID, nil, nil, device); err != nil {
+		return nil, fmt.Errorf("error retrieving device %s of node %s, err: %v", deviceID, node.Name, err)
+	}
+	if device.Metro == nil {
+		return nil, fmt.Errorf("device %s of node %s is in no metro", deviceID, node.Name)
+	}
+	return device, nil
+}
+
+// getAssignment returns the assignment of ip to the device, nil if there's
+// none. The management addresses of the device, the node's, aren't
+// considered.
+func (e *EquinixMetal) getAssignment(ctx context.Context, device *equinixMetalDevice, ip net.IP) (*equinixMetalIP, error) {
+	list := &equinixMetalIPList{}
+	if err := e.client.do(ctx, http.MethodGet, fmt.Sprintf("/devices/%s/ips", device.ID), nil, nil, list); err != nil {
+		return nil, fmt.Errorf("error retrieving the IP addresses of device %s, err: %v", device.ID, err)
+	}
+	for _, assignment := range list.IPAddresses {
+		if !assignment.Management && assignment.ParentBlock != nil && ParseIP(assignment.Address).Equal(ip) {
+			return &assignment, nil
+		}
+	}
+	return nil, nil
+}
+
+// listReservations returns the elastic IP reservations of the project of the
+// device, the blocks of management addresses of the devices aside.
+func (e *EquinixMetal) listReservations(ctx context.Context, device *equinixMetalDevice) ([]equinixMetalIP, error) {
+	list := &equinixMetalIPList{}
+	if err := e.client.do(ctx, http.MethodGet, getEquinixMetalProjectPath(device)+"/ips", url.Values{
+		"types": {"public_ipv4", "private_ipv4", "global_ipv4"},
+	}, nil, list); err != nil {
+		return nil, fmt.Errorf("error retrieving the elastic IP reservations of the project of device %s, err: %v", device.ID, err)
+	}
+	reservations := []equinixMetalIP{}
+	for _, reservation := range list.IPAddresses {
+		if !reservation.Management {
+			reservations = append(reservations, reservation)
+		}
+	}
+	return reservations, nil
+}
+
+// getAnnouncablePrefixes returns the number of prefixes the IPv4 BGP sessions
+// of the device may still announce, -1 if BGP isn't enabled on the project or
+// the device has no IPv4 BGP session.
+func (e *EquinixMetal) getAnnouncablePrefixes(ctx context.Context, device *equinixMetalDevice) (int, error) {
+	config := &struct {
+		Status    string `json:"status"`
+		MaxPrefix int    `json:"max_prefix"`
+	}{}
+	if err := e.client.do(ctx, http.MethodGet, getEquinixMetalProjectPath(device)+"/bgp-config", nil, nil, config); err != nil {
+		if isRESTStatus(err, http.StatusNotFound) {
+			return -1, nil
+		}
+		return 0, fmt.Errorf("error retrieving the BGP configuration of the project of device %s, err: %v", device.ID, err)
+	}
+	if config.Status != "enabled" || config.MaxPrefix <= 0 {
+		return -1, nil
+	}
+	sessions := &struct {
+		BGPSessions []struct {
+			AddressFamily string `json:"address_family"`
+		} `json:"bgp_sessions"`
+	}{}
+	if err := e.client.do(ctx, http.MethodGet, fmt.Sprintf("/devices/%s/bgp/sessions", device.ID), nil, nil, sessions); err != nil {
+		return 0, fmt.Errorf("error retrieving the BGP sessions of device %s, err: %v", device.ID, err)
+	}
+	for _, session := range sessions.BGPSessions {
+		if session.AddressFamily != "ipv4" {
+			continue
+		}
+		list := &equinixMetalIPList{}
+		if err := e.client.do(ctx, http.MethodGet, fmt.Sprintf("/devices/%s/ips", device.ID), nil, nil, list); err != nil {
+			return 0, fmt.Errorf("error retrieving the IP addresses of device %s, err: %v", device.ID, err)
+		}
+		announced := 0
+		for _, assignment := range list.IPAddresses {
+			if !assignment.Management && assignment.AddressFamily == 4 {
+				announced++
+			}
+		}
+		if announced > config.MaxPrefix {
+			return 0, nil
+		}
+		return config.MaxPrefix - announced, nil
+	}
+	return -1, nil
+}
+
+// isEquinixMetalReservationUsable returns true if the reservation is global,
+// or in the metro of the device.
+func isEquinixMetalReservationUsable(reservation *equinixMetalIP, device *equinixMetalDevice) bool {
+	return reservation.GlobalIP || (reservation.Metro != nil && reservation.Metro.Code == device.Metro.Code)
+}
+
+// getEquinixMetalProjectPath returns the API path of the project of the
+// device, out of its href, which starts with the path of the API, e.g.
+// /metal/v1/projects/<project ID>.
+func getEquinixMetalProjectPath(device *equinixMetalDevice) string {
+	return "/projects/" + path.Base(device.Project.Href)
+}
+
+func getEquinixMetalCIDR(reservation *equinixMetalIP) *net.IPNet {
+	_, cidr, err := net.ParseCIDR(fmt.Sprintf("%s/%d", reservation.Network, reservation.CIDR))
+	if err != nil {
+		return &net.IPNet{}
+	}
+	return cidr
+}
+
+// getEquinixMetalDeviceID returns the ID of the node's device, out of its
+// providerID, which looks like equinixmetal://<device ID>, or packet://<device
+// ID> for clusters installed before the rebranding.
+func getEquinixMetalDeviceID(node *corev1.Node) (string, error) {
+	for _, prefix := range []string{"equinixmetal://", "packet://"} {
+		if !strings.HasPrefix(node.Spec.ProviderID, prefix) {
+			continue
+		}
+		deviceID := strings.TrimPrefix(node.Spec.ProviderID, prefix)
+		if _, err := uuid.Parse(deviceID); err == nil {
+			return deviceID, nil
+		}
+	}
+	return "", fmt.Errorf("failed to parse node %s provider id %q, expected equinixmetal://<device ID>", node.Name, node.Spec.ProviderID)
+}
@@ -0,0 +1,294 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	equinixMetalTestDeviceID  = "7c9a5f2e-3d41-4b6a-9e0f-1a2b3c4d5e01"
+	equinixMetalTestProjectID = "7c9a5f2e-3d41-4b6a-9e0f-1a2b3c4d5e02"
+)
+
+// fakeEquinixMetal serves the Equinix Metal API requests of device
+// equinixMetalTestDeviceID, in metro da, whose management address is
+// 147.75.0.10. The project reserves 147.75.1.0/30 in metro da, 147.75.2.0/30
+// in metro ny and 147.75.3.0/31 globally.
+type fakeEquinixMetal struct {
+	mu sync.Mutex
+	// assigned maps the assigned addresses to the IDs of their assignments.
+	assigned map[string]string
+	// bgpStatus and maxPrefix are the BGP configuration of the project,
+	// bgpSessions the address families of the BGP sessions of the device.
+	bgpStatus   string
+	maxPrefix   int
+	bgpSessions []string
+	assignments int
+}
+
+var fakeEquinixMetalReservations = []struct {
+	id, cidr, metro string
+}{
+	{id: "reservation-da", cidr: "147.75.1.0/30", metro: "da"},
+	{id: "reservation-ny", cidr: "147.75.2.0/30", metro: "ny"},
+	{id: "reservation-global", cidr: "147.75.3.0/31"},
+}
+
+func (f *fakeEquinixMetal) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Header.Get("X-Auth-Token") != "token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	const (
+		devicePath  = "/metal/v1/devices/" + equinixMetalTestDeviceID
+		projectPath = "/metal/v1/projects/" + equinixMetalTestProjectID
+	)
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == devicePath:
+		_, _ = fmt.Fprintf(w, `{"id": "%s", "metro": {"code": "da"}, "project": {"href": "%s"}}`, equinixMetalTestDeviceID, projectPath)
+	case r.Method == http.MethodGet && r.URL.Path == devicePath+"/ips":
+		ips := []string{`{"id": "management", "address": "147.75.0.10", "address_family": 4, "management": true, "parent_block": {"network": "147.75.0.0", "cidr": 29}}`}
+		for address, id := range f.assigned {
+			for _, reservation := range fakeEquinixMetalReservations {
+				if _, cidr, _ := net.ParseCIDR(reservation.cidr); cidr.Contains(net.ParseIP(address)) {
+					ones, _ := cidr.Mask.Size()
+					ips = append(ips, fmt.Sprintf(`{"id": "%s", "address": "%s", "address_family": 4, "parent_block": {"network": "%s", "cidr": %d}}`, id, address, cidr.IP, ones))
+				}
+			}
+		}
+		_, _ = fmt.Fprintf(w, `{"ip_addresses": [%s]}`, strings.Join(ips, ","))
+	case r.Method == http.MethodPost && r.URL.Path == devicePath+"/ips":
+		request := struct {
+			Address string `json:"address"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || !strings.HasSuffix(request.Address, "/32") {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		address := strings.TrimSuffix(request.Address, "/32")
+		if _, ok := f.assigned[address]; ok {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		if f.assigned == nil {
+			f.assigned = map[string]string{}
+		}
+		f.assignments++
+		f.assigned[address] = fmt.Sprintf("assignment-%d", f.assignments)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprintf(w, `{"id": "%s"}`, f.assigned[address])
+	case r.Method == http.MethodGet && r.URL.Path == projectPath+"/ips":
+		if r.URL.Query().Get("types") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		ips := []string{`{"id": "management", "network": "147.75.0.0", "cidr": 29, "address_family": 4, "management": true, "metro": {"code": "da"}}`}
+		for _, reservation := range fakeEquinixMetalReservations {
+			ip, cidr, _ := net.ParseCIDR(reservation.cidr)
+			ones, _ := cidr.Mask.Size()
+			location := fmt.Sprintf(`"metro": {"code": "%s"}`, reservation.metro)
+			if reservation.metro == "" {
+				location = `"global_ip": true`
+			}
+			ips = append(ips, fmt.Sprintf(`{"id": "%s", "network": "%s", "cidr": %d, "address_family": 4, %s}`, reservation.id, ip, ones, location))
+		}
+		_, _ = fmt.Fprintf(w, `{"ip_addresses": [%s]}`, strings.Join(ips, ","))
+	case r.Method == http.MethodGet && r.URL.Path == projectPath+"/bgp-config":
+		if f.bgpStatus == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"status": "%s", "max_prefix": %d}`, f.bgpStatus, f.maxPrefix)
+	case r.Method == http.MethodGet && r.URL.Path == devicePath+"/bgp/sessions":
+		sessions := []string{}
+		for _, addressFamily := range f.bgpSessions {
+			sessions = append(sessions, fmt.Sprintf(`{"address_family": "%s"}`, addressFamily))
+		}
+		_, _ = fmt.Fprintf(w, `{"bgp_sessions": [%s]}`, strings.Join(sessions, ","))
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/metal/v1/ips/") && strings.HasSuffix(r.URL.Path, "/available"):
+		if r.URL.Query().Get("cidr") != "32" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/metal/v1/ips/"), "/available")
+		for _, reservation := range fakeEquinixMetalReservations {
+			if reservation.id != id {
+				continue
+			}
+			available := []string{}
+			ip, cidr, _ := net.ParseCIDR(reservation.cidr)
+			for ip := ip.To4(); cidr.Contains(ip); ip[3]++ {
+				if _, ok := f.assigned[ip.String()]; !ok {
+					available = append(available, fmt.Sprintf(`"%s/32"`, ip))
+				}
+			}
+			_, _ = fmt.Fprintf(w, `{"available": [%s]}`, strings.Join(available, ","))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/metal/v1/ips/"):
+		id := strings.TrimPrefix(r.URL.Path, "/metal/v1/ips/")
+		for address, assignment := range f.assigned {
+			if assignment == id {
+				delete(f.assigned, address)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeEquinixMetalProvider(server *httptest.Server) *EquinixMetal {
+	return &EquinixMetal{
+		CloudProvider: CloudProvider{ctx: context.Background()},
+		client: &restClient{
+			httpClient: server.Client(),
+			baseURL:    server.URL + "/metal/v1",
+			authorize: func(r *http.Request) error {
+				r.Header.Set("X-Auth-Token", "token")
+				return nil
+			},
+		},
+	}
+}
+
+func newEquinixMetalNode() *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0"},
+		Spec:       corev1.NodeSpec{ProviderID: "equinixmetal://" + equinixMetalTestDeviceID},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "147.75.0.10"}},
+		},
+	}
+}
+
+// newEquinixMetalFakeCloud plugs the fake API into the tests shared by the
+// clouds.
+func newEquinixMetalFakeCloud(t *testing.T) *fakeCloud {
+	fake := &fakeEquinixMetal{}
+	server := httptest.NewServer(fake)
+	return &fakeCloud{
+		CloudProviderIntf: newFakeEquinixMetalProvider(server),
+		assigned: func() []string {
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			ips := []string{}
+			for ip := range fake.assigned {
+				ips = append(ips, ip)
+			}
+			return ips
+		},
+		close: server.Close,
+	}
+}
+
+func TestEquinixMetalAssignPrivateIP(t *testing.T) {
+	tcs := []struct {
+		ip          string
+		assigned    map[string]string
+		expectedErr error
+		expectErr   bool
+	}{
+		// Global reservations are assignable in any metro.
+		{ip: "147.75.3.1"},
+		// The reservation is in another metro.
+		{ip: "147.75.2.1", expectedErr: ZoneMismatchError},
+		// Neither out of the reservations, nor the management addresses.
+		{ip: "147.75.4.1", expectErr: true},
+		{ip: "147.75.0.11", expectErr: true},
+		{ip: "2604:1380::1", expectErr: true},
+	}
+	for i, tc := range tcs {
+		fake := &fakeEquinixMetal{assigned: tc.assigned}
+		server := httptest.NewServer(fake)
+		provider := newFakeEquinixMetalProvider(server)
+		err := provider.AssignPrivateIP(context.Background(), net.ParseIP(tc.ip), newEquinixMetalNode())
+		server.Close()
+		if tc.expectedErr != nil {
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("TestEquinixMetalAssignPrivateIP(%d): expected error %v, got %v", i, tc.expectedErr, err)
+			}
+			continue
+		}
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestEquinixMetalAssignPrivateIP(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		if _, ok := fake.assigned[tc.ip]; ok == tc.expectErr {
+			t.Fatalf("TestEquinixMetalAssignPrivateIP(%d): expected IP address %s to be assigned: %v, got %v", i, tc.ip, !tc.expectErr, fake.assigned)
+		}
+	}
+}
+
+func TestEquinixMetalCapacity(t *testing.T) {
+	tcs := []struct {
+		assigned    map[string]string
+		bgpStatus   string
+		maxPrefix   int
+		bgpSessions []string
+		expected    int
+	}{
+		// The 4 addresses of the reservation of the metro, the 2 global ones.
+		{expected: 6},
+		{assigned: map[string]string{"147.75.1.1": "assignment-0"}, expected: 5},
+		{bgpStatus: "enabled", maxPrefix: 2, bgpSessions: []string{"ipv4"}, expected: 2},
+		{bgpStatus: "enabled", maxPrefix: 2, bgpSessions: []string{"ipv4"}, assigned: map[string]string{"147.75.1.1": "assignment-0"}, expected: 1},
+		{bgpStatus: "enabled", maxPrefix: 10, bgpSessions: []string{"ipv4"}, expected: 6},
+		// BGP doesn't limit the capacity of devices without IPv4 sessions, or
+		// on projects without BGP.
+		{bgpStatus: "enabled", maxPrefix: 2, bgpSessions: []string{"ipv6"}, expected: 6},
+		{bgpStatus: "disabled", maxPrefix: 2, bgpSessions: []string{"ipv4"}, expected: 6},
+	}
+	for i, tc := range tcs {
+		fake := &fakeEquinixMetal{assigned: tc.assigned, bgpStatus: tc.bgpStatus, maxPrefix: tc.maxPrefix, bgpSessions: tc.bgpSessions}
+		server := httptest.NewServer(fake)
+		provider := newFakeEquinixMetalProvider(server)
+		configs, err := provider.GetNodeEgressIPConfiguration(context.Background(), newEquinixMetalNode())
+		server.Close()
+		if err != nil {
+			t.Fatalf("TestEquinixMetalCapacity(%d): received unexpected error, err: %v", i, err)
+		}
+		if len(configs) != 1 || configs[0].Interface != equinixMetalTestDeviceID || configs[0].IFAddr.IPv4 != "147.75.1.0/30" ||
+			fmt.Sprint(configs[0].SecondaryIFAddrs) != "[147.75.3.0/31]" || configs[0].Capacity.IPv4 != tc.expected {
+			t.Fatalf("TestEquinixMetalCapacity(%d): expected a capacity of %d, got %+v", i, tc.expected, configs)
+		}
+	}
+}
+
+func TestGetEquinixMetalDeviceID(t *testing.T) {
+	tcs := []struct {
+		providerID string
+		expected   string
+		expectErr  bool
+	}{
+		{providerID: "equinixmetal://" + equinixMetalTestDeviceID, expected: equinixMetalTestDeviceID},
+		{providerID: "packet://" + equinixMetalTestDeviceID, expected: equinixMetalTestDeviceID},
+		{providerID: equinixMetalTestDeviceID, expectErr: true},
+		{providerID: "equinixmetal://device-0", expectErr: true},
+		{providerID: "", expectErr: true},
+	}
+	for i, tc := range tcs {
+		deviceID, err := getEquinixMetalDeviceID(&corev1.Node{Spec: corev1.NodeSpec{ProviderID: tc.providerID}})
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestGetEquinixMetalDeviceID(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		if !tc.expectErr && deviceID != tc.expected {
+			t.Fatalf("TestGetEquinixMetalDeviceID(%d): expected device ID %q, got %q", i, tc.expected, deviceID)
+		}
+	}
+}
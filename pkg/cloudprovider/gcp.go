@@ -1,14 +1,20 @@
 package cloudprovider
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net"
+	"net/http"
 	"net/url"
 	"strings"
 
+	"golang.org/x/oauth2"
 	google "google.golang.org/api/compute/v1"
 	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
 	utilnet "k8s.io/utils/net"
 )
 
@@ -26,20 +32,72 @@ const (
 type GCP struct {
 	CloudProvider
 	client *google.Service
+	// networkInterfaceSelector selects the network interface egress IPs are
+	// assigned to on nodes without selector annotation, the first one if nil.
+	networkInterfaceSelector *gcpNetworkInterfaceSelector
+	// updates collect concurrent changes to the same network interface, if
+	// GCPUpdateBatchWindow is set.
+	updates gcpNetworkInterfaceUpdates
+	// calls are the AssignPrivateIPs and ReleasePrivateIPs calls in
+	// progress, whose changes are applied without waiting for the batch
+	// window.
+	calls batchCalls
+	// networkInterfaceLocks serializes the batched updates of each network
+	// interface, keyed by gcpNetworkInterfaceRef.
+	networkInterfaceLocks keyedMutex
+	// project is the project of the credentials, in which the instances of
+	// nodes without providerID are looked up.
+	project string
+	// instances caches the instances of nodes without providerID.
+	instances gcpInstanceCache
+	// resourceLabels are the extra labels set on the instances whose network
+	// interfaces the controller changes.
+	resourceLabels map[string]string
 }
 
 func (g *GCP) initCredentials() (err error) {
-	rawSecretData, err := g.readSecretData("service_account.json")
+	if g.networkInterfaceSelector, err = parseGCPNetworkInterfaceSelector(g.cfg.GCPNetworkInterfaceSelector); err != nil {
+		return err
+	}
+	if g.resourceLabels, err = parseGCPResourceLabels(g.cfg.GCPResourceLabels); err != nil {
+		return err
+	}
+
+	credentialsJSON, err := g.getCredentialsJSON()
 	if err != nil {
 		return err
 	}
+	var credentials struct {
+		ProjectID string `json:"project_id"`
+	}
+	if err := json.Unmarshal(credentialsJSON, &credentials); err == nil {
+		g.project = credentials.ProjectID
+	}
 
-	opts := []option.ClientOption{
-		option.WithCredentialsJSON([]byte(rawSecretData)),
+	// Send the requests, including the ones fetching tokens, through the
+	// cluster-wide proxy and trust the custom CA bundle, if any.
+	httpClient, err := newHTTPClient(g.cfg.ConfigDir)
+	if err != nil {
+		return err
+	}
+	transport, err := htransport.NewTransport(context.WithValue(g.ctx, oauth2.HTTPClient, httpClient), httpClient.Transport,
+		option.WithCredentialsJSON(credentialsJSON),
+		option.WithScopes(google.CloudPlatformScope),
 		option.WithUserAgent(UserAgent),
+	)
+	if err != nil {
+		return fmt.Errorf("error: cannot initialize google client, err: %v", err)
+	}
+	opts := []option.ClientOption{
+		option.WithHTTPClient(&http.Client{Transport: &gcpRetryTransport{next: transport}}),
 	}
 	if g.cfg.APIOverride != "" {
-		opts = append(opts, option.WithEndpoint(g.cfg.APIOverride))
+		endpoint, err := getGCPComputeEndpoint(g.cfg.APIOverride)
+		if err != nil {
+			return err
+		}
+		klog.Infof("Using the Compute API endpoint %s", endpoint)
+		opts = append(opts, option.WithEndpoint(endpoint))
 	}
 
 	g.client, err = google.NewService(g.ctx, opts...)
@@ -49,12 +107,31 @@ func (g *GCP) initCredentials() (err error) {
 	return nil
 }
 
+// getGCPComputeEndpoint returns the base path of the Compute API at apiURL,
+// e.g. https://restricted.googleapis.com/compute/v1/ for the restricted VIP of
+// Private Google Access, https://restricted.googleapis.com, or a Private
+// Service Connect endpoint. The path of the Compute API is appended to URLs
+// without path.
+func getGCPComputeEndpoint(apiURL string) (string, error) {
+	u, err := url.Parse(apiURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid GCP API URL %q, expected e.g. https://restricted.googleapis.com", apiURL)
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		u.Path = "/compute/v1"
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u.String(), nil
+}
+
 // AssignPrivateIP adds the IP to the associated instance's IP aliases.
 // Important: GCP IP aliases can come in all forms, i.e: if you add 10.0.32.25
 // GCP can return 10.0.32.25/32 or 10.0.32.25 - we thus need to check for both
 // when validating that the IP provided doesn't already exist
-func (g *GCP) AssignPrivateIP(ip net.IP, node *corev1.Node) error {
-	project, zone, instance, err := g.getInstance(node)
+func (g *GCP) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	project, zone, instance, err := g.getInstance(ctx, node)
 	if err != nil {
 		return err
 	}
@@ -62,40 +139,173 @@ func (g *GCP) AssignPrivateIP(ip net.IP, node *corev1.Node) error {
 	if err != nil {
 		return err
 	}
-	// Perform the operation against the first interface listed following the
-	// order GCP specifies.
-	networkInterface := networkInterfaces[0]
-	for _, aliasIPRange := range networkInterface.AliasIpRanges {
-		if assignedIP := net.ParseIP(aliasIPRange.IpCidrRange); assignedIP.Equal(ip) {
-			return AlreadyExistingIPError
-		}
-		if _, assignedSubnet, err := net.ParseCIDR(aliasIPRange.IpCidrRange); err == nil && assignedSubnet.Contains(ip) {
-			return AlreadyExistingIPError
-		}
-	}
-	networkInterface.AliasIpRanges = append(networkInterface.AliasIpRanges, &google.AliasIpRange{
-		IpCidrRange: ip.String(),
-	})
-	operation, err := g.client.Instances.UpdateNetworkInterface(project, zone, instance.Name, networkInterface.Name, networkInterface).Do()
+	// Perform the operation against the selected interface, by default the
+	// first interface listed following the order GCP specifies.
+	networkInterface, err := g.selectNetworkInterface(node, networkInterfaces)
 	if err != nil {
 		return err
 	}
-	return g.waitForCompletion(project, zone, operation.Name)
+	// IPv6 egress IPs are addresses of the IPv6 range routed to the network
+	// interface, there's nothing to assign.
+	if utilnet.IsIPv6(ip) {
+		return checkGCPIPv6(ip, networkInterface)
+	}
+	if hasGCPAliasIP(networkInterface, ip) {
+		return AlreadyExistingIPError
+	}
+	if err := g.updateNetworkInterface(ctx, project, zone, instance, networkInterface, gcpAliasIPChange{ip: ip, add: true}); err != nil {
+		return err
+	}
+	g.labelInstance(ctx, project, zone, instance)
+	return nil
 }
 
 func (g *GCP) AllowsMovePrivateIP() bool {
 	return false
 }
 
-func (g *GCP) MovePrivateIP(ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+func (g *GCP) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+	return nil
+}
+
+// CleanupNode is a no-op, private IPs are deleted together with the instance.
+func (g *GCP) CleanupNode(ctx context.Context, node *corev1.Node) error {
+	return nil
+}
+
+// VerifyPrivateIP verifies that an alias IP range of the selected network
+// interface of the node still holds ip, wrapping a MissingIPError otherwise,
+// e.g. if it was removed in the console or with gcloud. IPv6 egress IPs are
+// verified to still be in the IPv6 range of the network interface.
+func (g *GCP) VerifyPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	_, _, instance, err := g.getInstance(ctx, node)
+	if err != nil {
+		return err
+	}
+	networkInterfaces, err := g.getNetworkInterfaces(instance)
+	if err != nil {
+		return err
+	}
+	networkInterface, err := g.selectNetworkInterface(node, networkInterfaces)
+	if err != nil {
+		return err
+	}
+	if utilnet.IsIPv6(ip) {
+		if err := checkGCPIPv6(ip, networkInterface); err != nil {
+			return fmt.Errorf("%w: %v", MissingIPError, err)
+		}
+		return nil
+	}
+	if !hasGCPAliasIP(networkInterface, ip) {
+		return fmt.Errorf("%w: IP address %s is not an alias IP range of network interface %s of instance %s", MissingIPError, ip, networkInterface.Name, instance.Name)
+	}
 	return nil
 }
 
+// GetPrivateIPReservations returns nil, the IP address is held by the
+// instance's interface itself.
+func (g *GCP) GetPrivateIPReservations(ctx context.Context, ip net.IP, node *corev1.Node) ([]PrivateIPReservation, error) {
+	return nil, nil
+}
+
+// GetNodeNetworkInterfaces returns nil, the instance's network interfaces are
+// fixed at creation.
+func (g *GCP) GetNodeNetworkInterfaces(ctx context.Context, node *corev1.Node) ([]string, error) {
+	return nil, nil
+}
+
+// ListPrivateIPs returns the IPv4 addresses of the /32 alias IP ranges of the
+// node's network interface, ranges of other sizes aren't assigned by us. The
+// IPv6 addresses, taken from the interface's /96 range, aren't tracked by the
+// cloud and can't be listed.
+func (g *GCP) ListPrivateIPs(ctx context.Context, node *corev1.Node) ([]net.IP, error) {
+	_, networkInterface, err := g.getSelectedNetworkInterface(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	return getGCPAliasIPs(networkInterface), nil
+}
+
+// getSelectedNetworkInterface returns the node's instance and its network
+// interface the IP addresses are assigned to.
+func (g *GCP) getSelectedNetworkInterface(ctx context.Context, node *corev1.Node) (*google.Instance, *google.NetworkInterface, error) {
+	_, _, instance, err := g.getInstance(ctx, node)
+	if err != nil {
+		return nil, nil, err
+	}
+	networkInterfaces, err := g.getNetworkInterfaces(instance)
+	if err != nil {
+		return nil, nil, err
+	}
+	networkInterface, err := g.selectNetworkInterface(node, networkInterfaces)
+	if err != nil {
+		return nil, nil, err
+	}
+	return instance, networkInterface, nil
+}
+
+// getGCPAliasIPs returns the IPv4 addresses of the /32 alias IP ranges of the
+// network interface.
+func getGCPAliasIPs(networkInterface *google.NetworkInterface) []net.IP {
+	ips := []net.IP{}
+	for _, aliasIPRange := range networkInterface.AliasIpRanges {
+		if ip := ParseIP(aliasIPRange.IpCidrRange); ip != nil {
+			ips = append(ips, ip)
+			continue
+		}
+		if ip, ipNet, err := net.ParseCIDR(aliasIPRange.IpCidrRange); err == nil {
+			if ones, bits := ipNet.Mask.Size(); ones == bits {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return ips
+}
+
+// CheckHealth retrieves the node's instance.
+func (g *GCP) CheckHealth(ctx context.Context, node *corev1.Node) error {
+	_, _, _, err := g.getInstance(ctx, node)
+	return err
+}
+
+// ListOwnedResources returns the /32 alias IP ranges of the selected network
+// interface of each node, ranges of other sizes aren't assigned by us, see
+// ListPrivateIPs. Nodes whose network interface can't be retrieved are
+// skipped.
+func (g *GCP) ListOwnedResources(ctx context.Context, nodes []*corev1.Node) ([]OwnedResource, error) {
+	resources := []OwnedResource{}
+	for _, node := range nodes {
+		instance, networkInterface, err := g.getSelectedNetworkInterface(ctx, node)
+		if err != nil {
+			klog.Warningf("Could not list the alias IP ranges of node %s, err: %v", node.Name, err)
+			continue
+		}
+		for _, ip := range getGCPAliasIPs(networkInterface) {
+			resources = append(resources, OwnedResource{
+				ID:   fmt.Sprintf("%s/%s/%s", instance.Name, networkInterface.Name, ip),
+				Kind: "alias IP range",
+				IP:   ip,
+				Node: node.Name,
+				node: node,
+			})
+		}
+	}
+	return resources, nil
+}
+
+// DeleteOwnedResource removes the alias IP range from its node.
+func (g *GCP) DeleteOwnedResource(ctx context.Context, resource OwnedResource) error {
+	if resource.node == nil {
+		return fmt.Errorf("cannot delete alias IP range %s, it belongs to no node", resource.ID)
+	}
+	return g.ReleasePrivateIP(ctx, resource.IP, resource.node)
+}
+
 // ReleasePrivateIP removes the IP alias from the associated instance.
 // Important: GCP IP aliases can come in all forms, i.e: if you add 10.0.32.25
 // GCP can return 10.0.32.25/32 or 10.0.32.25
-func (g *GCP) ReleasePrivateIP(ip net.IP, node *corev1.Node) error {
-	project, zone, instance, err := g.getInstance(node)
+func (g *GCP) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	project, zone, instance, err := g.getInstance(ctx, node)
 	if err != nil {
 		return err
 	}
@@ -104,40 +314,64 @@ func (g *GCP) ReleasePrivateIP(ip net.IP, node *corev1.Node) error {
 	if err != nil {
 		return err
 	}
-	// Perform the operation against the first interface listed following the
-	// order GCP specifies.
-	networkInterface := networkInterfaces[0]
+	// Perform the operation against the selected interface, by default the
+	// first interface listed following the order GCP specifies.
+	networkInterface, err := g.selectNetworkInterface(node, networkInterfaces)
+	if err != nil {
+		return err
+	}
+	// IPv6 egress IPs are addresses of the IPv6 range routed to the network
+	// interface, there's nothing to release.
+	if utilnet.IsIPv6(ip) {
+		if checkGCPIPv6(ip, networkInterface) != nil {
+			return NonExistingIPError
+		}
+		return nil
+	}
 	ipAssigned := false
-	var keepAliases []*google.AliasIpRange
 	for _, aliasIPRange := range networkInterface.AliasIpRanges {
-		if assignedIP := net.ParseIP(aliasIPRange.IpCidrRange); assignedIP != nil && !assignedIP.Equal(ip) {
-			keepAliases = append(keepAliases, aliasIPRange)
-			continue
-		} else if assignedIP != nil && assignedIP.Equal(ip) {
-			ipAssigned = true
-			continue
-		}
-		if assignedIP, _, err := net.ParseCIDR(aliasIPRange.IpCidrRange); err == nil && !assignedIP.Equal(ip) {
-			keepAliases = append(keepAliases, aliasIPRange)
-		} else if err == nil && assignedIP.Equal(ip) {
+		if isGCPAliasIP(aliasIPRange, ip) {
 			ipAssigned = true
 		}
 	}
 	if !ipAssigned {
 		return NonExistingIPError
 	}
-	networkInterface.AliasIpRanges = keepAliases
-	// make sure that AliasIpRanges is always sent in the request, even if it is empty
-	networkInterface.ForceSendFields = append(networkInterface.ForceSendFields, "AliasIpRanges")
-	operation, err := g.client.Instances.UpdateNetworkInterface(project, zone, instance.Name, networkInterface.Name, networkInterface).Do()
-	if err != nil {
-		return err
+	return g.updateNetworkInterface(ctx, project, zone, instance, networkInterface, gcpAliasIPChange{ip: ip})
+}
+
+// AssignPrivateIPs assigns the IP addresses concurrently if updates are
+// batched, for their alias IP ranges to be added in a single zone operation,
+// and in turn otherwise.
+func (g *GCP) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	if g.cfg.GCPUpdateBatchWindow > 0 {
+		return g.calls.apply(ctx, ips, node, g.AssignPrivateIP)
 	}
-	return g.waitForCompletion(project, zone, operation.Name)
+	return eachPrivateIP(ctx, ips, node, g.AssignPrivateIP)
 }
 
-func (g *GCP) GetNodeEgressIPConfiguration(node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
-	project, _, instance, err := g.getInstance(node)
+// ReleasePrivateIPs releases the IP addresses concurrently if updates are
+// batched, for their alias IP ranges to be removed in a single zone
+// operation, and in turn otherwise.
+func (g *GCP) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	if g.cfg.GCPUpdateBatchWindow > 0 {
+		return g.calls.apply(ctx, ips, node, g.ReleasePrivateIP)
+	}
+	return eachPrivateIP(ctx, ips, node, g.ReleasePrivateIP)
+}
+
+// BatchesAssignPrivateIPs returns true if updates are batched.
+func (g *GCP) BatchesAssignPrivateIPs() bool {
+	return g.cfg.GCPUpdateBatchWindow > 0
+}
+
+// BatchesReleasePrivateIPs returns true if updates are batched.
+func (g *GCP) BatchesReleasePrivateIPs() bool {
+	return g.cfg.GCPUpdateBatchWindow > 0
+}
+
+func (g *GCP) GetNodeEgressIPConfiguration(ctx context.Context, node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
+	project, _, instance, err := g.getInstance(ctx, node)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving instance associated with node, err: %v", err)
 	}
@@ -145,59 +379,52 @@ func (g *GCP) GetNodeEgressIPConfiguration(node *corev1.Node) ([]*NodeEgressIPCo
 	if err != nil {
 		return nil, err
 	}
-	// Perform the operation against the first interface listed following the
-	// order GCP specifies.
-	for _, networkInterface := range networkInterfaces {
-		config := &NodeEgressIPConfiguration{
-			Interface: networkInterface.Name,
-		}
-		v4Subnet, v6Subnet, err := g.getSubnet(project, networkInterface)
-		if err != nil {
-			return nil, fmt.Errorf("error retrieving the network interface subnets, err: %v", err)
-		}
-		config.IFAddr = ifAddr{}
-		if v4Subnet != nil {
-			config.IFAddr.IPv4 = v4Subnet.String()
-		}
-		if v6Subnet != nil {
-			config.IFAddr.IPv6 = v6Subnet.String()
-		}
-		config.Capacity = capacity{
-			IP: g.getCapacity(networkInterface),
-		}
-		return []*NodeEgressIPConfiguration{config}, nil
+	// Perform the operation against the selected interface, by default the
+	// first interface listed following the order GCP specifies.
+	networkInterface, err := g.selectNetworkInterface(node, networkInterfaces)
+	if err != nil {
+		return nil, err
 	}
-	return nil, nil
-}
-
-// The GCP zone operations API call. All GCP infrastructure modifications are
-// assigned a unique operation ID and are queued in a global/zone operations
-// queue. In the case of assignments of private IP addresses to instances, the
-// operation is added to the zone operations queue. Hence we need to keep the
-// opName and the zone the instance lives in.
-func (g *GCP) waitForCompletion(project, zone, opName string) error {
-	op, err := g.client.ZoneOperations.Wait(project, zone, opName).Do()
+	config := &NodeEgressIPConfiguration{
+		Interface: networkInterface.Name,
+	}
+	v4Subnet, v6Subnet, err := g.getSubnet(ctx, project, networkInterface)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("error retrieving the network interface subnets, err: %v", err)
 	}
-
-	if op.Error != nil {
-		data, err := op.Error.MarshalJSON()
-		if err != nil {
-			return fmt.Errorf("failed marshaling error %v", op.Error)
+	config.IFAddr = ifAddr{}
+	if v4Subnet != nil {
+		config.IFAddr.IPv4 = v4Subnet.String()
+	}
+	if v6Subnet != nil {
+		config.IFAddr.IPv6 = v6Subnet.String()
+	}
+	config.Capacity = capacity{
+		IP: g.getCapacity(networkInterface),
+	}
+	// On dual-stack network interfaces, IPv6 egress IPs are addresses of the
+	// IPv6 range of the network interface rather than alias IP ranges, each
+	// family has a capacity of its own.
+	if ipv6Range := getGCPIPv6Range(networkInterface); ipv6Range != nil {
+		config.IFAddr.IPv6 = ipv6Range.String()
+		config.Capacity = capacity{
+			IPv4: g.getCapacity(networkInterface),
+			IPv6: getGCPIPv6Capacity(ipv6Range),
 		}
-		return fmt.Errorf("%s", string(data))
 	}
-	return nil
+	return []*NodeEgressIPConfiguration{config}, nil
 }
 
-func (g *GCP) getSubnet(project string, networkInterface *google.NetworkInterface) (*net.IPNet, *net.IPNet, error) {
+// getSubnet returns the IPv4 and IPv6 ranges of the subnet of the network
+// interface of an instance of project, see parseSubnet for the project of the
+// subnet.
+func (g *GCP) getSubnet(ctx context.Context, project string, networkInterface *google.NetworkInterface) (*net.IPNet, *net.IPNet, error) {
 	var v4Subnet, v6Subnet *net.IPNet
-	region, subnet, err := g.parseSubnet(networkInterface.Subnetwork)
+	project, region, subnet, err := g.parseSubnet(networkInterface.Subnetwork, project)
 	if err != nil {
 		return nil, nil, err
 	}
-	subnetResult, err := g.client.Subnetworks.Get(project, region, subnet).Do()
+	subnetResult, err := g.client.Subnetworks.Get(project, region, subnet).Context(ctx).Do()
 	if err != nil {
 		return nil, nil, err
 	}
@@ -211,12 +438,20 @@ func (g *GCP) getSubnet(project string, networkInterface *google.NetworkInterfac
 }
 
 // Note: there is also a global "alias IP per VPC quota", but OpenShift clusters on
-// GCP seem to have that value defined to 15,000. So we can skip that.
+// GCP seem to have that value defined to 15,000. So we can skip that. The limit
+// per network interface doesn't depend on the machine type: the machine types
+// API only exposes CPUs, memory and disks, hence no lookup. It's
+// GCPAliasIPRangesPerInterface if set, so that a raised limit doesn't need a
+// new release, defaultGCPPrivateIPCapacity otherwise.
 func (g *GCP) getCapacity(networkInterface *google.NetworkInterface) int {
+	limit := defaultGCPPrivateIPCapacity
+	if g.cfg.GCPAliasIPRangesPerInterface > 0 {
+		limit = g.cfg.GCPAliasIPRangesPerInterface
+	}
 	currentIPv4Usage := 0
 	currentIPv6Usage := 0
 	for _, aliasIPRange := range networkInterface.AliasIpRanges {
-		if assignedIP := net.ParseIP(aliasIPRange.IpCidrRange); assignedIP != nil {
+		if assignedIP := ParseIP(aliasIPRange.IpCidrRange); assignedIP != nil {
 			if utilnet.IsIPv4(assignedIP) {
 				currentIPv4Usage++
 			} else {
@@ -230,22 +465,34 @@ func (g *GCP) getCapacity(networkInterface *google.NetworkInterface) int {
 			}
 		}
 	}
-	return defaultGCPPrivateIPCapacity - currentIPv4Usage - currentIPv6Usage
+	if currentIPv4Usage+currentIPv6Usage > limit {
+		return 0
+	}
+	return limit - currentIPv4Usage - currentIPv6Usage
 }
 
 // getInstance retrieves the GCP instance referrred by the Node object.
 // returns the project and zone name as well.
-func (g *GCP) getInstance(node *corev1.Node) (string, string, *google.Instance, error) {
-	project, zone, instance, err := splitGCPNode(node)
+func (g *GCP) getInstance(ctx context.Context, node *corev1.Node) (string, string, *google.Instance, error) {
+	ref, cached, err := g.resolveInstance(ctx, node)
 	if err != nil {
 		return "", "", nil, err
 	}
 
-	i, err := g.client.Instances.Get(project, zone, instance).Do()
+	i, err := g.client.Instances.Get(ref.project, ref.zone, ref.name).Context(ctx).Do()
+	if cached && isGCPNotFound(err) {
+		// The instance was deleted, or recreated in another zone, since it
+		// was looked up.
+		g.instances.remove(node.Name)
+		if ref, _, err = g.resolveInstance(ctx, node); err != nil {
+			return "", "", nil, err
+		}
+		i, err = g.client.Instances.Get(ref.project, ref.zone, ref.name).Context(ctx).Do()
+	}
 	if err != nil {
 		return "", "", nil, err
 	}
-	return project, zone, i, nil
+	return ref.project, ref.zone, i, nil
 }
 
 func (g *GCP) getNetworkInterfaces(instance *google.Instance) ([]*google.NetworkInterface, error) {
@@ -284,11 +531,23 @@ func splitGCPNode(node *corev1.Node) (project, zone, instance string, err error)
 // GCP Subnet URLs are defined as:
 // - https://www.googleapis.com/compute/v1/projects/project/regions/region/subnetworks/subnetwork
 // OR
+// - projects/project/regions/region/subnetworks/subnetwork
+// OR
 // - regions/region/subnetworks/subnetwork
-func (g *GCP) parseSubnet(subnetURL string) (string, string, error) {
+// parseSubnet returns the project, region and name of the subnet. With shared
+// VPC (XPN), the subnets live in the host project, not in the instance's
+// project: the project is the one the URL names, otherwise GCPNetworkProjectID,
+// otherwise project, the instance's.
+func (g *GCP) parseSubnet(subnetURL, project string) (string, string, string, error) {
 	subnetURLParts := strings.Split(subnetURL, "/")
-	if len(subnetURLParts) != 11 {
-		return "", "", UnexpectedURIError(subnetURL)
+	i := len(subnetURLParts) - 4
+	if i < 0 || subnetURLParts[i] != "regions" || subnetURLParts[i+2] != "subnetworks" || subnetURLParts[i+1] == "" || subnetURLParts[i+3] == "" {
+		return "", "", "", UnexpectedURIError(subnetURL)
+	}
+	if i >= 2 && subnetURLParts[i-2] == "projects" && subnetURLParts[i-1] != "" {
+		project = subnetURLParts[i-1]
+	} else if g.cfg.GCPNetworkProjectID != "" {
+		project = g.cfg.GCPNetworkProjectID
 	}
-	return subnetURLParts[len(subnetURLParts)-3], subnetURLParts[len(subnetURLParts)-1], nil
+	return project, subnetURLParts[i+1], subnetURLParts[i+3], nil
 }
@@ -0,0 +1,185 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	google "google.golang.org/api/compute/v1"
+	"k8s.io/klog/v2"
+)
+
+// gcpAliasIPChange is an IP address to add to the alias IP ranges of a network
+// interface, or to remove from them if add is false.
+type gcpAliasIPChange struct {
+	ip  net.IP
+	add bool
+}
+
+// gcpNetworkInterfaceRef identifies the network interface name of instance.
+type gcpNetworkInterfaceRef struct {
+	project, zone, instance, name string
+}
+
+func (r gcpNetworkInterfaceRef) String() string {
+	return strings.Join([]string{r.project, r.zone, r.instance, r.name}, "/")
+}
+
+// gcpNetworkInterfaceUpdate collects the concurrent changes to the same
+// network interface, to apply them in a single update.
+type gcpNetworkInterfaceUpdate struct {
+	changes []gcpAliasIPChange
+	// errs holds the result of each change, by index, once done is closed.
+	errs []error
+	done chan struct{}
+}
+
+// gcpNetworkInterfaceUpdates are the updates collecting changes, keyed by
+// network interface.
+type gcpNetworkInterfaceUpdates struct {
+	sync.Mutex
+	pending map[gcpNetworkInterfaceRef]*gcpNetworkInterfaceUpdate
+}
+
+// updateNetworkInterface applies the change to the network interface of the
+// instance of project in zone. If batching is enabled, the first change to the
+// network interface waits for the batch window, or for the other IP addresses
+// of its AssignPrivateIPs or ReleasePrivateIPs call, and all changes to the same
+// network interface queued meanwhile are applied along in the same update,
+// each update being a zone operation slow to complete. A batch is applied on
+// the context of its first change, whose trace the update is part of.
+func (g *GCP) updateNetworkInterface(ctx context.Context, project, zone string, instance *google.Instance, networkInterface *google.NetworkInterface, change gcpAliasIPChange) error {
+	if g.cfg.GCPUpdateBatchWindow <= 0 {
+		applyGCPAliasIPChanges(networkInterface, []gcpAliasIPChange{change})
+		return g.sendNetworkInterfaceUpdate(ctx, project, zone, instance.Name, networkInterface)
+	}
+	key := gcpNetworkInterfaceRef{project: project, zone: zone, instance: instance.Name, name: networkInterface.Name}
+
+	g.updates.Lock()
+	if g.updates.pending == nil {
+		g.updates.pending = map[gcpNetworkInterfaceRef]*gcpNetworkInterfaceUpdate{}
+	}
+	update, ok := g.updates.pending[key]
+	if !ok {
+		update = &gcpNetworkInterfaceUpdate{done: make(chan struct{})}
+		g.updates.pending[key] = update
+	}
+	index := len(update.changes)
+	update.changes = append(update.changes, change)
+	g.updates.Unlock()
+
+	if ok {
+		g.calls.join(change.ip)
+		<-update.done
+		return update.errs[index]
+	}
+
+	g.calls.wait(change.ip, g.cfg.GCPUpdateBatchWindow)
+	g.updates.Lock()
+	delete(g.updates.pending, key)
+	g.updates.Unlock()
+	update.errs = g.sendNetworkInterfaceUpdateBatch(ctx, key, update.changes)
+	close(update.done)
+	return update.errs[index]
+}
+
+// sendNetworkInterfaceUpdateBatch applies the changes in a single update, to
+// the network interface as it is after the batch window. The update succeeds
+// or fails as a whole: if it fails, each change is applied on its own, so that
+// a change which can't be applied doesn't fail the others. The updates of a
+// network interface are serialized, the fingerprint of the network interface
+// failing concurrent ones anyway.
+func (g *GCP) sendNetworkInterfaceUpdateBatch(ctx context.Context, ref gcpNetworkInterfaceRef, changes []gcpAliasIPChange) []error {
+	defer g.networkInterfaceLocks.Lock(ref.String())()
+	errs := make([]error, len(changes))
+	if len(changes) > 1 {
+		klog.Infof("Applying %d alias IP changes to network interface %s in a single update", len(changes), ref)
+	}
+	err := g.getAndUpdateNetworkInterface(ctx, ref, changes)
+	if err == nil || len(changes) == 1 {
+		for i := range changes {
+			errs[i] = err
+		}
+		return errs
+	}
+	klog.Warningf("Could not apply %d alias IP changes to network interface %s in a single update, applying them one by one, err: %v", len(changes), ref, err)
+	for i, change := range changes {
+		errs[i] = g.getAndUpdateNetworkInterface(ctx, ref, []gcpAliasIPChange{change})
+	}
+	return errs
+}
+
+func (g *GCP) getAndUpdateNetworkInterface(ctx context.Context, ref gcpNetworkInterfaceRef, changes []gcpAliasIPChange) error {
+	instance, err := g.client.Instances.Get(ref.project, ref.zone, ref.instance).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	for _, networkInterface := range instance.NetworkInterfaces {
+		if networkInterface != nil && networkInterface.Name == ref.name {
+			applyGCPAliasIPChanges(networkInterface, changes)
+			return g.sendNetworkInterfaceUpdate(ctx, ref.project, ref.zone, ref.instance, networkInterface)
+		}
+	}
+	return fmt.Errorf("network interface %s not found on instance %s", ref.name, ref.instance)
+}
+
+// sendNetworkInterfaceUpdate updates the network interface of the instance
+// and waits for the operation to complete.
+func (g *GCP) sendNetworkInterfaceUpdate(ctx context.Context, project, zone, instance string, networkInterface *google.NetworkInterface) error {
+	// make sure that AliasIpRanges is always sent in the request, even if it is empty
+	networkInterface.ForceSendFields = append(networkInterface.ForceSendFields, "AliasIpRanges")
+	operation, err := g.client.Instances.UpdateNetworkInterface(project, zone, instance, networkInterface.Name, networkInterface).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return g.waitForCompletion(ctx, project, zone, operation.Name)
+}
+
+// applyGCPAliasIPChanges applies the changes, in order, to the alias IP ranges
+// of the network interface. Adding an IP address already held, or removing one
+// which isn't, is a no-op.
+func applyGCPAliasIPChanges(networkInterface *google.NetworkInterface, changes []gcpAliasIPChange) {
+	for _, change := range changes {
+		if change.add {
+			if !hasGCPAliasIP(networkInterface, change.ip) {
+				networkInterface.AliasIpRanges = append(networkInterface.AliasIpRanges, &google.AliasIpRange{
+					IpCidrRange: change.ip.String(),
+				})
+			}
+			continue
+		}
+		var keepAliases []*google.AliasIpRange
+		for _, aliasIPRange := range networkInterface.AliasIpRanges {
+			if !isGCPAliasIP(aliasIPRange, change.ip) {
+				keepAliases = append(keepAliases, aliasIPRange)
+			}
+		}
+		networkInterface.AliasIpRanges = keepAliases
+	}
+}
+
+// hasGCPAliasIP returns true if an alias IP range of the network interface
+// holds ip.
+func hasGCPAliasIP(networkInterface *google.NetworkInterface, ip net.IP) bool {
+	for _, aliasIPRange := range networkInterface.AliasIpRanges {
+		if assignedIP := ParseIP(aliasIPRange.IpCidrRange); assignedIP.Equal(ip) {
+			return true
+		}
+		if _, assignedSubnet, err := net.ParseCIDR(aliasIPRange.IpCidrRange); err == nil && assignedSubnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGCPAliasIP returns true if the alias IP range is ip, which GCP can return
+// as 10.0.32.25/32 or 10.0.32.25.
+func isGCPAliasIP(aliasIPRange *google.AliasIpRange, ip net.IP) bool {
+	if assignedIP := ParseIP(aliasIPRange.IpCidrRange); assignedIP != nil {
+		return assignedIP.Equal(ip)
+	}
+	assignedIP, _, err := net.ParseCIDR(aliasIPRange.IpCidrRange)
+	return err == nil && assignedIP.Equal(ip)
+}
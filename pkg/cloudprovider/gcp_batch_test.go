@@ -0,0 +1,152 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	google "google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+)
+
+// fakeGCPInstance serves the Compute API operations getting the instance
+// worker-0 and updating its network interface nic0, holding the alias IP
+// ranges of aliases, refusing updates with refusedIP.
+type fakeGCPInstance struct {
+	mu        sync.Mutex
+	aliases   []string
+	refusedIP string
+	updates   int
+}
+
+func (f *fakeGCPInstance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/projects/project/zones/zone/instances/worker-0":
+		aliasIPRanges := []*google.AliasIpRange{}
+		for _, alias := range f.aliases {
+			aliasIPRanges = append(aliasIPRanges, &google.AliasIpRange{IpCidrRange: alias})
+		}
+		_ = json.NewEncoder(w).Encode(&google.Instance{
+			Name:              "worker-0",
+			NetworkInterfaces: []*google.NetworkInterface{{Name: "nic0", AliasIpRanges: aliasIPRanges}},
+		})
+	case r.Method == http.MethodPatch && r.URL.Path == "/projects/project/zones/zone/instances/worker-0/updateNetworkInterface":
+		f.updates++
+		networkInterface := &google.NetworkInterface{}
+		if err := json.NewDecoder(r.Body).Decode(networkInterface); err != nil || r.URL.Query().Get("networkInterface") != "nic0" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		aliases := []string{}
+		for _, aliasIPRange := range networkInterface.AliasIpRanges {
+			if aliasIPRange.IpCidrRange == f.refusedIP {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error": {"code": 400, "message": "IP address is in use"}}`)
+				return
+			}
+			aliases = append(aliases, aliasIPRange.IpCidrRange)
+		}
+		f.aliases = aliases
+		_ = json.NewEncoder(w).Encode(&google.Operation{Name: fmt.Sprintf("operation-%d", f.updates)})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/projects/project/zones/zone/operations/"):
+		_ = json.NewEncoder(w).Encode(&google.Operation{Status: "DONE"})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestGCPUpdateNetworkInterface(t *testing.T) {
+	tcs := []struct {
+		window    time.Duration
+		assigned  []string
+		refusedIP string
+		add       []string
+		remove    []string
+		expected  []string
+		updates   int
+		failedIPs []string
+	}{
+		{
+			assigned: []string{"10.0.32.4/32"},
+			add:      []string{"10.0.32.10"},
+			expected: []string{"10.0.32.10", "10.0.32.4/32"},
+			updates:  1,
+		},
+		// Concurrent changes are applied in a single update.
+		{
+			window:   100 * time.Millisecond,
+			assigned: []string{"10.0.32.4", "10.0.32.5/32"},
+			add:      []string{"10.0.32.10", "10.0.32.11", "10.0.32.12"},
+			remove:   []string{"10.0.32.5"},
+			expected: []string{"10.0.32.10", "10.0.32.11", "10.0.32.12", "10.0.32.4"},
+			updates:  1,
+		},
+		// If the update fails, the changes are applied one by one.
+		{
+			window:    100 * time.Millisecond,
+			assigned:  []string{"10.0.32.4"},
+			refusedIP: "10.0.32.66",
+			add:       []string{"10.0.32.10", "10.0.32.66"},
+			expected:  []string{"10.0.32.10", "10.0.32.4"},
+			updates:   3,
+			failedIPs: []string{"10.0.32.66"},
+		},
+	}
+	for i, tc := range tcs {
+		fake := &fakeGCPInstance{aliases: tc.assigned, refusedIP: tc.refusedIP}
+		server := httptest.NewServer(fake)
+		client, err := google.NewService(context.Background(), option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+		if err != nil {
+			t.Fatalf("TestGCPUpdateNetworkInterface(%d): received unexpected error, err: %v", i, err)
+		}
+		g := &GCP{CloudProvider: CloudProvider{ctx: context.Background(), cfg: CloudProviderConfig{GCPUpdateBatchWindow: tc.window}}, client: client}
+
+		var mu sync.Mutex
+		failedIPs := []string{}
+		var wg sync.WaitGroup
+		change := func(ip string, add bool) {
+			defer wg.Done()
+			// Every change comes with the instance as it was before any.
+			instance, err := client.Instances.Get("project", "zone", "worker-0").Do()
+			if err == nil {
+				err = g.updateNetworkInterface(context.Background(), "project", "zone", instance, instance.NetworkInterfaces[0], gcpAliasIPChange{ip: net.ParseIP(ip), add: add})
+			}
+			if err != nil {
+				mu.Lock()
+				failedIPs = append(failedIPs, ip)
+				mu.Unlock()
+			}
+		}
+		for _, ip := range tc.add {
+			wg.Add(1)
+			go change(ip, true)
+		}
+		for _, ip := range tc.remove {
+			wg.Add(1)
+			go change(ip, false)
+		}
+		wg.Wait()
+		server.Close()
+
+		sort.Strings(fake.aliases)
+		if fmt.Sprint(fake.aliases) != fmt.Sprint(tc.expected) {
+			t.Fatalf("TestGCPUpdateNetworkInterface(%d): expected alias IP ranges %v, got %v", i, tc.expected, fake.aliases)
+		}
+		if fake.updates != tc.updates {
+			t.Fatalf("TestGCPUpdateNetworkInterface(%d): expected %d updates, got %d", i, tc.updates, fake.updates)
+		}
+		if fmt.Sprint(failedIPs) != fmt.Sprint(tc.failedIPs) {
+			t.Fatalf("TestGCPUpdateNetworkInterface(%d): expected changes of %v to fail, got %v", i, tc.failedIPs, failedIPs)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/golang/groupcache/lru"
+	google "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// gcpInstanceCacheSize is the number of instances of nodes without providerID
+// the CNCC keeps track of, the least recently used ones being looked up again.
+const gcpInstanceCacheSize = 1024
+
+// gcpInstanceRef identifies the instance name of project in zone.
+type gcpInstanceRef struct {
+	project, zone, name string
+}
+
+// gcpInstanceCache caches the instances looked up for nodes without
+// providerID, keyed by node name: a lookup lists the instances of all zones
+// of the project, while every sync of the CloudPrivateIPConfigs of the node
+// needs the instance.
+type gcpInstanceCache struct {
+	sync.Mutex
+	instances *lru.Cache
+}
+
+func (c *gcpInstanceCache) get(node string) (gcpInstanceRef, bool) {
+	c.Lock()
+	defer c.Unlock()
+	if c.instances == nil {
+		return gcpInstanceRef{}, false
+	}
+	ref, ok := c.instances.Get(node)
+	if !ok {
+		return gcpInstanceRef{}, false
+	}
+	return ref.(gcpInstanceRef), true
+}
+
+func (c *gcpInstanceCache) add(node string, ref gcpInstanceRef) {
+	c.Lock()
+	defer c.Unlock()
+	if c.instances == nil {
+		c.instances = lru.New(gcpInstanceCacheSize)
+	}
+	c.instances.Add(node, ref)
+}
+
+func (c *gcpInstanceCache) remove(node string) {
+	c.Lock()
+	defer c.Unlock()
+	if c.instances != nil {
+		c.instances.Remove(node)
+	}
+}
+
+// resolveInstance returns the instance of the node, parsed out of its
+// providerID. The providerID is only set once the cloud provider initialized
+// the node: until then, the instance is the one named after the node's
+// hostname in the project of the credentials, looked up in all zones. The
+// looked up instances are cached, cached is true if the instance comes from
+// the cache.
+func (g *GCP) resolveInstance(ctx context.Context, node *corev1.Node) (ref gcpInstanceRef, cached bool, err error) {
+	if node.Spec.ProviderID != "" {
+		project, zone, instance, err := splitGCPNode(node)
+		return gcpInstanceRef{project: project, zone: zone, name: instance}, false, err
+	}
+	if ref, ok := g.instances.get(node.Name); ok {
+		return ref, true, nil
+	}
+	if ref, err = g.lookupInstance(ctx, node); err != nil {
+		return ref, false, err
+	}
+	klog.Infof("Node %s has no providerID, using instance %s of zone %s of project %s", node.Name, ref.name, ref.zone, ref.project)
+	g.instances.add(node.Name, ref)
+	return ref, false, nil
+}
+
+// lookupInstance looks up the instance named after the node's hostname in all
+// zones of the project of the credentials. Exactly one must exist.
+func (g *GCP) lookupInstance(ctx context.Context, node *corev1.Node) (gcpInstanceRef, error) {
+	name := strings.SplitN(node.Name, ".", 2)[0]
+	if g.project == "" {
+		return gcpInstanceRef{}, fmt.Errorf("node %s has no providerID, and the GCP credentials don't name the project to look up its instance in", node.Name)
+	}
+	refs := []gcpInstanceRef{}
+	err := g.client.Instances.AggregatedList(g.project).Filter(fmt.Sprintf("name = %s", name)).Pages(ctx, func(list *google.InstanceAggregatedList) error {
+		for scope, scopedList := range list.Items {
+			for _, instance := range scopedList.Instances {
+				if instance != nil && instance.Name == name {
+					refs = append(refs, gcpInstanceRef{project: g.project, zone: strings.TrimPrefix(scope, "zones/"), name: name})
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return gcpInstanceRef{}, fmt.Errorf("error looking up the instance of node %s without providerID, err: %v", node.Name, err)
+	}
+	if len(refs) != 1 {
+		return gcpInstanceRef{}, fmt.Errorf("node %s has no providerID, and %d instances named %s exist in project %s, expected exactly one", node.Name, len(refs), name, g.project)
+	}
+	return refs[0], nil
+}
+
+// isGCPNotFound returns true if err is an HTTP 404 of the GCP API.
+func isGCPNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
@@ -0,0 +1,98 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	google "google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// fakeGCPInstanceZones serves the instance worker-0 of project, in the zones
+// of zones, counting the lookups listing the instances of all zones.
+type fakeGCPInstanceZones struct {
+	mu      sync.Mutex
+	zones   []string
+	lookups int
+}
+
+func (f *fakeGCPInstanceZones) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path == "/projects/project/aggregated/instances" {
+		f.lookups++
+		list := &google.InstanceAggregatedList{Items: map[string]google.InstancesScopedList{}}
+		for _, zone := range f.zones {
+			list.Items["zones/"+zone] = google.InstancesScopedList{Instances: []*google.Instance{{Name: "worker-0"}}}
+		}
+		_ = json.NewEncoder(w).Encode(list)
+		return
+	}
+	for _, zone := range f.zones {
+		if r.URL.Path == "/projects/project/zones/"+zone+"/instances/worker-0" {
+			_ = json.NewEncoder(w).Encode(&google.Instance{Name: "worker-0", Zone: zone})
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func TestGCPResolveInstance(t *testing.T) {
+	fake := &fakeGCPInstanceZones{zones: []string{"us-central1-a"}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client, err := google.NewService(context.Background(), option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("TestGCPResolveInstance: received unexpected error, err: %v", err)
+	}
+	g := &GCP{CloudProvider: CloudProvider{ctx: context.Background()}, client: client, project: "project"}
+	node := &corev1.Node{}
+	node.Name = "worker-0.c.project.internal"
+
+	tcs := []struct {
+		zones   []string
+		zone    string
+		lookups int
+		err     bool
+	}{
+		{zone: "us-central1-a", lookups: 1},
+		// The instance is cached.
+		{zone: "us-central1-a", lookups: 1},
+		// The instance was recreated in another zone: it's looked up again.
+		{zones: []string{"us-central1-b"}, zone: "us-central1-b", lookups: 2},
+		{zones: []string{"us-central1-a", "us-central1-b"}, zone: "us-central1-b", lookups: 2},
+		{zones: []string{"us-central1-a"}, zone: "us-central1-a", lookups: 3},
+		// The instance was deleted.
+		{zones: []string{}, lookups: 4, err: true},
+		// Instance names are only unique within a zone.
+		{zones: []string{"us-central1-a", "us-central1-b"}, lookups: 5, err: true},
+	}
+	for i, tc := range tcs {
+		if tc.zones != nil {
+			fake.mu.Lock()
+			fake.zones = tc.zones
+			fake.mu.Unlock()
+		}
+		_, zone, _, err := g.getInstance(context.Background(), node)
+		if tc.err != (err != nil) {
+			t.Fatalf("TestGCPResolveInstance(%d): expected an error: %v, err: %v", i, tc.err, err)
+		}
+		if zone != tc.zone {
+			t.Fatalf("TestGCPResolveInstance(%d): expected zone %q, got %q", i, tc.zone, zone)
+		}
+		if fake.lookups != tc.lookups {
+			t.Fatalf("TestGCPResolveInstance(%d): expected %d lookups, got %d", i, tc.lookups, fake.lookups)
+		}
+	}
+
+	// Nodes with providerID don't need any lookup.
+	node.Spec.ProviderID = "gce://project/us-central1-a/worker-0"
+	if _, zone, _, err := g.getInstance(context.Background(), node); err != nil || zone != "us-central1-a" || fake.lookups != 5 {
+		t.Fatalf("TestGCPResolveInstance: expected zone us-central1-a without lookup, got %q, %d lookups, err: %v", zone, fake.lookups, err)
+	}
+}
@@ -0,0 +1,70 @@
+package cloudprovider
+
+import (
+	"fmt"
+	"math"
+	"net"
+
+	google "google.golang.org/api/compute/v1"
+)
+
+// gcpIPv6AccessTypeExternal is the IPv6 access type of the network interfaces
+// of subnets with external IPv6 ranges, whose IPv6 range is the one of their
+// IPv6 access config.
+const gcpIPv6AccessTypeExternal = "EXTERNAL"
+
+// getGCPIPv6Range returns the IPv6 range GCP routes to the network interface
+// of a dual-stack instance, a /96: of its external IPv6 access config if its
+// subnet has an external IPv6 range, of its internal IPv6 address otherwise.
+// It's nil if the network interface has none. IPv6 addresses can't be alias
+// IP ranges: IPv6 egress IPs are addresses of that range instead, reaching the
+// instance without any change of the network interface.
+func getGCPIPv6Range(networkInterface *google.NetworkInterface) *net.IPNet {
+	address, prefixLength := networkInterface.Ipv6Address, networkInterface.InternalIpv6PrefixLength
+	if networkInterface.Ipv6AccessType == gcpIPv6AccessTypeExternal || address == "" {
+		address, prefixLength = "", 0
+		for _, accessConfig := range networkInterface.Ipv6AccessConfigs {
+			if accessConfig != nil && accessConfig.ExternalIpv6 != "" {
+				address, prefixLength = accessConfig.ExternalIpv6, accessConfig.ExternalIpv6PrefixLength
+				break
+			}
+		}
+	}
+	ip := ParseIP(address)
+	if ip == nil || ip.To4() != nil {
+		return nil
+	}
+	if prefixLength <= 0 || prefixLength > 128 {
+		prefixLength = 96
+	}
+	mask := net.CIDRMask(int(prefixLength), 128)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
+
+// checkGCPIPv6 returns an error unless the IPv6 address ip is in the IPv6
+// range of the network interface, and isn't the address of the network
+// interface itself.
+func checkGCPIPv6(ip net.IP, networkInterface *google.NetworkInterface) error {
+	ipv6Range := getGCPIPv6Range(networkInterface)
+	if ipv6Range == nil {
+		return fmt.Errorf("network interface %s has no IPv6 range, its subnet must be dual-stack for IPv6 egress IPs", networkInterface.Name)
+	}
+	if !ipv6Range.Contains(ip) {
+		return fmt.Errorf("IPv6 egress IP %s isn't in the IPv6 range %s of network interface %s, IPv6 egress IPs can't be alias IP ranges", ip, ipv6Range, networkInterface.Name)
+	}
+	if ip.Equal(ipv6Range.IP) || ip.Equal(ParseIP(networkInterface.Ipv6Address)) {
+		return fmt.Errorf("IPv6 egress IP %s is the address of network interface %s", ip, networkInterface.Name)
+	}
+	return nil
+}
+
+// getGCPIPv6Capacity returns the number of IPv6 egress IPs the IPv6 range can
+// hold, all its addresses but the one of the network interface, up to
+// math.MaxInt32.
+func getGCPIPv6Capacity(ipv6Range *net.IPNet) int {
+	ones, bits := ipv6Range.Mask.Size()
+	if bits-ones >= 31 {
+		return math.MaxInt32
+	}
+	return 1<<(bits-ones) - 1
+}
@@ -0,0 +1,67 @@
+package cloudprovider
+
+import (
+	"math"
+	"net"
+	"testing"
+
+	google "google.golang.org/api/compute/v1"
+)
+
+func TestGCPIPv6(t *testing.T) {
+	internal := &google.NetworkInterface{
+		Name:                     "nic0",
+		StackType:                "IPV4_IPV6",
+		Ipv6AccessType:           "INTERNAL",
+		Ipv6Address:              "fd20:a:b:c:0:0:0:0",
+		InternalIpv6PrefixLength: 96,
+	}
+	external := &google.NetworkInterface{
+		Name:              "nic0",
+		StackType:         "IPV4_IPV6",
+		Ipv6AccessType:    "EXTERNAL",
+		Ipv6AccessConfigs: []*google.AccessConfig{{Type: "DIRECT_IPV6", ExternalIpv6: "2600:1900:4000:1234:0:0:0:0", ExternalIpv6PrefixLength: 96}},
+	}
+	// The prefix length defaults to /96.
+	withoutPrefixLength := &google.NetworkInterface{Name: "nic0", Ipv6Address: "fd20:a:b:c::"}
+	ipv4Only := &google.NetworkInterface{Name: "nic0", StackType: "IPV4_ONLY", NetworkIP: "10.0.32.2"}
+
+	tcs := []struct {
+		networkInterface *google.NetworkInterface
+		ipv6Range        string
+		ip               string
+		err              bool
+	}{
+		{networkInterface: internal, ipv6Range: "fd20:a:b:c::/96", ip: "fd20:a:b:c::10"},
+		{networkInterface: internal, ipv6Range: "fd20:a:b:c::/96", ip: "fd20:a:b:c::1:0:10", err: true},
+		// The address of the network interface can't be an egress IP.
+		{networkInterface: internal, ipv6Range: "fd20:a:b:c::/96", ip: "fd20:a:b:c::", err: true},
+		{networkInterface: external, ipv6Range: "2600:1900:4000:1234::/96", ip: "2600:1900:4000:1234::10"},
+		{networkInterface: external, ipv6Range: "2600:1900:4000:1234::/96", ip: "fd20:a:b:c::10", err: true},
+		{networkInterface: withoutPrefixLength, ipv6Range: "fd20:a:b:c::/96", ip: "fd20:a:b:c::10"},
+		{networkInterface: ipv4Only, ip: "fd20:a:b:c::10", err: true},
+	}
+	for i, tc := range tcs {
+		ipv6Range := getGCPIPv6Range(tc.networkInterface)
+		if tc.ipv6Range == "" {
+			if ipv6Range != nil {
+				t.Fatalf("TestGCPIPv6(%d): expected no IPv6 range, got %s", i, ipv6Range)
+			}
+		} else if ipv6Range == nil || ipv6Range.String() != tc.ipv6Range {
+			t.Fatalf("TestGCPIPv6(%d): expected IPv6 range %s, got %v", i, tc.ipv6Range, ipv6Range)
+		}
+		err := checkGCPIPv6(net.ParseIP(tc.ip), tc.networkInterface)
+		if tc.err != (err != nil) {
+			t.Fatalf("TestGCPIPv6(%d): expected an error: %v, err: %v", i, tc.err, err)
+		}
+	}
+
+	_, ipv6Range, _ := net.ParseCIDR("fd20:a:b:c::/96")
+	if capacity := getGCPIPv6Capacity(ipv6Range); capacity != math.MaxInt32 {
+		t.Fatalf("TestGCPIPv6: expected capacity %d, got %d", math.MaxInt32, capacity)
+	}
+	_, ipv6Range, _ = net.ParseCIDR("fd20:a:b:c::/124")
+	if capacity := getGCPIPv6Capacity(ipv6Range); capacity != 15 {
+		t.Fatalf("TestGCPIPv6: expected capacity %d, got %d", 15, capacity)
+	}
+}
@@ -0,0 +1,120 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	google "google.golang.org/api/compute/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// gcpClusterIDLabelKey and gcpOwnedByLabelKey are the keys of the labels
+	// set on the instances whose network interfaces the controller changes,
+	// if GCPLabelResources is set: the ID of the cluster and the controller.
+	// GCP label keys can only hold lowercase letters, digits, dashes and
+	// underscores, hence cloud-network-openshift-io.
+	gcpClusterIDLabelKey = "cloud-network-openshift-io_cluster-id"
+	gcpOwnedByLabelKey   = "cloud-network-openshift-io_owned-by"
+	// gcpMaxLabelLength is the maximum length of GCP label keys and values.
+	gcpMaxLabelLength = 63
+)
+
+var (
+	gcpLabelKeyRegexp   = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,62}$`)
+	gcpLabelValueRegexp = regexp.MustCompile(`^[a-z0-9_-]{0,63}$`)
+	gcpLabelValueChars  = regexp.MustCompile(`[^a-z0-9_-]`)
+)
+
+// parseGCPResourceLabels parses a comma separated list of <key>=<value>
+// labels. GCP label keys must start with a lowercase letter, and keys and
+// values can only hold up to 63 lowercase letters, digits, dashes and
+// underscores. GCP reserves the keys starting with goog.
+func parseGCPResourceLabels(s string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, label := range strings.Split(s, ",") {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(label, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || !gcpLabelKeyRegexp.MatchString(key) || !gcpLabelValueRegexp.MatchString(value) {
+			return nil, fmt.Errorf("invalid GCP resource label %q, expected <key>=<value> of up to 63 lowercase letters, digits, dashes and underscores, the key starting with a letter", label)
+		}
+		if strings.HasPrefix(key, "goog") {
+			return nil, fmt.Errorf("invalid GCP resource label %q, keys starting with goog are reserved", label)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// getGCPLabelValue returns s as a valid GCP label value: lowercased, the
+// characters labels can't hold replaced by dashes, and truncated.
+func getGCPLabelValue(s string) string {
+	value := gcpLabelValueChars.ReplaceAllString(strings.ToLower(s), "-")
+	if len(value) > gcpMaxLabelLength {
+		value = value[:gcpMaxLabelLength]
+	}
+	return value
+}
+
+// labelsResources returns true if the instances whose network interfaces the
+// controller changes are labeled.
+func (g *GCP) labelsResources() bool {
+	return g.cfg.GCPLabelResources || len(g.resourceLabels) > 0
+}
+
+// getResourceLabels returns the labels of the instances whose network
+// interfaces the controller changes.
+func (g *GCP) getResourceLabels() map[string]string {
+	labels := map[string]string{}
+	for key, value := range g.resourceLabels {
+		labels[key] = value
+	}
+	if g.cfg.GCPLabelResources {
+		if g.cfg.ClusterID != "" {
+			labels[gcpClusterIDLabelKey] = getGCPLabelValue(g.cfg.ClusterID)
+		}
+		labels[gcpOwnedByLabelKey] = UserAgent
+	}
+	return labels
+}
+
+// labelInstance labels the instance of project in zone whose network
+// interface the controller changed. Alias IP ranges and network interfaces
+// can't be labeled, the instance is. Its labels are replaced as a whole, the
+// ones it has are kept, and nothing is sent if it has all labels already. The
+// labels are informative, failing to set them doesn't fail the change.
+func (g *GCP) labelInstance(ctx context.Context, project, zone string, instance *google.Instance) {
+	if !g.labelsResources() {
+		return
+	}
+	labels := map[string]string{}
+	for key, value := range instance.Labels {
+		labels[key] = value
+	}
+	changed := false
+	for key, value := range g.getResourceLabels() {
+		if current, ok := labels[key]; !ok || current != value {
+			labels[key] = value
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	operation, err := g.client.Instances.SetLabels(project, zone, instance.Name, &google.InstancesSetLabelsRequest{
+		Labels:           labels,
+		LabelFingerprint: instance.LabelFingerprint,
+	}).Context(ctx).Do()
+	if err == nil {
+		err = g.waitForCompletion(ctx, project, zone, operation.Name)
+	}
+	if err != nil {
+		klog.Warningf("Could not label instance %s, err: %v", instance.Name, err)
+	}
+}
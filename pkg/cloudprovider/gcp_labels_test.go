@@ -0,0 +1,97 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	google "google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+)
+
+func TestParseGCPResourceLabels(t *testing.T) {
+	tcs := []struct {
+		labels   string
+		expected map[string]string
+		err      bool
+	}{
+		{expected: map[string]string{}},
+		{labels: "cost-center=networking, team=sdn_1,empty=", expected: map[string]string{"cost-center": "networking", "team": "sdn_1", "empty": ""}},
+		{labels: "Team=sdn", err: true},
+		{labels: "team=SDN", err: true},
+		{labels: "1team=sdn", err: true},
+		{labels: "team", err: true},
+		{labels: "team=" + strings.Repeat("a", 64), err: true},
+		{labels: "goog-dm=sdn", err: true},
+	}
+	for i, tc := range tcs {
+		labels, err := parseGCPResourceLabels(tc.labels)
+		if tc.err != (err != nil) {
+			t.Fatalf("TestParseGCPResourceLabels(%d): expected an error: %v, err: %v", i, tc.err, err)
+		}
+		if !tc.err && !reflect.DeepEqual(labels, tc.expected) {
+			t.Fatalf("TestParseGCPResourceLabels(%d): expected labels %v, got %v", i, tc.expected, labels)
+		}
+	}
+}
+
+func TestGCPLabelInstance(t *testing.T) {
+	tcs := []struct {
+		cfg            CloudProviderConfig
+		resourceLabels map[string]string
+		labels         map[string]string
+		expected       map[string]string
+	}{
+		// Nothing is labeled by default.
+		{labels: map[string]string{"role": "worker"}},
+		{
+			cfg:      CloudProviderConfig{GCPLabelResources: true, ClusterID: "Cluster.ID"},
+			labels:   map[string]string{"role": "worker"},
+			expected: map[string]string{"role": "worker", gcpClusterIDLabelKey: "cluster-id", gcpOwnedByLabelKey: "cloud-network-config-controller"},
+		},
+		{
+			resourceLabels: map[string]string{"team": "sdn"},
+			labels:         map[string]string{"team": "storage"},
+			expected:       map[string]string{"team": "sdn"},
+		},
+		// Instances with all labels already aren't labeled again.
+		{
+			cfg:    CloudProviderConfig{GCPLabelResources: true},
+			labels: map[string]string{"role": "worker", gcpOwnedByLabelKey: "cloud-network-config-controller"},
+		},
+	}
+	for i, tc := range tcs {
+		var labels map[string]string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodPost && r.URL.Path == "/projects/project/zones/zone/instances/worker-0/setLabels":
+				request := &google.InstancesSetLabelsRequest{}
+				if err := json.NewDecoder(r.Body).Decode(request); err != nil || request.LabelFingerprint != "fingerprint" {
+					w.WriteHeader(http.StatusPreconditionFailed)
+					return
+				}
+				labels = request.Labels
+				_ = json.NewEncoder(w).Encode(&google.Operation{Name: "operation-1"})
+			case r.Method == http.MethodGet && r.URL.Path == "/projects/project/zones/zone/operations/operation-1":
+				_ = json.NewEncoder(w).Encode(&google.Operation{Status: "DONE"})
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		client, err := google.NewService(context.Background(), option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+		if err != nil {
+			t.Fatalf("TestGCPLabelInstance(%d): received unexpected error, err: %v", i, err)
+		}
+		g := &GCP{CloudProvider: CloudProvider{ctx: context.Background(), cfg: tc.cfg}, client: client, resourceLabels: tc.resourceLabels}
+		g.labelInstance(context.Background(), "project", "zone", &google.Instance{Name: "worker-0", Labels: tc.labels, LabelFingerprint: "fingerprint"})
+		server.Close()
+		if fmt.Sprint(labels) != fmt.Sprint(tc.expected) {
+			t.Fatalf("TestGCPLabelInstance(%d): expected labels %v, got %v", i, tc.expected, labels)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package cloudprovider
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	google "google.golang.org/api/compute/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// GCPNetworkInterfaceSelectorAnnotation can be set on a node to the
+	// selector of the network interface egress IPs are assigned to,
+	// overriding -platform-gcp-network-interface-selector for that node.
+	GCPNetworkInterfaceSelectorAnnotation = "cloud.network.openshift.io/gcp-network-interface-selector"
+
+	gcpNetworkInterfaceSelectorSubnetwork = "subnetwork"
+	gcpNetworkInterfaceSelectorName       = "name"
+	gcpNetworkInterfaceSelectorNetwork    = "network"
+)
+
+// gcpNetworkInterfaceSelector selects the network interface of multi-NIC
+// instances egress IPs are assigned to, by subnetwork, name pattern or VPC
+// network. GCP network tags are set on instances, not on their network
+// interfaces, so they can't select one.
+type gcpNetworkInterfaceSelector struct {
+	kind string
+	// value is the subnetwork or network URL, or the name pattern.
+	value string
+}
+
+func (s *gcpNetworkInterfaceSelector) String() string {
+	return fmt.Sprintf("%s=%s", s.kind, s.value)
+}
+
+// parseGCPNetworkInterfaceSelector parses a network interface selector, one
+// of: subnetwork=<URL>, name=<pattern>, network=<URL>. The pattern follows the
+// syntax of path.Match. It returns nil for an empty selector.
+func parseGCPNetworkInterfaceSelector(s string) (*gcpNetworkInterfaceSelector, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	kind, value, ok := strings.Cut(s, "=")
+	if !ok || value == "" {
+		return nil, fmt.Errorf("invalid GCP network interface selector %q, expected <kind>=<value>", s)
+	}
+	selector := &gcpNetworkInterfaceSelector{kind: kind, value: strings.Trim(value, "/")}
+	switch kind {
+	case gcpNetworkInterfaceSelectorSubnetwork, gcpNetworkInterfaceSelectorNetwork:
+	case gcpNetworkInterfaceSelectorName:
+		if _, err := path.Match(value, ""); err != nil {
+			return nil, fmt.Errorf("invalid GCP network interface selector %q, bad name pattern: %v", s, err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid GCP network interface selector %q, kind must be one of: %s, %s, %s", s,
+			gcpNetworkInterfaceSelectorSubnetwork, gcpNetworkInterfaceSelectorName, gcpNetworkInterfaceSelectorNetwork)
+	}
+	return selector, nil
+}
+
+// selectNetworkInterface returns the network interface egress IPs are
+// assigned to, out of the instance's network interfaces in the order GCP
+// specifies: the first one matching the node's selector annotation, or the
+// global selector. Without selector, it's the first one, nic0.
+func (g *GCP) selectNetworkInterface(node *corev1.Node, networkInterfaces []*google.NetworkInterface) (*google.NetworkInterface, error) {
+	selector := g.networkInterfaceSelector
+	if annotation, ok := node.Annotations[GCPNetworkInterfaceSelectorAnnotation]; ok {
+		var err error
+		if selector, err = parseGCPNetworkInterfaceSelector(annotation); err != nil {
+			return nil, fmt.Errorf("error parsing annotation %s of node %s, err: %v", GCPNetworkInterfaceSelectorAnnotation, node.Name, err)
+		}
+	}
+	if selector == nil {
+		return networkInterfaces[0], nil
+	}
+	for _, networkInterface := range networkInterfaces {
+		if networkInterface != nil && selector.matches(networkInterface) {
+			return networkInterface, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no network interface of node %s matches selector %s", NoNetworkInterfaceError, node.Name, selector)
+}
+
+// matches returns true if the network interface matches the selector. The
+// URLs of the subnetwork and network match their full URL as well as any
+// trailing part of it, e.g. projects/<project>/regions/<region>/subnetworks/<name>
+// or just <name>.
+func (s *gcpNetworkInterfaceSelector) matches(networkInterface *google.NetworkInterface) bool {
+	switch s.kind {
+	case gcpNetworkInterfaceSelectorSubnetwork:
+		return matchesGCPURL(networkInterface.Subnetwork, s.value)
+	case gcpNetworkInterfaceSelectorNetwork:
+		return matchesGCPURL(networkInterface.Network, s.value)
+	default:
+		matched, _ := path.Match(s.value, networkInterface.Name)
+		return matched
+	}
+}
+
+func matchesGCPURL(url, value string) bool {
+	return url != "" && strings.HasSuffix("/"+strings.Trim(url, "/"), "/"+value)
+}
@@ -0,0 +1,58 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	google "google.golang.org/api/compute/v1"
+)
+
+const (
+	// defaultGCPOperationPollInterval, defaultGCPOperationPollMaxInterval and
+	// defaultGCPOperationTimeout apply if GCPOperationPollInterval,
+	// GCPOperationPollMaxInterval and GCPOperationTimeout aren't set.
+	defaultGCPOperationPollInterval    = time.Second
+	defaultGCPOperationPollMaxInterval = 10 * time.Second
+	defaultGCPOperationTimeout         = 5 * time.Minute
+)
+
+// The GCP zone operations API call. All GCP infrastructure modifications are
+// assigned a unique operation ID and are queued in a global/zone operations
+// queue. In the case of assignments of private IP addresses to instances, the
+// operation is added to the zone operations queue. Hence we need to keep the
+// opName and the zone the instance lives in. The operation is polled every
+// GCPOperationPollInterval at first, the interval doubling after every poll up
+// to GCPOperationPollMaxInterval, until it's done or GCPOperationTimeout
+// elapsed, see pollUntilDone.
+func (g *GCP) waitForCompletion(ctx context.Context, project, zone, opName string) error {
+	interval, maxInterval, timeout := g.cfg.GCPOperationPollInterval, g.cfg.GCPOperationPollMaxInterval, g.cfg.GCPOperationTimeout
+	if interval <= 0 {
+		interval = defaultGCPOperationPollInterval
+	}
+	if maxInterval <= 0 {
+		maxInterval = defaultGCPOperationPollMaxInterval
+	}
+	if timeout <= 0 {
+		timeout = defaultGCPOperationTimeout
+	}
+	return g.pollUntilDone(ctx, "operation "+opName, interval, maxInterval, timeout, func(ctx context.Context) (bool, error) {
+		op, err := g.client.ZoneOperations.Get(project, zone, opName).Context(ctx).Do()
+		if err != nil {
+			return false, err
+		}
+		return op.Status == "DONE", gcpOperationError(op)
+	})
+}
+
+// gcpOperationError returns the error of the done operation, if it failed.
+func gcpOperationError(op *google.Operation) error {
+	if op.Error != nil {
+		data, err := op.Error.MarshalJSON()
+		if err != nil {
+			return fmt.Errorf("failed marshaling error %v", op.Error)
+		}
+		return fmt.Errorf("%s", string(data))
+	}
+	return nil
+}
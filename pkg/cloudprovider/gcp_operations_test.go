@@ -0,0 +1,79 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	google "google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+)
+
+func TestGCPWaitForCompletion(t *testing.T) {
+	tcs := []struct {
+		// running is the number of polls the operation is still running for.
+		running  int
+		failed   bool
+		shutdown bool
+		polls    int
+		err      bool
+	}{
+		{polls: 1},
+		{running: 3, polls: 4},
+		{running: 1, failed: true, polls: 2, err: true},
+		// The operation isn't done by the deadline.
+		{running: 1000, err: true},
+		// The wait is abandoned on shutdown.
+		{running: 1000, shutdown: true, err: true},
+	}
+	for i, tc := range tcs {
+		polls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet || r.URL.Path != "/projects/project/zones/zone/operations/operation-1" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			polls++
+			op := &google.Operation{Name: "operation-1", Status: "RUNNING"}
+			if polls > tc.running {
+				op.Status = "DONE"
+				if tc.failed {
+					op.Error = &google.OperationError{Errors: []*google.OperationErrorErrors{{Code: "QUOTA_EXCEEDED"}}}
+				}
+			}
+			_ = json.NewEncoder(w).Encode(op)
+		}))
+		client, err := google.NewService(context.Background(), option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+		if err != nil {
+			t.Fatalf("TestGCPWaitForCompletion(%d): received unexpected error, err: %v", i, err)
+		}
+		cfg := CloudProviderConfig{
+			GCPOperationPollInterval:    time.Millisecond,
+			GCPOperationPollMaxInterval: 4 * time.Millisecond,
+			GCPOperationTimeout:         200 * time.Millisecond,
+		}
+		if tc.shutdown {
+			shutdownCtx, cancel := context.WithCancel(context.Background())
+			cfg.ShutdownContext = shutdownCtx
+			cfg.GCPOperationTimeout = time.Hour
+			time.AfterFunc(50*time.Millisecond, cancel)
+		}
+		g := &GCP{CloudProvider: CloudProvider{ctx: context.Background(), cfg: cfg}, client: client}
+
+		start := time.Now()
+		err = g.waitForCompletion(context.Background(), "project", "zone", "operation-1")
+		server.Close()
+		if tc.err != (err != nil) {
+			t.Fatalf("TestGCPWaitForCompletion(%d): expected an error: %v, err: %v", i, tc.err, err)
+		}
+		if tc.polls != 0 && polls != tc.polls {
+			t.Fatalf("TestGCPWaitForCompletion(%d): expected %d polls, got %d", i, tc.polls, polls)
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Fatalf("TestGCPWaitForCompletion(%d): expected the wait to end early, took %v", i, elapsed)
+		}
+	}
+}
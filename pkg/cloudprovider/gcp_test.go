@@ -1,8 +1,15 @@
 package cloudprovider
 
 import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"reflect"
 	"testing"
 
+	google "google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
 	corev1 "k8s.io/api/core/v1"
 )
 
@@ -29,3 +36,255 @@ func TestSplitGCPNode(t *testing.T) {
 		t.Fatalf("wrong name: %s", instance)
 	}
 }
+
+func TestParseGCPSubnet(t *testing.T) {
+	tcs := []struct {
+		subnetURL        string
+		networkProjectID string
+		project          string
+		region           string
+		subnet           string
+		expectErr        bool
+	}{
+		{
+			subnetURL: "https://www.googleapis.com/compute/v1/projects/openshift-qe/regions/us-central1/subnetworks/worker-subnet",
+			project:   "openshift-qe",
+			region:    "us-central1",
+			subnet:    "worker-subnet",
+		},
+		// Shared VPC: the subnet lives in the host project.
+		{
+			subnetURL:        "https://www.googleapis.com/compute/v1/projects/host-project/regions/us-central1/subnetworks/worker-subnet",
+			networkProjectID: "other-project",
+			project:          "host-project",
+			region:           "us-central1",
+			subnet:           "worker-subnet",
+		},
+		{
+			subnetURL: "projects/host-project/regions/us-central1/subnetworks/worker-subnet",
+			project:   "host-project",
+			region:    "us-central1",
+			subnet:    "worker-subnet",
+		},
+		{
+			subnetURL:        "regions/us-central1/subnetworks/worker-subnet",
+			networkProjectID: "host-project",
+			project:          "host-project",
+			region:           "us-central1",
+			subnet:           "worker-subnet",
+		},
+		{
+			subnetURL: "regions/us-central1/subnetworks/worker-subnet",
+			project:   "openshift-qe",
+			region:    "us-central1",
+			subnet:    "worker-subnet",
+		},
+		{
+			subnetURL: "https://www.googleapis.com/compute/v1/projects/openshift-qe/global/networks/default",
+			expectErr: true,
+		},
+		{
+			subnetURL: "worker-subnet",
+			expectErr: true,
+		},
+	}
+	for i, tc := range tcs {
+		g := &GCP{CloudProvider: CloudProvider{cfg: CloudProviderConfig{GCPNetworkProjectID: tc.networkProjectID}}}
+		project, region, subnet, err := g.parseSubnet(tc.subnetURL, "openshift-qe")
+		if tc.expectErr {
+			if err == nil {
+				t.Fatalf("TestParseGCPSubnet(%d): expected an error for %s", i, tc.subnetURL)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestParseGCPSubnet(%d): received unexpected error, err: %v", i, err)
+		}
+		if project != tc.project || region != tc.region || subnet != tc.subnet {
+			t.Fatalf("TestParseGCPSubnet(%d): expected %s/%s/%s, got %s/%s/%s", i, tc.project, tc.region, tc.subnet, project, region, subnet)
+		}
+	}
+}
+
+func TestGCPGetCapacity(t *testing.T) {
+	tcs := []struct {
+		aliasIPRanges []string
+		limit         int
+		capacity      int
+	}{
+		{capacity: 10},
+		// Both IP families, and ranges, take from the same limit.
+		{aliasIPRanges: []string{"10.0.32.25", "10.0.32.26/32", "10.0.48.0/28", "fd00::25"}, capacity: 6},
+		{aliasIPRanges: []string{"10.0.32.25", "fd00::25"}, limit: 100, capacity: 98},
+		{aliasIPRanges: []string{"10.0.32.25", "10.0.32.26", "10.0.32.27"}, limit: 2, capacity: 0},
+	}
+	for i, tc := range tcs {
+		g := &GCP{CloudProvider: CloudProvider{cfg: CloudProviderConfig{GCPAliasIPRangesPerInterface: tc.limit}}}
+		networkInterface := &google.NetworkInterface{}
+		for _, aliasIPRange := range tc.aliasIPRanges {
+			networkInterface.AliasIpRanges = append(networkInterface.AliasIpRanges, &google.AliasIpRange{IpCidrRange: aliasIPRange})
+		}
+		if capacity := g.getCapacity(networkInterface); capacity != tc.capacity {
+			t.Fatalf("TestGCPGetCapacity(%d): expected capacity %d, got %d", i, tc.capacity, capacity)
+		}
+	}
+}
+
+func TestGCPSelectNetworkInterface(t *testing.T) {
+	const computeURL = "https://www.googleapis.com/compute/v1/projects/project/"
+	networkInterfaces := []*google.NetworkInterface{
+		{Name: "nic0", Network: computeURL + "global/networks/machine", Subnetwork: computeURL + "regions/us-central1/subnetworks/machine"},
+		{Name: "nic1", Network: computeURL + "global/networks/egress", Subnetwork: computeURL + "regions/us-central1/subnetworks/egress"},
+		{Name: "nic2", Network: computeURL + "global/networks/storage", Subnetwork: computeURL + "regions/us-central1/subnetworks/storage"},
+	}
+	annotation := func(s string) *string { return &s }
+
+	tcs := []struct {
+		selector   string
+		annotation *string
+		expected   string
+		err        bool
+	}{
+		{expected: "nic0"},
+		{selector: "subnetwork=" + computeURL + "regions/us-central1/subnetworks/egress", expected: "nic1"},
+		// URLs match by any trailing part.
+		{selector: "subnetwork=projects/project/regions/us-central1/subnetworks/egress", expected: "nic1"},
+		{selector: "subnetwork=storage", expected: "nic2"},
+		{selector: "subnetwork=orage", err: true},
+		{selector: "network=global/networks/egress", expected: "nic1"},
+		{selector: "name=nic[12]", expected: "nic1"},
+		{selector: "network=unknown", err: true},
+		// The node's annotation overrides the global selector, even if empty.
+		{selector: "network=egress", annotation: annotation("name=nic2"), expected: "nic2"},
+		{selector: "network=egress", annotation: annotation(""), expected: "nic0"},
+		{annotation: annotation("tag=egress"), err: true},
+		{annotation: annotation("name=[nic"), err: true},
+	}
+	for i, tc := range tcs {
+		selector, err := parseGCPNetworkInterfaceSelector(tc.selector)
+		if err != nil {
+			t.Fatalf("TestGCPSelectNetworkInterface(%d): received unexpected error, err: %q", i, err)
+		}
+		g := &GCP{networkInterfaceSelector: selector}
+		node := &corev1.Node{}
+		node.Name = "worker-0"
+		if tc.annotation != nil {
+			node.Annotations = map[string]string{GCPNetworkInterfaceSelectorAnnotation: *tc.annotation}
+		}
+		networkInterface, err := g.selectNetworkInterface(node, networkInterfaces)
+		if tc.err {
+			if err == nil {
+				t.Fatalf("TestGCPSelectNetworkInterface(%d): expected an error, got %s", i, networkInterface.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestGCPSelectNetworkInterface(%d): received unexpected error, err: %q", i, err)
+		}
+		if networkInterface.Name != tc.expected {
+			t.Fatalf("TestGCPSelectNetworkInterface(%d): expected network interface %s, got %s", i, tc.expected, networkInterface.Name)
+		}
+	}
+}
+
+func TestGCPVerifyPrivateIP(t *testing.T) {
+	tcs := []struct {
+		assigned []string
+		ip       string
+		missing  bool
+	}{
+		{assigned: []string{"10.0.32.4/32", "10.0.32.10"}, ip: "10.0.32.10"},
+		{assigned: []string{"10.0.32.4/32", "10.0.32.10"}, ip: "10.0.32.4"},
+		// The alias IP range was removed out of band.
+		{assigned: []string{"10.0.32.4/32"}, ip: "10.0.32.10", missing: true},
+		{ip: "10.0.32.10", missing: true},
+	}
+	for i, tc := range tcs {
+		server := httptest.NewServer(&fakeGCPInstance{aliases: tc.assigned})
+		client, err := google.NewService(context.Background(), option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+		if err != nil {
+			t.Fatalf("TestGCPVerifyPrivateIP(%d): received unexpected error, err: %v", i, err)
+		}
+		g := &GCP{CloudProvider: CloudProvider{ctx: context.Background()}, client: client}
+		node := &corev1.Node{}
+		node.Name = "worker-0"
+		node.Spec.ProviderID = "gce://project/zone/worker-0"
+		err = g.VerifyPrivateIP(context.Background(), net.ParseIP(tc.ip), node)
+		server.Close()
+		if tc.missing != errors.Is(err, MissingIPError) {
+			t.Fatalf("TestGCPVerifyPrivateIP(%d): expected a missing IP: %v, err: %v", i, tc.missing, err)
+		}
+		if !tc.missing && err != nil {
+			t.Fatalf("TestGCPVerifyPrivateIP(%d): received unexpected error, err: %v", i, err)
+		}
+	}
+}
+
+func TestGetGCPComputeEndpoint(t *testing.T) {
+	tcs := []struct {
+		apiURL   string
+		expected string
+		err      bool
+	}{
+		{apiURL: "https://restricted.googleapis.com", expected: "https://restricted.googleapis.com/compute/v1/"},
+		{apiURL: "https://restricted.googleapis.com/", expected: "https://restricted.googleapis.com/compute/v1/"},
+		{apiURL: "https://compute-egress.p.googleapis.com/compute/v1/", expected: "https://compute-egress.p.googleapis.com/compute/v1/"},
+		{apiURL: "https://compute.example.com:8443/compute/beta", expected: "https://compute.example.com:8443/compute/beta/"},
+		{apiURL: "restricted.googleapis.com", err: true},
+		{apiURL: "://restricted.googleapis.com", err: true},
+	}
+	for i, tc := range tcs {
+		endpoint, err := getGCPComputeEndpoint(tc.apiURL)
+		if tc.err != (err != nil) {
+			t.Fatalf("TestGetGCPComputeEndpoint(%d): expected an error: %v, err: %v", i, tc.err, err)
+		}
+		if endpoint != tc.expected {
+			t.Fatalf("TestGetGCPComputeEndpoint(%d): expected endpoint %q, got %q", i, tc.expected, endpoint)
+		}
+	}
+}
+
+func TestGCPListOwnedResources(t *testing.T) {
+	// 10.0.48.0/24 wasn't assigned by the controller, only /32 ranges are.
+	fake := &fakeGCPInstance{aliases: []string{"10.0.32.4/32", "10.0.32.10", "10.0.48.0/24"}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client, err := google.NewService(context.Background(), option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("TestGCPListOwnedResources: received unexpected error, err: %v", err)
+	}
+	g := &GCP{CloudProvider: CloudProvider{ctx: context.Background()}, client: client}
+	node := &corev1.Node{}
+	node.Name = "worker-0"
+	node.Spec.ProviderID = "gce://project/zone/worker-0"
+	// The instance of the second node doesn't exist, it's skipped.
+	gone := &corev1.Node{}
+	gone.Name = "worker-1"
+	gone.Spec.ProviderID = "gce://project/zone/worker-1"
+
+	resources, err := g.ListOwnedResources(context.Background(), []*corev1.Node{node, gone})
+	if err != nil {
+		t.Fatalf("TestGCPListOwnedResources: received unexpected error, err: %v", err)
+	}
+	found := []string{}
+	for _, resource := range resources {
+		if resource.Node != "worker-0" {
+			t.Fatalf("TestGCPListOwnedResources: expected %s to belong to worker-0, got %q", resource.ID, resource.Node)
+		}
+		found = append(found, resource.ID)
+	}
+	expected := []string{"worker-0/nic0/10.0.32.4", "worker-0/nic0/10.0.32.10"}
+	if !reflect.DeepEqual(found, expected) {
+		t.Fatalf("TestGCPListOwnedResources: expected %v, got %v", expected, found)
+	}
+
+	if err := g.DeleteOwnedResource(context.Background(), resources[0]); err != nil {
+		t.Fatalf("TestGCPListOwnedResources: received unexpected error deleting %s, err: %v", resources[0].ID, err)
+	}
+	if !reflect.DeepEqual(fake.aliases, []string{"10.0.32.10", "10.0.48.0/24"}) {
+		t.Fatalf("TestGCPListOwnedResources: expected the alias IP range of 10.0.32.4 to be removed, got %v", fake.aliases)
+	}
+	if err := g.DeleteOwnedResource(context.Background(), resources[0]); !errors.Is(err, NonExistingIPError) {
+		t.Fatalf("TestGCPListOwnedResources: expected a NonExistingIPError deleting %s again, got err: %v", resources[0].ID, err)
+	}
+}
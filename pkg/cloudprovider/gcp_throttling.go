@@ -0,0 +1,201 @@
+package cloudprovider
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openshift/cloud-network-config-controller/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// gcpMaxRetries is the number of times a request throttled by GCP, or
+	// failing with a transient server error, is retried.
+	gcpMaxRetries = 4
+	// gcpRetryBaseDelay is the delay before the first retry, doubling on
+	// every retry up to gcpRetryMaxDelay, unless the response has a
+	// Retry-After header.
+	gcpRetryBaseDelay = time.Second
+	gcpRetryMaxDelay  = 16 * time.Second
+)
+
+var (
+	// gcpRetryStatusCodes are the status codes of the responses worth
+	// retrying: throttling, i.e. 429 Too Many Requests when exceeding the
+	// rate quotas of the Compute API, and transient server errors.
+	gcpRetryStatusCodes = map[int]bool{
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusGatewayTimeout:      true,
+	}
+
+	gcpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "gcp_requests_total",
+		Help:      "Number of Compute API requests sent, retries included, by HTTP method, resource and status code, error for requests without response.",
+	}, []string{"method", "resource", "code"})
+	gcpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Name:      "gcp_request_duration_seconds",
+		Help:      "Duration of the Compute API requests, retries included, in seconds.",
+		Buckets:   metrics.DefaultDurationBuckets,
+	}, []string{"method", "resource"})
+	gcpRequestRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "gcp_request_retries_total",
+		Help:      "Number of Compute API requests retried, by HTTP method, resource and status code of the retried response.",
+	}, []string{"method", "resource", "code"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		gcpRequestsTotal,
+		gcpRequestDuration,
+		gcpRequestRetriesTotal,
+	)
+}
+
+// gcpRetryTransport retries the Compute API requests throttled by GCP, or
+// failing with a transient server error, with a jittered exponential backoff,
+// and exports metrics of all requests. The Compute client doesn't retry any
+// request on its own. Once throttled, all requests wait for the backoff of the
+// throttled one rather than being sent only to be throttled in turn, which
+// would further delay the recovery of the quota. Retrying writes is safe: the
+// only one, the update of a network interface, carries its fingerprint, so
+// that the replay of an update which went through fails rather than applying
+// it twice.
+type gcpRetryTransport struct {
+	next http.RoundTripper
+	// baseDelay is the delay before the first retry, gcpRetryBaseDelay if 0.
+	baseDelay time.Duration
+
+	mu    sync.Mutex
+	until time.Time
+}
+
+func (t *gcpRetryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resource := getGCPRequestResource(r.URL.Path)
+	for attempt := 0; ; attempt++ {
+		if err := t.wait(r); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		resp, err := t.next.RoundTrip(r)
+		gcpRequestDuration.WithLabelValues(r.Method, resource).Observe(time.Since(start).Seconds())
+		if err != nil {
+			gcpRequestsTotal.WithLabelValues(r.Method, resource, "error").Inc()
+			return nil, err
+		}
+		code := strconv.Itoa(resp.StatusCode)
+		gcpRequestsTotal.WithLabelValues(r.Method, resource, code).Inc()
+		if !gcpRetryStatusCodes[resp.StatusCode] || attempt >= gcpMaxRetries || (r.Body != nil && r.GetBody == nil) {
+			return resp, nil
+		}
+		delay := t.backoff(resp, attempt)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			t.throttled(delay)
+		}
+		if !fitsDeadline(r, delay) {
+			return resp, nil
+		}
+		gcpRequestRetriesTotal.WithLabelValues(r.Method, resource, code).Inc()
+		klog.Warningf("GCP request %s %s failed with %s, retrying in %v", r.Method, r.URL.Path, resp.Status, delay)
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		if r.GetBody != nil {
+			body, err := r.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = r.Clone(r.Context())
+			r.Body = body
+		}
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+	}
+}
+
+// backoff returns the delay before retrying the request, the one of the
+// Retry-After header of the response if any, an exponential backoff with
+// jitter otherwise: a random delay between half and all of baseDelay*2^attempt,
+// up to gcpRetryMaxDelay.
+func (t *gcpRetryTransport) backoff(resp *http.Response, attempt int) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	delay := t.baseDelay
+	if delay <= 0 {
+		delay = gcpRetryBaseDelay
+	}
+	for i := 0; i < attempt && delay < gcpRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > gcpRetryMaxDelay {
+		delay = gcpRetryMaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// wait waits until GCP stops throttling requests. If that's after the
+// deadline of the request, it fails right away instead.
+func (t *gcpRetryTransport) wait(r *http.Request) error {
+	t.mu.Lock()
+	delay := time.Until(t.until)
+	t.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	if !fitsDeadline(r, delay) {
+		return fmt.Errorf("GCP requests throttled for another %v, beyond the deadline of request %s %s", delay.Round(time.Second), r.Method, r.URL.Path)
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-r.Context().Done():
+		return r.Context().Err()
+	}
+}
+
+func (t *gcpRetryTransport) throttled(delay time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until := time.Now().Add(delay); until.After(t.until) {
+		t.until = until
+	}
+}
+
+// getGCPRequestResource returns the kind of resource the Compute API request
+// of path is about, the last collection or method of the path, e.g. instances
+// for .../zones/<zone>/instances/<instance>, or updateNetworkInterface for
+// .../instances/<instance>/updateNetworkInterface, keeping the cardinality of
+// the metrics bounded.
+func getGCPRequestResource(path string) string {
+	_, path, ok := strings.Cut(path, "/projects/")
+	if !ok {
+		return "unknown"
+	}
+	// The collections and methods are every other segment, following the
+	// project.
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	resource := "projects"
+	for i := 1; i < len(segments); i += 2 {
+		if segments[i] == "aggregated" && i+1 < len(segments) {
+			i++
+		}
+		resource = segments[i]
+	}
+	return resource
+}
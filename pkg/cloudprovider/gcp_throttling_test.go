@@ -0,0 +1,113 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	google "google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+)
+
+func TestGCPRetryTransport(t *testing.T) {
+	tcs := []struct {
+		// failures is the number of requests failing with status before one
+		// succeeds.
+		failures   int
+		status     int
+		retryAfter string
+		timeout    time.Duration
+		requests   int
+		expectErr  bool
+	}{
+		{requests: 1},
+		{failures: 2, status: http.StatusTooManyRequests, requests: 3},
+		{failures: 1, status: http.StatusServiceUnavailable, retryAfter: "0", requests: 2},
+		// Requests are retried at most gcpMaxRetries times.
+		{failures: 10, status: http.StatusInternalServerError, requests: gcpMaxRetries + 1, expectErr: true},
+		// Client errors aren't retried.
+		{failures: 1, status: http.StatusForbidden, requests: 1, expectErr: true},
+		// Retrying after the deadline of the request is pointless.
+		{failures: 1, status: http.StatusTooManyRequests, retryAfter: "60", timeout: time.Second, requests: 1, expectErr: true},
+	}
+	for i, tc := range tcs {
+		var mu sync.Mutex
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			requests++
+			// Retried requests are sent with their body.
+			if body, _ := ioutil.ReadAll(r.Body); len(body) == 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if requests <= tc.failures {
+				w.Header().Set("Retry-After", tc.retryAfter)
+				w.WriteHeader(tc.status)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(&google.Operation{Name: "operation"})
+		}))
+		transport := &gcpRetryTransport{next: http.DefaultTransport, baseDelay: time.Millisecond}
+		client, err := google.NewService(context.Background(), option.WithEndpoint(server.URL+"/"), option.WithHTTPClient(&http.Client{Transport: transport}))
+		if err != nil {
+			t.Fatalf("TestGCPRetryTransport(%d): received unexpected error, err: %v", i, err)
+		}
+		retriesBefore := testutil.ToFloat64(gcpRequestRetriesTotal.WithLabelValues(http.MethodPatch, "updateNetworkInterface", "429")) +
+			testutil.ToFloat64(gcpRequestRetriesTotal.WithLabelValues(http.MethodPatch, "updateNetworkInterface", "500")) +
+			testutil.ToFloat64(gcpRequestRetriesTotal.WithLabelValues(http.MethodPatch, "updateNetworkInterface", "503"))
+		durationsBefore := histogramCount(gcpRequestDuration, http.MethodPatch, "updateNetworkInterface")
+
+		ctx := context.Background()
+		if tc.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+			defer cancel()
+		}
+		_, err = client.Instances.UpdateNetworkInterface("project", "zone", "worker-0", "nic0", &google.NetworkInterface{Name: "nic0"}).Context(ctx).Do()
+		server.Close()
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestGCPRetryTransport(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		if requests != tc.requests {
+			t.Fatalf("TestGCPRetryTransport(%d): expected %d requests, got %d", i, tc.requests, requests)
+		}
+		retries := testutil.ToFloat64(gcpRequestRetriesTotal.WithLabelValues(http.MethodPatch, "updateNetworkInterface", "429")) +
+			testutil.ToFloat64(gcpRequestRetriesTotal.WithLabelValues(http.MethodPatch, "updateNetworkInterface", "500")) +
+			testutil.ToFloat64(gcpRequestRetriesTotal.WithLabelValues(http.MethodPatch, "updateNetworkInterface", "503")) - retriesBefore
+		expectedRetries := tc.requests - 1
+		if retries != float64(expectedRetries) {
+			t.Fatalf("TestGCPRetryTransport(%d): expected %d retries, got %v", i, expectedRetries, retries)
+		}
+		if durations := histogramCount(gcpRequestDuration, http.MethodPatch, "updateNetworkInterface") - durationsBefore; durations != uint64(tc.requests) {
+			t.Fatalf("TestGCPRetryTransport(%d): expected %d request durations, got %d", i, tc.requests, durations)
+		}
+	}
+}
+
+func TestGetGCPRequestResource(t *testing.T) {
+	tcs := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/compute/v1/projects/project/zones/zone/instances/worker-0", expected: "instances"},
+		{path: "/compute/v1/projects/project/zones/zone/instances/worker-0/updateNetworkInterface", expected: "updateNetworkInterface"},
+		{path: "/compute/v1/projects/project/zones/zone/operations/operation-1", expected: "operations"},
+		{path: "/compute/v1/projects/project/regions/region/subnetworks/subnet", expected: "subnetworks"},
+		{path: "/compute/v1/projects/project/aggregated/instances", expected: "instances"},
+		{path: "/projects/project", expected: "projects"},
+		{path: "/token", expected: "unknown"},
+	}
+	for i, tc := range tcs {
+		if resource := getGCPRequestResource(tc.path); resource != tc.expected {
+			t.Fatalf("TestGetGCPRequestResource(%d): expected resource %q, got %q", i, tc.expected, resource)
+		}
+	}
+}
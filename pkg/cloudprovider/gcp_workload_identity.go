@@ -0,0 +1,59 @@
+package cloudprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"k8s.io/klog/v2"
+)
+
+// gcpExternalAccountType is the type of the credentials of workload identity
+// federation, which exchange a token of an external identity provider, e.g. a
+// projected service account token, for access tokens of the Compute API.
+const gcpExternalAccountType = "external_account"
+
+// getCredentialsJSON returns the credentials to authenticate with, read from
+// the service_account.json key of the secret: either a service account key, or
+// an external account configuration, as generated for workload identity
+// federation. The subject token file of the latter is GCPFederatedTokenFile, if
+// set, e.g. if the projected service account token isn't mounted where the
+// configuration expects it. The token file is read again on every refresh of
+// the access tokens, which happens automatically before they expire.
+func (g *GCP) getCredentialsJSON() ([]byte, error) {
+	rawSecretData, err := g.readSecretData("service_account.json")
+	if err != nil {
+		return nil, err
+	}
+	var credentials map[string]interface{}
+	if err := json.Unmarshal([]byte(rawSecretData), &credentials); err != nil {
+		return nil, fmt.Errorf("error parsing GCP credentials, err: %v", err)
+	}
+	if credentials["type"] != gcpExternalAccountType {
+		if g.cfg.GCPFederatedTokenFile != "" {
+			return nil, fmt.Errorf("a federated token file is set, but the GCP credentials are of type %v rather than %s", credentials["type"], gcpExternalAccountType)
+		}
+		return []byte(rawSecretData), nil
+	}
+	credentialSource, _ := credentials["credential_source"].(map[string]interface{})
+	if g.cfg.GCPFederatedTokenFile != "" {
+		// The file and the URL of the credential source are exclusive.
+		credentialSource = map[string]interface{}{
+			"file":   g.cfg.GCPFederatedTokenFile,
+			"format": credentialSource["format"],
+		}
+		if credentialSource["format"] == nil {
+			delete(credentialSource, "format")
+		}
+		credentials["credential_source"] = credentialSource
+	}
+	if tokenFile, ok := credentialSource["file"].(string); ok {
+		if _, err := os.Stat(tokenFile); err != nil {
+			return nil, fmt.Errorf("unable to access federated token file %s, err: %v", tokenFile, err)
+		}
+		klog.Infof("Authenticating to GCP through workload identity federation with federated token file %s", tokenFile)
+	} else {
+		klog.Infof("Authenticating to GCP through workload identity federation")
+	}
+	return json.Marshal(credentials)
+}
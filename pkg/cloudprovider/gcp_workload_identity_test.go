@@ -0,0 +1,89 @@
+package cloudprovider
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGCPCredentialsJSON(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("token-1"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	externalAccount := func(credentialSource string) string {
+		return `{"type": "external_account", "audience": "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/pool/providers/cluster", ` +
+			`"subject_token_type": "urn:ietf:params:oauth:token-type:jwt", "token_url": "https://sts.googleapis.com/v1/token", "credential_source": ` + credentialSource + `}`
+	}
+
+	tcs := []struct {
+		credentials   string
+		tokenFile     string
+		expectErr     bool
+		expectedCreds string
+	}{
+		{
+			credentials:   `{"type": "service_account", "client_email": "cncc@project.iam.gserviceaccount.com"}`,
+			expectedCreds: `{"type": "service_account", "client_email": "cncc@project.iam.gserviceaccount.com"}`,
+		},
+		// The federated token file only applies to external accounts.
+		{
+			credentials: `{"type": "service_account", "client_email": "cncc@project.iam.gserviceaccount.com"}`,
+			tokenFile:   tokenFile,
+			expectErr:   true,
+		},
+		{
+			credentials:   externalAccount(`{"file": "` + tokenFile + `", "format": {"type": "text"}}`),
+			expectedCreds: externalAccount(`{"file": "` + tokenFile + `", "format": {"type": "text"}}`),
+		},
+		{
+			credentials: externalAccount(`{"file": "/var/run/secrets/openshift/serviceaccount/token"}`),
+			expectErr:   true,
+		},
+		// The federated token file replaces the credential source, keeping its
+		// format.
+		{
+			credentials:   externalAccount(`{"url": "http://169.254.169.254/token", "format": {"type": "text"}}`),
+			tokenFile:     tokenFile,
+			expectedCreds: externalAccount(`{"file": "` + tokenFile + `", "format": {"type": "text"}}`),
+		},
+		{
+			credentials:   externalAccount(`{"file": "/var/run/secrets/openshift/serviceaccount/token"}`),
+			tokenFile:     tokenFile,
+			expectedCreds: externalAccount(`{"file": "` + tokenFile + `"}`),
+		},
+		{
+			credentials: `not JSON`,
+			expectErr:   true,
+		},
+	}
+	for i, tc := range tcs {
+		if err := ioutil.WriteFile(filepath.Join(dir, "service_account.json"), []byte(tc.credentials), 0600); err != nil {
+			t.Fatal(err)
+		}
+		g := &GCP{CloudProvider: CloudProvider{cfg: CloudProviderConfig{CredentialDir: dir, GCPFederatedTokenFile: tc.tokenFile}}}
+		credentials, err := g.getCredentialsJSON()
+		if tc.expectErr {
+			if err == nil {
+				t.Fatalf("TestGCPCredentialsJSON(%d): expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestGCPCredentialsJSON(%d): received unexpected error, err: %v", i, err)
+		}
+		var actual, expected interface{}
+		if err := json.Unmarshal(credentials, &actual); err != nil {
+			t.Fatalf("TestGCPCredentialsJSON(%d): received invalid credentials %s, err: %v", i, credentials, err)
+		}
+		if err := json.Unmarshal([]byte(tc.expectedCreds), &expected); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("TestGCPCredentialsJSON(%d): expected credentials %s, got %s", i, tc.expectedCreds, credentials)
+		}
+	}
+}
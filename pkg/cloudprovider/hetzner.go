@@ -0,0 +1,424 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+const (
+	// PlatformTypeHetzner is the string representation for the Hetzner Cloud
+	// platform type.
+	PlatformTypeHetzner = "Hetzner"
+
+	hetznerDefaultAPIURL = "https://api.hetzner.cloud/v1"
+
+	// hetznerActionTimeout applies to the actions changing the alias IPs of
+	// servers. They're polled every hetznerPollInterval at first, the
+	// interval doubling up to hetznerPollMaxInterval.
+	hetznerActionTimeout   = 5 * time.Minute
+	hetznerPollInterval    = time.Second
+	hetznerPollMaxInterval = 10 * time.Second
+
+	hetznerActionStatusError   = "error"
+	hetznerActionStatusSuccess = "success"
+)
+
+// Hetzner implements the API wrapper for talking to the Hetzner Cloud API.
+// Egress IPs are alias IPs of the servers on their private networks, which
+// only deliver the traffic of the addresses of the servers. Each network a
+// server is attached to is an interface of the node.
+type Hetzner struct {
+	CloudProvider
+	noOwnedResources
+	client *restClient
+	// serverLocks serializes the changes of the alias IPs of each server,
+	// which replace all of them.
+	serverLocks keyedMutex
+	// pollInterval is the first interval between polls of actions, doubling
+	// after every poll up to pollMaxInterval.
+	pollInterval    time.Duration
+	pollMaxInterval time.Duration
+}
+
+type hetznerPrivateNet struct {
+	Network    int64    `json:"network"`
+	IP         string   `json:"ip"`
+	AliasIPs   []string `json:"alias_ips"`
+	MACAddress string   `json:"mac_address"`
+}
+
+type hetznerServer struct {
+	ID         int64               `json:"id"`
+	PrivateNet []hetznerPrivateNet `json:"private_net"`
+}
+
+type hetznerNetwork struct {
+	ID      int64 `json:"id"`
+	Subnets []struct {
+		IPRange string `json:"ip_range"`
+	} `json:"subnets"`
+}
+
+type hetznerAction struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"`
+	Error  *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (h *Hetzner) initCredentials() error {
+	token, err := h.readSecretData("hcloud_token")
+	if err != nil {
+		return err
+	}
+	httpClient, err := newHTTPClient(h.cfg.ConfigDir)
+	if err != nil {
+		return err
+	}
+	baseURL := h.cfg.APIOverride
+	if baseURL == "" {
+		baseURL = hetznerDefaultAPIURL
+	}
+	token = strings.TrimSpace(token)
+	h.client = &restClient{
+		httpClient: httpClient,
+		baseURL:    baseURL,
+		authorize: func(r *http.Request) error {
+			r.Header.Set("Authorization", "Bearer "+token)
+			return nil
+		},
+	}
+	h.pollInterval, h.pollMaxInterval = hetznerPollInterval, hetznerPollMaxInterval
+	klog.Infof("Using the Hetzner Cloud API at %s", baseURL)
+	return nil
+}
+
+// AssignPrivateIP adds ip to the alias IPs of the node's server on the
+// network whose subnet holds it.
+func (h *Hetzner) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	if !utilnet.IsIPv4(ip) {
+		return fmt.Errorf("Hetzner Cloud networks are IPv4 only, can't assign IP address %s", ip)
+	}
+	serverID, err := getHetznerServerID(node)
+	if err != nil {
+		return err
+	}
+	defer h.serverLocks.Lock(serverID)()
+
+	server, err := h.getServer(ctx, node, serverID)
+	if err != nil {
+		return err
+	}
+	privateNet, _, err := h.getPrivateNet(ctx, server, ip)
+	if err != nil {
+		return err
+	}
+	if privateNet == nil {
+		return fmt.Errorf("IP address %s is in no subnet of the networks of server %d", ip, server.ID)
+	}
+	if ParseIP(privateNet.IP).Equal(ip) {
+		return fmt.Errorf("IP address %s is the address of server %d", ip, server.ID)
+	}
+	if hasHetznerAliasIP(privateNet, ip) {
+		return AlreadyExistingIPError
+	}
+	return h.changeAliasIPs(ctx, server, privateNet, append(privateNet.AliasIPs, ip.String()))
+}
+
+func (h *Hetzner) AllowsMovePrivateIP() bool {
+	return false
+}
+
+func (h *Hetzner) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+	return nil
+}
+
+// ReleasePrivateIP removes ip from the alias IPs of the node's server.
+func (h *Hetzner) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	serverID, err := getHetznerServerID(node)
+	if err != nil {
+		return err
+	}
+	defer h.serverLocks.Lock(serverID)()
+
+	server, err := h.getServer(ctx, node, serverID)
+	if err != nil {
+		return err
+	}
+	for i := range server.PrivateNet {
+		privateNet := &server.PrivateNet[i]
+		if !hasHetznerAliasIP(privateNet, ip) {
+			continue
+		}
+		aliasIPs := []string{}
+		for _, aliasIP := range privateNet.AliasIPs {
+			if !ParseIP(aliasIP).Equal(ip) {
+				aliasIPs = append(aliasIPs, aliasIP)
+			}
+		}
+		return h.changeAliasIPs(ctx, server, privateNet, aliasIPs)
+	}
+	return NonExistingIPError
+}
+
+func (h *Hetzner) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, h.AssignPrivateIP)
+}
+
+func (h *Hetzner) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, h.ReleasePrivateIP)
+}
+
+// GetNodeEgressIPConfiguration returns the configuration of each network of
+// the node's server, keyed by the ID of the network. Its subnet is the one
+// holding the address of the server, and its capacity the number of addresses
+// of the subnet usable by servers, less the ones of the server: the network
+// itself has no limit. Addresses used by other servers are left to the
+// network plugin, which knows the egress IPs it assigned elsewhere.
+func (h *Hetzner) GetNodeEgressIPConfiguration(ctx context.Context, node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
+	serverID, err := getHetznerServerID(node)
+	if err != nil {
+		return nil, err
+	}
+	server, err := h.getServer(ctx, node, serverID)
+	if err != nil {
+		return nil, err
+	}
+	if len(server.PrivateNet) == 0 {
+		return nil, fmt.Errorf("%w: server %d of node %s is attached to no network", NoNetworkInterfaceError, server.ID, node.Name)
+	}
+	configs := []*NodeEgressIPConfiguration{}
+	for i := range server.PrivateNet {
+		privateNet := &server.PrivateNet[i]
+		subnet, err := h.getSubnet(ctx, server, privateNet, ParseIP(privateNet.IP))
+		if err != nil {
+			return nil, err
+		}
+		if subnet == nil {
+			return nil, fmt.Errorf("address %s of server %d is in no subnet of network %d", privateNet.IP, server.ID, privateNet.Network)
+		}
+		available := getHetznerSubnetSize(subnet) - 1 - len(privateNet.AliasIPs)
+		if available < 0 {
+			available = 0
+		}
+		configs = append(configs, &NodeEgressIPConfiguration{
+			Interface: strconv.FormatInt(privateNet.Network, 10),
+			IFAddr:    ifAddr{IPv4: subnet.String()},
+			Capacity:  capacity{IPv4: available},
+			MAC:       normalizeMAC(privateNet.MACAddress),
+		})
+	}
+	return configs, nil
+}
+
+// CleanupNode is a no-op, the alias IPs are deleted together with the server.
+func (h *Hetzner) CleanupNode(ctx context.Context, node *corev1.Node) error {
+	return nil
+}
+
+// VerifyPrivateIP verifies that ip is still an alias IP of the node's server,
+// wrapping a MissingIPError otherwise.
+func (h *Hetzner) VerifyPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	serverID, err := getHetznerServerID(node)
+	if err != nil {
+		return err
+	}
+	server, err := h.getServer(ctx, node, serverID)
+	if err != nil {
+		return err
+	}
+	for i := range server.PrivateNet {
+		if hasHetznerAliasIP(&server.PrivateNet[i], ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: IP address %s is not an alias IP of server %d", MissingIPError, ip, server.ID)
+}
+
+// GetPrivateIPReservations returns nil, alias IPs aren't resources of their
+// own.
+func (h *Hetzner) GetPrivateIPReservations(ctx context.Context, ip net.IP, node *corev1.Node) ([]PrivateIPReservation, error) {
+	return nil, nil
+}
+
+// GetNodeNetworkInterfaces returns the IDs of the networks of the node's
+// server, in the order they're attached.
+func (h *Hetzner) GetNodeNetworkInterfaces(ctx context.Context, node *corev1.Node) ([]string, error) {
+	serverID, err := getHetznerServerID(node)
+	if err != nil {
+		return nil, err
+	}
+	server, err := h.getServer(ctx, node, serverID)
+	if err != nil {
+		return nil, err
+	}
+	networkIDs := []string{}
+	for _, privateNet := range server.PrivateNet {
+		networkIDs = append(networkIDs, strconv.FormatInt(privateNet.Network, 10))
+	}
+	return networkIDs, nil
+}
+
+// ListPrivateIPs returns the alias IPs of the node's server on all of its
+// networks.
+func (h *Hetzner) ListPrivateIPs(ctx context.Context, node *corev1.Node) ([]net.IP, error) {
+	serverID, err := getHetznerServerID(node)
+	if err != nil {
+		return nil, err
+	}
+	server, err := h.getServer(ctx, node, serverID)
+	if err != nil {
+		return nil, err
+	}
+	ips := []net.IP{}
+	for _, privateNet := range server.PrivateNet {
+		for _, aliasIP := range privateNet.AliasIPs {
+			ips = append(ips, ParseIP(aliasIP))
+		}
+	}
+	return ips, nil
+}
+
+// CheckHealth retrieves the node's server.
+func (h *Hetzner) CheckHealth(ctx context.Context, node *corev1.Node) error {
+	serverID, err := getHetznerServerID(node)
+	if err != nil {
+		return err
+	}
+	_, err = h.getServer(ctx, node, serverID)
+	return err
+}
+
+func (h *Hetzner) getServer(ctx context.Context, node *corev1.Node, serverID string) (*hetznerServer, error) {
+	response := &struct {
+		Server hetznerServer `json:"server"`
+	}{}
+	if err := h.client.do(ctx, http.MethodGet, "/servers/"+serverID, nil, nil, response); err != nil {
+		return nil, fmt.Errorf("error retrieving server %s of node %s, err: %v", serverID, node.Name, err)
+	}
+	return &response.Server, nil
+}
+
+// getPrivateNet returns the network attachment of the server whose network
+// has a subnet holding ip, and that subnet; nil if there's none.
+func (h *Hetzner) getPrivateNet(ctx context.Context, server *hetznerServer, ip net.IP) (*hetznerPrivateNet, *net.IPNet, error) {
+	for i := range server.PrivateNet {
+		subnet, err := h.getSubnet(ctx, server, &server.PrivateNet[i], ip)
+		if err != nil || subnet != nil {
+			return &server.PrivateNet[i], subnet, err
+		}
+	}
+	return nil, nil, nil
+}
+
+// getSubnet returns the subnet of the network of privateNet holding ip, nil
+// if there's none.
+func (h *Hetzner) getSubnet(ctx context.Context, server *hetznerServer, privateNet *hetznerPrivateNet, ip net.IP) (*net.IPNet, error) {
+	response := &struct {
+		Network hetznerNetwork `json:"network"`
+	}{}
+	if err := h.client.do(ctx, http.MethodGet, fmt.Sprintf("/networks/%d", privateNet.Network), nil, nil, response); err != nil {
+		return nil, fmt.Errorf("error retrieving network %d of server %d, err: %v", privateNet.Network, server.ID, err)
+	}
+	for _, subnet := range response.Network.Subnets {
+		_, cidr, err := net.ParseCIDR(subnet.IPRange)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing subnet %q of network %d, err: %v", subnet.IPRange, privateNet.Network, err)
+		}
+		if cidr.Contains(ip) {
+			return cidr, nil
+		}
+	}
+	return nil, nil
+}
+
+// changeAliasIPs sets the alias IPs of the server on the network of
+// privateNet, and waits for the action doing it to complete.
+func (h *Hetzner) changeAliasIPs(ctx context.Context, server *hetznerServer, privateNet *hetznerPrivateNet, aliasIPs []string) error {
+	response := &struct {
+		Action hetznerAction `json:"action"`
+	}{}
+	if err := h.client.do(ctx, http.MethodPost, fmt.Sprintf("/servers/%d/actions/change_alias_ips", server.ID), nil, map[string]interface{}{
+		"network":   privateNet.Network,
+		"alias_ips": aliasIPs,
+	}, response); err != nil {
+		return fmt.Errorf("error changing the alias IPs of server %d on network %d, err: %v", server.ID, privateNet.Network, err)
+	}
+	return h.waitForAction(ctx, &response.Action)
+}
+
+// waitForAction polls the action until it succeeds or fails, every
+// pollInterval at first, the interval doubling after every poll up to
+// pollMaxInterval, for up to hetznerActionTimeout, see pollUntilDone. The
+// action as returned by the request which started it is checked first.
+func (h *Hetzner) waitForAction(ctx context.Context, action *hetznerAction) error {
+	polled := false
+	return h.pollUntilDone(ctx, fmt.Sprintf("action %d", action.ID), h.pollInterval, h.pollMaxInterval, hetznerActionTimeout, func(ctx context.Context) (bool, error) {
+		if polled {
+			response := &struct {
+				Action hetznerAction `json:"action"`
+			}{}
+			if err := h.client.do(ctx, http.MethodGet, fmt.Sprintf("/actions/%d", action.ID), nil, nil, response); err != nil {
+				return false, fmt.Errorf("error retrieving action %d, err: %v", action.ID, err)
+			}
+			action = &response.Action
+		}
+		polled = true
+		switch action.Status {
+		case hetznerActionStatusSuccess:
+			return true, nil
+		case hetznerActionStatusError:
+			if action.Error != nil {
+				return true, fmt.Errorf("action %d failed: %s: %s", action.ID, action.Error.Code, action.Error.Message)
+			}
+			return true, fmt.Errorf("action %d failed", action.ID)
+		}
+		return false, nil
+	})
+}
+
+// hasHetznerAliasIP returns true if ip is an alias IP of the network
+// attachment.
+func hasHetznerAliasIP(privateNet *hetznerPrivateNet, ip net.IP) bool {
+	for _, aliasIP := range privateNet.AliasIPs {
+		if ParseIP(aliasIP).Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// getHetznerSubnetSize returns the number of addresses of the subnet usable
+// by servers: the network and broadcast addresses, and the first address,
+// the gateway's, are reserved.
+func getHetznerSubnetSize(subnet *net.IPNet) int {
+	ones, bits := subnet.Mask.Size()
+	if bits-ones < 2 {
+		return 0
+	}
+	return 1<<(bits-ones) - 3
+}
+
+// getHetznerServerID returns the ID of the node's server, out of its
+// providerID, which looks like hcloud://<server ID>.
+func getHetznerServerID(node *corev1.Node) (string, error) {
+	serverID := strings.TrimPrefix(node.Spec.ProviderID, "hcloud://")
+	if serverID == node.Spec.ProviderID {
+		return "", fmt.Errorf("failed to parse node %s provider id %q, expected hcloud://<server ID>", node.Name, node.Spec.ProviderID)
+	}
+	if _, err := strconv.ParseUint(serverID, 10, 64); err != nil {
+		return "", fmt.Errorf("failed to parse node %s provider id %q, expected hcloud://<server ID>", node.Name, node.Spec.ProviderID)
+	}
+	return serverID, nil
+}
@@ -0,0 +1,201 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeHetzner serves the Hetzner Cloud API requests of server 42, attached
+// to network 1, with subnet 10.0.1.0/24, as 10.0.1.2, and to network 2, with
+// subnet 10.0.2.0/28, as 10.0.2.2. Actions are running when created, and
+// succeed or fail when polled.
+type fakeHetzner struct {
+	mu       sync.Mutex
+	aliasIPs map[int64][]string
+	// failActions fails the actions changing the alias IPs.
+	failActions bool
+	actions     int
+}
+
+func (f *fakeHetzner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/servers/42":
+		aliasIPs1, _ := json.Marshal(append([]string{}, f.aliasIPs[1]...))
+		aliasIPs2, _ := json.Marshal(append([]string{}, f.aliasIPs[2]...))
+		_, _ = fmt.Fprintf(w, `{"server": {"id": 42, "private_net": [
+			{"network": 1, "ip": "10.0.1.2", "alias_ips": %s, "mac_address": "86:00:00:00:00:01"},
+			{"network": 2, "ip": "10.0.2.2", "alias_ips": %s, "mac_address": "86:00:00:00:00:02"}
+		]}}`, aliasIPs1, aliasIPs2)
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/networks/1":
+		_, _ = fmt.Fprint(w, `{"network": {"id": 1, "subnets": [{"ip_range": "10.0.1.0/24"}]}}`)
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/networks/2":
+		_, _ = fmt.Fprint(w, `{"network": {"id": 2, "subnets": [{"ip_range": "10.0.3.0/24"}, {"ip_range": "10.0.2.0/28"}]}}`)
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/servers/42/actions/change_alias_ips":
+		request := struct {
+			Network  int64    `json:"network"`
+			AliasIPs []string `json:"alias_ips"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.AliasIPs == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !f.failActions {
+			if f.aliasIPs == nil {
+				f.aliasIPs = map[int64][]string{}
+			}
+			f.aliasIPs[request.Network] = request.AliasIPs
+		}
+		f.actions++
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprintf(w, `{"action": {"id": %d, "status": "running"}}`, f.actions)
+	case r.Method == http.MethodGet && r.URL.Path == fmt.Sprintf("/v1/actions/%d", f.actions):
+		if f.failActions {
+			_, _ = fmt.Fprintf(w, `{"action": {"id": %d, "status": "error", "error": {"code": "action_failed", "message": "Action failed"}}}`, f.actions)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"action": {"id": %d, "status": "success"}}`, f.actions)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeHetznerProvider(server *httptest.Server) *Hetzner {
+	return &Hetzner{
+		CloudProvider: CloudProvider{ctx: context.Background()},
+		client: &restClient{
+			httpClient: server.Client(),
+			baseURL:    server.URL + "/v1",
+			authorize: func(r *http.Request) error {
+				r.Header.Set("Authorization", "Bearer token")
+				return nil
+			},
+		},
+		pollInterval:    time.Millisecond,
+		pollMaxInterval: time.Millisecond,
+	}
+}
+
+func newHetznerNode() *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0"},
+		Spec:       corev1.NodeSpec{ProviderID: "hcloud://42"},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.1.2"}},
+		},
+	}
+}
+
+// newHetznerFakeCloud plugs the fake API into the tests shared by the clouds.
+func newHetznerFakeCloud(t *testing.T) *fakeCloud {
+	fake := &fakeHetzner{}
+	server := httptest.NewServer(fake)
+	return &fakeCloud{
+		CloudProviderIntf: newFakeHetznerProvider(server),
+		assigned: func() []string {
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			ips := []string{}
+			for _, aliasIPs := range fake.aliasIPs {
+				ips = append(ips, aliasIPs...)
+			}
+			return ips
+		},
+		close: server.Close,
+	}
+}
+
+func TestHetznerAssignPrivateIP(t *testing.T) {
+	tcs := []struct {
+		ip               string
+		aliasIPs         map[int64][]string
+		failActions      bool
+		expectedAliasIPs map[int64][]string
+		expectErr        bool
+	}{
+		{
+			ip:               "10.0.1.10",
+			aliasIPs:         map[int64][]string{1: {"10.0.1.11"}},
+			expectedAliasIPs: map[int64][]string{1: {"10.0.1.11", "10.0.1.10"}},
+		},
+		{
+			ip:               "10.0.1.10",
+			failActions:      true,
+			expectedAliasIPs: map[int64][]string{},
+			expectErr:        true,
+		},
+		// Not out of the subnets of the networks.
+		{ip: "10.0.4.10", expectedAliasIPs: map[int64][]string{}, expectErr: true},
+		{ip: "fd00::10", expectedAliasIPs: map[int64][]string{}, expectErr: true},
+	}
+	for i, tc := range tcs {
+		fake := &fakeHetzner{aliasIPs: map[int64][]string{}, failActions: tc.failActions}
+		for network, aliasIPs := range tc.aliasIPs {
+			fake.aliasIPs[network] = aliasIPs
+		}
+		server := httptest.NewServer(fake)
+		provider := newFakeHetznerProvider(server)
+		err := provider.AssignPrivateIP(context.Background(), net.ParseIP(tc.ip), newHetznerNode())
+		server.Close()
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestHetznerAssignPrivateIP(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		if fmt.Sprint(fake.aliasIPs) != fmt.Sprint(tc.expectedAliasIPs) {
+			t.Fatalf("TestHetznerAssignPrivateIP(%d): expected alias IPs %v, got %v", i, tc.expectedAliasIPs, fake.aliasIPs)
+		}
+	}
+}
+
+func TestHetznerListPrivateIPs(t *testing.T) {
+	fake := &fakeHetzner{aliasIPs: map[int64][]string{2: {"10.0.2.10", "10.0.2.11"}}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	provider := newFakeHetznerProvider(server)
+
+	networkIDs, err := provider.GetNodeNetworkInterfaces(context.Background(), newHetznerNode())
+	if err != nil || fmt.Sprint(networkIDs) != "[1 2]" {
+		t.Fatalf("expected networks [1 2], got %v, err: %v", networkIDs, err)
+	}
+	ips, err := provider.ListPrivateIPs(context.Background(), newHetznerNode())
+	if err != nil || fmt.Sprint(ips) != "[10.0.2.10 10.0.2.11]" {
+		t.Fatalf("expected alias IPs [10.0.2.10 10.0.2.11], got %v, err: %v", ips, err)
+	}
+}
+
+func TestGetHetznerServerID(t *testing.T) {
+	tcs := []struct {
+		providerID string
+		expected   string
+		expectErr  bool
+	}{
+		{providerID: "hcloud://42", expected: "42"},
+		{providerID: "42", expectErr: true},
+		{providerID: "hcloud://server-0", expectErr: true},
+		{providerID: "hcloud://", expectErr: true},
+		{providerID: "hrobot://42", expectErr: true},
+	}
+	for i, tc := range tcs {
+		serverID, err := getHetznerServerID(&corev1.Node{Spec: corev1.NodeSpec{ProviderID: tc.providerID}})
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestGetHetznerServerID(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		if !tc.expectErr && serverID != tc.expected {
+			t.Fatalf("TestGetHetznerServerID(%d): expected server ID %q, got %q", i, tc.expected, serverID)
+		}
+	}
+}
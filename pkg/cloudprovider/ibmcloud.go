@@ -0,0 +1,372 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+const (
+	// PlatformTypeIBMCloud is the string representation for the IBM Cloud
+	// VPC platform type.
+	PlatformTypeIBMCloud = "IBMCloud"
+
+	// ibmCloudAPIVersion is the version of the VPC API requested, the first
+	// with virtual network interfaces.
+	ibmCloudAPIVersion = "2024-04-30"
+	// ibmCloudDefaultIPsPerInterface is the number of secondary IP addresses a
+	// virtual network interface holds by default. It's a quota of the account
+	// rather than a property of the instance profile, see
+	// IBMCloudIPsPerInterface.
+	ibmCloudDefaultIPsPerInterface = 10
+)
+
+// IBMCloud implements the API wrapper for talking to the IBM Cloud VPC API.
+// Egress IPs are reserved IPs of the subnet of the primary network attachment
+// of the instance, bound to its virtual network interface as secondary IP
+// addresses.
+type IBMCloud struct {
+	CloudProvider
+	noOwnedResources
+	vpc *restClient
+	iam *ibmCloudIAM
+}
+
+type ibmCloudReference struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+type ibmCloudReservedIP struct {
+	ID         string             `json:"id,omitempty"`
+	Address    string             `json:"address"`
+	Name       string             `json:"name,omitempty"`
+	AutoDelete bool               `json:"auto_delete"`
+	Target     *ibmCloudReference `json:"target,omitempty"`
+}
+
+type ibmCloudInstance struct {
+	ID                       string `json:"id"`
+	Name                     string `json:"name"`
+	PrimaryNetworkAttachment *struct {
+		ID                      string             `json:"id"`
+		VirtualNetworkInterface *ibmCloudReference `json:"virtual_network_interface"`
+	} `json:"primary_network_attachment"`
+}
+
+type ibmCloudVirtualNetworkInterface struct {
+	ID        string               `json:"id"`
+	Name      string               `json:"name"`
+	PrimaryIP ibmCloudReservedIP   `json:"primary_ip"`
+	Subnet    ibmCloudReference    `json:"subnet"`
+	IPs       []ibmCloudReservedIP `json:"ips"`
+}
+
+type ibmCloudSubnet struct {
+	ID            string `json:"id"`
+	IPv4CIDRBlock string `json:"ipv4_cidr_block"`
+}
+
+type ibmCloudReservedIPList struct {
+	ReservedIPs []ibmCloudReservedIP `json:"reserved_ips"`
+	Next        *struct {
+		Href string `json:"href"`
+	} `json:"next"`
+}
+
+func (i *IBMCloud) initCredentials() error {
+	apiKey, err := i.readSecretData("ibmcloud_api_key")
+	if err != nil {
+		return err
+	}
+	httpClient, err := newHTTPClient(i.cfg.ConfigDir)
+	if err != nil {
+		return err
+	}
+	baseURL := i.cfg.APIOverride
+	if baseURL == "" {
+		if i.cfg.IBMCloudRegion == "" {
+			return fmt.Errorf("the IBM Cloud region is needed to reach the VPC API of the region, unless the API URL is overridden")
+		}
+		baseURL = fmt.Sprintf("https://%s.iaas.cloud.ibm.com/v1", i.cfg.IBMCloudRegion)
+	}
+	i.iam = newIBMCloudIAM(httpClient, i.cfg.IBMCloudIAMURL, strings.TrimSpace(apiKey))
+	i.vpc = &restClient{
+		httpClient: httpClient,
+		baseURL:    baseURL,
+		query:      url.Values{"version": {ibmCloudAPIVersion}, "generation": {"2"}},
+		authorize:  i.iam.authorize,
+	}
+	klog.Infof("Using the IBM Cloud VPC API at %s", baseURL)
+	return nil
+}
+
+// AssignPrivateIP reserves ip in the subnet of the node's virtual network
+// interface and binds it to the virtual network interface. The reserved IP
+// is deleted automatically once unbound, or with the virtual network
+// interface. A reserved IP left unbound for ip, e.g. by a previous attempt, is
+// bound rather than reserved again.
+func (i *IBMCloud) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	if !utilnet.IsIPv4(ip) {
+		return fmt.Errorf("IBM Cloud VPC doesn't support IPv6, can't assign IP address %s", ip)
+	}
+	vni, err := i.getVirtualNetworkInterface(ctx, node)
+	if err != nil {
+		return err
+	}
+	if getIBMCloudSecondaryIP(vni, ip) != nil {
+		return AlreadyExistingIPError
+	}
+	reservedIP, created, err := i.reserveIP(ctx, vni, ip)
+	if err != nil {
+		return err
+	}
+	if err := i.vpc.do(ctx, http.MethodPut, fmt.Sprintf("/virtual_network_interfaces/%s/ips/%s", vni.ID, reservedIP.ID), nil, nil, nil); err != nil {
+		if created {
+			if deleteErr := i.vpc.do(ctx, http.MethodDelete, fmt.Sprintf("/subnets/%s/reserved_ips/%s", vni.Subnet.ID, reservedIP.ID), nil, nil, nil); deleteErr != nil {
+				klog.Warningf("Could not delete reserved IP %s of IP address %s after failing to bind it, err: %v", reservedIP.ID, ip, deleteErr)
+			}
+		}
+		return fmt.Errorf("error binding reserved IP %s of IP address %s to virtual network interface %s, err: %v", reservedIP.ID, ip, vni.ID, err)
+	}
+	return nil
+}
+
+// reserveIP reserves ip in the subnet of the virtual network interface,
+// created is false if an unbound reserved IP of ip existed already.
+func (i *IBMCloud) reserveIP(ctx context.Context, vni *ibmCloudVirtualNetworkInterface, ip net.IP) (reservedIP *ibmCloudReservedIP, created bool, err error) {
+	reservedIP = &ibmCloudReservedIP{}
+	err = i.vpc.do(ctx, http.MethodPost, fmt.Sprintf("/subnets/%s/reserved_ips", vni.Subnet.ID), nil, &ibmCloudReservedIP{
+		Address:    ip.String(),
+		Name:       getIBMCloudReservedIPName(ip),
+		AutoDelete: true,
+	}, reservedIP)
+	if err == nil {
+		return reservedIP, true, nil
+	}
+	existing, lookupErr := i.lookupReservedIP(ctx, vni.Subnet.ID, ip)
+	if lookupErr != nil || existing == nil {
+		return nil, false, fmt.Errorf("error reserving IP address %s in subnet %s, err: %v", ip, vni.Subnet.ID, err)
+	}
+	if existing.Target != nil {
+		return nil, false, fmt.Errorf("IP address %s is reserved in subnet %s for %s already", ip, vni.Subnet.ID, existing.Target.ID)
+	}
+	return existing, false, nil
+}
+
+// lookupReservedIP returns the reserved IP of ip in the subnet, nil if there's
+// none.
+func (i *IBMCloud) lookupReservedIP(ctx context.Context, subnetID string, ip net.IP) (*ibmCloudReservedIP, error) {
+	path := fmt.Sprintf("/subnets/%s/reserved_ips", subnetID)
+	for path != "" {
+		list := &ibmCloudReservedIPList{}
+		if err := i.vpc.do(ctx, http.MethodGet, path, url.Values{"limit": {"100"}}, nil, list); err != nil {
+			return nil, err
+		}
+		for _, reservedIP := range list.ReservedIPs {
+			if ParseIP(reservedIP.Address).Equal(ip) {
+				return &reservedIP, nil
+			}
+		}
+		path = ""
+		if list.Next != nil {
+			path = list.Next.Href
+		}
+	}
+	return nil, nil
+}
+
+func (i *IBMCloud) AllowsMovePrivateIP() bool {
+	return false
+}
+
+func (i *IBMCloud) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+	return nil
+}
+
+// ReleasePrivateIP unbinds the reserved IP of ip from the node's virtual
+// network interface, which deletes it.
+func (i *IBMCloud) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	vni, err := i.getVirtualNetworkInterface(ctx, node)
+	if err != nil {
+		return err
+	}
+	reservedIP := getIBMCloudSecondaryIP(vni, ip)
+	if reservedIP == nil {
+		return NonExistingIPError
+	}
+	return i.vpc.do(ctx, http.MethodDelete, fmt.Sprintf("/virtual_network_interfaces/%s/ips/%s", vni.ID, reservedIP.ID), nil, nil, nil)
+}
+
+func (i *IBMCloud) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, i.AssignPrivateIP)
+}
+
+func (i *IBMCloud) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, i.ReleasePrivateIP)
+}
+
+// GetNodeEgressIPConfiguration returns the configuration of the node's virtual
+// network interface, keyed by ID. IBM Cloud VPC subnets are IPv4 only.
+func (i *IBMCloud) GetNodeEgressIPConfiguration(ctx context.Context, node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
+	vni, err := i.getVirtualNetworkInterface(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	subnet := &ibmCloudSubnet{}
+	if err := i.vpc.do(ctx, http.MethodGet, "/subnets/"+vni.Subnet.ID, nil, nil, subnet); err != nil {
+		return nil, fmt.Errorf("error retrieving subnet %s, err: %v", vni.Subnet.ID, err)
+	}
+	_, cidr, err := net.ParseCIDR(subnet.IPv4CIDRBlock)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the CIDR %q of subnet %s, err: %v", subnet.IPv4CIDRBlock, subnet.ID, err)
+	}
+	return []*NodeEgressIPConfiguration{
+		{
+			Interface: vni.ID,
+			IFAddr:    ifAddr{IPv4: cidr.String()},
+			Capacity:  capacity{IPv4: i.getCapacity(vni)},
+		},
+	}, nil
+}
+
+// getCapacity returns the number of secondary IP addresses the virtual
+// network interface can still hold.
+func (i *IBMCloud) getCapacity(vni *ibmCloudVirtualNetworkInterface) int {
+	limit := i.cfg.IBMCloudIPsPerInterface
+	if limit <= 0 {
+		limit = ibmCloudDefaultIPsPerInterface
+	}
+	secondaryIPs := 0
+	for _, reservedIP := range vni.IPs {
+		if reservedIP.ID != vni.PrimaryIP.ID {
+			secondaryIPs++
+		}
+	}
+	if limit < secondaryIPs {
+		return 0
+	}
+	return limit - secondaryIPs
+}
+
+// CleanupNode is a no-op, the reserved IPs are deleted together with the
+// virtual network interface of the instance.
+func (i *IBMCloud) CleanupNode(ctx context.Context, node *corev1.Node) error {
+	return nil
+}
+
+// VerifyPrivateIP verifies that the reserved IP of ip is still bound to the
+// node's virtual network interface, wrapping a MissingIPError otherwise.
+func (i *IBMCloud) VerifyPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	vni, err := i.getVirtualNetworkInterface(ctx, node)
+	if err != nil {
+		return err
+	}
+	if getIBMCloudSecondaryIP(vni, ip) == nil {
+		return fmt.Errorf("%w: IP address %s is not bound to virtual network interface %s", MissingIPError, ip, vni.ID)
+	}
+	return nil
+}
+
+// GetPrivateIPReservations returns the reserved IP of ip.
+func (i *IBMCloud) GetPrivateIPReservations(ctx context.Context, ip net.IP, node *corev1.Node) ([]PrivateIPReservation, error) {
+	vni, err := i.getVirtualNetworkInterface(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	reservedIP := getIBMCloudSecondaryIP(vni, ip)
+	if reservedIP == nil {
+		return nil, nil
+	}
+	return []PrivateIPReservation{{ID: reservedIP.ID, Subnet: vni.Subnet.ID}}, nil
+}
+
+// GetNodeNetworkInterfaces returns nil, the primary network attachment of an
+// instance can't be replaced.
+func (i *IBMCloud) GetNodeNetworkInterfaces(ctx context.Context, node *corev1.Node) ([]string, error) {
+	return nil, nil
+}
+
+// ListPrivateIPs returns the addresses of the secondary reserved IPs bound to
+// the node's virtual network interface.
+func (i *IBMCloud) ListPrivateIPs(ctx context.Context, node *corev1.Node) ([]net.IP, error) {
+	vni, err := i.getVirtualNetworkInterface(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	ips := []net.IP{}
+	for _, reservedIP := range vni.IPs {
+		if reservedIP.ID != vni.PrimaryIP.ID {
+			ips = append(ips, ParseIP(reservedIP.Address))
+		}
+	}
+	return ips, nil
+}
+
+// CheckHealth retrieves the virtual network interface of the node's
+// instance.
+func (i *IBMCloud) CheckHealth(ctx context.Context, node *corev1.Node) error {
+	_, err := i.getVirtualNetworkInterface(ctx, node)
+	return err
+}
+
+// getVirtualNetworkInterface returns the virtual network interface of the
+// primary network attachment of the node's instance. Instances with legacy
+// network interfaces, created before virtual network interfaces, can't hold
+// secondary IP addresses.
+func (i *IBMCloud) getVirtualNetworkInterface(ctx context.Context, node *corev1.Node) (*ibmCloudVirtualNetworkInterface, error) {
+	instanceID, err := getIBMCloudInstanceID(node)
+	if err != nil {
+		return nil, err
+	}
+	instance := &ibmCloudInstance{}
+	if err := i.vpc.do(ctx, http.MethodGet, "/instances/"+instanceID, nil, nil, instance); err != nil {
+		return nil, fmt.Errorf("error retrieving instance %s of node %s, err: %v", instanceID, node.Name, err)
+	}
+	if instance.PrimaryNetworkAttachment == nil || instance.PrimaryNetworkAttachment.VirtualNetworkInterface == nil {
+		return nil, fmt.Errorf("%w: instance %s of node %s has no network attachment with a virtual network interface, legacy network interfaces can't hold egress IPs", NoNetworkInterfaceError, instanceID, node.Name)
+	}
+	vni := &ibmCloudVirtualNetworkInterface{}
+	if err := i.vpc.do(ctx, http.MethodGet, "/virtual_network_interfaces/"+instance.PrimaryNetworkAttachment.VirtualNetworkInterface.ID, nil, nil, vni); err != nil {
+		return nil, fmt.Errorf("error retrieving virtual network interface %s of node %s, err: %v", instance.PrimaryNetworkAttachment.VirtualNetworkInterface.ID, node.Name, err)
+	}
+	return vni, nil
+}
+
+// getIBMCloudSecondaryIP returns the reserved IP of ip bound to the virtual
+// network interface, nil if there's none or ip is its primary IP.
+func getIBMCloudSecondaryIP(vni *ibmCloudVirtualNetworkInterface, ip net.IP) *ibmCloudReservedIP {
+	for _, reservedIP := range vni.IPs {
+		if reservedIP.ID != vni.PrimaryIP.ID && ParseIP(reservedIP.Address).Equal(ip) {
+			return &reservedIP
+		}
+	}
+	return nil
+}
+
+// getIBMCloudReservedIPName returns the name of the reserved IP of ip, unique
+// in its subnet, e.g. egress-ip-10-240-0-10.
+func getIBMCloudReservedIPName(ip net.IP) string {
+	return "egress-ip-" + strings.ReplaceAll(ip.String(), ".", "-")
+}
+
+// getIBMCloudInstanceID returns the ID of the node's instance, the last
+// component of its providerID, which looks like
+// ibm://<account ID>///<cluster ID>/<instance ID> on IBM Cloud VPC.
+func getIBMCloudInstanceID(node *corev1.Node) (string, error) {
+	if !strings.HasPrefix(node.Spec.ProviderID, "ibm://") {
+		return "", fmt.Errorf("failed to parse node %s provider id %q, expected ibm://<account ID>///<cluster ID>/<instance ID>", node.Name, node.Spec.ProviderID)
+	}
+	instanceID := node.Spec.ProviderID[strings.LastIndex(node.Spec.ProviderID, "/")+1:]
+	if instanceID == "" {
+		return "", fmt.Errorf("failed to parse node %s provider id %q: no instance ID", node.Name, node.Spec.ProviderID)
+	}
+	return instanceID, nil
+}
@@ -0,0 +1,92 @@
+package cloudprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ibmCloudDefaultIAMURL is the IAM endpoint the API key is exchanged for
+	// access tokens at, https://private.iam.cloud.ibm.com for clusters
+	// without public endpoints.
+	ibmCloudDefaultIAMURL = "https://iam.cloud.ibm.com"
+	// ibmCloudTokenRefreshMargin is how long before their expiration the
+	// access tokens are refreshed.
+	ibmCloudTokenRefreshMargin = 5 * time.Minute
+)
+
+// ibmCloudIAM exchanges the API key of the secret for IAM access tokens,
+// which are cached until shortly before they expire, an hour after they're
+// issued.
+type ibmCloudIAM struct {
+	httpClient *http.Client
+	url        string
+	apiKey     string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newIBMCloudIAM(httpClient *http.Client, iamURL, apiKey string) *ibmCloudIAM {
+	if iamURL == "" {
+		iamURL = ibmCloudDefaultIAMURL
+	}
+	return &ibmCloudIAM{httpClient: httpClient, url: strings.TrimSuffix(iamURL, "/"), apiKey: apiKey}
+}
+
+// authorize sets the bearer access token of the request.
+func (t *ibmCloudIAM) authorize(r *http.Request) error {
+	token, err := t.getToken(r)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (t *ibmCloudIAM) getToken(r *http.Request) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Now().Add(ibmCloudTokenRefreshMargin).Before(t.expires) {
+		return t.token, nil
+	}
+	form := url.Values{
+		"grant_type": {"urn:ibm:params:oauth:grant-type:apikey"},
+		"apikey":     {t.apiKey},
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, t.url+"/identity/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error requesting an IBM Cloud IAM access token, err: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error requesting an IBM Cloud IAM access token: StatusCode=%d %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("error decoding the IBM Cloud IAM access token, err: %v", err)
+	}
+	t.token = token.AccessToken
+	t.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return t.token, nil
+}
@@ -0,0 +1,291 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeIBMCloud serves the IAM and VPC API requests of a single instance whose
+// virtual network interface is in subnet 10.240.0.0/24.
+type fakeIBMCloud struct {
+	mu          sync.Mutex
+	tokens      int
+	reservedIPs map[string]*ibmCloudReservedIP
+	// bound are the IDs of the reserved IPs bound to the virtual network
+	// interface, in order, the primary IP first.
+	bound []string
+	// failBind fails binding reserved IPs to the virtual network interface.
+	failBind bool
+}
+
+func newFakeIBMCloud() *fakeIBMCloud {
+	return &fakeIBMCloud{
+		reservedIPs: map[string]*ibmCloudReservedIP{
+			"primary": {ID: "primary", Address: "10.240.0.4", Target: &ibmCloudReference{ID: "vni-0"}},
+		},
+		bound: []string{"primary"},
+	}
+}
+
+func (f *fakeIBMCloud) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path == "/identity/token" {
+		if r.Method != http.MethodPost || r.FormValue("apikey") != "api-key" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.tokens++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "expires_in": 3600})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer token" || r.URL.Query().Get("version") != ibmCloudAPIVersion {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/instances/instance-0":
+		_, _ = w.Write([]byte(`{"id": "instance-0", "primary_network_attachment": {"id": "attachment-0", "virtual_network_interface": {"id": "vni-0"}}}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/instances/legacy":
+		_, _ = w.Write([]byte(`{"id": "legacy", "primary_network_interface": {"id": "nic-0"}}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/virtual_network_interfaces/vni-0":
+		vni := &ibmCloudVirtualNetworkInterface{ID: "vni-0", PrimaryIP: *f.reservedIPs["primary"], Subnet: ibmCloudReference{ID: "subnet-0"}}
+		for _, id := range f.bound {
+			vni.IPs = append(vni.IPs, *f.reservedIPs[id])
+		}
+		_ = json.NewEncoder(w).Encode(vni)
+	case r.Method == http.MethodGet && r.URL.Path == "/subnets/subnet-0":
+		_ = json.NewEncoder(w).Encode(&ibmCloudSubnet{ID: "subnet-0", IPv4CIDRBlock: "10.240.0.0/24"})
+	case r.Method == http.MethodGet && r.URL.Path == "/subnets/subnet-0/reserved_ips":
+		list := &ibmCloudReservedIPList{}
+		for _, reservedIP := range f.reservedIPs {
+			list.ReservedIPs = append(list.ReservedIPs, *reservedIP)
+		}
+		_ = json.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodPost && r.URL.Path == "/subnets/subnet-0/reserved_ips":
+		reservedIP := &ibmCloudReservedIP{}
+		if err := json.NewDecoder(r.Body).Decode(reservedIP); err != nil || !reservedIP.AutoDelete {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, existing := range f.reservedIPs {
+			if existing.Address == reservedIP.Address {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+		}
+		reservedIP.ID = "rip-" + strings.ReplaceAll(reservedIP.Address, ".", "-")
+		f.reservedIPs[reservedIP.ID] = reservedIP
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(reservedIP)
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/subnets/subnet-0/reserved_ips/"):
+		delete(f.reservedIPs, strings.TrimPrefix(r.URL.Path, "/subnets/subnet-0/reserved_ips/"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/virtual_network_interfaces/vni-0/ips/"):
+		reservedIP, ok := f.reservedIPs[strings.TrimPrefix(r.URL.Path, "/virtual_network_interfaces/vni-0/ips/")]
+		if !ok || f.failBind {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reservedIP.Target = &ibmCloudReference{ID: "vni-0"}
+		f.bound = append(f.bound, reservedIP.ID)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/virtual_network_interfaces/vni-0/ips/"):
+		id := strings.TrimPrefix(r.URL.Path, "/virtual_network_interfaces/vni-0/ips/")
+		for j, bound := range f.bound {
+			if bound == id {
+				f.bound = append(f.bound[:j], f.bound[j+1:]...)
+				// Reserved IPs are deleted once unbound, if auto_delete.
+				if f.reservedIPs[id].AutoDelete {
+					delete(f.reservedIPs, id)
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeIBMCloudProvider(server *httptest.Server, cfg CloudProviderConfig) *IBMCloud {
+	iam := newIBMCloudIAM(server.Client(), server.URL, "api-key")
+	return &IBMCloud{
+		CloudProvider: CloudProvider{ctx: context.Background(), cfg: cfg},
+		iam:           iam,
+		vpc: &restClient{
+			httpClient: server.Client(),
+			baseURL:    server.URL,
+			query:      url.Values{"version": {ibmCloudAPIVersion}},
+			authorize:  iam.authorize,
+		},
+	}
+}
+
+func newIBMCloudNode(instanceID string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0"},
+		Spec:       corev1.NodeSpec{ProviderID: "ibm://account///cluster/" + instanceID},
+	}
+}
+
+// newIBMCloudFakeCloud plugs the fake API into the tests shared by the clouds.
+func newIBMCloudFakeCloud(t *testing.T) *fakeCloud {
+	fake := newFakeIBMCloud()
+	server := httptest.NewServer(fake)
+	return &fakeCloud{
+		CloudProviderIntf: newFakeIBMCloudProvider(server, CloudProviderConfig{}),
+		assigned: func() []string {
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			ips := []string{}
+			for _, id := range fake.bound[1:] {
+				ips = append(ips, fake.reservedIPs[id].Address)
+			}
+			return ips
+		},
+		close: server.Close,
+	}
+}
+
+func TestIBMCloudAssignPrivateIP(t *testing.T) {
+	tcs := []struct {
+		ip string
+		// unbound is the address of a reserved IP left unbound in the subnet.
+		unbound     string
+		failBind    bool
+		expectedErr error
+		expectErr   bool
+		// expectedReservedIPs is the number of reserved IPs of the subnet
+		// afterwards, the primary IP included.
+		expectedReservedIPs int
+	}{
+		{ip: "10.240.0.10", unbound: "10.240.0.10", expectedReservedIPs: 2},
+		{ip: "fd00::10", expectErr: true, expectedReservedIPs: 1},
+		// Reserved IPs are deleted if binding them fails.
+		{ip: "10.240.0.10", failBind: true, expectErr: true, expectedReservedIPs: 1},
+	}
+	for i, tc := range tcs {
+		fake := newFakeIBMCloud()
+		fake.failBind = tc.failBind
+		if tc.unbound != "" {
+			fake.reservedIPs["unbound"] = &ibmCloudReservedIP{ID: "unbound", Address: tc.unbound, AutoDelete: true}
+		}
+		server := httptest.NewServer(fake)
+		provider := newFakeIBMCloudProvider(server, CloudProviderConfig{})
+		err := provider.AssignPrivateIP(context.Background(), net.ParseIP(tc.ip), newIBMCloudNode("instance-0"))
+		server.Close()
+		if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+			t.Fatalf("TestIBMCloudAssignPrivateIP(%d): expected error %v, got %v", i, tc.expectedErr, err)
+		}
+		if tc.expectedErr == nil && tc.expectErr != (err != nil) {
+			t.Fatalf("TestIBMCloudAssignPrivateIP(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		if len(fake.reservedIPs) != tc.expectedReservedIPs {
+			t.Fatalf("TestIBMCloudAssignPrivateIP(%d): expected %d reserved IPs, got %d", i, tc.expectedReservedIPs, len(fake.reservedIPs))
+		}
+		if err == nil {
+			if len(fake.bound) != 2 || fake.reservedIPs[fake.bound[1]].Address != tc.ip {
+				t.Fatalf("TestIBMCloudAssignPrivateIP(%d): expected IP address %s to be bound, got %v", i, tc.ip, fake.bound)
+			}
+		}
+	}
+}
+
+func TestIBMCloudReleasePrivateIP(t *testing.T) {
+	fake := newFakeIBMCloud()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	provider := newFakeIBMCloudProvider(server, CloudProviderConfig{})
+	node := newIBMCloudNode("instance-0")
+	ip := net.ParseIP("10.240.0.10")
+
+	if err := provider.AssignPrivateIP(context.Background(), ip, node); err != nil {
+		t.Fatalf("received unexpected error assigning IP address, err: %v", err)
+	}
+	if err := provider.ReleasePrivateIP(context.Background(), ip, node); err != nil {
+		t.Fatalf("received unexpected error releasing IP address, err: %v", err)
+	}
+	if len(fake.reservedIPs) != 1 {
+		t.Fatalf("expected the reserved IP to be deleted once unbound, got %v", fake.reservedIPs)
+	}
+	if fake.tokens != 1 {
+		t.Fatalf("expected the access token to be requested once, got %d requests", fake.tokens)
+	}
+}
+
+func TestIBMCloudCapacity(t *testing.T) {
+	tcs := []struct {
+		instanceID       string
+		ipsPerInterface  int
+		secondaryIPs     []string
+		expectedCapacity int
+		expectedErr      error
+	}{
+		{instanceID: "instance-0", ipsPerInterface: 2, secondaryIPs: []string{"10.240.0.10"}, expectedCapacity: 1},
+		{instanceID: "instance-0", ipsPerInterface: 1, secondaryIPs: []string{"10.240.0.10", "10.240.0.11"}, expectedCapacity: 0},
+		{instanceID: "legacy", expectedErr: NoNetworkInterfaceError},
+	}
+	for i, tc := range tcs {
+		fake := newFakeIBMCloud()
+		for _, address := range tc.secondaryIPs {
+			id := "rip-" + address
+			fake.reservedIPs[id] = &ibmCloudReservedIP{ID: id, Address: address}
+			fake.bound = append(fake.bound, id)
+		}
+		server := httptest.NewServer(fake)
+		provider := newFakeIBMCloudProvider(server, CloudProviderConfig{IBMCloudIPsPerInterface: tc.ipsPerInterface})
+		configs, err := provider.GetNodeEgressIPConfiguration(context.Background(), newIBMCloudNode(tc.instanceID))
+		server.Close()
+		if tc.expectedErr != nil {
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("TestIBMCloudCapacity(%d): expected error %v, got %v", i, tc.expectedErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestIBMCloudCapacity(%d): received unexpected error, err: %v", i, err)
+		}
+		if len(configs) != 1 || configs[0].Interface != "vni-0" || configs[0].IFAddr.IPv4 != "10.240.0.0/24" || configs[0].IFAddr.IPv6 != "" {
+			t.Fatalf("TestIBMCloudCapacity(%d): unexpected configuration %+v", i, configs[0])
+		}
+		if configs[0].Capacity.IPv4 != tc.expectedCapacity {
+			t.Fatalf("TestIBMCloudCapacity(%d): expected capacity %d, got %d", i, tc.expectedCapacity, configs[0].Capacity.IPv4)
+		}
+	}
+}
+
+func TestGetIBMCloudInstanceID(t *testing.T) {
+	tcs := []struct {
+		providerID string
+		expected   string
+		expectErr  bool
+	}{
+		{providerID: "ibm://account///cluster/0717_b5e1a7c4-5ff9-4a4a-9a7b-7c6e8e3d1b2a", expected: "0717_b5e1a7c4-5ff9-4a4a-9a7b-7c6e8e3d1b2a"},
+		{providerID: "ibm://account///cluster/", expectErr: true},
+		{providerID: "gce://project/zone/worker-0", expectErr: true},
+		{providerID: "", expectErr: true},
+	}
+	for i, tc := range tcs {
+		node := &corev1.Node{Spec: corev1.NodeSpec{ProviderID: tc.providerID}}
+		instanceID, err := getIBMCloudInstanceID(node)
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestGetIBMCloudInstanceID(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		if instanceID != tc.expected {
+			t.Fatalf("TestGetIBMCloudInstanceID(%d): expected instance ID %q, got %q", i, tc.expected, instanceID)
+		}
+	}
+}
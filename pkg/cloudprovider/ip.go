@@ -0,0 +1,65 @@
+package cloudprovider
+
+import (
+	"net"
+	"strings"
+)
+
+// ParseIP parses s as an IP address, like net.ParseIP, but also accepts the
+// other textual forms of the same address clouds are known to return: IPv6
+// zones, surrounding whitespace and IPv4 octets with leading zeros (read as
+// decimal, not octal). IPv4 addresses, including IPv4-mapped IPv6 ones, are
+// always returned in their 4-byte form. All IP addresses received from the
+// cloud must be parsed through ParseIP before being compared. Those received
+// from the API server, e.g. CloudPrivateIPConfig names, must be parsed
+// strictly, with net.ParseIP, not to alias distinct names to the same IP
+// address. It returns nil if s isn't an IP address.
+func ParseIP(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '%'); i >= 0 {
+		s = s[:i]
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		ip = net.ParseIP(trimIPv4LeadingZeros(s))
+	}
+	if ip == nil {
+		return nil
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+// NormalizeIP returns the canonical textual form of the IP address s, so that
+// two representations of the same address compare equal as strings. It's
+// returned as is if it can't be parsed.
+func NormalizeIP(s string) string {
+	ip := ParseIP(s)
+	if ip == nil {
+		return s
+	}
+	return ip.String()
+}
+
+// trimIPv4LeadingZeros strips the leading zeros of the octets of the dotted
+// IPv4 address ending s, which net.ParseIP rejects since go 1.17.
+func trimIPv4LeadingZeros(s string) string {
+	prefix := ""
+	if i := strings.LastIndexByte(s, ':'); i >= 0 {
+		prefix, s = s[:i+1], s[i+1:]
+	}
+	octets := strings.Split(s, ".")
+	if len(octets) != 4 {
+		return prefix + s
+	}
+	for i, octet := range octets {
+		if trimmed := strings.TrimLeft(octet, "0"); trimmed != "" || octet == "" {
+			octets[i] = trimmed
+		} else {
+			octets[i] = "0"
+		}
+	}
+	return prefix + strings.Join(octets, ".")
+}
@@ -0,0 +1,44 @@
+package cloudprovider
+
+import (
+	"testing"
+)
+
+func TestParseIP(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{in: "192.0.2.1", expected: "192.0.2.1"},
+		{in: " 192.0.2.1\n", expected: "192.0.2.1"},
+		{in: "192.000.002.001", expected: "192.0.2.1"},
+		{in: "010.0.0.1", expected: "10.0.0.1"},
+		{in: "::ffff:192.0.2.1", expected: "192.0.2.1"},
+		{in: "::FFFF:192.000.2.1", expected: "192.0.2.1"},
+		{in: "2001:DB8::1", expected: "2001:db8::1"},
+		{in: "2001:0db8:0000:0000:0000:0000:0000:0001", expected: "2001:db8::1"},
+		{in: "fe80::1%eth0", expected: "fe80::1"},
+		{in: "192.0.2", expected: ""},
+		{in: "192.0.2.256", expected: ""},
+		{in: "not-an-ip", expected: ""},
+		{in: "", expected: ""},
+	}
+	for i, test := range tests {
+		ip := ParseIP(test.in)
+		if test.expected == "" {
+			if ip != nil {
+				t.Fatalf("TestParseIP(%d): expected %q not to parse, got %s", i, test.in, ip)
+			}
+			continue
+		}
+		if ip == nil || ip.String() != test.expected {
+			t.Fatalf("TestParseIP(%d): expected %q to parse as %s, got %s", i, test.in, test.expected, ip)
+		}
+		if ip.To4() != nil && len(ip) != 4 {
+			t.Fatalf("TestParseIP(%d): expected IPv4 address %q in its 4-byte form, got %d bytes", i, test.in, len(ip))
+		}
+		if normalized := NormalizeIP(test.in); normalized != test.expected {
+			t.Fatalf("TestParseIP(%d): expected %q to normalize to %s, got %s", i, test.in, test.expected, normalized)
+		}
+	}
+}
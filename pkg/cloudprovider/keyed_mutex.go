@@ -0,0 +1,72 @@
+package cloudprovider
+
+import (
+	"sort"
+	"sync"
+)
+
+// keyedMutex hands out one lock per key: holders of different keys proceed in
+// parallel, while holders of the same key are serialized. Locks are dropped
+// once nobody holds or waits for them anymore. The zero value is ready to use.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*refCountedMutex
+}
+
+type refCountedMutex struct {
+	sync.Mutex
+	refs int
+}
+
+// Lock locks all given keys and returns the function unlocking them. Keys are
+// always locked in the same order, so that callers locking overlapping sets of
+// keys can't deadlock. Empty keys are ignored.
+func (k *keyedMutex) Lock(keys ...string) func() {
+	sorted := make([]string, 0, len(keys))
+	seen := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		if _, ok := seen[key]; !ok && key != "" {
+			seen[key] = struct{}{}
+			sorted = append(sorted, key)
+		}
+	}
+	sort.Strings(sorted)
+
+	locks := make([]*refCountedMutex, 0, len(sorted))
+	for _, key := range sorted {
+		lock := k.acquire(key)
+		lock.Lock()
+		locks = append(locks, lock)
+	}
+	return func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+			k.release(sorted[i])
+		}
+	}
+}
+
+func (k *keyedMutex) acquire(key string) *refCountedMutex {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.locks == nil {
+		k.locks = make(map[string]*refCountedMutex)
+	}
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = &refCountedMutex{}
+		k.locks[key] = lock
+	}
+	lock.refs++
+	return lock
+}
+
+func (k *keyedMutex) release(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	lock := k.locks[key]
+	lock.refs--
+	if lock.refs == 0 {
+		delete(k.locks, key)
+	}
+}
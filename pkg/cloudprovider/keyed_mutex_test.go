@@ -0,0 +1,58 @@
+package cloudprovider
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedMutex(t *testing.T) {
+	var k keyedMutex
+
+	// Different keys don't block each other.
+	unlockA := k.Lock("a")
+	done := make(chan struct{})
+	go func() {
+		k.Lock("b")()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("TestKeyedMutex: locking key b blocked on key a")
+	}
+
+	// The same key does, even as part of several keys.
+	locked := make(chan struct{})
+	go func() {
+		unlock := k.Lock("b", "a")
+		close(locked)
+		unlock()
+	}()
+	select {
+	case <-locked:
+		t.Fatalf("TestKeyedMutex: locked key a twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlockA()
+	<-locked
+
+	// Overlapping sets of keys locked in different orders don't deadlock.
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			k.Lock("a", "b")()
+		}()
+		go func() {
+			defer wg.Done()
+			k.Lock("b", "a")()
+		}()
+	}
+	wg.Wait()
+
+	if len(k.locks) != 0 {
+		t.Fatalf("TestKeyedMutex: expected all locks to be dropped, got %d", len(k.locks))
+	}
+}
@@ -0,0 +1,201 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+
+	corev1 "k8s.io/api/core/v1"
+	utilnet "k8s.io/utils/net"
+)
+
+const (
+	// PlatformTypeNone is the string representation for platforms without a
+	// cloud API, e.g. bare metal.
+	PlatformTypeNone = "None"
+
+	// NodePrimaryIfAddrAnnotation is the annotation the network plugin
+	// reports the CIDRs of the primary interface of the node with, e.g.
+	// {"ipv4":"192.168.111.20/24","ipv6":"fd2e:6f44:5dd8::20/64"}.
+	NodePrimaryIfAddrAnnotation = "k8s.ovn.org/node-primary-ifaddr"
+
+	// defaultNoneCapacity is the number of egress IPs reported per node if
+	// NoneCapacity isn't set, as on OpenStack.
+	defaultNoneCapacity = 64
+)
+
+// None implements the cloud provider of platforms without a cloud API. There's
+// nothing to program: the network of the nodes delivers the traffic of any
+// address of their subnets, the node announcing it being enough. Assignments
+// are only validated against the subnets of the node, and recorded by the
+// status of the CloudPrivateIPConfigs like on any other platform.
+type None struct {
+	CloudProvider
+	noOwnedResources
+}
+
+// initCredentials is a no-op, there's no cloud API to authenticate to.
+func (n *None) initCredentials() error {
+	return nil
+}
+
+// AssignPrivateIP validates that ip is in the subnet of its address family of
+// the node's primary interface, and isn't an address of the node.
+func (n *None) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	return validateNoneIP(ip, node)
+}
+
+func (n *None) AllowsMovePrivateIP() bool {
+	return false
+}
+
+func (n *None) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+	return nil
+}
+
+// ReleasePrivateIP is a no-op, nothing was programmed.
+func (n *None) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	return nil
+}
+
+func (n *None) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, n.AssignPrivateIP)
+}
+
+func (n *None) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, n.ReleasePrivateIP)
+}
+
+// GetNodeEgressIPConfiguration returns the CIDRs of the node's primary
+// interface, keyed by the name of the node, and the configured capacity, for
+// all address families.
+func (n *None) GetNodeEgressIPConfiguration(ctx context.Context, node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
+	ifAddrs, err := getNoneIfAddrs(node)
+	if err != nil {
+		return nil, err
+	}
+	limit := n.cfg.NoneCapacity
+	if limit <= 0 {
+		limit = defaultNoneCapacity
+	}
+	config := &NodeEgressIPConfiguration{
+		Interface: node.Name,
+		Capacity:  capacity{IP: limit},
+	}
+	for _, cidr := range ifAddrs {
+		if utilnet.IsIPv6CIDR(cidr) {
+			config.IFAddr.IPv6 = cidr.String()
+		} else {
+			config.IFAddr.IPv4 = cidr.String()
+		}
+	}
+	return []*NodeEgressIPConfiguration{config}, nil
+}
+
+// CleanupNode is a no-op, nothing was programmed.
+func (n *None) CleanupNode(ctx context.Context, node *corev1.Node) error {
+	return nil
+}
+
+// VerifyPrivateIP verifies that ip is still in a subnet of the node's primary
+// interface, wrapping a MissingIPError otherwise: the node was moved to
+// another subnet since.
+func (n *None) VerifyPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	ifAddrs, err := getNoneIfAddrs(node)
+	if err != nil {
+		return err
+	}
+	for _, cidr := range ifAddrs {
+		if cidr.Contains(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: IP address %s is in none of the subnets %v of node %s", MissingIPError, ip, ifAddrs, node.Name)
+}
+
+// GetPrivateIPReservations returns nil, there's no cloud resource.
+func (n *None) GetPrivateIPReservations(ctx context.Context, ip net.IP, node *corev1.Node) ([]PrivateIPReservation, error) {
+	return nil, nil
+}
+
+// GetNodeNetworkInterfaces returns nil, there's no cloud resource.
+func (n *None) GetNodeNetworkInterfaces(ctx context.Context, node *corev1.Node) ([]string, error) {
+	return nil, nil
+}
+
+// ListPrivateIPs returns nil, there's no cloud resource.
+func (n *None) ListPrivateIPs(ctx context.Context, node *corev1.Node) ([]net.IP, error) {
+	return nil, nil
+}
+
+// CheckHealth returns nil, there's no cloud API.
+func (n *None) CheckHealth(ctx context.Context, node *corev1.Node) error {
+	return nil
+}
+
+// validateNoneIP returns an error if ip isn't in the subnet of its address
+// family of the node's primary interface, or is an address of the node.
+func validateNoneIP(ip net.IP, node *corev1.Node) error {
+	ifAddrs, err := getNoneIfAddrs(node)
+	if err != nil {
+		return err
+	}
+	for _, nodeIP := range nodeInternalIPs(node) {
+		if nodeIP.Equal(ip) {
+			return fmt.Errorf("IP address %s is an address of node %s", ip, node.Name)
+		}
+	}
+	for _, cidr := range ifAddrs {
+		if !cidr.Contains(ip) {
+			continue
+		}
+		if ip.Equal(cidr.IP) || ip.Equal(getBroadcastAddress(cidr)) {
+			return fmt.Errorf("IP address %s is the network or broadcast address of subnet %s of node %s", ip, cidr, node.Name)
+		}
+		return nil
+	}
+	return fmt.Errorf("IP address %s is in none of the subnets %v of node %s", ip, ifAddrs, node.Name)
+}
+
+// getNoneIfAddrs returns the CIDRs of the node's primary interface, as
+// reported by the network plugin.
+func getNoneIfAddrs(node *corev1.Node) ([]*net.IPNet, error) {
+	annotation, ok := node.Annotations[NodePrimaryIfAddrAnnotation]
+	if !ok {
+		return nil, fmt.Errorf("%w: node %s has no %s annotation reporting the subnets of its primary interface", NoNetworkInterfaceError, node.Name, NodePrimaryIfAddrAnnotation)
+	}
+	ifAddr := ifAddr{}
+	if err := json.Unmarshal([]byte(annotation), &ifAddr); err != nil {
+		return nil, fmt.Errorf("error parsing the %s annotation %q of node %s, err: %v", NodePrimaryIfAddrAnnotation, annotation, node.Name, err)
+	}
+	var ifAddrs []*net.IPNet
+	for _, s := range []string{ifAddr.IPv4, ifAddr.IPv6} {
+		if s == "" {
+			continue
+		}
+		_, cidr, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the %s annotation %q of node %s, err: %v", NodePrimaryIfAddrAnnotation, annotation, node.Name, err)
+		}
+		ifAddrs = append(ifAddrs, cidr)
+	}
+	if len(ifAddrs) == 0 {
+		return nil, fmt.Errorf("%w: the %s annotation of node %s reports no subnet", NoNetworkInterfaceError, NodePrimaryIfAddrAnnotation, node.Name)
+	}
+	return ifAddrs, nil
+}
+
+// getBroadcastAddress returns the broadcast address of the IPv4 subnet, nil
+// for IPv6 subnets, which have none.
+func getBroadcastAddress(cidr *net.IPNet) net.IP {
+	ip := cidr.IP.To4()
+	if ip == nil || len(cidr.Mask) != net.IPv4len {
+		return nil
+	}
+	broadcast := make(net.IP, net.IPv4len)
+	for i := range ip {
+		broadcast[i] = ip[i] | ^cidr.Mask[i]
+	}
+	return broadcast
+}
@@ -0,0 +1,101 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newNoneNode(ifAddr string) *corev1.Node {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0"},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "192.168.111.20"}},
+		},
+	}
+	if ifAddr != "" {
+		node.Annotations = map[string]string{NodePrimaryIfAddrAnnotation: ifAddr}
+	}
+	return node
+}
+
+func TestNoneAssignPrivateIP(t *testing.T) {
+	tcs := []struct {
+		ip        string
+		ifAddr    string
+		expectErr bool
+	}{
+		{ip: "192.168.111.30", ifAddr: `{"ipv4":"192.168.111.20/24"}`},
+		{ip: "fd2e::30", ifAddr: `{"ipv4":"192.168.111.20/24","ipv6":"fd2e::20/64"}`},
+		{ip: "fd2e::30", ifAddr: `{"ipv4":"192.168.111.20/24"}`, expectErr: true},
+		{ip: "192.168.112.30", ifAddr: `{"ipv4":"192.168.111.20/24"}`, expectErr: true},
+		// Neither the node's address, nor the network and broadcast ones.
+		{ip: "192.168.111.20", ifAddr: `{"ipv4":"192.168.111.20/24"}`, expectErr: true},
+		{ip: "192.168.111.0", ifAddr: `{"ipv4":"192.168.111.20/24"}`, expectErr: true},
+		{ip: "192.168.111.255", ifAddr: `{"ipv4":"192.168.111.20/24"}`, expectErr: true},
+		{ip: "192.168.111.30", ifAddr: "", expectErr: true},
+		{ip: "192.168.111.30", ifAddr: `{"ipv4":"192.168.111.20"}`, expectErr: true},
+	}
+	for i, tc := range tcs {
+		provider := &None{}
+		err := provider.AssignPrivateIP(context.Background(), net.ParseIP(tc.ip), newNoneNode(tc.ifAddr))
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestNoneAssignPrivateIP(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+	}
+}
+
+func TestNoneVerifyPrivateIP(t *testing.T) {
+	provider := &None{}
+	ip := net.ParseIP("192.168.111.30")
+	if err := provider.VerifyPrivateIP(context.Background(), ip, newNoneNode(`{"ipv4":"192.168.111.20/24"}`)); err != nil {
+		t.Fatalf("received unexpected error verifying IP address, err: %v", err)
+	}
+	// The node was moved to another subnet.
+	if err := provider.VerifyPrivateIP(context.Background(), ip, newNoneNode(`{"ipv4":"192.168.112.20/24"}`)); !errors.Is(err, MissingIPError) {
+		t.Fatalf("expected a MissingIPError verifying an IP address out of the node's subnet, got %v", err)
+	}
+	if err := provider.VerifyPrivateIP(context.Background(), ip, newNoneNode("")); !errors.Is(err, NoNetworkInterfaceError) {
+		t.Fatalf("expected a NoNetworkInterfaceError verifying an IP address of a node without subnets, got %v", err)
+	}
+}
+
+func TestNoneGetNodeEgressIPConfiguration(t *testing.T) {
+	tcs := []struct {
+		noneCapacity int
+		ifAddr       string
+		expected     NodeEgressIPConfiguration
+	}{
+		{
+			ifAddr: `{"ipv4":"192.168.111.20/24","ipv6":"fd2e::20/64"}`,
+			expected: NodeEgressIPConfiguration{
+				Interface: "worker-0",
+				IFAddr:    ifAddr{IPv4: "192.168.111.0/24", IPv6: "fd2e::/64"},
+				Capacity:  capacity{IP: defaultNoneCapacity},
+			},
+		},
+		{
+			noneCapacity: 10,
+			ifAddr:       `{"ipv6":"fd2e::20/64"}`,
+			expected: NodeEgressIPConfiguration{
+				Interface: "worker-0",
+				IFAddr:    ifAddr{IPv6: "fd2e::/64"},
+				Capacity:  capacity{IP: 10},
+			},
+		},
+	}
+	for i, tc := range tcs {
+		provider := &None{CloudProvider: CloudProvider{cfg: CloudProviderConfig{NoneCapacity: tc.noneCapacity}}}
+		configs, err := provider.GetNodeEgressIPConfiguration(context.Background(), newNoneNode(tc.ifAddr))
+		if err != nil {
+			t.Fatalf("TestNoneGetNodeEgressIPConfiguration(%d): received unexpected error, err: %v", i, err)
+		}
+		if len(configs) != 1 || configs[0].Interface != tc.expected.Interface || configs[0].IFAddr != tc.expected.IFAddr || configs[0].Capacity != tc.expected.Capacity {
+			t.Fatalf("TestNoneGetNodeEgressIPConfiguration(%d): expected configuration %+v, got %+v", i, tc.expected, configs)
+		}
+	}
+}
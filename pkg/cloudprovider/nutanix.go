@@ -0,0 +1,564 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+const (
+	// PlatformTypeNutanix is the string representation for the Nutanix AHV
+	// platform type.
+	PlatformTypeNutanix = "Nutanix"
+
+	// nutanixMaxCapacity is the number of egress IPs reported per NIC: Prism
+	// Central has no notion of a limit, see ovirtMaxCapacity.
+	nutanixMaxCapacity = 64
+
+	// nutanixClientContext prefixes the client context of the IP address
+	// reservations of the controller, followed by the UUID of the VM.
+	nutanixClientContext = "cloud-network-config-controller:"
+
+	// defaultNutanixTaskTimeout applies to the tasks of the changes, if
+	// NutanixTaskTimeout isn't set. They're polled every
+	// defaultNutanixPollInterval at first, the interval doubling up to
+	// defaultNutanixPollMaxInterval.
+	defaultNutanixTaskTimeout     = 10 * time.Minute
+	defaultNutanixPollInterval    = time.Second
+	defaultNutanixPollMaxInterval = 10 * time.Second
+
+	nutanixSubnetTypeOverlay = "OVERLAY"
+)
+
+// Nutanix implements the API wrapper for talking to the Prism Central APIs of
+// Nutanix AHV. Egress IPs are secondary IP addresses of the first NIC of the VM
+// on overlay subnets of Flow Virtual Networking, which filter the addresses
+// VMs send from. On VLAN subnets, which don't, they're reserved in the IPAM of
+// the subnet instead, for them not to be handed out to other VMs. Both changes
+// are carried out by asynchronous tasks.
+type Nutanix struct {
+	CloudProvider
+	noOwnedResources
+	// v3 and v4 send the requests of the v3 API, for VMs, and the v4 APIs,
+	// for IP address reservations and tasks.
+	v3 *restClient
+	v4 *restClient
+	// vmLocks serializes the updates of each VM, which are rejected if the
+	// VM was updated since it was retrieved.
+	vmLocks keyedMutex
+	// pollInterval is the first interval between polls of tasks, doubling
+	// after every poll up to pollMaxInterval.
+	pollInterval    time.Duration
+	pollMaxInterval time.Duration
+}
+
+type nutanixReference struct {
+	UUID string `json:"uuid"`
+}
+
+type nutanixNIC struct {
+	UUID            string           `json:"uuid"`
+	MacAddress      string           `json:"mac_address"`
+	SubnetReference nutanixReference `json:"subnet_reference"`
+	IPEndpointList  []struct {
+		IP string `json:"ip"`
+	} `json:"ip_endpoint_list"`
+	SecondaryIPAddressList []string `json:"secondary_ip_address_list"`
+}
+
+type nutanixVM struct {
+	Metadata nutanixReference `json:"metadata"`
+	Spec     struct {
+		Resources struct {
+			NICList []nutanixNIC `json:"nic_list"`
+		} `json:"resources"`
+	} `json:"spec"`
+}
+
+type nutanixSubnet struct {
+	Metadata nutanixReference `json:"metadata"`
+	Spec     struct {
+		Resources struct {
+			SubnetType string `json:"subnet_type"`
+			IPConfig   *struct {
+				SubnetIP     string `json:"subnet_ip"`
+				PrefixLength int    `json:"prefix_length"`
+			} `json:"ip_config"`
+		} `json:"resources"`
+	} `json:"spec"`
+}
+
+type nutanixIPAddress struct {
+	IPv4 struct {
+		Value string `json:"value"`
+	} `json:"ipv4"`
+}
+
+type nutanixReservedIP struct {
+	IPAddress     nutanixIPAddress `json:"ipAddress"`
+	ClientContext string           `json:"clientContext"`
+}
+
+// nutanixCredentials is the format of the credentials of the secret, shared
+// with the other components of the platform.
+type nutanixCredentials []struct {
+	Type string `json:"type"`
+	Data struct {
+		PrismCentral struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"prismCentral"`
+	} `json:"data"`
+}
+
+func (n *Nutanix) initCredentials() error {
+	data, err := n.readSecretData("credentials")
+	if err != nil {
+		return err
+	}
+	credentials := nutanixCredentials{}
+	if err := json.Unmarshal([]byte(data), &credentials); err != nil {
+		return fmt.Errorf("error decoding the Nutanix credentials, err: %v", err)
+	}
+	username, password := "", ""
+	for _, credential := range credentials {
+		if credential.Type == "basic_auth" {
+			username, password = credential.Data.PrismCentral.Username, credential.Data.PrismCentral.Password
+		}
+	}
+	if username == "" {
+		return fmt.Errorf("the Nutanix credentials hold no basic_auth Prism Central credentials")
+	}
+	if n.cfg.NutanixPrismCentralURL == "" {
+		return fmt.Errorf("the URL of Prism Central is needed to reach the Nutanix APIs")
+	}
+	httpClient, err := newHTTPClient(n.cfg.ConfigDir)
+	if err != nil {
+		return err
+	}
+	baseURL := strings.TrimSuffix(n.cfg.NutanixPrismCentralURL, "/") + "/api"
+	authorize := func(r *http.Request) error {
+		r.SetBasicAuth(username, password)
+		// The v4 APIs require a request ID, making changes idempotent.
+		if r.Method != http.MethodGet {
+			r.Header.Set("NTNX-Request-Id", uuid.NewString())
+		}
+		return nil
+	}
+	n.v3 = &restClient{httpClient: httpClient, baseURL: baseURL + "/nutanix/v3", authorize: authorize}
+	n.v4 = &restClient{httpClient: httpClient, baseURL: baseURL, authorize: authorize}
+	n.pollInterval, n.pollMaxInterval = defaultNutanixPollInterval, defaultNutanixPollMaxInterval
+	klog.Infof("Using Prism Central at %s", n.cfg.NutanixPrismCentralURL)
+	return nil
+}
+
+// AssignPrivateIP adds ip to the secondary IP addresses of the first NIC of
+// the node's VM, on overlay subnets, or reserves it for the VM in the IPAM of
+// the subnet, on VLAN subnets. A reservation of ip left behind for a VM which
+// doesn't exist anymore is released first.
+func (n *Nutanix) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	if !utilnet.IsIPv4(ip) {
+		return fmt.Errorf("Nutanix AHV subnets are IPv4 only, can't assign IP address %s", ip)
+	}
+	vmUUID, err := getNutanixVMUUID(node)
+	if err != nil {
+		return err
+	}
+	defer n.vmLocks.Lock(vmUUID)()
+	vm, nic, subnet, err := n.getNIC(ctx, node, vmUUID)
+	if err != nil {
+		return err
+	}
+	if subnet.Spec.Resources.SubnetType == nutanixSubnetTypeOverlay {
+		if hasNutanixSecondaryIP(nic, ip) {
+			return AlreadyExistingIPError
+		}
+		return n.updateSecondaryIPs(ctx, vm.Metadata.UUID, nic.UUID, append(nic.SecondaryIPAddressList, ip.String()))
+	}
+	reservedIP, err := n.getReservedIP(ctx, subnet.Metadata.UUID, ip)
+	if err != nil {
+		return err
+	}
+	if reservedIP != nil {
+		if reservedIP.ClientContext == nutanixClientContext+vm.Metadata.UUID {
+			return AlreadyExistingIPError
+		}
+		if err := n.releaseStaleReservation(ctx, subnet.Metadata.UUID, ip, reservedIP); err != nil {
+			return err
+		}
+	}
+	return n.reserveIP(ctx, subnet.Metadata.UUID, ip, "reserve-ips", nutanixClientContext+vm.Metadata.UUID)
+}
+
+func (n *Nutanix) AllowsMovePrivateIP() bool {
+	return false
+}
+
+func (n *Nutanix) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+	return nil
+}
+
+// ReleasePrivateIP removes ip from the secondary IP addresses of the first NIC
+// of the node's VM, or releases its reservation for the VM.
+func (n *Nutanix) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	vmUUID, err := getNutanixVMUUID(node)
+	if err != nil {
+		return err
+	}
+	defer n.vmLocks.Lock(vmUUID)()
+	vm, nic, subnet, err := n.getNIC(ctx, node, vmUUID)
+	if err != nil {
+		return err
+	}
+	if subnet.Spec.Resources.SubnetType == nutanixSubnetTypeOverlay {
+		if !hasNutanixSecondaryIP(nic, ip) {
+			return NonExistingIPError
+		}
+		secondaryIPs := []string{}
+		for _, secondaryIP := range nic.SecondaryIPAddressList {
+			if !ParseIP(secondaryIP).Equal(ip) {
+				secondaryIPs = append(secondaryIPs, secondaryIP)
+			}
+		}
+		return n.updateSecondaryIPs(ctx, vm.Metadata.UUID, nic.UUID, secondaryIPs)
+	}
+	reservedIP, err := n.getReservedIP(ctx, subnet.Metadata.UUID, ip)
+	if err != nil {
+		return err
+	}
+	if reservedIP == nil || reservedIP.ClientContext != nutanixClientContext+vm.Metadata.UUID {
+		return NonExistingIPError
+	}
+	return n.reserveIP(ctx, subnet.Metadata.UUID, ip, "unreserve-ips", "")
+}
+
+func (n *Nutanix) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, n.AssignPrivateIP)
+}
+
+func (n *Nutanix) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, n.ReleasePrivateIP)
+}
+
+// GetNodeEgressIPConfiguration returns the configuration of the first NIC of
+// the node's VM, keyed by UUID.
+func (n *Nutanix) GetNodeEgressIPConfiguration(ctx context.Context, node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
+	vmUUID, err := getNutanixVMUUID(node)
+	if err != nil {
+		return nil, err
+	}
+	vm, nic, subnet, err := n.getNIC(ctx, node, vmUUID)
+	if err != nil {
+		return nil, err
+	}
+	ipConfig := subnet.Spec.Resources.IPConfig
+	_, cidr, err := net.ParseCIDR(fmt.Sprintf("%s/%d", ipConfig.SubnetIP, ipConfig.PrefixLength))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the CIDR %s/%d of subnet %s, err: %v", ipConfig.SubnetIP, ipConfig.PrefixLength, subnet.Metadata.UUID, err)
+	}
+	assigned := len(nic.SecondaryIPAddressList)
+	if subnet.Spec.Resources.SubnetType != nutanixSubnetTypeOverlay {
+		reservedIPs, err := n.listReservedIPs(ctx, subnet.Metadata.UUID)
+		if err != nil {
+			return nil, err
+		}
+		assigned = 0
+		for _, reservedIP := range reservedIPs {
+			if reservedIP.ClientContext == nutanixClientContext+vm.Metadata.UUID {
+				assigned++
+			}
+		}
+	}
+	config := &NodeEgressIPConfiguration{
+		Interface: nic.UUID,
+		IFAddr:    ifAddr{IPv4: cidr.String()},
+		Capacity:  capacity{IPv4: nutanixMaxCapacity - assigned},
+		MAC:       normalizeMAC(nic.MacAddress),
+	}
+	if config.Capacity.IPv4 < 0 {
+		config.Capacity.IPv4 = 0
+	}
+	return []*NodeEgressIPConfiguration{config}, nil
+}
+
+// CleanupNode is a no-op: secondary IP addresses are deleted together with
+// the VM, and reservations left behind by deleted VMs are released once their
+// IP addresses are assigned again.
+func (n *Nutanix) CleanupNode(ctx context.Context, node *corev1.Node) error {
+	return nil
+}
+
+// VerifyPrivateIP verifies that ip is still a secondary IP address of the
+// first NIC of the node's VM, or reserved for it, wrapping a MissingIPError
+// otherwise.
+func (n *Nutanix) VerifyPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	vmUUID, err := getNutanixVMUUID(node)
+	if err != nil {
+		return err
+	}
+	vm, nic, subnet, err := n.getNIC(ctx, node, vmUUID)
+	if err != nil {
+		return err
+	}
+	if subnet.Spec.Resources.SubnetType == nutanixSubnetTypeOverlay {
+		if !hasNutanixSecondaryIP(nic, ip) {
+			return fmt.Errorf("%w: IP address %s is no secondary IP address of NIC %s", MissingIPError, ip, nic.UUID)
+		}
+		return nil
+	}
+	reservedIP, err := n.getReservedIP(ctx, subnet.Metadata.UUID, ip)
+	if err != nil {
+		return err
+	}
+	if reservedIP == nil || reservedIP.ClientContext != nutanixClientContext+vm.Metadata.UUID {
+		return fmt.Errorf("%w: IP address %s is not reserved for VM %s in subnet %s", MissingIPError, ip, vm.Metadata.UUID, subnet.Metadata.UUID)
+	}
+	return nil
+}
+
+// GetPrivateIPReservations returns nil, neither secondary IP addresses nor
+// IPAM reservations are resources of their own.
+func (n *Nutanix) GetPrivateIPReservations(ctx context.Context, ip net.IP, node *corev1.Node) ([]PrivateIPReservation, error) {
+	return nil, nil
+}
+
+// GetNodeNetworkInterfaces returns nil, the first NIC of a VM isn't tracked.
+func (n *Nutanix) GetNodeNetworkInterfaces(ctx context.Context, node *corev1.Node) ([]string, error) {
+	return nil, nil
+}
+
+// ListPrivateIPs returns nil, the IP addresses reserved in managed subnets
+// are only known per subnet, not per VM.
+func (n *Nutanix) ListPrivateIPs(ctx context.Context, node *corev1.Node) ([]net.IP, error) {
+	return nil, nil
+}
+
+// CheckHealth retrieves the node's VM and the subnet of its NIC.
+func (n *Nutanix) CheckHealth(ctx context.Context, node *corev1.Node) error {
+	vmUUID, err := getNutanixVMUUID(node)
+	if err != nil {
+		return err
+	}
+	_, _, _, err = n.getNIC(ctx, node, vmUUID)
+	return err
+}
+
+// getNIC returns the node's VM, its first NIC and the subnet of the NIC. The
+// subnet needs IPAM, for the CNCC to know its CIDR, and overlay subnets have
+// it.
+func (n *Nutanix) getNIC(ctx context.Context, node *corev1.Node, vmUUID string) (*nutanixVM, *nutanixNIC, *nutanixSubnet, error) {
+	vm := &nutanixVM{}
+	if err := n.v3.do(ctx, http.MethodGet, "/vms/"+vmUUID, nil, nil, vm); err != nil {
+		return nil, nil, nil, fmt.Errorf("error retrieving VM %s of node %s, err: %v", vmUUID, node.Name, err)
+	}
+	if len(vm.Spec.Resources.NICList) == 0 {
+		return nil, nil, nil, fmt.Errorf("%w: VM %s of node %s has no NIC", NoNetworkInterfaceError, vmUUID, node.Name)
+	}
+	nic := &vm.Spec.Resources.NICList[0]
+	subnet := &nutanixSubnet{}
+	if err := n.v3.do(ctx, http.MethodGet, "/subnets/"+nic.SubnetReference.UUID, nil, nil, subnet); err != nil {
+		return nil, nil, nil, fmt.Errorf("error retrieving subnet %s of node %s, err: %v", nic.SubnetReference.UUID, node.Name, err)
+	}
+	if subnet.Spec.Resources.IPConfig == nil {
+		return nil, nil, nil, fmt.Errorf("subnet %s of node %s has no IPAM, the CNCC can't manage egress IPs on it", nic.SubnetReference.UUID, node.Name)
+	}
+	return vm, nic, subnet, nil
+}
+
+// updateSecondaryIPs replaces the secondary IP addresses of the NIC of the VM
+// and waits for the update to complete. The VM is updated as retrieved, bar
+// its status, for the update not to reset any of its other settings.
+func (n *Nutanix) updateSecondaryIPs(ctx context.Context, vmUUID, nicUUID string, secondaryIPs []string) error {
+	vm := map[string]interface{}{}
+	if err := n.v3.do(ctx, http.MethodGet, "/vms/"+vmUUID, nil, nil, &vm); err != nil {
+		return fmt.Errorf("error retrieving VM %s, err: %v", vmUUID, err)
+	}
+	delete(vm, "status")
+	spec, _ := vm["spec"].(map[string]interface{})
+	resources, _ := spec["resources"].(map[string]interface{})
+	nics, _ := resources["nic_list"].([]interface{})
+	updated := false
+	for _, nic := range nics {
+		if nic, ok := nic.(map[string]interface{}); ok && nic["uuid"] == nicUUID {
+			nic["secondary_ip_address_list"] = secondaryIPs
+			updated = true
+		}
+	}
+	if !updated {
+		return fmt.Errorf("%w: NIC %s of VM %s is gone", NoNetworkInterfaceError, nicUUID, vmUUID)
+	}
+	response := &struct {
+		Status struct {
+			ExecutionContext struct {
+				TaskUUID string `json:"task_uuid"`
+			} `json:"execution_context"`
+		} `json:"status"`
+	}{}
+	if err := n.v3.do(ctx, http.MethodPut, "/vms/"+vmUUID, nil, vm, response); err != nil {
+		return fmt.Errorf("error updating the secondary IP addresses of NIC %s of VM %s, err: %v", nicUUID, vmUUID, err)
+	}
+	taskUUID := response.Status.ExecutionContext.TaskUUID
+	return n.waitForTask(ctx, taskUUID, func(ctx context.Context) (string, string, error) {
+		task := &struct {
+			Status      string `json:"status"`
+			ErrorDetail string `json:"error_detail"`
+		}{}
+		err := n.v3.do(ctx, http.MethodGet, "/tasks/"+taskUUID, nil, nil, task)
+		return task.Status, task.ErrorDetail, err
+	})
+}
+
+// reserveIP carries out the reserve-ips, or unreserve-ips, action of the
+// subnet for ip, and waits for it to complete.
+func (n *Nutanix) reserveIP(ctx context.Context, subnetUUID string, ip net.IP, action, clientContext string) error {
+	request := map[string]interface{}{
+		"reserveType": "IP_ADDRESS_LIST",
+		"ipAddresses": []interface{}{map[string]interface{}{"ipv4": map[string]string{"value": ip.String()}}},
+	}
+	if action == "unreserve-ips" {
+		request = map[string]interface{}{
+			"unreserveType": "IP_ADDRESS_LIST",
+			"ipAddresses":   request["ipAddresses"],
+		}
+	}
+	if clientContext != "" {
+		request["clientContext"] = clientContext
+	}
+	response := &struct {
+		Data struct {
+			ExtID string `json:"extId"`
+		} `json:"data"`
+	}{}
+	if err := n.v4.do(ctx, http.MethodPost, fmt.Sprintf("/networking/v4.0/config/subnets/%s/$actions/%s", subnetUUID, action), nil, request, response); err != nil {
+		return fmt.Errorf("error carrying out %s of IP address %s in subnet %s, err: %v", action, ip, subnetUUID, err)
+	}
+	taskID := response.Data.ExtID
+	return n.waitForTask(ctx, taskID, func(ctx context.Context) (string, string, error) {
+		task := &struct {
+			Data struct {
+				Status        string `json:"status"`
+				ErrorMessages []struct {
+					Message string `json:"message"`
+				} `json:"errorMessages"`
+			} `json:"data"`
+		}{}
+		err := n.v4.do(ctx, http.MethodGet, "/prism/v4.0/config/tasks/"+url.PathEscape(taskID), nil, nil, task)
+		messages := []string{}
+		for _, message := range task.Data.ErrorMessages {
+			messages = append(messages, message.Message)
+		}
+		return task.Data.Status, strings.Join(messages, "; "), err
+	})
+}
+
+// releaseStaleReservation releases the reservation of ip if the controller
+// made it for a VM which doesn't exist anymore, and fails otherwise: ip is in
+// use.
+func (n *Nutanix) releaseStaleReservation(ctx context.Context, subnetUUID string, ip net.IP, reservedIP *nutanixReservedIP) error {
+	vmUUID := strings.TrimPrefix(reservedIP.ClientContext, nutanixClientContext)
+	if vmUUID == reservedIP.ClientContext {
+		return fmt.Errorf("IP address %s is reserved in subnet %s by another client", ip, subnetUUID)
+	}
+	err := n.v3.do(ctx, http.MethodGet, "/vms/"+vmUUID, nil, nil, nil)
+	if err == nil {
+		return fmt.Errorf("IP address %s is reserved in subnet %s for VM %s already", ip, subnetUUID, vmUUID)
+	}
+	if !isRESTStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("error retrieving VM %s IP address %s is reserved for, err: %v", vmUUID, ip, err)
+	}
+	klog.Infof("Releasing the reservation of IP address %s in subnet %s for deleted VM %s", ip, subnetUUID, vmUUID)
+	return n.reserveIP(ctx, subnetUUID, ip, "unreserve-ips", "")
+}
+
+// getReservedIP returns the reservation of ip in the subnet, nil if there's
+// none.
+func (n *Nutanix) getReservedIP(ctx context.Context, subnetUUID string, ip net.IP) (*nutanixReservedIP, error) {
+	reservedIPs, err := n.listReservedIPs(ctx, subnetUUID)
+	if err != nil {
+		return nil, err
+	}
+	for _, reservedIP := range reservedIPs {
+		if ParseIP(reservedIP.IPAddress.IPv4.Value).Equal(ip) {
+			return &reservedIP, nil
+		}
+	}
+	return nil, nil
+}
+
+// listReservedIPs returns the IP address reservations of the subnet, page by
+// page.
+func (n *Nutanix) listReservedIPs(ctx context.Context, subnetUUID string) ([]nutanixReservedIP, error) {
+	const limit = 100
+	reservedIPs := []nutanixReservedIP{}
+	for page := 0; ; page++ {
+		response := &struct {
+			Data []nutanixReservedIP `json:"data"`
+		}{}
+		if err := n.v4.do(ctx, http.MethodGet, fmt.Sprintf("/networking/v4.0/config/subnets/%s/reserved-ips", subnetUUID), url.Values{
+			"$page":  {strconv.Itoa(page)},
+			"$limit": {strconv.Itoa(limit)},
+		}, nil, response); err != nil {
+			return nil, fmt.Errorf("error retrieving the IP address reservations of subnet %s, err: %v", subnetUUID, err)
+		}
+		reservedIPs = append(reservedIPs, response.Data...)
+		if len(response.Data) < limit {
+			return reservedIPs, nil
+		}
+	}
+}
+
+// waitForTask polls the task with poll, which returns its status and error
+// message, every pollInterval at first, the interval doubling after every
+// poll up to pollMaxInterval, until it's done or NutanixTaskTimeout expires,
+// see pollUntilDone.
+func (n *Nutanix) waitForTask(ctx context.Context, taskID string, poll func(ctx context.Context) (status, message string, err error)) error {
+	timeout := n.cfg.NutanixTaskTimeout
+	if timeout <= 0 {
+		timeout = defaultNutanixTaskTimeout
+	}
+	return n.pollUntilDone(ctx, "task "+taskID, n.pollInterval, n.pollMaxInterval, timeout, func(ctx context.Context) (bool, error) {
+		status, message, err := poll(ctx)
+		if err != nil {
+			return false, fmt.Errorf("error retrieving task %s, err: %v", taskID, err)
+		}
+		switch status {
+		case "SUCCEEDED":
+			return true, nil
+		case "FAILED", "ABORTED", "CANCELED":
+			return true, fmt.Errorf("task %s %s: %s", taskID, strings.ToLower(status), message)
+		}
+		return false, nil
+	})
+}
+
+// hasNutanixSecondaryIP returns true if ip is a secondary IP address of the
+// NIC.
+func hasNutanixSecondaryIP(nic *nutanixNIC, ip net.IP) bool {
+	for _, secondaryIP := range nic.SecondaryIPAddressList {
+		if ParseIP(secondaryIP).Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// getNutanixVMUUID returns the UUID of the node's VM, out of its providerID,
+// which looks like nutanix://<VM UUID>.
+func getNutanixVMUUID(node *corev1.Node) (string, error) {
+	vmUUID := strings.TrimPrefix(node.Spec.ProviderID, "nutanix://")
+	if _, err := uuid.Parse(vmUUID); err != nil || vmUUID == node.Spec.ProviderID {
+		return "", fmt.Errorf("failed to parse node %s provider id %q, expected nutanix://<VM UUID>", node.Name, node.Spec.ProviderID)
+	}
+	return vmUUID, nil
+}
@@ -0,0 +1,288 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	nutanixTestVMUUID      = "6fe3b5a0-cbd2-4c7f-8d6e-0a6e0f6a7d01"
+	nutanixTestOverlayUUID = "0d1a3f0e-52b4-4b8e-9f0a-5a9d2f6b1c01"
+	nutanixTestVLANUUID    = "0d1a3f0e-52b4-4b8e-9f0a-5a9d2f6b1c02"
+)
+
+// fakeNutanix serves the Prism Central API requests of VM nutanixTestVMUUID,
+// whose first NIC nic-0 is in subnet subnetUUID. Tasks are running when first
+// polled, and succeed or fail when polled again.
+type fakeNutanix struct {
+	mu           sync.Mutex
+	subnetUUID   string
+	secondaryIPs []string
+	reservedIPs  []nutanixReservedIP
+	// failTasks fails the tasks of the changes.
+	failTasks bool
+	// polls counts the polls of each task.
+	polls map[string]int
+	tasks int
+}
+
+func (f *fakeNutanix) newTask() string {
+	f.tasks++
+	return fmt.Sprintf("task-%d", f.tasks)
+}
+
+func (f *fakeNutanix) pollTask(id string) string {
+	if f.polls == nil {
+		f.polls = map[string]int{}
+	}
+	if f.polls[id]++; f.polls[id] == 1 {
+		return "RUNNING"
+	}
+	if f.failTasks {
+		return "FAILED"
+	}
+	return "SUCCEEDED"
+}
+
+func (f *fakeNutanix) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if username, password, ok := r.BasicAuth(); !ok || username != "admin" || password != "password" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet && r.Header.Get("NTNX-Request-Id") == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	const (
+		vmPath          = "/api/nutanix/v3/vms/" + nutanixTestVMUUID
+		subnetsPath     = "/networking/v4.0/config/subnets/" + nutanixTestVLANUUID
+		reservedIPsPath = "/api" + subnetsPath + "/reserved-ips"
+	)
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == vmPath:
+		secondaryIPs, _ := json.Marshal(f.secondaryIPs)
+		_, _ = fmt.Fprintf(w, `{
+			"metadata": {"uuid": "%s", "kind": "vm", "spec_version": 3},
+			"spec": {"name": "worker-0", "resources": {"num_sockets": 4, "nic_list": [
+				{"uuid": "nic-0", "mac_address": "50:6B:8D:00:00:01", "subnet_reference": {"kind": "subnet", "uuid": "%s"}, "ip_endpoint_list": [{"ip": "10.0.0.10"}], "secondary_ip_address_list": %s},
+				{"uuid": "nic-1", "mac_address": "50:6B:8D:00:00:02", "subnet_reference": {"kind": "subnet", "uuid": "%s"}}
+			]}},
+			"status": {"state": "COMPLETE"}
+		}`, nutanixTestVMUUID, f.subnetUUID, secondaryIPs, nutanixTestVLANUUID)
+	case r.Method == http.MethodPut && r.URL.Path == vmPath:
+		vm := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&vm); err != nil || vm["status"] != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		update := &nutanixVM{}
+		spec, _ := json.Marshal(vm)
+		_ = json.Unmarshal(spec, update)
+		// Settings the controller doesn't know of are kept.
+		if !strings.Contains(string(spec), `"num_sockets":4`) || len(update.Spec.Resources.NICList) != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.secondaryIPs = update.Spec.Resources.NICList[0].SecondaryIPAddressList
+		_, _ = fmt.Fprintf(w, `{"status": {"state": "PENDING", "execution_context": {"task_uuid": "%s"}}}`, f.newTask())
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/nutanix/v3/vms/"):
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/nutanix/v3/subnets/"+nutanixTestOverlayUUID:
+		_, _ = fmt.Fprintf(w, `{"metadata": {"uuid": "%s"}, "spec": {"resources": {"subnet_type": "OVERLAY", "ip_config": {"subnet_ip": "10.0.0.0", "prefix_length": 24}}}}`, nutanixTestOverlayUUID)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/nutanix/v3/subnets/"+nutanixTestVLANUUID:
+		_, _ = fmt.Fprintf(w, `{"metadata": {"uuid": "%s"}, "spec": {"resources": {"subnet_type": "VLAN", "ip_config": {"subnet_ip": "10.0.0.0", "prefix_length": 24}}}}`, nutanixTestVLANUUID)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/nutanix/v3/tasks/"):
+		_, _ = fmt.Fprintf(w, `{"status": "%s", "error_detail": "internal error"}`, f.pollTask(strings.TrimPrefix(r.URL.Path, "/api/nutanix/v3/tasks/")))
+	case r.Method == http.MethodGet && r.URL.Path == reservedIPsPath:
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": f.reservedIPs})
+	case r.Method == http.MethodPost && r.URL.Path == "/api"+subnetsPath+"/$actions/reserve-ips":
+		request := &struct {
+			ReserveType   string             `json:"reserveType"`
+			IPAddresses   []nutanixIPAddress `json:"ipAddresses"`
+			ClientContext string             `json:"clientContext"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(request); err != nil || request.ReserveType != "IP_ADDRESS_LIST" || len(request.IPAddresses) != 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.reservedIPs = append(f.reservedIPs, nutanixReservedIP{IPAddress: request.IPAddresses[0], ClientContext: request.ClientContext})
+		_, _ = fmt.Fprintf(w, `{"data": {"extId": "ZXJnb24=:%s"}}`, f.newTask())
+	case r.Method == http.MethodPost && r.URL.Path == "/api"+subnetsPath+"/$actions/unreserve-ips":
+		request := &struct {
+			UnreserveType string             `json:"unreserveType"`
+			IPAddresses   []nutanixIPAddress `json:"ipAddresses"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(request); err != nil || request.UnreserveType != "IP_ADDRESS_LIST" || len(request.IPAddresses) != 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for i, reservedIP := range f.reservedIPs {
+			if reservedIP.IPAddress == request.IPAddresses[0] {
+				f.reservedIPs = append(f.reservedIPs[:i], f.reservedIPs[i+1:]...)
+				break
+			}
+		}
+		_, _ = fmt.Fprintf(w, `{"data": {"extId": "ZXJnb24=:%s"}}`, f.newTask())
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/prism/v4.0/config/tasks/"):
+		_, _ = fmt.Fprintf(w, `{"data": {"status": "%s", "errorMessages": [{"message": "internal error"}]}}`, f.pollTask(strings.TrimPrefix(r.URL.Path, "/api/prism/v4.0/config/tasks/")))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeNutanixProvider(server *httptest.Server) *Nutanix {
+	authorize := func(r *http.Request) error {
+		r.SetBasicAuth("admin", "password")
+		if r.Method != http.MethodGet {
+			r.Header.Set("NTNX-Request-Id", "request-id")
+		}
+		return nil
+	}
+	return &Nutanix{
+		CloudProvider:   CloudProvider{ctx: context.Background()},
+		v3:              &restClient{httpClient: server.Client(), baseURL: server.URL + "/api/nutanix/v3", authorize: authorize},
+		v4:              &restClient{httpClient: server.Client(), baseURL: server.URL + "/api", authorize: authorize},
+		pollInterval:    time.Millisecond,
+		pollMaxInterval: time.Millisecond,
+	}
+}
+
+func newNutanixNode() *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0"},
+		Spec:       corev1.NodeSpec{ProviderID: "nutanix://" + nutanixTestVMUUID},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.10"}},
+		},
+	}
+}
+
+// newNutanixFakeCloud plugs the fake API into the tests shared by the clouds,
+// the NIC of the VM being in subnet subnetUUID.
+func newNutanixFakeCloud(subnetUUID string) func(t *testing.T) *fakeCloud {
+	return func(t *testing.T) *fakeCloud {
+		fake := &fakeNutanix{subnetUUID: subnetUUID}
+		server := httptest.NewServer(fake)
+		return &fakeCloud{
+			CloudProviderIntf: newFakeNutanixProvider(server),
+			assigned: func() []string {
+				fake.mu.Lock()
+				defer fake.mu.Unlock()
+				ips := append([]string{}, fake.secondaryIPs...)
+				for _, reservedIP := range fake.reservedIPs {
+					ips = append(ips, reservedIP.IPAddress.IPv4.Value)
+				}
+				return ips
+			},
+			close: server.Close,
+		}
+	}
+}
+
+func TestNutanixAssignPrivateIP(t *testing.T) {
+	tcs := []struct {
+		ip                   string
+		subnetUUID           string
+		secondaryIPs         []string
+		reservedIPs          []nutanixReservedIP
+		failTasks            bool
+		expectedSecondaryIPs []string
+		expectedReservedIPs  []string
+		expectErr            bool
+	}{
+		{
+			ip:                   "10.0.0.20",
+			subnetUUID:           nutanixTestOverlayUUID,
+			secondaryIPs:         []string{"10.0.0.21"},
+			expectedSecondaryIPs: []string{"10.0.0.21", "10.0.0.20"},
+		},
+		{
+			ip:                  "10.0.0.20",
+			subnetUUID:          nutanixTestVLANUUID,
+			expectedReservedIPs: []string{"10.0.0.20=" + nutanixClientContext + nutanixTestVMUUID},
+		},
+		// The reservation of a deleted VM is released first.
+		{
+			ip:                  "10.0.0.20",
+			subnetUUID:          nutanixTestVLANUUID,
+			reservedIPs:         []nutanixReservedIP{newNutanixReservedIP("10.0.0.20", nutanixClientContext+"deleted")},
+			expectedReservedIPs: []string{"10.0.0.20=" + nutanixClientContext + nutanixTestVMUUID},
+		},
+		{
+			ip:                  "10.0.0.20",
+			subnetUUID:          nutanixTestVLANUUID,
+			reservedIPs:         []nutanixReservedIP{newNutanixReservedIP("10.0.0.20", "dhcp")},
+			expectedReservedIPs: []string{"10.0.0.20=dhcp"},
+			expectErr:           true,
+		},
+		{
+			ip:                   "10.0.0.20",
+			subnetUUID:           nutanixTestOverlayUUID,
+			failTasks:            true,
+			expectedSecondaryIPs: []string{"10.0.0.20"},
+			expectErr:            true,
+		},
+		{ip: "fd00::20", subnetUUID: nutanixTestOverlayUUID, expectErr: true},
+	}
+	for i, tc := range tcs {
+		fake := &fakeNutanix{subnetUUID: tc.subnetUUID, secondaryIPs: tc.secondaryIPs, reservedIPs: tc.reservedIPs, failTasks: tc.failTasks}
+		server := httptest.NewServer(fake)
+		provider := newFakeNutanixProvider(server)
+		err := provider.AssignPrivateIP(context.Background(), net.ParseIP(tc.ip), newNutanixNode())
+		server.Close()
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestNutanixAssignPrivateIP(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		if fmt.Sprint(fake.secondaryIPs) != fmt.Sprint(tc.expectedSecondaryIPs) {
+			t.Fatalf("TestNutanixAssignPrivateIP(%d): expected secondary IP addresses %v, got %v", i, tc.expectedSecondaryIPs, fake.secondaryIPs)
+		}
+		var reservedIPs []string
+		for _, reservedIP := range fake.reservedIPs {
+			reservedIPs = append(reservedIPs, reservedIP.IPAddress.IPv4.Value+"="+reservedIP.ClientContext)
+		}
+		if fmt.Sprint(reservedIPs) != fmt.Sprint(tc.expectedReservedIPs) {
+			t.Fatalf("TestNutanixAssignPrivateIP(%d): expected reserved IP addresses %v, got %v", i, tc.expectedReservedIPs, reservedIPs)
+		}
+	}
+}
+
+func TestGetNutanixVMUUID(t *testing.T) {
+	tcs := []struct {
+		providerID string
+		expected   string
+		expectErr  bool
+	}{
+		{providerID: "nutanix://" + nutanixTestVMUUID, expected: nutanixTestVMUUID},
+		{providerID: nutanixTestVMUUID, expectErr: true},
+		{providerID: "nutanix://vm-0", expectErr: true},
+		{providerID: "", expectErr: true},
+	}
+	for i, tc := range tcs {
+		vmUUID, err := getNutanixVMUUID(&corev1.Node{Spec: corev1.NodeSpec{ProviderID: tc.providerID}})
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestGetNutanixVMUUID(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		if !tc.expectErr && vmUUID != tc.expected {
+			t.Fatalf("TestGetNutanixVMUUID(%d): expected VM UUID %q, got %q", i, tc.expected, vmUUID)
+		}
+	}
+}
+
+func newNutanixReservedIP(ip, clientContext string) nutanixReservedIP {
+	reservedIP := nutanixReservedIP{ClientContext: clientContext}
+	reservedIP.IPAddress.IPv4.Value = ip
+	return reservedIP
+}
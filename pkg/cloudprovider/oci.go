@@ -0,0 +1,425 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+const (
+	// PlatformTypeOCI is the string representation for the Oracle Cloud
+	// Infrastructure platform type.
+	PlatformTypeOCI = "OCI"
+
+	// ociMaxIPsPerVNIC is the number of secondary private IPv4 addresses, and
+	// of IPv6 addresses, a VNIC can hold, whatever the shape of its instance,
+	// unless -platform-oci-shape-ip-limits says otherwise.
+	ociMaxIPsPerVNIC = 32
+)
+
+// OCI implements the API wrapper for talking to the Core Services API of
+// Oracle Cloud Infrastructure. Egress IPs are secondary private IPs, or IPv6
+// addresses, of the primary VNIC of the instance.
+type OCI struct {
+	CloudProvider
+	noOwnedResources
+	client *restClient
+	// shapeIPLimits overrides ociMaxIPsPerVNIC for the shapes it holds.
+	shapeIPLimits map[string]int
+}
+
+type ociInstance struct {
+	ID            string `json:"id"`
+	CompartmentID string `json:"compartmentId"`
+	Shape         string `json:"shape"`
+}
+
+type ociVNICAttachment struct {
+	ID             string `json:"id"`
+	VNICID         string `json:"vnicId"`
+	LifecycleState string `json:"lifecycleState"`
+}
+
+type ociVNIC struct {
+	ID         string `json:"id"`
+	SubnetID   string `json:"subnetId"`
+	MacAddress string `json:"macAddress"`
+	IsPrimary  bool   `json:"isPrimary"`
+}
+
+// ociPrivateIP is a private IPv4 address, or an IPv6 address, of a VNIC.
+type ociPrivateIP struct {
+	ID          string `json:"id,omitempty"`
+	VNICID      string `json:"vnicId"`
+	IPAddress   string `json:"ipAddress"`
+	DisplayName string `json:"displayName,omitempty"`
+	IsPrimary   bool   `json:"isPrimary,omitempty"`
+}
+
+type ociSubnet struct {
+	ID             string   `json:"id"`
+	CIDRBlock      string   `json:"cidrBlock"`
+	IPv6CIDRBlocks []string `json:"ipv6CidrBlocks"`
+}
+
+func (o *OCI) initCredentials() error {
+	httpClient, err := newHTTPClient(o.cfg.ConfigDir)
+	if err != nil {
+		return err
+	}
+	if o.shapeIPLimits, err = parseOCIShapeIPLimits(o.cfg.OCIShapeIPLimits); err != nil {
+		return err
+	}
+	baseURL := o.cfg.APIOverride
+	if baseURL == "" {
+		if o.cfg.OCIRegion == "" {
+			return fmt.Errorf("the OCI region is needed to reach the Core Services API of the region, unless the API URL is overridden")
+		}
+		baseURL = fmt.Sprintf("https://iaas.%s.oraclecloud.com/20160918", o.cfg.OCIRegion)
+	}
+	o.client = &restClient{
+		httpClient: httpClient,
+		baseURL:    baseURL,
+	}
+	if o.cfg.OCIInstancePrincipal {
+		if o.cfg.OCIRegion == "" {
+			return fmt.Errorf("the OCI region is needed to reach the authentication service of the region with an instance principal")
+		}
+		o.client.authorize = newOCIInstancePrincipal(httpClient, "", fmt.Sprintf("https://auth.%s.oraclecloud.com", o.cfg.OCIRegion)).authorize
+		klog.Infof("Using the OCI Core Services API at %s as instance principal", baseURL)
+		return nil
+	}
+	apiKey := &ociAPIKey{}
+	var keyID []string
+	for _, name := range []string{"oci_tenancy_id", "oci_user_id", "oci_fingerprint"} {
+		value, err := o.readSecretData(name)
+		if err != nil {
+			return err
+		}
+		keyID = append(keyID, strings.TrimSpace(value))
+	}
+	apiKey.keyID = strings.Join(keyID, "/")
+	privateKey, err := o.readSecretData("oci_private_key")
+	if err != nil {
+		return err
+	}
+	if apiKey.key, err = parseOCIPrivateKey([]byte(privateKey)); err != nil {
+		return err
+	}
+	o.client.authorize = apiKey.authorize
+	klog.Infof("Using the OCI Core Services API at %s as user %s", baseURL, keyID[1])
+	return nil
+}
+
+// AssignPrivateIP creates a secondary private IP of ip, or an IPv6 address, on
+// the primary VNIC of the node's instance. The creation fails if ip is
+// assigned to another VNIC of the subnet already.
+func (o *OCI) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	_, vnic, err := o.getVNIC(ctx, node)
+	if err != nil {
+		return err
+	}
+	privateIP, err := o.getPrivateIP(ctx, vnic, ip)
+	if err != nil {
+		return err
+	}
+	if privateIP != nil {
+		return AlreadyExistingIPError
+	}
+	if err := o.client.do(ctx, http.MethodPost, getOCIPrivateIPPath(ip), nil, &ociPrivateIP{
+		VNICID:      vnic.ID,
+		IPAddress:   ip.String(),
+		DisplayName: getOCIPrivateIPName(ip),
+	}, nil); err != nil {
+		return fmt.Errorf("error assigning IP address %s to VNIC %s, err: %v", ip, vnic.ID, err)
+	}
+	return nil
+}
+
+func (o *OCI) AllowsMovePrivateIP() bool {
+	return false
+}
+
+func (o *OCI) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+	return nil
+}
+
+// ReleasePrivateIP deletes the secondary private IP, or IPv6 address, of ip
+// from the primary VNIC of the node's instance.
+func (o *OCI) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	_, vnic, err := o.getVNIC(ctx, node)
+	if err != nil {
+		return err
+	}
+	privateIP, err := o.getPrivateIP(ctx, vnic, ip)
+	if err != nil {
+		return err
+	}
+	if privateIP == nil {
+		return NonExistingIPError
+	}
+	// IPv6 addresses aren't primary, the ones of the node are kept.
+	for _, nodeIP := range nodeInternalIPs(node) {
+		if nodeIP.Equal(ip) {
+			return NonExistingIPError
+		}
+	}
+	return o.client.do(ctx, http.MethodDelete, getOCIPrivateIPPath(ip)+"/"+privateIP.ID, nil, nil, nil)
+}
+
+func (o *OCI) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, o.AssignPrivateIP)
+}
+
+func (o *OCI) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, o.ReleasePrivateIP)
+}
+
+// GetNodeEgressIPConfiguration returns the configuration of the primary VNIC
+// of the node's instance, keyed by OCID. Its capacity is the limit of the
+// shape of the instance but the addresses assigned, for each address family.
+func (o *OCI) GetNodeEgressIPConfiguration(ctx context.Context, node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
+	instance, vnic, err := o.getVNIC(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	subnet := &ociSubnet{}
+	if err := o.client.do(ctx, http.MethodGet, "/subnets/"+vnic.SubnetID, nil, nil, subnet); err != nil {
+		return nil, fmt.Errorf("error retrieving subnet %s, err: %v", vnic.SubnetID, err)
+	}
+	config := &NodeEgressIPConfiguration{
+		Interface: vnic.ID,
+		MAC:       normalizeMAC(vnic.MacAddress),
+	}
+	limit := o.getShapeIPLimit(instance.Shape)
+	if subnet.CIDRBlock != "" {
+		_, cidr, err := net.ParseCIDR(subnet.CIDRBlock)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the CIDR %q of subnet %s, err: %v", subnet.CIDRBlock, subnet.ID, err)
+		}
+		privateIPs, err := o.listPrivateIPs(ctx, vnic, "/privateIps")
+		if err != nil {
+			return nil, err
+		}
+		secondaryIPs := 0
+		for _, privateIP := range privateIPs {
+			if !privateIP.IsPrimary {
+				secondaryIPs++
+			}
+		}
+		config.IFAddr.IPv4 = cidr.String()
+		config.Capacity.IPv4 = limit - secondaryIPs
+	}
+	// Subnets may have several IPv6 prefixes, the first one is reported as
+	// the other providers report a single one.
+	if len(subnet.IPv6CIDRBlocks) > 0 {
+		_, cidr, err := net.ParseCIDR(subnet.IPv6CIDRBlocks[0])
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the IPv6 CIDR %q of subnet %s, err: %v", subnet.IPv6CIDRBlocks[0], subnet.ID, err)
+		}
+		ipv6s, err := o.listPrivateIPs(ctx, vnic, "/ipv6")
+		if err != nil {
+			return nil, err
+		}
+		config.IFAddr.IPv6 = cidr.String()
+		config.Capacity.IPv6 = limit - len(ipv6s)
+	}
+	if config.Capacity.IPv4 < 0 {
+		config.Capacity.IPv4 = 0
+	}
+	if config.Capacity.IPv6 < 0 {
+		config.Capacity.IPv6 = 0
+	}
+	return []*NodeEgressIPConfiguration{config}, nil
+}
+
+// CleanupNode is a no-op, private IPs are deleted together with the VNIC of
+// the instance.
+func (o *OCI) CleanupNode(ctx context.Context, node *corev1.Node) error {
+	return nil
+}
+
+// VerifyPrivateIP verifies that ip is still assigned to the primary VNIC of
+// the node's instance, wrapping a MissingIPError otherwise.
+func (o *OCI) VerifyPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	_, vnic, err := o.getVNIC(ctx, node)
+	if err != nil {
+		return err
+	}
+	privateIP, err := o.getPrivateIP(ctx, vnic, ip)
+	if err != nil {
+		return err
+	}
+	if privateIP == nil {
+		return fmt.Errorf("%w: IP address %s is not assigned to VNIC %s", MissingIPError, ip, vnic.ID)
+	}
+	return nil
+}
+
+// GetPrivateIPReservations returns the private IP, or IPv6 address, of ip.
+func (o *OCI) GetPrivateIPReservations(ctx context.Context, ip net.IP, node *corev1.Node) ([]PrivateIPReservation, error) {
+	_, vnic, err := o.getVNIC(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	privateIP, err := o.getPrivateIP(ctx, vnic, ip)
+	if err != nil || privateIP == nil {
+		return nil, err
+	}
+	return []PrivateIPReservation{{ID: privateIP.ID, Subnet: vnic.SubnetID}}, nil
+}
+
+// GetNodeNetworkInterfaces returns nil, the primary VNIC of an instance can't
+// be replaced.
+func (o *OCI) GetNodeNetworkInterfaces(ctx context.Context, node *corev1.Node) ([]string, error) {
+	return nil, nil
+}
+
+// ListPrivateIPs returns the secondary private IPs and the IPv6 addresses of
+// the node's primary VNIC.
+func (o *OCI) ListPrivateIPs(ctx context.Context, node *corev1.Node) ([]net.IP, error) {
+	_, vnic, err := o.getVNIC(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	ips := []net.IP{}
+	for _, path := range []string{"/privateIps", "/ipv6"} {
+		privateIPs, err := o.listPrivateIPs(ctx, vnic, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, privateIP := range privateIPs {
+			if !privateIP.IsPrimary {
+				ips = append(ips, ParseIP(privateIP.IPAddress))
+			}
+		}
+	}
+	return ips, nil
+}
+
+// CheckHealth retrieves the primary VNIC of the node's instance.
+func (o *OCI) CheckHealth(ctx context.Context, node *corev1.Node) error {
+	_, _, err := o.getVNIC(ctx, node)
+	return err
+}
+
+// getVNIC returns the node's instance and its primary VNIC, out of the VNICs
+// attached to it.
+func (o *OCI) getVNIC(ctx context.Context, node *corev1.Node) (*ociInstance, *ociVNIC, error) {
+	instanceID, err := getOCIInstanceID(node)
+	if err != nil {
+		return nil, nil, err
+	}
+	instance := &ociInstance{}
+	if err := o.client.do(ctx, http.MethodGet, "/instances/"+instanceID, nil, nil, instance); err != nil {
+		return nil, nil, fmt.Errorf("error retrieving instance %s of node %s, err: %v", instanceID, node.Name, err)
+	}
+	attachments := []ociVNICAttachment{}
+	if err := o.client.do(ctx, http.MethodGet, "/vnicAttachments", url.Values{
+		"compartmentId": {instance.CompartmentID},
+		"instanceId":    {instanceID},
+	}, nil, &attachments); err != nil {
+		return nil, nil, fmt.Errorf("error retrieving the VNIC attachments of instance %s of node %s, err: %v", instanceID, node.Name, err)
+	}
+	for _, attachment := range attachments {
+		if attachment.LifecycleState != "ATTACHED" {
+			continue
+		}
+		vnic := &ociVNIC{}
+		if err := o.client.do(ctx, http.MethodGet, "/vnics/"+attachment.VNICID, nil, nil, vnic); err != nil {
+			return nil, nil, fmt.Errorf("error retrieving VNIC %s of node %s, err: %v", attachment.VNICID, node.Name, err)
+		}
+		if vnic.IsPrimary {
+			return instance, vnic, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("%w: instance %s of node %s has no primary VNIC attached", NoNetworkInterfaceError, instanceID, node.Name)
+}
+
+// getPrivateIP returns the private IP, or IPv6 address, of ip assigned to the
+// VNIC, nil if there's none or ip is its primary private IP.
+func (o *OCI) getPrivateIP(ctx context.Context, vnic *ociVNIC, ip net.IP) (*ociPrivateIP, error) {
+	privateIPs, err := o.listPrivateIPs(ctx, vnic, getOCIPrivateIPPath(ip))
+	if err != nil {
+		return nil, err
+	}
+	for _, privateIP := range privateIPs {
+		if !privateIP.IsPrimary && ParseIP(privateIP.IPAddress).Equal(ip) {
+			return &privateIP, nil
+		}
+	}
+	return nil, nil
+}
+
+// listPrivateIPs returns the private IPs, at /privateIps, or IPv6 addresses,
+// at /ipv6, of the VNIC. A VNIC holds fewer than a page of them.
+func (o *OCI) listPrivateIPs(ctx context.Context, vnic *ociVNIC, path string) ([]ociPrivateIP, error) {
+	privateIPs := []ociPrivateIP{}
+	if err := o.client.do(ctx, http.MethodGet, path, url.Values{"vnicId": {vnic.ID}, "limit": {"100"}}, nil, &privateIPs); err != nil {
+		return nil, fmt.Errorf("error retrieving the addresses of VNIC %s, err: %v", vnic.ID, err)
+	}
+	return privateIPs, nil
+}
+
+// getShapeIPLimit returns the number of addresses of each address family the
+// VNICs of instances of the shape can hold.
+func (o *OCI) getShapeIPLimit(shape string) int {
+	if limit, ok := o.shapeIPLimits[shape]; ok {
+		return limit
+	}
+	return ociMaxIPsPerVNIC
+}
+
+// parseOCIShapeIPLimits parses the comma separated <shape>=<limit> pairs of
+// -platform-oci-shape-ip-limits.
+func parseOCIShapeIPLimits(s string) (map[string]int, error) {
+	limits := map[string]int{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid OCI shape IP limit %q, expected <shape>=<limit>", pair)
+		}
+		limit, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid OCI shape IP limit %q, expected a non-negative number of addresses", pair)
+		}
+		limits[strings.TrimSpace(parts[0])] = limit
+	}
+	return limits, nil
+}
+
+// getOCIPrivateIPPath returns the path of the private IPs of the address
+// family of ip: IPv6 addresses are resources of their own.
+func getOCIPrivateIPPath(ip net.IP) string {
+	if utilnet.IsIPv6(ip) {
+		return "/ipv6"
+	}
+	return "/privateIps"
+}
+
+// getOCIPrivateIPName returns the display name of the private IP of ip, e.g.
+// egress-ip-10-0-0-10.
+func getOCIPrivateIPName(ip net.IP) string {
+	return "egress-ip-" + strings.NewReplacer(".", "-", ":", "-").Replace(ip.String())
+}
+
+// getOCIInstanceID returns the OCID of the node's instance, out of its
+// providerID, which looks like oci://<instance OCID>, or is the OCID itself.
+func getOCIInstanceID(node *corev1.Node) (string, error) {
+	instanceID := strings.TrimPrefix(node.Spec.ProviderID, "oci://")
+	if !strings.HasPrefix(instanceID, "ocid1.instance.") {
+		return "", fmt.Errorf("failed to parse node %s provider id %q, expected oci://<instance OCID>", node.Name, node.Spec.ProviderID)
+	}
+	return instanceID, nil
+}
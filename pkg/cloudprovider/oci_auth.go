@@ -0,0 +1,325 @@
+package cloudprovider
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ociDefaultMetadataURL is the instance metadata service the certificate
+	// of the instance principal is retrieved from.
+	ociDefaultMetadataURL = "http://169.254.169.254/opc/v2"
+	// ociTokenRefreshMargin is how long before their expiration the security
+	// tokens of the instance principal are refreshed.
+	ociTokenRefreshMargin = 5 * time.Minute
+)
+
+// ociAPIKey signs requests with the API signing key of a user.
+type ociAPIKey struct {
+	// keyID is <tenancy OCID>/<user OCID>/<key fingerprint>.
+	keyID string
+	key   *rsa.PrivateKey
+}
+
+func (k *ociAPIKey) authorize(r *http.Request) error {
+	return signOCIRequest(r, k.keyID, k.key)
+}
+
+// ociInstancePrincipal signs requests as the instance the controller runs on,
+// which needs to be part of a dynamic group granted the policies. The
+// certificate of the instance, from the instance metadata service, is
+// exchanged at the authentication service for a security token, bound to a
+// session key of our own, which is refreshed shortly before it expires.
+type ociInstancePrincipal struct {
+	httpClient  *http.Client
+	metadataURL string
+	// authURL is the authentication service of the region, e.g.
+	// https://auth.us-ashburn-1.oraclecloud.com.
+	authURL string
+
+	mu         sync.Mutex
+	token      string
+	sessionKey *rsa.PrivateKey
+	expires    time.Time
+}
+
+func newOCIInstancePrincipal(httpClient *http.Client, metadataURL, authURL string) *ociInstancePrincipal {
+	if metadataURL == "" {
+		metadataURL = ociDefaultMetadataURL
+	}
+	return &ociInstancePrincipal{
+		httpClient:  httpClient,
+		metadataURL: strings.TrimSuffix(metadataURL, "/"),
+		authURL:     strings.TrimSuffix(authURL, "/"),
+	}
+}
+
+func (p *ociInstancePrincipal) authorize(r *http.Request) error {
+	token, sessionKey, err := p.getToken(r)
+	if err != nil {
+		return err
+	}
+	return signOCIRequest(r, "ST$"+token, sessionKey)
+}
+
+func (p *ociInstancePrincipal) getToken(r *http.Request) (string, *rsa.PrivateKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != "" && time.Now().Add(ociTokenRefreshMargin).Before(p.expires) {
+		return p.token, p.sessionKey, nil
+	}
+	leafCert, err := p.getMetadata(r, "/identity/cert.pem")
+	if err != nil {
+		return "", nil, err
+	}
+	leafKey, err := p.getMetadata(r, "/identity/key.pem")
+	if err != nil {
+		return "", nil, err
+	}
+	intermediateCert, err := p.getMetadata(r, "/identity/intermediate.pem")
+	if err != nil {
+		return "", nil, err
+	}
+	cert, err := parseOCICertificate(leafCert)
+	if err != nil {
+		return "", nil, err
+	}
+	tenancyID := getOCICertificateTenancy(cert)
+	if tenancyID == "" {
+		return "", nil, fmt.Errorf("the OCI instance certificate names no tenancy")
+	}
+	key, err := parseOCIPrivateKey(leafKey)
+	if err != nil {
+		return "", nil, err
+	}
+	sessionKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", nil, err
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&sessionKey.PublicKey)
+	if err != nil {
+		return "", nil, err
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"certificate":              getOCIPEMContent(leafCert),
+		"publicKey":                getOCIPEMContent(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})),
+		"intermediateCertificates": []string{getOCIPEMContent(intermediateCert)},
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, p.authURL+"/v1/x509", bytes.NewReader(body))
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if err := signOCIRequest(req, tenancyID+"/fed-x509/"+getOCIFingerprint(cert.Raw), key); err != nil {
+		return "", nil, err
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("error requesting an OCI security token, err: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("error requesting an OCI security token: StatusCode=%d %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	var token struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(respBody, &token); err != nil || token.Token == "" {
+		return "", nil, fmt.Errorf("error decoding the OCI security token, err: %v", err)
+	}
+	expires, err := getOCITokenExpiration(token.Token)
+	if err != nil {
+		return "", nil, err
+	}
+	p.token, p.sessionKey, p.expires = token.Token, sessionKey, expires
+	return p.token, p.sessionKey, nil
+}
+
+// getMetadata returns the document at path of the instance metadata service.
+func (p *ociInstancePrincipal) getMetadata(r *http.Request, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, p.metadataURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Version 2 of the instance metadata service requires this header, which
+	// requests forwarded by a server side request forgery don't carry.
+	req.Header.Set("Authorization", "Bearer Oracle")
+	// The instance metadata service is link-local: it must not be reached
+	// through the proxy of the cluster.
+	resp, err := (&http.Client{Timeout: restRequestTimeout}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving %s from the OCI instance metadata service, err: %v", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error retrieving %s from the OCI instance metadata service: StatusCode=%d %s", path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// signOCIRequest signs the request as the OCI APIs require, with version 1 of
+// the HTTP signatures draft: the date, target and host of every request, and
+// the length, type and SHA-256 digest of the body of the ones which have one,
+// are signed with RSA-SHA256.
+func signOCIRequest(r *http.Request, keyID string, key *rsa.PrivateKey) error {
+	r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	target := r.URL.EscapedPath()
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	headers := []string{"date", "(request-target)", "host"}
+	lines := []string{
+		"date: " + r.Header.Get("Date"),
+		"(request-target): " + strings.ToLower(r.Method) + " " + target,
+		"host: " + host,
+	}
+	if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch {
+		var body []byte
+		if r.GetBody != nil {
+			bodyReader, err := r.GetBody()
+			if err != nil {
+				return err
+			}
+			if body, err = ioutil.ReadAll(bodyReader); err != nil {
+				return err
+			}
+		}
+		digest := sha256.Sum256(body)
+		if r.Header.Get("Content-Type") == "" {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		r.Header.Set("Content-Length", fmt.Sprint(len(body)))
+		r.Header.Set("X-Content-Sha256", base64.StdEncoding.EncodeToString(digest[:]))
+		headers = append(headers, "content-length", "content-type", "x-content-sha256")
+		lines = append(lines,
+			"content-length: "+r.Header.Get("Content-Length"),
+			"content-type: "+r.Header.Get("Content-Type"),
+			"x-content-sha256: "+r.Header.Get("X-Content-Sha256"),
+		)
+	}
+	digest := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return fmt.Errorf("error signing the OCI request, err: %v", err)
+	}
+	r.Header.Set("Authorization", fmt.Sprintf(`Signature version="1",keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyID, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(signature)))
+	return nil
+}
+
+// parseOCIPrivateKey parses an unencrypted PEM encoded RSA private key, in
+// PKCS #1 or PKCS #8 format.
+func parseOCIPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded OCI private key found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the OCI private key, encrypted keys aren't supported, err: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("the OCI private key is no RSA key")
+	}
+	return rsaKey, nil
+}
+
+func parseOCICertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded OCI instance certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// getOCICertificateTenancy returns the OCID of the tenancy of the instance,
+// which its certificate names as opc-tenant:<OCID>, or opc-identity:<OCID>.
+func getOCICertificateTenancy(cert *x509.Certificate) string {
+	for _, unit := range cert.Subject.OrganizationalUnit {
+		if strings.HasPrefix(unit, "opc-tenant:") {
+			return strings.TrimPrefix(unit, "opc-tenant:")
+		}
+	}
+	for _, organization := range cert.Subject.Organization {
+		if strings.HasPrefix(organization, "opc-identity:") {
+			return strings.TrimPrefix(organization, "opc-identity:")
+		}
+	}
+	return ""
+}
+
+// getOCIFingerprint returns the SHA-1 fingerprint of the DER encoded
+// certificate, as colon separated hexadecimal bytes.
+func getOCIFingerprint(der []byte) string {
+	sum := sha1.Sum(der)
+	octets := make([]string, len(sum))
+	for i, b := range sum {
+		octets[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(octets, ":")
+}
+
+// getOCIPEMContent returns the base64 content of the PEM document, without its
+// boundaries and line breaks, as the authentication service expects it.
+func getOCIPEMContent(data []byte) string {
+	var content []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "-----") {
+			content = append(content, line)
+		}
+	}
+	return strings.Join(content, "")
+}
+
+// getOCITokenExpiration returns the expiration of the security token, a JWT.
+func getOCITokenExpiration(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("the OCI security token is no JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error decoding the OCI security token, err: %v", err)
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, fmt.Errorf("error decoding the expiration of the OCI security token, err: %v", err)
+	}
+	return time.Unix(claims.Exp, 0), nil
+}
@@ -0,0 +1,422 @@
+package cloudprovider
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// verifyOCISignature returns nil if the request is signed by keyID with the
+// private key of publicKey.
+func verifyOCISignature(r *http.Request, keyID string, publicKey *rsa.PublicKey) error {
+	params := map[string]string{}
+	for _, param := range strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Signature "), ",") {
+		parts := strings.SplitN(param, "=", 2)
+		if len(parts) == 2 {
+			params[parts[0]] = strings.Trim(parts[1], `"`)
+		}
+	}
+	if params["keyId"] != keyID || params["algorithm"] != "rsa-sha256" {
+		return fmt.Errorf("unexpected signature parameters %v", params)
+	}
+	var lines []string
+	for _, header := range strings.Split(params["headers"], " ") {
+		switch header {
+		case "(request-target)":
+			lines = append(lines, header+": "+strings.ToLower(r.Method)+" "+r.URL.RequestURI())
+		case "host":
+			lines = append(lines, header+": "+r.Host)
+		default:
+			lines = append(lines, header+": "+r.Header.Get(header))
+		}
+	}
+	if r.Method == http.MethodPost {
+		if !strings.Contains(params["headers"], "x-content-sha256") {
+			return fmt.Errorf("the body isn't signed")
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		r.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+		digest := sha256.Sum256(body)
+		if r.Header.Get("X-Content-Sha256") != base64.StdEncoding.EncodeToString(digest[:]) {
+			return fmt.Errorf("unexpected body digest")
+		}
+	}
+	signature, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature)
+}
+
+// fakeOCI serves the Core Services API requests of instance ocid1.instance.a,
+// whose primary VNIC ocid1.vnic.a is attached after a secondary one.
+type fakeOCI struct {
+	mu         sync.Mutex
+	keyID      string
+	publicKey  *rsa.PublicKey
+	privateIPs []ociPrivateIP
+	ipv6s      []ociPrivateIP
+	ids        int
+}
+
+func (f *fakeOCI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := verifyOCISignature(r, f.keyID, f.publicKey); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"code": "NotAuthenticated", "message": "` + err.Error() + `"}`))
+		return
+	}
+	list := func(privateIPs []ociPrivateIP) {
+		if r.URL.Query().Get("vnicId") != "ocid1.vnic.a" {
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(privateIPs)
+	}
+	create := func(privateIPs *[]ociPrivateIP) {
+		privateIP := ociPrivateIP{}
+		if err := json.NewDecoder(r.Body).Decode(&privateIP); err != nil || privateIP.VNICID != "ocid1.vnic.a" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, existing := range *privateIPs {
+			if existing.IPAddress == privateIP.IPAddress {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+		}
+		f.ids++
+		privateIP.ID = fmt.Sprintf("ocid1.privateip.%d", f.ids)
+		*privateIPs = append(*privateIPs, privateIP)
+		_ = json.NewEncoder(w).Encode(privateIP)
+	}
+	remove := func(privateIPs *[]ociPrivateIP, id string) {
+		for i, privateIP := range *privateIPs {
+			if privateIP.ID == id {
+				*privateIPs = append((*privateIPs)[:i], (*privateIPs)[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/20160918/instances/ocid1.instance.a":
+		_, _ = w.Write([]byte(`{"id": "ocid1.instance.a", "compartmentId": "ocid1.compartment.a", "shape": "VM.Standard.E4.Flex"}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/20160918/vnicAttachments":
+		if r.URL.Query().Get("compartmentId") != "ocid1.compartment.a" || r.URL.Query().Get("instanceId") != "ocid1.instance.a" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`[
+			{"id": "ocid1.vnicattachment.c", "vnicId": "ocid1.vnic.c", "lifecycleState": "DETACHED"},
+			{"id": "ocid1.vnicattachment.b", "vnicId": "ocid1.vnic.b", "lifecycleState": "ATTACHED"},
+			{"id": "ocid1.vnicattachment.a", "vnicId": "ocid1.vnic.a", "lifecycleState": "ATTACHED"}
+		]`))
+	case r.Method == http.MethodGet && r.URL.Path == "/20160918/vnics/ocid1.vnic.a":
+		_, _ = w.Write([]byte(`{"id": "ocid1.vnic.a", "subnetId": "ocid1.subnet.a", "macAddress": "02:00:17:00:00:0A", "isPrimary": true}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/20160918/vnics/ocid1.vnic.b":
+		_, _ = w.Write([]byte(`{"id": "ocid1.vnic.b", "subnetId": "ocid1.subnet.b", "macAddress": "02:00:17:00:00:0B", "isPrimary": false}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/20160918/subnets/ocid1.subnet.a":
+		_, _ = w.Write([]byte(`{"id": "ocid1.subnet.a", "cidrBlock": "10.0.0.0/24", "ipv6CidrBlocks": ["2603:c020::/64"]}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/20160918/privateIps":
+		list(f.privateIPs)
+	case r.Method == http.MethodGet && r.URL.Path == "/20160918/ipv6":
+		list(f.ipv6s)
+	case r.Method == http.MethodPost && r.URL.Path == "/20160918/privateIps":
+		create(&f.privateIPs)
+	case r.Method == http.MethodPost && r.URL.Path == "/20160918/ipv6":
+		create(&f.ipv6s)
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/20160918/privateIps/"):
+		remove(&f.privateIPs, strings.TrimPrefix(r.URL.Path, "/20160918/privateIps/"))
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/20160918/ipv6/"):
+		remove(&f.ipv6s, strings.TrimPrefix(r.URL.Path, "/20160918/ipv6/"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newOCITestKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("received unexpected error generating a key, err: %v", err)
+	}
+	return key
+}
+
+func newFakeOCI(t *testing.T) (*fakeOCI, *httptest.Server, *OCI) {
+	key := newOCITestKey(t)
+	fake := &fakeOCI{
+		keyID:      "ocid1.tenancy.a/ocid1.user.a/aa:bb",
+		publicKey:  &key.PublicKey,
+		privateIPs: []ociPrivateIP{{ID: "ocid1.privateip.0", VNICID: "ocid1.vnic.a", IPAddress: "10.0.0.10", IsPrimary: true}},
+	}
+	server := httptest.NewServer(fake)
+	provider := &OCI{
+		CloudProvider: CloudProvider{ctx: context.Background()},
+		client: &restClient{
+			httpClient: server.Client(),
+			baseURL:    server.URL + "/20160918",
+			authorize:  (&ociAPIKey{keyID: fake.keyID, key: key}).authorize,
+		},
+		shapeIPLimits: map[string]int{},
+	}
+	return fake, server, provider
+}
+
+func newOCINode() *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0"},
+		Spec:       corev1.NodeSpec{ProviderID: "oci://ocid1.instance.a"},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.10"}},
+		},
+	}
+}
+
+// newOCIFakeCloud plugs the fake API into the tests shared by the clouds.
+func newOCIFakeCloud(t *testing.T) *fakeCloud {
+	fake, server, provider := newFakeOCI(t)
+	return &fakeCloud{
+		CloudProviderIntf: provider,
+		assigned: func() []string {
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			ips := []string{}
+			for _, privateIP := range append(fake.privateIPs, fake.ipv6s...) {
+				if !privateIP.IsPrimary {
+					ips = append(ips, privateIP.IPAddress)
+				}
+			}
+			return ips
+		},
+		close: server.Close,
+	}
+}
+
+func TestOCIAssignPrivateIP(t *testing.T) {
+	tcs := []struct {
+		ip         string
+		providerID string
+		expectErr  bool
+	}{
+		{ip: "10.0.0.20"},
+		{ip: "10.0.0.20", providerID: "aws:///us-east-1a/i-0", expectErr: true},
+	}
+	for i, tc := range tcs {
+		fake, server, provider := newFakeOCI(t)
+		node := newOCINode()
+		if tc.providerID != "" {
+			node.Spec.ProviderID = tc.providerID
+		}
+		err := provider.AssignPrivateIP(context.Background(), net.ParseIP(tc.ip), node)
+		server.Close()
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestOCIAssignPrivateIP(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		if tc.expectErr {
+			continue
+		}
+		assigned := false
+		for _, privateIP := range append(fake.privateIPs, fake.ipv6s...) {
+			if privateIP.IPAddress == tc.ip && privateIP.DisplayName == getOCIPrivateIPName(net.ParseIP(tc.ip)) {
+				assigned = true
+			}
+		}
+		if !assigned {
+			t.Fatalf("TestOCIAssignPrivateIP(%d): expected IP address %s to be assigned, got %v and %v", i, tc.ip, fake.privateIPs, fake.ipv6s)
+		}
+	}
+}
+
+func TestOCICapacity(t *testing.T) {
+	tcs := []struct {
+		shapeIPLimits    map[string]int
+		expectedCapacity capacity
+	}{
+		{shapeIPLimits: map[string]int{"VM.Standard.E4.Flex": 16}, expectedCapacity: capacity{IPv4: 15, IPv6: 16}},
+		{shapeIPLimits: map[string]int{"VM.Standard.E4.Flex": 0}, expectedCapacity: capacity{}},
+		{shapeIPLimits: map[string]int{"VM.Standard2.1": 2}, expectedCapacity: capacity{IPv4: ociMaxIPsPerVNIC - 1, IPv6: ociMaxIPsPerVNIC}},
+	}
+	for i, tc := range tcs {
+		fake, server, provider := newFakeOCI(t)
+		fake.privateIPs = append(fake.privateIPs, ociPrivateIP{ID: "ocid1.privateip.1", VNICID: "ocid1.vnic.a", IPAddress: "10.0.0.20"})
+		if tc.shapeIPLimits != nil {
+			provider.shapeIPLimits = tc.shapeIPLimits
+		}
+		configs, err := provider.GetNodeEgressIPConfiguration(context.Background(), newOCINode())
+		server.Close()
+		if err != nil {
+			t.Fatalf("TestOCICapacity(%d): received unexpected error, err: %v", i, err)
+		}
+		expected := NodeEgressIPConfiguration{
+			Interface: "ocid1.vnic.a",
+			IFAddr:    ifAddr{IPv4: "10.0.0.0/24", IPv6: "2603:c020::/64"},
+			Capacity:  tc.expectedCapacity,
+			MAC:       "02:00:17:00:00:0a",
+		}
+		if len(configs) != 1 || configs[0].Interface != expected.Interface || configs[0].IFAddr != expected.IFAddr ||
+			configs[0].Capacity != expected.Capacity || configs[0].MAC != expected.MAC {
+			t.Fatalf("TestOCICapacity(%d): expected configuration %+v, got %+v", i, expected, configs)
+		}
+	}
+}
+
+func TestOCIInstancePrincipal(t *testing.T) {
+	leafKey := newOCITestKey(t)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ocid1.instance.a", OrganizationalUnit: []string{"opc-certtype:instance", "opc-tenant:ocid1.tenancy.a"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	leafCert, err := x509.CreateCertificate(rand.Reader, template, template, &leafKey.PublicKey, leafKey)
+	if err != nil {
+		t.Fatalf("received unexpected error creating a certificate, err: %v", err)
+	}
+	leafCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafCert})
+
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer Oracle" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/opc/v2/identity/cert.pem", "/opc/v2/identity/intermediate.pem":
+			_, _ = w.Write(leafCertPEM)
+		case "/opc/v2/identity/key.pem":
+			_, _ = w.Write(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(leafKey)}))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer metadata.Close()
+
+	fake := &fakeOCI{}
+	api := httptest.NewServer(fake)
+	defer api.Close()
+
+	tokens := 0
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := verifyOCISignature(r, "ocid1.tenancy.a/fed-x509/"+getOCIFingerprint(leafCert), &leafKey.PublicKey); err != nil || r.URL.Path != "/v1/x509" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var request struct {
+			Certificate string `json:"certificate"`
+			PublicKey   string `json:"publicKey"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Certificate != base64.StdEncoding.EncodeToString(leafCert) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		publicKey, err := base64.StdEncoding.DecodeString(request.PublicKey)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		sessionKey, err := x509.ParsePKIXPublicKey(publicKey)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		claims, _ := json.Marshal(map[string]int64{"exp": time.Now().Add(20 * time.Minute).Unix()})
+		token := fmt.Sprintf("e30.%s.c2lnbmF0dXJl", base64.RawURLEncoding.EncodeToString(claims))
+		fake.mu.Lock()
+		fake.keyID, fake.publicKey = "ST$"+token, sessionKey.(*rsa.PublicKey)
+		tokens++
+		fake.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": token})
+	}))
+	defer auth.Close()
+
+	provider := &OCI{
+		CloudProvider: CloudProvider{ctx: context.Background()},
+		client: &restClient{
+			httpClient: api.Client(),
+			baseURL:    api.URL + "/20160918",
+			authorize:  newOCIInstancePrincipal(auth.Client(), metadata.URL+"/opc/v2", auth.URL).authorize,
+		},
+	}
+	ip := net.ParseIP("10.0.0.20")
+	if err := provider.AssignPrivateIP(context.Background(), ip, newOCINode()); err != nil {
+		t.Fatalf("received unexpected error assigning IP address, err: %v", err)
+	}
+	if err := provider.VerifyPrivateIP(context.Background(), ip, newOCINode()); err != nil {
+		t.Fatalf("received unexpected error verifying IP address, err: %v", err)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if tokens != 1 {
+		t.Fatalf("expected a single security token to be requested, got %d", tokens)
+	}
+}
+
+func TestParseOCIShapeIPLimits(t *testing.T) {
+	tcs := []struct {
+		shapeIPLimits string
+		expected      map[string]int
+		expectErr     bool
+	}{
+		{shapeIPLimits: "", expected: map[string]int{}},
+		{shapeIPLimits: "VM.Standard.E4.Flex=16, BM.Standard3.64=8", expected: map[string]int{"VM.Standard.E4.Flex": 16, "BM.Standard3.64": 8}},
+		{shapeIPLimits: "VM.Standard.E4.Flex", expectErr: true},
+		{shapeIPLimits: "VM.Standard.E4.Flex=-1", expectErr: true},
+	}
+	for i, tc := range tcs {
+		limits, err := parseOCIShapeIPLimits(tc.shapeIPLimits)
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestParseOCIShapeIPLimits(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		if !tc.expectErr && fmt.Sprint(limits) != fmt.Sprint(tc.expected) {
+			t.Fatalf("TestParseOCIShapeIPLimits(%d): expected limits %v, got %v", i, tc.expected, limits)
+		}
+	}
+}
+
+func TestGetOCIInstanceID(t *testing.T) {
+	tcs := []struct {
+		providerID string
+		expected   string
+		expectErr  bool
+	}{
+		{providerID: "oci://ocid1.instance.oc1.iad.abc", expected: "ocid1.instance.oc1.iad.abc"},
+		{providerID: "ocid1.instance.oc1.iad.abc", expected: "ocid1.instance.oc1.iad.abc"},
+		{providerID: "oci://ocid1.volume.oc1.iad.abc", expectErr: true},
+		{providerID: "", expectErr: true},
+	}
+	for i, tc := range tcs {
+		instanceID, err := getOCIInstanceID(&corev1.Node{Spec: corev1.NodeSpec{ProviderID: tc.providerID}})
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestGetOCIInstanceID(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		if !tc.expectErr && instanceID != tc.expected {
+			t.Fatalf("TestGetOCIInstanceID(%d): expected instance ID %q, got %q", i, tc.expected, instanceID)
+		}
+	}
+}
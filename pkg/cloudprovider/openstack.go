@@ -1,6 +1,7 @@
 package cloudprovider
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
@@ -11,21 +12,35 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/availabilityzones"
 	novaservers "github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/attributestags"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/external"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/provider"
+	neutronnetworks "github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
 	neutronports "github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
 	neutronsubnets "github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
 	"github.com/gophercloud/gophercloud/pagination"
 	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/openshift/cloud-network-config-controller/pkg/journal"
+	"github.com/openshift/cloud-network-config-controller/pkg/tracing"
 	"gopkg.in/yaml.v2"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 	utilnet "k8s.io/utils/net"
 )
@@ -38,6 +53,11 @@ const (
 	egressIPTag             = "OpenShiftEgressIP"
 	novaDeviceOwner         = "compute:nova"
 
+	// openstackStandbyTagPrefix prefixes the tags of a reservation port
+	// recording the standby servers its IP address is pre-allowed on, which
+	// are 53 characters long, below neutron's limit of 60.
+	openstackStandbyTagPrefix = "egressip-standby-"
+
 	// NOTE: Capacity is defined on a per interface basis as:
 	// - IP address capacity for each node, where the capacity is either IP family
 	//   agnostic or not.
@@ -46,6 +66,39 @@ const (
 	// Should customers run into this ceiling, there should be no issue to raise it
 	// in the future.
 	openstackMaxCapacity = 64
+
+	// OpenStackReleaseServerIDsAnnotation can be set by admins on a node to a
+	// comma separated list of nova server IDs. Reservation ports whose DeviceID
+	// points at one of those servers - instead of the node's current server -
+	// are then released as well, as long as the servers don't exist anymore.
+	// This allows recovering from instance replacement without cleaning up
+	// the reservation ports by hand.
+	OpenStackReleaseServerIDsAnnotation = "cloud.network.openshift.io/openstack-release-server-ids"
+
+	// OpenStackServerIDAnnotation can be set on a node to the ID of its nova
+	// server, e.g. by an agent reading the instance UUID from the config drive
+	// or the metadata service. It's used as long as the node's providerID
+	// isn't set.
+	OpenStackServerIDAnnotation = "cloud.network.openshift.io/openstack-server-id"
+
+	// OpenStackStandbyServerAnnotation can be set on a node to the ID of the
+	// nova server of another node, its standby. With standby assignments
+	// enabled, egress IPs assigned to the node are also allowed on the standby
+	// server's port, so that moving them to the standby node is immediate.
+	OpenStackStandbyServerAnnotation = "cloud.network.openshift.io/openstack-standby-server-id"
+
+	// OpenStackPortSecurityDisabledPolicyFail makes assignments on networks with
+	// port security disabled fail.
+	OpenStackPortSecurityDisabledPolicyFail = "fail"
+	// OpenStackPortSecurityDisabledPolicySkip makes assignments on networks with
+	// port security disabled only reserve the IP address, without adding it to
+	// allowed_address_pairs.
+	OpenStackPortSecurityDisabledPolicySkip = "skip"
+
+	// OpenStackPinnedSubnetTag can be set by admins on one of several subnets of
+	// the same address family on a network, to make it the subnet reported in
+	// the egress IP configuration of nodes attached to the network.
+	OpenStackPinnedSubnetTag = "openshift-egress-ip-subnet"
 )
 
 // OpenStack implements the API wrapper for talking
@@ -54,6 +107,28 @@ type OpenStack struct {
 	CloudProvider
 	novaClient    *gophercloud.ServiceClient
 	neutronClient *gophercloud.ServiceClient
+	// octaviaClient adds the egress IPs to the verification pool, it's nil
+	// unless OpenStackVerificationPool is set.
+	octaviaClient *gophercloud.ServiceClient
+	// verificationLock serializes the member changes of the verification
+	// pool: Octavia refuses changes to its load balancer while a previous
+	// one is pending.
+	verificationLock sync.Mutex
+	// compensations holds the reservation ports which are released in the
+	// background, see enqueueCompensation.
+	compensations     workqueue.RateLimitingInterface
+	compensationsOnce sync.Once
+	// journal persists the pending releases across restarts, it's nil unless
+	// OpenStackJournalStore is set.
+	journal *journal.Journal
+	// serverLocks serializes the operations on the ports of each server. Those
+	// are read-modify-write cycles guarded by the ports' revision numbers, so
+	// concurrent operations on the same port would mostly conflict and retry.
+	// Operations on different servers still run in parallel.
+	serverLocks keyedMutex
+	// dnsIntegration is true if neutron has the dns-integration extension
+	// enabled, which allows setting dns_name on ports.
+	dnsIntegration bool
 }
 
 // initCredentials initializes the cloud API credentials by reading the
@@ -65,6 +140,13 @@ type OpenStack struct {
 func (o *OpenStack) initCredentials() error {
 	var err error
 
+	switch o.cfg.OpenStackPortSecurityDisabledPolicy {
+	case OpenStackPortSecurityDisabledPolicyFail, OpenStackPortSecurityDisabledPolicySkip:
+	default:
+		return fmt.Errorf("invalid policy for networks with port security disabled '%s', expected one of: %s, %s",
+			o.cfg.OpenStackPortSecurityDisabledPolicy, OpenStackPortSecurityDisabledPolicyFail, OpenStackPortSecurityDisabledPolicySkip)
+	}
+
 	// Read the clouds.yaml file.
 	// That information is stored in secret cloud-credentials.
 	clientConfigFile := filepath.Join(o.cfg.CredentialDir, "clouds.yaml")
@@ -84,24 +166,26 @@ func (o *OpenStack) initCredentials() error {
 	if !ok {
 		return fmt.Errorf("invalid clouds.yaml file. Missing section for cloud name '%s'", openstackCloudName)
 	}
+	var extra openstackCloudsExtra
+	if err := yaml.Unmarshal(content, &extra); err != nil {
+		return fmt.Errorf("could not parse cloud configuration from %s, err: %q", clientConfigFile, err)
+	}
+	systemScope := extra.Clouds[openstackCloudName].Auth.SystemScope
 
 	// Set AllowReauth to enable reauth when the token expires. Otherwise, we'll get endless ""Authentication failed"
 	// errors after the token expired.
 	// https://github.com/gophercloud/gophercloud/blob/a5d8e32ad107b1b72635a2e823ddd6c28fa0d4e7/auth_options.go#L70
 	// https://github.com/gophercloud/gophercloud/blob/513734676e6495f6fec60e7aaf1f86f1ce807428/openstack/client.go#L151
-	cloud.AuthInfo.AllowReauth = true
+	if cloud.AuthInfo != nil {
+		cloud.AuthInfo.AllowReauth = true
+	}
 
 	// Prepare the options.
-	clientOpts := &clientconfig.ClientOpts{
-		Cloud:      cloud.Cloud,
-		AuthType:   cloud.AuthType,
-		AuthInfo:   cloud.AuthInfo,
-		RegionName: cloud.RegionName,
-	}
-	opts, err := clientconfig.AuthOptions(clientOpts)
+	opts, err := openstackAuthOptions(&cloud, systemScope)
 	if err != nil {
 		return err
 	}
+	description := describeOpenStackAuth(cloud.AuthInfo, systemScope)
 	provider, err := openstack.NewClient(opts.IdentityEndpoint)
 	if err != nil {
 		return err
@@ -127,11 +211,28 @@ func (o *OpenStack) initCredentials() error {
 		klog.Infof("Could not find custom CA bundle in file '%s' - some environments require a custom CA to work correctly", caBundle)
 	}
 
-	// Now, authenticate.
-	err = openstack.Authenticate(provider, *opts)
+	// Trace the requests to keystone, neutron and nova.
+	transport := provider.HTTPClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	provider.HTTPClient.Transport = tracing.NewTransport(transport)
+
+	// Now, authenticate. Every call is bound to the controller's shutdown and
+	// to a timeout, see withTimeout, otherwise a hung endpoint would block a
+	// worker, and with that controller shutdown, forever. So is
+	// authentication, re-authentication included, see reauthenticate.
+	authCtx, cancel := o.requestContext(o.ctx)
+	provider.Context = authCtx
+	err = o.authenticate(provider, *opts)
+	cancel()
 	if err != nil {
+		return openstackAuthError(err, description)
+	}
+	if err := checkOpenStackCatalog(provider, description); err != nil {
 		return err
 	}
+	klog.Infof("Authenticated to OpenStack as %s", description)
 
 	// And create a client for nova (compute / servers).
 	o.novaClient, err = openstack.NewComputeV2(provider, gophercloud.EndpointOpts{
@@ -149,34 +250,58 @@ func (o *OpenStack) initCredentials() error {
 		return err
 	}
 
+	o.dnsIntegration = o.hasNeutronExtension(o.ctx, "dns-integration")
+
+	if o.cfg.OpenStackVerificationPool != "" {
+		if err := o.initVerificationPool(provider); err != nil {
+			return err
+		}
+	}
+
+	if o.cfg.OpenStackJournalStore != nil {
+		o.restoreCompensations()
+	}
+
 	return nil
 }
 
-func (o *OpenStack) findAssignSubnetAndPort(ip net.IP, node *corev1.Node) (*neutronsubnets.Subnet, *neutronports.Port, error) {
+// assignCandidate is a server port together with the subnet on the port's
+// network that an IP address fits inside.
+type assignCandidate struct {
+	subnet *neutronsubnets.Subnet
+	port   *neutronports.Port
+}
+
+func (o *OpenStack) findAssignSubnetAndPort(ctx context.Context, ip net.IP, node *corev1.Node) (*neutronsubnets.Subnet, *neutronports.Port, error) {
 	// List all ports that are attached to this server.
-	serverID, err := getNovaServerIDFromProviderID(node.Spec.ProviderID)
+	serverID, err := o.getNovaServerID(ctx, node)
 	if err != nil {
 		return nil, nil, err
 	}
-	serverPorts, err := o.listNovaServerPorts(serverID)
+	serverPorts, err := o.listNovaServerPorts(ctx, serverID)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// Loop over all ports that are attached to this nova instance and find the subnets
-	// that are attached to the port's network.
+	// If this IP address is already allowed on any of the ports (speak: part of allowed_address_pairs),
+	// then return an AlreadyExistingIPError and skip all further steps.
 	for _, serverPort := range serverPorts {
-		// If this IP address is already allowed on the port (speak: part of allowed_address_pairs),
-		// then return an AlreadyExistingIPError and skip all further steps.
 		if isIPAddressAllowedOnNeutronPort(serverPort, ip) {
 			// This is part of normal operation.
 			// Callers will likely ignore this and go on with their business logic and
 			// report success to the user.
 			return nil, nil, AlreadyExistingIPError
 		}
+	}
+
+	// Loop over all ports that are attached to this nova instance and find the subnets
+	// that are attached to the port's network.
+	var candidates []assignCandidate
+	for _, serverPort := range serverPorts {
+		serverPort := serverPort
 
 		// Get all subnets that are attached to this port.
-		subnets, err := o.getNeutronSubnetsForNetwork(serverPort.NetworkID)
+		subnets, err := o.getNeutronSubnetsForNetwork(ctx, serverPort.NetworkID)
 		if err != nil {
 			klog.Warningf("Could not find subnet information for network %s, err: %q", serverPort.NetworkID, err)
 			continue
@@ -215,12 +340,80 @@ func (o *OpenStack) findAssignSubnetAndPort(ip net.IP, node *corev1.Node) (*neut
 		}
 
 		if matchingSubnet != nil {
-			return matchingSubnet, &serverPort, nil
+			candidates = append(candidates, assignCandidate{subnet: matchingSubnet, port: &serverPort})
 		}
 	}
 
 	// 5) The IP address does not fit in any of the attached networks' subnets.
-	return nil, nil, fmt.Errorf("could not assign IP address %s to node %s", ip, node.Name)
+	if len(candidates) == 0 {
+		return nil, nil, fmt.Errorf("could not assign IP address %s to node %s", ip, node.Name)
+	}
+
+	candidate, err := o.selectAssignCandidate(ctx, ip, node, serverID, candidates)
+	if err != nil {
+		return nil, nil, err
+	}
+	return candidate.subnet, candidate.port, nil
+}
+
+// selectAssignCandidate picks the port and subnet an IP address is assigned to
+// when it fits on more than one of the server's ports. Networks can be scoped to
+// availability zones, and assigning the IP address on a network of another AZ
+// than the server's leads to asymmetric routing. Hence, networks in the server's
+// AZ are preferred over networks without AZ information, which in turn are
+// preferred over networks in other AZs. Amongst equals, the first port that was
+// found wins. If OpenStackStrictAZMatching is set, networks in other AZs are never
+// selected.
+func (o *OpenStack) selectAssignCandidate(ctx context.Context, ip net.IP, node *corev1.Node, serverID string, candidates []assignCandidate) (*assignCandidate, error) {
+	if len(candidates) == 1 && !o.cfg.OpenStackStrictAZMatching {
+		return &candidates[0], nil
+	}
+
+	serverAZ, err := o.getNovaServerAvailabilityZone(ctx, serverID)
+	if err != nil {
+		if o.cfg.OpenStackStrictAZMatching {
+			return nil, fmt.Errorf("could not determine availability zone of node %s, err: %q", node.Name, err)
+		}
+		klog.Warningf("Could not determine availability zone of node %s, ignoring availability zones, err: %q", node.Name, err)
+		return &candidates[0], nil
+	}
+	if serverAZ == "" {
+		return &candidates[0], nil
+	}
+
+	var agnostic, foreign *assignCandidate
+	for i := range candidates {
+		c := &candidates[i]
+		networkAZs, err := o.getNeutronNetworkAvailabilityZones(ctx, c.port.NetworkID)
+		if err != nil {
+			if o.cfg.OpenStackStrictAZMatching {
+				return nil, fmt.Errorf("could not determine availability zones of network %s, err: %q", c.port.NetworkID, err)
+			}
+			klog.Warningf("Could not determine availability zones of network %s, err: %q", c.port.NetworkID, err)
+		}
+		switch {
+		case len(networkAZs) == 0:
+			if agnostic == nil {
+				agnostic = c
+			}
+		case sets.NewString(networkAZs...).Has(serverAZ):
+			return c, nil
+		default:
+			if foreign == nil {
+				foreign = c
+			}
+		}
+	}
+	if agnostic != nil {
+		return agnostic, nil
+	}
+	if o.cfg.OpenStackStrictAZMatching {
+		return nil, fmt.Errorf("could not assign IP address %s to node %s, none of the matching networks is in availability zone %s",
+			ip, node.Name, serverAZ)
+	}
+	klog.Warningf("IP address %s is assigned to node %s on network %s outside of availability zone %s, this may lead to asymmetric routing",
+		ip, node.Name, foreign.port.NetworkID, serverAZ)
+	return foreign, nil
 }
 
 // AssignPrivateIP attempts to assigning the IP address provided to the VM
@@ -233,58 +426,82 @@ func (o *OpenStack) findAssignSubnetAndPort(ip net.IP, node *corev1.Node) (*neut
 // Throw an AlreadyExistingIPError if the IP provided is already associated with the
 // node, it's up to the caller to decide what to do with that.
 // NOTE: For OpenStack, this is a 2 step operation which is not atomic:
-//   a) Reserve a neutron port.
-//   b) Add the IP address to the allowed_address_pairs field.
-// If step b) fails, then we will try to undo step a). However, if this undo fails,
-// then we will be in a situation where the user or an upper layer will have to call
-// ReleasePrivateIP to get out of this situation.
-func (o *OpenStack) AssignPrivateIP(ip net.IP, node *corev1.Node) error {
+//
+//	a) Reserve a neutron port.
+//	b) Add the IP address to the allowed_address_pairs field.
+//
+// If step b) fails, then we will try to undo step a). If this undo fails, it's
+// queued and retried in the background until it succeeds, see enqueueCompensation.
+// Until then, assigning the IP address again fails as it's still reserved.
+func (o *OpenStack) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
 	if node == nil {
 		return fmt.Errorf("invalid nil pointer provided for node when trying to assign private IP %s", ip.String())
 	}
 	// List all ports that are attached to this server.
-	serverID, err := getNovaServerIDFromProviderID(node.Spec.ProviderID)
+	serverID, err := o.getNovaServerID(ctx, node)
+	if err != nil {
+		return err
+	}
+	standbyServerID, err := o.getStandbyServerID(node, serverID)
 	if err != nil {
 		return err
 	}
+	// Updates of the servers' ports must be ordered, see serverLocks.
+	defer o.serverLocks.Lock(serverID, standbyServerID)()
 
-	matchingSubnet, matchingPort, err := o.findAssignSubnetAndPort(ip, node)
+	matchingSubnet, matchingPort, err := o.findAssignSubnetAndPort(ctx, ip, node)
 	if err != nil {
 		return err
 	}
 
 	if matchingSubnet != nil {
+		skipAAP, err := o.skipAllowedAddressPairs(ctx, matchingPort.ID, matchingPort.NetworkID)
+		if err != nil {
+			return err
+		}
+		// Without allowed_address_pairs, the reservation port is the only trace of
+		// the assignment.
+		if skipAAP {
+			if _, err := o.getNeutronPortWithIPAddressAndMachineID(ctx, *matchingSubnet, ip, serverID); err == nil {
+				return AlreadyExistingIPError
+			}
+		}
+
 		// 2) Reserve the IP address on the subnet by creating a new unattached neutron port.
-		unboundPort, err := o.reserveNeutronIPAddress(*matchingSubnet, ip, serverID)
+		unboundPort, err := o.reserveNeutronIPAddress(ctx, *matchingSubnet, ip, serverID, node.Name)
 		if err != nil {
 			return err
 		}
+		if skipAAP {
+			klog.Infof("Port security is disabled on network %s, only reserved IP address %s for node %s", matchingPort.NetworkID, ip, node.Name)
+			return nil
+		}
 		// 3) Then, add the IP address to the port's allowed_address_pairs.
 		//    TODO: use a more elegant retry mechanism.
-		if err = o.allowIPAddressOnNeutronPort(matchingPort.ID, ip); err != nil && !errors.Is(err, AlreadyExistingIPError) {
+		if err = o.allowIPAddressOnNeutronPort(ctx, matchingPort.ID, ip); err != nil && !errors.Is(err, AlreadyExistingIPError) {
 			// Try to clean up the allocated port if adding the IP to allowed_address_pairs failed.
-			// Try this 10 times, but if this operation fails more than that, then user intervention is needed or
-			// the upper layer must call ReleasePrivateIP (because if the neutron port exists and holds
-			// a reservation, then the assign step will not continue after step 2).
-			var errRelease error
-			var releaseStatus string
-			for i := 0; i < 10; i++ {
-				errRelease = o.releaseNeutronIPAddress(*unboundPort, serverID)
-				// If the release operation was successful, then we are done.
-				if errRelease == nil {
-					releaseStatus = "Released neutron port reservation."
-					break
-				}
-				// Otherwise store the error message and retry.
-				releaseStatus = fmt.Sprintf("Could not release neutron port reservation after %d tries, err: %q", i+1, errRelease)
+			// If that fails, hand the release over to the compensation queue rather than
+			// blocking this worker on it: the reservation would prevent any further attempt at
+			// assigning the IP address otherwise.
+			releaseStatus := "Released neutron port reservation."
+			if errRelease := o.releaseNeutronIPAddress(ctx, *unboundPort, serverID); errRelease != nil {
+				o.enqueueCompensation(openstackCompensation{portID: unboundPort.ID, serverID: serverID})
+				releaseStatus = fmt.Sprintf("Could not release neutron port reservation, retrying in the background, err: %q", errRelease)
 			}
 			return fmt.Errorf("could not allow IP address %s on port %s, err: %q. %s", ip.String(), matchingPort.ID, err, releaseStatus)
 		}
-		// 4) Return nil to indicate success if steps 2 and 3 passed.
+		// 4) Pre-allow the IP address on the standby server, if any. The assignment
+		//    itself succeeded, so failing to do so only slows down failovers.
+		if standbyServerID != "" {
+			if err := o.allowIPAddressOnStandbyServer(ctx, unboundPort, standbyServerID, matchingPort.NetworkID, ip); err != nil {
+				klog.Warningf("Could not pre-allow IP address %s on standby server %s of node %s, err: %q", ip, standbyServerID, node.Name, err)
+			}
+		}
+		// 5) Return nil to indicate success if steps 2 and 3 passed.
 		return nil
 	}
 
-	// 5) The IP address does not fit in any of the attached networks' subnets.
+	// 6) The IP address does not fit in any of the attached networks' subnets.
 	return fmt.Errorf("could not assign IP address %s to node %s", ip, node.Name)
 }
 
@@ -292,26 +509,76 @@ func (o *OpenStack) AllowsMovePrivateIP() bool {
 	return true
 }
 
-func (o *OpenStack) MovePrivateIP(ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+func (o *OpenStack) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
 	if nodeToAdd == nil || nodeToDel == nil {
 		return fmt.Errorf("invalid nil pointer provided for node when trying to move IP %s", ip.String())
 	}
 
-	// List all ports that are attached to this server.
-	serverID, err := getNovaServerIDFromProviderID(nodeToDel.Spec.ProviderID)
+	serverID, err := o.getNovaServerID(ctx, nodeToDel)
+	if err != nil {
+		return err
+	}
+	serverIDToAdd, err := o.getNovaServerID(ctx, nodeToAdd)
+	if err != nil {
+		return err
+	}
+	standbyServerID, err := o.getStandbyServerID(nodeToAdd, serverIDToAdd)
+	if err != nil {
+		return err
+	}
+	standbyServerIDToDel, err := o.getStandbyServerID(nodeToDel, serverID)
 	if err != nil {
 		return err
 	}
-	serverPorts, err := o.listNovaServerPorts(serverID)
+	// Updates of the servers' ports must be ordered, see serverLocks.
+	unlock := o.serverLocks.Lock(serverID, serverIDToAdd, standbyServerID)
+	reservation, err := o.movePrivateIP(ctx, ip, nodeToAdd, serverID, serverIDToAdd, standbyServerID)
+	unlock()
 	if err != nil {
 		return err
 	}
+	// Remove the IP address from the standby servers it was pre-allowed on for
+	// the previous nodes, unless the node we move to or its standby is one of
+	// them. The standby of the node we move away from is always checked, for the
+	// IP addresses pre-allowed before the standby servers were recorded. The move
+	// itself succeeded, so failing to do so is only logged.
+	stale := sets.NewString(standbyServerIDToDel)
+	if reservation != nil {
+		stale.Insert(standbyServerIDsOf(*reservation)...)
+	}
+	// The server we failed over to isn't a standby anymore, see
+	// ListPrivateIPs.
+	if reservation != nil && serverIDToAdd != standbyServerID && stale.Has(serverIDToAdd) {
+		if err := o.forgetStandbyServer(ctx, reservation, serverIDToAdd); err != nil {
+			klog.Warningf("Could not forget server %s as a standby of IP address %s, err: %q", serverIDToAdd, ip, err)
+		}
+	}
+	stale.Delete("", serverIDToAdd, standbyServerID)
+	if err := o.unallowIPAddressOnStandbyServers(ctx, ip, stale.List(), reservation); err != nil {
+		klog.Warningf("Could not remove IP address %s from the previous standby servers, err: %q", ip, err)
+	}
+	return nil
+}
 
-	// Loop over all ports that are attached to this nova instance.
-	for _, serverPort := range serverPorts {
-		if isIPAddressAllowedOnNeutronPort(serverPort, ip) {
-			if err = o.unallowIPAddressOnNeutronPort(serverPort.ID, ip); err != nil {
-				return err
+// movePrivateIP moves ip from serverID to serverIDToAdd and pre-allows it on
+// standbyServerID, the standby of nodeToAdd, if any. It returns the reservation
+// port of ip, nil if it isn't reserved.
+func (o *OpenStack) movePrivateIP(ctx context.Context, ip net.IP, nodeToAdd *corev1.Node, serverID, serverIDToAdd, standbyServerID string) (*neutronports.Port, error) {
+	// If the node we move away from is the standby of the node we move to, the IP
+	// address stays allowed on its ports, pre-warmed for moving it back.
+	if serverID != standbyServerID {
+		// List all ports that are attached to this server.
+		serverPorts, err := o.listNovaServerPorts(ctx, serverID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Loop over all ports that are attached to this nova instance.
+		for _, serverPort := range serverPorts {
+			if isIPAddressAllowedOnNeutronPort(serverPort, ip) {
+				if err = o.unallowIPAddressOnNeutronPort(ctx, serverPort.ID, ip); err != nil {
+					return nil, err
+				}
 			}
 		}
 	}
@@ -319,15 +586,50 @@ func (o *OpenStack) MovePrivateIP(ip net.IP, nodeToAdd, nodeToDel *corev1.Node)
 	// TODO(dulek): Should we even care if we haven't found the IP? I'd say no, maybe we've removed it in
 	//              a previous try?
 
-	_, port, err := o.findAssignSubnetAndPort(ip, nodeToAdd)
-	if err != nil {
-		return err
+	_, port, err := o.findAssignSubnetAndPort(ctx, ip, nodeToAdd)
+	if errors.Is(err, AlreadyExistingIPError) && o.cfg.OpenStackStandbyAssignments {
+		// The node we move to was the standby of the previous one, the IP address
+		// is already allowed on its port.
+		klog.Infof("IP address %s was pre-allowed on node %s, failing over without updating its ports", ip, nodeToAdd.Name)
+		ports, err := o.listNovaServerPorts(ctx, serverIDToAdd)
+		if err != nil {
+			return nil, err
+		}
+		for i := range ports {
+			if isIPAddressAllowedOnNeutronPort(ports[i], ip) {
+				port = &ports[i]
+			}
+		}
+	} else if err != nil {
+		return nil, err
+	} else {
+		skipAAP, err := o.skipAllowedAddressPairs(ctx, port.ID, port.NetworkID)
+		if err != nil {
+			return nil, err
+		}
+		if skipAAP {
+			return nil, nil
+		}
+
+		if err = o.allowIPAddressOnNeutronPort(ctx, port.ID, ip); err != nil && !errors.Is(err, AlreadyExistingIPError) {
+			return nil, fmt.Errorf("could not allow IP address %s on port %s, err: %q", ip.String(), port.ID, err)
+		}
+	}
+	if port == nil {
+		return nil, nil
 	}
 
-	if err = o.allowIPAddressOnNeutronPort(port.ID, ip); err != nil && !errors.Is(err, AlreadyExistingIPError) {
-		return fmt.Errorf("could not allow IP address %s on port %s, err: %q", ip.String(), port.ID, err)
+	reservation, err := o.getNeutronReservationPort(ctx, port.NetworkID, ip)
+	if err != nil {
+		klog.Warningf("Could not find the reservation port of IP address %s on network %s, err: %q", ip, port.NetworkID, err)
+		return nil, nil
 	}
-	return nil
+	if standbyServerID != "" && standbyServerID != serverID {
+		if err := o.allowIPAddressOnStandbyServer(ctx, reservation, standbyServerID, port.NetworkID, ip); err != nil {
+			klog.Warningf("Could not pre-allow IP address %s on standby server %s of node %s, err: %q", ip, standbyServerID, nodeToAdd.Name, err)
+		}
+	}
+	return reservation, nil
 }
 
 // ReleasePrivateIP attempts to release the IP address provided from the
@@ -337,26 +639,59 @@ func (o *OpenStack) MovePrivateIP(ip net.IP, nodeToAdd, nodeToDel *corev1.Node)
 // all matching IP allowed_address_pairs for ports which are bound to this server.
 // It also means that any unbound port on any network that is attached to this server -
 // having the IP address to be released and matching the correct DeviceOwner and DeviceID
-// containing the serverID will be deleted, as well.
+// containing the serverID will be deleted, as well. The same goes for the server IDs
+// listed in the node's OpenStackReleaseServerIDsAnnotation, if those servers are gone.
 // In OpenStack, it is possible to create different subnets with the exact same CIDR.
 // These different subnets can then be assigned to ports on the same server.
 // Hence, a server could be connected to several ports where the same IP is part of the
 // allowed_address_pairs and where the same IP is reserved in neutron.
 // NOTE: If the IP is non-existant: it returns an NonExistingIPError. The caller will
 // likely want to ignore such an error and continue its normal operation.
-func (o *OpenStack) ReleasePrivateIP(ip net.IP, node *corev1.Node) error {
+func (o *OpenStack) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
 	if node == nil {
 		return fmt.Errorf("invalid nil pointer provided for node when trying to release IP %s", ip.String())
 	}
 	// List all ports that are attached to this server.
-	serverID, err := getNovaServerIDFromProviderID(node.Spec.ProviderID)
+	serverID, err := o.getNovaServerID(ctx, node)
 	if err != nil {
 		return err
 	}
-	serverPorts, err := o.listNovaServerPorts(serverID)
+	standbyServerID, err := o.getStandbyServerID(node, serverID)
 	if err != nil {
 		return err
 	}
+	// Updates of the servers' ports must be ordered, see serverLocks.
+	unlock := o.serverLocks.Lock(serverID, standbyServerID)
+	previousStandbyServerIDs, err := o.releasePrivateIP(ctx, ip, node, serverID, standbyServerID)
+	unlock()
+	if err != nil && !errors.Is(err, NonExistingIPError) {
+		return err
+	}
+	// Remove the IP address from the standby servers it was pre-allowed on for
+	// previous nodes, or before the node's standby changed, outside of the locks
+	// held above.
+	previousStandbyServerIDs.Delete(serverID, standbyServerID)
+	if err := o.unallowIPAddressOnStandbyServers(ctx, ip, previousStandbyServerIDs.List(), nil); err != nil {
+		return err
+	}
+	return err
+}
+
+// releasePrivateIP releases ip from the server and its standby, see
+// ReleasePrivateIP. It returns the standby servers recorded on the released
+// reservation port.
+func (o *OpenStack) releasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node, serverID, standbyServerID string) (sets.String, error) {
+	// previousStandbyServerIDs are the standby servers recorded on the
+	// reservation port, read before it's released.
+	previousStandbyServerIDs := sets.NewString()
+	serverPorts, err := o.listNovaServerPorts(ctx, serverID)
+	if err != nil {
+		return previousStandbyServerIDs, err
+	}
+
+	// Reservation ports of the node's current server can always be released,
+	// those of previous servers only if the admin explicitly allowed it.
+	ownerIDs := append([]string{serverID}, o.getReleaseOverrideServerIDs(ctx, node)...)
 
 	// Loop over all ports that are attached to this nova instance.
 	isFound := false
@@ -384,15 +719,20 @@ func (o *OpenStack) ReleasePrivateIP(ip net.IP, node *corev1.Node) error {
 		// 1) Check if the IP address is part of the port's allowed_address_pairs.
 		if isIPAddressAllowedOnNeutronPort(serverPort, ip) {
 			isFound = true
+			if reservation, err := o.getNeutronReservationPort(ctx, serverPort.NetworkID, ip); err != nil {
+				klog.Warningf("Could not find the reservation port of IP address %s on network %s, err: %q", ip, serverPort.NetworkID, err)
+			} else if reservation != nil {
+				previousStandbyServerIDs.Insert(standbyServerIDsOf(*reservation)...)
+			}
 			// 1) a) Remove the IP address from the port's allowed_address_pairs.
-			if err = o.unallowIPAddressOnNeutronPort(serverPort.ID, ip); err != nil {
-				return err
+			if err = o.unallowIPAddressOnNeutronPort(ctx, serverPort.ID, ip); err != nil {
+				return previousStandbyServerIDs, err
 			}
 		}
 
 		// 2) Get all subnets that are attached to this port's network and search for the neutron port
 		// holding the IP address.
-		subnets, err := o.getNeutronSubnetsForNetwork(serverPort.NetworkID)
+		subnets, err := o.getNeutronSubnetsForNetwork(ctx, serverPort.NetworkID)
 		if err != nil {
 			klog.Warningf("Could not find subnet information for network %s, err: %q", serverPort.NetworkID, err)
 			continue
@@ -411,11 +751,24 @@ func (o *OpenStack) ReleasePrivateIP(ip net.IP, node *corev1.Node) error {
 			}
 			// 2) b) Is the IP address on the subnet?
 			// The DeviceOwner and DeviceID that this is a port that identify that this is managed by this plugin.
-			if unboundPort, err := o.getNeutronPortWithIPAddressAndMachineID(s, ip, serverID); err == nil {
+			for _, ownerID := range ownerIDs {
+				unboundPort, err := o.getNeutronPortWithIPAddressAndMachineID(ctx, s, ip, ownerID)
+				if err != nil {
+					continue
+				}
 				isFound = true
+				if ownerID != serverID {
+					klog.Warningf("Releasing neutron port %s holding IP address %s for node %s although it belongs to server %s "+
+						"instead of %s, as allowed by annotation %s", unboundPort.ID, ip, node.Name, ownerID, serverID,
+						OpenStackReleaseServerIDsAnnotation)
+				}
+				// The reservation port may be released through another port of the
+				// server on the same network before its allowed_address_pairs are
+				// checked, read its standby servers first.
+				previousStandbyServerIDs.Insert(standbyServerIDsOf(*unboundPort)...)
 				// 2) c)  Then, release the IP allocation = delete the unbound neutron port.
-				if err = o.releaseNeutronIPAddress(*unboundPort, serverID); err != nil {
-					return err
+				if err = o.releaseNeutronIPAddress(ctx, *unboundPort, ownerID); err != nil {
+					return previousStandbyServerIDs, err
 				}
 				// We could break here now. However, go on here with the next subnet on this port
 				// to cover the very odd case that 2 subnets with the same CIDR were attached to the same
@@ -425,15 +778,361 @@ func (o *OpenStack) ReleasePrivateIP(ip net.IP, node *corev1.Node) error {
 			}
 		}
 	}
+	// Remove the IP address pre-allowed on the standby server, if any.
+	if standbyServerID != "" {
+		standbyPorts, err := o.listNovaServerPorts(ctx, standbyServerID)
+		if err != nil {
+			return previousStandbyServerIDs, err
+		}
+		for _, standbyPort := range standbyPorts {
+			if isIPAddressAllowedOnNeutronPort(standbyPort, ip) {
+				if err = o.unallowIPAddressOnNeutronPort(ctx, standbyPort.ID, ip); err != nil {
+					return previousStandbyServerIDs, err
+				}
+			}
+		}
+	}
 	// 3) The IP address is not part of any attached subnet and it's not part of any allowed_address_pair
 	// on any of the ports that are attached to the server.
 	if !isFound {
 		// This is part of normal operation.
 		// Callers will likely ignore this and go on with normal operation.
+		return previousStandbyServerIDs, NonExistingIPError
+	}
+
+	return previousStandbyServerIDs, nil
+}
+
+func (o *OpenStack) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, o.AssignPrivateIP)
+}
+
+func (o *OpenStack) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, o.ReleasePrivateIP)
+}
+
+// CleanupNode deletes all reservation ports owned by the node's server in one
+// pass. The allowed_address_pairs vanish together with the server's ports, but
+// our reservation ports would otherwise linger forever and keep the IP addresses
+// from being assigned to any other node. As the node object can be deleted and
+// re-created while the server keeps running, this is only done once the server
+// is gone: an InstanceExistsError is returned until then.
+func (o *OpenStack) CleanupNode(ctx context.Context, node *corev1.Node) error {
+	if node == nil {
+		return fmt.Errorf("invalid nil pointer provided for node when trying to clean it up")
+	}
+	serverID, err := o.getNovaServerID(ctx, node)
+	if err != nil {
+		return err
+	}
+	defer o.serverLocks.Lock(serverID)()
+	_, err = o.getNovaServer(ctx, serverID)
+	if err == nil {
+		return fmt.Errorf("%w: server %s of node %s, not releasing its egress IPs yet", InstanceExistsError, serverID, node.Name)
+	}
+	var notFound gophercloud.ErrDefault404
+	if !errors.As(err, &notFound) {
+		return err
+	}
+
+	ports, err := o.listNeutronReservationPorts(ctx, serverID)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, p := range ports {
+		if err := o.releaseNeutronIPAddress(ctx, p, serverID); err != nil {
+			errs = append(errs, fmt.Errorf("could not delete neutron port %s, err: %q", p.ID, err))
+			continue
+		}
+		klog.Infof("Released neutron port %s of deleted node %s", p.ID, node.Name)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// GetNodeNetworkInterfaces returns nil, ports attached to or detached from the
+// server aren't tracked.
+func (o *OpenStack) GetNodeNetworkInterfaces(ctx context.Context, node *corev1.Node) ([]string, error) {
+	return nil, nil
+}
+
+// GetPrivateIPReservations returns the reservation ports holding the IP address on
+// the networks the node's server is attached to. Reservation ports stay with the
+// server the IP address was first assigned to when it's moved, hence they're
+// looked up regardless of their owner.
+func (o *OpenStack) GetPrivateIPReservations(ctx context.Context, ip net.IP, node *corev1.Node) ([]PrivateIPReservation, error) {
+	if node == nil {
+		return nil, fmt.Errorf("invalid nil pointer provided for node when trying to get the reservations of IP %s", ip.String())
+	}
+	serverID, err := o.getNovaServerID(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	serverPorts, err := o.listNovaServerPorts(ctx, serverID)
+	if err != nil {
+		return nil, err
+	}
+	var reservations []PrivateIPReservation
+	networkIDs := sets.NewString()
+	for _, serverPort := range serverPorts {
+		if networkIDs.Has(serverPort.NetworkID) {
+			continue
+		}
+		networkIDs.Insert(serverPort.NetworkID)
+		portListOpts := neutronports.ListOpts{
+			NetworkID:   serverPort.NetworkID,
+			DeviceOwner: egressIPTag,
+		}
+		client, cancel := o.withTimeout(ctx, o.neutronClient)
+		err := neutronports.List(client, portListOpts).EachPage(func(page pagination.Page) (bool, error) {
+			portList, err := neutronports.ExtractPorts(page)
+			if err != nil {
+				return false, err
+			}
+			for _, p := range portList {
+				for _, fip := range p.FixedIPs {
+					if ip.Equal(ParseIP(fip.IPAddress)) {
+						reservations = append(reservations, PrivateIPReservation{ID: p.ID, Subnet: fip.SubnetID})
+					}
+				}
+			}
+			return true, nil
+		})
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return reservations, nil
+}
+
+// ListPrivateIPs returns the egress IP addresses allowed on the ports of the
+// node's server, i.e. those in their allowed_address_pairs which have a
+// reservation port. Reservation ports stay with the server they were created
+// for when their IP address is moved, so they're matched by IP address rather
+// than by device ID. IP addresses the server only holds as a standby, see
+// allowIPAddressOnStandbyServer, aren't listed.
+func (o *OpenStack) ListPrivateIPs(ctx context.Context, node *corev1.Node) ([]net.IP, error) {
+	if node == nil {
+		return nil, fmt.Errorf("invalid nil pointer provided for node when trying to list its private IPs")
+	}
+	serverID, err := o.getNovaServerID(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	serverPorts, err := o.listNovaServerPorts(ctx, serverID)
+	if err != nil {
+		return nil, err
+	}
+	ips := []net.IP{}
+	listed := sets.NewString()
+	// reservations holds the reservation ports of each network, by IP
+	// address.
+	reservations := map[string]map[string]neutronports.Port{}
+	for _, serverPort := range serverPorts {
+		if _, ok := reservations[serverPort.NetworkID]; !ok {
+			reservations[serverPort.NetworkID] = map[string]neutronports.Port{}
+			client, cancel := o.withTimeout(ctx, o.neutronClient)
+			err := neutronports.List(client, neutronports.ListOpts{
+				NetworkID:   serverPort.NetworkID,
+				DeviceOwner: egressIPTag,
+			}).EachPage(func(page pagination.Page) (bool, error) {
+				portList, err := neutronports.ExtractPorts(page)
+				if err != nil {
+					return false, err
+				}
+				for _, p := range portList {
+					for _, fip := range p.FixedIPs {
+						if ip := ParseIP(fip.IPAddress); ip != nil {
+							reservations[serverPort.NetworkID][ip.String()] = p
+						}
+					}
+				}
+				return true, nil
+			})
+			cancel()
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, aap := range serverPort.AllowedAddressPairs {
+			ip := ParseIP(aap.IPAddress)
+			if ip == nil || listed.Has(ip.String()) {
+				continue
+			}
+			reservation, ok := reservations[serverPort.NetworkID][ip.String()]
+			if !ok || sets.NewString(standbyServerIDsOf(reservation)...).Has(serverID) {
+				continue
+			}
+			listed.Insert(ip.String())
+			ips = append(ips, ip)
+		}
+	}
+	return ips, nil
+}
+
+// CheckHealth lists the ports of the node's nova server.
+func (o *OpenStack) CheckHealth(ctx context.Context, node *corev1.Node) error {
+	serverID, err := o.getNovaServerID(ctx, node)
+	if err != nil {
+		return err
+	}
+	_, err = o.listNovaServerPorts(ctx, serverID)
+	return err
+}
+
+// ListOwnedResources returns all reservation ports, each with the node and
+// the provider ID of the server it was created for. Reservation ports stay with that server when
+// their IP address is moved, hence the node isn't necessarily the one the IP
+// address is assigned to.
+func (o *OpenStack) ListOwnedResources(ctx context.Context, nodes []*corev1.Node) ([]OwnedResource, error) {
+	nodeNames := map[string]string{}
+	for _, node := range nodes {
+		// The ports of a node whose server is unknown would look orphaned.
+		serverID, err := o.getNovaServerID(ctx, node)
+		if err != nil {
+			return nil, err
+		}
+		nodeNames[generateDeviceID(serverID)] = node.Name
+	}
+	resources := []OwnedResource{}
+	portListOpts := neutronports.ListOpts{
+		DeviceOwner: egressIPTag,
+	}
+	client, cancel := o.withTimeout(ctx, o.neutronClient)
+	defer cancel()
+	err := neutronports.List(client, portListOpts).EachPage(func(page pagination.Page) (bool, error) {
+		portList, err := neutronports.ExtractPorts(page)
+		if err != nil {
+			return false, err
+		}
+		for _, p := range portList {
+			for _, fip := range p.FixedIPs {
+				resources = append(resources, OwnedResource{
+					ID:         p.ID,
+					Kind:       "neutron port",
+					IP:         ParseIP(fip.IPAddress),
+					Node:       nodeNames[p.DeviceID],
+					ProviderID: openstackProviderPrefix + strings.TrimPrefix(p.DeviceID, egressIPTag+"_"),
+				})
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+// DeleteOwnedResource deletes the reservation port, after checking that it's
+// still one.
+func (o *OpenStack) DeleteOwnedResource(ctx context.Context, resource OwnedResource) error {
+	client, cancel := o.withTimeout(ctx, o.neutronClient)
+	defer cancel()
+	port, err := neutronports.Get(client, resource.ID).Extract()
+	var notFound gophercloud.ErrDefault404
+	if errors.As(err, &notFound) {
+		return NonExistingIPError
+	}
+	if err != nil {
+		return err
+	}
+	serverID := strings.TrimPrefix(port.DeviceID, egressIPTag+"_")
+	defer o.serverLocks.Lock(serverID)()
+	err = o.releaseNeutronIPAddress(ctx, *port, serverID)
+	if errors.As(err, &notFound) {
 		return NonExistingIPError
 	}
+	return err
+}
 
-	return nil
+// VerifyPrivateIP verifies that the reservation port holding the IP address exists
+// and that the server port the IP address was allowed on is ACTIVE, meaning that
+// neutron programmed it on the data plane. The reachability of the IP address
+// is probed separately, see ProbeReachability.
+func (o *OpenStack) VerifyPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	if node == nil {
+		return fmt.Errorf("invalid nil pointer provided for node when trying to verify IP %s", ip.String())
+	}
+	serverID, err := o.getNovaServerID(ctx, node)
+	if err != nil {
+		return err
+	}
+	serverPorts, err := o.listNovaServerPorts(ctx, serverID)
+	if err != nil {
+		return err
+	}
+	for _, serverPort := range serverPorts {
+		subnets, err := o.getNeutronSubnetsForNetwork(ctx, serverPort.NetworkID)
+		if err != nil {
+			return err
+		}
+		for _, s := range subnets {
+			_, ipnet, err := net.ParseCIDR(s.CIDR)
+			if err != nil || !ipnet.Contains(ip) {
+				continue
+			}
+			if _, err := o.getNeutronPortWithIPAddressAndMachineID(ctx, s, ip, serverID); err != nil {
+				return fmt.Errorf("could not find the reservation port of IP address %s on subnet %s, err: %q", ip, s.ID, err)
+			}
+			if !isIPAddressAllowedOnNeutronPort(serverPort, ip) {
+				skipAAP, err := o.skipAllowedAddressPairs(ctx, serverPort.ID, serverPort.NetworkID)
+				if err != nil {
+					return err
+				}
+				// Another port of the server on this network may hold it.
+				if !skipAAP {
+					continue
+				}
+			}
+			if serverPort.Status != "ACTIVE" {
+				return fmt.Errorf("port %s of node %s holding IP address %s is %s instead of ACTIVE", serverPort.ID, node.Name, ip, serverPort.Status)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("IP address %s is not allowed on any port of node %s", ip, node.Name)
+}
+
+// getReleaseOverrideServerIDs returns the server IDs listed in the node's
+// OpenStackReleaseServerIDsAnnotation. Any ID which is not a valid UUID, is the
+// node's current server, or belongs to a server which still exists is refused:
+// we must never release the reservation of a live server.
+func (o *OpenStack) getReleaseOverrideServerIDs(ctx context.Context, node *corev1.Node) []string {
+	annotation, ok := node.Annotations[OpenStackReleaseServerIDsAnnotation]
+	if !ok {
+		return nil
+	}
+	var serverIDs []string
+	for _, id := range strings.Split(annotation, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		if _, err := uuid.Parse(id); err != nil {
+			klog.Warningf("Ignoring server ID '%s' in annotation %s of node %s, it is not a valid UUID",
+				id, OpenStackReleaseServerIDsAnnotation, node.Name)
+			continue
+		}
+		if node.Spec.ProviderID == openstackProviderPrefix+id {
+			continue
+		}
+		_, err := o.getNovaServer(ctx, id)
+		if err == nil {
+			klog.Warningf("Ignoring server ID '%s' in annotation %s of node %s, the server still exists",
+				id, OpenStackReleaseServerIDsAnnotation, node.Name)
+			continue
+		}
+		var notFound gophercloud.ErrDefault404
+		if !errors.As(err, &notFound) {
+			klog.Warningf("Ignoring server ID '%s' in annotation %s of node %s, could not verify that the server is gone, err: %q",
+				id, OpenStackReleaseServerIDsAnnotation, node.Name, err)
+			continue
+		}
+		serverIDs = append(serverIDs, id)
+	}
+	return serverIDs
 }
 
 // GetNodeEgressIPConfiguration retrieves the egress IP configuration for
@@ -444,18 +1143,18 @@ func (o *OpenStack) ReleasePrivateIP(ip net.IP, node *corev1.Node) error {
 // * The interface is keyed by a neutron UUID
 // This function should only be called when no egress IPs have been added to the node,
 // it will return an incorrect "egress IP capacity" otherwise.
-func (o *OpenStack) GetNodeEgressIPConfiguration(node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
+func (o *OpenStack) GetNodeEgressIPConfiguration(ctx context.Context, node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
 	if node == nil {
 		return nil, fmt.Errorf("invalid nil pointer provided for node when trying to get node EgressIP configuration")
 	}
 
 	var configurations []*NodeEgressIPConfiguration
 
-	serverID, err := getNovaServerIDFromProviderID(node.Spec.ProviderID)
+	serverID, err := o.getNovaServerID(ctx, node)
 	if err != nil {
 		return nil, err
 	}
-	serverPorts, err := o.listNovaServerPorts(serverID)
+	serverPorts, err := o.listNovaServerPorts(ctx, serverID)
 	if err != nil {
 		return nil, err
 	}
@@ -465,11 +1164,23 @@ func (o *OpenStack) GetNodeEgressIPConfiguration(node *corev1.Node) ([]*NodeEgre
 	// otherwise we don't know where the EgressIP should be attached to.
 	cidrs := make(map[string]struct{})
 	for _, p := range serverPorts {
+		network, err := o.getNeutronNetwork(ctx, p.NetworkID)
+		if err != nil {
+			return nil, err
+		}
+		// Ports on external networks are usually attached to provider
+		// networks directly, where egress IPs aren't tenant-managed.
+		if network.External && !o.cfg.OpenStackIncludeExternalNetworks {
+			klog.Infof("Skipping port %s of node %s on external network %s", p.ID, node.Name, p.NetworkID)
+			continue
+		}
+
 		// Retrieve configuration for this port.
-		config, err := o.getNeutronPortNodeEgressIPConfiguration(p)
+		config, err := o.getNeutronPortNodeEgressIPConfiguration(ctx, p, node)
 		if err != nil {
 			return nil, err
 		}
+		config.VLAN = getNeutronNetworkVLAN(network)
 
 		// Check for duplicate CIDR assignments.
 		if config.IFAddr.IPv4 != "" {
@@ -493,21 +1204,24 @@ func (o *OpenStack) GetNodeEgressIPConfiguration(node *corev1.Node) ([]*NodeEgre
 }
 
 // getNeutronPortNodeEgressIPConfiguration renders the NeutronPortNodeEgressIPConfiguration for a given port.
-// * The interface is keyed by a neutron UUID
-// * If multiple IPv4 repectively multiple IPv6 subnets are attached to the same port, throw an error.
-// * The IP capacity is per port, per IP address family. It's ceiling is limited by the maximum of:
-//   a) The size of the subnet.
-//   b) An arbitrarily selected ceiling of 64.
-//   The number of unique IP addresses in allowed_address_pair and fixed_ips is subtracted from that ceiling.
-//   Keep in mind that the subnet size is an upper limit for the subnet, the port quota an upper limit for the
-//   project but that IP capacity is a per port value.
-//   The definition of this field does unfortunately not play very well with the way how neutron operates as there
-//   is no such thing as a per port quota or limit.
+//   - The interface is keyed by a neutron UUID
+//   - If multiple IPv4 repectively multiple IPv6 subnets are attached to the same port, the primary one is
+//     selected by selectPrimarySubnets. The other subnets the port has fixed IPs on are reported as
+//     SecondaryIFAddrs.
+//   - The IP capacity is per port, per IP address family. It's ceiling is limited by the maximum of:
+//     a) The size of the subnet.
+//     b) An arbitrarily selected ceiling of 64.
+//     The number of unique IP addresses in allowed_address_pair and fixed_ips is subtracted from that ceiling.
+//     Keep in mind that the subnet size is an upper limit for the subnet, the port quota an upper limit for the
+//     project but that IP capacity is a per port value.
+//     The definition of this field does unfortunately not play very well with the way how neutron operates as there
+//     is no such thing as a per port quota or limit.
+//
 // TODO: How to determine the primary interface of an instance if multiple interfaces are attached?
 // TODO: As a solution, we currently report the EgressIP configuration for every attached interface, but other plugins
 // do not do this. Is the upper layer compatible with that?
 // TODO: How to determine the primary AF?
-func (o *OpenStack) getNeutronPortNodeEgressIPConfiguration(p neutronports.Port) (*NodeEgressIPConfiguration, error) {
+func (o *OpenStack) getNeutronPortNodeEgressIPConfiguration(ctx context.Context, p neutronports.Port, node *corev1.Node) (*NodeEgressIPConfiguration, error) {
 	var ipv4, ipv6 string
 	var ipv4Prefix, ipv6Prefix int
 	var ipv4Cap, ipv6Cap int
@@ -516,14 +1230,23 @@ func (o *OpenStack) getNeutronPortNodeEgressIPConfiguration(p neutronports.Port)
 	var ipnet *net.IPNet
 
 	// Retrieve all subnets for this port.
-	subnets, err := o.getNeutronSubnetsForNetwork(p.NetworkID)
+	subnets, err := o.getNeutronSubnetsForNetwork(ctx, p.NetworkID)
 	if err != nil {
 		return nil, fmt.Errorf("could not find subnet information for network %s, err: %q", p.NetworkID, err)
 	}
 
-	// Loop over all subnets. OpenStack potentially has several IPv4 or IPv6 subnets per port, but the
-	// CloudPrivateIPConfig expects only a single subnet of each address family per port. Throw an error
-	// in such a case.
+	// OpenStack potentially has several IPv4 or IPv6 subnets per port, but the
+	// CloudPrivateIPConfig expects only a single subnet of each address family per port. Use the
+	// primary one in such a case, and report the others the port has fixed IPs on.
+	allSubnets := subnets
+	subnets, err = o.selectPrimarySubnets(p, subnets, nodeInternalIPs(node))
+	if err != nil {
+		return nil, err
+	}
+	secondaryIFAddrs := getSecondaryIFAddrs(p, allSubnets, subnets)
+
+	// Loop over all subnets, there's at most one of each address family left.
+	var ipv4Net, ipv6Net *net.IPNet
 	for _, s := range subnets {
 		// Parse CIDR information into ip and ipnet.
 		ip, ipnet, err = net.ParseCIDR(s.CIDR)
@@ -537,6 +1260,7 @@ func (o *OpenStack) getNeutronPortNodeEgressIPConfiguration(p neutronports.Port)
 				return nil, fmt.Errorf("found multiple IPv4 subnets attached to port %s, this is not supported", p.ID)
 			}
 			ipv4 = ipnet.String()
+			ipv4Net = ipnet
 			ipv4Prefix, _ = ipnet.Mask.Size()
 			ipv4Cap = int(math.Min(float64(openstackMaxCapacity), math.Pow(2, 32-float64(ipv4Prefix))-2))
 		} else {
@@ -544,13 +1268,14 @@ func (o *OpenStack) getNeutronPortNodeEgressIPConfiguration(p neutronports.Port)
 				return nil, fmt.Errorf("found multiple IPv6 subnets attached to port %s, this is not supported", p.ID)
 			}
 			ipv6 = ipnet.String()
+			ipv6Net = ipnet
 			ipv6Prefix, _ = ipnet.Mask.Size()
 			ipv6Cap = int(math.Min(float64(openstackMaxCapacity), math.Pow(2, 128-float64(ipv6Prefix))-2))
 		}
 
 	}
 
-	ipv4UsedIPs, ipv6UsedIPs := o.getIPsOnPort(p)
+	ipv4UsedIPs, ipv6UsedIPs := o.getIPsOnPort(p, ipv4Net, ipv6Net)
 
 	return &NodeEgressIPConfiguration{
 		Interface: p.ID,
@@ -562,36 +1287,142 @@ func (o *OpenStack) getNeutronPortNodeEgressIPConfiguration(p neutronports.Port)
 			IPv4: ipv4Cap - ipv4UsedIPs,
 			IPv6: ipv6Cap - ipv6UsedIPs,
 		},
+		SecondaryIFAddrs: secondaryIFAddrs,
+		MAC:              normalizeMAC(p.MACAddress),
 	}, nil
 }
 
-// getIPsOnPort returns the number of unique IP addresses on the given port.
+// getSecondaryIFAddrs returns the CIDRs of the subnets, out of allSubnets, the
+// port has fixed IPs on but which weren't selected as primary subnets, in the
+// order of the port's fixed IPs.
+func getSecondaryIFAddrs(p neutronports.Port, allSubnets, selected []neutronsubnets.Subnet) []string {
+	selectedIDs := sets.NewString()
+	for _, s := range selected {
+		selectedIDs.Insert(s.ID)
+	}
+	var secondaryIFAddrs []string
+	for _, fixedIP := range p.FixedIPs {
+		if selectedIDs.Has(fixedIP.SubnetID) {
+			continue
+		}
+		for _, s := range allSubnets {
+			if s.ID == fixedIP.SubnetID {
+				secondaryIFAddrs = append(secondaryIFAddrs, s.CIDR)
+				selectedIDs.Insert(s.ID)
+				break
+			}
+		}
+	}
+	return secondaryIFAddrs
+}
+
+// getNeutronNetworkVLAN returns the VLAN ID of the network, or 0 if it's not a VLAN
+// network or if its provider attributes are not visible to us, which is the default
+// for non-admin users.
+func getNeutronNetworkVLAN(network *neutronNetwork) int {
+	if network.NetworkType != "vlan" {
+		return 0
+	}
+	vlan, err := strconv.Atoi(network.SegmentationID)
+	if err != nil {
+		return 0
+	}
+	return vlan
+}
+
+// getIPsOnPort returns the number of unique IP addresses on the given port inside of
+// the given IPv4 and IPv6 subnets, any of which may be nil.
 // Those include both IPs in the list of FixedIP addresses and in the list of
 // allowed_address_pairs. This method is a helper for getNeutronPortNodeEgressIPConfiguration
 // and as such does not test if multiple networks of the same address family are assigned to
 // the port, given that the calling method will already have done this.
-func (o *OpenStack) getIPsOnPort(p neutronports.Port) (int, int) {
+func (o *OpenStack) getIPsOnPort(p neutronports.Port, ipv4Net, ipv6Net *net.IPNet) (int, int) {
 	ipv4UsedIPs := make(map[string]struct{})
 	ipv6UsedIPs := make(map[string]struct{})
 
-	for _, ip := range p.FixedIPs {
-		if utilnet.IsIPv4(net.ParseIP(ip.IPAddress)) {
-			ipv4UsedIPs[ip.IPAddress] = struct{}{}
-		} else {
-			ipv6UsedIPs[ip.IPAddress] = struct{}{}
+	count := func(ipAddress string) {
+		ip := ParseIP(ipAddress)
+		if ip == nil {
+			return
+		}
+		// Key by the canonical form, so that the same IP listed both as a
+		// fixed IP and an allowed address pair is only counted once.
+		if ipv4Net != nil && ipv4Net.Contains(ip) {
+			ipv4UsedIPs[ip.String()] = struct{}{}
+		} else if ipv6Net != nil && ipv6Net.Contains(ip) {
+			ipv6UsedIPs[ip.String()] = struct{}{}
 		}
 	}
+	for _, ip := range p.FixedIPs {
+		count(ip.IPAddress)
+	}
 	for _, ip := range p.AllowedAddressPairs {
-		if utilnet.IsIPv4(net.ParseIP(ip.IPAddress)) {
-			ipv4UsedIPs[ip.IPAddress] = struct{}{}
-		} else {
-			ipv6UsedIPs[ip.IPAddress] = struct{}{}
-		}
+		count(ip.IPAddress)
 	}
 
 	return len(ipv4UsedIPs), len(ipv6UsedIPs)
 }
 
+// selectPrimarySubnets returns subnets, reduced to the primary subnet of each address family
+// which has several subnets. That's, in order of preference:
+//   - the pinned subnet. Subnets are pinned by listing their ID in OpenStackPinnedSubnets or by
+//     tagging them with OpenStackPinnedSubnetTag.
+//   - the subnet of the port's fixed IP which is an internal IP address of the node.
+//   - the only subnet the port has fixed IPs on.
+func (o *OpenStack) selectPrimarySubnets(p neutronports.Port, subnets []neutronsubnets.Subnet, nodeIPs []net.IP) ([]neutronsubnets.Subnet, error) {
+	pinnedIDs := sets.NewString()
+	for _, id := range strings.Split(o.cfg.OpenStackPinnedSubnets, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			pinnedIDs.Insert(id)
+		}
+	}
+	fixedIPSubnetIDs, nodeIPSubnetIDs := sets.NewString(), sets.NewString()
+	for _, fixedIP := range p.FixedIPs {
+		fixedIPSubnetIDs.Insert(fixedIP.SubnetID)
+		for _, nodeIP := range nodeIPs {
+			if nodeIP.Equal(ParseIP(fixedIP.IPAddress)) {
+				nodeIPSubnetIDs.Insert(fixedIP.SubnetID)
+			}
+		}
+	}
+
+	var selected []neutronsubnets.Subnet
+	for _, ipVersion := range []int{4, 6} {
+		var family, pinned, ofNodeIP, ofFixedIP []neutronsubnets.Subnet
+		for _, s := range subnets {
+			if s.IPVersion != ipVersion {
+				continue
+			}
+			family = append(family, s)
+			if pinnedIDs.Has(s.ID) || sets.NewString(s.Tags...).Has(OpenStackPinnedSubnetTag) {
+				pinned = append(pinned, s)
+			}
+			if nodeIPSubnetIDs.Has(s.ID) {
+				ofNodeIP = append(ofNodeIP, s)
+			}
+			if fixedIPSubnetIDs.Has(s.ID) {
+				ofFixedIP = append(ofFixedIP, s)
+			}
+		}
+		switch {
+		case len(family) <= 1:
+			selected = append(selected, family...)
+		case len(pinned) == 1:
+			selected = append(selected, pinned...)
+		case len(pinned) > 1:
+			return nil, fmt.Errorf("found multiple pinned IPv%d subnets attached to port %s, only one may be pinned", ipVersion, p.ID)
+		case len(ofNodeIP) == 1:
+			selected = append(selected, ofNodeIP...)
+		case len(ofFixedIP) == 1:
+			selected = append(selected, ofFixedIP...)
+		default:
+			return nil, fmt.Errorf("found multiple IPv%d subnets attached to port %s, this is only supported if one of them is pinned "+
+				"through -platform-openstack-pinned-subnets or tag '%s', or holds the node's internal IP address", ipVersion, p.ID, OpenStackPinnedSubnetTag)
+		}
+	}
+	return selected, nil
+}
+
 // reserveNeutronIPAddress creates a new unattached neutron port with the given IP on
 // the given subnet. This will serve as our IPAM as it is impossible to create 2 ports
 // with the same IP on the same subnet. The created port will be identified with a custom
@@ -599,13 +1430,20 @@ func (o *OpenStack) getIPsOnPort(p neutronports.Port) (int, int) {
 // NOTE: We are not using tags. According to the neutron API, it's possible to add a tag when creating
 // a port. But gophercloud does not allow us to do that and we must use a 2 step process (create port, then
 // add tag).
-func (o *OpenStack) reserveNeutronIPAddress(s neutronsubnets.Subnet, ip net.IP, serverID string) (*neutronports.Port, error) {
+func (o *OpenStack) reserveNeutronIPAddress(ctx context.Context, s neutronsubnets.Subnet, ip net.IP, serverID, nodeName string) (*neutronports.Port, error) {
 	if serverID == "" || len(serverID) > 254-len(egressIPTag) {
 		return nil, fmt.Errorf("cannot assign IP address %s on subnet %s with an invalid serverID '%s'", ip.String(), s.ID, serverID)
 	}
 
+	// Describe the port, so that cloud admins can map it back to its owner.
+	description := fmt.Sprintf("Egress IP of node %s", nodeName)
+	if o.cfg.ClusterID != "" {
+		description += fmt.Sprintf(" of cluster %s", o.cfg.ClusterID)
+	}
+	description += fmt.Sprintf(", reserved at %s", time.Now().UTC().Format(time.RFC3339))
+
 	// Now, create the port.
-	opts := neutronports.CreateOpts{
+	var opts neutronports.CreateOptsBuilder = neutronports.CreateOpts{
 		NetworkID: s.NetworkID,
 		FixedIPs: []neutronports.IP{
 			{
@@ -616,8 +1454,17 @@ func (o *OpenStack) reserveNeutronIPAddress(s neutronsubnets.Subnet, ip net.IP,
 		DeviceOwner: egressIPTag,
 		DeviceID:    generateDeviceID(serverID),
 		Name:        fmt.Sprintf("egressip-%s", ip.String()),
+		Description: description,
+	}
+	if o.dnsIntegration {
+		opts = portCreateOptsDNSExt{
+			CreateOptsBuilder: opts,
+			DNSName:           generateDNSName(ip),
+		}
 	}
-	p, err := neutronports.Create(o.neutronClient, opts).Extract()
+	client, cancel := o.withTimeout(ctx, o.neutronClient)
+	defer cancel()
+	p, err := neutronports.Create(client, opts).Extract()
 	if err != nil {
 		return nil, err
 	}
@@ -625,9 +1472,44 @@ func (o *OpenStack) reserveNeutronIPAddress(s neutronsubnets.Subnet, ip net.IP,
 	return p, nil
 }
 
+// portCreateOptsDNSExt adds the dns_name of the dns-integration extension to the
+// port creation options.
+type portCreateOptsDNSExt struct {
+	neutronports.CreateOptsBuilder
+	DNSName string
+}
+
+// ToPortCreateMap adds dns_name to the map of the base port creation options.
+func (opts portCreateOptsDNSExt) ToPortCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToPortCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	base["port"].(map[string]interface{})["dns_name"] = opts.DNSName
+	return base, nil
+}
+
+// hasNeutronExtension returns true if neutron has the extension with the given alias
+// enabled. The extensions are optional, so failing to list them, e.g. when the
+// policy of the cloud forbids it, is not fatal: the extension is then assumed
+// to be absent.
+func (o *OpenStack) hasNeutronExtension(ctx context.Context, alias string) bool {
+	client, cancel := o.withTimeout(ctx, o.neutronClient)
+	defer cancel()
+	_, err := client.Get(client.ServiceURL("extensions", alias), nil, nil)
+	if err != nil {
+		var notFound gophercloud.ErrDefault404
+		if !errors.As(err, &notFound) {
+			klog.Warningf("Could not check for neutron's %s extension, assuming it is not enabled, err: %q", alias, err)
+		}
+		return false
+	}
+	return true
+}
+
 // releaseNeutronIPAddress deletes an unattached neutron port with the given IP on
 // the given subnet. It also looks at the DeviceOwner and DeviceID and makes sure that the port matches.
-func (o *OpenStack) releaseNeutronIPAddress(port neutronports.Port, serverID string) error {
+func (o *OpenStack) releaseNeutronIPAddress(ctx context.Context, port neutronports.Port, serverID string) error {
 	if serverID == "" || len(serverID) > 254-len(egressIPTag) {
 		return fmt.Errorf("cannot release neutron port %s. An invalid serverID was provided '%s'", port.ID, serverID)
 	}
@@ -637,12 +1519,14 @@ func (o *OpenStack) releaseNeutronIPAddress(port neutronports.Port, serverID str
 			port.ID, serverID, port.DeviceOwner, port.DeviceID)
 	}
 
-	return neutronports.Delete(o.neutronClient, port.ID).ExtractErr()
+	client, cancel := o.withTimeout(ctx, o.neutronClient)
+	defer cancel()
+	return neutronports.Delete(client, port.ID).ExtractErr()
 }
 
 // getNeutronPortWithIPAddressAndMachineID gets the neutron port with the given IP on the given subnet and
 // with the correct DeviceID containing the serverID.
-func (o *OpenStack) getNeutronPortWithIPAddressAndMachineID(s neutronsubnets.Subnet, ip net.IP, serverID string) (*neutronports.Port, error) {
+func (o *OpenStack) getNeutronPortWithIPAddressAndMachineID(ctx context.Context, s neutronsubnets.Subnet, ip net.IP, serverID string) (*neutronports.Port, error) {
 	if serverID == "" || len(serverID) > 254-len(egressIPTag) {
 		return nil, fmt.Errorf("cannot retrieve neutron port with IP address %s on subnet %s with an invalid serverID '%s'", ip.String(), s.ID, serverID)
 	}
@@ -663,7 +1547,9 @@ func (o *OpenStack) getNeutronPortWithIPAddressAndMachineID(s neutronsubnets.Sub
 	portListOpts := neutronports.ListOpts{
 		NetworkID: s.NetworkID,
 	}
-	pager := neutronports.List(o.neutronClient, portListOpts)
+	client, cancel := o.withTimeout(ctx, o.neutronClient)
+	defer cancel()
+	pager := neutronports.List(client, portListOpts)
 	err := pager.EachPage(func(page pagination.Page) (bool, error) {
 		portList, err := neutronports.ExtractPorts(page)
 		if err != nil {
@@ -676,7 +1562,7 @@ func (o *OpenStack) getNeutronPortWithIPAddressAndMachineID(s neutronsubnets.Sub
 				continue
 			}
 			for _, fip := range p.FixedIPs {
-				if fip.SubnetID == s.ID && fip.IPAddress == ip.String() {
+				if fip.SubnetID == s.ID && ip.Equal(ParseIP(fip.IPAddress)) {
 					ports = append(ports, p)
 					// End the search.
 					return false, nil
@@ -696,11 +1582,41 @@ func (o *OpenStack) getNeutronPortWithIPAddressAndMachineID(s neutronsubnets.Sub
 	return &ports[0], nil
 }
 
+// getNeutronReservationPort returns the reservation port holding ip on the
+// network, whichever server it was reserved for, nil if there's none.
+func (o *OpenStack) getNeutronReservationPort(ctx context.Context, networkID string, ip net.IP) (*neutronports.Port, error) {
+	var reservation *neutronports.Port
+	client, cancel := o.withTimeout(ctx, o.neutronClient)
+	defer cancel()
+	pager := neutronports.List(client, neutronports.ListOpts{
+		NetworkID:   networkID,
+		DeviceOwner: egressIPTag,
+	})
+	err := pager.EachPage(func(page pagination.Page) (bool, error) {
+		portList, err := neutronports.ExtractPorts(page)
+		if err != nil {
+			return false, err
+		}
+		for i := range portList {
+			for _, fip := range portList[i].FixedIPs {
+				if ip.Equal(ParseIP(fip.IPAddress)) {
+					reservation = &portList[i]
+					return false, nil
+				}
+			}
+		}
+		return true, nil
+	})
+	return reservation, err
+}
+
 // allowIPAddressOnNeutronPort adds the specified IP address to the port's allowed_address_pairs.
-func (o *OpenStack) allowIPAddressOnNeutronPort(portID string, ip net.IP) error {
+func (o *OpenStack) allowIPAddressOnNeutronPort(ctx context.Context, portID string, ip net.IP) error {
 	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
 		// Always get the most recent copy of this port.
-		p, err := neutronports.Get(o.neutronClient, portID).Extract()
+		client, cancel := o.withTimeout(ctx, o.neutronClient)
+		defer cancel()
+		p, err := neutronports.Get(client, portID).Extract()
 		if err != nil {
 			return err
 		}
@@ -725,7 +1641,9 @@ func (o *OpenStack) allowIPAddressOnNeutronPort(portID string, ip net.IP) error
 			AllowedAddressPairs: &allowedPairs,
 			RevisionNumber:      &p.RevisionNumber,
 		}
-		_, err = neutronports.Update(o.neutronClient, p.ID, opts).Extract()
+		client, cancel = o.withTimeout(ctx, o.neutronClient)
+		defer cancel()
+		_, err = neutronports.Update(client, p.ID, opts).Extract()
 
 		// If the update yielded an error of type "RevisionNumberConstraintFailed", then create a
 		// Conflict error. RetryOnConflict will react to this and will repeat the entire operation.
@@ -745,10 +1663,12 @@ func (o *OpenStack) allowIPAddressOnNeutronPort(portID string, ip net.IP) error
 }
 
 // unallowIPAddressOnNeutronPort removes the specified IP address from the port's allowed_address_pairs.
-func (o *OpenStack) unallowIPAddressOnNeutronPort(portID string, ip net.IP) error {
+func (o *OpenStack) unallowIPAddressOnNeutronPort(ctx context.Context, portID string, ip net.IP) error {
 	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
 		// Always get the most recent copy of this port.
-		p, err := neutronports.Get(o.neutronClient, portID).Extract()
+		client, cancel := o.withTimeout(ctx, o.neutronClient)
+		defer cancel()
+		p, err := neutronports.Get(client, portID).Extract()
 		if err != nil {
 			return err
 		}
@@ -763,7 +1683,7 @@ func (o *OpenStack) unallowIPAddressOnNeutronPort(portID string, ip net.IP) erro
 		// the one that we want to remove.
 		var allowedPairs []neutronports.AddressPair
 		for _, aap := range p.AllowedAddressPairs {
-			if ip.Equal(net.ParseIP(aap.IPAddress)) {
+			if ip.Equal(ParseIP(aap.IPAddress)) {
 				continue
 			}
 			allowedPairs = append(allowedPairs, aap)
@@ -776,7 +1696,9 @@ func (o *OpenStack) unallowIPAddressOnNeutronPort(portID string, ip net.IP) erro
 			AllowedAddressPairs: &allowedPairs,
 			RevisionNumber:      &p.RevisionNumber,
 		}
-		_, err = neutronports.Update(o.neutronClient, p.ID, opts).Extract()
+		client, cancel = o.withTimeout(ctx, o.neutronClient)
+		defer cancel()
+		_, err = neutronports.Update(client, p.ID, opts).Extract()
 
 		// If the update yielded an error of type "RevisionNumberConstraintFailed", then create a
 		// Conflict error. RetryOnConflict will react to this and will repeat the entire operation.
@@ -797,7 +1719,7 @@ func (o *OpenStack) unallowIPAddressOnNeutronPort(portID string, ip net.IP) erro
 
 // getNeutronSubnetsForNetwork returns all subnets that belong to the given network with
 // ID <networkID>.
-func (o *OpenStack) getNeutronSubnetsForNetwork(networkID string) ([]neutronsubnets.Subnet, error) {
+func (o *OpenStack) getNeutronSubnetsForNetwork(ctx context.Context, networkID string) ([]neutronsubnets.Subnet, error) {
 	var subnets []neutronsubnets.Subnet
 
 	if _, err := uuid.Parse(networkID); err != nil {
@@ -805,7 +1727,9 @@ func (o *OpenStack) getNeutronSubnetsForNetwork(networkID string) ([]neutronsubn
 	}
 
 	opts := neutronsubnets.ListOpts{NetworkID: networkID}
-	pager := neutronsubnets.List(o.neutronClient, opts)
+	client, cancel := o.withTimeout(ctx, o.neutronClient)
+	defer cancel()
+	pager := neutronsubnets.List(client, opts)
 	err := pager.EachPage(func(page pagination.Page) (bool, error) {
 		subnetList, err := neutronsubnets.ExtractSubnets(page)
 		if err != nil {
@@ -821,21 +1745,135 @@ func (o *OpenStack) getNeutronSubnetsForNetwork(networkID string) ([]neutronsubn
 }
 
 // getNovaServer gets the nova server with ID == <serverID>.
-func (o *OpenStack) getNovaServer(serverID string) (*novaservers.Server, error) {
+func (o *OpenStack) getNovaServer(ctx context.Context, serverID string) (*novaservers.Server, error) {
 	if _, err := uuid.Parse(serverID); err != nil {
 		return nil, fmt.Errorf("serverID '%s' is not a valid UUID", serverID)
 	}
 
-	server, err := novaservers.Get(o.novaClient, serverID).Extract()
+	client, cancel := o.withTimeout(ctx, o.novaClient)
+	defer cancel()
+	server, err := novaservers.Get(client, serverID).Extract()
 	if err != nil {
 		return nil, err
 	}
 	return server, nil
 }
 
+// getNovaServerAvailabilityZone returns the availability zone of the nova server with
+// ID == <serverID>.
+func (o *OpenStack) getNovaServerAvailabilityZone(ctx context.Context, serverID string) (string, error) {
+	if _, err := uuid.Parse(serverID); err != nil {
+		return "", fmt.Errorf("serverID '%s' is not a valid UUID", serverID)
+	}
+
+	var server struct {
+		novaservers.Server
+		availabilityzones.ServerAvailabilityZoneExt
+	}
+	client, cancel := o.withTimeout(ctx, o.novaClient)
+	defer cancel()
+	if err := novaservers.Get(client, serverID).ExtractInto(&server); err != nil {
+		return "", err
+	}
+	return server.AvailabilityZone, nil
+}
+
+// NetworkAvailabilityZoneExt is an extension to the base network object, gophercloud
+// only knows about the requested availability_zone_hints. It must be exported for
+// gophercloud to be able to extract into it.
+type NetworkAvailabilityZoneExt struct {
+	AvailabilityZones []string `json:"availability_zones"`
+}
+
+// NetworkPortSecurityExt is an extension to the base network and port objects.
+// Contrary to gophercloud's portsecurity.PortSecurityExt, it allows us to tell a
+// disabled port security apart from a cloud without the port-security extension.
+type NetworkPortSecurityExt struct {
+	PortSecurityEnabled *bool `json:"port_security_enabled"`
+}
+
+// neutronPort is a neutron port together with all extensions we care about.
+type neutronPort struct {
+	neutronports.Port
+	NetworkPortSecurityExt
+}
+
+// neutronNetwork is a neutron network together with all extensions we care about.
+type neutronNetwork struct {
+	neutronnetworks.Network
+	NetworkAvailabilityZoneExt
+	NetworkPortSecurityExt
+	external.NetworkExternalExt
+	provider.NetworkProviderExt
+}
+
+// getNeutronNetwork gets the neutron network with ID == <networkID>.
+func (o *OpenStack) getNeutronNetwork(ctx context.Context, networkID string) (*neutronNetwork, error) {
+	if _, err := uuid.Parse(networkID); err != nil {
+		return nil, fmt.Errorf("networkID '%s' is not a valid UUID", networkID)
+	}
+
+	var network neutronNetwork
+	client, cancel := o.withTimeout(ctx, o.neutronClient)
+	defer cancel()
+	if err := neutronnetworks.Get(client, networkID).ExtractInto(&network); err != nil {
+		return nil, err
+	}
+	return &network, nil
+}
+
+// getNeutronNetworkAvailabilityZones returns the availability zones of the network with
+// ID == <networkID>. Those are the zones the network is actually scheduled to, falling
+// back to the zones it was requested to be scheduled to if neutron does not report them.
+// An empty result means that the network is not scoped to any availability zone.
+func (o *OpenStack) getNeutronNetworkAvailabilityZones(ctx context.Context, networkID string) ([]string, error) {
+	network, err := o.getNeutronNetwork(ctx, networkID)
+	if err != nil {
+		return nil, err
+	}
+	if len(network.AvailabilityZones) > 0 {
+		return network.AvailabilityZones, nil
+	}
+	return network.AvailabilityZoneHints, nil
+}
+
+// skipAllowedAddressPairs returns true if allowed_address_pairs must not be managed on
+// the port with ID == <portID>, of the network with ID == <networkID>. Neutron refuses
+// allowed_address_pairs on ports without port security. Ports get the
+// port_security_enabled of their network by default, but it may be overridden on each
+// port, hence the port's is checked first, the network's only if neutron doesn't report
+// it. Those ports don't filter any traffic though, so following
+// OpenStackPortSecurityDisabledPolicy, we can either skip the allowed_address_pairs and
+// only keep the reservation port for IPAM, or fail.
+func (o *OpenStack) skipAllowedAddressPairs(ctx context.Context, portID, networkID string) (bool, error) {
+	var port neutronPort
+	client, cancel := o.withTimeout(ctx, o.neutronClient)
+	defer cancel()
+	if err := neutronports.Get(client, portID).ExtractInto(&port); err != nil {
+		return false, err
+	}
+	portSecurityEnabled, disabledOn := port.PortSecurityEnabled, "port "+portID
+	if portSecurityEnabled == nil {
+		network, err := o.getNeutronNetwork(ctx, networkID)
+		if err != nil {
+			return false, err
+		}
+		portSecurityEnabled, disabledOn = network.PortSecurityEnabled, "network "+networkID
+	}
+	if portSecurityEnabled == nil || *portSecurityEnabled {
+		return false, nil
+	}
+	if o.cfg.OpenStackPortSecurityDisabledPolicy == OpenStackPortSecurityDisabledPolicySkip {
+		return true, nil
+	}
+	return false, fmt.Errorf("port security is disabled on %s, hence IP addresses cannot be added to its allowed_address_pairs; "+
+		"use policy '%s' to only reserve IP addresses on such ports",
+		disabledOn, OpenStackPortSecurityDisabledPolicySkip)
+}
+
 // listNovaServerPorts lists all ports that are attached to the provided nova server
 // with ID == <serverID>.
-func (o *OpenStack) listNovaServerPorts(serverID string) ([]neutronports.Port, error) {
+func (o *OpenStack) listNovaServerPorts(ctx context.Context, serverID string) ([]neutronports.Port, error) {
 	var err error
 	var serverPorts []neutronports.Port
 
@@ -848,7 +1886,9 @@ func (o *OpenStack) listNovaServerPorts(serverID string) ([]neutronports.Port, e
 		DeviceID:    serverID,
 	}
 
-	pager := neutronports.List(o.neutronClient, portListOpts)
+	client, cancel := o.withTimeout(ctx, o.neutronClient)
+	defer cancel()
+	pager := neutronports.List(client, portListOpts)
 	err = pager.EachPage(func(page pagination.Page) (bool, error) {
 		portList, err := neutronports.ExtractPorts(page)
 		if err != nil {
@@ -863,11 +1903,41 @@ func (o *OpenStack) listNovaServerPorts(serverID string) ([]neutronports.Port, e
 	return serverPorts, nil
 }
 
+// listNeutronReservationPorts lists all reservation ports which are owned by the nova
+// server with ID == <serverID>.
+func (o *OpenStack) listNeutronReservationPorts(ctx context.Context, serverID string) ([]neutronports.Port, error) {
+	var ports []neutronports.Port
+
+	if _, err := uuid.Parse(serverID); err != nil {
+		return nil, fmt.Errorf("serverID '%s' is not a valid UUID", serverID)
+	}
+
+	portListOpts := neutronports.ListOpts{
+		DeviceOwner: egressIPTag,
+		DeviceID:    generateDeviceID(serverID),
+	}
+	client, cancel := o.withTimeout(ctx, o.neutronClient)
+	defer cancel()
+	pager := neutronports.List(client, portListOpts)
+	err := pager.EachPage(func(page pagination.Page) (bool, error) {
+		portList, err := neutronports.ExtractPorts(page)
+		if err != nil {
+			return false, err
+		}
+		ports = append(ports, portList...)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ports, nil
+}
+
 // isIPAddressAllowedOnNeutronPort returns true if the given IP address can be found inside the
 // list of allowed_address_pairs for this port.
 func isIPAddressAllowedOnNeutronPort(p neutronports.Port, ip net.IP) bool {
 	for _, aap := range p.AllowedAddressPairs {
-		if ip.Equal(net.ParseIP(aap.IPAddress)) {
+		if ip.Equal(ParseIP(aap.IPAddress)) {
 			return true
 		}
 
@@ -884,7 +1954,220 @@ func getNovaServerIDFromProviderID(providerID string) (string, error) {
 	return serverID, nil
 }
 
+// getStandbyServerID returns the ID of the standby server designated by the
+// OpenStackStandbyServerAnnotation of node, whose own server is serverID. It
+// returns an empty string if standby assignments are disabled or if the node
+// has no standby.
+func (o *OpenStack) getStandbyServerID(node *corev1.Node, serverID string) (string, error) {
+	if !o.cfg.OpenStackStandbyAssignments {
+		return "", nil
+	}
+	standbyServerID, ok := node.Annotations[OpenStackStandbyServerAnnotation]
+	if !ok || standbyServerID == serverID {
+		return "", nil
+	}
+	if _, err := uuid.Parse(standbyServerID); err != nil {
+		return "", fmt.Errorf("cannot parse valid nova server ID from annotation %s '%s' of node %s", OpenStackStandbyServerAnnotation, standbyServerID, node.Name)
+	}
+	return standbyServerID, nil
+}
+
+// allowIPAddressOnStandbyServer adds ip to the allowed_address_pairs of the port
+// of the standby server attached to the network networkID. The standby server is
+// first recorded on reservation, the reservation port of ip, if any, so that ip
+// is removed from it once it's not the standby anymore, see
+// unallowIPAddressOnStandbyServers.
+func (o *OpenStack) allowIPAddressOnStandbyServer(ctx context.Context, reservation *neutronports.Port, standbyServerID, networkID string, ip net.IP) error {
+	if reservation != nil && !sets.NewString(reservation.Tags...).Has(openstackStandbyTagPrefix+standbyServerID) {
+		client, cancel := o.withTimeout(ctx, o.neutronClient)
+		defer cancel()
+		if err := attributestags.Add(client, "ports", reservation.ID, openstackStandbyTagPrefix+standbyServerID).ExtractErr(); err != nil {
+			return fmt.Errorf("could not record standby server %s on reservation port %s, err: %q", standbyServerID, reservation.ID, err)
+		}
+	}
+	standbyPorts, err := o.listNovaServerPorts(ctx, standbyServerID)
+	if err != nil {
+		return err
+	}
+	for _, standbyPort := range standbyPorts {
+		if standbyPort.NetworkID != networkID {
+			continue
+		}
+		if err := o.allowIPAddressOnNeutronPort(ctx, standbyPort.ID, ip); err != nil && !errors.Is(err, AlreadyExistingIPError) {
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("standby server %s has no port on network %s", standbyServerID, networkID)
+}
+
+// standbyServerIDsOf returns the standby servers recorded on a reservation
+// port, see allowIPAddressOnStandbyServer.
+func standbyServerIDsOf(reservation neutronports.Port) []string {
+	standbyServerIDs := []string{}
+	for _, tag := range reservation.Tags {
+		if strings.HasPrefix(tag, openstackStandbyTagPrefix) {
+			standbyServerIDs = append(standbyServerIDs, strings.TrimPrefix(tag, openstackStandbyTagPrefix))
+		}
+	}
+	return standbyServerIDs
+}
+
+// unallowIPAddressOnStandbyServers removes ip from the allowed_address_pairs of
+// the ports of the standby servers, each under its server's lock, and forgets
+// them on reservation, unless it's nil.
+func (o *OpenStack) unallowIPAddressOnStandbyServers(ctx context.Context, ip net.IP, standbyServerIDs []string, reservation *neutronports.Port) error {
+	for _, standbyServerID := range standbyServerIDs {
+		if err := o.unallowIPAddressOnServer(ctx, ip, standbyServerID); err != nil {
+			return err
+		}
+		if reservation == nil {
+			continue
+		}
+		if err := o.forgetStandbyServer(ctx, reservation, standbyServerID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forgetStandbyServer removes the tag recording standbyServerID as a standby of
+// the IP address of reservation.
+func (o *OpenStack) forgetStandbyServer(ctx context.Context, reservation *neutronports.Port, standbyServerID string) error {
+	var notFound gophercloud.ErrDefault404
+	client, cancel := o.withTimeout(ctx, o.neutronClient)
+	defer cancel()
+	if err := attributestags.Delete(client, "ports", reservation.ID, openstackStandbyTagPrefix+standbyServerID).ExtractErr(); err != nil && !errors.As(err, &notFound) {
+		return fmt.Errorf("could not forget standby server %s on reservation port %s, err: %q", standbyServerID, reservation.ID, err)
+	}
+	return nil
+}
+
+// unallowIPAddressOnServer removes ip from the allowed_address_pairs of the
+// ports of the server, under its lock.
+func (o *OpenStack) unallowIPAddressOnServer(ctx context.Context, ip net.IP, serverID string) error {
+	defer o.serverLocks.Lock(serverID)()
+	ports, err := o.listNovaServerPorts(ctx, serverID)
+	if err != nil {
+		return err
+	}
+	for _, port := range ports {
+		if isIPAddressAllowedOnNeutronPort(port, ip) {
+			if err := o.unallowIPAddressOnNeutronPort(ctx, port.ID, ip); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// getNovaServerID returns the ID of the nova server of node. It's extracted
+// from the node's providerID if set. Otherwise, as the providerID is only set
+// by the cloud provider once the node is initialized, it falls back to the
+// OpenStackServerIDAnnotation, and then to the only nova server whose name is
+// the node's hostname and which holds the node's internal IP addresses.
+func (o *OpenStack) getNovaServerID(ctx context.Context, node *corev1.Node) (string, error) {
+	if node.Spec.ProviderID != "" {
+		return getNovaServerIDFromProviderID(node.Spec.ProviderID)
+	}
+	if serverID, ok := node.Annotations[OpenStackServerIDAnnotation]; ok {
+		if _, err := uuid.Parse(serverID); err != nil {
+			return "", fmt.Errorf("cannot parse valid nova server ID from annotation %s '%s' of node %s", OpenStackServerIDAnnotation, serverID, node.Name)
+		}
+		return serverID, nil
+	}
+	serverID, err := o.findNovaServerIDByNode(ctx, node)
+	if err != nil {
+		return "", fmt.Errorf("node %s has no providerID, and its nova server could not be found, err: %q", node.Name, err)
+	}
+	klog.Infof("Node %s has no providerID, using nova server %s matching its hostname and addresses", node.Name, serverID)
+	return serverID, nil
+}
+
+// nodeInternalIPs returns the internal IP addresses of node, if any.
+func nodeInternalIPs(node *corev1.Node) []net.IP {
+	if node == nil {
+		return nil
+	}
+	var internalIPs []net.IP
+	for _, address := range node.Status.Addresses {
+		if address.Type != corev1.NodeInternalIP {
+			continue
+		}
+		if ip := ParseIP(address.Address); ip != nil {
+			internalIPs = append(internalIPs, ip)
+		}
+	}
+	return internalIPs
+}
+
+// findNovaServerIDByNode looks up the nova server named after the hostname of
+// node. If several servers share the name, only those holding all internal IP
+// addresses of the node are considered. Exactly one server must remain.
+func (o *OpenStack) findNovaServerIDByNode(ctx context.Context, node *corev1.Node) (string, error) {
+	hostname := node.Name
+	for _, address := range node.Status.Addresses {
+		if address.Type == corev1.NodeHostName {
+			hostname = address.Address
+		}
+	}
+	internalIPs := nodeInternalIPs(node)
+
+	var serverIDs []string
+	// Nova matches names as regular expressions.
+	listOpts := novaservers.ListOpts{Name: "^" + regexp.QuoteMeta(hostname) + "$"}
+	client, cancel := o.withTimeout(ctx, o.novaClient)
+	defer cancel()
+	err := novaservers.List(client, listOpts).EachPage(func(page pagination.Page) (bool, error) {
+		var servers []struct {
+			ID        string                           `json:"id"`
+			Addresses map[string][]novaservers.Address `json:"addresses"`
+		}
+		if err := novaservers.ExtractServersInto(page, &servers); err != nil {
+			return false, err
+		}
+		for _, server := range servers {
+			if novaServerHoldsIPs(server.Addresses, internalIPs) {
+				serverIDs = append(serverIDs, server.ID)
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(serverIDs) != 1 {
+		return "", fmt.Errorf("expected exactly one nova server named '%s' with addresses %v, found %d", hostname, internalIPs, len(serverIDs))
+	}
+	return serverIDs[0], nil
+}
+
+// novaServerHoldsIPs returns true if all ips are among the addresses of a nova
+// server.
+func novaServerHoldsIPs(addresses map[string][]novaservers.Address, ips []net.IP) bool {
+	for _, ip := range ips {
+		found := false
+		for _, networkAddresses := range addresses {
+			for _, address := range networkAddresses {
+				if ip.Equal(ParseIP(address.Address)) {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
 // generateDeviceID is a tiny helper to allow us to work around https://bugzilla.redhat.com/show_bug.cgi?id=2109162.
 func generateDeviceID(serverID string) string {
 	return fmt.Sprintf("%s_%s", egressIPTag, serverID)
 }
+
+// generateDNSName returns the dns_name of the reservation port of ip. DNS names are
+// labels, hence dots and colons of the IP address are replaced by dashes.
+func generateDNSName(ip net.IP) string {
+	return "egressip-" + strings.NewReplacer(".", "-", ":", "-").Replace(ip.String())
+}
@@ -0,0 +1,143 @@
+package cloudprovider
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/utils/openstack/clientconfig"
+)
+
+// openstackSystemScopeAll is the only system scope keystone knows of.
+const openstackSystemScopeAll = "all"
+
+// openstackCloudsExtra holds the settings of clouds.yaml that clientconfig
+// doesn't parse.
+type openstackCloudsExtra struct {
+	Clouds map[string]struct {
+		Auth struct {
+			// SystemScope requests a system-scoped token, which is not
+			// bound to any project or domain.
+			SystemScope string `yaml:"system_scope,omitempty"`
+		} `yaml:"auth,omitempty"`
+	} `yaml:"clouds"`
+}
+
+// openstackAuthOptions returns the authentication options for cloud, scoped
+// to the system if systemScope is set. In clouds with several domains,
+// keystone only answers a generic 401 to a user or project it can't resolve,
+// so the options are validated beforehand: users and projects given by name
+// need their domain, and the token must be scoped to a project or to the
+// system, the scopes covering the ports of the nodes. Domain-scoped and
+// unscoped tokens are refused.
+func openstackAuthOptions(cloud *clientconfig.Cloud, systemScope string) (*gophercloud.AuthOptions, error) {
+	auth := cloud.AuthInfo
+	if auth == nil {
+		return nil, fmt.Errorf("invalid clouds.yaml file. Missing auth section for cloud name '%s'", openstackCloudName)
+	}
+	applicationCredential := auth.ApplicationCredentialID != "" || auth.ApplicationCredentialName != ""
+	token := strings.Contains(string(cloud.AuthType), "token") || auth.Token != ""
+	projectScoped := auth.ProjectID != "" || auth.ProjectName != ""
+
+	// Application credentials identified by name, and passwords, belong to
+	// a user. Application credentials identified by ID and tokens don't
+	// need one.
+	if !token && auth.ApplicationCredentialID == "" {
+		if auth.UserID == "" && auth.Username == "" {
+			return nil, fmt.Errorf("invalid clouds.yaml file. Neither username nor user_id set for cloud name '%s'", openstackCloudName)
+		}
+		if auth.UserID == "" && auth.UserDomainID == "" && auth.UserDomainName == "" && auth.DomainID == "" && auth.DomainName == "" && auth.DefaultDomain == "" {
+			return nil, fmt.Errorf("invalid clouds.yaml file. User '%s' needs a domain: user names are only unique within a domain, set user_domain_name or user_domain_id, or use user_id instead", auth.Username)
+		}
+	}
+
+	switch {
+	case systemScope != "":
+		if systemScope != openstackSystemScopeAll {
+			return nil, fmt.Errorf("invalid clouds.yaml file. Invalid system_scope '%s', expected '%s'", systemScope, openstackSystemScopeAll)
+		}
+		if projectScoped || applicationCredential {
+			return nil, fmt.Errorf("invalid clouds.yaml file. system_scope can't be combined with a project or an application credential, which carry their own scope: remove project_name/project_id or system_scope")
+		}
+	case applicationCredential:
+		// Application credentials are bound to the project they were
+		// created in, they can't be scoped otherwise.
+	case !projectScoped && (auth.DomainID != "" || auth.DomainName != ""):
+		return nil, fmt.Errorf("invalid clouds.yaml file. No project set: domain-scoped tokens don't allow managing the ports of the nodes, set project_name or project_id, or system_scope: %s", openstackSystemScopeAll)
+	case !projectScoped:
+		return nil, fmt.Errorf("invalid clouds.yaml file. No project set: unscoped tokens carry no service catalog, set project_name or project_id, or system_scope: %s", openstackSystemScopeAll)
+	case auth.ProjectID == "" && auth.ProjectDomainID == "" && auth.ProjectDomainName == "" && auth.DomainID == "" && auth.DomainName == "" && auth.DefaultDomain == "":
+		return nil, fmt.Errorf("invalid clouds.yaml file. Project '%s' needs a domain: project names are only unique within a domain, set project_domain_name or project_domain_id, or use project_id instead", auth.ProjectName)
+	}
+
+	opts, err := clientconfig.AuthOptions(&clientconfig.ClientOpts{
+		Cloud:      cloud.Cloud,
+		AuthType:   cloud.AuthType,
+		AuthInfo:   auth,
+		RegionName: cloud.RegionName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if systemScope != "" {
+		opts.Scope = &gophercloud.AuthScope{System: true}
+		opts.TenantID, opts.TenantName = "", ""
+	}
+	return opts, nil
+}
+
+// describeOpenStackAuth describes who authenticates with which scope, in the
+// terms of clouds.yaml.
+func describeOpenStackAuth(auth *clientconfig.AuthInfo, systemScope string) string {
+	user := "token"
+	switch {
+	case auth.ApplicationCredentialID != "":
+		user = fmt.Sprintf("application credential %s", auth.ApplicationCredentialID)
+	case auth.UserID != "":
+		user = fmt.Sprintf("user %s", auth.UserID)
+	case auth.Username != "":
+		user = fmt.Sprintf("user '%s' in domain '%s'", auth.Username, firstNonEmpty(auth.UserDomainName, auth.UserDomainID, auth.DomainName, auth.DomainID, auth.DefaultDomain))
+	}
+	switch {
+	case systemScope != "":
+		return fmt.Sprintf("%s scoped to the system", user)
+	case auth.ProjectID != "":
+		return fmt.Sprintf("%s scoped to project %s", user, auth.ProjectID)
+	case auth.ProjectName != "":
+		return fmt.Sprintf("%s scoped to project '%s' in domain '%s'", user, auth.ProjectName, firstNonEmpty(auth.ProjectDomainName, auth.ProjectDomainID, auth.DomainName, auth.DomainID, auth.DefaultDomain))
+	}
+	return user
+}
+
+// openstackAuthError adds guidance to the errors keystone answers
+// authentication with, for which it doesn't give any reason itself.
+func openstackAuthError(err error, description string) error {
+	var unauthorized gophercloud.ErrDefault401
+	if errors.As(err, &unauthorized) {
+		return fmt.Errorf("keystone refused to authenticate %s: check the credentials, that the user and project domains are the right ones and that the user has a role on the project or system, err: %q", description, err)
+	}
+	return fmt.Errorf("could not authenticate %s, err: %q", description, err)
+}
+
+// checkOpenStackCatalog checks that the service catalog the token was issued
+// with lists the compute and network services. Keystone doesn't refuse tokens
+// whose catalog lacks them, e.g. with endpoint filtering for their project,
+// creating the clients would only fail with a generic error.
+func checkOpenStackCatalog(provider *gophercloud.ProviderClient, description string) error {
+	for _, service := range []string{"compute", "network"} {
+		if _, err := provider.EndpointLocator(gophercloud.EndpointOpts{Type: service, Availability: gophercloud.AvailabilityPublic}); err != nil {
+			return fmt.Errorf("the token of %s has no %s endpoint in its service catalog, check the endpoints available in that scope, err: %q", description, service, err)
+		}
+	}
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
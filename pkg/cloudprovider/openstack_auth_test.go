@@ -0,0 +1,174 @@
+package cloudprovider
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	tokens3 "github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"gopkg.in/yaml.v2"
+)
+
+func TestOpenStackAuthOptions(t *testing.T) {
+	tcs := []struct {
+		auth string
+		// scope is the expected token scope, errContains what the error
+		// must point at if one is expected.
+		scope       gophercloud.AuthScope
+		errContains string
+	}{
+		{
+			auth: `
+      username: admin
+      user_domain_name: users
+      project_name: openshift
+      project_domain_name: projects`,
+			scope: gophercloud.AuthScope{ProjectName: "openshift", DomainName: "projects"},
+		},
+		// User and project in different domains, by ID.
+		{
+			auth: `
+      username: admin
+      user_domain_id: 5a1d
+      project_name: openshift
+      project_domain_id: 7c3e`,
+			scope: gophercloud.AuthScope{ProjectName: "openshift", DomainID: "7c3e"},
+		},
+		// domain_name defaults both domains.
+		{
+			auth: `
+      username: admin
+      domain_name: shared
+      project_name: openshift`,
+			scope: gophercloud.AuthScope{ProjectName: "openshift", DomainName: "shared"},
+		},
+		{
+			auth: `
+      user_id: 0f9d
+      project_id: 8a7b`,
+			scope: gophercloud.AuthScope{ProjectID: "8a7b"},
+		},
+		{
+			auth: `
+      username: admin
+      user_domain_name: users
+      system_scope: all`,
+			scope: gophercloud.AuthScope{System: true},
+		},
+		{
+			auth: `
+      application_credential_id: 3e2f
+      application_credential_secret: secret`,
+		},
+		{
+			auth: `
+      username: admin
+      project_name: openshift
+      project_domain_name: projects`,
+			errContains: "user_domain_name",
+		},
+		{
+			auth: `
+      username: admin
+      user_domain_name: users
+      project_name: openshift`,
+			errContains: "project_domain_name",
+		},
+		{
+			auth: `
+      username: admin
+      domain_name: users`,
+			errContains: "domain-scoped",
+		},
+		{
+			auth: `
+      user_id: 0f9d`,
+			errContains: "unscoped",
+		},
+		{
+			auth: `
+      username: admin
+      user_domain_name: users
+      project_id: 8a7b
+      system_scope: all`,
+			errContains: "system_scope",
+		},
+		{
+			auth: `
+      user_id: 0f9d
+      system_scope: project`,
+			errContains: "system_scope",
+		},
+	}
+
+	for i, tc := range tcs {
+		content := []byte(`
+clouds:
+  openstack:
+    auth:
+      auth_url: https://keystone.example.com:5000/v3
+      password: password` + tc.auth + "\n")
+		var clouds clientconfig.Clouds
+		var extra openstackCloudsExtra
+		if err := yaml.Unmarshal(content, &clouds); err != nil {
+			t.Fatalf("TestOpenStackAuthOptions(%d): could not parse clouds.yaml, err: %v", i, err)
+		}
+		if err := yaml.Unmarshal(content, &extra); err != nil {
+			t.Fatalf("TestOpenStackAuthOptions(%d): could not parse clouds.yaml, err: %v", i, err)
+		}
+		cloud := clouds.Clouds[openstackCloudName]
+
+		opts, err := openstackAuthOptions(&cloud, extra.Clouds[openstackCloudName].Auth.SystemScope)
+		if tc.errContains != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.errContains) {
+				t.Fatalf("TestOpenStackAuthOptions(%d): expected an error about %s, got: %v", i, tc.errContains, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestOpenStackAuthOptions(%d): received unexpected error, err: %v", i, err)
+		}
+		if *opts.Scope != tc.scope {
+			t.Fatalf("TestOpenStackAuthOptions(%d): expected scope %+v, got %+v", i, tc.scope, *opts.Scope)
+		}
+	}
+}
+
+func TestOpenStackAuthError(t *testing.T) {
+	description := describeOpenStackAuth(&clientconfig.AuthInfo{Username: "admin", UserDomainName: "users", ProjectName: "openshift", ProjectDomainName: "projects"}, "")
+	if description != "user 'admin' in domain 'users' scoped to project 'openshift' in domain 'projects'" {
+		t.Fatalf("TestOpenStackAuthError: unexpected description %q", description)
+	}
+	err := openstackAuthError(gophercloud.ErrDefault401{}, description)
+	if !strings.Contains(err.Error(), "keystone refused to authenticate "+description) {
+		t.Fatalf("TestOpenStackAuthError: expected guidance for the 401, got: %v", err)
+	}
+
+	provider, err := openstack.NewClient("https://keystone.example.com:5000/v3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog := tokens3.ServiceCatalog{
+		Entries: []tokens3.CatalogEntry{
+			{
+				Type:      "network",
+				Endpoints: []tokens3.Endpoint{{Interface: "public", URL: "https://neutron.example.com:9696/"}},
+			},
+		},
+	}
+	provider.EndpointLocator = func(eo gophercloud.EndpointOpts) (string, error) {
+		return openstack.V3EndpointURL(&catalog, eo)
+	}
+	if err := checkOpenStackCatalog(provider, description); err == nil || !strings.Contains(err.Error(), "no compute endpoint") {
+		t.Fatalf("TestOpenStackAuthError: expected the missing compute endpoint to be reported, got: %v", err)
+	}
+	catalog.Entries = append(catalog.Entries, tokens3.CatalogEntry{
+		Type:      "compute",
+		Endpoints: []tokens3.Endpoint{{Interface: "public", URL: "https://nova.example.com:8774/v2.1/"}},
+	})
+	if err := checkOpenStackCatalog(provider, description); err != nil {
+		t.Fatalf("TestOpenStackAuthError: received unexpected error, err: %v", err)
+	}
+}
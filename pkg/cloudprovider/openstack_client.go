@@ -0,0 +1,60 @@
+package cloudprovider
+
+import (
+	"context"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+// requestContext returns the context of a call to the OpenStack API on
+// behalf of ctx, cancelled with ctx, when the controller shuts down or once
+// OpenStackRequestTimeout elapsed, and the function releasing it.
+func (o *OpenStack) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	var cancel context.CancelFunc
+	if o.cfg.OpenStackRequestTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, o.cfg.OpenStackRequestTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	o.cancelOnShutdown(ctx, cancel)
+	return ctx, cancel
+}
+
+// withTimeout returns a copy of client whose requests are bound to a
+// requestContext of their own, and the function releasing it. gophercloud
+// binds all requests of a provider client to its Context, hence each call
+// gets a provider client of its own, which bounds the call as a whole, all
+// pages of a listing included. The copy uses the token of client, and
+// re-authenticates through it.
+func (o *OpenStack) withTimeout(ctx context.Context, client *gophercloud.ServiceClient) (*gophercloud.ServiceClient, context.CancelFunc) {
+	ctx, cancel := o.requestContext(ctx)
+	shared := client.ProviderClient
+	provider := &gophercloud.ProviderClient{
+		IdentityBase:      shared.IdentityBase,
+		IdentityEndpoint:  shared.IdentityEndpoint,
+		EndpointLocator:   shared.EndpointLocator,
+		HTTPClient:        shared.HTTPClient,
+		UserAgent:         shared.UserAgent,
+		Context:           ctx,
+		RetryBackoffFunc:  shared.RetryBackoffFunc,
+		MaxBackoffRetries: shared.MaxBackoffRetries,
+		RetryFunc:         shared.RetryFunc,
+	}
+	// The copy has locks of its own: it re-authenticates while holding its
+	// lock, which must not be the one of client re-authenticating.
+	provider.UseTokenLock()
+	provider.CopyTokenFrom(shared)
+	if shared.ReauthFunc != nil {
+		provider.ReauthFunc = func() error {
+			// Skipped if the token was already renewed meanwhile.
+			if err := shared.Reauthenticate(provider.Token()); err != nil {
+				return err
+			}
+			provider.CopyTokenFrom(shared)
+			return nil
+		}
+	}
+	bound := *client
+	bound.ProviderClient = provider
+	return &bound, cancel
+}
@@ -0,0 +1,116 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	th "github.com/gophercloud/gophercloud/testhelper"
+	testclient "github.com/gophercloud/gophercloud/testhelper/client"
+)
+
+func TestOpenStackRequestTimeout(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	// The port listing hangs until the client gives up.
+	th.Mux.HandleFunc("/ports", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	o := OpenStack{
+		CloudProvider: CloudProvider{
+			ctx: context.Background(),
+			cfg: CloudProviderConfig{OpenStackRequestTimeout: 50 * time.Millisecond},
+		},
+		neutronClient: testclient.ServiceClient(),
+	}
+	start := time.Now()
+	_, err := o.listNovaServerPorts(context.Background(), "9e5476bd-a4ec-4653-93d6-72c93aa682ba")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the listing to time out, got err: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("the listing timed out after %v only", elapsed)
+	}
+
+	// The timeout bounds each call, not the provider: the next call has a
+	// full timeout of its own.
+	if _, err := o.listNovaServerPorts(context.Background(), "9e5476bd-a4ec-4653-93d6-72c93aa682ba"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the second listing to time out as well, got err: %v", err)
+	}
+}
+
+func TestOpenStackRequestShutdown(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	th.Mux.HandleFunc("/ports", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	shutdown, stop := context.WithCancel(context.Background())
+	o := OpenStack{
+		CloudProvider: CloudProvider{
+			ctx: context.Background(),
+			cfg: CloudProviderConfig{ShutdownContext: shutdown},
+		},
+		neutronClient: testclient.ServiceClient(),
+	}
+	time.AfterFunc(50*time.Millisecond, stop)
+	_, err := o.listNovaServerPorts(context.Background(), "9e5476bd-a4ec-4653-93d6-72c93aa682ba")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the listing to be cancelled on shutdown, got err: %v", err)
+	}
+}
+
+func TestOpenStackRequestReauthenticates(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	th.Mux.HandleFunc("/ports", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Auth-Token") != "renewed" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ports": []}`)
+	})
+
+	shared := &gophercloud.ProviderClient{}
+	shared.UseTokenLock()
+	shared.SetToken(testclient.TokenID)
+	reauths := 0
+	shared.ReauthFunc = func() error {
+		reauths++
+		shared.SetToken("renewed")
+		return nil
+	}
+	o := OpenStack{
+		CloudProvider: CloudProvider{
+			ctx: context.Background(),
+			cfg: CloudProviderConfig{OpenStackRequestTimeout: time.Minute},
+		},
+		neutronClient: &gophercloud.ServiceClient{
+			ProviderClient: shared,
+			Endpoint:       th.Endpoint(),
+		},
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := o.listNovaServerPorts(context.Background(), "9e5476bd-a4ec-4653-93d6-72c93aa682ba"); err != nil {
+			t.Fatalf("listing #%d: unexpected err: %v", i, err)
+		}
+	}
+	// The renewed token is the one of the shared client, the second call
+	// reuses it.
+	if reauths != 1 {
+		t.Fatalf("expected a single re-authentication, got %d", reauths)
+	}
+	if token := shared.Token(); token != "renewed" {
+		t.Fatalf("expected the shared client to hold the renewed token, got %q", token)
+	}
+}
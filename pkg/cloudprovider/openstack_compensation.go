@@ -0,0 +1,127 @@
+package cloudprovider
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	neutronports "github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/openshift/cloud-network-config-controller/pkg/journal"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// openstackCompensationBaseDelay and openstackCompensationMaxDelay bound
+	// the exponential backoff between attempts at releasing a reservation port.
+	openstackCompensationBaseDelay = time.Second
+	openstackCompensationMaxDelay  = 5 * time.Minute
+)
+
+// openstackCompensation is a reservation port which must be released because
+// the assignment it was created for failed half-way.
+type openstackCompensation struct {
+	portID   string
+	serverID string
+}
+
+// enqueueCompensation queues the release of a reservation port. Releases are
+// retried with backoff in the background until they succeed, independently of
+// the assignment which created the port, so that no worker is blocked on it.
+// They stop with the controller, those still pending are resumed from the
+// journal by the next leader.
+func (o *OpenStack) enqueueCompensation(c openstackCompensation) {
+	o.compensationsOnce.Do(func() {
+		o.compensations = workqueue.NewNamedRateLimitingQueue(
+			workqueue.NewItemExponentialFailureRateLimiter(openstackCompensationBaseDelay, openstackCompensationMaxDelay),
+			"openstack-compensations",
+		)
+		go o.runCompensations()
+		if o.cfg.ShutdownContext != nil {
+			go func() {
+				<-o.cfg.ShutdownContext.Done()
+				o.compensations.ShutDown()
+			}()
+		}
+	})
+	if o.journal != nil {
+		if err := o.journal.Put(c.portID, c.serverID); err != nil {
+			klog.Warningf("Could not persist the pending release of neutron port reservation %s, err: %q", c.portID, err)
+		}
+	}
+	o.compensations.Add(c)
+}
+
+// restoreCompensations opens the journal of pending releases and queues the
+// ones persisted before a restart, so that reservation ports of assignments
+// which failed half-way are released without rescanning the cloud. Failing to
+// open the journal is not fatal, pending releases are then only kept in memory.
+func (o *OpenStack) restoreCompensations() {
+	j, err := journal.Open(o.cfg.OpenStackJournalStore)
+	if err != nil {
+		klog.Warningf("Could not restore the pending releases of neutron port reservations, they won't be persisted, err: %q", err)
+		return
+	}
+	o.journal = j
+	entries := j.Entries()
+	if len(entries) == 0 {
+		return
+	}
+	// The releases are replayed outside of the read-only and dry-run
+	// wrappers, which can't refuse them.
+	if o.cfg.ReadOnly || o.cfg.DryRun {
+		klog.Infof("Not releasing %d persisted neutron port reservations in read-only or dry-run mode", len(entries))
+		return
+	}
+	klog.Infof("Restoring %d pending releases of neutron port reservations", len(entries))
+	for portID, serverID := range entries {
+		o.enqueueCompensation(openstackCompensation{portID: portID, serverID: serverID})
+	}
+	if err := j.Compact(); err != nil {
+		klog.Warningf("Could not compact the journal of pending releases of neutron port reservations, err: %q", err)
+	}
+}
+
+func (o *OpenStack) runCompensations() {
+	for o.processNextCompensation() {
+	}
+}
+
+func (o *OpenStack) processNextCompensation() bool {
+	item, shutdown := o.compensations.Get()
+	if shutdown {
+		return false
+	}
+	defer o.compensations.Done(item)
+
+	c := item.(openstackCompensation)
+	if err := o.compensate(c); err != nil {
+		klog.Warningf("Could not release neutron port reservation %s after %d tries, will retry, err: %q",
+			c.portID, o.compensations.NumRequeues(item)+1, err)
+		o.compensations.AddRateLimited(item)
+		return true
+	}
+	o.compensations.Forget(item)
+	klog.Infof("Released neutron port reservation %s", c.portID)
+	if o.journal != nil {
+		if err := o.journal.Delete(c.portID); err != nil {
+			klog.Warningf("Could not persist the release of neutron port reservation %s, err: %q", c.portID, err)
+		}
+	}
+	return true
+}
+
+// compensate releases the reservation port of c, unless it's already gone.
+func (o *OpenStack) compensate(c openstackCompensation) error {
+	client, cancel := o.withTimeout(o.ctx, o.neutronClient)
+	defer cancel()
+	port, err := neutronports.Get(client, c.portID).Extract()
+	if err != nil {
+		var notFound gophercloud.ErrDefault404
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		return err
+	}
+	return o.releaseNeutronIPAddress(o.ctx, *port, c.serverID)
+}
@@ -0,0 +1,198 @@
+package cloudprovider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	neutronports "github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	th "github.com/gophercloud/gophercloud/testhelper"
+	testclient "github.com/gophercloud/gophercloud/testhelper/client"
+	"github.com/openshift/cloud-network-config-controller/pkg/journal"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestCompensation(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	serverID := "9e5476bd-a4ec-4653-93d6-72c93aa682ba"
+	reservation := neutronports.Port{
+		ID:          "4d8c2b0a-5f6e-4a7b-c2d3-e4f5a6b7c8d9",
+		NetworkID:   "57d1274f-4717-43f1-88ec-0944546a14ef",
+		DeviceOwner: egressIPTag,
+		DeviceID:    generateDeviceID(serverID),
+	}
+	portMap[reservation.ID] = reservation
+	defer delete(portMap, reservation.ID)
+
+	// Fail the first release, as if neutron was unavailable.
+	deletes := 0
+	th.Mux.HandleFunc("/ports/"+reservation.ID, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			deletes++
+			if deletes == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			delete(portMap, reservation.ID)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if _, ok := portMap[reservation.ID]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.Write([]byte(`{"port": {"id": "` + reservation.ID + `", "device_owner": "` + reservation.DeviceOwner + `", "device_id": "` + reservation.DeviceID + `"}}`))
+	})
+
+	o := OpenStack{
+		CloudProvider: CloudProvider{ctx: context.Background()},
+		novaClient:    testclient.ServiceClient(),
+		neutronClient: testclient.ServiceClient(),
+	}
+	o.enqueueCompensation(openstackCompensation{portID: reservation.ID, serverID: serverID})
+	defer o.compensations.ShutDown()
+
+	err := wait.PollImmediate(100*time.Millisecond, 10*openstackCompensationBaseDelay, func() (bool, error) {
+		return o.compensations.Len() == 0 && o.compensations.NumRequeues(openstackCompensation{portID: reservation.ID, serverID: serverID}) == 0 && deletes == 2, nil
+	})
+	if err != nil {
+		t.Fatalf("TestCompensation: expected reservation port to be released after a retry, got %d release attempts", deletes)
+	}
+	if _, ok := portMap[reservation.ID]; ok {
+		t.Fatalf("TestCompensation: expected reservation port to be released")
+	}
+}
+
+func TestRestoreCompensations(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	serverID := "9e5476bd-a4ec-4653-93d6-72c93aa682ba"
+	reservation := neutronports.Port{
+		ID:          "4d8c2b0a-5f6e-4a7b-c2d3-e4f5a6b7c8d9",
+		NetworkID:   "57d1274f-4717-43f1-88ec-0944546a14ef",
+		DeviceOwner: egressIPTag,
+		DeviceID:    generateDeviceID(serverID),
+	}
+	portMap[reservation.ID] = reservation
+	defer delete(portMap, reservation.ID)
+
+	th.Mux.HandleFunc("/ports/"+reservation.ID, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			delete(portMap, reservation.ID)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if _, ok := portMap[reservation.ID]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.Write([]byte(`{"port": {"id": "` + reservation.ID + `", "device_owner": "` + reservation.DeviceOwner + `", "device_id": "` + reservation.DeviceID + `"}}`))
+	})
+
+	// The release was pending when the controller restarted.
+	store := &journal.CustomResourceStore{Client: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()), Name: "journal"}
+	j, _ := journal.Open(store)
+	if err := j.Put(reservation.ID, serverID); err != nil {
+		t.Fatalf("TestRestoreCompensations: unexpected error, err: %v", err)
+	}
+
+	o := OpenStack{
+		CloudProvider: CloudProvider{ctx: context.Background(), cfg: CloudProviderConfig{OpenStackJournalStore: store}},
+		novaClient:    testclient.ServiceClient(),
+		neutronClient: testclient.ServiceClient(),
+	}
+	o.restoreCompensations()
+	if o.compensations == nil {
+		t.Fatalf("TestRestoreCompensations: expected the pending release to be restored")
+	}
+	defer o.compensations.ShutDown()
+
+	err := wait.PollImmediate(100*time.Millisecond, 10*openstackCompensationBaseDelay, func() (bool, error) {
+		j, err := journal.Open(store)
+		return err == nil && len(j.Entries()) == 0, nil
+	})
+	if err != nil {
+		t.Fatalf("TestRestoreCompensations: expected the release to be removed from the journal")
+	}
+	if _, ok := portMap[reservation.ID]; ok {
+		t.Fatalf("TestRestoreCompensations: expected reservation port to be released")
+	}
+}
+
+func TestRestoreCompensationsDryRun(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	deletes := 0
+	th.Mux.HandleFunc("/ports/4d8c2b0a-5f6e-4a7b-c2d3-e4f5a6b7c8d9", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			deletes++
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	store := &journal.CustomResourceStore{Client: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()), Name: "journal"}
+	j, _ := journal.Open(store)
+	if err := j.Put("4d8c2b0a-5f6e-4a7b-c2d3-e4f5a6b7c8d9", "9e5476bd-a4ec-4653-93d6-72c93aa682ba"); err != nil {
+		t.Fatalf("TestRestoreCompensationsDryRun: unexpected error, err: %v", err)
+	}
+
+	for _, cfg := range []CloudProviderConfig{{DryRun: true}, {ReadOnly: true}} {
+		cfg.OpenStackJournalStore = store
+		o := OpenStack{
+			CloudProvider: CloudProvider{ctx: context.Background(), cfg: cfg},
+			novaClient:    testclient.ServiceClient(),
+			neutronClient: testclient.ServiceClient(),
+		}
+		o.restoreCompensations()
+		if o.compensations != nil {
+			o.compensations.ShutDown()
+			t.Fatalf("TestRestoreCompensationsDryRun: expected no pending release to be replayed with %+v", cfg)
+		}
+	}
+	if deletes != 0 {
+		t.Fatalf("TestRestoreCompensationsDryRun: expected no reservation port to be deleted, got %d deletions", deletes)
+	}
+	if j, err := journal.Open(store); err != nil || len(j.Entries()) != 1 {
+		t.Fatalf("TestRestoreCompensationsDryRun: expected the pending release to be kept in the journal, err: %v", err)
+	}
+}
+
+func TestCompensationsShutdown(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	// Neutron is unavailable, the release stays pending.
+	th.Mux.HandleFunc("/ports/4d8c2b0a-5f6e-4a7b-c2d3-e4f5a6b7c8d9", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	store := &journal.CustomResourceStore{Client: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()), Name: "journal"}
+	o := OpenStack{
+		CloudProvider: CloudProvider{ctx: context.Background(), cfg: CloudProviderConfig{ShutdownContext: ctx, OpenStackJournalStore: store}},
+		novaClient:    testclient.ServiceClient(),
+		neutronClient: testclient.ServiceClient(),
+	}
+	o.restoreCompensations()
+	o.enqueueCompensation(openstackCompensation{portID: "4d8c2b0a-5f6e-4a7b-c2d3-e4f5a6b7c8d9", serverID: "9e5476bd-a4ec-4653-93d6-72c93aa682ba"})
+	cancel()
+
+	err := wait.PollImmediate(100*time.Millisecond, 10*openstackCompensationBaseDelay, func() (bool, error) {
+		return o.compensations.ShuttingDown(), nil
+	})
+	if err != nil {
+		t.Fatalf("TestCompensationsShutdown: expected the queue to shut down with the controller")
+	}
+	if j, err := journal.Open(store); err != nil || len(j.Entries()) != 1 {
+		t.Fatalf("TestCompensationsShutdown: expected the pending release to be kept in the journal for the next leader, err: %v", err)
+	}
+}
@@ -1,12 +1,15 @@
 package cloudprovider
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 
@@ -322,6 +325,31 @@ func HandleServerGet(t *testing.T) {
 	}
 }
 
+// HandleNetworkGet sets up the test networks to respond to a network Get request.
+func HandleNetworkGet(t *testing.T) {
+	for id := range networkMap {
+		th.Mux.HandleFunc("/networks/"+id, func(w http.ResponseWriter, r *http.Request) {
+			th.TestMethod(t, r, "GET")
+			th.TestHeader(t, r, "X-Auth-Token", testclient.TokenID)
+
+			networkID := strings.Split(r.URL.Path, "/")[2]
+			network, ok := networkMap[networkID]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			out, err := json.Marshal(map[string]neutronnetworks.Network{
+				"network": network,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			fmt.Fprintf(w, string(out))
+		})
+	}
+}
+
 func HandleSubnetList(t *testing.T) {
 	th.Mux.HandleFunc("/subnets", func(w http.ResponseWriter, r *http.Request) {
 		th.TestMethod(t, r, "GET")
@@ -573,15 +601,47 @@ func HandlePortGetUpdateDelete(t *testing.T, portID string) {
 		})
 	}
 
+	// Tags of the ports, only adding and deleting single tags is supported.
+	g := func(id string) {
+		th.Mux.HandleFunc("/ports/"+id+"/tags/", func(w http.ResponseWriter, r *http.Request) {
+			th.TestHeader(t, r, "X-Auth-Token", testclient.TokenID)
+			port, ok := portMap[id]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			tag := r.URL.Path[len("/ports/"+id+"/tags/"):]
+			tags := sets.NewString(port.Tags...)
+			switch r.Method {
+			case "PUT":
+				tags.Insert(tag)
+				w.WriteHeader(http.StatusCreated)
+			case "DELETE":
+				if !tags.Has(tag) {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				tags.Delete(tag)
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				t.Errorf("Request method = %v, expected PUT|DELETE", r.Method)
+			}
+			port.Tags = tags.List()
+			portMap[id] = port
+		})
+	}
+
 	// If not portID is specified, do this for all ports in the map.
 	if portID == "" {
 		for id := range portMap {
 			f(id)
+			g(id)
 		}
 		return
 	}
 	// If a portID is specified, do this for the given portID.
 	f(portID)
+	g(portID)
 }
 
 func TestOpenStackPlugin(t *testing.T) {
@@ -589,12 +649,13 @@ func TestOpenStackPlugin(t *testing.T) {
 	defer th.TeardownHTTP()
 
 	HandleSubnetList(t)
+	HandleNetworkGet(t)
 	HandlePortGetUpdateDelete(t, "")
 	HandlePortListAndCreation(t)
 	HandleServerGet(t)
 
 	o := OpenStack{
-		CloudProvider: CloudProvider{},
+		CloudProvider: CloudProvider{ctx: context.Background()},
 		novaClient:    testclient.ServiceClient(),
 		neutronClient: testclient.ServiceClient(),
 	}
@@ -603,7 +664,7 @@ func TestOpenStackPlugin(t *testing.T) {
 	n1 := &corev1.Node{}
 	n1.Name = "node1"
 	n1.Spec.ProviderID = "openstack:///9e5476bd-a4ec-4653-93d6-72c93aa682ba"
-	_, err := o.GetNodeEgressIPConfiguration(n1)
+	_, err := o.GetNodeEgressIPConfiguration(context.Background(), n1)
 	if err == nil {
 		t.Fatal("TestOpenStackPlugin: Testing node1, this should fail, but returned a nil error instead")
 	}
@@ -615,7 +676,7 @@ func TestOpenStackPlugin(t *testing.T) {
 	n2 := &corev1.Node{}
 	n2.Name = "node2"
 	n2.Spec.ProviderID = "openstack:///b5d5889f-76f9-46b1-8af9-bfdf81e96616"
-	nodeEgressIPConfiguration, err := o.GetNodeEgressIPConfiguration(n2)
+	nodeEgressIPConfiguration, err := o.GetNodeEgressIPConfiguration(context.Background(), n2)
 	if err != nil {
 		t.Fatalf("TestOpenStackPlugin: Could not generate NodeEgressIPConfiguration, err: %q", err)
 	}
@@ -665,40 +726,40 @@ func TestOpenStackPlugin(t *testing.T) {
 	}
 
 	// Now, try making several invalid assignments.
-	err = o.AssignPrivateIP(net.ParseIP("192.168.1.20"), n2)
+	err = o.AssignPrivateIP(context.Background(), net.ParseIP("192.168.1.20"), n2)
 	errString := "could not assign IP address 192.168.1.20 to node node2"
 	if err == nil || err.Error() != errString {
 		t.Fatalf("TestOpenStackPlugin: Unexpected error, got '%q' but expected '%s'", err, errString)
 	}
 
 	// IP address 192.0.2.20 is already held by another device (server1-port2).
-	err = o.AssignPrivateIP(net.ParseIP("192.0.2.20"), n2)
+	err = o.AssignPrivateIP(context.Background(), net.ParseIP("192.0.2.20"), n2)
 	errString = "but got 409 instead"
 	if err == nil || !strings.Contains(err.Error(), errString) {
 		t.Fatalf("TestOpenStackPlugin: Unexpected error, got '%q' but expected error to contain '%s'", err, errString)
 	}
 
 	// Make a successful assignment.
-	err = o.AssignPrivateIP(net.ParseIP("192.0.2.50"), n2)
+	err = o.AssignPrivateIP(context.Background(), net.ParseIP("192.0.2.50"), n2)
 	if err != nil {
 		t.Fatalf("TestOpenStackPlugin: Unexpected error, got '%q' but expected <nil>", err)
 	}
 
 	// Unrelease an unbound IP address.
-	err = o.ReleasePrivateIP(net.ParseIP("192.168.1.20"), n2)
+	err = o.ReleasePrivateIP(context.Background(), net.ParseIP("192.168.1.20"), n2)
 	errString = "the requested IP for removal is not assigned"
 	if err == nil || err.Error() != errString {
 		t.Fatalf("TestOpenStackPlugin: Unexpected error, got '%q' but expected '%s'", err, errString)
 	}
 
 	// Make a successful release request.
-	err = o.ReleasePrivateIP(net.ParseIP("192.0.2.50"), n2)
+	err = o.ReleasePrivateIP(context.Background(), net.ParseIP("192.0.2.50"), n2)
 	if err != nil {
 		t.Fatalf("TestOpenStackPlugin: Unexpected error, got '%q' but expected <nil>", err)
 	}
 
 	// Try releasing the same IP again.
-	err = o.ReleasePrivateIP(net.ParseIP("192.0.2.50"), n2)
+	err = o.ReleasePrivateIP(context.Background(), net.ParseIP("192.0.2.50"), n2)
 	errString = "the requested IP for removal is not assigned"
 	if err == nil || err.Error() != errString {
 		t.Fatalf("TestOpenStackPlugin: Unexpected error, got '%q' but expected '%s'", err, errString)
@@ -712,7 +773,7 @@ func TestGetNeutronPortNodeEgressIPConfiguration(t *testing.T) {
 	HandlePortListAndCreation(t)
 
 	o := OpenStack{
-		CloudProvider: CloudProvider{},
+		CloudProvider: CloudProvider{ctx: context.Background()},
 		novaClient:    testclient.ServiceClient(),
 		neutronClient: testclient.ServiceClient(),
 	}
@@ -761,7 +822,7 @@ func TestGetNeutronPortNodeEgressIPConfiguration(t *testing.T) {
 	}
 
 	for i, tc := range tcs {
-		nodeEgressIPConfig, err := o.getNeutronPortNodeEgressIPConfiguration(tc.port)
+		nodeEgressIPConfig, err := o.getNeutronPortNodeEgressIPConfiguration(context.Background(), tc.port, nil)
 		if err != nil {
 			if !strings.Contains(err.Error(), tc.errString) {
 				t.Fatalf("TestGetNeutronPortNodeEgressIPConfiguration(%d): Received unexpected error, err: %q, expected: %q", i, err, tc.errString)
@@ -775,6 +836,126 @@ func TestGetNeutronPortNodeEgressIPConfiguration(t *testing.T) {
 	}
 }
 
+func TestGetNeutronPortNodeEgressIPConfigurationPinnedSubnets(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+	HandleSubnetList(t)
+
+	taggedSubnetID := "379db076-b0a3-4ecd-84f6-3701137aeaea"
+	taggedSubnet := subnetMap[taggedSubnetID]
+	defer func() { subnetMap[taggedSubnetID] = taggedSubnet }()
+
+	tcs := []struct {
+		pinnedSubnets string
+		tagged        bool
+		ipv4          string
+		errString     string
+	}{
+		{
+			pinnedSubnets: "3b05bf67-4868-4d7c-9a3d-39d1e1008d71",
+			ipv4:          "192.168.125.0/24",
+		},
+		{
+			tagged: true,
+			ipv4:   "192.168.124.0/24",
+		},
+		{
+			pinnedSubnets: "3b05bf67-4868-4d7c-9a3d-39d1e1008d71",
+			tagged:        true,
+			errString:     "found multiple pinned IPv4 subnets attached to port",
+		},
+	}
+
+	for i, tc := range tcs {
+		subnet := taggedSubnet
+		if tc.tagged {
+			subnet.Tags = []string{OpenStackPinnedSubnetTag}
+		}
+		subnetMap[taggedSubnetID] = subnet
+
+		o := OpenStack{
+			CloudProvider: CloudProvider{
+				ctx: context.Background(),
+				cfg: CloudProviderConfig{
+					OpenStackPinnedSubnets: tc.pinnedSubnets,
+				},
+			},
+			novaClient:    testclient.ServiceClient(),
+			neutronClient: testclient.ServiceClient(),
+		}
+		nodeEgressIPConfig, err := o.getNeutronPortNodeEgressIPConfiguration(context.Background(), portMap["fa65cd2e-5a85-4b8f-9138-40509eb062ca"], nil)
+		if tc.errString != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.errString) {
+				t.Fatalf("TestGetNeutronPortNodeEgressIPConfigurationPinnedSubnets(%d): expected error to contain '%s', got: %q", i, tc.errString, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestGetNeutronPortNodeEgressIPConfigurationPinnedSubnets(%d): received unexpected error, err: %q", i, err)
+		}
+		// Only the fixed IP of the port inside the pinned subnet is used.
+		if nodeEgressIPConfig.IFAddr.IPv4 != tc.ipv4 || nodeEgressIPConfig.Capacity.IPv4 != openstackMaxCapacity-1 {
+			t.Fatalf("TestGetNeutronPortNodeEgressIPConfigurationPinnedSubnets(%d): expected subnet %s with capacity %d, got: %v",
+				i, tc.ipv4, openstackMaxCapacity-1, nodeEgressIPConfig)
+		}
+	}
+}
+
+func TestGetNeutronPortNodeEgressIPConfigurationNodeIP(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+	HandleSubnetList(t)
+
+	o := OpenStack{
+		CloudProvider: CloudProvider{ctx: context.Background()},
+		novaClient:    testclient.ServiceClient(),
+		neutronClient: testclient.ServiceClient(),
+	}
+	port := portMap["fa65cd2e-5a85-4b8f-9138-40509eb062ca"]
+
+	tcs := []struct {
+		internalIP string
+		ipv4       string
+		secondary  []string
+		errString  string
+	}{
+		{
+			internalIP: "192.168.125.11",
+			ipv4:       "192.168.125.0/24",
+			secondary:  []string{"192.168.124.0/24"},
+		},
+		{
+			internalIP: "192.168.124.10",
+			ipv4:       "192.168.124.0/24",
+			secondary:  []string{"192.168.125.0/24"},
+		},
+		{
+			internalIP: "10.0.0.10",
+			errString:  "found multiple IPv4 subnets attached to port",
+		},
+	}
+
+	for i, tc := range tcs {
+		node := &corev1.Node{}
+		node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: tc.internalIP}}
+		nodeEgressIPConfig, err := o.getNeutronPortNodeEgressIPConfiguration(context.Background(), port, node)
+		if tc.errString != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.errString) {
+				t.Fatalf("TestGetNeutronPortNodeEgressIPConfigurationNodeIP(%d): expected error to contain '%s', got: %q", i, tc.errString, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestGetNeutronPortNodeEgressIPConfigurationNodeIP(%d): received unexpected error, err: %q", i, err)
+		}
+		if nodeEgressIPConfig.IFAddr.IPv4 != tc.ipv4 || !reflect.DeepEqual(nodeEgressIPConfig.SecondaryIFAddrs, tc.secondary) ||
+			nodeEgressIPConfig.Capacity.IPv4 != openstackMaxCapacity-1 {
+			t.Fatalf("TestGetNeutronPortNodeEgressIPConfigurationNodeIP(%d): expected subnet %s with secondary subnets %v, got: %v",
+				i, tc.ipv4, tc.secondary, nodeEgressIPConfig)
+		}
+	}
+}
+
 // TestAllowUnAllowIPAddressOnNeutronPort tests both allowIPAddressOnNeutronPort and
 // unAllowIPAddressOnNeutronPort.
 func TestAllowUnAllowIPAddressOnNeutronPort(t *testing.T) {
@@ -783,7 +964,7 @@ func TestAllowUnAllowIPAddressOnNeutronPort(t *testing.T) {
 	HandlePortGetUpdateDelete(t, "")
 
 	o := OpenStack{
-		CloudProvider: CloudProvider{},
+		CloudProvider: CloudProvider{ctx: context.Background()},
 		novaClient:    testclient.ServiceClient(),
 		neutronClient: testclient.ServiceClient(),
 	}
@@ -843,7 +1024,7 @@ func TestAllowUnAllowIPAddressOnNeutronPort(t *testing.T) {
 		if tc.unallow {
 			f = o.unallowIPAddressOnNeutronPort
 		}
-		if err := f(tc.portID, tc.ip); err != nil {
+		if err := f(context.Background(), tc.portID, tc.ip); err != nil {
 			if tc.errString == "" || !strings.Contains(err.Error(), tc.errString) {
 				t.Fatalf("TestAllowUnAllowIPAddressOnNeutronPort(%d): Received unexpected error. Should contain '%s', but got err: %q", i, tc.errString, err)
 			}
@@ -871,7 +1052,7 @@ func TestReserveAndReleaseNeutronIPAddress(t *testing.T) {
 	HandlePortListAndCreation(t)
 
 	o := OpenStack{
-		CloudProvider: CloudProvider{},
+		CloudProvider: CloudProvider{ctx: context.Background()},
 		novaClient:    testclient.ServiceClient(),
 		neutronClient: testclient.ServiceClient(),
 	}
@@ -980,7 +1161,7 @@ func TestReserveAndReleaseNeutronIPAddress(t *testing.T) {
 		var err error
 
 		if tc.reserve {
-			if port, err = o.reserveNeutronIPAddress(tc.subnet, tc.ip, tc.nodeName); err != nil {
+			if port, err = o.reserveNeutronIPAddress(context.Background(), tc.subnet, tc.ip, tc.nodeName, tc.nodeName); err != nil {
 				if tc.errString == "" || !strings.Contains(err.Error(), tc.errString) {
 					t.Fatalf("TestReserveAndReleaseNeutronIPAddress(%d)|reserve: Received unexpected error, err: %q", i, err)
 				}
@@ -1003,14 +1184,14 @@ func TestReserveAndReleaseNeutronIPAddress(t *testing.T) {
 					port = &p
 				} else {
 					// Otherwise, use the subnet, ip and nodeName information to retrieve the port.
-					p, err := o.getNeutronPortWithIPAddressAndMachineID(tc.subnet, tc.ip, tc.nodeName)
+					p, err := o.getNeutronPortWithIPAddressAndMachineID(context.Background(), tc.subnet, tc.ip, tc.nodeName)
 					if err != nil {
 						t.Fatalf("TestReserveAndReleaseNeutronIPAddress(%d)|release: Cannot find a port that matches subnet, ip and nodeName, err: %q", i, err)
 					}
 					port = p
 				}
 			}
-			if err := o.releaseNeutronIPAddress(*port, tc.nodeName); err != nil {
+			if err := o.releaseNeutronIPAddress(context.Background(), *port, tc.nodeName); err != nil {
 				if tc.errString == "" || !strings.Contains(err.Error(), tc.errString) {
 					t.Fatalf("TestReserveAndReleaseNeutronIPAddress(%d)|release: Received unexpected error, expected error to contain '%s' but got err: %q",
 						i, tc.errString, err)
@@ -1056,7 +1237,7 @@ func TestGetNeutronSubnetsForNetwork(t *testing.T) {
 	HandleSubnetList(t)
 
 	o := OpenStack{
-		CloudProvider: CloudProvider{},
+		CloudProvider: CloudProvider{ctx: context.Background()},
 		novaClient:    testclient.ServiceClient(),
 		neutronClient: testclient.ServiceClient(),
 	}
@@ -1077,7 +1258,7 @@ func TestGetNeutronSubnetsForNetwork(t *testing.T) {
 	}
 
 	for _, tc := range tcs {
-		listedSubnets, err := o.getNeutronSubnetsForNetwork(tc.networkID)
+		listedSubnets, err := o.getNeutronSubnetsForNetwork(context.Background(), tc.networkID)
 		if err != nil {
 			if tc.errString != err.Error() {
 				t.Fatalf("Received unexpected error in TestGetNeutronSubnetsForNetwork, err: %q", err)
@@ -1102,7 +1283,7 @@ func TestGetNeutronPortWithIPAddressAndNodeName(t *testing.T) {
 	HandlePortListAndCreation(t)
 
 	o := OpenStack{
-		CloudProvider: CloudProvider{},
+		CloudProvider: CloudProvider{ctx: context.Background()},
 		novaClient:    testclient.ServiceClient(),
 		neutronClient: testclient.ServiceClient(),
 	}
@@ -1148,7 +1329,7 @@ func TestGetNeutronPortWithIPAddressAndNodeName(t *testing.T) {
 	}
 
 	for i, tc := range tcs {
-		retrievedPort, err := o.getNeutronPortWithIPAddressAndMachineID(tc.subnet, tc.ip, tc.nodeName)
+		retrievedPort, err := o.getNeutronPortWithIPAddressAndMachineID(context.Background(), tc.subnet, tc.ip, tc.nodeName)
 		if err != nil {
 			if tc.errString != err.Error() {
 				t.Fatalf("TestGetNeutronPortWithIPAddressAndNodeName(%d): Received unexpected error, expected to get '%s', instead got err: %q", i, tc.errString, err)
@@ -1168,7 +1349,7 @@ func TestListNovaServerPorts(t *testing.T) {
 	HandlePortListAndCreation(t)
 
 	o := OpenStack{
-		CloudProvider: CloudProvider{},
+		CloudProvider: CloudProvider{ctx: context.Background()},
 		novaClient:    testclient.ServiceClient(),
 		neutronClient: testclient.ServiceClient(),
 	}
@@ -1189,7 +1370,7 @@ func TestListNovaServerPorts(t *testing.T) {
 	}
 
 	for _, tc := range tcs {
-		listedPorts, err := o.listNovaServerPorts(tc.instanceID)
+		listedPorts, err := o.listNovaServerPorts(context.Background(), tc.instanceID)
 		if err != nil {
 			if tc.errString != err.Error() {
 				t.Fatalf("Received unexpected error in TestListNovaServerPorts, err: %q", err)
@@ -1214,7 +1395,7 @@ func TestGetNovaServer(t *testing.T) {
 	HandleServerGet(t)
 
 	o := OpenStack{
-		CloudProvider: CloudProvider{},
+		CloudProvider: CloudProvider{ctx: context.Background()},
 		novaClient:    testclient.ServiceClient(),
 		neutronClient: testclient.ServiceClient(),
 	}
@@ -1233,7 +1414,7 @@ func TestGetNovaServer(t *testing.T) {
 	}
 
 	for i, tc := range tcs {
-		server, err := o.getNovaServer(tc.id)
+		server, err := o.getNovaServer(context.Background(), tc.id)
 		if err != nil {
 			if !strings.Contains(err.Error(), tc.errString) {
 				t.Fatalf("TestGetNovaServer(%d): Received unexpected error in TestGetNovaServer, expected ton contain '%s' but got err: %q", i, tc.errString, err)
@@ -1291,3 +1472,972 @@ func TestGetNovaServerIDFromProviderID(t *testing.T) {
 		}
 	}
 }
+
+func TestSelectAssignCandidate(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	serverID := "9e5476bd-a4ec-4653-93d6-72c93aa682ba"
+	th.Mux.HandleFunc("/servers/"+serverID, func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		fmt.Fprintf(w, `{"server": {"id": "%s", "OS-EXT-AZ:availability_zone": "az1"}}`, serverID)
+	})
+	networkAZs := map[string]string{
+		// Scheduled to az1.
+		"57d1274f-4717-43f1-88ec-0944546a14ef": `"availability_zones": ["az1"], "availability_zone_hints": []`,
+		// Not scheduled yet, but requested to be in az2.
+		"e3ddc5f8-0306-4039-872e-8c8fe40b42fc": `"availability_zones": [], "availability_zone_hints": ["az2"]`,
+		// Not scoped to any AZ.
+		"cae78aec-16db-483a-9927-c427d4cff77f": `"availability_zones": [], "availability_zone_hints": []`,
+	}
+	for id, azs := range networkAZs {
+		id, azs := id, azs
+		th.Mux.HandleFunc("/networks/"+id, func(w http.ResponseWriter, r *http.Request) {
+			th.TestMethod(t, r, "GET")
+			fmt.Fprintf(w, `{"network": {"id": "%s", %s}}`, id, azs)
+		})
+	}
+
+	candidate := func(networkID string) assignCandidate {
+		return assignCandidate{
+			subnet: &neutronsubnets.Subnet{NetworkID: networkID},
+			port:   &neutronports.Port{ID: "port-" + networkID, NetworkID: networkID},
+		}
+	}
+	sameAZ := candidate("57d1274f-4717-43f1-88ec-0944546a14ef")
+	otherAZ := candidate("e3ddc5f8-0306-4039-872e-8c8fe40b42fc")
+	noAZ := candidate("cae78aec-16db-483a-9927-c427d4cff77f")
+
+	tcs := []struct {
+		candidates []assignCandidate
+		strict     bool
+		expected   string
+		errString  string
+	}{
+		{
+			candidates: []assignCandidate{otherAZ, noAZ, sameAZ},
+			expected:   sameAZ.port.ID,
+		},
+		{
+			candidates: []assignCandidate{otherAZ, noAZ},
+			expected:   noAZ.port.ID,
+		},
+		{
+			candidates: []assignCandidate{otherAZ},
+			expected:   otherAZ.port.ID,
+		},
+		{
+			candidates: []assignCandidate{otherAZ, noAZ},
+			strict:     true,
+			expected:   noAZ.port.ID,
+		},
+		{
+			candidates: []assignCandidate{otherAZ},
+			strict:     true,
+			errString:  "none of the matching networks is in availability zone az1",
+		},
+	}
+
+	node := &corev1.Node{}
+	node.Name = "node1"
+	for i, tc := range tcs {
+		o := OpenStack{
+			CloudProvider: CloudProvider{
+				ctx: context.Background(),
+				cfg: CloudProviderConfig{
+					OpenStackStrictAZMatching: tc.strict,
+				},
+			},
+			novaClient:    testclient.ServiceClient(),
+			neutronClient: testclient.ServiceClient(),
+		}
+		selected, err := o.selectAssignCandidate(context.Background(), net.ParseIP("192.0.2.50"), node, serverID, tc.candidates)
+		if tc.errString != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.errString) {
+				t.Fatalf("TestSelectAssignCandidate(%d): expected error to contain '%s', got: %q", i, tc.errString, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestSelectAssignCandidate(%d): received unexpected error, err: %q", i, err)
+		}
+		if selected.port.ID != tc.expected {
+			t.Fatalf("TestSelectAssignCandidate(%d): expected port %s to be selected, got %s", i, tc.expected, selected.port.ID)
+		}
+	}
+}
+
+func TestSkipAllowedAddressPairs(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	networks := map[string]string{
+		"57d1274f-4717-43f1-88ec-0944546a14ef": `"port_security_enabled": true`,
+		"e3ddc5f8-0306-4039-872e-8c8fe40b42fc": `"port_security_enabled": false`,
+		// The port-security extension is not enabled.
+		"cae78aec-16db-483a-9927-c427d4cff77f": `"name": "network-multiple-ipv4-cidrs"`,
+	}
+	for id, attrs := range networks {
+		id, attrs := id, attrs
+		th.Mux.HandleFunc("/networks/"+id, func(w http.ResponseWriter, r *http.Request) {
+			th.TestMethod(t, r, "GET")
+			fmt.Fprintf(w, `{"network": {"id": "%s", %s}}`, id, attrs)
+		})
+	}
+	ports := map[string]string{
+		"0f7e9c6a-1d2b-4c3d-8e4f-5a6b7c8d9e01": `"port_security_enabled": true`,
+		"0f7e9c6a-1d2b-4c3d-8e4f-5a6b7c8d9e02": `"port_security_enabled": false`,
+		// The port-security extension is not enabled, or doesn't report it.
+		"0f7e9c6a-1d2b-4c3d-8e4f-5a6b7c8d9e03": `"name": "port"`,
+	}
+	for id, attrs := range ports {
+		id, attrs := id, attrs
+		th.Mux.HandleFunc("/ports/"+id, func(w http.ResponseWriter, r *http.Request) {
+			th.TestMethod(t, r, "GET")
+			fmt.Fprintf(w, `{"port": {"id": "%s", %s}}`, id, attrs)
+		})
+	}
+
+	tcs := []struct {
+		portID    string
+		networkID string
+		policy    string
+		skip      bool
+		errString string
+	}{
+		{
+			portID:    "0f7e9c6a-1d2b-4c3d-8e4f-5a6b7c8d9e03",
+			networkID: "57d1274f-4717-43f1-88ec-0944546a14ef",
+			policy:    OpenStackPortSecurityDisabledPolicyFail,
+		},
+		{
+			portID:    "0f7e9c6a-1d2b-4c3d-8e4f-5a6b7c8d9e03",
+			networkID: "cae78aec-16db-483a-9927-c427d4cff77f",
+			policy:    OpenStackPortSecurityDisabledPolicyFail,
+		},
+		{
+			portID:    "0f7e9c6a-1d2b-4c3d-8e4f-5a6b7c8d9e03",
+			networkID: "e3ddc5f8-0306-4039-872e-8c8fe40b42fc",
+			policy:    OpenStackPortSecurityDisabledPolicyFail,
+			errString: "port security is disabled on network e3ddc5f8-0306-4039-872e-8c8fe40b42fc",
+		},
+		{
+			portID:    "0f7e9c6a-1d2b-4c3d-8e4f-5a6b7c8d9e03",
+			networkID: "e3ddc5f8-0306-4039-872e-8c8fe40b42fc",
+			policy:    OpenStackPortSecurityDisabledPolicySkip,
+			skip:      true,
+		},
+		// The port's port security overrides the network's.
+		{
+			portID:    "0f7e9c6a-1d2b-4c3d-8e4f-5a6b7c8d9e01",
+			networkID: "e3ddc5f8-0306-4039-872e-8c8fe40b42fc",
+			policy:    OpenStackPortSecurityDisabledPolicyFail,
+		},
+		{
+			portID:    "0f7e9c6a-1d2b-4c3d-8e4f-5a6b7c8d9e02",
+			networkID: "57d1274f-4717-43f1-88ec-0944546a14ef",
+			policy:    OpenStackPortSecurityDisabledPolicyFail,
+			errString: "port security is disabled on port 0f7e9c6a-1d2b-4c3d-8e4f-5a6b7c8d9e02",
+		},
+		{
+			portID:    "0f7e9c6a-1d2b-4c3d-8e4f-5a6b7c8d9e02",
+			networkID: "57d1274f-4717-43f1-88ec-0944546a14ef",
+			policy:    OpenStackPortSecurityDisabledPolicySkip,
+			skip:      true,
+		},
+	}
+
+	for i, tc := range tcs {
+		o := OpenStack{
+			CloudProvider: CloudProvider{
+				ctx: context.Background(),
+				cfg: CloudProviderConfig{
+					OpenStackPortSecurityDisabledPolicy: tc.policy,
+				},
+			},
+			novaClient:    testclient.ServiceClient(),
+			neutronClient: testclient.ServiceClient(),
+		}
+		skip, err := o.skipAllowedAddressPairs(context.Background(), tc.portID, tc.networkID)
+		if tc.errString != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.errString) {
+				t.Fatalf("TestSkipAllowedAddressPairs(%d): expected error to contain '%s', got: %q", i, tc.errString, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestSkipAllowedAddressPairs(%d): received unexpected error, err: %q", i, err)
+		}
+		if skip != tc.skip {
+			t.Fatalf("TestSkipAllowedAddressPairs(%d): expected %t, got %t", i, tc.skip, skip)
+		}
+	}
+}
+
+func TestReleasePrivateIPWithOverrideServerIDs(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	// A reservation port left behind by a server which was replaced by server2.
+	replacedServerID := "2d3f3b9c-8a9e-4a8e-9d3b-6f4e0f1c2a7d"
+	reservation := neutronports.Port{
+		ID:          "c3b1c7e5-2a4f-4d8e-8f5a-0b6d2e9a4c11",
+		NetworkID:   "57d1274f-4717-43f1-88ec-0944546a14ef",
+		Name:        "egressip-192.0.2.60",
+		DeviceOwner: egressIPTag,
+		DeviceID:    generateDeviceID(replacedServerID),
+		FixedIPs: []neutronports.IP{
+			{
+				SubnetID:  "49895d6d-6972-4198-8afa-ada96e1daaef",
+				IPAddress: "192.0.2.60",
+			},
+		},
+	}
+	portMap[reservation.ID] = reservation
+	defer delete(portMap, reservation.ID)
+
+	HandleSubnetList(t)
+	HandlePortGetUpdateDelete(t, "")
+	HandlePortListAndCreation(t)
+	HandleServerGet(t)
+
+	o := OpenStack{
+		CloudProvider: CloudProvider{ctx: context.Background()},
+		novaClient:    testclient.ServiceClient(),
+		neutronClient: testclient.ServiceClient(),
+	}
+
+	ip := net.ParseIP("192.0.2.60")
+	node := &corev1.Node{}
+	node.Name = "node2"
+	node.Spec.ProviderID = "openstack:///b5d5889f-76f9-46b1-8af9-bfdf81e96616"
+
+	// Without the annotation, the reservation of another server is never released.
+	if err := o.ReleasePrivateIP(context.Background(), ip, node); err != NonExistingIPError {
+		t.Fatalf("TestReleasePrivateIPWithOverrideServerIDs: expected '%s', got: %q", NonExistingIPError, err)
+	}
+
+	// Servers which still exist are refused, invalid IDs are ignored.
+	node.Annotations = map[string]string{
+		OpenStackReleaseServerIDsAnnotation: "9e5476bd-a4ec-4653-93d6-72c93aa682ba, not-a-uuid",
+	}
+	if err := o.ReleasePrivateIP(context.Background(), ip, node); err != NonExistingIPError {
+		t.Fatalf("TestReleasePrivateIPWithOverrideServerIDs: expected '%s', got: %q", NonExistingIPError, err)
+	}
+	if _, ok := portMap[reservation.ID]; !ok {
+		t.Fatalf("TestReleasePrivateIPWithOverrideServerIDs: reservation port was released for a server which still exists")
+	}
+
+	node.Annotations[OpenStackReleaseServerIDsAnnotation] = replacedServerID
+	if err := o.ReleasePrivateIP(context.Background(), ip, node); err != nil {
+		t.Fatalf("TestReleasePrivateIPWithOverrideServerIDs: received unexpected error, err: %q", err)
+	}
+	if _, ok := portMap[reservation.ID]; ok {
+		t.Fatalf("TestReleasePrivateIPWithOverrideServerIDs: expected reservation port of the replaced server to be released")
+	}
+}
+
+func TestCleanupNode(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	deletedServerID := "5b8c7a1e-3f2d-4c6b-9e0a-8d7f6e5c4b3a"
+	reservations := []neutronports.Port{
+		{
+			ID:          "0f4e8d6c-1b2a-4c3d-8e9f-a0b1c2d3e4f5",
+			NetworkID:   "57d1274f-4717-43f1-88ec-0944546a14ef",
+			DeviceOwner: egressIPTag,
+			DeviceID:    generateDeviceID(deletedServerID),
+		},
+		{
+			ID:          "1a5f9e7d-2c3b-4d4e-9f0a-b1c2d3e4f5a6",
+			NetworkID:   "e3ddc5f8-0306-4039-872e-8c8fe40b42fc",
+			DeviceOwner: egressIPTag,
+			DeviceID:    generateDeviceID(deletedServerID),
+		},
+	}
+	liveReservation := neutronports.Port{
+		ID:          "2b6a0f8e-3d4c-4e5f-a0b1-c2d3e4f5a6b7",
+		NetworkID:   "57d1274f-4717-43f1-88ec-0944546a14ef",
+		DeviceOwner: egressIPTag,
+		DeviceID:    generateDeviceID("9e5476bd-a4ec-4653-93d6-72c93aa682ba"),
+	}
+	for _, p := range append(reservations, liveReservation) {
+		portMap[p.ID] = p
+		defer delete(portMap, p.ID)
+	}
+
+	HandlePortGetUpdateDelete(t, "")
+	HandlePortListAndCreation(t)
+	HandleServerGet(t)
+
+	o := OpenStack{
+		CloudProvider: CloudProvider{ctx: context.Background()},
+		novaClient:    testclient.ServiceClient(),
+		neutronClient: testclient.ServiceClient(),
+	}
+
+	// The server of this node still exists, nothing must be released until
+	// it's gone.
+	existing := &corev1.Node{}
+	existing.Name = "node1"
+	existing.Spec.ProviderID = "openstack:///9e5476bd-a4ec-4653-93d6-72c93aa682ba"
+	if err := o.CleanupNode(context.Background(), existing); !errors.Is(err, InstanceExistsError) {
+		t.Fatalf("TestCleanupNode: expected an InstanceExistsError, got: %v", err)
+	}
+	if _, ok := portMap[liveReservation.ID]; !ok {
+		t.Fatalf("TestCleanupNode: released a port although the server still exists")
+	}
+
+	deleted := &corev1.Node{}
+	deleted.Name = "deleted-node"
+	deleted.Spec.ProviderID = openstackProviderPrefix + deletedServerID
+	if err := o.CleanupNode(context.Background(), deleted); err != nil {
+		t.Fatalf("TestCleanupNode: received unexpected error, err: %q", err)
+	}
+	for _, p := range reservations {
+		if _, ok := portMap[p.ID]; ok {
+			t.Fatalf("TestCleanupNode: expected reservation port %s of the deleted server to be released", p.ID)
+		}
+	}
+}
+
+func TestVerifyPrivateIP(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	serverID := "9e5476bd-a4ec-4653-93d6-72c93aa682ba"
+	reservation := neutronports.Port{
+		ID:          "3c7b1a9f-4e5d-4f6a-b1c2-d3e4f5a6b7c8",
+		NetworkID:   "57d1274f-4717-43f1-88ec-0944546a14ef",
+		Name:        "egressip-192.0.2.1",
+		DeviceOwner: egressIPTag,
+		DeviceID:    generateDeviceID(serverID),
+		FixedIPs: []neutronports.IP{
+			{
+				SubnetID:  "49895d6d-6972-4198-8afa-ada96e1daaef",
+				IPAddress: "192.0.2.1",
+			},
+		},
+	}
+	portMap[reservation.ID] = reservation
+	defer delete(portMap, reservation.ID)
+
+	serverPortID := "9ab428d4-58f8-42d7-9672-90c3f5641f83"
+	serverPort := portMap[serverPortID]
+	defer func() { portMap[serverPortID] = serverPort }()
+
+	HandleSubnetList(t)
+	HandleNetworkGet(t)
+	HandlePortGetUpdateDelete(t, "")
+	HandlePortListAndCreation(t)
+
+	o := OpenStack{
+		CloudProvider: CloudProvider{ctx: context.Background()},
+		novaClient:    testclient.ServiceClient(),
+		neutronClient: testclient.ServiceClient(),
+	}
+
+	node := &corev1.Node{}
+	node.Name = "node1"
+	node.Spec.ProviderID = openstackProviderPrefix + serverID
+
+	tcs := []struct {
+		ip         string
+		portStatus string
+		expectErr  bool
+	}{
+		{
+			// The server port isn't bound yet.
+			ip:        "192.0.2.1",
+			expectErr: true,
+		},
+		{
+			ip:         "192.0.2.1",
+			portStatus: "ACTIVE",
+		},
+		{
+			// Allowed on the server port, but never reserved.
+			ip:         "192.0.2.2",
+			portStatus: "ACTIVE",
+			expectErr:  true,
+		},
+		{
+			ip:         "198.51.100.1",
+			portStatus: "ACTIVE",
+			expectErr:  true,
+		},
+	}
+	for i, tc := range tcs {
+		port := serverPort
+		port.Status = tc.portStatus
+		portMap[serverPortID] = port
+
+		err := o.VerifyPrivateIP(context.Background(), net.ParseIP(tc.ip), node)
+		if tc.expectErr && err == nil {
+			t.Fatalf("TestVerifyPrivateIP(%d): expected an error, got nil", i)
+		}
+		if !tc.expectErr && err != nil {
+			t.Fatalf("TestVerifyPrivateIP(%d): received unexpected error, err: %q", i, err)
+		}
+	}
+}
+
+func TestGetNodeEgressIPConfigurationExternalNetworks(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	networks := map[string]string{
+		"57d1274f-4717-43f1-88ec-0944546a14ef": `"router:external": false, "provider:network_type": "vlan", "provider:segmentation_id": 100`,
+		"e3ddc5f8-0306-4039-872e-8c8fe40b42fc": `"router:external": true`,
+	}
+	portID := "319bb795-b08e-4b8f-b9d2-b3a7c8c1ab45"
+	port := portMap[portID]
+	defer func() { portMap[portID] = port }()
+	withMAC := port
+	withMAC.MACAddress = "FA:16:3E:0B:8C:01"
+	portMap[portID] = withMAC
+	for id, attrs := range networks {
+		id, attrs := id, attrs
+		th.Mux.HandleFunc("/networks/"+id, func(w http.ResponseWriter, r *http.Request) {
+			th.TestMethod(t, r, "GET")
+			fmt.Fprintf(w, `{"network": {"id": "%s", %s}}`, id, attrs)
+		})
+	}
+	HandleSubnetList(t)
+	HandlePortListAndCreation(t)
+
+	node := &corev1.Node{}
+	node.Name = "node2"
+	node.Spec.ProviderID = "openstack:///b5d5889f-76f9-46b1-8af9-bfdf81e96616"
+
+	tcs := []struct {
+		includeExternal bool
+		interfaces      []string
+	}{
+		{
+			interfaces: []string{"319bb795-b08e-4b8f-b9d2-b3a7c8c1ab45"},
+		},
+		{
+			includeExternal: true,
+			interfaces:      []string{"319bb795-b08e-4b8f-b9d2-b3a7c8c1ab45", "ed5351a4-08b5-4ac6-b9c9-bbbe557df381"},
+		},
+	}
+	for i, tc := range tcs {
+		o := OpenStack{
+			CloudProvider: CloudProvider{
+				ctx: context.Background(),
+				cfg: CloudProviderConfig{
+					OpenStackIncludeExternalNetworks: tc.includeExternal,
+				},
+			},
+			novaClient:    testclient.ServiceClient(),
+			neutronClient: testclient.ServiceClient(),
+		}
+		configurations, err := o.GetNodeEgressIPConfiguration(context.Background(), node)
+		if err != nil {
+			t.Fatalf("TestGetNodeEgressIPConfigurationExternalNetworks(%d): received unexpected error, err: %q", i, err)
+		}
+		var interfaces []string
+		for _, config := range configurations {
+			interfaces = append(interfaces, config.Interface)
+			if config.Interface == portID && (config.MAC != "fa:16:3e:0b:8c:01" || config.VLAN != 100) {
+				t.Fatalf("TestGetNodeEgressIPConfigurationExternalNetworks(%d): expected MAC fa:16:3e:0b:8c:01 on VLAN 100, got %s on VLAN %d", i, config.MAC, config.VLAN)
+			}
+		}
+		sort.Strings(interfaces)
+		if !reflect.DeepEqual(interfaces, tc.interfaces) {
+			t.Fatalf("TestGetNodeEgressIPConfigurationExternalNetworks(%d): expected interfaces %v, got %v", i, tc.interfaces, interfaces)
+		}
+	}
+}
+
+func TestReserveNeutronIPAddressMetadata(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	var created map[string]map[string]interface{}
+	th.Mux.HandleFunc("/ports", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+			t.Fatal(err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"port": {"id": "5e9d3c1b-6a7f-4b8c-9d0e-f1a2b3c4d5e6"}}`)
+	})
+	th.Mux.HandleFunc("/extensions/dns-integration", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		fmt.Fprintf(w, `{"extension": {"alias": "dns-integration"}}`)
+	})
+	th.Mux.HandleFunc("/extensions/forbidden-extension", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.WriteHeader(http.StatusForbidden)
+	})
+
+	o := OpenStack{
+		CloudProvider: CloudProvider{
+			ctx: context.Background(),
+			cfg: CloudProviderConfig{
+				ClusterID: "cluster-x7k2p",
+			},
+		},
+		novaClient:    testclient.ServiceClient(),
+		neutronClient: testclient.ServiceClient(),
+	}
+	for _, alias := range []string{"dns-integration", "not-an-extension", "forbidden-extension"} {
+		if enabled := o.hasNeutronExtension(context.Background(), alias); enabled != (alias == "dns-integration") {
+			t.Fatalf("TestReserveNeutronIPAddressMetadata: unexpected availability %t of extension %s", enabled, alias)
+		}
+	}
+
+	for i, dnsIntegration := range []bool{false, true} {
+		o.dnsIntegration = dnsIntegration
+		if _, err := o.reserveNeutronIPAddress(context.Background(), subnetMap["de0cda14-6ac6-4439-bc94-da0a27938b7b"], net.ParseIP("2000::5"), "9e5476bd-a4ec-4653-93d6-72c93aa682ba", "node1"); err != nil {
+			t.Fatalf("TestReserveNeutronIPAddressMetadata(%d): received unexpected error, err: %q", i, err)
+		}
+		description, _ := created["port"]["description"].(string)
+		if !strings.HasPrefix(description, "Egress IP of node node1 of cluster cluster-x7k2p, reserved at ") {
+			t.Fatalf("TestReserveNeutronIPAddressMetadata(%d): unexpected description '%s'", i, description)
+		}
+		dnsName, ok := created["port"]["dns_name"]
+		if dnsIntegration && dnsName != "egressip-2000--5" {
+			t.Fatalf("TestReserveNeutronIPAddressMetadata(%d): expected dns_name 'egressip-2000--5', got '%v'", i, dnsName)
+		}
+		if !dnsIntegration && ok {
+			t.Fatalf("TestReserveNeutronIPAddressMetadata(%d): expected no dns_name without dns-integration, got '%v'", i, dnsName)
+		}
+	}
+}
+
+func TestGetNovaServerID(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	// Two servers share the name of node2, they're told apart by their addresses.
+	th.Mux.HandleFunc("/servers/detail", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		if name := r.URL.Query().Get("name"); name != "^node2$" {
+			fmt.Fprintf(w, `{"servers": []}`)
+			return
+		}
+		fmt.Fprintf(w, `{"servers": [
+			{"id": "b5d5889f-76f9-46b1-8af9-bfdf81e96616", "name": "node2", "addresses": {"net1": [{"version": 4, "addr": "192.0.2.20"}]}},
+			{"id": "95dda9a5-7bd9-494f-8b84-81c1629915bc", "name": "node2", "addresses": {"net1": [{"version": 4, "addr": "192.0.2.30"}]}}
+		]}`)
+	})
+
+	o := OpenStack{
+		novaClient:    testclient.ServiceClient(),
+		neutronClient: testclient.ServiceClient(),
+	}
+
+	tcs := []struct {
+		providerID  string
+		annotations map[string]string
+		name        string
+		addresses   []corev1.NodeAddress
+		serverID    string
+		expectErr   bool
+	}{
+		{
+			providerID: "openstack:///9e5476bd-a4ec-4653-93d6-72c93aa682ba",
+			annotations: map[string]string{
+				OpenStackServerIDAnnotation: "b5d5889f-76f9-46b1-8af9-bfdf81e96616",
+			},
+			name:     "node1",
+			serverID: "9e5476bd-a4ec-4653-93d6-72c93aa682ba",
+		},
+		{
+			annotations: map[string]string{
+				OpenStackServerIDAnnotation: "b5d5889f-76f9-46b1-8af9-bfdf81e96616",
+			},
+			name:     "node1",
+			serverID: "b5d5889f-76f9-46b1-8af9-bfdf81e96616",
+		},
+		{
+			annotations: map[string]string{
+				OpenStackServerIDAnnotation: "not-a-uuid",
+			},
+			name:      "node1",
+			expectErr: true,
+		},
+		{
+			name: "node2",
+			addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeInternalIP, Address: "192.0.2.30"},
+			},
+			serverID: "95dda9a5-7bd9-494f-8b84-81c1629915bc",
+		},
+		{
+			name: "node2.example.com",
+			addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "node2"},
+				{Type: corev1.NodeInternalIP, Address: "192.0.2.20"},
+			},
+			serverID: "b5d5889f-76f9-46b1-8af9-bfdf81e96616",
+		},
+		{
+			// Ambiguous: both servers match.
+			name:      "node2",
+			expectErr: true,
+		},
+		{
+			name:      "node3",
+			expectErr: true,
+		},
+	}
+	for i, tc := range tcs {
+		node := &corev1.Node{}
+		node.Name = tc.name
+		node.Annotations = tc.annotations
+		node.Spec.ProviderID = tc.providerID
+		node.Status.Addresses = tc.addresses
+		serverID, err := o.getNovaServerID(context.Background(), node)
+		if tc.expectErr {
+			if err == nil {
+				t.Fatalf("TestGetNovaServerID(%d): expected an error, got server ID '%s'", i, serverID)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestGetNovaServerID(%d): received unexpected error, err: %q", i, err)
+		}
+		if serverID != tc.serverID {
+			t.Fatalf("TestGetNovaServerID(%d): expected server ID '%s', got '%s'", i, tc.serverID, serverID)
+		}
+	}
+}
+
+func TestStandbyAssignments(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	original := make(map[string]neutronports.Port, len(portMap))
+	for id, p := range portMap {
+		original[id] = p
+	}
+	defer func() { portMap = original }()
+
+	HandleNetworkGet(t)
+	HandleSubnetList(t)
+	HandlePortGetUpdateDelete(t, "")
+	HandlePortListAndCreation(t)
+	HandleServerGet(t)
+
+	o := OpenStack{
+		CloudProvider: CloudProvider{
+			ctx: context.Background(),
+			cfg: CloudProviderConfig{
+				OpenStackStandbyAssignments: true,
+			},
+		},
+		novaClient:    testclient.ServiceClient(),
+		neutronClient: testclient.ServiceClient(),
+	}
+
+	server1 := "9e5476bd-a4ec-4653-93d6-72c93aa682ba"
+	server2 := "b5d5889f-76f9-46b1-8af9-bfdf81e96616"
+	// node1 and node2 are each other's standby.
+	node1 := &corev1.Node{}
+	node1.Name = "node1"
+	node1.Spec.ProviderID = "openstack:///" + server1
+	node1.Annotations = map[string]string{OpenStackStandbyServerAnnotation: server2}
+	node2 := &corev1.Node{}
+	node2.Name = "node2"
+	node2.Spec.ProviderID = "openstack:///" + server2
+	node2.Annotations = map[string]string{OpenStackStandbyServerAnnotation: server1}
+
+	isAllowedOnServer := func(serverID string, ip net.IP) bool {
+		for _, p := range portMap {
+			if p.DeviceID == serverID && isIPAddressAllowedOnNeutronPort(p, ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	ip := net.ParseIP("192.0.2.61")
+	if err := o.AssignPrivateIP(context.Background(), ip, node2); err != nil {
+		t.Fatalf("TestStandbyAssignments: received unexpected error, err: %q", err)
+	}
+	if !isAllowedOnServer(server2, ip) || !isAllowedOnServer(server1, ip) {
+		t.Fatalf("TestStandbyAssignments: expected IP address %s to be allowed on the node's and the standby's server", ip)
+	}
+
+	// Failing over to the standby keeps the IP address pre-allowed on the
+	// previous node, as it's the standby of the new one.
+	if err := o.MovePrivateIP(context.Background(), ip, node1, node2); err != nil {
+		t.Fatalf("TestStandbyAssignments: received unexpected error, err: %q", err)
+	}
+	if !isAllowedOnServer(server2, ip) || !isAllowedOnServer(server1, ip) {
+		t.Fatalf("TestStandbyAssignments: expected IP address %s to stay allowed on both servers after the failover", ip)
+	}
+
+	if err := o.ReleasePrivateIP(context.Background(), ip, node1); err != nil {
+		t.Fatalf("TestStandbyAssignments: received unexpected error, err: %q", err)
+	}
+	if isAllowedOnServer(server2, ip) || isAllowedOnServer(server1, ip) {
+		t.Fatalf("TestStandbyAssignments: expected IP address %s to be removed from both servers", ip)
+	}
+
+	// Without standby assignments, the annotation is ignored.
+	o.cfg.OpenStackStandbyAssignments = false
+	ip = net.ParseIP("192.0.2.62")
+	if err := o.AssignPrivateIP(context.Background(), ip, node2); err != nil {
+		t.Fatalf("TestStandbyAssignments: received unexpected error, err: %q", err)
+	}
+	if isAllowedOnServer(server1, ip) {
+		t.Fatalf("TestStandbyAssignments: expected IP address %s not to be pre-allowed with standby assignments disabled", ip)
+	}
+}
+
+func TestGetPrivateIPReservations(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+	HandlePortListAndCreation(t)
+
+	o := OpenStack{
+		CloudProvider: CloudProvider{ctx: context.Background()},
+		novaClient:    testclient.ServiceClient(),
+		neutronClient: testclient.ServiceClient(),
+	}
+
+	// Reservation ports are found on the networks of the node, whichever
+	// server owns them.
+	node := &corev1.Node{}
+	node.Name = "node2"
+	node.Spec.ProviderID = "openstack:///b5d5889f-76f9-46b1-8af9-bfdf81e96616"
+
+	tcs := []struct {
+		ip           string
+		reservations []PrivateIPReservation
+	}{
+		{
+			ip: "2000::12",
+			reservations: []PrivateIPReservation{
+				{ID: "638a74cd-d894-45b1-8865-4945c4911145", Subnet: "de0cda14-6ac6-4439-bc94-da0a27938b7b"},
+			},
+		},
+		{
+			ip: "192.0.2.99",
+		},
+	}
+	for i, tc := range tcs {
+		reservations, err := o.GetPrivateIPReservations(context.Background(), net.ParseIP(tc.ip), node)
+		if err != nil {
+			t.Fatalf("TestGetPrivateIPReservations(%d): received unexpected error, err: %q", i, err)
+		}
+		if !reflect.DeepEqual(reservations, tc.reservations) {
+			t.Fatalf("TestGetPrivateIPReservations(%d): expected %v, got %v", i, tc.reservations, reservations)
+		}
+	}
+}
+
+func TestListOwnedResources(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+	HandlePortListAndCreation(t)
+
+	o := OpenStack{
+		CloudProvider: CloudProvider{ctx: context.Background()},
+		novaClient:    testclient.ServiceClient(),
+		neutronClient: testclient.ServiceClient(),
+	}
+	node := &corev1.Node{}
+	node.Name = "node2"
+	node.Spec.ProviderID = "openstack:///b5d5889f-76f9-46b1-8af9-bfdf81e96616"
+
+	resources, err := o.ListOwnedResources(context.Background(), []*corev1.Node{node})
+	if err != nil {
+		t.Fatalf("TestListOwnedResources: received unexpected error, err: %q", err)
+	}
+	// The reservation port of server node1, which is no node's, holds an
+	// address of each family.
+	var found []string
+	for _, resource := range resources {
+		if portMap[resource.ID].DeviceOwner != egressIPTag {
+			t.Fatalf("TestListOwnedResources: expected only reservation ports, got %+v", resource)
+		}
+		if resource.ID == "638a74cd-d894-45b1-8865-4945c4911145" {
+			if resource.Node != "" || resource.ProviderID != openstackProviderPrefix+portMap[resource.ID].DeviceID[len(egressIPTag)+1:] {
+				t.Fatalf("TestListOwnedResources: expected port %s to belong to no node but to its server, got %q and %q", resource.ID, resource.Node, resource.ProviderID)
+			}
+			found = append(found, resource.IP.String())
+		}
+	}
+	if !reflect.DeepEqual(found, []string{"192.0.2.12", "2000::12"}) {
+		t.Fatalf("TestListOwnedResources: expected the addresses of port 638a74cd-d894-45b1-8865-4945c4911145, got %v", found)
+	}
+
+	if _, err := o.ListOwnedResources(context.Background(), []*corev1.Node{{Spec: corev1.NodeSpec{ProviderID: "openstack:///invalid"}}}); err == nil {
+		t.Fatalf("TestListOwnedResources: expected an error listing resources with a node of unknown server")
+	}
+}
+
+func TestStandbyAssignmentsCleanup(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	original := make(map[string]neutronports.Port, len(portMap))
+	for id, p := range portMap {
+		original[id] = p
+	}
+	defer func() { portMap = original }()
+
+	server1 := "9e5476bd-a4ec-4653-93d6-72c93aa682ba"
+	server2 := "b5d5889f-76f9-46b1-8af9-bfdf81e96616"
+	server3 := "95dda9a5-7bd9-494f-8b84-81c1629915bc"
+	portMap["1b1d4d5c-1bf2-4a5c-9c1b-2d5f0ba5d3a3"] = neutronports.Port{
+		ID:        "1b1d4d5c-1bf2-4a5c-9c1b-2d5f0ba5d3a3",
+		NetworkID: "57d1274f-4717-43f1-88ec-0944546a14ef",
+		Name:      "server3-port1",
+		FixedIPs: []neutronports.IP{
+			{
+				SubnetID:  "49895d6d-6972-4198-8afa-ada96e1daaef",
+				IPAddress: "192.0.2.13",
+			},
+		},
+		DeviceID:    server3,
+		DeviceOwner: novaDeviceOwner,
+	}
+
+	HandleNetworkGet(t)
+	HandleSubnetList(t)
+	HandlePortGetUpdateDelete(t, "")
+	HandlePortListAndCreation(t)
+	HandleServerGet(t)
+
+	o := OpenStack{
+		CloudProvider: CloudProvider{
+			ctx: context.Background(),
+			cfg: CloudProviderConfig{
+				OpenStackStandbyAssignments: true,
+			},
+		},
+		novaClient:    testclient.ServiceClient(),
+		neutronClient: testclient.ServiceClient(),
+	}
+
+	node := func(name, serverID, standbyServerID string) *corev1.Node {
+		node := &corev1.Node{}
+		node.Name = name
+		node.Spec.ProviderID = "openstack:///" + serverID
+		if standbyServerID != "" {
+			node.Annotations = map[string]string{OpenStackStandbyServerAnnotation: standbyServerID}
+		}
+		return node
+	}
+	isAllowedOnServer := func(serverID string, ip net.IP) bool {
+		for _, p := range portMap {
+			if p.DeviceID == serverID && isIPAddressAllowedOnNeutronPort(p, ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Moving the IP address away from node1 to node3, which has no standby,
+	// removes it from node1's standby.
+	ip := net.ParseIP("192.0.2.63")
+	if err := o.AssignPrivateIP(context.Background(), ip, node("node1", server1, server2)); err != nil {
+		t.Fatalf("TestStandbyAssignmentsCleanup: received unexpected error, err: %q", err)
+	}
+	if !isAllowedOnServer(server2, ip) {
+		t.Fatalf("TestStandbyAssignmentsCleanup: expected IP address %s to be pre-allowed on the standby server", ip)
+	}
+	if err := o.MovePrivateIP(context.Background(), ip, node("node3", server3, ""), node("node1", server1, server2)); err != nil {
+		t.Fatalf("TestStandbyAssignmentsCleanup: received unexpected error, err: %q", err)
+	}
+	if !isAllowedOnServer(server3, ip) || isAllowedOnServer(server1, ip) || isAllowedOnServer(server2, ip) {
+		t.Fatalf("TestStandbyAssignmentsCleanup: expected IP address %s to be allowed only on the server it moved to", ip)
+	}
+
+	// Releasing the IP address after the node's standby changed removes it
+	// from the previous standby, recorded on the reservation port.
+	ip = net.ParseIP("192.0.2.64")
+	if err := o.AssignPrivateIP(context.Background(), ip, node("node1", server1, server2)); err != nil {
+		t.Fatalf("TestStandbyAssignmentsCleanup: received unexpected error, err: %q", err)
+	}
+	if err := o.ReleasePrivateIP(context.Background(), ip, node("node1", server1, server3)); err != nil {
+		t.Fatalf("TestStandbyAssignmentsCleanup: received unexpected error, err: %q", err)
+	}
+	for _, serverID := range []string{server1, server2, server3} {
+		if isAllowedOnServer(serverID, ip) {
+			t.Fatalf("TestStandbyAssignmentsCleanup: expected IP address %s to be removed from server %s", ip, serverID)
+		}
+	}
+}
+
+func TestListPrivateIPs(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	original := make(map[string]neutronports.Port, len(portMap))
+	for id, p := range portMap {
+		original[id] = p
+	}
+	defer func() { portMap = original }()
+
+	server1 := "9e5476bd-a4ec-4653-93d6-72c93aa682ba"
+	server2 := "b5d5889f-76f9-46b1-8af9-bfdf81e96616"
+
+	HandleNetworkGet(t)
+	HandleSubnetList(t)
+	HandlePortGetUpdateDelete(t, "")
+	HandlePortListAndCreation(t)
+	HandleServerGet(t)
+
+	o := OpenStack{
+		CloudProvider: CloudProvider{
+			ctx: context.Background(),
+			cfg: CloudProviderConfig{
+				OpenStackStandbyAssignments: true,
+			},
+		},
+		novaClient:    testclient.ServiceClient(),
+		neutronClient: testclient.ServiceClient(),
+	}
+
+	node := func(name, serverID, standbyServerID string) *corev1.Node {
+		node := &corev1.Node{}
+		node.Name = name
+		node.Spec.ProviderID = "openstack:///" + serverID
+		if standbyServerID != "" {
+			node.Annotations = map[string]string{OpenStackStandbyServerAnnotation: standbyServerID}
+		}
+		return node
+	}
+	list := func(node *corev1.Node) string {
+		ips, err := o.ListPrivateIPs(context.Background(), node)
+		if err != nil {
+			t.Fatalf("TestListPrivateIPs: received unexpected error, err: %q", err)
+		}
+		return fmt.Sprint(ips)
+	}
+
+	// IP addresses are listed for the server they're assigned to, not for its
+	// standby.
+	ip := net.ParseIP("192.0.2.65")
+	if err := o.AssignPrivateIP(context.Background(), ip, node("node1", server1, server2)); err != nil {
+		t.Fatalf("TestListPrivateIPs: received unexpected error, err: %q", err)
+	}
+	if ips := list(node("node1", server1, server2)); ips != "[192.0.2.65]" {
+		t.Fatalf("TestListPrivateIPs: expected IP address %s to be listed for node1, got: %s", ip, ips)
+	}
+	if ips := list(node("node2", server2, "")); ips != "[]" {
+		t.Fatalf("TestListPrivateIPs: expected no IP address to be listed for the standby node2, got: %s", ips)
+	}
+
+	// Moved IP addresses are listed for the server they moved to, although
+	// their reservation port stays with the server it was created for.
+	if err := o.MovePrivateIP(context.Background(), ip, node("node2", server2, ""), node("node1", server1, server2)); err != nil {
+		t.Fatalf("TestListPrivateIPs: received unexpected error, err: %q", err)
+	}
+	if ips := list(node("node1", server1, "")); ips != "[]" {
+		t.Fatalf("TestListPrivateIPs: expected no IP address to be listed for node1 after the move, got: %s", ips)
+	}
+	if ips := list(node("node2", server2, "")); ips != "[192.0.2.65]" {
+		t.Fatalf("TestListPrivateIPs: expected IP address %s to be listed for node2 after the move, got: %s", ip, ips)
+	}
+}
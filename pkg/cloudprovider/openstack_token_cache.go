@@ -0,0 +1,202 @@
+package cloudprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	tokens3 "github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// openstackTokenCacheFile is the name of the file inside
+	// OpenStackTokenCacheDir in which the keystone token is persisted.
+	openstackTokenCacheFile = "keystone-token.json"
+	// openstackTokenExpiryMargin is the minimum validity a persisted token must
+	// have left in order for it to be reused on startup. This avoids starting
+	// up with a token which expires moments later.
+	openstackTokenExpiryMargin = 10 * time.Minute
+)
+
+// openstackTokenCache is the on-disk representation of a keystone token and
+// the service catalog that was issued together with it. Key identifies the
+// credentials the token was issued for, see openstackTokenCacheKey.
+type openstackTokenCache struct {
+	Key       string                 `json:"key"`
+	TokenID   string                 `json:"token_id"`
+	ExpiresAt time.Time              `json:"expires_at"`
+	Catalog   tokens3.ServiceCatalog `json:"catalog"`
+}
+
+// authenticate authenticates the provider client against keystone. If
+// OpenStackTokenCacheDir is set, a previously persisted token is reused as long
+// as it's still valid, which spares us a round-trip to keystone on every
+// restart. Any newly issued token is persisted for the next restart. A token
+// persisted for other credentials, e.g. after clouds.yaml was rotated to
+// another user or project, is never reused.
+func (o *OpenStack) authenticate(provider *gophercloud.ProviderClient, opts gophercloud.AuthOptions) error {
+	if o.cfg.OpenStackTokenCacheDir == "" {
+		if err := openstack.Authenticate(provider, opts); err != nil {
+			return err
+		}
+		provider.ReauthFunc = func() error {
+			return o.reauthenticate(provider, opts)
+		}
+		return nil
+	}
+
+	cache, err := readOpenStackTokenCache(o.cfg.OpenStackTokenCacheDir)
+	if err != nil {
+		klog.Warningf("Could not read persisted keystone token, re-authenticating, err: %q", err)
+	} else if cache != nil && cache.Key != openstackTokenCacheKey(opts) {
+		klog.Infof("Persisted keystone token was issued for other credentials, re-authenticating")
+	} else if cache != nil && time.Until(cache.ExpiresAt) > openstackTokenExpiryMargin {
+		klog.Infof("Reusing persisted keystone token, valid until %s", cache.ExpiresAt)
+		provider.SetToken(cache.TokenID)
+		catalog := cache.Catalog
+		provider.EndpointLocator = func(eo gophercloud.EndpointOpts) (string, error) {
+			return openstack.V3EndpointURL(&catalog, eo)
+		}
+		provider.ReauthFunc = func() error {
+			return o.reauthenticate(provider, opts)
+		}
+		return nil
+	}
+
+	if err := openstack.Authenticate(provider, opts); err != nil {
+		return err
+	}
+	o.persistToken(provider, opts)
+	provider.ReauthFunc = func() error {
+		return o.reauthenticate(provider, opts)
+	}
+	return nil
+}
+
+// reauthenticate issues a new token using a throw-away provider client and
+// copies it over to the provider client. This is called by gophercloud when a
+// request fails with a 401, i.e: when the token expired or was revoked. The
+// request to keystone is bound to a requestContext of its own.
+func (o *OpenStack) reauthenticate(provider *gophercloud.ProviderClient, opts gophercloud.AuthOptions) error {
+	tac, err := openstack.NewClient(opts.IdentityEndpoint)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := o.requestContext(o.ctx)
+	defer cancel()
+	tac.Context = ctx
+	tac.HTTPClient = provider.HTTPClient
+	tac.SetThrowaway(true)
+	// Only retry authentication once, see the equivalent in gophercloud's v3auth.
+	opts.AllowReauth = false
+	if err := openstack.Authenticate(tac, opts); err != nil {
+		return err
+	}
+	provider.CopyTokenFrom(tac)
+	o.persistToken(tac, opts)
+	return nil
+}
+
+// persistToken writes the token and catalog held by the provider client, issued
+// for opts, to OpenStackTokenCacheDir. Failing to do so is not fatal, we will
+// simply have to authenticate again on the next restart.
+func (o *OpenStack) persistToken(provider *gophercloud.ProviderClient, opts gophercloud.AuthOptions) {
+	if o.cfg.OpenStackTokenCacheDir == "" {
+		return
+	}
+	result, ok := provider.GetAuthResult().(tokens3.CreateResult)
+	if !ok {
+		klog.Warningf("Cannot persist keystone token, unexpected authentication result type %T", provider.GetAuthResult())
+		return
+	}
+	token, err := result.ExtractToken()
+	if err != nil {
+		klog.Warningf("Cannot persist keystone token, err: %q", err)
+		return
+	}
+	catalog, err := result.ExtractServiceCatalog()
+	if err != nil {
+		klog.Warningf("Cannot persist keystone service catalog, err: %q", err)
+		return
+	}
+	cache := &openstackTokenCache{
+		Key:       openstackTokenCacheKey(opts),
+		TokenID:   token.ID,
+		ExpiresAt: token.ExpiresAt,
+		Catalog:   *catalog,
+	}
+	if err := writeOpenStackTokenCache(o.cfg.OpenStackTokenCacheDir, cache); err != nil {
+		klog.Warningf("Cannot persist keystone token, err: %q", err)
+	}
+}
+
+// openstackTokenCacheKey identifies the credentials of opts: the keystone
+// endpoint, the user or application credential and the scope of the token.
+// Secrets, e.g. the password, are deliberately left out of it, the key is
+// persisted in clear text.
+func openstackTokenCacheKey(opts gophercloud.AuthOptions) string {
+	key := []string{
+		opts.IdentityEndpoint,
+		opts.UserID, opts.Username, opts.DomainID, opts.DomainName,
+		opts.ApplicationCredentialID, opts.ApplicationCredentialName,
+		opts.TenantID, opts.TenantName,
+	}
+	if scope := opts.Scope; scope != nil {
+		key = append(key, scope.ProjectID, scope.ProjectName, scope.DomainID, scope.DomainName, strconv.FormatBool(scope.System))
+	}
+	return strings.Join(key, "|")
+}
+
+// readOpenStackTokenCache reads the persisted token from dir. It returns nil
+// and no error if no token was persisted yet.
+func readOpenStackTokenCache(dir string) (*openstackTokenCache, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, openstackTokenCacheFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	cache := &openstackTokenCache{}
+	if err := json.Unmarshal(content, cache); err != nil {
+		return nil, fmt.Errorf("could not parse persisted keystone token, err: %q", err)
+	}
+	if cache.TokenID == "" {
+		return nil, fmt.Errorf("persisted keystone token is empty")
+	}
+	return cache, nil
+}
+
+// writeOpenStackTokenCache atomically writes the token to dir. The file is
+// only readable by us, given that it holds a valid credential.
+func writeOpenStackTokenCache(dir string, cache *openstackTokenCache) error {
+	content, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, openstackTokenCacheFile)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, openstackTokenCacheFile))
+}
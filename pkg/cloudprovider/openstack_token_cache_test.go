@@ -0,0 +1,132 @@
+package cloudprovider
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	tokens3 "github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+)
+
+func TestOpenStackTokenCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystone-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Nothing persisted yet.
+	cache, err := readOpenStackTokenCache(dir)
+	if err != nil || cache != nil {
+		t.Fatalf("TestOpenStackTokenCache: expected no cache and no error, got %v and err: %q", cache, err)
+	}
+
+	catalog := tokens3.ServiceCatalog{
+		Entries: []tokens3.CatalogEntry{
+			{
+				Type: "network",
+				Endpoints: []tokens3.Endpoint{
+					{
+						Interface: "public",
+						URL:       "https://neutron.example.com:9696/",
+					},
+				},
+			},
+		},
+	}
+	// Nothing listens on this endpoint: authenticating against keystone
+	// must fail, so we know when the persisted token wasn't reused.
+	opts := gophercloud.AuthOptions{
+		IdentityEndpoint: "http://127.0.0.1:1/v3",
+		Username:         "user",
+		Password:         "password",
+		DomainName:       "default",
+		Scope:            &gophercloud.AuthScope{ProjectName: "project", DomainName: "default"},
+	}
+	otherProject := opts
+	otherProject.Scope = &gophercloud.AuthScope{ProjectName: "other-project", DomainName: "default"}
+	otherUser := opts
+	otherUser.Username = "other-user"
+	otherEndpoint := opts
+	otherEndpoint.IdentityEndpoint = "http://127.0.0.2:1/v3"
+
+	tcs := []struct {
+		expiresAt time.Time
+		issuedFor gophercloud.AuthOptions
+		reused    bool
+	}{
+		{
+			expiresAt: time.Now().Add(time.Hour),
+			issuedFor: opts,
+			reused:    true,
+		},
+		{
+			// Issued for other credentials, must re-authenticate.
+			expiresAt: time.Now().Add(time.Hour),
+			issuedFor: otherProject,
+		},
+		{
+			expiresAt: time.Now().Add(time.Hour),
+			issuedFor: otherUser,
+		},
+		{
+			expiresAt: time.Now().Add(time.Hour),
+			issuedFor: otherEndpoint,
+		},
+		{
+			// Too close to expiring, must re-authenticate.
+			expiresAt: time.Now().Add(openstackTokenExpiryMargin / 2),
+			issuedFor: opts,
+		},
+		{
+			expiresAt: time.Now().Add(-time.Hour),
+			issuedFor: opts,
+		},
+	}
+
+	for i, tc := range tcs {
+		err = writeOpenStackTokenCache(dir, &openstackTokenCache{
+			Key:       openstackTokenCacheKey(tc.issuedFor),
+			TokenID:   "persisted-token",
+			ExpiresAt: tc.expiresAt,
+			Catalog:   catalog,
+		})
+		if err != nil {
+			t.Fatalf("TestOpenStackTokenCache(%d): could not persist token, err: %q", i, err)
+		}
+
+		o := OpenStack{
+			CloudProvider: CloudProvider{
+				ctx: context.Background(),
+				cfg: CloudProviderConfig{
+					OpenStackTokenCacheDir: dir,
+				},
+			},
+		}
+		provider, err := openstack.NewClient(opts.IdentityEndpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = o.authenticate(provider, opts)
+		if !tc.reused {
+			if err == nil {
+				t.Fatalf("TestOpenStackTokenCache(%d): expected authentication against keystone, but the persisted token was reused", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestOpenStackTokenCache(%d): expected the persisted token to be reused, err: %q", i, err)
+		}
+		if provider.Token() != "persisted-token" {
+			t.Fatalf("TestOpenStackTokenCache(%d): expected token 'persisted-token', got '%s'", i, provider.Token())
+		}
+		url, err := provider.EndpointLocator(gophercloud.EndpointOpts{Type: "network", Availability: gophercloud.AvailabilityPublic})
+		if err != nil || url != "https://neutron.example.com:9696/" {
+			t.Fatalf("TestOpenStackTokenCache(%d): unexpected endpoint '%s', err: %v", i, url, err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	octaviapools "github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	"github.com/gophercloud/gophercloud/pagination"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// openstackVerificationMemberPrefix prefixes the name of the members
+	// added to the verification pool.
+	openstackVerificationMemberPrefix = "cncc-verify-"
+	// openstackVerificationPINGPort is the protocol port of the members
+	// added to the verification pool if no port is configured. Octavia
+	// requires one, but PING health monitors don't use it.
+	openstackVerificationPINGPort = 1
+)
+
+var (
+	// openstackVerificationInterval is the interval at which the member's
+	// operating status is polled, and openstackVerificationTimeout how long
+	// the health monitor has to bring it ONLINE or ERROR.
+	openstackVerificationInterval = 2 * time.Second
+	openstackVerificationTimeout  = 2 * time.Minute
+	// openstackMemberChangeBackoff retries the member changes Octavia
+	// refuses with a 409 while the load balancer is PENDING_UPDATE, e.g.
+	// with a change of another client.
+	openstackMemberChangeBackoff = wait.Backoff{Duration: time.Second, Factor: 2, Steps: 6, Cap: 30 * time.Second}
+)
+
+// initVerificationPool creates the Octavia client and checks that the
+// verification pool exists and has a health monitor: members of pools without
+// one stay in operating status NO_MONITOR.
+func (o *OpenStack) initVerificationPool(provider *gophercloud.ProviderClient) error {
+	var err error
+	o.octaviaClient, err = openstack.NewLoadBalancerV2(provider, gophercloud.EndpointOpts{})
+	if err != nil {
+		return fmt.Errorf("could not create the Octavia client for the verification pool, err: %q", err)
+	}
+	client, cancel := o.withTimeout(o.ctx, o.octaviaClient)
+	defer cancel()
+	pool, err := octaviapools.Get(client, o.cfg.OpenStackVerificationPool).Extract()
+	if err != nil {
+		return fmt.Errorf("could not get the verification pool %s, err: %q", o.cfg.OpenStackVerificationPool, err)
+	}
+	if pool.MonitorID == "" {
+		return fmt.Errorf("verification pool %s has no health monitor", pool.ID)
+	}
+	return nil
+}
+
+// ProbeReachability adds the IP address as a member of the verification pool,
+// if one is configured, on the subnet of the node's ports it's in, and waits for
+// the pool's health monitor to report it ONLINE.
+func (o *OpenStack) ProbeReachability(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	if o.octaviaClient == nil {
+		return nil
+	}
+	serverID, err := o.getNovaServerID(ctx, node)
+	if err != nil {
+		return err
+	}
+	serverPorts, err := o.listNovaServerPorts(ctx, serverID)
+	if err != nil {
+		return err
+	}
+	for _, serverPort := range serverPorts {
+		subnets, err := o.getNeutronSubnetsForNetwork(ctx, serverPort.NetworkID)
+		if err != nil {
+			return err
+		}
+		for _, s := range subnets {
+			if _, ipnet, err := net.ParseCIDR(s.CIDR); err == nil && ipnet.Contains(ip) {
+				return o.verifyReachability(ctx, ip, s.ID)
+			}
+		}
+	}
+	return fmt.Errorf("IP address %s is on no subnet of the ports of node %s", ip, node.Name)
+}
+
+// verifyReachability adds ip on subnetID as a member of the verification pool
+// and waits for the pool's health monitor to report it ONLINE. The health
+// checks originate from the load balancer, i.e. from within the cloud, so
+// they prove that the IP address is reachable on the subnet end-to-end,
+// where neutron's own status can't be trusted with some SDN backends. The
+// member is deleted again in any case.
+func (o *OpenStack) verifyReachability(ctx context.Context, ip net.IP, subnetID string) error {
+	poolID := o.cfg.OpenStackVerificationPool
+	name := openstackVerificationMemberPrefix + ip.String()
+	// A member left behind by a previous verification, e.g. if we were
+	// killed, would make the creation conflict.
+	if err := o.deleteVerificationMembers(ctx, poolID, ip); err != nil {
+		return err
+	}
+	port := o.cfg.OpenStackVerificationPort
+	if port == 0 {
+		port = openstackVerificationPINGPort
+	}
+	var member *octaviapools.Member
+	err := o.changeVerificationMembers(func() (err error) {
+		client, cancel := o.withTimeout(ctx, o.octaviaClient)
+		defer cancel()
+		member, err = octaviapools.CreateMember(client, poolID, octaviapools.CreateMemberOpts{
+			Name:         name,
+			Address:      ip.String(),
+			ProtocolPort: port,
+			SubnetID:     subnetID,
+		}).Extract()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not add IP address %s to verification pool %s, err: %q", ip, poolID, err)
+	}
+	defer func() {
+		if err := o.deleteVerificationMember(ctx, poolID, member.ID); err != nil {
+			klog.Warningf("Could not delete member %s of IP address %s from verification pool %s, err: %q", member.ID, ip, poolID, err)
+		}
+	}()
+
+	status := member.OperatingStatus
+	err = wait.PollImmediate(openstackVerificationInterval, openstackVerificationTimeout, func() (bool, error) {
+		client, cancel := o.withTimeout(ctx, o.octaviaClient)
+		defer cancel()
+		member, err := octaviapools.GetMember(client, poolID, member.ID).Extract()
+		if err != nil {
+			return false, err
+		}
+		status = member.OperatingStatus
+		return status == "ONLINE" || status == "ERROR" || status == "NO_MONITOR", nil
+	})
+	switch {
+	case err == wait.ErrWaitTimeout:
+		return fmt.Errorf("health monitor of verification pool %s did not report IP address %s within %s, operating status: %s", poolID, ip, openstackVerificationTimeout, status)
+	case err != nil:
+		return fmt.Errorf("could not get the member of IP address %s in verification pool %s, err: %q", ip, poolID, err)
+	case status != "ONLINE":
+		return fmt.Errorf("health monitor of verification pool %s reports IP address %s with operating status %s", poolID, ip, status)
+	}
+	return nil
+}
+
+// deleteVerificationMembers deletes the members of ip from the verification
+// pool.
+func (o *OpenStack) deleteVerificationMembers(ctx context.Context, poolID string, ip net.IP) error {
+	var memberIDs []string
+	client, cancel := o.withTimeout(ctx, o.octaviaClient)
+	defer cancel()
+	err := octaviapools.ListMembers(client, poolID, octaviapools.ListMembersOpts{Address: ip.String()}).EachPage(func(page pagination.Page) (bool, error) {
+		members, err := octaviapools.ExtractMembers(page)
+		if err != nil {
+			return false, err
+		}
+		for _, member := range members {
+			memberIDs = append(memberIDs, member.ID)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not list the members of IP address %s in verification pool %s, err: %q", ip, poolID, err)
+	}
+	for _, memberID := range memberIDs {
+		if err := o.deleteVerificationMember(ctx, poolID, memberID); err != nil {
+			return fmt.Errorf("could not delete stale member %s of IP address %s from verification pool %s, err: %q", memberID, ip, poolID, err)
+		}
+	}
+	return nil
+}
+
+// deleteVerificationMember deletes a member of the verification pool, unless
+// it's already gone.
+func (o *OpenStack) deleteVerificationMember(ctx context.Context, poolID, memberID string) error {
+	return o.changeVerificationMembers(func() error {
+		var notFound gophercloud.ErrDefault404
+		client, cancel := o.withTimeout(ctx, o.octaviaClient)
+		defer cancel()
+		if err := octaviapools.DeleteMember(client, poolID, memberID).ExtractErr(); err != nil && !errors.As(err, &notFound) {
+			return err
+		}
+		return nil
+	})
+}
+
+// changeVerificationMembers performs a change to the members of the
+// verification pool, one at a time, retrying it while Octavia refuses it as
+// the load balancer is busy with a previous change.
+func (o *OpenStack) changeVerificationMembers(change func() error) error {
+	o.verificationLock.Lock()
+	defer o.verificationLock.Unlock()
+	var err error
+	waitErr := wait.ExponentialBackoff(openstackMemberChangeBackoff, func() (bool, error) {
+		err = change()
+		var conflict gophercloud.ErrDefault409
+		return !errors.As(err, &conflict), nil
+	})
+	if waitErr == wait.ErrWaitTimeout {
+		return fmt.Errorf("load balancer of the verification pool stayed busy, err: %q", err)
+	}
+	return err
+}
@@ -0,0 +1,160 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	th "github.com/gophercloud/gophercloud/testhelper"
+	testclient "github.com/gophercloud/gophercloud/testhelper/client"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// fakeVerificationPool serves the Octavia member operations of a single pool,
+// whose health monitor reports every new member with operatingStatus once
+// polled. The first conflicts member changes are refused as the load balancer
+// is busy.
+type fakeVerificationPool struct {
+	mu              sync.Mutex
+	operatingStatus string
+	members         map[string]map[string]interface{}
+	created         int
+	conflicts       int
+}
+
+// conflict refuses the member change if the load balancer is still busy.
+func (f *fakeVerificationPool) conflict(w http.ResponseWriter) bool {
+	if f.conflicts == 0 {
+		return false
+	}
+	f.conflicts--
+	w.WriteHeader(http.StatusConflict)
+	return true
+}
+
+func (f *fakeVerificationPool) handle(t *testing.T, poolID string) {
+	th.Mux.HandleFunc("/lbaas/pools/"+poolID+"/members", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		w.Header().Add("Content-Type", "application/json")
+		switch r.Method {
+		case "GET":
+			members := []map[string]interface{}{}
+			for _, member := range f.members {
+				if member["address"] == r.URL.Query().Get("address") {
+					members = append(members, member)
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"members": members})
+		case "POST":
+			if f.conflict(w) {
+				return
+			}
+			var body struct {
+				Member map[string]interface{} `json:"member"`
+			}
+			th.AssertNoErr(t, json.NewDecoder(r.Body).Decode(&body))
+			f.created++
+			member := body.Member
+			member["id"] = fmt.Sprintf("member-%d", f.created)
+			member["operating_status"] = "OFFLINE"
+			f.members[member["id"].(string)] = member
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{"member": member})
+		}
+	})
+	th.Mux.HandleFunc("/lbaas/pools/"+poolID+"/members/", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		id := r.URL.Path[len("/lbaas/pools/"+poolID+"/members/"):]
+		member, ok := f.members[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case "GET":
+			member["operating_status"] = f.operatingStatus
+			w.Header().Add("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"member": member})
+		case "DELETE":
+			if f.conflict(w) {
+				return
+			}
+			delete(f.members, id)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
+
+func TestVerifyReachability(t *testing.T) {
+	poolID := "5a9a3e9e-d1aa-448e-af37-a70171f2a332"
+	subnetID := "49895d6d-6972-4198-8afa-ada96e1daaef"
+	ip := net.ParseIP("192.0.2.1")
+	defer func(interval, timeout time.Duration, backoff wait.Backoff) {
+		openstackVerificationInterval, openstackVerificationTimeout, openstackMemberChangeBackoff = interval, timeout, backoff
+	}(openstackVerificationInterval, openstackVerificationTimeout, openstackMemberChangeBackoff)
+	openstackVerificationInterval, openstackVerificationTimeout = 10*time.Millisecond, 100*time.Millisecond
+	openstackMemberChangeBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3}
+
+	tcs := []struct {
+		operatingStatus string
+		// staleMember is left behind by a previous verification.
+		staleMember bool
+		// conflicts are the member changes refused as the load balancer
+		// is busy.
+		conflicts int
+		expectErr bool
+	}{
+		{
+			operatingStatus: "ONLINE",
+		},
+		{
+			operatingStatus: "ONLINE",
+			staleMember:     true,
+		},
+		{
+			operatingStatus: "ERROR",
+			expectErr:       true,
+		},
+		{
+			// The creation and the deletion of the member are retried.
+			operatingStatus: "ONLINE",
+			conflicts:       2,
+		},
+		{
+			// The health monitor never checks the member.
+			operatingStatus: "OFFLINE",
+			expectErr:       true,
+		},
+	}
+	for i, tc := range tcs {
+		th.SetupHTTP()
+		fake := &fakeVerificationPool{operatingStatus: tc.operatingStatus, members: map[string]map[string]interface{}{}, conflicts: tc.conflicts}
+		if tc.staleMember {
+			fake.members["stale"] = map[string]interface{}{"id": "stale", "address": ip.String()}
+		}
+		fake.handle(t, poolID)
+		o := OpenStack{
+			CloudProvider: CloudProvider{ctx: context.Background(), cfg: CloudProviderConfig{OpenStackVerificationPool: poolID}},
+			octaviaClient: testclient.ServiceClient(),
+		}
+
+		err := o.verifyReachability(context.Background(), ip, subnetID)
+		th.TeardownHTTP()
+		if tc.expectErr && err == nil {
+			t.Fatalf("TestVerifyReachability(%d): expected an error, got nil", i)
+		}
+		if !tc.expectErr && err != nil {
+			t.Fatalf("TestVerifyReachability(%d): received unexpected error, err: %q", i, err)
+		}
+		if fake.created != 1 || len(fake.members) != 0 {
+			t.Fatalf("TestVerifyReachability(%d): expected a single member to be created and all members to be deleted, got %d created and %v left", i, fake.created, fake.members)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+package cloudprovider
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+const (
+	// PlatformTypeOVirt is the string representation for the oVirt / RHV
+	// platform type.
+	PlatformTypeOVirt   = "oVirt"
+	ovirtProviderPrefix = "ovirt://"
+
+	// ovirtIPv4Parameter and ovirtIPv6Parameter are the names of the network
+	// filter parameters holding the IPv4 and IPv6 addresses the network
+	// filter of a vNIC, e.g. clean-traffic, lets the VM send from.
+	ovirtIPv4Parameter = "IP"
+	ovirtIPv6Parameter = "IPV6"
+
+	// NOTE: oVirt has no notion of a capacity of a vNIC either, the network
+	// filter parameters are unlimited. As on OpenStack, we settle on a sane
+	// ceiling of 64 IP addresses per vNIC.
+	ovirtMaxCapacity = 64
+)
+
+// OVirt implements the API wrapper for talking to the oVirt engine API.
+// oVirt networks are layer 2 only, the addresses a VM can send from are only
+// restricted by the network filter of the vNIC profile of its vNICs: egress
+// IPs are network filter parameters of the first vNIC of the VM, next to the
+// ones of the addresses of the node.
+type OVirt struct {
+	CloudProvider
+	noOwnedResources
+	client *restClient
+	// machineNetworks are the subnets of the VMs, which oVirt doesn't know.
+	machineNetworks []*net.IPNet
+	// nicLocks serializes the changes of the network filter parameters of
+	// each vNIC.
+	nicLocks keyedMutex
+}
+
+type ovirtNIC struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	MAC  struct {
+		Address string `json:"address"`
+	} `json:"mac"`
+}
+
+type ovirtNetworkFilterParameter struct {
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (o *OVirt) initCredentials() error {
+	apiURL, err := o.readSecretData("ovirt_url")
+	if err != nil {
+		return err
+	}
+	username, err := o.readSecretData("ovirt_username")
+	if err != nil {
+		return err
+	}
+	password, err := o.readSecretData("ovirt_password")
+	if err != nil {
+		return err
+	}
+	if o.machineNetworks, err = parseOVirtMachineNetworks(o.cfg.OVirtMachineNetworks); err != nil {
+		return err
+	}
+	transport, err := newHTTPTransport(o.cfg.ConfigDir)
+	if err != nil {
+		return err
+	}
+	// The secret may hold the CA of the engine, which is usually self-signed.
+	if caBundle, err := o.readSecretData("ovirt_ca_bundle"); err == nil && strings.TrimSpace(caBundle) != "" {
+		if err := appendOVirtCABundle(transport, caBundle); err != nil {
+			return err
+		}
+	}
+	httpClient := newTracedHTTPClient(transport)
+	if o.cfg.APIOverride != "" {
+		apiURL = o.cfg.APIOverride
+	}
+	username, password = strings.TrimSpace(username), strings.TrimSpace(password)
+	o.client = &restClient{
+		httpClient: httpClient,
+		baseURL:    strings.TrimSpace(apiURL),
+		authorize: func(r *http.Request) error {
+			r.SetBasicAuth(username, password)
+			r.Header.Set("Version", "4")
+			return nil
+		},
+	}
+	klog.Infof("Using the oVirt engine API at %s", o.client.baseURL)
+	return nil
+}
+
+// appendOVirtCABundle makes the HTTP transport trust the certificates of the
+// CA bundle, on top of the ones it trusts already.
+func appendOVirtCABundle(transport *http.Transport, caBundle string) error {
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	if transport.TLSClientConfig.RootCAs == nil {
+		certPool, err := x509.SystemCertPool()
+		if err != nil {
+			return fmt.Errorf("could not initialize x509 SystemCertPool, err: %q", err)
+		}
+		transport.TLSClientConfig.RootCAs = certPool
+	}
+	if !transport.TLSClientConfig.RootCAs.AppendCertsFromPEM([]byte(caBundle)) {
+		return fmt.Errorf("could not parse secret data ovirt_ca_bundle, no PEM certificate found")
+	}
+	return nil
+}
+
+// AssignPrivateIP adds a network filter parameter of ip to the first vNIC of
+// the node's VM. A vNIC without any network filter parameter of the address
+// family of ip gets the ones of the addresses of the node first: the network
+// filter only lets the VM send from the learned address until parameters are
+// set, adding one of the egress IP alone would cut the node off.
+func (o *OVirt) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	vmID, nic, err := o.getNIC(ctx, node)
+	if err != nil {
+		return err
+	}
+	defer o.nicLocks.Lock(nic.ID)()
+	parameters, err := o.listParameters(ctx, vmID, nic.ID)
+	if err != nil {
+		return err
+	}
+	name := getOVirtParameterName(ip)
+	if getOVirtParameter(parameters, ip) != nil {
+		for _, nodeIP := range nodeInternalIPs(node) {
+			if nodeIP.Equal(ip) {
+				return fmt.Errorf("IP address %s is the address of node %s", ip, node.Name)
+			}
+		}
+		return AlreadyExistingIPError
+	}
+	addresses := []net.IP{ip}
+	if !hasOVirtParameter(parameters, name) {
+		var nodeIPs []net.IP
+		for _, nodeIP := range nodeInternalIPs(node) {
+			if getOVirtParameterName(nodeIP) == name {
+				nodeIPs = append(nodeIPs, nodeIP)
+			}
+		}
+		if len(nodeIPs) == 0 {
+			return fmt.Errorf("node %s has no address of the family of IP address %s to keep in the network filter parameters of vNIC %s", node.Name, ip, nic.Name)
+		}
+		addresses = append(nodeIPs, ip)
+	}
+	for _, address := range addresses {
+		parameter := &ovirtNetworkFilterParameter{Name: name, Value: address.String()}
+		if err := o.client.do(ctx, http.MethodPost, fmt.Sprintf("/vms/%s/nics/%s/networkfilterparameters", vmID, nic.ID), nil, parameter, nil); err != nil {
+			return fmt.Errorf("error adding network filter parameter %s=%s to vNIC %s of VM %s, err: %v", name, address, nic.Name, vmID, err)
+		}
+	}
+	return nil
+}
+
+func (o *OVirt) AllowsMovePrivateIP() bool {
+	return false
+}
+
+func (o *OVirt) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+	return nil
+}
+
+// ReleasePrivateIP removes the network filter parameter of ip from the first
+// vNIC of the node's VM. The parameters of the addresses of the node are
+// kept.
+func (o *OVirt) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	vmID, nic, err := o.getNIC(ctx, node)
+	if err != nil {
+		return err
+	}
+	for _, nodeIP := range nodeInternalIPs(node) {
+		if nodeIP.Equal(ip) {
+			return NonExistingIPError
+		}
+	}
+	defer o.nicLocks.Lock(nic.ID)()
+	parameters, err := o.listParameters(ctx, vmID, nic.ID)
+	if err != nil {
+		return err
+	}
+	parameter := getOVirtParameter(parameters, ip)
+	if parameter == nil {
+		return NonExistingIPError
+	}
+	return o.client.do(ctx, http.MethodDelete, fmt.Sprintf("/vms/%s/nics/%s/networkfilterparameters/%s", vmID, nic.ID, parameter.ID), nil, nil, nil)
+}
+
+func (o *OVirt) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, o.AssignPrivateIP)
+}
+
+func (o *OVirt) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, o.ReleasePrivateIP)
+}
+
+// GetNodeEgressIPConfiguration returns the configuration of the first vNIC of
+// the node's VM, keyed by ID. Its subnets are the machine networks holding
+// the addresses of the node.
+func (o *OVirt) GetNodeEgressIPConfiguration(ctx context.Context, node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
+	vmID, nic, err := o.getNIC(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	parameters, err := o.listParameters(ctx, vmID, nic.ID)
+	if err != nil {
+		return nil, err
+	}
+	config := &NodeEgressIPConfiguration{
+		Interface: nic.ID,
+		MAC:       normalizeMAC(nic.MAC.Address),
+	}
+	nodeIPs := nodeInternalIPs(node)
+	for _, nodeIP := range nodeIPs {
+		for _, machineNetwork := range o.machineNetworks {
+			if !machineNetwork.Contains(nodeIP) {
+				continue
+			}
+			if utilnet.IsIPv4(nodeIP) && config.IFAddr.IPv4 == "" {
+				config.IFAddr.IPv4 = machineNetwork.String()
+				config.Capacity.IPv4 = ovirtMaxCapacity - countOVirtEgressIPs(parameters, ovirtIPv4Parameter, nodeIPs)
+			}
+			if utilnet.IsIPv6(nodeIP) && config.IFAddr.IPv6 == "" {
+				config.IFAddr.IPv6 = machineNetwork.String()
+				config.Capacity.IPv6 = ovirtMaxCapacity - countOVirtEgressIPs(parameters, ovirtIPv6Parameter, nodeIPs)
+			}
+		}
+	}
+	if config.IFAddr.IPv4 == "" && config.IFAddr.IPv6 == "" {
+		return nil, fmt.Errorf("no machine network holds an address of node %s, machine networks: %v", node.Name, o.cfg.OVirtMachineNetworks)
+	}
+	return []*NodeEgressIPConfiguration{config}, nil
+}
+
+// CleanupNode is a no-op, network filter parameters are deleted together with
+// the VM.
+func (o *OVirt) CleanupNode(ctx context.Context, node *corev1.Node) error {
+	return nil
+}
+
+// VerifyPrivateIP verifies that the network filter parameter of ip is still
+// set on the first vNIC of the node's VM, wrapping a MissingIPError otherwise.
+func (o *OVirt) VerifyPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	vmID, nic, err := o.getNIC(ctx, node)
+	if err != nil {
+		return err
+	}
+	parameters, err := o.listParameters(ctx, vmID, nic.ID)
+	if err != nil {
+		return err
+	}
+	if getOVirtParameter(parameters, ip) == nil {
+		return fmt.Errorf("%w: vNIC %s of VM %s has no network filter parameter of IP address %s", MissingIPError, nic.Name, vmID, ip)
+	}
+	return nil
+}
+
+// GetPrivateIPReservations returns nil, network filter parameters aren't
+// resources of their own.
+func (o *OVirt) GetPrivateIPReservations(ctx context.Context, ip net.IP, node *corev1.Node) ([]PrivateIPReservation, error) {
+	return nil, nil
+}
+
+// GetNodeNetworkInterfaces returns nil, the vNICs of VMs aren't tracked.
+func (o *OVirt) GetNodeNetworkInterfaces(ctx context.Context, node *corev1.Node) ([]string, error) {
+	return nil, nil
+}
+
+// ListPrivateIPs returns the IP addresses of the network filter parameters of
+// the first vNIC of the node's VM, the node's own aside.
+func (o *OVirt) ListPrivateIPs(ctx context.Context, node *corev1.Node) ([]net.IP, error) {
+	vmID, nic, err := o.getNIC(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	parameters, err := o.listParameters(ctx, vmID, nic.ID)
+	if err != nil {
+		return nil, err
+	}
+	nodeIPs := nodeInternalIPs(node)
+	ips := []net.IP{}
+parameters:
+	for _, parameter := range parameters {
+		ip := ParseIP(parameter.Value)
+		if ip == nil || parameter.Name != getOVirtParameterName(ip) {
+			continue
+		}
+		for _, nodeIP := range nodeIPs {
+			if nodeIP.Equal(ip) {
+				continue parameters
+			}
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+// CheckHealth retrieves the vNIC of the node's VM.
+func (o *OVirt) CheckHealth(ctx context.Context, node *corev1.Node) error {
+	_, _, err := o.getNIC(ctx, node)
+	return err
+}
+
+// getNIC returns the ID of the node's VM and its first vNIC, by name.
+func (o *OVirt) getNIC(ctx context.Context, node *corev1.Node) (string, *ovirtNIC, error) {
+	vmID, err := getOVirtVMID(node)
+	if err != nil {
+		return "", nil, err
+	}
+	nics := &struct {
+		NICs []ovirtNIC `json:"nic"`
+	}{}
+	if err := o.client.do(ctx, http.MethodGet, fmt.Sprintf("/vms/%s/nics", vmID), nil, nil, nics); err != nil {
+		return "", nil, fmt.Errorf("error retrieving the vNICs of VM %s of node %s, err: %v", vmID, node.Name, err)
+	}
+	if len(nics.NICs) == 0 {
+		return "", nil, fmt.Errorf("%w: VM %s of node %s has no vNIC", NoNetworkInterfaceError, vmID, node.Name)
+	}
+	sort.SliceStable(nics.NICs, func(i, j int) bool {
+		return nics.NICs[i].Name < nics.NICs[j].Name
+	})
+	return vmID, &nics.NICs[0], nil
+}
+
+func (o *OVirt) listParameters(ctx context.Context, vmID, nicID string) ([]ovirtNetworkFilterParameter, error) {
+	parameters := &struct {
+		Parameters []ovirtNetworkFilterParameter `json:"network_filter_parameter"`
+	}{}
+	if err := o.client.do(ctx, http.MethodGet, fmt.Sprintf("/vms/%s/nics/%s/networkfilterparameters", vmID, nicID), nil, nil, parameters); err != nil {
+		return nil, fmt.Errorf("error retrieving the network filter parameters of vNIC %s of VM %s, err: %v", nicID, vmID, err)
+	}
+	return parameters.Parameters, nil
+}
+
+// getOVirtParameterName returns the name of the network filter parameters of
+// the address family of ip.
+func getOVirtParameterName(ip net.IP) string {
+	if utilnet.IsIPv6(ip) {
+		return ovirtIPv6Parameter
+	}
+	return ovirtIPv4Parameter
+}
+
+// getOVirtParameter returns the network filter parameter of ip, nil if
+// there's none.
+func getOVirtParameter(parameters []ovirtNetworkFilterParameter, ip net.IP) *ovirtNetworkFilterParameter {
+	name := getOVirtParameterName(ip)
+	for _, parameter := range parameters {
+		if parameter.Name == name && ParseIP(parameter.Value).Equal(ip) {
+			return &parameter
+		}
+	}
+	return nil
+}
+
+// hasOVirtParameter returns true if there's a network filter parameter named
+// name.
+func hasOVirtParameter(parameters []ovirtNetworkFilterParameter, name string) bool {
+	for _, parameter := range parameters {
+		if parameter.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// countOVirtEgressIPs returns the number of network filter parameters named
+// name which aren't addresses of the node.
+func countOVirtEgressIPs(parameters []ovirtNetworkFilterParameter, name string, nodeIPs []net.IP) int {
+	count := 0
+	for _, parameter := range parameters {
+		if parameter.Name != name {
+			continue
+		}
+		isNodeIP := false
+		for _, nodeIP := range nodeIPs {
+			if nodeIP.Equal(ParseIP(parameter.Value)) {
+				isNodeIP = true
+			}
+		}
+		if !isNodeIP {
+			count++
+		}
+	}
+	return count
+}
+
+// parseOVirtMachineNetworks parses the comma separated list of the CIDRs of
+// the machine networks.
+func parseOVirtMachineNetworks(s string) ([]*net.IPNet, error) {
+	var machineNetworks []*net.IPNet
+	for _, cidr := range strings.Split(s, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		_, machineNetwork, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid oVirt machine network %q, err: %v", cidr, err)
+		}
+		machineNetworks = append(machineNetworks, machineNetwork)
+	}
+	if len(machineNetworks) == 0 {
+		return nil, fmt.Errorf("the machine networks are needed on oVirt, its networks have no subnets")
+	}
+	return machineNetworks, nil
+}
+
+// getOVirtVMID returns the ID of the node's VM, out of its providerID, which
+// looks like ovirt://<VM ID>.
+func getOVirtVMID(node *corev1.Node) (string, error) {
+	vmID := strings.TrimPrefix(node.Spec.ProviderID, ovirtProviderPrefix)
+	if vmID == node.Spec.ProviderID || vmID == "" || strings.Contains(vmID, "/") {
+		return "", fmt.Errorf("failed to parse node %s provider id %q, expected %s<VM ID>", node.Name, node.Spec.ProviderID, ovirtProviderPrefix)
+	}
+	return vmID, nil
+}
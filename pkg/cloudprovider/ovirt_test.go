@@ -0,0 +1,194 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeOVirt serves the oVirt engine API requests of VM vm-0, whose first vNIC
+// is nic1.
+type fakeOVirt struct {
+	mu         sync.Mutex
+	parameters []ovirtNetworkFilterParameter
+	ids        int
+}
+
+func (f *fakeOVirt) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if username, password, ok := r.BasicAuth(); !ok || username != "admin@internal" || password != "password" || r.Header.Get("Version") != "4" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	const parametersPath = "/ovirt-engine/api/vms/vm-0/nics/nic-1/networkfilterparameters"
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/ovirt-engine/api/vms/vm-0/nics":
+		_, _ = w.Write([]byte(`{"nic": [{"id": "nic-2", "name": "nic2"}, {"id": "nic-1", "name": "nic1", "mac": {"address": "56:6F:00:00:00:01"}}]}`))
+	case r.Method == http.MethodGet && r.URL.Path == parametersPath:
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"network_filter_parameter": f.parameters})
+	case r.Method == http.MethodPost && r.URL.Path == parametersPath:
+		parameter := ovirtNetworkFilterParameter{}
+		if err := json.NewDecoder(r.Body).Decode(&parameter); err != nil || parameter.Name == "" || parameter.Value == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.ids++
+		parameter.ID = fmt.Sprint(f.ids)
+		f.parameters = append(f.parameters, parameter)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(parameter)
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, parametersPath+"/"):
+		id := strings.TrimPrefix(r.URL.Path, parametersPath+"/")
+		for i, parameter := range f.parameters {
+			if parameter.ID == id {
+				f.parameters = append(f.parameters[:i], f.parameters[i+1:]...)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeOVirtProvider(server *httptest.Server) *OVirt {
+	_, machineNetwork, _ := net.ParseCIDR("192.168.0.0/24")
+	return &OVirt{
+		CloudProvider:   CloudProvider{ctx: context.Background()},
+		machineNetworks: []*net.IPNet{machineNetwork},
+		client: &restClient{
+			httpClient: server.Client(),
+			baseURL:    server.URL + "/ovirt-engine/api",
+			authorize: func(r *http.Request) error {
+				r.SetBasicAuth("admin@internal", "password")
+				r.Header.Set("Version", "4")
+				return nil
+			},
+		},
+	}
+}
+
+func newOVirtNode() *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0"},
+		Spec:       corev1.NodeSpec{ProviderID: "ovirt://vm-0"},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "192.168.0.10"}},
+		},
+	}
+}
+
+// newOVirtFakeCloud plugs the fake API into the tests shared by the clouds.
+func newOVirtFakeCloud(t *testing.T) *fakeCloud {
+	fake := &fakeOVirt{}
+	server := httptest.NewServer(fake)
+	return &fakeCloud{
+		CloudProviderIntf: newFakeOVirtProvider(server),
+		assigned: func() []string {
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			// The parameter of the node's address is no egress IP.
+			ips := []string{}
+			for _, parameter := range fake.parameters {
+				if parameter.Value != "192.168.0.10" {
+					ips = append(ips, parameter.Value)
+				}
+			}
+			return ips
+		},
+		close: server.Close,
+	}
+}
+
+func TestOVirtAssignPrivateIP(t *testing.T) {
+	tcs := []struct {
+		ip         string
+		parameters []ovirtNetworkFilterParameter
+		expected   []string
+		expectErr  bool
+	}{
+		// The address of the node is kept once parameters are set.
+		{ip: "192.168.0.20", expected: []string{"IP=192.168.0.10", "IP=192.168.0.20"}},
+		{
+			ip:         "192.168.0.21",
+			parameters: []ovirtNetworkFilterParameter{{ID: "a", Name: "IP", Value: "192.168.0.10"}, {ID: "b", Name: "IP", Value: "192.168.0.20"}},
+			expected:   []string{"IP=192.168.0.10", "IP=192.168.0.20", "IP=192.168.0.21"},
+		},
+		// The node has no IPv6 address to keep.
+		{ip: "fd00::20", expectErr: true},
+		{
+			ip:         "192.168.0.10",
+			parameters: []ovirtNetworkFilterParameter{{ID: "a", Name: "IP", Value: "192.168.0.10"}},
+			expected:   []string{"IP=192.168.0.10"},
+			expectErr:  true,
+		},
+	}
+	for i, tc := range tcs {
+		fake := &fakeOVirt{parameters: tc.parameters}
+		server := httptest.NewServer(fake)
+		provider := newFakeOVirtProvider(server)
+		err := provider.AssignPrivateIP(context.Background(), net.ParseIP(tc.ip), newOVirtNode())
+		server.Close()
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestOVirtAssignPrivateIP(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		var parameters []string
+		for _, parameter := range fake.parameters {
+			parameters = append(parameters, parameter.Name+"="+parameter.Value)
+		}
+		if strings.Join(parameters, ",") != strings.Join(tc.expected, ",") {
+			t.Fatalf("TestOVirtAssignPrivateIP(%d): expected network filter parameters %v, got %v", i, tc.expected, parameters)
+		}
+	}
+}
+
+func TestOVirtReleasePrivateIP(t *testing.T) {
+	fake := &fakeOVirt{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	provider := newFakeOVirtProvider(server)
+	node := newOVirtNode()
+	ip := net.ParseIP("192.168.0.20")
+
+	if err := provider.AssignPrivateIP(context.Background(), ip, node); err != nil {
+		t.Fatalf("received unexpected error assigning IP address, err: %v", err)
+	}
+	if err := provider.ReleasePrivateIP(context.Background(), ip, node); err != nil {
+		t.Fatalf("received unexpected error releasing IP address, err: %v", err)
+	}
+	if len(fake.parameters) != 1 || fake.parameters[0].Value != "192.168.0.10" {
+		t.Fatalf("expected only the network filter parameter of the node's address to be kept, got %v", fake.parameters)
+	}
+}
+
+func TestParseOVirtMachineNetworks(t *testing.T) {
+	tcs := []struct {
+		machineNetworks string
+		expected        string
+		expectErr       bool
+	}{
+		{machineNetworks: "192.168.0.0/24", expected: "[192.168.0.0/24]"},
+		{machineNetworks: "192.168.0.1/24, fd00::/64", expected: "[192.168.0.0/24 fd00::/64]"},
+		{machineNetworks: "", expectErr: true},
+		{machineNetworks: "192.168.0.0", expectErr: true},
+	}
+	for i, tc := range tcs {
+		machineNetworks, err := parseOVirtMachineNetworks(tc.machineNetworks)
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestParseOVirtMachineNetworks(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		if !tc.expectErr && fmt.Sprint(machineNetworks) != tc.expected {
+			t.Fatalf("TestParseOVirtMachineNetworks(%d): expected machine networks %s, got %v", i, tc.expected, machineNetworks)
+		}
+	}
+}
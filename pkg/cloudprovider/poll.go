@@ -0,0 +1,62 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// pollUntilDone calls poll every interval at first, the interval doubling
+// after every call up to maxInterval, until it reports done or timeout
+// elapsed. poll returns the error of what it waits for together with done if
+// that failed, and its own error otherwise, which ends the wait unless it's
+// due to the wait's context being done. The wait is abandoned as soon as the
+// controller shuts down: the operations on the cloud complete on their own,
+// the next sync finds them done. what describes what's waited for in the
+// errors, e.g. "operation X".
+func (c *CloudProvider) pollUntilDone(ctx context.Context, what string, interval, maxInterval, timeout time.Duration, poll func(ctx context.Context) (done bool, err error)) error {
+	if maxInterval < interval {
+		maxInterval = interval
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	c.cancelOnShutdown(ctx, cancel)
+
+	for {
+		done, err := poll(ctx)
+		if done || err != nil && ctx.Err() == nil {
+			return err
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if c.cfg.ShutdownContext != nil && c.cfg.ShutdownContext.Err() != nil {
+				klog.Warningf("Abandoning the wait for %s, the controller is shutting down", what)
+				return fmt.Errorf("abandoned the wait for %s on shutdown: %w", what, c.cfg.ShutdownContext.Err())
+			}
+			return fmt.Errorf("timed out waiting for %s after %v: %w", what, timeout, ctx.Err())
+		case <-timer.C:
+		}
+		if interval *= 2; interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+// cancelOnShutdown cancels ctx with cancel as soon as the controller shuts
+// down, unless ctx is done first.
+func (c *CloudProvider) cancelOnShutdown(ctx context.Context, cancel context.CancelFunc) {
+	if c.cfg.ShutdownContext == nil {
+		return
+	}
+	go func() {
+		select {
+		case <-c.cfg.ShutdownContext.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+}
@@ -0,0 +1,448 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+const (
+	// PlatformTypePowerVS is the string representation for the IBM Power
+	// Systems Virtual Server platform type.
+	PlatformTypePowerVS = "PowerVS"
+
+	// powerVSPortOwner prefixes the description of the network ports of egress
+	// IPs, followed by the ID of the PVM instance they're created for.
+	powerVSPortOwner = "cloud-network-config-controller:"
+	// powerVSPortActive is the status of network ports attached to a running
+	// PVM instance. Ports are DOWN while detached and BUILD in between.
+	powerVSPortActive = "ACTIVE"
+	// powerVSDefaultIPsPerInstance applies if PowerVSIPsPerInstance isn't set.
+	powerVSDefaultIPsPerInstance = 8
+	// defaultPowerVSPollInterval, defaultPowerVSPollMaxInterval and
+	// defaultPowerVSOperationTimeout apply to the waits for network ports to
+	// be attached and detached, the latter if PowerVSOperationTimeout isn't
+	// set.
+	defaultPowerVSPollInterval     = 2 * time.Second
+	defaultPowerVSPollMaxInterval  = 15 * time.Second
+	defaultPowerVSOperationTimeout = 10 * time.Minute
+)
+
+// PowerVS implements the API wrapper for talking to the IBM Power Systems
+// Virtual Server API. Egress IPs are network ports of the network of the PVM
+// instance, attached to it. Network ports are attached and detached
+// asynchronously, in the order of minutes, so every change is followed by
+// polling the port until it's done.
+type PowerVS struct {
+	CloudProvider
+	noOwnedResources
+	client *restClient
+	// cloudInstanceID is the ID of the Power VS workspace of the cluster.
+	cloudInstanceID string
+	// pollInterval is the first interval between polls of network ports,
+	// doubling after every poll up to pollMaxInterval.
+	pollInterval    time.Duration
+	pollMaxInterval time.Duration
+}
+
+type powerVSPort struct {
+	PortID      string `json:"portID,omitempty"`
+	IPAddress   string `json:"ipAddress,omitempty"`
+	MACAddress  string `json:"macAddress,omitempty"`
+	Status      string `json:"status,omitempty"`
+	Description string `json:"description,omitempty"`
+	PVMInstance *struct {
+		PVMInstanceID string `json:"pvmInstanceID"`
+	} `json:"pvmInstance,omitempty"`
+}
+
+type powerVSNetwork struct {
+	NetworkID string `json:"networkID"`
+	Name      string `json:"name"`
+	CIDR      string `json:"cidr"`
+}
+
+func (p *PowerVS) initCredentials() error {
+	apiKey, err := p.readSecretData("ibmcloud_api_key")
+	if err != nil {
+		return err
+	}
+	crn := p.cfg.PowerVSCloudInstanceCRN
+	if p.cloudInstanceID, err = getPowerVSCloudInstanceID(crn); err != nil {
+		return err
+	}
+	httpClient, err := newHTTPClient(p.cfg.ConfigDir)
+	if err != nil {
+		return err
+	}
+	baseURL := p.cfg.APIOverride
+	if baseURL == "" {
+		if p.cfg.PowerVSRegion == "" {
+			return fmt.Errorf("the Power VS region is needed to reach the Power VS API of the region, unless the API URL is overridden")
+		}
+		baseURL = fmt.Sprintf("https://%s.power-iaas.cloud.ibm.com", p.cfg.PowerVSRegion)
+	}
+	iam := newIBMCloudIAM(httpClient, p.cfg.IBMCloudIAMURL, strings.TrimSpace(apiKey))
+	p.client = &restClient{
+		httpClient: httpClient,
+		baseURL:    strings.TrimSuffix(baseURL, "/") + "/pcloud/v1/cloud-instances/" + p.cloudInstanceID,
+		// Every request names the workspace by its CRN as well.
+		authorize: func(r *http.Request) error {
+			r.Header.Set("CRN", crn)
+			return iam.authorize(r)
+		},
+	}
+	p.pollInterval, p.pollMaxInterval = defaultPowerVSPollInterval, defaultPowerVSPollMaxInterval
+	klog.Infof("Using the Power VS API at %s for workspace %s", baseURL, p.cloudInstanceID)
+	return nil
+}
+
+// AssignPrivateIP creates a network port of ip in the network of the node's
+// PVM instance and attaches it, waiting until it's active. A port left
+// detached for the instance, e.g. by an attachment which timed out, is
+// attached rather than created again.
+func (p *PowerVS) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	if !utilnet.IsIPv4(ip) {
+		return fmt.Errorf("Power VS doesn't support IPv6, can't assign IP address %s", ip)
+	}
+	pvmInstanceID, networkID, err := p.getInstanceNetwork(ctx, node)
+	if err != nil {
+		return err
+	}
+	port, err := p.lookupPort(ctx, networkID, ip)
+	if err != nil {
+		return err
+	}
+	created := false
+	switch {
+	case port == nil:
+		port = &powerVSPort{}
+		if err := p.client.do(ctx, http.MethodPost, fmt.Sprintf("/networks/%s/ports", networkID), nil, &powerVSPort{
+			IPAddress:   ip.String(),
+			Description: powerVSPortOwner + pvmInstanceID,
+		}, port); err != nil {
+			return fmt.Errorf("error creating network port of IP address %s in network %s, err: %v", ip, networkID, err)
+		}
+		created = true
+	case port.Description != powerVSPortOwner+pvmInstanceID:
+		return fmt.Errorf("IP address %s is held by network port %s of network %s already", ip, port.PortID, networkID)
+	case isPowerVSPortAttached(port, pvmInstanceID) && port.Status == powerVSPortActive:
+		return AlreadyExistingIPError
+	}
+	if !isPowerVSPortAttached(port, pvmInstanceID) {
+		if err := p.client.do(ctx, http.MethodPut, fmt.Sprintf("/networks/%s/ports/%s", networkID, port.PortID), nil, map[string]string{
+			"pvmInstanceID": pvmInstanceID,
+		}, nil); err != nil {
+			if created {
+				p.deletePort(ctx, networkID, port.PortID)
+			}
+			return fmt.Errorf("error attaching network port %s of IP address %s to PVM instance %s, err: %v", port.PortID, ip, pvmInstanceID, err)
+		}
+	}
+	return p.waitForPort(ctx, networkID, port.PortID, "attached", func(port *powerVSPort) bool {
+		return isPowerVSPortAttached(port, pvmInstanceID) && port.Status == powerVSPortActive
+	})
+}
+
+func (p *PowerVS) AllowsMovePrivateIP() bool {
+	return false
+}
+
+func (p *PowerVS) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+	return nil
+}
+
+// ReleasePrivateIP detaches the network port of ip from the node's PVM
+// instance, waits until it's detached, and deletes it.
+func (p *PowerVS) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	pvmInstanceID, networkID, err := p.getInstanceNetwork(ctx, node)
+	if err != nil {
+		return err
+	}
+	port, err := p.lookupPort(ctx, networkID, ip)
+	if err != nil {
+		return err
+	}
+	if port == nil || port.Description != powerVSPortOwner+pvmInstanceID {
+		return NonExistingIPError
+	}
+	return p.releasePort(ctx, pvmInstanceID, networkID, port)
+}
+
+func (p *PowerVS) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, p.AssignPrivateIP)
+}
+
+func (p *PowerVS) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, p.ReleasePrivateIP)
+}
+
+// releasePort detaches the network port from the PVM instance, if attached,
+// and deletes it.
+func (p *PowerVS) releasePort(ctx context.Context, pvmInstanceID, networkID string, port *powerVSPort) error {
+	if isPowerVSPortAttached(port, pvmInstanceID) {
+		if err := p.client.do(ctx, http.MethodDelete, fmt.Sprintf("/pvm-instances/%s/networks/%s", pvmInstanceID, networkID), nil, map[string]string{
+			"macAddress": port.MACAddress,
+		}, nil); err != nil {
+			return fmt.Errorf("error detaching network port %s from PVM instance %s, err: %v", port.PortID, pvmInstanceID, err)
+		}
+		if err := p.waitForPort(ctx, networkID, port.PortID, "detached", func(port *powerVSPort) bool {
+			return port.PVMInstance == nil || port.PVMInstance.PVMInstanceID == ""
+		}); err != nil {
+			return err
+		}
+	}
+	if err := p.client.do(ctx, http.MethodDelete, fmt.Sprintf("/networks/%s/ports/%s", networkID, port.PortID), nil, nil, nil); err != nil && !isRESTStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("error deleting network port %s, err: %v", port.PortID, err)
+	}
+	return nil
+}
+
+// deletePort deletes a network port which failed to be attached.
+func (p *PowerVS) deletePort(ctx context.Context, networkID, portID string) {
+	if err := p.client.do(ctx, http.MethodDelete, fmt.Sprintf("/networks/%s/ports/%s", networkID, portID), nil, nil, nil); err != nil {
+		klog.Warningf("Could not delete network port %s after failing to attach it, err: %v", portID, err)
+	}
+}
+
+// GetNodeEgressIPConfiguration returns the configuration of the network of
+// the node's PVM instance, keyed by ID. Power VS networks are IPv4 only.
+func (p *PowerVS) GetNodeEgressIPConfiguration(ctx context.Context, node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
+	pvmInstanceID, networkID, err := p.getInstanceNetwork(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	network := &powerVSNetwork{}
+	if err := p.client.do(ctx, http.MethodGet, "/networks/"+networkID, nil, nil, network); err != nil {
+		return nil, fmt.Errorf("error retrieving network %s, err: %v", networkID, err)
+	}
+	_, cidr, err := net.ParseCIDR(network.CIDR)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the CIDR %q of network %s, err: %v", network.CIDR, networkID, err)
+	}
+	ports, err := p.listPorts(ctx, networkID)
+	if err != nil {
+		return nil, err
+	}
+	limit := p.cfg.PowerVSIPsPerInstance
+	if limit <= 0 {
+		limit = powerVSDefaultIPsPerInstance
+	}
+	for _, port := range ports {
+		if port.Description == powerVSPortOwner+pvmInstanceID {
+			limit--
+		}
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	return []*NodeEgressIPConfiguration{
+		{
+			Interface: networkID,
+			IFAddr:    ifAddr{IPv4: cidr.String()},
+			Capacity:  capacity{IPv4: limit},
+		},
+	}, nil
+}
+
+// CleanupNode deletes the network ports of the node's PVM instance once the
+// instance is gone, it returns an InstanceExistsError until then. Network
+// ports outlive the instances they're attached to and would otherwise keep the
+// IP addresses from being assigned to any other node.
+func (p *PowerVS) CleanupNode(ctx context.Context, node *corev1.Node) error {
+	pvmInstanceID, err := getPowerVSInstanceID(node)
+	if err != nil {
+		return err
+	}
+	_, _, err = p.getInstanceNetwork(ctx, node)
+	if err == nil {
+		return fmt.Errorf("%w: PVM instance %s of node %s, not releasing its egress IPs yet", InstanceExistsError, pvmInstanceID, node.Name)
+	}
+	if !isRESTStatus(err, http.StatusNotFound) {
+		return err
+	}
+	networks := &struct {
+		Networks []powerVSNetwork `json:"networks"`
+	}{}
+	if err := p.client.do(ctx, http.MethodGet, "/networks", nil, nil, networks); err != nil {
+		return fmt.Errorf("error listing networks, err: %v", err)
+	}
+	var errs []error
+	for _, network := range networks.Networks {
+		ports, err := p.listPorts(ctx, network.NetworkID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, port := range ports {
+			if port.Description != powerVSPortOwner+pvmInstanceID {
+				continue
+			}
+			// Ports are detached together with the instance.
+			if err := p.client.do(ctx, http.MethodDelete, fmt.Sprintf("/networks/%s/ports/%s", network.NetworkID, port.PortID), nil, nil, nil); err != nil && !isRESTStatus(err, http.StatusNotFound) {
+				errs = append(errs, fmt.Errorf("could not delete network port %s, err: %v", port.PortID, err))
+				continue
+			}
+			klog.Infof("Released network port %s of deleted node %s", port.PortID, node.Name)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// VerifyPrivateIP verifies that the network port of ip is still attached to
+// the node's PVM instance and active, wrapping a MissingIPError if it was
+// detached or deleted.
+func (p *PowerVS) VerifyPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	pvmInstanceID, networkID, err := p.getInstanceNetwork(ctx, node)
+	if err != nil {
+		return err
+	}
+	port, err := p.lookupPort(ctx, networkID, ip)
+	if err != nil {
+		return err
+	}
+	if port == nil || !isPowerVSPortAttached(port, pvmInstanceID) {
+		return fmt.Errorf("%w: no network port of IP address %s is attached to PVM instance %s", MissingIPError, ip, pvmInstanceID)
+	}
+	if port.Status != powerVSPortActive {
+		return fmt.Errorf("network port %s of IP address %s is %s rather than %s", port.PortID, ip, port.Status, powerVSPortActive)
+	}
+	return nil
+}
+
+// GetPrivateIPReservations returns the network port of ip.
+func (p *PowerVS) GetPrivateIPReservations(ctx context.Context, ip net.IP, node *corev1.Node) ([]PrivateIPReservation, error) {
+	pvmInstanceID, networkID, err := p.getInstanceNetwork(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	port, err := p.lookupPort(ctx, networkID, ip)
+	if err != nil {
+		return nil, err
+	}
+	if port == nil || port.Description != powerVSPortOwner+pvmInstanceID {
+		return nil, nil
+	}
+	return []PrivateIPReservation{{ID: port.PortID, Subnet: networkID}}, nil
+}
+
+// GetNodeNetworkInterfaces returns nil, the networks of PVM instances aren't
+// tracked.
+func (p *PowerVS) GetNodeNetworkInterfaces(ctx context.Context, node *corev1.Node) ([]string, error) {
+	return nil, nil
+}
+
+// ListPrivateIPs returns nil, network ports are only looked up per IP
+// address.
+func (p *PowerVS) ListPrivateIPs(ctx context.Context, node *corev1.Node) ([]net.IP, error) {
+	return nil, nil
+}
+
+// CheckHealth lists the networks of the node's PVM instance.
+func (p *PowerVS) CheckHealth(ctx context.Context, node *corev1.Node) error {
+	_, _, err := p.getInstanceNetwork(ctx, node)
+	return err
+}
+
+// getInstanceNetwork returns the ID of the node's PVM instance and of its
+// first network, the one egress IPs are created in.
+func (p *PowerVS) getInstanceNetwork(ctx context.Context, node *corev1.Node) (string, string, error) {
+	pvmInstanceID, err := getPowerVSInstanceID(node)
+	if err != nil {
+		return "", "", err
+	}
+	networks := &struct {
+		Networks []struct {
+			NetworkID string `json:"networkID"`
+		} `json:"networks"`
+	}{}
+	if err := p.client.do(ctx, http.MethodGet, fmt.Sprintf("/pvm-instances/%s/networks", pvmInstanceID), nil, nil, networks); err != nil {
+		return "", "", fmt.Errorf("error retrieving the networks of PVM instance %s of node %s: %w", pvmInstanceID, node.Name, err)
+	}
+	if len(networks.Networks) == 0 {
+		return "", "", fmt.Errorf("%w: PVM instance %s of node %s has no network", NoNetworkInterfaceError, pvmInstanceID, node.Name)
+	}
+	return pvmInstanceID, networks.Networks[0].NetworkID, nil
+}
+
+func (p *PowerVS) listPorts(ctx context.Context, networkID string) ([]powerVSPort, error) {
+	ports := &struct {
+		Ports []powerVSPort `json:"ports"`
+	}{}
+	if err := p.client.do(ctx, http.MethodGet, fmt.Sprintf("/networks/%s/ports", networkID), nil, nil, ports); err != nil {
+		return nil, fmt.Errorf("error listing the network ports of network %s, err: %v", networkID, err)
+	}
+	return ports.Ports, nil
+}
+
+// lookupPort returns the network port of ip in the network, nil if there's
+// none.
+func (p *PowerVS) lookupPort(ctx context.Context, networkID string, ip net.IP) (*powerVSPort, error) {
+	ports, err := p.listPorts(ctx, networkID)
+	if err != nil {
+		return nil, err
+	}
+	for _, port := range ports {
+		if ParseIP(port.IPAddress).Equal(ip) {
+			return &port, nil
+		}
+	}
+	return nil, nil
+}
+
+// waitForPort polls the network port every pollInterval at first, the
+// interval doubling after every poll up to pollMaxInterval, until done or
+// PowerVSOperationTimeout elapsed, see pollUntilDone: the port is attached or
+// detached on its own, the next assignment or release finds it so.
+func (p *PowerVS) waitForPort(ctx context.Context, networkID, portID, state string, done func(port *powerVSPort) bool) error {
+	timeout := p.cfg.PowerVSOperationTimeout
+	if timeout <= 0 {
+		timeout = defaultPowerVSOperationTimeout
+	}
+	return p.pollUntilDone(ctx, fmt.Sprintf("network port %s to be %s", portID, state), p.pollInterval, p.pollMaxInterval, timeout, func(ctx context.Context) (bool, error) {
+		port := &powerVSPort{}
+		if err := p.client.do(ctx, http.MethodGet, fmt.Sprintf("/networks/%s/ports/%s", networkID, portID), nil, nil, port); err != nil {
+			return false, fmt.Errorf("error retrieving network port %s, err: %v", portID, err)
+		}
+		return done(port), nil
+	})
+}
+
+// isPowerVSPortAttached returns true if the network port is attached to the
+// PVM instance.
+func isPowerVSPortAttached(port *powerVSPort, pvmInstanceID string) bool {
+	return port.PVMInstance != nil && port.PVMInstance.PVMInstanceID == pvmInstanceID
+}
+
+// getPowerVSCloudInstanceID returns the ID of the Power VS workspace of the
+// CRN, which looks like
+// crn:v1:bluemix:public:power-iaas:<zone>:a/<account ID>:<workspace ID>::
+func getPowerVSCloudInstanceID(crn string) (string, error) {
+	parts := strings.Split(crn, ":")
+	if len(parts) != 10 || parts[0] != "crn" || parts[4] != "power-iaas" || parts[7] == "" {
+		return "", fmt.Errorf("invalid Power VS workspace CRN %q, expected crn:v1:bluemix:public:power-iaas:<zone>:a/<account ID>:<workspace ID>::", crn)
+	}
+	return parts[7], nil
+}
+
+// getPowerVSInstanceID returns the ID of the node's PVM instance, the last
+// component of its providerID, which looks like
+// ibmpowervs://<region>/<zone>/<workspace ID>/<PVM instance ID> on Power VS.
+func getPowerVSInstanceID(node *corev1.Node) (string, error) {
+	if !strings.HasPrefix(node.Spec.ProviderID, "ibmpowervs://") {
+		return "", fmt.Errorf("failed to parse node %s provider id %q, expected ibmpowervs://<region>/<zone>/<workspace ID>/<PVM instance ID>", node.Name, node.Spec.ProviderID)
+	}
+	pvmInstanceID := node.Spec.ProviderID[strings.LastIndex(node.Spec.ProviderID, "/")+1:]
+	if pvmInstanceID == "" {
+		return "", fmt.Errorf("failed to parse node %s provider id %q: no PVM instance ID", node.Name, node.Spec.ProviderID)
+	}
+	return pvmInstanceID, nil
+}
@@ -0,0 +1,286 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const powerVSTestCRN = "crn:v1:bluemix:public:power-iaas:dal12:a/account:workspace::"
+
+// fakePowerVS serves the IAM and Power VS API requests of PVM instance pvm-0
+// in network net-0, 192.168.0.0/24. Network ports are attached and detached
+// asynchronously: they're BUILD for the first polls after the request.
+type fakePowerVS struct {
+	mu    sync.Mutex
+	ports map[string]*powerVSPort
+	// pending is the number of polls of a port until its attachment or
+	// detachment is done.
+	pending map[string]int
+	// detaching are the ports being detached rather than attached.
+	detaching map[string]bool
+	// polls is the number of polls a change takes.
+	polls int
+	// deleted is set once the PVM instance was deleted.
+	deleted bool
+}
+
+func newFakePowerVS(polls int) *fakePowerVS {
+	return &fakePowerVS{
+		ports: map[string]*powerVSPort{
+			"primary": {PortID: "primary", IPAddress: "192.168.0.10", MACAddress: "fa:00:00:00:00:10", Status: powerVSPortActive, PVMInstance: &struct {
+				PVMInstanceID string `json:"pvmInstanceID"`
+			}{PVMInstanceID: "pvm-0"}},
+		},
+		pending:   map[string]int{},
+		detaching: map[string]bool{},
+		polls:     polls,
+	}
+}
+
+func (f *fakePowerVS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path == "/identity/token" {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "expires_in": 3600})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer token" || r.Header.Get("CRN") != powerVSTestCRN {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/pcloud/v1/cloud-instances/workspace")
+	switch {
+	case r.Method == http.MethodGet && path == "/pvm-instances/pvm-0/networks":
+		if f.deleted {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"networks": [{"networkID": "net-0", "ipAddress": "192.168.0.10"}]}`))
+	case r.Method == http.MethodDelete && path == "/pvm-instances/pvm-0/networks/net-0":
+		request := map[string]string{}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		for _, port := range f.ports {
+			if port.MACAddress == request["macAddress"] && port.PVMInstance != nil {
+				port.Status = "BUILD"
+				f.pending[port.PortID] = f.polls
+				f.detaching[port.PortID] = true
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodGet && path == "/networks":
+		_, _ = w.Write([]byte(`{"networks": [{"networkID": "net-0"}, {"networkID": "net-1"}]}`))
+	case r.Method == http.MethodGet && path == "/networks/net-0":
+		_ = json.NewEncoder(w).Encode(&powerVSNetwork{NetworkID: "net-0", CIDR: "192.168.0.0/24"})
+	case r.Method == http.MethodGet && path == "/networks/net-1/ports":
+		_, _ = w.Write([]byte(`{"ports": []}`))
+	case r.Method == http.MethodGet && path == "/networks/net-0/ports":
+		ports := struct {
+			Ports []powerVSPort `json:"ports"`
+		}{}
+		for _, port := range f.ports {
+			ports.Ports = append(ports.Ports, *port)
+		}
+		_ = json.NewEncoder(w).Encode(ports)
+	case r.Method == http.MethodPost && path == "/networks/net-0/ports":
+		port := &powerVSPort{}
+		_ = json.NewDecoder(r.Body).Decode(port)
+		port.PortID = "port-" + port.IPAddress
+		port.MACAddress = "fa:00:00:00:00:" + port.IPAddress[strings.LastIndex(port.IPAddress, ".")+1:]
+		port.Status = "DOWN"
+		f.ports[port.PortID] = port
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(port)
+	case strings.HasPrefix(path, "/networks/net-0/ports/"):
+		port, ok := f.ports[strings.TrimPrefix(path, "/networks/net-0/ports/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if pending, ok := f.pending[port.PortID]; ok {
+				if pending > 0 {
+					f.pending[port.PortID]--
+				} else {
+					delete(f.pending, port.PortID)
+					if f.detaching[port.PortID] {
+						delete(f.detaching, port.PortID)
+						port.PVMInstance = nil
+						port.Status = "DOWN"
+					} else {
+						port.Status = powerVSPortActive
+					}
+				}
+			}
+			_ = json.NewEncoder(w).Encode(port)
+		case http.MethodPut:
+			request := map[string]string{}
+			_ = json.NewDecoder(r.Body).Decode(&request)
+			port.PVMInstance = &struct {
+				PVMInstanceID string `json:"pvmInstanceID"`
+			}{PVMInstanceID: request["pvmInstanceID"]}
+			port.Status = "BUILD"
+			f.pending[port.PortID] = f.polls
+		case http.MethodDelete:
+			if port.PVMInstance != nil {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			delete(f.ports, port.PortID)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakePowerVSProvider(server *httptest.Server, cfg CloudProviderConfig) *PowerVS {
+	iam := newIBMCloudIAM(server.Client(), server.URL, "api-key")
+	return &PowerVS{
+		CloudProvider:   CloudProvider{ctx: context.Background(), cfg: cfg},
+		cloudInstanceID: "workspace",
+		client: &restClient{
+			httpClient: server.Client(),
+			baseURL:    server.URL + "/pcloud/v1/cloud-instances/workspace",
+			authorize: func(r *http.Request) error {
+				r.Header.Set("CRN", powerVSTestCRN)
+				return iam.authorize(r)
+			},
+		},
+		pollInterval:    time.Millisecond,
+		pollMaxInterval: time.Millisecond,
+	}
+}
+
+func newPowerVSNode() *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0"},
+		Spec:       corev1.NodeSpec{ProviderID: "ibmpowervs://us-south/dal12/workspace/pvm-0"},
+	}
+}
+
+// newPowerVSFakeCloud plugs the fake API into the tests shared by the clouds,
+// network ports taking a couple of polls to be attached and detached.
+func newPowerVSFakeCloud(t *testing.T) *fakeCloud {
+	fake := newFakePowerVS(2)
+	server := httptest.NewServer(fake)
+	return &fakeCloud{
+		CloudProviderIntf: newFakePowerVSProvider(server, CloudProviderConfig{}),
+		assigned: func() []string {
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			ips := []string{}
+			for id, port := range fake.ports {
+				if id != "primary" {
+					ips = append(ips, port.IPAddress)
+				}
+			}
+			return ips
+		},
+		close: server.Close,
+	}
+}
+
+func TestPowerVSAssignPrivateIP(t *testing.T) {
+	tcs := []struct {
+		ip    string
+		polls int
+		// detached is the description of a detached port of ip in the
+		// network.
+		detached  string
+		timeout   time.Duration
+		expectErr bool
+		// expectedPorts is the number of ports of the network afterwards, the
+		// primary one included.
+		expectedPorts int
+	}{
+		{ip: "192.168.0.20", polls: 3, expectedPorts: 2},
+		// Ports left detached for the instance are attached again.
+		{ip: "192.168.0.20", detached: powerVSPortOwner + "pvm-0", expectedPorts: 2},
+		{ip: "192.168.0.20", detached: "database", expectErr: true, expectedPorts: 2},
+		{ip: "fd00::20", expectErr: true, expectedPorts: 1},
+		// Ports which don't get attached in time are kept for the next attempt.
+		{ip: "192.168.0.20", polls: 1000, timeout: 50 * time.Millisecond, expectErr: true, expectedPorts: 2},
+	}
+	for i, tc := range tcs {
+		fake := newFakePowerVS(tc.polls)
+		if tc.detached != "" {
+			fake.ports["detached"] = &powerVSPort{PortID: "detached", IPAddress: tc.ip, MACAddress: "fa:00:00:00:00:20", Status: "DOWN", Description: tc.detached}
+		}
+		server := httptest.NewServer(fake)
+		provider := newFakePowerVSProvider(server, CloudProviderConfig{PowerVSOperationTimeout: tc.timeout})
+		err := provider.AssignPrivateIP(context.Background(), net.ParseIP(tc.ip), newPowerVSNode())
+		server.Close()
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestPowerVSAssignPrivateIP(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		if len(fake.ports) != tc.expectedPorts {
+			t.Fatalf("TestPowerVSAssignPrivateIP(%d): expected %d ports, got %d", i, tc.expectedPorts, len(fake.ports))
+		}
+		if err == nil {
+			for _, port := range fake.ports {
+				if port.IPAddress == tc.ip && (port.Status != powerVSPortActive || !isPowerVSPortAttached(port, "pvm-0")) {
+					t.Fatalf("TestPowerVSAssignPrivateIP(%d): expected the port of %s to be attached and active, got %+v", i, tc.ip, port)
+				}
+			}
+		}
+	}
+}
+
+func TestPowerVSCleanupNode(t *testing.T) {
+	fake := newFakePowerVS(0)
+	fake.ports["egress"] = &powerVSPort{PortID: "egress", IPAddress: "192.168.0.20", Status: "DOWN", Description: powerVSPortOwner + "pvm-0"}
+	fake.ports["other"] = &powerVSPort{PortID: "other", IPAddress: "192.168.0.21", Status: "DOWN", Description: powerVSPortOwner + "pvm-1"}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	provider := newFakePowerVSProvider(server, CloudProviderConfig{})
+
+	// Nothing is released while the instance exists.
+	if err := provider.CleanupNode(context.Background(), newPowerVSNode()); !errors.Is(err, InstanceExistsError) {
+		t.Fatalf("expected an InstanceExistsError cleaning up node, got: %v", err)
+	}
+	if len(fake.ports) != 3 {
+		t.Fatalf("expected no port to be deleted while the instance exists, got %v", fake.ports)
+	}
+	fake.deleted = true
+	delete(fake.ports, "primary")
+	if err := provider.CleanupNode(context.Background(), newPowerVSNode()); err != nil {
+		t.Fatalf("received unexpected error cleaning up node, err: %v", err)
+	}
+	if _, ok := fake.ports["egress"]; ok || len(fake.ports) != 1 {
+		t.Fatalf("expected only the port of the deleted instance to be deleted, got %v", fake.ports)
+	}
+}
+
+func TestGetPowerVSCloudInstanceID(t *testing.T) {
+	tcs := []struct {
+		crn       string
+		expected  string
+		expectErr bool
+	}{
+		{crn: powerVSTestCRN, expected: "workspace"},
+		{crn: "crn:v1:bluemix:public:is:us-south:a/account::vpc:r006-vpc", expectErr: true},
+		{crn: "crn:v1:bluemix:public:power-iaas:dal12:a/account:::", expectErr: true},
+		{crn: "", expectErr: true},
+	}
+	for i, tc := range tcs {
+		id, err := getPowerVSCloudInstanceID(tc.crn)
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestGetPowerVSCloudInstanceID(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		if id != tc.expected {
+			t.Fatalf("TestGetPowerVSCloudInstanceID(%d): expected ID %q, got %q", i, tc.expected, id)
+		}
+	}
+}
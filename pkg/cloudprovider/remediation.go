@@ -0,0 +1,122 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// remediation maps cloud API errors, recognized by any of the markers their
+// message contains, to the next steps resolving them.
+type remediation struct {
+	markers []string
+	hint    string
+	// class labels the errors in metrics, see ErrorClass.
+	class string
+	// needsIntervention is set for the errors which retrying won't resolve
+	// until someone acts on the hint.
+	needsIntervention bool
+}
+
+// remediations are matched in order, the first match wins. The markers are the
+// error codes of the cloud APIs, which all providers include in their errors.
+var remediations = []remediation{
+	{
+		// OpenStack: the Neutron port was changed by another client between
+		// our read and our update, even after the update was retried.
+		markers: []string{"RevisionNumberConstraintFailed"},
+		hint:    "another client keeps updating the allowed address pairs of the node's port concurrently, check for other components managing them",
+		class:   "conflict",
+	},
+	{
+		markers:           []string{"OverQuota", "QuotaExceeded", "quotaExceeded", "QUOTA_EXCEEDED"},
+		hint:              "a cloud quota is exhausted, raise the quota of the project/account or release unused IP addresses/ports",
+		class:             "quota",
+		needsIntervention: true,
+	},
+	{
+		markers: []string{"InsufficientFreeAddressesInSubnet", "IpAddressGenerationFailure", "SubnetIsFull", "IP_SPACE_EXHAUSTED"},
+		hint:    "the node's subnet has no free IP address left, release unused IP addresses or enlarge the subnet",
+		class:   "subnet_full",
+	},
+	{
+		// AWS: the network interface holds as many private IP addresses as
+		// its instance type allows.
+		markers: []string{"PrivateIpAddressLimitExceeded"},
+		hint:    "the node's instance type allows no more private IP addresses, assign the egress IP to another node or use a larger instance type",
+		class:   "ip_limit",
+	},
+	{
+		markers:           []string{"UnauthorizedOperation", "AccessDenied", "AuthorizationFailed", "PolicyNotAuthorized", "Request forbidden", "Error 403", "StatusCode=403"},
+		hint:              "the cloud credentials lack a permission, check the policy granted to the credentials in the CNCC's secret",
+		class:             "permission",
+		needsIntervention: true,
+	},
+}
+
+// RemediationHint returns the human readable next steps resolving err, or an
+// empty string if err is not a cloud error with a known remediation.
+func RemediationHint(err error) string {
+	if r := findRemediation(err); r != nil {
+		return r.hint
+	}
+	return ""
+}
+
+// NeedsIntervention returns true if err is a cloud error which retrying won't
+// resolve until someone acts, i.e: an exhausted quota or a missing
+// permission.
+func NeedsIntervention(err error) bool {
+	r := findRemediation(err)
+	return r != nil && r.needsIntervention
+}
+
+// ErrorClass returns the class of err labeling it in metrics: one of the
+// sentinel errors of the cloud providers, a cloud error with a known
+// remediation, a timeout, or "unknown". It's "success" if err is nil.
+func ErrorClass(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, AlreadyExistingIPError):
+		return "already_assigned"
+	case errors.Is(err, NonExistingIPError):
+		return "not_assigned"
+	case errors.Is(err, ZoneMismatchError):
+		return "zone_mismatch"
+	case errors.Is(err, NoNetworkInterfaceError):
+		return "no_network_interface"
+	case errors.Is(err, ReadOnlyError):
+		return "read_only"
+	}
+	if r := findRemediation(err); r != nil {
+		return r.class
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	return "unknown"
+}
+
+func findRemediation(err error) *remediation {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	for i := range remediations {
+		for _, marker := range remediations[i].markers {
+			if strings.Contains(msg, marker) {
+				return &remediations[i]
+			}
+		}
+	}
+	return nil
+}
+
+// WithRemediationHint appends the remediation hint of err, if any, to msg.
+func WithRemediationHint(msg string, err error) string {
+	if hint := RemediationHint(err); hint != "" {
+		return msg + ". Hint: " + hint
+	}
+	return msg
+}
@@ -0,0 +1,82 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRemediationHint(t *testing.T) {
+	tcs := []struct {
+		err  error
+		hint string
+	}{
+		{err: nil},
+		{err: errors.New("connection refused")},
+		{err: AlreadyExistingIPError},
+		{err: fmt.Errorf("error updating port, err: Conflict: RevisionNumberConstraintFailed"), hint: "concurrently"},
+		{err: errors.New(`Expected HTTP response code [201] when accessing [POST ports], but got 409 instead {"NeutronError": {"type": "OverQuota"}}`), hint: "quota"},
+		{err: errors.New("googleapi: Error 403: Quota 'IN_USE_ADDRESSES' exceeded, quotaExceeded"), hint: "quota"},
+		{err: errors.New("googleapi: Error 403: Required 'compute.instances.updateNetworkInterface' permission, forbidden"), hint: "credentials"},
+		{err: errors.New("InsufficientFreeAddressesInSubnet: insufficient free addresses in subnet"), hint: "subnet"},
+		{err: errors.New("PrivateIpAddressLimitExceeded: Number of private addresses will exceed limit"), hint: "instance type"},
+		{err: errors.New("UnauthorizedOperation: You are not authorized to perform this operation"), hint: "credentials"},
+		{err: errors.New("Code=\"AuthorizationFailed\" Message=\"The client does not have authorization\""), hint: "credentials"},
+	}
+
+	for i, tc := range tcs {
+		hint := RemediationHint(tc.err)
+		if (tc.hint == "") != (hint == "") || !strings.Contains(hint, tc.hint) {
+			t.Fatalf("TestRemediationHint(%d): expected a hint containing %q, got: %q", i, tc.hint, hint)
+		}
+		msg := WithRemediationHint("error", tc.err)
+		if (tc.hint == "") != (msg == "error") {
+			t.Fatalf("TestRemediationHint(%d): unexpected message %q", i, msg)
+		}
+	}
+}
+
+func TestNeedsIntervention(t *testing.T) {
+	tcs := []struct {
+		err               error
+		needsIntervention bool
+	}{
+		{err: nil},
+		{err: errors.New("connection refused")},
+		{err: fmt.Errorf("error updating port, err: Conflict: RevisionNumberConstraintFailed")},
+		{err: errors.New("InsufficientFreeAddressesInSubnet: insufficient free addresses in subnet")},
+		{err: errors.New("googleapi: Error 403: Quota 'IN_USE_ADDRESSES' exceeded, quotaExceeded"), needsIntervention: true},
+		{err: fmt.Errorf("error assigning CloudPrivateIPConfig, err: %w", errors.New("UnauthorizedOperation: You are not authorized to perform this operation")), needsIntervention: true},
+	}
+
+	for i, tc := range tcs {
+		if needsIntervention := NeedsIntervention(tc.err); needsIntervention != tc.needsIntervention {
+			t.Fatalf("TestNeedsIntervention(%d): expected %t, got %t", i, tc.needsIntervention, needsIntervention)
+		}
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tcs := []struct {
+		err   error
+		class string
+	}{
+		{err: nil, class: "success"},
+		{err: errors.New("connection refused"), class: "unknown"},
+		{err: fmt.Errorf("error assigning IP address, err: %w", AlreadyExistingIPError), class: "already_assigned"},
+		{err: NonExistingIPError, class: "not_assigned"},
+		{err: fmt.Errorf("%w: would assign IP address", ReadOnlyError), class: "read_only"},
+		{err: errors.New("googleapi: Error 403: Quota 'IN_USE_ADDRESSES' exceeded, quotaExceeded"), class: "quota"},
+		{err: errors.New("UnauthorizedOperation: You are not authorized to perform this operation"), class: "permission"},
+		{err: errors.New("PrivateIpAddressLimitExceeded: Number of private addresses will exceed limit"), class: "ip_limit"},
+		{err: fmt.Errorf("error waiting for the operation, err: %w", context.DeadlineExceeded), class: "timeout"},
+	}
+
+	for i, tc := range tcs {
+		if class := ErrorClass(tc.err); class != tc.class {
+			t.Fatalf("TestErrorClass(%d): expected %q, got %q", i, tc.class, class)
+		}
+	}
+}
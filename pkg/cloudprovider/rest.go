@@ -0,0 +1,126 @@
+package cloudprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// restRequestTimeout bounds every request of a restClient, so that a hung
+// endpoint doesn't block a worker, and with that controller shutdown, forever.
+const restRequestTimeout = time.Minute
+
+// restClient sends the JSON requests of the cloud APIs this repository has no
+// Go SDK vendored for. Every provider brings its own authentication.
+type restClient struct {
+	httpClient *http.Client
+	// baseURL prefixes the paths of the requests, e.g.
+	// https://us-south.iaas.cloud.ibm.com/v1.
+	baseURL string
+	// query is added to the query of every request, e.g. an API version.
+	query url.Values
+	// authorize sets the credentials of the request, e.g. its Authorization
+	// header. Requests are sent without credentials if nil.
+	authorize func(r *http.Request) error
+}
+
+// restError is the error of a request answered with a status code other than
+// 2xx. StatusCode=<code> is part of the message, for the remediation hints of
+// authorization failures to match.
+type restError struct {
+	method     string
+	url        string
+	statusCode int
+	body       string
+}
+
+func (e *restError) Error() string {
+	return fmt.Sprintf("%s %s: StatusCode=%d %s", e.method, e.url, e.statusCode, strings.TrimSpace(e.body))
+}
+
+// isRESTStatus returns true if err is the error of a request answered with
+// the status code.
+func isRESTStatus(err error, statusCode int) bool {
+	var restErr *restError
+	return errors.As(err, &restErr) && restErr.statusCode == statusCode
+}
+
+// do sends a request of method to path, relative to baseURL unless it's an
+// absolute URL, e.g. the link to the next page of a list, with query and the
+// JSON of in as body, if not nil. The JSON of the response is decoded into out,
+// if not nil.
+func (c *restClient) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, restRequestTimeout)
+	defer cancel()
+
+	u, err := url.Parse(path)
+	if err != nil {
+		return err
+	}
+	if !u.IsAbs() {
+		if u, err = url.Parse(strings.TrimSuffix(c.baseURL, "/") + "/" + strings.TrimPrefix(path, "/")); err != nil {
+			return err
+		}
+	}
+	values := u.Query()
+	for key, value := range c.query {
+		if _, ok := values[key]; !ok {
+			values[key] = value
+		}
+	}
+	for key, value := range query {
+		values[key] = value
+	}
+	u.RawQuery = values.Encode()
+
+	var body []byte
+	if in != nil {
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	r, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Accept", "application/json")
+	r.Header.Set("User-Agent", UserAgent)
+	if in != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if c.authorize != nil {
+		if err := c.authorize(r); err != nil {
+			return err
+		}
+	}
+	httpClient := c.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &restError{method: method, url: u.Path, statusCode: resp.StatusCode, body: string(respBody)}
+	}
+	if out == nil || len(bytes.TrimSpace(respBody)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("error decoding the response of %s %s, err: %v", method, u.Path, err)
+	}
+	return nil
+}
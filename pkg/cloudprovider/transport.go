@@ -0,0 +1,59 @@
+package cloudprovider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/openshift/cloud-network-config-controller/pkg/tracing"
+	"k8s.io/klog/v2"
+)
+
+// newHTTPClient returns an HTTP client going through the cluster-wide proxy,
+// which is set in the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment
+// variables of the CNCC, and trusting the custom CA bundle ca-bundle.pem of
+// configDir, mounted from the ConfigMap kube-cloud-config, if any, on top of
+// the system's CAs: disconnected clusters reach the cloud API through a proxy,
+// which may intercept TLS with a certificate of its own. Its requests are
+// traced.
+func newHTTPClient(configDir string) (*http.Client, error) {
+	transport, err := newHTTPTransport(configDir)
+	if err != nil {
+		return nil, err
+	}
+	return newTracedHTTPClient(transport), nil
+}
+
+// newHTTPTransport returns the transport of newHTTPClient, for the clouds
+// configuring it further.
+func newHTTPTransport(configDir string) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	caBundle := filepath.Join(configDir, "ca-bundle.pem")
+	userCACert, err := ioutil.ReadFile(caBundle)
+	if err == nil && len(userCACert) != 0 {
+		klog.Infof("Custom CA bundle found at location '%s' - reading certificate information", caBundle)
+		certPool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize x509 SystemCertPool, err: %q", err)
+		}
+		if !certPool.AppendCertsFromPEM(userCACert) {
+			return nil, fmt.Errorf("could not parse file '%s', no PEM certificate found", caBundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: certPool}
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not parse file '%s', err: %q", caBundle, err)
+	}
+	return transport, nil
+}
+
+// newTracedHTTPClient returns an HTTP client sending its requests with
+// transport and tracing those sent on behalf of a traced call, as children of
+// its span.
+func newTracedHTTPClient(transport http.RoundTripper) *http.Client {
+	return &http.Client{Transport: tracing.NewTransport(transport)}
+}
@@ -0,0 +1,325 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+const (
+	// PlatformTypeVSphere is the string representation for the vSphere
+	// platform type. Egress IPs are only supported on vSphere clusters whose
+	// networking is backed by NSX-T.
+	PlatformTypeVSphere = "VSphere"
+
+	// nsxtEgressIPScope is the scope of the tags of the segment ports the
+	// controller added address bindings to, one per egress IP, the tag being
+	// the IP address. Address bindings can't be tagged themselves.
+	nsxtEgressIPScope = "cloud.network.openshift.io/egress-ip"
+	// nsxtMaxTags is the maximum number of tags of an NSX-T object.
+	nsxtMaxTags = 30
+)
+
+// VSphere implements the API wrapper for talking to the NSX-T Policy API of
+// a vSphere cluster. Egress IPs are address bindings of the segment port of
+// the VM's first network adapter, which SpoofGuard lets the VM send from: the
+// NSX-T equivalent of the allowed_address_pairs of OpenStack.
+type VSphere struct {
+	CloudProvider
+	noOwnedResources
+	client *restClient
+	ports  nsxtPortCache
+	// portLocks serializes the changes of the address bindings of the segment
+	// port of each VM, keyed by providerID: they're replaced as a whole.
+	portLocks keyedMutex
+}
+
+type nsxtTag struct {
+	Scope string `json:"scope"`
+	Tag   string `json:"tag"`
+}
+
+type nsxtAddressBinding struct {
+	IPAddress  string `json:"ip_address"`
+	MACAddress string `json:"mac_address,omitempty"`
+}
+
+type nsxtSegmentPort struct {
+	ID              string               `json:"id"`
+	Path            string               `json:"path"`
+	AddressBindings []nsxtAddressBinding `json:"address_bindings"`
+	Tags            []nsxtTag            `json:"tags"`
+}
+
+type nsxtSegment struct {
+	ID      string `json:"id"`
+	Subnets []struct {
+		Network        string `json:"network"`
+		GatewayAddress string `json:"gateway_address"`
+	} `json:"subnets"`
+}
+
+func (v *VSphere) initCredentials() error {
+	username, err := v.readSecretData("nsxt_username")
+	if err != nil {
+		return err
+	}
+	password, err := v.readSecretData("nsxt_password")
+	if err != nil {
+		return err
+	}
+	if v.cfg.VSphereNSXTManagerURL == "" {
+		return fmt.Errorf("the NSX-T manager URL is needed on vSphere, egress IPs are only supported with NSX-T")
+	}
+	httpClient, err := newHTTPClient(v.cfg.ConfigDir)
+	if err != nil {
+		return err
+	}
+	username, password = strings.TrimSpace(username), strings.TrimSpace(password)
+	v.client = &restClient{
+		httpClient: httpClient,
+		baseURL:    v.cfg.VSphereNSXTManagerURL,
+		authorize: func(r *http.Request) error {
+			r.SetBasicAuth(username, password)
+			return nil
+		},
+	}
+	klog.Infof("Using the NSX-T manager at %s", v.cfg.VSphereNSXTManagerURL)
+	return nil
+}
+
+// AssignPrivateIP adds an address binding of ip, and its tag, to the segment
+// port of the node's VM.
+func (v *VSphere) AssignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	return v.updatePort(ctx, node, func(ref nsxtPortRef, port *nsxtSegmentPort) error {
+		if binding := getNSXTAddressBinding(port, ip); binding >= 0 {
+			if getNSXTEgressIPTag(port, ip) >= 0 {
+				return AlreadyExistingIPError
+			}
+			return fmt.Errorf("IP address %s is bound to segment port %s already, but not as an egress IP", ip, port.ID)
+		}
+		if getNSXTEgressIPTag(port, ip) < 0 {
+			if len(port.Tags) >= nsxtMaxTags {
+				return fmt.Errorf("segment port %s has %d tags already, the maximum, no egress IP can be added", port.ID, len(port.Tags))
+			}
+			port.Tags = append(port.Tags, nsxtTag{Scope: nsxtEgressIPScope, Tag: ip.String()})
+		}
+		port.AddressBindings = append(port.AddressBindings, nsxtAddressBinding{IPAddress: ip.String(), MACAddress: ref.mac})
+		return nil
+	})
+}
+
+func (v *VSphere) AllowsMovePrivateIP() bool {
+	return false
+}
+
+func (v *VSphere) MovePrivateIP(ctx context.Context, ip net.IP, nodeToAdd, nodeToDel *corev1.Node) error {
+	return nil
+}
+
+// ReleasePrivateIP removes the address binding of ip, and its tag, from the
+// segment port of the node's VM. Address bindings of the segment port not
+// tagged as egress IPs are never removed.
+func (v *VSphere) ReleasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	return v.updatePort(ctx, node, func(ref nsxtPortRef, port *nsxtSegmentPort) error {
+		tag := getNSXTEgressIPTag(port, ip)
+		if tag < 0 {
+			return NonExistingIPError
+		}
+		port.Tags = append(port.Tags[:tag], port.Tags[tag+1:]...)
+		if binding := getNSXTAddressBinding(port, ip); binding >= 0 {
+			port.AddressBindings = append(port.AddressBindings[:binding], port.AddressBindings[binding+1:]...)
+		}
+		return nil
+	})
+}
+
+func (v *VSphere) AssignPrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, v.AssignPrivateIP)
+}
+
+func (v *VSphere) ReleasePrivateIPs(ctx context.Context, ips []net.IP, node *corev1.Node) []error {
+	return eachPrivateIP(ctx, ips, node, v.ReleasePrivateIP)
+}
+
+// updatePort retrieves the segment port of the node's VM, lets update change
+// its address bindings and tags, and patches them. Nothing is patched if
+// update fails.
+func (v *VSphere) updatePort(ctx context.Context, node *corev1.Node, update func(ref nsxtPortRef, port *nsxtSegmentPort) error) error {
+	defer v.portLocks.Lock(node.Spec.ProviderID)()
+	port, ref, err := v.getPort(ctx, node)
+	if err != nil {
+		return err
+	}
+	if err := update(ref, port); err != nil {
+		return err
+	}
+	// Both lists are replaced as a whole: they must be sent even if empty.
+	if port.AddressBindings == nil {
+		port.AddressBindings = []nsxtAddressBinding{}
+	}
+	if port.Tags == nil {
+		port.Tags = []nsxtTag{}
+	}
+	if err := v.client.do(ctx, http.MethodPatch, "/policy/api/v1"+ref.portPath, nil, map[string]interface{}{
+		"resource_type":    "SegmentPort",
+		"address_bindings": port.AddressBindings,
+		"tags":             port.Tags,
+	}, nil); err != nil {
+		return fmt.Errorf("error updating the address bindings of segment port %s, err: %v", ref.portPath, err)
+	}
+	return nil
+}
+
+// GetNodeEgressIPConfiguration returns the configuration of the segment port
+// of the node's VM, keyed by ID. The capacity of each address family is the
+// number of addresses of the subnet of the segment, but its network,
+// broadcast and gateway address and the ones bound to the port, up to the
+// number of tags the port can still hold.
+func (v *VSphere) GetNodeEgressIPConfiguration(ctx context.Context, node *corev1.Node) ([]*NodeEgressIPConfiguration, error) {
+	port, ref, err := v.getPort(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	segment := &nsxtSegment{}
+	if err := v.client.do(ctx, http.MethodGet, "/policy/api/v1"+ref.segmentPath, nil, nil, segment); err != nil {
+		return nil, fmt.Errorf("error retrieving segment %s, err: %v", ref.segmentPath, err)
+	}
+	config := &NodeEgressIPConfiguration{
+		Interface: port.ID,
+		MAC:       normalizeMAC(ref.mac),
+	}
+	tags := nsxtMaxTags - len(port.Tags)
+	for _, subnet := range segment.Subnets {
+		cidr := subnet.Network
+		if cidr == "" {
+			cidr = subnet.GatewayAddress
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the subnet %q of segment %s, err: %v", cidr, segment.ID, err)
+		}
+		capacity := getNSXTSubnetCapacity(ipNet)
+		for _, binding := range port.AddressBindings {
+			if ip := ParseIP(binding.IPAddress); ip != nil && ipNet.Contains(ip) {
+				capacity--
+			}
+		}
+		if capacity > tags {
+			capacity = tags
+		}
+		if capacity < 0 {
+			capacity = 0
+		}
+		switch {
+		case utilnet.IsIPv4CIDR(ipNet) && config.IFAddr.IPv4 == "":
+			config.IFAddr.IPv4, config.Capacity.IPv4 = ipNet.String(), capacity
+		case utilnet.IsIPv6CIDR(ipNet) && config.IFAddr.IPv6 == "":
+			config.IFAddr.IPv6, config.Capacity.IPv6 = ipNet.String(), capacity
+		}
+	}
+	if config.IFAddr.IPv4 == "" && config.IFAddr.IPv6 == "" {
+		return nil, fmt.Errorf("segment %s of node %s has no subnet", segment.ID, node.Name)
+	}
+	return []*NodeEgressIPConfiguration{config}, nil
+}
+
+// CleanupNode is a no-op, segment ports are deleted together with the VM.
+func (v *VSphere) CleanupNode(ctx context.Context, node *corev1.Node) error {
+	return nil
+}
+
+// VerifyPrivateIP verifies that the address binding of ip is still on the
+// segment port of the node's VM, wrapping a MissingIPError otherwise.
+func (v *VSphere) VerifyPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) error {
+	port, _, err := v.getPort(ctx, node)
+	if err != nil {
+		return err
+	}
+	if getNSXTAddressBinding(port, ip) < 0 {
+		return fmt.Errorf("%w: IP address %s is not bound to segment port %s", MissingIPError, ip, port.ID)
+	}
+	return nil
+}
+
+// GetPrivateIPReservations returns nil, address bindings aren't resources of
+// their own.
+func (v *VSphere) GetPrivateIPReservations(ctx context.Context, ip net.IP, node *corev1.Node) ([]PrivateIPReservation, error) {
+	return nil, nil
+}
+
+// GetNodeNetworkInterfaces returns nil, the network adapters of VMs aren't
+// tracked.
+func (v *VSphere) GetNodeNetworkInterfaces(ctx context.Context, node *corev1.Node) ([]string, error) {
+	return nil, nil
+}
+
+// ListPrivateIPs returns the IP addresses bound to the node's segment port,
+// the node's own aside.
+func (v *VSphere) ListPrivateIPs(ctx context.Context, node *corev1.Node) ([]net.IP, error) {
+	port, _, err := v.getPort(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	nodeIPs := nodeInternalIPs(node)
+	ips := []net.IP{}
+bindings:
+	for _, binding := range port.AddressBindings {
+		ip := ParseIP(binding.IPAddress)
+		for _, nodeIP := range nodeIPs {
+			if nodeIP.Equal(ip) {
+				continue bindings
+			}
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+// CheckHealth retrieves the segment port of the node's VM.
+func (v *VSphere) CheckHealth(ctx context.Context, node *corev1.Node) error {
+	_, _, err := v.getPort(ctx, node)
+	return err
+}
+
+// getNSXTAddressBinding returns the index of the address binding of ip of the
+// segment port, -1 if there's none.
+func getNSXTAddressBinding(port *nsxtSegmentPort, ip net.IP) int {
+	for i, binding := range port.AddressBindings {
+		if ParseIP(binding.IPAddress).Equal(ip) {
+			return i
+		}
+	}
+	return -1
+}
+
+// getNSXTEgressIPTag returns the index of the egress IP tag of ip of the
+// segment port, -1 if there's none.
+func getNSXTEgressIPTag(port *nsxtSegmentPort, ip net.IP) int {
+	for i, tag := range port.Tags {
+		if tag.Scope == nsxtEgressIPScope && ParseIP(tag.Tag).Equal(ip) {
+			return i
+		}
+	}
+	return -1
+}
+
+// getNSXTSubnetCapacity returns the number of addresses of the subnet but its
+// network, broadcast and gateway address, up to math.MaxInt32.
+func getNSXTSubnetCapacity(ipNet *net.IPNet) int {
+	ones, bits := ipNet.Mask.Size()
+	if bits-ones >= 31 {
+		return math.MaxInt32
+	}
+	if capacity := 1<<(bits-ones) - 3; capacity > 0 {
+		return capacity
+	}
+	return 0
+}
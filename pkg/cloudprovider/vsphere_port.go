@@ -0,0 +1,200 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/groupcache/lru"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// nsxtPortCacheSize is the number of segment ports of nodes the CNCC keeps
+// track of, the least recently used ones being looked up again.
+const nsxtPortCacheSize = 1024
+
+// nsxtPortRef identifies the segment port of the first network adapter of a
+// VM, by its Policy API path, and the segment it's on.
+type nsxtPortRef struct {
+	segmentPath, portPath string
+	// mac is the MAC address of the network adapter.
+	mac string
+}
+
+// nsxtPortCache caches the segment ports looked up for nodes, keyed by
+// providerID: a lookup takes the VM, its network adapters and a search of
+// the segment ports, while every sync of the CloudPrivateIPConfigs of the
+// node needs the segment port.
+type nsxtPortCache struct {
+	sync.Mutex
+	ports *lru.Cache
+}
+
+func (c *nsxtPortCache) get(providerID string) (nsxtPortRef, bool) {
+	c.Lock()
+	defer c.Unlock()
+	if c.ports == nil {
+		return nsxtPortRef{}, false
+	}
+	ref, ok := c.ports.Get(providerID)
+	if !ok {
+		return nsxtPortRef{}, false
+	}
+	return ref.(nsxtPortRef), true
+}
+
+func (c *nsxtPortCache) add(providerID string, ref nsxtPortRef) {
+	c.Lock()
+	defer c.Unlock()
+	if c.ports == nil {
+		c.ports = lru.New(nsxtPortCacheSize)
+	}
+	c.ports.Add(providerID, ref)
+}
+
+func (c *nsxtPortCache) remove(providerID string) {
+	c.Lock()
+	defer c.Unlock()
+	if c.ports != nil {
+		c.ports.Remove(providerID)
+	}
+}
+
+// resolvePort returns the segment port of the node's VM, from the cache or
+// looked up.
+func (v *VSphere) resolvePort(ctx context.Context, node *corev1.Node) (nsxtPortRef, error) {
+	if ref, ok := v.ports.get(node.Spec.ProviderID); ok {
+		return ref, nil
+	}
+	ref, err := v.lookupPort(ctx, node)
+	if err != nil {
+		return ref, err
+	}
+	v.ports.add(node.Spec.ProviderID, ref)
+	return ref, nil
+}
+
+// getPort retrieves the segment port of the node's VM, and returns it with
+// its reference. A cached segment port which doesn't exist anymore, e.g. as
+// the network adapter was replaced, is looked up again, once.
+func (v *VSphere) getPort(ctx context.Context, node *corev1.Node) (*nsxtSegmentPort, nsxtPortRef, error) {
+	ref, err := v.resolvePort(ctx, node)
+	if err != nil {
+		return nil, ref, err
+	}
+	port := &nsxtSegmentPort{}
+	err = v.client.do(ctx, http.MethodGet, "/policy/api/v1"+ref.portPath, nil, nil, port)
+	if isRESTStatus(err, http.StatusNotFound) {
+		klog.Infof("Segment port %s of node %s doesn't exist anymore, looking it up again", ref.portPath, node.Name)
+		v.ports.remove(node.Spec.ProviderID)
+		if ref, err = v.resolvePort(ctx, node); err != nil {
+			return nil, ref, err
+		}
+		err = v.client.do(ctx, http.MethodGet, "/policy/api/v1"+ref.portPath, nil, nil, port)
+	}
+	if err != nil {
+		return nil, ref, fmt.Errorf("error retrieving segment port %s of node %s, err: %v", ref.portPath, node.Name, err)
+	}
+	return port, ref, nil
+}
+
+// lookupPort looks up the segment port of the first network adapter of the
+// node's VM: the VM with the BIOS UUID of the node's providerID, the network
+// adapter with the lowest device key, and the segment port it's attached to.
+func (v *VSphere) lookupPort(ctx context.Context, node *corev1.Node) (nsxtPortRef, error) {
+	biosUUID, err := getVSphereBIOSUUID(node)
+	if err != nil {
+		return nsxtPortRef{}, err
+	}
+	vmID, err := v.lookupVM(ctx, biosUUID)
+	if err != nil {
+		return nsxtPortRef{}, fmt.Errorf("error looking up the VM of node %s: %w", node.Name, err)
+	}
+
+	vifs := &struct {
+		Results []struct {
+			LPortAttachmentID string `json:"lport_attachment_id"`
+			DeviceKey         string `json:"device_key"`
+			MACAddress        string `json:"mac_address"`
+		} `json:"results"`
+	}{}
+	if err := v.client.do(ctx, http.MethodGet, "/api/v1/fabric/vifs", url.Values{"owner_vm_id": {vmID}}, nil, vifs); err != nil {
+		return nsxtPortRef{}, fmt.Errorf("error listing the network adapters of VM %s of node %s, err: %v", vmID, node.Name, err)
+	}
+	sort.SliceStable(vifs.Results, func(i, j int) bool {
+		return vifs.Results[i].DeviceKey < vifs.Results[j].DeviceKey
+	})
+	for _, vif := range vifs.Results {
+		if vif.LPortAttachmentID == "" {
+			continue
+		}
+		ports := &struct {
+			Results []struct {
+				Path       string `json:"path"`
+				ParentPath string `json:"parent_path"`
+			} `json:"results"`
+		}{}
+		query := fmt.Sprintf("resource_type:SegmentPort AND attachment.id:%s", vif.LPortAttachmentID)
+		if err := v.client.do(ctx, http.MethodGet, "/policy/api/v1/search/query", url.Values{"query": {query}}, nil, ports); err != nil {
+			return nsxtPortRef{}, fmt.Errorf("error searching the segment port of VM %s of node %s, err: %v", vmID, node.Name, err)
+		}
+		if len(ports.Results) == 0 {
+			continue
+		}
+		return nsxtPortRef{
+			segmentPath: ports.Results[0].ParentPath,
+			portPath:    ports.Results[0].Path,
+			mac:         vif.MACAddress,
+		}, nil
+	}
+	return nsxtPortRef{}, fmt.Errorf("%w: VM %s of node %s has no network adapter attached to an NSX-T segment", NoNetworkInterfaceError, vmID, node.Name)
+}
+
+// lookupVM returns the external ID of the VM with the BIOS UUID, paging
+// through the VMs known to NSX-T: they can't be filtered by BIOS UUID.
+func (v *VSphere) lookupVM(ctx context.Context, biosUUID string) (string, error) {
+	computeID := "biosUuid:" + biosUUID
+	cursor := ""
+	for {
+		query := url.Values{}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		vms := &struct {
+			Results []struct {
+				ExternalID string   `json:"external_id"`
+				ComputeIDs []string `json:"compute_ids"`
+			} `json:"results"`
+			Cursor string `json:"cursor"`
+		}{}
+		if err := v.client.do(ctx, http.MethodGet, "/api/v1/fabric/virtual-machines", query, nil, vms); err != nil {
+			return "", err
+		}
+		for _, vm := range vms.Results {
+			for _, id := range vm.ComputeIDs {
+				if strings.EqualFold(id, computeID) {
+					return vm.ExternalID, nil
+				}
+			}
+		}
+		if vms.Cursor == "" || vms.Cursor == cursor {
+			return "", fmt.Errorf("no VM with BIOS UUID %s is known to NSX-T", biosUUID)
+		}
+		cursor = vms.Cursor
+	}
+}
+
+// getVSphereBIOSUUID returns the BIOS UUID of the node's VM, out of its
+// providerID, which looks like vsphere://<BIOS UUID>.
+func getVSphereBIOSUUID(node *corev1.Node) (string, error) {
+	biosUUID := strings.TrimPrefix(node.Spec.ProviderID, "vsphere://")
+	if biosUUID == node.Spec.ProviderID || biosUUID == "" || strings.Contains(biosUUID, "/") {
+		return "", fmt.Errorf("failed to parse node %s provider id %q, expected vsphere://<BIOS UUID>", node.Name, node.Spec.ProviderID)
+	}
+	return biosUUID, nil
+}
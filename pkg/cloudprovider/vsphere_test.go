@@ -0,0 +1,209 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	nsxtTestBIOSUUID = "4230b1f1-7a54-d1b4-2d2e-6c3b9f1e0a11"
+	nsxtTestPortPath = "/infra/segments/segment-0/ports/port-0"
+)
+
+// fakeNSXT serves the NSX-T API requests of VM vm-0, whose second network
+// adapter is attached to segment port port-0 of segment segment-0, with
+// subnets 192.168.0.0/24 and fd00::/64.
+type fakeNSXT struct {
+	mu   sync.Mutex
+	port nsxtSegmentPort
+	// lookups is the number of VM lookups.
+	lookups int
+	// portPath is the path of the segment port, a different one once the
+	// network adapter was replaced.
+	portPath string
+}
+
+func newFakeNSXT() *fakeNSXT {
+	return &fakeNSXT{
+		port: nsxtSegmentPort{
+			ID:              "port-0",
+			AddressBindings: []nsxtAddressBinding{{IPAddress: "192.168.0.10", MACAddress: "00:50:56:00:00:10"}},
+			Tags:            []nsxtTag{{Scope: "ncp/cluster", Tag: "cluster"}},
+		},
+		portPath: nsxtTestPortPath,
+	}
+}
+
+func (f *fakeNSXT) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if username, password, ok := r.BasicAuth(); !ok || username != "admin" || password != "password" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/fabric/virtual-machines":
+		f.lookups++
+		// The VMs are returned in two pages.
+		if r.URL.Query().Get("cursor") == "" {
+			_, _ = w.Write([]byte(`{"results": [{"external_id": "vm-1", "compute_ids": ["biosUuid:00000000-0000-0000-0000-000000000000"]}], "cursor": "1"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"results": [{"external_id": "vm-0", "compute_ids": ["moIdOnHost:7", "biosUuid:` + nsxtTestBIOSUUID + `"]}]}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/fabric/vifs" && r.URL.Query().Get("owner_vm_id") == "vm-0":
+		_, _ = w.Write([]byte(`{"results": [
+			{"lport_attachment_id": "attachment-1", "device_key": "4001", "mac_address": "00:50:56:00:00:11"},
+			{"lport_attachment_id": "attachment-0", "device_key": "4000", "mac_address": "00:50:56:00:00:10"}
+		]}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/policy/api/v1/search/query":
+		if r.URL.Query().Get("query") != "resource_type:SegmentPort AND attachment.id:attachment-0" {
+			_, _ = w.Write([]byte(`{"results": []}`))
+			return
+		}
+		_, _ = w.Write([]byte(fmt.Sprintf(`{"results": [{"path": %q, "parent_path": "/infra/segments/segment-0"}]}`, f.portPath)))
+	case r.Method == http.MethodGet && r.URL.Path == "/policy/api/v1/infra/segments/segment-0":
+		_, _ = w.Write([]byte(`{"id": "segment-0", "subnets": [{"gateway_address": "192.168.0.1/24", "network": "192.168.0.0/24"}, {"gateway_address": "fd00::1/64"}]}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/policy/api/v1"+f.portPath:
+		_ = json.NewEncoder(w).Encode(&f.port)
+	case r.Method == http.MethodPatch && r.URL.Path == "/policy/api/v1"+f.portPath:
+		update := &nsxtSegmentPort{}
+		if err := json.NewDecoder(r.Body).Decode(update); err != nil || update.AddressBindings == nil || update.Tags == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.port.AddressBindings, f.port.Tags = update.AddressBindings, update.Tags
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeVSphereProvider(server *httptest.Server) *VSphere {
+	return &VSphere{
+		CloudProvider: CloudProvider{ctx: context.Background()},
+		client: &restClient{
+			httpClient: server.Client(),
+			baseURL:    server.URL,
+			authorize: func(r *http.Request) error {
+				r.SetBasicAuth("admin", "password")
+				return nil
+			},
+		},
+	}
+}
+
+func newVSphereNode() *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0"},
+		Spec:       corev1.NodeSpec{ProviderID: "vsphere://" + nsxtTestBIOSUUID},
+	}
+}
+
+// newVSphereFakeCloud plugs the fake API into the tests shared by the clouds.
+func newVSphereFakeCloud(t *testing.T) *fakeCloud {
+	fake := newFakeNSXT()
+	server := httptest.NewServer(fake)
+	return &fakeCloud{
+		CloudProviderIntf: newFakeVSphereProvider(server),
+		assigned: func() []string {
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			ips := []string{}
+			for _, binding := range fake.port.AddressBindings[1:] {
+				ips = append(ips, binding.IPAddress)
+			}
+			return ips
+		},
+		close: server.Close,
+	}
+}
+
+func TestVSphereAssignPrivateIP(t *testing.T) {
+	tcs := []struct {
+		ip          string
+		tags        int
+		expectedErr error
+		expectErr   bool
+	}{
+		{ip: "192.168.0.20"},
+		{ip: "192.168.0.20", tags: nsxtMaxTags, expectErr: true},
+	}
+	for i, tc := range tcs {
+		fake := newFakeNSXT()
+		for len(fake.port.Tags) < tc.tags {
+			fake.port.Tags = append(fake.port.Tags, nsxtTag{Scope: "team", Tag: fmt.Sprint(len(fake.port.Tags))})
+		}
+		server := httptest.NewServer(fake)
+		provider := newFakeVSphereProvider(server)
+		err := provider.AssignPrivateIP(context.Background(), net.ParseIP(tc.ip), newVSphereNode())
+		server.Close()
+		if tc.expectErr != (err != nil) {
+			t.Fatalf("TestVSphereAssignPrivateIP(%d): expected an error: %v, err: %v", i, tc.expectErr, err)
+		}
+		if tc.expectErr {
+			if len(fake.port.AddressBindings) != 1 {
+				t.Fatalf("TestVSphereAssignPrivateIP(%d): expected the address bindings to be kept, got %v", i, fake.port.AddressBindings)
+			}
+			continue
+		}
+		expected := nsxtAddressBinding{IPAddress: tc.ip, MACAddress: "00:50:56:00:00:10"}
+		if len(fake.port.AddressBindings) != 2 || fake.port.AddressBindings[1] != expected {
+			t.Fatalf("TestVSphereAssignPrivateIP(%d): expected address binding %v, got %v", i, expected, fake.port.AddressBindings)
+		}
+		if getNSXTEgressIPTag(&fake.port, net.ParseIP(tc.ip)) < 0 || fake.port.Tags[0].Scope != "ncp/cluster" {
+			t.Fatalf("TestVSphereAssignPrivateIP(%d): expected the egress IP tag to be added, got %v", i, fake.port.Tags)
+		}
+	}
+}
+
+func TestVSphereReleasePrivateIP(t *testing.T) {
+	fake := newFakeNSXT()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	provider := newFakeVSphereProvider(server)
+	node := newVSphereNode()
+	ip := net.ParseIP("192.168.0.20")
+
+	if err := provider.AssignPrivateIP(context.Background(), ip, node); err != nil {
+		t.Fatalf("received unexpected error assigning IP address, err: %v", err)
+	}
+	// The network adapter is replaced, its segment port is looked up again.
+	fake.portPath = "/infra/segments/segment-0/ports/port-1"
+	if err := provider.ReleasePrivateIP(context.Background(), ip, node); err != nil {
+		t.Fatalf("received unexpected error releasing IP address, err: %v", err)
+	}
+	if len(fake.port.AddressBindings) != 1 || len(fake.port.Tags) != 1 {
+		t.Fatalf("expected only the address binding and tag of the egress IP to be removed, got %v and %v", fake.port.AddressBindings, fake.port.Tags)
+	}
+	if fake.lookups != 4 {
+		t.Fatalf("expected the VM to be looked up twice, over two pages, got %d requests", fake.lookups)
+	}
+}
+
+func TestGetNSXTSubnetCapacity(t *testing.T) {
+	tcs := []struct {
+		cidr     string
+		expected int
+	}{
+		{cidr: "192.168.0.0/24", expected: 253},
+		{cidr: "192.168.0.0/30", expected: 1},
+		{cidr: "192.168.0.0/31", expected: 0},
+		{cidr: "192.168.0.0/32", expected: 0},
+		{cidr: "fd00::/120", expected: 253},
+		{cidr: "fd00::/64", expected: 1<<31 - 1},
+	}
+	for i, tc := range tcs {
+		_, ipNet, _ := net.ParseCIDR(tc.cidr)
+		if capacity := getNSXTSubnetCapacity(ipNet); capacity != tc.expected {
+			t.Fatalf("TestGetNSXTSubnetCapacity(%d): expected capacity %d, got %d", i, tc.expected, capacity)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package conditions
+
+import (
+	"time"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	"github.com/openshift/cloud-network-config-controller/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types set by this controller. Consumers should only ever match
+// against these constants, never against the condition message.
+const (
+	// Assigned indicates whether the IP address of a CloudPrivateIPConfig is
+	// assigned to status.node on the cloud.
+	Assigned = string(cloudnetworkv1.Assigned)
+	// Verified indicates whether the assignment of the IP address of a
+	// CloudPrivateIPConfig has been verified to be effective, on the cloud
+	// and optionally on the data plane. It's only set when verification is
+	// enabled and is informative: it never causes the assignment to be retried.
+	Verified = "Verified"
+)
+
+// Condition reasons set by this controller.
+const (
+	// ReasonCloudResponsePending indicates a pending response from the cloud API
+	ReasonCloudResponsePending = "CloudResponsePending"
+	// ReasonCloudResponseError indicates an error response from the cloud API
+	ReasonCloudResponseError = "CloudResponseError"
+	// ReasonCloudResponseSuccess indicates a successful response from the cloud API
+	ReasonCloudResponseSuccess = "CloudResponseSuccess"
+	// ReasonReadOnly indicates that the change was not performed on the cloud,
+	// since the controller runs in read-only mode
+	ReasonReadOnly = "ReadOnly"
+	// ReasonVerificationSucceeded indicates that the assignment was verified
+	ReasonVerificationSucceeded = "VerificationSucceeded"
+	// ReasonCloudVerificationFailed indicates that the cloud does not report the
+	// assignment as effective
+	ReasonCloudVerificationFailed = "CloudVerificationFailed"
+	// ReasonProbeFailed indicates that the IP address could not be reached
+	ReasonProbeFailed = "ProbeFailed"
+	// ReasonMaintenanceWindow indicates that the change or the verification
+	// was deferred during a cloud maintenance window
+	ReasonMaintenanceWindow = "MaintenanceWindow"
+	// ReasonDualStackPairPending indicates that the change waits for the
+	// paired CloudPrivateIPConfig of the other IP family
+	ReasonDualStackPairPending = "DualStackPairPending"
+	// ReasonZoneMismatch indicates that the IP address can't be used in the
+	// zone of the node, it must be assigned to a node of another zone
+	ReasonZoneMismatch = "ZoneMismatch"
+)
+
+// Kinds of objects whose conditions are managed by this controller, used for
+// labeling metrics.
+const (
+	KindCloudPrivateIPConfig = "CloudPrivateIPConfig"
+)
+
+// flapWindow is the minimum amount of time a condition is expected to remain
+// in a definite status (True/False). Leaving that status sooner than that is
+// counted as a flap.
+const flapWindow = 5 * time.Minute
+
+var (
+	transitionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "condition_transitions_total",
+		Help:      "Number of status transitions of conditions managed by the controller.",
+	}, []string{"kind", "type", "from", "to"})
+	flapsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "condition_flaps_total",
+		Help:      "Number of times a condition left a definite status less than 5 minutes after entering it.",
+	}, []string{"kind", "type"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		transitionsTotal,
+		flapsTotal,
+	)
+}
+
+// New returns a condition of type conditionType observed at generation.
+// LastTransitionTime is left for Set to fill in.
+func New(conditionType string, status metav1.ConditionStatus, generation int64, reason, message string) metav1.Condition {
+	return metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	}
+}
+
+// Set returns a copy of existing in which newCondition has been set. The
+// LastTransitionTime of the condition is only bumped if its status actually
+// changes, otherwise the previous one is kept. Every status transition is
+// recorded in the condition metrics under kind.
+func Set(kind string, existing []metav1.Condition, newCondition metav1.Condition) []metav1.Condition {
+	conditions := make([]metav1.Condition, len(existing))
+	copy(conditions, existing)
+
+	now := metav1.Now()
+	if old := meta.FindStatusCondition(conditions, newCondition.Type); old != nil && old.Status != newCondition.Status {
+		transitionsTotal.WithLabelValues(kind, newCondition.Type, string(old.Status), string(newCondition.Status)).Inc()
+		if isFlap(old, now.Time) {
+			flapsTotal.WithLabelValues(kind, newCondition.Type).Inc()
+		}
+	} else if old == nil {
+		transitionsTotal.WithLabelValues(kind, newCondition.Type, "", string(newCondition.Status)).Inc()
+	}
+	if newCondition.LastTransitionTime.IsZero() {
+		newCondition.LastTransitionTime = now
+	}
+	meta.SetStatusCondition(&conditions, newCondition)
+	return conditions
+}
+
+// Remove returns a copy of existing without the condition of type
+// conditionType.
+func Remove(existing []metav1.Condition, conditionType string) []metav1.Condition {
+	conditions := make([]metav1.Condition, len(existing))
+	copy(conditions, existing)
+	meta.RemoveStatusCondition(&conditions, conditionType)
+	return conditions
+}
+
+// isFlap returns true if the old condition is left within flapWindow of
+// entering its status. Leaving Unknown is never a flap, since that status is
+// only held while waiting for the cloud to respond.
+func isFlap(old *metav1.Condition, now time.Time) bool {
+	if old.Status == metav1.ConditionUnknown || old.LastTransitionTime.IsZero() {
+		return false
+	}
+	return now.Sub(old.LastTransitionTime.Time) < flapWindow
+}
@@ -0,0 +1,47 @@
+package conditions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSet(t *testing.T) {
+	kind := "TestSet"
+	pending := New(Assigned, metav1.ConditionUnknown, 1, ReasonCloudResponsePending, "pending")
+	conditions := Set(kind, nil, pending)
+	if len(conditions) != 1 || conditions[0].LastTransitionTime.IsZero() {
+		t.Fatalf("TestSet: expected one condition with a transition time, got %v", conditions)
+	}
+
+	// Same status, the transition time must be kept.
+	firstTransition := conditions[0].LastTransitionTime
+	conditions = Set(kind, conditions, New(Assigned, metav1.ConditionUnknown, 2, ReasonCloudResponsePending, "still pending"))
+	if !conditions[0].LastTransitionTime.Equal(&firstTransition) || conditions[0].ObservedGeneration != 2 {
+		t.Fatalf("TestSet: expected transition time to be kept and generation bumped, got %v", conditions[0])
+	}
+
+	// Leaving Unknown is never a flap.
+	conditions = Set(kind, conditions, New(Assigned, metav1.ConditionTrue, 2, ReasonCloudResponseSuccess, "assigned"))
+	if testutil.ToFloat64(transitionsTotal.WithLabelValues(kind, Assigned, string(metav1.ConditionUnknown), string(metav1.ConditionTrue))) != 1 {
+		t.Fatalf("TestSet: expected Unknown -> True transition to be recorded")
+	}
+	if testutil.ToFloat64(flapsTotal.WithLabelValues(kind, Assigned)) != 0 {
+		t.Fatalf("TestSet: expected no flap when leaving Unknown")
+	}
+
+	// Leaving True right after entering it is a flap.
+	conditions = Set(kind, conditions, New(Assigned, metav1.ConditionFalse, 2, ReasonCloudResponseError, "error"))
+	if testutil.ToFloat64(flapsTotal.WithLabelValues(kind, Assigned)) != 1 {
+		t.Fatalf("TestSet: expected a flap when leaving True within %s", flapWindow)
+	}
+
+	// Leaving False a long time after entering it is not.
+	conditions[0].LastTransitionTime = metav1.NewTime(time.Now().Add(-2 * flapWindow))
+	Set(kind, conditions, New(Assigned, metav1.ConditionTrue, 2, ReasonCloudResponseSuccess, "assigned"))
+	if testutil.ToFloat64(flapsTotal.WithLabelValues(kind, Assigned)) != 1 {
+		t.Fatalf("TestSet: expected no flap when leaving False after %s", flapWindow)
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	controller "github.com/openshift/cloud-network-config-controller/pkg/controller"
+	maintenance "github.com/openshift/cloud-network-config-controller/pkg/maintenance"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// Name is the name of the only ControllerConfig the controller reads.
+	Name = "cluster"
+
+	// reloadInterval is the interval at which the ControllerConfig and the
+	// secrets it references are checked for changes.
+	reloadInterval = time.Minute
+)
+
+// controllerConfigResource is the resource of ControllerConfigs, see
+// manifests/cloudnetworkconfig.openshift.io_controllerconfigs.yaml
+var controllerConfigResource = schema.GroupVersionResource{
+	Group:    "cloudnetworkconfig.openshift.io",
+	Version:  "v1alpha1",
+	Resource: "controllerconfigs",
+}
+
+// Config is the configuration of the controller which may change at runtime,
+// read from the ControllerConfig named Name, with the secrets it references
+// resolved.
+type Config struct {
+	// NotificationSinks are the sinks the assignment lifecycle events are
+	// delivered to.
+	NotificationSinks []NotificationSink
+	// MaintenanceWindows are the planned maintenance windows of the cloud.
+	MaintenanceWindows maintenance.Windows
+}
+
+// NotificationSink is a sink of the assignment lifecycle events, see
+// notifier.NewSink.
+type NotificationSink struct {
+	Kind string
+	// URL is read from a secret, incoming webhook URLs usually embed a
+	// token.
+	URL string
+}
+
+// controllerConfigSpec is the spec of a ControllerConfig.
+type controllerConfigSpec struct {
+	NotificationSinks []struct {
+		Kind         string        `json:"kind"`
+		URLSecretRef *secretKeyRef `json:"urlSecretRef"`
+	} `json:"notificationSinks"`
+	MaintenanceWindows []struct {
+		Schedule string `json:"schedule"`
+		Duration string `json:"duration"`
+	} `json:"maintenanceWindows"`
+}
+
+// secretKeyRef references a key of a secret of the controller's namespace.
+type secretKeyRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// Loader reads the Config out of the ControllerConfig and the secrets of the
+// controller's namespace.
+type Loader struct {
+	Client    dynamic.Interface
+	Secrets   corev1client.SecretsGetter
+	Namespace string
+}
+
+// Load returns the Config. It's empty if there's no ControllerConfig, or the
+// CRD isn't installed.
+func (l *Loader) Load(ctx context.Context) (*Config, error) {
+	getCtx, cancel := context.WithTimeout(ctx, controller.ClientTimeout)
+	defer cancel()
+	controllerConfig, err := l.Client.Resource(controllerConfigResource).Get(getCtx, Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return &Config{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting ControllerConfig: %q, err: %v", Name, err)
+	}
+	rawSpec, _, _ := unstructured.NestedMap(controllerConfig.Object, "spec")
+	spec := controllerConfigSpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawSpec, &spec); err != nil {
+		return nil, fmt.Errorf("invalid ControllerConfig: %q, err: %v", Name, err)
+	}
+
+	config := &Config{}
+	for i, sink := range spec.NotificationSinks {
+		if sink.URLSecretRef == nil || sink.URLSecretRef.Name == "" || sink.URLSecretRef.Key == "" {
+			return nil, fmt.Errorf("invalid notification sink %d of ControllerConfig: %q, urlSecretRef must name a secret and its key", i, Name)
+		}
+		url, err := l.secretValue(ctx, *sink.URLSecretRef)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notification sink %d of ControllerConfig: %q, %v", i, Name, err)
+		}
+		config.NotificationSinks = append(config.NotificationSinks, NotificationSink{Kind: sink.Kind, URL: url})
+	}
+	for _, window := range spec.MaintenanceWindows {
+		parsed, err := maintenance.ParseWindow(window.Schedule, window.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ControllerConfig: %q, %v", Name, err)
+		}
+		config.MaintenanceWindows = append(config.MaintenanceWindows, parsed)
+	}
+	return config, nil
+}
+
+func (l *Loader) secretValue(ctx context.Context, ref secretKeyRef) (string, error) {
+	getCtx, cancel := context.WithTimeout(ctx, controller.ClientTimeout)
+	defer cancel()
+	secret, err := l.Secrets.Secrets(l.Namespace).Get(getCtx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("error getting secret: %s/%s, err: %v", l.Namespace, ref.Name, err)
+	}
+	value, ok := secret.Data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("secret: %s/%s has no key %q", l.Namespace, ref.Name, ref.Key)
+	}
+	return string(value), nil
+}
+
+// Watch reloads the Config periodically until ctx is done, and calls onChange
+// once it differs from loaded, e.g. to restart the controllers like on a
+// rotation of the cloud credentials. Configs which fail to load are logged and
+// ignored, the current one stays in effect.
+func (l *Loader) Watch(ctx context.Context, loaded *Config, onChange func()) {
+	wait.Until(func() {
+		config, err := l.Load(ctx)
+		if err != nil {
+			klog.Warningf("Keeping the current configuration, err: %v", err)
+			return
+		}
+		if !reflect.DeepEqual(config, loaded) {
+			klog.Infof("ControllerConfig: %q or the secrets it references changed", Name)
+			onChange()
+		}
+	}, reloadInterval, ctx.Done())
+}
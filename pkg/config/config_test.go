@@ -0,0 +1,115 @@
+package config
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	maintenance "github.com/openshift/cloud-network-config-controller/pkg/maintenance"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	fakekubeclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLoad(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "notifications", Namespace: "openshift-cloud-network-config-controller"},
+		Data:       map[string][]byte{"slack": []byte("https://hooks.slack.com/services/T/B/X")},
+	}
+	newControllerConfig := func(sinks ...interface{}) *unstructured.Unstructured {
+		controllerConfig := &unstructured.Unstructured{}
+		controllerConfig.SetAPIVersion(controllerConfigResource.GroupVersion().String())
+		controllerConfig.SetKind("ControllerConfig")
+		controllerConfig.SetName(Name)
+		controllerConfig.Object["spec"] = map[string]interface{}{"notificationSinks": sinks}
+		return controllerConfig
+	}
+	withMaintenanceWindows := func(controllerConfig *unstructured.Unstructured, windows ...interface{}) *unstructured.Unstructured {
+		unstructured.SetNestedSlice(controllerConfig.Object, windows, "spec", "maintenanceWindows")
+		return controllerConfig
+	}
+	window, _ := maintenance.ParseWindow("0 2 * * 0", "4h")
+	slackSink := func(name, key string) interface{} {
+		return map[string]interface{}{
+			"kind":         "slack",
+			"urlSecretRef": map[string]interface{}{"name": name, "key": key},
+		}
+	}
+
+	tcs := []struct {
+		name             string
+		controllerConfig *unstructured.Unstructured
+		expected         *Config
+		err              string
+	}{
+		{
+			name:     "Should return an empty config without ControllerConfig",
+			expected: &Config{},
+		},
+		{
+			name:             "Should resolve the URLs of the notification sinks",
+			controllerConfig: newControllerConfig(slackSink("notifications", "slack")),
+			expected: &Config{NotificationSinks: []NotificationSink{
+				{Kind: "slack", URL: "https://hooks.slack.com/services/T/B/X"},
+			}},
+		},
+		{
+			name: "Should parse the maintenance windows",
+			controllerConfig: withMaintenanceWindows(newControllerConfig(),
+				map[string]interface{}{"schedule": "0 2 * * 0", "duration": "4h"},
+			),
+			expected: &Config{MaintenanceWindows: maintenance.Windows{window}},
+		},
+		{
+			name: "Should fail on an invalid maintenance window",
+			controllerConfig: withMaintenanceWindows(newControllerConfig(),
+				map[string]interface{}{"schedule": "0 2 * * 0", "duration": "-4h"},
+			),
+			err: "invalid maintenance window",
+		},
+		{
+			name:             "Should fail on a missing secret",
+			controllerConfig: newControllerConfig(slackSink("missing", "slack")),
+			err:              "error getting secret",
+		},
+		{
+			name:             "Should fail on a missing key",
+			controllerConfig: newControllerConfig(slackSink("notifications", "webhook")),
+			err:              `has no key "webhook"`,
+		},
+		{
+			name:             "Should fail without secret reference",
+			controllerConfig: newControllerConfig(map[string]interface{}{"kind": "slack"}),
+			err:              "urlSecretRef must name a secret and its key",
+		},
+	}
+
+	for i, tc := range tcs {
+		objects := []runtime.Object{}
+		if tc.controllerConfig != nil {
+			objects = append(objects, tc.controllerConfig)
+		}
+		loader := &Loader{
+			Client:    dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objects...),
+			Secrets:   fakekubeclient.NewSimpleClientset(secret).CoreV1(),
+			Namespace: secret.Namespace,
+		}
+		config, err := loader.Load(context.TODO())
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("TestLoad(%d): %s: expected error %q, got: %v", i, tc.name, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestLoad(%d): %s: unexpected error, err: %v", i, tc.name, err)
+		}
+		if !reflect.DeepEqual(config, tc.expected) {
+			t.Fatalf("TestLoad(%d): %s: expected %+v, got %+v", i, tc.name, tc.expected, config)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	controller "github.com/openshift/cloud-network-config-controller/pkg/controller"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+)
+
+// AssignmentOperation is the operation documented by a
+// CloudIPAssignmentRecord.
+type AssignmentOperation string
+
+const (
+	AssignmentOperationAssign  AssignmentOperation = "Assign"
+	AssignmentOperationMove    AssignmentOperation = "Move"
+	AssignmentOperationRelease AssignmentOperation = "Release"
+
+	// AssignmentRecordLabel is the label of CloudIPAssignmentRecords holding
+	// the name of the CloudPrivateIPConfig they document, to select all
+	// records of an IP address.
+	AssignmentRecordLabel = "cloud.network.openshift.io/cloudprivateipconfig"
+
+	// assignmentRecordPruneInterval is the interval at which the
+	// CloudIPAssignmentRecords older than the retention are deleted.
+	assignmentRecordPruneInterval = 10 * time.Minute
+)
+
+var (
+	// cloudIPAssignmentRecordResource is the resource of
+	// CloudIPAssignmentRecords, see
+	// manifests/cloudnetworkconfig.openshift.io_cloudipassignmentrecords.yaml
+	cloudIPAssignmentRecordResource = schema.GroupVersionResource{
+		Group:    "cloudnetworkconfig.openshift.io",
+		Version:  "v1alpha1",
+		Resource: "cloudipassignmentrecords",
+	}
+	cloudIPAssignmentRecordKind = "CloudIPAssignmentRecord"
+)
+
+// AuditConfig configures the CloudIPAssignmentRecords documenting every
+// successful assignment, move and release.
+type AuditConfig struct {
+	// Client records the CloudIPAssignmentRecords, nil if disabled.
+	Client dynamic.Interface
+	// Retention is how long CloudIPAssignmentRecords are kept.
+	Retention time.Duration
+}
+
+// recordAssignment documents the successful operation moving the IP address of
+// cloudPrivateIPConfig from previousNode to node, either of them empty if it
+// wasn't or isn't assigned anymore, in a new CloudIPAssignmentRecord. Records
+// aren't owned by the CloudPrivateIPConfig, so that they outlive it. They're
+// purely informative, failing to record them is logged but doesn't fail the
+// sync.
+func (c *CloudPrivateIPConfigController) recordAssignment(cloudPrivateIPConfig *cloudnetworkv1.CloudPrivateIPConfig, ip net.IP, operation AssignmentOperation, previousNode, node string) {
+	if c.auditConfig.Client == nil {
+		return
+	}
+	now := time.Now().UTC()
+	spec := map[string]interface{}{
+		"operation":            string(operation),
+		"cloudPrivateIPConfig": cloudPrivateIPConfig.Name,
+		"ip":                   ip.String(),
+		"time":                 now.Format(time.RFC3339),
+	}
+	if previousNode != "" {
+		spec["previousNode"] = previousNode
+	}
+	if node != "" {
+		spec["node"] = node
+	}
+	record := &unstructured.Unstructured{}
+	record.SetAPIVersion(cloudIPAssignmentRecordResource.GroupVersion().String())
+	record.SetKind(cloudIPAssignmentRecordKind)
+	// The name is unique as long as the object isn't changed twice within
+	// the same nanosecond, and sorts the records of an object by time.
+	record.SetName(fmt.Sprintf("%s-%d", cloudPrivateIPConfig.Name, now.UnixNano()))
+	record.SetLabels(map[string]string{AssignmentRecordLabel: cloudPrivateIPConfig.Name})
+	record.Object["spec"] = spec
+
+	ctx, cancel := context.WithTimeout(c.ctx, controller.ClientTimeout)
+	defer cancel()
+	if _, err := c.auditConfig.Client.Resource(cloudIPAssignmentRecordResource).Create(ctx, record, metav1.CreateOptions{}); err != nil {
+		klog.Warningf("Could not record CloudIPAssignmentRecord of %s operation for CloudPrivateIPConfig: %q, err: %v", operation, cloudPrivateIPConfig.Name, err)
+	}
+}
+
+// RunAssignmentRecordPruner deletes the CloudIPAssignmentRecords older than
+// the retention periodically, until ctx is done.
+func RunAssignmentRecordPruner(ctx context.Context, auditConfig AuditConfig) {
+	if auditConfig.Client == nil {
+		return
+	}
+	wait.Until(func() {
+		if err := pruneAssignmentRecords(ctx, auditConfig, time.Now()); err != nil {
+			klog.Warningf("Could not prune CloudIPAssignmentRecords, err: %v", err)
+		}
+	}, assignmentRecordPruneInterval, ctx.Done())
+}
+
+// pruneAssignmentRecords deletes the CloudIPAssignmentRecords recorded more
+// than the retention before now.
+func pruneAssignmentRecords(ctx context.Context, auditConfig AuditConfig, now time.Time) error {
+	client := auditConfig.Client.Resource(cloudIPAssignmentRecordResource)
+	listCtx, cancel := context.WithTimeout(ctx, controller.ClientTimeout)
+	defer cancel()
+	records, err := client.List(listCtx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	deleted := 0
+	for _, record := range records.Items {
+		recorded, _, _ := unstructured.NestedString(record.Object, "spec", "time")
+		recordedTime, err := time.Parse(time.RFC3339, recorded)
+		if err != nil {
+			// Fall back to the creation of records without a valid time.
+			recordedTime = record.GetCreationTimestamp().Time
+		}
+		if now.Sub(recordedTime) <= auditConfig.Retention {
+			continue
+		}
+		deleteCtx, cancel := context.WithTimeout(ctx, controller.ClientTimeout)
+		err = client.Delete(deleteCtx, record.GetName(), metav1.DeleteOptions{})
+		cancel()
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("error deleting CloudIPAssignmentRecord: %q, err: %v", record.GetName(), err)
+		}
+		deleted++
+	}
+	if deleted > 0 {
+		klog.Infof("Pruned %d CloudIPAssignmentRecords older than %s", deleted, auditConfig.Retention)
+	}
+	return nil
+}
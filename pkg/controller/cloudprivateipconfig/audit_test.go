@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestRecordAssignment(t *testing.T) {
+	auditClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		cloudIPAssignmentRecordResource: cloudIPAssignmentRecordKind + "List",
+	})
+	c := &CloudPrivateIPConfigController{
+		auditConfig: AuditConfig{Client: auditClient, Retention: time.Hour},
+		ctx:         context.TODO(),
+	}
+
+	cloudPrivateIPConfig := &cloudnetworkv1.CloudPrivateIPConfig{}
+	cloudPrivateIPConfig.Name = "192.168.172.12"
+	ip := net.ParseIP(cloudPrivateIPConfig.Name)
+
+	operations := []struct {
+		operation    AssignmentOperation
+		previousNode string
+		node         string
+	}{
+		{AssignmentOperationAssign, "", "nodeA"},
+		{AssignmentOperationMove, "nodeA", "nodeB"},
+		{AssignmentOperationRelease, "nodeB", ""},
+	}
+	for _, op := range operations {
+		c.recordAssignment(cloudPrivateIPConfig, ip, op.operation, op.previousNode, op.node)
+	}
+
+	list, err := auditClient.Resource(cloudIPAssignmentRecordResource).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: AssignmentRecordLabel + "=" + cloudPrivateIPConfig.Name,
+	})
+	if err != nil {
+		t.Fatalf("TestRecordAssignment: could not list CloudIPAssignmentRecords, err: %v", err)
+	}
+	if len(list.Items) != len(operations) {
+		t.Fatalf("TestRecordAssignment: expected %d CloudIPAssignmentRecords, got %d", len(operations), len(list.Items))
+	}
+	// Records are named after the time of the operation, hence listed in order.
+	for i, op := range operations {
+		spec := list.Items[i].Object["spec"].(map[string]interface{})
+		if spec["operation"] != string(op.operation) || spec["ip"] != cloudPrivateIPConfig.Name || spec["cloudPrivateIPConfig"] != cloudPrivateIPConfig.Name {
+			t.Fatalf("TestRecordAssignment(%d): unexpected CloudIPAssignmentRecord %v", i, spec)
+		}
+		if previousNode, _, _ := unstructured.NestedString(spec, "previousNode"); previousNode != op.previousNode {
+			t.Fatalf("TestRecordAssignment(%d): expected previous node %q, got %q", i, op.previousNode, previousNode)
+		}
+		if node, _, _ := unstructured.NestedString(spec, "node"); node != op.node {
+			t.Fatalf("TestRecordAssignment(%d): expected node %q, got %q", i, op.node, node)
+		}
+	}
+
+	// Only the records older than the retention are pruned.
+	old := list.Items[0].DeepCopy()
+	old.SetName(cloudPrivateIPConfig.Name + "-old")
+	old.Object["spec"].(map[string]interface{})["time"] = time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	if _, err := auditClient.Resource(cloudIPAssignmentRecordResource).Create(context.TODO(), old, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("TestRecordAssignment: could not create CloudIPAssignmentRecord, err: %v", err)
+	}
+	if err := pruneAssignmentRecords(context.TODO(), c.auditConfig, time.Now()); err != nil {
+		t.Fatalf("TestRecordAssignment: unexpected error pruning CloudIPAssignmentRecords, err: %v", err)
+	}
+	list, err = auditClient.Resource(cloudIPAssignmentRecordResource).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("TestRecordAssignment: could not list CloudIPAssignmentRecords, err: %v", err)
+	}
+	if len(list.Items) != len(operations) {
+		t.Fatalf("TestRecordAssignment: expected %d CloudIPAssignmentRecords after pruning, got %d", len(operations), len(list.Items))
+	}
+	for _, record := range list.Items {
+		if record.GetName() == old.GetName() {
+			t.Fatalf("TestRecordAssignment: expected CloudIPAssignmentRecord %s to be pruned", old.GetName())
+		}
+	}
+}
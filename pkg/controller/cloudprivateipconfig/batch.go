@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/openshift/cloud-network-config-controller/pkg/tracing"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// nodeBatch collects the IP addresses of concurrent assignments, or releases,
+// to the same node, to hand them to the cloud provider at once.
+type nodeBatch struct {
+	ips []net.IP
+	// errs holds the result of each IP address, by index, once done is
+	// closed.
+	errs []error
+	done chan struct{}
+}
+
+// nodeBatches are the batches collecting IP addresses, keyed by operation and
+// node name.
+type nodeBatches struct {
+	sync.Mutex
+	pending map[string]*nodeBatch
+}
+
+// assignPrivateIP assigns ip to node on the cloud, along with the IP
+// addresses assigned to the same node within the node batch window, if set and
+// if the cloud provider assigns IP addresses in a single call. Otherwise the
+// batch would only delay the assignments, applied in turn anyway.
+func (c *CloudPrivateIPConfigController) assignPrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) (err error) {
+	ctx, span := startCloudSpan(ctx, "AssignPrivateIP", ip, node)
+	defer func() { tracing.End(span, err) }()
+	if c.nodeBatchWindow <= 0 || !c.cloudProviderClient.BatchesAssignPrivateIPs() {
+		return c.cloudProviderClient.AssignPrivateIP(ctx, ip, node)
+	}
+	return c.batch(ctx, "assign", ip, node, c.cloudProviderClient.AssignPrivateIPs)
+}
+
+// releasePrivateIP releases ip from node on the cloud, along with the IP
+// addresses released from the same node within the node batch window, if set
+// and if the cloud provider releases IP addresses in a single call.
+func (c *CloudPrivateIPConfigController) releasePrivateIP(ctx context.Context, ip net.IP, node *corev1.Node) (err error) {
+	ctx, span := startCloudSpan(ctx, "ReleasePrivateIP", ip, node)
+	defer func() { tracing.End(span, err) }()
+	if c.nodeBatchWindow <= 0 || !c.cloudProviderClient.BatchesReleasePrivateIPs() {
+		return c.cloudProviderClient.ReleasePrivateIP(ctx, ip, node)
+	}
+	return c.batch(ctx, "release", ip, node, c.cloudProviderClient.ReleasePrivateIPs)
+}
+
+// batch queues ip for the operation on node. The first IP address queued
+// waits for the node batch window, and all IP addresses queued meanwhile are
+// sent along to the cloud provider in the same call. Each worker blocks
+// until the call returns, so a batch holds at most as many IP addresses as
+// there are workers. The cloud provider sends the IP addresses of the call
+// without waiting for its own batch window. The call is made with the ctx of
+// the first IP address queued, so the requests to the cloud are traced as
+// children of its span only.
+func (c *CloudPrivateIPConfigController) batch(ctx context.Context, operation string, ip net.IP, node *corev1.Node, send func(context.Context, []net.IP, *corev1.Node) []error) error {
+	key := operation + "/" + node.Name
+
+	c.batches.Lock()
+	if c.batches.pending == nil {
+		c.batches.pending = map[string]*nodeBatch{}
+	}
+	batch, ok := c.batches.pending[key]
+	if !ok {
+		batch = &nodeBatch{done: make(chan struct{})}
+		c.batches.pending[key] = batch
+	}
+	index := len(batch.ips)
+	batch.ips = append(batch.ips, ip)
+	c.batches.Unlock()
+
+	if ok {
+		<-batch.done
+		return batch.errs[index]
+	}
+
+	time.Sleep(c.nodeBatchWindow)
+	c.batches.Lock()
+	delete(c.batches.pending, key)
+	c.batches.Unlock()
+	if len(batch.ips) > 1 {
+		klog.Infof("Sending the %s operations of %d IP addresses for node %q in a single call", operation, len(batch.ips), node.Name)
+	}
+	batch.errs = send(ctx, batch.ips, node)
+	close(batch.done)
+	return batch.errs[index]
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	fakecloudnetworkclientset "github.com/openshift/client-go/cloudnetwork/clientset/versioned/fake"
+	cloudnetworkinformers "github.com/openshift/client-go/cloudnetwork/informers/externalversions"
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	fakekubeclient "k8s.io/client-go/kubernetes/fake"
+)
+
+// TestBatchAssignments verifies that the concurrent assignments to the same
+// node are sent to the cloud provider in a single call, each object getting
+// its own result, unless the cloud provider doesn't batch them.
+func TestBatchAssignments(t *testing.T) {
+	for _, unbatched := range []bool{false, true} {
+		testBatchAssignments(t, unbatched)
+	}
+}
+
+func testBatchAssignments(t *testing.T, unbatched bool) {
+	ips := []string{"192.168.172.12", "192.168.172.13", "192.168.172.14"}
+	cloudPrivateIPConfigs := []*cloudnetworkv1.CloudPrivateIPConfig{}
+	for _, ip := range ips {
+		cloudPrivateIPConfigs = append(cloudPrivateIPConfigs, &cloudnetworkv1.CloudPrivateIPConfig{
+			ObjectMeta: v1.ObjectMeta{Name: ip},
+			Spec:       cloudnetworkv1.CloudPrivateIPConfigSpec{Node: nodeNameA},
+		})
+	}
+	fakeCloudNetworkClient := fakecloudnetworkclientset.NewSimpleClientset(cloudPrivateIPConfigs[0], cloudPrivateIPConfigs[1], cloudPrivateIPConfigs[2])
+	fakeCloudProvider := cloudprovider.NewFakeCloudProvider(false, false, false, false, 0)
+	fakeCloudProvider.MockErrorOnAssignIPs = map[string]bool{"192.168.172.13": true}
+	fakeCloudProvider.MockUnbatched = unbatched
+	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(fakekubeclient.NewSimpleClientset(), 0)
+	cloudNetworkInformerFactory := cloudnetworkinformers.NewSharedInformerFactory(fakeCloudNetworkClient, 0)
+	controller := NewCloudPrivateIPConfigController(
+		context.TODO(),
+		fakeCloudProvider,
+		fakeCloudNetworkClient,
+		cloudNetworkInformerFactory.Cloud().V1().CloudPrivateIPConfigs(),
+		kubeInformerFactory.Core().V1().Nodes(),
+		VerifyConfig{},
+		nil,
+		AuditConfig{},
+		nil,
+		nil,
+		100*time.Millisecond,
+		nil,
+	)
+	for _, cloudPrivateIPConfig := range cloudPrivateIPConfigs {
+		cloudNetworkInformerFactory.Cloud().V1().CloudPrivateIPConfigs().Informer().GetStore().Add(cloudPrivateIPConfig)
+	}
+	kubeInformerFactory.Core().V1().Nodes().Informer().GetStore().Add(&nodeA)
+
+	errs := make([]error, len(ips))
+	wg := &sync.WaitGroup{}
+	for i, ip := range ips {
+		wg.Add(1)
+		go func(i int, ip string) {
+			defer wg.Done()
+			errs[i] = controller.SyncHandler(context.TODO(), ip)
+		}(i, ip)
+	}
+	wg.Wait()
+	if errs[0] != nil || errs[1] == nil || errs[2] != nil {
+		t.Fatalf("expected only the assignment of 192.168.172.13 to fail, got: %v", errs)
+	}
+	assigned := append([]string{}, fakeCloudProvider.StateTracker...)
+	if unbatched {
+		for _, call := range assigned {
+			if strings.HasPrefix(call, "assign-batch-") {
+				t.Fatalf("expected the assignments not to be batched, got: %v", fakeCloudProvider.StateTracker)
+			}
+		}
+	} else {
+		if assigned[0] != "assign-batch-3-nodeA" {
+			t.Fatalf("expected the assignments to be sent in a single call, got: %v", fakeCloudProvider.StateTracker)
+		}
+		assigned = assigned[1:]
+	}
+	sort.Strings(assigned)
+	if err := assertStateEquals(assigned, []string{"assign-192.168.172.12-nodeA", "assign-192.168.172.13-nodeA", "assign-192.168.172.14-nodeA"}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"net"
 	"reflect"
 	"strings"
+	"sync"
+	"time"
 
 	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
 	cloudnetworkclientset "github.com/openshift/client-go/cloudnetwork/clientset/versioned"
@@ -15,21 +17,35 @@ import (
 	cloudnetworkinformers "github.com/openshift/client-go/cloudnetwork/informers/externalversions/cloudnetwork/v1"
 	cloudnetworklisters "github.com/openshift/client-go/cloudnetwork/listers/cloudnetwork/v1"
 	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	"github.com/openshift/cloud-network-config-controller/pkg/conditions"
 	controller "github.com/openshift/cloud-network-config-controller/pkg/controller"
+	"github.com/openshift/cloud-network-config-controller/pkg/maintenance"
+	"github.com/openshift/cloud-network-config-controller/pkg/notifier"
+	"github.com/openshift/cloud-network-config-controller/pkg/tracing"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/dynamic"
 	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/record"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
+// CloudPrivateIPConfigIPAnnotation holds the IP address of a
+// CloudPrivateIPConfig, as parsed from its name by the admission webhook.
+const CloudPrivateIPConfigIPAnnotation = "cloud.network.openshift.io/ip"
+
 var (
 	// cloudPrivateIPConfigControllerAgentType is the CloudPrivateIPConfig controller's dedicated resource type
 	cloudPrivateIPConfigControllerAgentType = reflect.TypeOf(&cloudnetworkv1.CloudPrivateIPConfig{})
@@ -38,12 +54,6 @@ var (
 	// cloudPrivateIPConfigFinalizer is the name of the finalizer blocking
 	// object deletion until the cloud confirms that the IP has been removed
 	cloudPrivateIPConfigFinalizer = "cloudprivateipconfig.cloud.network.openshift.io/finalizer"
-	// cloudResponseReasonPending indicates a pending response from the cloud API
-	cloudResponseReasonPending = "CloudResponsePending"
-	// cloudResponseReasonError indicates an error response from the cloud API
-	cloudResponseReasonError = "CloudResponseError"
-	// cloudResponseReasonSuccess indicates a successful response from the cloud API
-	cloudResponseReasonSuccess = "CloudResponseSuccess"
 )
 
 // CloudPrivateIPConfigController is the controller implementation for CloudPrivateIPConfig resources
@@ -55,6 +65,37 @@ type CloudPrivateIPConfigController struct {
 	// CloudProviderClient is a client interface allowing the controller
 	// access to the cloud API
 	cloudProviderClient cloudprovider.CloudProviderIntf
+	// verifyConfig configures the verification of successful assignments
+	verifyConfig VerifyConfig
+	// reservationClient records the CloudIPReservations, nil if disabled
+	reservationClient dynamic.Interface
+	// auditConfig configures the CloudIPAssignmentRecords, disabled if its
+	// client is nil
+	auditConfig AuditConfig
+	// notifier delivers the assignment lifecycle events, nil if disabled
+	notifier *notifier.Dispatcher
+	// eventRecorder records the assignment lifecycle as Kubernetes Events on
+	// the CloudPrivateIPConfigs and nodes, nil if disabled
+	eventRecorder record.EventRecorder
+	// maintenanceWindows defer the release of deleted CloudPrivateIPConfigs
+	// and soften the verification of assignments
+	maintenanceWindows maintenance.Windows
+	// nodeBatchWindow is how long assignments and releases wait for others
+	// to the same node, to be sent to the cloud provider at once, see batch.
+	// Disabled if 0.
+	nodeBatchWindow time.Duration
+	// batches are the pending batches of assignments and releases
+	batches nodeBatches
+	// repairs are the CloudPrivateIPConfigs the cloud state resync found
+	// missing on the cloud, see repairAssignment
+	repairs pendingRepairs
+	// reachabilityProbes are the pending reachability probes of the
+	// verified assignments, see enqueueReachabilityProbe
+	reachabilityProbes workqueue.Interface
+	reachabilityOnce   sync.Once
+	// enqueue adds a CloudPrivateIPConfig to the work queue, used to hand
+	// paired CloudPrivateIPConfigs over to their partner
+	enqueue func(obj interface{})
 	// controllerContext is the passed-down global context. It's used and passed
 	// down to all API client calls as to make sure all in-flight calls get
 	// cancelled if the main context is
@@ -67,7 +108,14 @@ func NewCloudPrivateIPConfigController(
 	cloudProviderClient cloudprovider.CloudProviderIntf,
 	cloudNetworkClientset cloudnetworkclientset.Interface,
 	cloudPrivateIPConfigInformer cloudnetworkinformers.CloudPrivateIPConfigInformer,
-	nodeInformer coreinformers.NodeInformer) *controller.CloudNetworkConfigController {
+	nodeInformer coreinformers.NodeInformer,
+	verifyConfig VerifyConfig,
+	reservationClient dynamic.Interface,
+	auditConfig AuditConfig,
+	notifier *notifier.Dispatcher,
+	maintenanceWindows maintenance.Windows,
+	nodeBatchWindow time.Duration,
+	eventRecorder record.EventRecorder) *controller.CloudNetworkConfigController {
 
 	utilruntime.Must(cloudnetworkscheme.AddToScheme(scheme.Scheme))
 
@@ -76,6 +124,13 @@ func NewCloudPrivateIPConfigController(
 		cloudProviderClient:        cloudProviderClient,
 		cloudNetworkClient:         cloudNetworkClientset,
 		cloudPrivateIPConfigLister: cloudPrivateIPConfigInformer.Lister(),
+		verifyConfig:               verifyConfig,
+		reservationClient:          reservationClient,
+		auditConfig:                auditConfig,
+		notifier:                   notifier,
+		maintenanceWindows:         maintenanceWindows,
+		nodeBatchWindow:            nodeBatchWindow,
+		eventRecorder:              eventRecorder,
 		ctx:                        controllerContext,
 	}
 	controller := controller.NewCloudNetworkConfigController(
@@ -84,12 +139,32 @@ func NewCloudPrivateIPConfigController(
 		cloudPrivateIPConfigControllerAgentName,
 		cloudPrivateIPConfigControllerAgentType,
 	)
+	controller.MaintenanceWindows = maintenanceWindows
+	controller.Store = cloudPrivateIPConfigInformer.Informer().GetStore()
+	controller.Resync = func() { cloudPrivateIPConfigController.resyncCloudState() }
+	controller.ResyncPeriod = verifyConfig.ResyncPeriod
+	cloudPrivateIPConfigController.enqueue = controller.Enqueue
+	if reservationClient != nil {
+		go cloudPrivateIPConfigController.runReservationReconciler(cloudPrivateIPConfigInformer.Informer().HasSynced, nodeInformer.Informer().HasSynced)
+	}
 
 	cloudPrivateIPConfigInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: controller.Enqueue,
+		AddFunc: func(obj interface{}) {
+			controller.Enqueue(obj)
+			cloudPrivateIPConfigController.enqueuePartner(obj)
+		},
 		UpdateFunc: func(old, new interface{}) {
 			oldCloudPrivateIPConfig, _ := old.(*cloudnetworkv1.CloudPrivateIPConfig)
 			newCloudPrivateIPConfig, _ := new.(*cloudnetworkv1.CloudPrivateIPConfig)
+			// Let the partner of a paired object re-evaluate the pair on any
+			// change relevant to it.
+			if !reflect.DeepEqual(oldCloudPrivateIPConfig.Spec, newCloudPrivateIPConfig.Spec) ||
+				oldCloudPrivateIPConfig.Status.Node != newCloudPrivateIPConfig.Status.Node ||
+				oldCloudPrivateIPConfig.DeletionTimestamp.IsZero() != newCloudPrivateIPConfig.DeletionTimestamp.IsZero() ||
+				oldCloudPrivateIPConfig.Annotations[DualStackPairAnnotation] != newCloudPrivateIPConfig.Annotations[DualStackPairAnnotation] {
+				cloudPrivateIPConfigController.enqueuePartner(old)
+				cloudPrivateIPConfigController.enqueuePartner(new)
+			}
 			// Enqueue consumer updates and deletion. Given the presence of our
 			// finalizer a delete action will be treated as an update before our
 			// finalizer is removed, once the finalizer has been removed by this
@@ -113,7 +188,10 @@ func NewCloudPrivateIPConfigController(
 				controller.Enqueue(new)
 			}
 		},
-		DeleteFunc: controller.Enqueue,
+		DeleteFunc: func(obj interface{}) {
+			controller.Enqueue(obj)
+			cloudPrivateIPConfigController.enqueuePartner(obj)
+		},
 	})
 	return controller
 }
@@ -135,7 +213,7 @@ func NewCloudPrivateIPConfigController(
 // - If we could update both, we don't resync the object
 
 // Note: that we don't retry re-syncing relentlessly, we finally give up after
-// maxRetries (defined in controller.go).
+// RetryPolicy.MaxRetries (see controller.go).
 
 //  Here's a schema of CloudPrivateIPConfig's reconciliation loop based on the consumer input:
 
@@ -162,10 +240,13 @@ func NewCloudPrivateIPConfigController(
 
 // Consumer should only consider ADD / UPDATE successful when:
 // - 	spec.node == status.node && status.conditions[0].Status == Success
-func (c *CloudPrivateIPConfigController) SyncHandler(key string) error {
+func (c *CloudPrivateIPConfigController) SyncHandler(ctx context.Context, key string) error {
 	var status *cloudnetworkv1.CloudPrivateIPConfigStatus
+	// Carry on the trace of the sync on the controller's context, for the
+	// requests to the API server to be cancelled on shutdown.
+	ctx = trace.ContextWithSpan(c.ctx, trace.SpanFromContext(ctx))
 
-	cloudPrivateIPConfig, err := c.getCloudPrivateIPConfig(key)
+	cloudPrivateIPConfig, err := c.getCloudPrivateIPConfig(ctx, key)
 	if err != nil {
 		return err
 	}
@@ -175,14 +256,21 @@ func (c *CloudPrivateIPConfigController) SyncHandler(key string) error {
 		return nil
 	}
 
-	ip := cloudPrivateIPConfigNameToIP(cloudPrivateIPConfig.Name)
+	ip := CloudPrivateIPConfigNameToIP(cloudPrivateIPConfig.Name)
 
 	// At most one of nodeNameToAdd or nodeNameToDel will be set
 	nodeNameToAdd, nodeNameToDel := c.computeOp(cloudPrivateIPConfig)
+	// Dequeue on NOOP, there's nothing to do, unless the assignment went
+	// missing on the cloud
+	if nodeNameToAdd == "" && nodeNameToDel == "" {
+		return c.repairAssignment(ctx, cloudPrivateIPConfig, ip)
+	}
+	// Paired objects are assigned and released along with their partner.
+	partner, wait, err := c.syncPair(ctx, cloudPrivateIPConfig, nodeNameToAdd, nodeNameToDel)
+	if wait {
+		return err
+	}
 	switch {
-	// Dequeue on NOOP, there's nothing to do
-	case nodeNameToAdd == "" && nodeNameToDel == "":
-		return nil
 	case nodeNameToAdd != "" && nodeNameToDel != "":
 		klog.Infof("CloudPrivateIPConfig: %q will be moved from node %q to node %q", key, nodeNameToDel, nodeNameToAdd)
 		nodeToDel, err := c.nodesLister.Get(nodeNameToDel)
@@ -194,48 +282,45 @@ func (c *CloudPrivateIPConfigController) SyncHandler(key string) error {
 			return err
 		}
 
-		status = &cloudnetworkv1.CloudPrivateIPConfigStatus{
-			Node: nodeNameToDel,
-			Conditions: []metav1.Condition{
-				{
-					Type:               string(cloudnetworkv1.Assigned),
-					Status:             metav1.ConditionUnknown,
-					ObservedGeneration: cloudPrivateIPConfig.Generation,
-					LastTransitionTime: metav1.Now(),
-					Reason:             cloudResponseReasonPending,
-					Message:            "Moving IP address",
-				},
-			},
-		}
-		if cloudPrivateIPConfig, err = c.updateCloudPrivateIPConfigStatus(cloudPrivateIPConfig, status); err != nil {
+		status = newAssignedStatus(cloudPrivateIPConfig, nodeNameToDel, metav1.ConditionUnknown, conditions.ReasonCloudResponsePending, "Moving IP address")
+		if cloudPrivateIPConfig, err = c.updateCloudPrivateIPConfigStatus(ctx, cloudPrivateIPConfig, status); err != nil {
 			return fmt.Errorf("error updating CloudPrivateIPConfig: %q during move operation, err: %v", key, err)
 		}
+		c.recordEvent(cloudPrivateIPConfig, corev1.EventTypeNormal, EventReasonMoveStarted, fmt.Sprintf("Moving IP address %s from node %s to node %s", ip, nodeNameToDel, nodeNameToAdd), nodeNameToDel, nodeNameToAdd)
 
 		// This is a blocking call. If the IP is not assigned then don't treat
 		// it as an error.
-		if moveErr := c.cloudProviderClient.MovePrivateIP(ip, nodeToAdd, nodeToDel); moveErr != nil && !errors.Is(moveErr, cloudprovider.NonExistingIPError) {
+		cloudCtx, span := startCloudSpan(ctx, "MovePrivateIP", ip, nodeToAdd, nodeToDel)
+		moveErr := c.cloudProviderClient.MovePrivateIP(cloudCtx, ip, nodeToAdd, nodeToDel)
+		tracing.End(span, moveErr)
+		if errors.Is(moveErr, cloudprovider.ReadOnlyError) {
+			// Report the planned move, retrying won't change anything.
+			status = newAssignedStatus(cloudPrivateIPConfig, nodeNameToDel, metav1.ConditionFalse, conditions.ReasonReadOnly, moveErr.Error())
+			c.notify(notifier.EventPlanned, cloudPrivateIPConfig, ip, nodeNameToAdd, moveErr.Error())
+			c.recordEvent(cloudPrivateIPConfig, corev1.EventTypeNormal, EventReasonPlanned, moveErr.Error(), nodeNameToDel, nodeNameToAdd)
+			_, err = c.updateCloudPrivateIPConfigStatus(ctx, cloudPrivateIPConfig, status)
+			return err
+		}
+		if moveErr != nil && !errors.Is(moveErr, cloudprovider.NonExistingIPError) {
 			// Move operation encountered an error, requeue
-			status = &cloudnetworkv1.CloudPrivateIPConfigStatus{
-				Node: nodeNameToDel,
-				Conditions: []metav1.Condition{
-					{
-						Type:               string(cloudnetworkv1.Assigned),
-						Status:             metav1.ConditionFalse,
-						ObservedGeneration: cloudPrivateIPConfig.Generation,
-						LastTransitionTime: metav1.Now(),
-						Reason:             cloudResponseReasonError,
-						Message:            fmt.Sprintf("Error processing cloud move request, err: %v", moveErr),
-					},
-				},
-			}
+			status = newAssignedStatus(cloudPrivateIPConfig, nodeNameToDel, metav1.ConditionFalse, conditions.ReasonCloudResponseError, cloudprovider.WithRemediationHint(fmt.Sprintf("Error processing cloud move request, err: %v", moveErr), moveErr))
+			c.recordEvent(cloudPrivateIPConfig, corev1.EventTypeWarning, EventReasonMoveFailed, cloudprovider.WithRemediationHint(fmt.Sprintf("Error moving IP address %s from node %s to node %s, err: %v", ip, nodeNameToDel, nodeNameToAdd, moveErr), moveErr), nodeNameToDel, nodeNameToAdd)
 			// Always requeue the object if we end up here. We need to make sure
 			// we try to clean up the IP on the cloud
-			if cloudPrivateIPConfig, err = c.updateCloudPrivateIPConfigStatus(cloudPrivateIPConfig, status); err != nil {
+			if cloudPrivateIPConfig, err = c.updateCloudPrivateIPConfigStatus(ctx, cloudPrivateIPConfig, status); err != nil {
 				return fmt.Errorf("error updating CloudPrivateIPConfig: %q status for error releasing cloud assignment, err: %v", key, err)
 			}
 			return fmt.Errorf("error moving CloudPrivateIPConfig: %q from node %q to %q, err: %v", key, nodeNameToDel, nodeNameToAdd, moveErr)
 		}
 
+		// The IP address is on the new node now, the pending status set
+		// above must not be left behind on the old one.
+		status = newAssignedStatus(cloudPrivateIPConfig, nodeNameToAdd, metav1.ConditionTrue, conditions.ReasonCloudResponseSuccess, "IP address successfully moved")
+		status = c.verifyAssignment(ctx, cloudPrivateIPConfig, status, ip, nodeToAdd)
+		c.recordReservation(cloudPrivateIPConfig, ip, nodeToAdd)
+		c.recordAssignment(cloudPrivateIPConfig, ip, AssignmentOperationMove, nodeNameToDel, nodeNameToAdd)
+		c.notify(notifier.EventAssigned, cloudPrivateIPConfig, ip, nodeNameToAdd, fmt.Sprintf("IP address moved from node %s", nodeNameToDel))
+		c.recordEvent(cloudPrivateIPConfig, corev1.EventTypeNormal, EventReasonMoved, fmt.Sprintf("IP address %s moved from node %s to node %s", ip, nodeNameToDel, nodeNameToAdd), nodeNameToDel, nodeNameToAdd)
 		klog.Infof("Moved IP address from node %q to %q for CloudPrivateIPConfig: %q", nodeNameToDel, nodeNameToAdd, key)
 	case nodeNameToDel != "":
 		klog.Infof("CloudPrivateIPConfig: %q will be deleted from node: %q", key, nodeNameToDel)
@@ -245,49 +330,55 @@ func (c *CloudPrivateIPConfigController) SyncHandler(key string) error {
 			return err
 		}
 
+		// Releasing the IP address of a deleted object isn't urgent, unlike
+		// releasing it to move it to another node.
+		if end, ok := c.maintenanceWindows.Active(time.Now()); ok && !cloudPrivateIPConfig.DeletionTimestamp.IsZero() {
+			status = newAssignedStatus(cloudPrivateIPConfig, nodeNameToDel, metav1.ConditionUnknown, conditions.ReasonMaintenanceWindow, fmt.Sprintf("Release deferred until the end of the cloud maintenance window at %s", end.Format(time.RFC3339)))
+			if _, err = c.updateCloudPrivateIPConfigStatus(ctx, cloudPrivateIPConfig, status); err != nil {
+				return fmt.Errorf("error updating CloudPrivateIPConfig: %q during delete operation, err: %v", key, err)
+			}
+			return &controller.DeferredError{Until: end, Reason: fmt.Sprintf("release of CloudPrivateIPConfig: %q during a cloud maintenance window", key)}
+		}
+
 		// This is step 1. in the docbloc for the DELETE operation in the
 		// syncHandler
-		status = &cloudnetworkv1.CloudPrivateIPConfigStatus{
-			Node: nodeNameToDel,
-			Conditions: []metav1.Condition{
-				{
-					Type:               string(cloudnetworkv1.Assigned),
-					Status:             metav1.ConditionUnknown,
-					ObservedGeneration: cloudPrivateIPConfig.Generation,
-					LastTransitionTime: metav1.Now(),
-					Reason:             cloudResponseReasonPending,
-					Message:            "Deleting IP address",
-				},
-			},
-		}
-		if cloudPrivateIPConfig, err = c.updateCloudPrivateIPConfigStatus(cloudPrivateIPConfig, status); err != nil {
+		status = newAssignedStatus(cloudPrivateIPConfig, nodeNameToDel, metav1.ConditionUnknown, conditions.ReasonCloudResponsePending, "Deleting IP address")
+		if cloudPrivateIPConfig, err = c.updateCloudPrivateIPConfigStatus(ctx, cloudPrivateIPConfig, status); err != nil {
 			return fmt.Errorf("error updating CloudPrivateIPConfig: %q during delete operation, err: %v", key, err)
 		}
+		c.recordEvent(cloudPrivateIPConfig, corev1.EventTypeNormal, EventReasonReleaseStarted, fmt.Sprintf("Releasing IP address %s from node %s", ip, nodeNameToDel), nodeNameToDel)
 
 		// This is a blocking call. If the IP is not assigned then don't treat
-		// it as an error.
-		if releaseErr := c.cloudProviderClient.ReleasePrivateIP(ip, node); releaseErr != nil && !errors.Is(releaseErr, cloudprovider.NonExistingIPError) {
+		// it as an error. Neither in read-only mode: we never assigned it in
+		// the first place and must not block the object's deletion.
+		releaseErr := c.releasePrivateIP(ctx, ip, node)
+		if releaseErr != nil && !errors.Is(releaseErr, cloudprovider.NonExistingIPError) && !errors.Is(releaseErr, cloudprovider.ReadOnlyError) {
 			// Delete operation encountered an error, requeue
-			status = &cloudnetworkv1.CloudPrivateIPConfigStatus{
-				Node: nodeNameToDel,
-				Conditions: []metav1.Condition{
-					{
-						Type:               string(cloudnetworkv1.Assigned),
-						Status:             metav1.ConditionFalse,
-						ObservedGeneration: cloudPrivateIPConfig.Generation,
-						LastTransitionTime: metav1.Now(),
-						Reason:             cloudResponseReasonError,
-						Message:            fmt.Sprintf("Error processing cloud release request, err: %v", releaseErr),
-					},
-				},
-			}
+			status = newAssignedStatus(cloudPrivateIPConfig, nodeNameToDel, metav1.ConditionFalse, conditions.ReasonCloudResponseError, cloudprovider.WithRemediationHint(fmt.Sprintf("Error processing cloud release request, err: %v", releaseErr), releaseErr))
+			c.recordEvent(cloudPrivateIPConfig, corev1.EventTypeWarning, EventReasonReleaseFailed, cloudprovider.WithRemediationHint(fmt.Sprintf("Error releasing IP address %s from node %s, err: %v", ip, nodeNameToDel, releaseErr), releaseErr), nodeNameToDel)
 			// Always requeue the object if we end up here. We need to make sure
 			// we try to clean up the IP on the cloud
-			if cloudPrivateIPConfig, err = c.updateCloudPrivateIPConfigStatus(cloudPrivateIPConfig, status); err != nil {
+			if cloudPrivateIPConfig, err = c.updateCloudPrivateIPConfigStatus(ctx, cloudPrivateIPConfig, status); err != nil {
 				return fmt.Errorf("error updating CloudPrivateIPConfig: %q status for error releasing cloud assignment, err: %v", key, err)
 			}
 			return fmt.Errorf("error releasing CloudPrivateIPConfig: %q from node: %q, err: %v", key, node.Name, releaseErr)
 		}
+		c.deleteReservation(cloudPrivateIPConfig)
+		c.recordAssignment(cloudPrivateIPConfig, ip, AssignmentOperationRelease, nodeNameToDel, "")
+		if errors.Is(releaseErr, cloudprovider.ReadOnlyError) {
+			c.notify(notifier.EventPlanned, cloudPrivateIPConfig, ip, nodeNameToDel, releaseErr.Error())
+			c.recordEvent(cloudPrivateIPConfig, corev1.EventTypeNormal, EventReasonPlanned, releaseErr.Error(), nodeNameToDel)
+		} else {
+			c.notify(notifier.EventReleased, cloudPrivateIPConfig, ip, nodeNameToDel, "IP address released")
+			c.recordEvent(cloudPrivateIPConfig, corev1.EventTypeNormal, EventReasonReleased, fmt.Sprintf("IP address %s released from node %s", ip, nodeNameToDel), nodeNameToDel)
+		}
+		if partner != nil {
+			// The partner retries releasing itself alone if this fails.
+			if err := c.releasePartner(ctx, partner, node); err != nil {
+				klog.Errorf("Error releasing the pair of CloudPrivateIPConfig: %q, err: %v", key, err)
+				c.enqueue(partner)
+			}
+		}
 
 		// Process real object deletion. We're using a finalizer, so it depends
 		// on this controller whether the object is finally deleted and removed
@@ -301,45 +392,22 @@ func (c *CloudPrivateIPConfigController) SyncHandler(key string) error {
 				// it down below
 				controllerutil.RemoveFinalizer(cloudPrivateIPConfig, cloudPrivateIPConfigFinalizer)
 				klog.Infof("Cleaning up IP address and finalizer for CloudPrivateIPConfig: %q, deleting it completely", key)
-				_, err = c.patchCloudPrivateIPConfigFinalizer(cloudPrivateIPConfig)
+				_, err = c.patchCloudPrivateIPConfigFinalizer(ctx, cloudPrivateIPConfig)
 				return err
 			}
 		}
 
 		// Update the status one last time, informing consumers of this status
 		// that we've successfully delete the IP in the cloud
-		status = &cloudnetworkv1.CloudPrivateIPConfigStatus{
-			Conditions: []metav1.Condition{
-				{
-					Type:               string(cloudnetworkv1.Assigned),
-					Status:             metav1.ConditionTrue,
-					ObservedGeneration: cloudPrivateIPConfig.Generation,
-					LastTransitionTime: metav1.Now(),
-					Reason:             cloudResponseReasonSuccess,
-					Message:            "IP address successfully deleted",
-				},
-			},
-		}
+		status = newAssignedStatus(cloudPrivateIPConfig, "", metav1.ConditionTrue, conditions.ReasonCloudResponseSuccess, "IP address successfully deleted")
 		klog.Infof("Deleted IP address from node: %q for CloudPrivateIPConfig: %q", node.Name, key)
 	case nodeNameToAdd != "":
 		klog.Infof("CloudPrivateIPConfig: %q will be added to node: %q", key, nodeNameToAdd)
 
 		// This is step 1. in the docbloc for the ADD operation in the
 		// syncHandler
-		status = &cloudnetworkv1.CloudPrivateIPConfigStatus{
-			Node: nodeNameToAdd,
-			Conditions: []metav1.Condition{
-				{
-					Type:               string(cloudnetworkv1.Assigned),
-					Status:             metav1.ConditionUnknown,
-					ObservedGeneration: cloudPrivateIPConfig.Generation,
-					LastTransitionTime: metav1.Now(),
-					Reason:             cloudResponseReasonPending,
-					Message:            "Adding IP address",
-				},
-			},
-		}
-		if cloudPrivateIPConfig, err = c.updateCloudPrivateIPConfigStatus(cloudPrivateIPConfig, status); err != nil {
+		status = newAssignedStatus(cloudPrivateIPConfig, nodeNameToAdd, metav1.ConditionUnknown, conditions.ReasonCloudResponsePending, "Adding IP address")
+		if cloudPrivateIPConfig, err = c.updateCloudPrivateIPConfigStatus(ctx, cloudPrivateIPConfig, status); err != nil {
 			return fmt.Errorf("error updating CloudPrivateIPConfig: %q, err: %v", key, err)
 		}
 
@@ -354,10 +422,11 @@ func (c *CloudPrivateIPConfigController) SyncHandler(key string) error {
 			// +kubebuilder:subresource:status on the CRD marking the status as
 			// impossible to update for anything/anyone else except for this
 			// controller.
-			if cloudPrivateIPConfig, err = c.patchCloudPrivateIPConfigFinalizer(cloudPrivateIPConfig); err != nil {
+			if cloudPrivateIPConfig, err = c.patchCloudPrivateIPConfigFinalizer(ctx, cloudPrivateIPConfig); err != nil {
 				return fmt.Errorf("error updating CloudPrivateIPConfig: %q, err: %v", key, err)
 			}
 		}
+		c.recordEvent(cloudPrivateIPConfig, corev1.EventTypeNormal, EventReasonAssignStarted, fmt.Sprintf("Assigning IP address %s to node %s", ip, nodeNameToAdd), nodeNameToAdd)
 
 		node, err := c.nodesLister.Get(nodeNameToAdd)
 		if err != nil {
@@ -367,23 +436,32 @@ func (c *CloudPrivateIPConfigController) SyncHandler(key string) error {
 		// This is a blocking call. If the IP is assigned (for ex: in case we
 		// were killed during the last sync but managed sending the cloud
 		// request away prior to that) then don't treat it as an error.
-		if assignErr := c.cloudProviderClient.AssignPrivateIP(ip, node); assignErr != nil && !errors.Is(assignErr, cloudprovider.AlreadyExistingIPError) {
+		assignErr := c.assignPrivateIP(ctx, ip, node)
+		if partner != nil && (assignErr == nil || errors.Is(assignErr, cloudprovider.AlreadyExistingIPError)) {
+			assignErr = c.assignPartner(ctx, partner, ip, node)
+		}
+		if errors.Is(assignErr, cloudprovider.ReadOnlyError) {
+			// Report the planned assignment, retrying won't change anything.
+			status = newAssignedStatus(cloudPrivateIPConfig, nodeNameToAdd, metav1.ConditionFalse, conditions.ReasonReadOnly, assignErr.Error())
+			c.notify(notifier.EventPlanned, cloudPrivateIPConfig, ip, nodeNameToAdd, assignErr.Error())
+			c.recordEvent(cloudPrivateIPConfig, corev1.EventTypeNormal, EventReasonPlanned, assignErr.Error(), nodeNameToAdd)
+			_, err = c.updateCloudPrivateIPConfigStatus(ctx, cloudPrivateIPConfig, status)
+			return err
+		}
+		if errors.Is(assignErr, cloudprovider.ZoneMismatchError) {
+			// Retrying won't change anything either, the IP address must be
+			// assigned to a node of another zone.
+			status = newAssignedStatus(cloudPrivateIPConfig, nodeNameToAdd, metav1.ConditionFalse, conditions.ReasonZoneMismatch, assignErr.Error())
+			c.recordEvent(cloudPrivateIPConfig, corev1.EventTypeWarning, EventReasonAssignFailed, assignErr.Error(), nodeNameToAdd)
+			_, err = c.updateCloudPrivateIPConfigStatus(ctx, cloudPrivateIPConfig, status)
+			return err
+		}
+		if assignErr != nil && !errors.Is(assignErr, cloudprovider.AlreadyExistingIPError) {
 			// If we couldn't even execute the assign request, set the status to
 			// failed.
-			status = &cloudnetworkv1.CloudPrivateIPConfigStatus{
-				Node: nodeNameToAdd,
-				Conditions: []metav1.Condition{
-					{
-						Type:               string(cloudnetworkv1.Assigned),
-						Status:             metav1.ConditionFalse,
-						ObservedGeneration: cloudPrivateIPConfig.Generation,
-						LastTransitionTime: metav1.Now(),
-						Reason:             cloudResponseReasonError,
-						Message:            fmt.Sprintf("Error processing cloud assignment request, err: %v", assignErr),
-					},
-				},
-			}
-			if cloudPrivateIPConfig, err = c.updateCloudPrivateIPConfigStatus(cloudPrivateIPConfig, status); err != nil {
+			status = newAssignedStatus(cloudPrivateIPConfig, nodeNameToAdd, metav1.ConditionFalse, conditions.ReasonCloudResponseError, cloudprovider.WithRemediationHint(fmt.Sprintf("Error processing cloud assignment request, err: %v", assignErr), assignErr))
+			c.recordEvent(cloudPrivateIPConfig, corev1.EventTypeWarning, EventReasonAssignFailed, cloudprovider.WithRemediationHint(fmt.Sprintf("Error assigning IP address %s to node %s, err: %v", ip, nodeNameToAdd, assignErr), assignErr), nodeNameToAdd)
+			if cloudPrivateIPConfig, err = c.updateCloudPrivateIPConfigStatus(ctx, cloudPrivateIPConfig, status); err != nil {
 				return fmt.Errorf("error updating CloudPrivateIPConfig: %q status for error issuing cloud assignment, err: %v", key, err)
 			}
 			return fmt.Errorf("error assigning CloudPrivateIPConfig: %q to node: %q, err: %v", key, node.Name, assignErr)
@@ -391,31 +469,46 @@ func (c *CloudPrivateIPConfigController) SyncHandler(key string) error {
 
 		// Add occurred and no error was encountered, keep status.node from
 		// above
-		status = &cloudnetworkv1.CloudPrivateIPConfigStatus{
-			Node: nodeNameToAdd,
-			Conditions: []metav1.Condition{
-				{
-					Type:               string(cloudnetworkv1.Assigned),
-					Status:             metav1.ConditionTrue,
-					ObservedGeneration: cloudPrivateIPConfig.Generation,
-					LastTransitionTime: metav1.Now(),
-					Reason:             cloudResponseReasonSuccess,
-					Message:            "IP address successfully added",
-				},
-			},
-		}
+		status = newAssignedStatus(cloudPrivateIPConfig, nodeNameToAdd, metav1.ConditionTrue, conditions.ReasonCloudResponseSuccess, "IP address successfully added")
+		status = c.verifyAssignment(ctx, cloudPrivateIPConfig, status, ip, node)
+		c.recordReservation(cloudPrivateIPConfig, ip, node)
+		c.recordAssignment(cloudPrivateIPConfig, ip, AssignmentOperationAssign, "", nodeNameToAdd)
+		c.notify(notifier.EventAssigned, cloudPrivateIPConfig, ip, nodeNameToAdd, "IP address assigned")
+		c.recordEvent(cloudPrivateIPConfig, corev1.EventTypeNormal, EventReasonAssigned, fmt.Sprintf("IP address %s assigned to node %s", ip, nodeNameToAdd), nodeNameToAdd)
 		klog.Infof("Added IP address to node: %q for CloudPrivateIPConfig: %q", node.Name, key)
 	}
-	_, err = c.updateCloudPrivateIPConfigStatus(cloudPrivateIPConfig, status)
+	_, err = c.updateCloudPrivateIPConfigStatus(ctx, cloudPrivateIPConfig, status)
 	return err
 }
 
+// notify fires an assignment lifecycle event for cloudPrivateIPConfig.
+func (c *CloudPrivateIPConfigController) notify(eventType notifier.EventType, cloudPrivateIPConfig *cloudnetworkv1.CloudPrivateIPConfig, ip net.IP, node, message string) {
+	c.notifier.Notify(notifier.Event{
+		Type:    eventType,
+		Object:  cloudPrivateIPConfig.Name,
+		IP:      ip.String(),
+		Node:    node,
+		Message: message,
+	})
+}
+
+// newAssignedStatus returns the status assigning the IP to node, with the
+// Assigned condition set on top of the object's current conditions. Any
+// Verified condition is dropped, since it refers to a previous assignment.
+func newAssignedStatus(cloudPrivateIPConfig *cloudnetworkv1.CloudPrivateIPConfig, node string, status metav1.ConditionStatus, reason, message string) *cloudnetworkv1.CloudPrivateIPConfigStatus {
+	return &cloudnetworkv1.CloudPrivateIPConfigStatus{
+		Node: node,
+		Conditions: conditions.Set(conditions.KindCloudPrivateIPConfig, conditions.Remove(cloudPrivateIPConfig.Status.Conditions, conditions.Verified),
+			conditions.New(conditions.Assigned, status, cloudPrivateIPConfig.Generation, reason, message)),
+	}
+}
+
 // updateCloudPrivateIPConfigStatus copies and updates the provided object and returns
 // the new object. The return value can be useful for recursive updates
-func (c *CloudPrivateIPConfigController) updateCloudPrivateIPConfigStatus(cloudPrivateIPConfig *cloudnetworkv1.CloudPrivateIPConfig, status *cloudnetworkv1.CloudPrivateIPConfigStatus) (*cloudnetworkv1.CloudPrivateIPConfig, error) {
+func (c *CloudPrivateIPConfigController) updateCloudPrivateIPConfigStatus(ctx context.Context, cloudPrivateIPConfig *cloudnetworkv1.CloudPrivateIPConfig, status *cloudnetworkv1.CloudPrivateIPConfigStatus) (*cloudnetworkv1.CloudPrivateIPConfig, error) {
 	updatedCloudPrivateIPConfig := &cloudnetworkv1.CloudPrivateIPConfig{}
 	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		ctx, cancel := context.WithTimeout(c.ctx, controller.ClientTimeout)
+		ctx, cancel := context.WithTimeout(ctx, controller.ClientTimeout)
 		defer cancel()
 		var err error
 		cloudPrivateIPConfig.Status = *status
@@ -433,7 +526,7 @@ type FinalizerPatch struct {
 
 // patchCloudPrivateIPConfigFinalizer patches the object and returns
 // the new object. The return value can be useful for recursive updates
-func (c *CloudPrivateIPConfigController) patchCloudPrivateIPConfigFinalizer(cloudPrivateIPConfig *cloudnetworkv1.CloudPrivateIPConfig) (*cloudnetworkv1.CloudPrivateIPConfig, error) {
+func (c *CloudPrivateIPConfigController) patchCloudPrivateIPConfigFinalizer(ctx context.Context, cloudPrivateIPConfig *cloudnetworkv1.CloudPrivateIPConfig) (*cloudnetworkv1.CloudPrivateIPConfig, error) {
 	patchedCloudPrivateIPConfig := &cloudnetworkv1.CloudPrivateIPConfig{}
 	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
 		p := []FinalizerPatch{
@@ -447,21 +540,21 @@ func (c *CloudPrivateIPConfigController) patchCloudPrivateIPConfigFinalizer(clou
 		if err != nil {
 			return fmt.Errorf("error serializing finalizer patch: %+v for CloudPrivateIPConfig: %s, err: %v", cloudPrivateIPConfig.Finalizers, cloudPrivateIPConfig.Name, err)
 		}
-		patchedCloudPrivateIPConfig, err = c.patchCloudPrivateIPConfig(cloudPrivateIPConfig.Name, op)
+		patchedCloudPrivateIPConfig, err = c.patchCloudPrivateIPConfig(ctx, cloudPrivateIPConfig.Name, op)
 		return err
 	})
 	return patchedCloudPrivateIPConfig, err
 }
 
-func (c *CloudPrivateIPConfigController) patchCloudPrivateIPConfig(name string, patchData []byte) (*cloudnetworkv1.CloudPrivateIPConfig, error) {
-	ctx, cancel := context.WithTimeout(c.ctx, controller.ClientTimeout)
+func (c *CloudPrivateIPConfigController) patchCloudPrivateIPConfig(ctx context.Context, name string, patchData []byte) (*cloudnetworkv1.CloudPrivateIPConfig, error) {
+	ctx, cancel := context.WithTimeout(ctx, controller.ClientTimeout)
 	defer cancel()
 	return c.cloudNetworkClient.CloudV1().CloudPrivateIPConfigs().Patch(ctx, name, types.JSONPatchType, patchData, metav1.PatchOptions{})
 }
 
 // getCloudPrivateIPConfig retrieves the object from the API server
-func (c *CloudPrivateIPConfigController) getCloudPrivateIPConfig(name string) (*cloudnetworkv1.CloudPrivateIPConfig, error) {
-	ctx, cancel := context.WithTimeout(c.ctx, controller.ClientTimeout)
+func (c *CloudPrivateIPConfigController) getCloudPrivateIPConfig(ctx context.Context, name string) (*cloudnetworkv1.CloudPrivateIPConfig, error) {
+	ctx, cancel := context.WithTimeout(ctx, controller.ClientTimeout)
 	defer cancel()
 	// This object will repeatedly be updated during this sync, hence we need to
 	// retrieve the object from the API server as opposed to the informer cache
@@ -488,22 +581,23 @@ func (c *CloudPrivateIPConfigController) computeOp(cloudPrivateIPConfig *cloudne
 	}
 	// If status and spec are different, delete the current object; we'll add it back with
 	// the updated value in the next sync; or attempt to move it if driver allows that;
+	// Paired objects are never moved, that would move them one after the other.
 	if cloudPrivateIPConfig.Spec.Node != cloudPrivateIPConfig.Status.Node && cloudPrivateIPConfig.Status.Node != "" {
-		if c.cloudProviderClient.AllowsMovePrivateIP() {
+		if c.cloudProviderClient.AllowsMovePrivateIP() && !isPaired(cloudPrivateIPConfig) {
 			return cloudPrivateIPConfig.Spec.Node, cloudPrivateIPConfig.Status.Node
 		} else {
 			return "", cloudPrivateIPConfig.Status.Node
 		}
 	}
 	// Add if the status is un-assigned or if the status is marked failed
-	if cloudPrivateIPConfig.Status.Node == "" || cloudPrivateIPConfig.Status.Conditions[0].Status != metav1.ConditionTrue {
+	if cloudPrivateIPConfig.Status.Node == "" || !meta.IsStatusConditionTrue(cloudPrivateIPConfig.Status.Conditions, conditions.Assigned) {
 		return cloudPrivateIPConfig.Spec.Node, ""
 	}
 	// Default to NOOP
 	return "", ""
 }
 
-// cloudPrivateIPConfigNameToIP converts the resource name to net.IP. Given a
+// CloudPrivateIPConfigNameToIP converts the resource name to net.IP. Given a
 // limitation in the Kubernetes API server (see:
 // https://github.com/kubernetes/kubernetes/pull/100950)
 // CloudPrivateIPConfig.metadata.name cannot represent an IPv6 address. To
@@ -515,7 +609,11 @@ func (c *CloudPrivateIPConfigController) computeOp(cloudPrivateIPConfig *cloudne
 // as: fc00.f853.0ccd.e793.0000.0000.0000.0054
 
 // We thus need to replace every fifth character's dot with a colon.
-func cloudPrivateIPConfigNameToIP(name string) net.IP {
+//
+// Names are parsed strictly, with net.ParseIP: the lenient
+// cloudprovider.ParseIP would read e.g. 010.0.0.1 as 10.0.0.1, so that two
+// CloudPrivateIPConfigs could claim the same IP address (CVE-2021-29923).
+func CloudPrivateIPConfigNameToIP(name string) net.IP {
 	// handle IPv4: this is enough since it will be serialized just fine
 	if ip := net.ParseIP(name); ip != nil {
 		return ip
@@ -524,3 +622,18 @@ func cloudPrivateIPConfigNameToIP(name string) net.IP {
 	name = strings.ReplaceAll(name, ".", ":")
 	return net.ParseIP(name)
 }
+
+// CloudPrivateIPConfigIPToName is the inverse of CloudPrivateIPConfigNameToIP:
+// it returns the canonical name of the CloudPrivateIPConfig of the IP address,
+// i.e. the IP address itself for IPv4 and the fully expanded IPv6 address with
+// dots instead of colons, ex: fc00.f853.0ccd.e793.0000.0000.0000.0054
+func CloudPrivateIPConfigIPToName(ip net.IP) string {
+	if ip.To4() != nil {
+		return ip.String()
+	}
+	groups := make([]string, 0, net.IPv6len/2)
+	for i := 0; i < net.IPv6len; i += 2 {
+		groups = append(groups, fmt.Sprintf("%02x%02x", ip[i], ip[i+1]))
+	}
+	return strings.Join(groups, ".")
+}
@@ -12,6 +12,7 @@ import (
 	fakecloudnetworkclientset "github.com/openshift/client-go/cloudnetwork/clientset/versioned/fake"
 	cloudnetworkinformers "github.com/openshift/client-go/cloudnetwork/informers/externalversions"
 	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	"github.com/openshift/cloud-network-config-controller/pkg/conditions"
 	controller "github.com/openshift/cloud-network-config-controller/pkg/controller"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -45,6 +46,13 @@ func NewFakeRacyCloudPrivateIPConfigController(delayCompletion time.Duration) *F
 		fakeCloudNetworkClient,
 		cloudNetworkInformerFactory.Cloud().V1().CloudPrivateIPConfigs(),
 		kubeInformerFactory.Core().V1().Nodes(),
+		VerifyConfig{},
+		nil,
+		AuditConfig{},
+		nil,
+		nil,
+		0,
+		nil,
 	)
 
 	fakeCloudPrivateIPConfigController := &FakeRacyCloudPrivateIPConfigController{
@@ -97,7 +105,7 @@ func TestDelayedCompletionWithCoalescedUpdatesBeforeFirstCreateOperationFinishes
 				{
 					Type:   string(cloudnetworkv1.Assigned),
 					Status: v1.ConditionTrue,
-					Reason: cloudResponseReasonSuccess,
+					Reason: conditions.ReasonCloudResponseSuccess,
 				},
 			},
 		},
@@ -193,7 +201,7 @@ func TestDelayedCompletionWithCoalescedUpdatesAfterFirstCreateOperationFinishes(
 				{
 					Type:   string(cloudnetworkv1.Assigned),
 					Status: v1.ConditionTrue,
-					Reason: cloudResponseReasonSuccess,
+					Reason: conditions.ReasonCloudResponseSuccess,
 				},
 			},
 		},
@@ -291,7 +299,7 @@ func TestDelayedCompletionWithCoalescedUpdatesAfterFirstCreateOperationFinishesA
 				{
 					Type:   string(cloudnetworkv1.Assigned),
 					Status: v1.ConditionTrue,
-					Reason: cloudResponseReasonSuccess,
+					Reason: conditions.ReasonCloudResponseSuccess,
 				},
 			},
 		},
@@ -12,6 +12,7 @@ import (
 	fakecloudnetworkclientset "github.com/openshift/client-go/cloudnetwork/clientset/versioned/fake"
 	cloudnetworkinformers "github.com/openshift/client-go/cloudnetwork/informers/externalversions"
 	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	"github.com/openshift/cloud-network-config-controller/pkg/conditions"
 	controller "github.com/openshift/cloud-network-config-controller/pkg/controller"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -73,6 +74,8 @@ type CloudPrivateIPConfigTestCase struct {
 	mockCloudAssignErrorWithExistingIP bool
 	mockCloudReleaseError              bool
 	mockCloudWaitError                 bool
+	mockCloudZoneMismatch              bool
+	mockCloudAllowsMove                bool
 	delayedCompletion                  time.Duration
 	testObject                         *cloudnetworkv1.CloudPrivateIPConfig
 	expectedObject                     *cloudnetworkv1.CloudPrivateIPConfig
@@ -86,6 +89,10 @@ func (t *CloudPrivateIPConfigTestCase) NewFakeCloudPrivateIPConfigController() *
 	fakeCloudNetworkClient := fakecloudnetworkclientset.NewSimpleClientset([]runtime.Object{t.testObject}...)
 	fakeKubeClient := fakekubeclient.NewSimpleClientset()
 	fakeCloudProvider := cloudprovider.NewFakeCloudProvider(t.mockCloudAssignError, t.mockCloudAssignErrorWithExistingIP, t.mockCloudReleaseError, t.mockCloudWaitError, t.delayedCompletion)
+	if t.mockCloudZoneMismatch {
+		fakeCloudProvider.MockZoneMismatchIPs = map[string]bool{cloudPrivateIPConfigName: true}
+	}
+	fakeCloudProvider.MockAllowsMove = t.mockCloudAllowsMove
 
 	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(fakeKubeClient, 0)
 	cloudNetworkInformerFactory := cloudnetworkinformers.NewSharedInformerFactory(fakeCloudNetworkClient, 0)
@@ -96,6 +103,13 @@ func (t *CloudPrivateIPConfigTestCase) NewFakeCloudPrivateIPConfigController() *
 		fakeCloudNetworkClient,
 		cloudNetworkInformerFactory.Cloud().V1().CloudPrivateIPConfigs(),
 		kubeInformerFactory.Core().V1().Nodes(),
+		VerifyConfig{},
+		nil,
+		AuditConfig{},
+		nil,
+		nil,
+		0,
+		nil,
 	)
 
 	fakeCloudPrivateIPConfigController := &FakeCloudPrivateIPConfigController{
@@ -182,7 +196,7 @@ func TestSyncAddCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionTrue,
-							Reason: cloudResponseReasonSuccess,
+							Reason: conditions.ReasonCloudResponseSuccess,
 						},
 					},
 				},
@@ -217,7 +231,7 @@ func TestSyncAddCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionFalse,
-							Reason: cloudResponseReasonError,
+							Reason: conditions.ReasonCloudResponseError,
 						},
 					},
 				},
@@ -228,6 +242,42 @@ func TestSyncAddCloudPrivateIPConfig(t *testing.T) {
 			mockCloudAssignError:    true,
 			expectErrorOnAssignSync: true,
 		},
+		{
+			name: "Should report a zone mismatch on add without retrying",
+			testObject: &cloudnetworkv1.CloudPrivateIPConfig{
+				ObjectMeta: v1.ObjectMeta{
+					Name: cloudPrivateIPConfigName,
+				},
+				Spec: cloudnetworkv1.CloudPrivateIPConfigSpec{
+					Node: nodeNameA,
+				},
+			},
+			expectedObject: &cloudnetworkv1.CloudPrivateIPConfig{
+				ObjectMeta: v1.ObjectMeta{
+					Name: cloudPrivateIPConfigName,
+					Finalizers: []string{
+						cloudPrivateIPConfigFinalizer,
+					},
+				},
+				Spec: cloudnetworkv1.CloudPrivateIPConfigSpec{
+					Node: nodeNameA,
+				},
+				Status: cloudnetworkv1.CloudPrivateIPConfigStatus{
+					Node: nodeNameA,
+					Conditions: []v1.Condition{
+						{
+							Type:   string(cloudnetworkv1.Assigned),
+							Status: v1.ConditionFalse,
+							Reason: conditions.ReasonZoneMismatch,
+						},
+					},
+				},
+			},
+			expectedTrackedState: []string{
+				fmt.Sprintf("assign-%s-%s", cloudPrivateIPConfigName, nodeNameA),
+			},
+			mockCloudZoneMismatch: true,
+		},
 		{
 			name: "Should fail to sync object on add with wait error",
 			testObject: &cloudnetworkv1.CloudPrivateIPConfig{
@@ -254,7 +304,7 @@ func TestSyncAddCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionFalse,
-							Reason: cloudResponseReasonError,
+							Reason: conditions.ReasonCloudResponseError,
 						},
 					},
 				},
@@ -290,7 +340,7 @@ func TestSyncAddCloudPrivateIPConfig(t *testing.T) {
 							// during its last sync term, and now has restarted
 							// and should re-sync it correctly.
 							Status: v1.ConditionUnknown,
-							Reason: cloudResponseReasonPending,
+							Reason: conditions.ReasonCloudResponsePending,
 						},
 					},
 				},
@@ -311,7 +361,7 @@ func TestSyncAddCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionTrue,
-							Reason: cloudResponseReasonSuccess,
+							Reason: conditions.ReasonCloudResponseSuccess,
 						},
 					},
 				},
@@ -348,7 +398,7 @@ func TestSyncAddCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionTrue,
-							Reason: cloudResponseReasonSuccess,
+							Reason: conditions.ReasonCloudResponseSuccess,
 						},
 					},
 				},
@@ -384,7 +434,7 @@ func TestSyncAddCloudPrivateIPConfig(t *testing.T) {
 							// during its last sync term, and now has restarted
 							// and should re-sync it correctly.
 							Status: v1.ConditionUnknown,
-							Reason: cloudResponseReasonPending,
+							Reason: conditions.ReasonCloudResponsePending,
 						},
 					},
 				},
@@ -405,7 +455,7 @@ func TestSyncAddCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionFalse,
-							Reason: cloudResponseReasonError,
+							Reason: conditions.ReasonCloudResponseError,
 						},
 					},
 				},
@@ -441,7 +491,7 @@ func TestSyncAddCloudPrivateIPConfig(t *testing.T) {
 							// during its last sync term, and now has restarted
 							// and should re-sync it correctly.
 							Status: v1.ConditionUnknown,
-							Reason: cloudResponseReasonPending,
+							Reason: conditions.ReasonCloudResponsePending,
 						},
 					},
 				},
@@ -462,7 +512,7 @@ func TestSyncAddCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionFalse,
-							Reason: cloudResponseReasonError,
+							Reason: conditions.ReasonCloudResponseError,
 						},
 					},
 				},
@@ -489,7 +539,7 @@ func TestSyncAddCloudPrivateIPConfig(t *testing.T) {
 							// Fake a failed sync in the last term by setting a
 							// false status.
 							Status:  v1.ConditionFalse,
-							Reason:  cloudResponseReasonError,
+							Reason:  conditions.ReasonCloudResponseError,
 							Message: "Something bad happened during the last sync",
 						},
 					},
@@ -511,7 +561,7 @@ func TestSyncAddCloudPrivateIPConfig(t *testing.T) {
 						v1.Condition{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionTrue,
-							Reason: cloudResponseReasonSuccess,
+							Reason: conditions.ReasonCloudResponseSuccess,
 						},
 					},
 				},
@@ -532,7 +582,7 @@ func TestSyncDeleteCloudPrivateIPConfig(t *testing.T) {
 				ObjectMeta: v1.ObjectMeta{
 					Name: cloudPrivateIPConfigName,
 					// Fake a deletion by setting the time to anything
-					DeletionTimestamp: &v1.Time{time.Now()},
+					DeletionTimestamp: &v1.Time{Time: time.Now()},
 					Finalizers: []string{
 						cloudPrivateIPConfigFinalizer,
 					},
@@ -546,7 +596,7 @@ func TestSyncDeleteCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionTrue,
-							Reason: cloudResponseReasonSuccess,
+							Reason: conditions.ReasonCloudResponseSuccess,
 						},
 					},
 				},
@@ -565,7 +615,7 @@ func TestSyncDeleteCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionUnknown,
-							Reason: cloudResponseReasonPending,
+							Reason: conditions.ReasonCloudResponsePending,
 						},
 					},
 				},
@@ -580,7 +630,7 @@ func TestSyncDeleteCloudPrivateIPConfig(t *testing.T) {
 				ObjectMeta: v1.ObjectMeta{
 					Name: cloudPrivateIPConfigName,
 					// Fake a deletion by setting the time to anything
-					DeletionTimestamp: &v1.Time{time.Now()},
+					DeletionTimestamp: &v1.Time{Time: time.Now()},
 					Finalizers: []string{
 						cloudPrivateIPConfigFinalizer,
 					},
@@ -594,7 +644,7 @@ func TestSyncDeleteCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionTrue,
-							Reason: cloudResponseReasonSuccess,
+							Reason: conditions.ReasonCloudResponseSuccess,
 						},
 					},
 				},
@@ -615,7 +665,7 @@ func TestSyncDeleteCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionFalse,
-							Reason: cloudResponseReasonError,
+							Reason: conditions.ReasonCloudResponseError,
 						},
 					},
 				},
@@ -632,7 +682,7 @@ func TestSyncDeleteCloudPrivateIPConfig(t *testing.T) {
 				ObjectMeta: v1.ObjectMeta{
 					Name: cloudPrivateIPConfigName,
 					// Fake a deletion by setting the time to anything
-					DeletionTimestamp: &v1.Time{time.Now()},
+					DeletionTimestamp: &v1.Time{Time: time.Now()},
 					Finalizers: []string{
 						cloudPrivateIPConfigFinalizer,
 					},
@@ -646,7 +696,7 @@ func TestSyncDeleteCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionTrue,
-							Reason: cloudResponseReasonSuccess,
+							Reason: conditions.ReasonCloudResponseSuccess,
 						},
 					},
 				},
@@ -667,7 +717,7 @@ func TestSyncDeleteCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionFalse,
-							Reason: cloudResponseReasonError,
+							Reason: conditions.ReasonCloudResponseError,
 						},
 					},
 				},
@@ -684,7 +734,7 @@ func TestSyncDeleteCloudPrivateIPConfig(t *testing.T) {
 				ObjectMeta: v1.ObjectMeta{
 					Name: cloudPrivateIPConfigName,
 					// Fake a deletion by setting the time to anything
-					DeletionTimestamp: &v1.Time{time.Now()},
+					DeletionTimestamp: &v1.Time{Time: time.Now()},
 					Finalizers: []string{
 						cloudPrivateIPConfigFinalizer,
 					},
@@ -699,7 +749,7 @@ func TestSyncDeleteCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionFalse,
-							Reason: cloudResponseReasonError,
+							Reason: conditions.ReasonCloudResponseError,
 						},
 					},
 				},
@@ -718,7 +768,7 @@ func TestSyncDeleteCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionUnknown,
-							Reason: cloudResponseReasonPending,
+							Reason: conditions.ReasonCloudResponsePending,
 						},
 					},
 				},
@@ -733,7 +783,7 @@ func TestSyncDeleteCloudPrivateIPConfig(t *testing.T) {
 				ObjectMeta: v1.ObjectMeta{
 					Name: cloudPrivateIPConfigName,
 					// Fake a deletion by setting the time to anything
-					DeletionTimestamp: &v1.Time{time.Now()},
+					DeletionTimestamp: &v1.Time{Time: time.Now()},
 					Finalizers: []string{
 						cloudPrivateIPConfigFinalizer,
 					},
@@ -748,7 +798,7 @@ func TestSyncDeleteCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionFalse,
-							Reason: cloudResponseReasonError,
+							Reason: conditions.ReasonCloudResponseError,
 						},
 					},
 				},
@@ -769,7 +819,7 @@ func TestSyncDeleteCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionFalse,
-							Reason: cloudResponseReasonError,
+							Reason: conditions.ReasonCloudResponseError,
 						},
 					},
 				},
@@ -786,7 +836,7 @@ func TestSyncDeleteCloudPrivateIPConfig(t *testing.T) {
 				ObjectMeta: v1.ObjectMeta{
 					Name: cloudPrivateIPConfigName,
 					// Fake a deletion by setting the time to anything
-					DeletionTimestamp: &v1.Time{time.Now()},
+					DeletionTimestamp: &v1.Time{Time: time.Now()},
 					Finalizers: []string{
 						cloudPrivateIPConfigFinalizer,
 					},
@@ -801,7 +851,7 @@ func TestSyncDeleteCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionFalse,
-							Reason: cloudResponseReasonError,
+							Reason: conditions.ReasonCloudResponseError,
 						},
 					},
 				},
@@ -822,7 +872,7 @@ func TestSyncDeleteCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionFalse,
-							Reason: cloudResponseReasonError,
+							Reason: conditions.ReasonCloudResponseError,
 						},
 					},
 				},
@@ -857,7 +907,7 @@ func TestSyncUpdateCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionTrue,
-							Reason: cloudResponseReasonSuccess,
+							Reason: conditions.ReasonCloudResponseSuccess,
 						},
 					},
 				},
@@ -878,7 +928,7 @@ func TestSyncUpdateCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionTrue,
-							Reason: cloudResponseReasonSuccess,
+							Reason: conditions.ReasonCloudResponseSuccess,
 						},
 					},
 				},
@@ -889,6 +939,55 @@ func TestSyncUpdateCloudPrivateIPConfig(t *testing.T) {
 			},
 			isUpdate: true,
 		},
+		{
+			name: "Should set the new node in the status after a move",
+			testObject: &cloudnetworkv1.CloudPrivateIPConfig{
+				ObjectMeta: v1.ObjectMeta{
+					Name: cloudPrivateIPConfigName,
+					Finalizers: []string{
+						cloudPrivateIPConfigFinalizer,
+					},
+				},
+				Spec: cloudnetworkv1.CloudPrivateIPConfigSpec{
+					Node: nodeNameB,
+				},
+				Status: cloudnetworkv1.CloudPrivateIPConfigStatus{
+					Node: nodeNameA,
+					Conditions: []v1.Condition{
+						{
+							Type:   string(cloudnetworkv1.Assigned),
+							Status: v1.ConditionTrue,
+							Reason: conditions.ReasonCloudResponseSuccess,
+						},
+					},
+				},
+			},
+			expectedObject: &cloudnetworkv1.CloudPrivateIPConfig{
+				ObjectMeta: v1.ObjectMeta{
+					Name: cloudPrivateIPConfigName,
+					Finalizers: []string{
+						cloudPrivateIPConfigFinalizer,
+					},
+				},
+				Spec: cloudnetworkv1.CloudPrivateIPConfigSpec{
+					Node: nodeNameB,
+				},
+				Status: cloudnetworkv1.CloudPrivateIPConfigStatus{
+					Node: nodeNameB,
+					Conditions: []v1.Condition{
+						{
+							Type:   string(cloudnetworkv1.Assigned),
+							Status: v1.ConditionTrue,
+							Reason: conditions.ReasonCloudResponseSuccess,
+						},
+					},
+				},
+			},
+			expectedTrackedState: []string{
+				fmt.Sprintf("move-%s-%s-%s", cloudPrivateIPConfigName, nodeNameA, nodeNameB),
+			},
+			mockCloudAllowsMove: true,
+		},
 		{
 			name: "Should fail to sync object on update with release error",
 			testObject: &cloudnetworkv1.CloudPrivateIPConfig{
@@ -907,7 +1006,7 @@ func TestSyncUpdateCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionTrue,
-							Reason: cloudResponseReasonSuccess,
+							Reason: conditions.ReasonCloudResponseSuccess,
 						},
 					},
 				},
@@ -928,7 +1027,7 @@ func TestSyncUpdateCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionFalse,
-							Reason: cloudResponseReasonError,
+							Reason: conditions.ReasonCloudResponseError,
 						},
 					},
 				},
@@ -957,7 +1056,7 @@ func TestSyncUpdateCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionTrue,
-							Reason: cloudResponseReasonSuccess,
+							Reason: conditions.ReasonCloudResponseSuccess,
 						},
 					},
 				},
@@ -978,7 +1077,7 @@ func TestSyncUpdateCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionFalse,
-							Reason: cloudResponseReasonError,
+							Reason: conditions.ReasonCloudResponseError,
 						},
 					},
 				},
@@ -1007,7 +1106,7 @@ func TestSyncUpdateCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionTrue,
-							Reason: cloudResponseReasonSuccess,
+							Reason: conditions.ReasonCloudResponseSuccess,
 						},
 					},
 				},
@@ -1028,7 +1127,7 @@ func TestSyncUpdateCloudPrivateIPConfig(t *testing.T) {
 						{
 							Type:   string(cloudnetworkv1.Assigned),
 							Status: v1.ConditionFalse,
-							Reason: cloudResponseReasonError,
+							Reason: conditions.ReasonCloudResponseError,
 						},
 					},
 				},
@@ -1050,11 +1149,11 @@ func runTests(t *testing.T, tests []CloudPrivateIPConfigTestCase) {
 		t.Run(test.name, func(t *testing.T) {
 			controller := test.NewFakeCloudPrivateIPConfigController()
 			if test.isUpdate {
-				if err := controller.CloudNetworkConfigController.SyncHandler(test.testObject.Name); err != nil && !test.expectErrorOnReleaseSync {
+				if err := controller.CloudNetworkConfigController.SyncHandler(context.TODO(), test.testObject.Name); err != nil && !test.expectErrorOnReleaseSync {
 					t.Fatalf("sync expected no error, but got err: %v", err)
 				}
 			}
-			if err := controller.CloudNetworkConfigController.SyncHandler(test.testObject.Name); err != nil && (!test.expectErrorOnAssignSync && !test.expectErrorOnReleaseSync) {
+			if err := controller.CloudNetworkConfigController.SyncHandler(context.TODO(), test.testObject.Name); err != nil && (!test.expectErrorOnAssignSync && !test.expectErrorOnReleaseSync) {
 				t.Fatalf("sync expected no error, but got err: %v", err)
 			}
 			syncedObject, err := controller.cloudNetworkClient.CloudV1().CloudPrivateIPConfigs().Get(context.TODO(), test.testObject.Name, v1.GetOptions{})
@@ -1084,11 +1183,51 @@ func TestCloudPrivateIPConfigNameToIP(t *testing.T) {
 			"192.172.168.4",
 			net.ParseIP("192.172.168.4"),
 		},
+		// Names are parsed strictly, see CVE-2021-29923.
+		{
+			"192.172.168.04",
+			nil,
+		},
+		{
+			"fc00.f853.0ccd.e793.0000.0000.0000.0054%eth0",
+			nil,
+		},
 	}
 	for _, test := range tests {
-		actualIP := cloudPrivateIPConfigNameToIP(test.name)
+		actualIP := CloudPrivateIPConfigNameToIP(test.name)
+		if test.exectedIP == nil {
+			if actualIP != nil {
+				t.Fatalf("Expected CloudPrivateIPConfigName %s not to be parsed, but got: %v", test.name, actualIP)
+			}
+			continue
+		}
 		if !test.exectedIP.Equal(actualIP) {
 			t.Fatalf("Expected CloudPrivateIPConfigName %s to match IP: %v, but got: %v", test.name, test.exectedIP, actualIP)
 		}
 	}
 }
+
+func TestCloudPrivateIPConfigIPToName(t *testing.T) {
+	tests := []struct {
+		ip           net.IP
+		expectedName string
+	}{
+		{
+			net.ParseIP("fc00:f853:ccd:e793::54"),
+			"fc00.f853.0ccd.e793.0000.0000.0000.0054",
+		},
+		{
+			net.ParseIP("192.172.168.4"),
+			"192.172.168.4",
+		},
+	}
+	for _, test := range tests {
+		actualName := CloudPrivateIPConfigIPToName(test.ip)
+		if actualName != test.expectedName {
+			t.Fatalf("Expected IP %v to match CloudPrivateIPConfigName: %s, but got: %s", test.ip, test.expectedName, actualName)
+		}
+		if !test.ip.Equal(CloudPrivateIPConfigNameToIP(actualName)) {
+			t.Fatalf("Expected CloudPrivateIPConfigName %s to match IP: %v", actualName, test.ip)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package controller
+
+import (
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Reasons of the Kubernetes Events recorded for the assignment lifecycle.
+const (
+	EventReasonAssignStarted  = "AssignStarted"
+	EventReasonAssigned       = "Assigned"
+	EventReasonAssignFailed   = "AssignFailed"
+	EventReasonReleaseStarted = "ReleaseStarted"
+	EventReasonReleased       = "Released"
+	EventReasonReleaseFailed  = "ReleaseFailed"
+	EventReasonMoveStarted    = "MoveStarted"
+	EventReasonMoved          = "Moved"
+	EventReasonMoveFailed     = "MoveFailed"
+	EventReasonRepaired       = "Repaired"
+	EventReasonPlanned        = "Planned"
+
+	// maxEventMessageLength caps the messages of Events, which hold cloud
+	// errors of arbitrary length, to what the API server accepts.
+	maxEventMessageLength = 1024
+)
+
+// recordEvent records a Kubernetes Event on cloudPrivateIPConfig and on each
+// of the nodes, so that `oc describe` of either tells what happened to the IP
+// address without correlating the controller's logs. It's a no-op if the
+// Events are disabled.
+func (c *CloudPrivateIPConfigController) recordEvent(cloudPrivateIPConfig *cloudnetworkv1.CloudPrivateIPConfig, eventType, reason, message string, nodes ...string) {
+	if c.eventRecorder == nil {
+		return
+	}
+	if len(message) > maxEventMessageLength {
+		message = message[:maxEventMessageLength-3] + "..."
+	}
+	c.eventRecorder.Event(cloudPrivateIPConfig, eventType, reason, message)
+	for _, node := range nodes {
+		if node == "" {
+			continue
+		}
+		// Like the kubelet, refer to nodes by name: that's what `oc
+		// describe node` looks the Events up by.
+		c.eventRecorder.Event(&corev1.ObjectReference{Kind: "Node", Name: node, UID: types.UID(node)}, eventType, reason, message)
+	}
+}
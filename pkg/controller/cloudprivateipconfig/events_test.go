@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	fakecloudnetworkclientset "github.com/openshift/client-go/cloudnetwork/clientset/versioned/fake"
+	cloudnetworkinformers "github.com/openshift/client-go/cloudnetwork/informers/externalversions"
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	"github.com/openshift/cloud-network-config-controller/pkg/conditions"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	fakekubeclient "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestRecordEvents(t *testing.T) {
+	ip := "192.168.172.12"
+	assigned := []v1.Condition{conditions.New(conditions.Assigned, v1.ConditionTrue, 0, conditions.ReasonCloudResponseSuccess, "")}
+	tcs := []struct {
+		name           string
+		specNode       string
+		statusNode     string
+		failAssign     bool
+		expectedEvents []string
+	}{
+		{
+			name:     "Should record the start and success of an assignment on the object and the node",
+			specNode: nodeNameA,
+			expectedEvents: []string{
+				"Normal AssignStarted Assigning IP address 192.168.172.12 to node nodeA",
+				"Normal AssignStarted Assigning IP address 192.168.172.12 to node nodeA",
+				"Normal Assigned IP address 192.168.172.12 assigned to node nodeA",
+				"Normal Assigned IP address 192.168.172.12 assigned to node nodeA",
+			},
+		},
+		{
+			name:       "Should record failed assignments with the cloud error",
+			specNode:   nodeNameA,
+			failAssign: true,
+			expectedEvents: []string{
+				"Normal AssignStarted Assigning IP address 192.168.172.12 to node nodeA",
+				"Normal AssignStarted Assigning IP address 192.168.172.12 to node nodeA",
+				"Warning AssignFailed Error assigning IP address 192.168.172.12 to node nodeA, err: Assign failed",
+				"Warning AssignFailed Error assigning IP address 192.168.172.12 to node nodeA, err: Assign failed",
+			},
+		},
+		{
+			name:       "Should record releases",
+			statusNode: nodeNameA,
+			expectedEvents: []string{
+				"Normal ReleaseStarted Releasing IP address 192.168.172.12 from node nodeA",
+				"Normal ReleaseStarted Releasing IP address 192.168.172.12 from node nodeA",
+				"Normal Released IP address 192.168.172.12 released from node nodeA",
+				"Normal Released IP address 192.168.172.12 released from node nodeA",
+			},
+		},
+	}
+
+	for i, tc := range tcs {
+		cloudPrivateIPConfig := &cloudnetworkv1.CloudPrivateIPConfig{
+			ObjectMeta: v1.ObjectMeta{Name: ip},
+			Spec:       cloudnetworkv1.CloudPrivateIPConfigSpec{Node: tc.specNode},
+			Status:     cloudnetworkv1.CloudPrivateIPConfigStatus{Node: tc.statusNode},
+		}
+		if tc.statusNode != "" {
+			cloudPrivateIPConfig.Finalizers = []string{cloudPrivateIPConfigFinalizer}
+			cloudPrivateIPConfig.Status.Conditions = assigned
+		}
+		fakeCloudNetworkClient := fakecloudnetworkclientset.NewSimpleClientset(cloudPrivateIPConfig)
+		fakeCloudProvider := cloudprovider.NewFakeCloudProvider(tc.failAssign, false, false, false, 0)
+		kubeInformerFactory := kubeinformers.NewSharedInformerFactory(fakekubeclient.NewSimpleClientset(), 0)
+		cloudNetworkInformerFactory := cloudnetworkinformers.NewSharedInformerFactory(fakeCloudNetworkClient, 0)
+		recorder := record.NewFakeRecorder(len(tc.expectedEvents) + 1)
+		controller := NewCloudPrivateIPConfigController(
+			context.TODO(),
+			fakeCloudProvider,
+			fakeCloudNetworkClient,
+			cloudNetworkInformerFactory.Cloud().V1().CloudPrivateIPConfigs(),
+			kubeInformerFactory.Core().V1().Nodes(),
+			VerifyConfig{},
+			nil,
+			AuditConfig{},
+			nil,
+			nil,
+			0,
+			recorder,
+		)
+		cloudNetworkInformerFactory.Cloud().V1().CloudPrivateIPConfigs().Informer().GetStore().Add(cloudPrivateIPConfig)
+		kubeInformerFactory.Core().V1().Nodes().Informer().GetStore().Add(&nodeA)
+
+		if err := controller.SyncHandler(context.TODO(), ip); (err != nil) != tc.failAssign {
+			t.Fatalf("TestRecordEvents(%d): %s: unexpected sync result, err: %v", i, tc.name, err)
+		}
+		close(recorder.Events)
+		events := []string{}
+		for event := range recorder.Events {
+			events = append(events, event)
+		}
+		if fmt.Sprint(events) != fmt.Sprint(tc.expectedEvents) {
+			t.Fatalf("TestRecordEvents(%d): %s: expected events:\n%s\ngot:\n%s", i, tc.name, strings.Join(tc.expectedEvents, "\n"), strings.Join(events, "\n"))
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	"github.com/openshift/cloud-network-config-controller/pkg/conditions"
+	"github.com/openshift/cloud-network-config-controller/pkg/notifier"
+	"github.com/openshift/cloud-network-config-controller/pkg/tracing"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// DualStackPairAnnotation can be set on an IPv4 and an IPv6
+// CloudPrivateIPConfig, each to the name of the other, to pair them: the IPv4
+// and IPv6 egress IPs of the same workload are then only ever assigned
+// together, to the same node. The IPv4 CloudPrivateIPConfig leads the pair, it
+// assigns and releases both on the cloud.
+const DualStackPairAnnotation = "cloud.network.openshift.io/dual-stack-pair"
+
+// isPaired returns true if the CloudPrivateIPConfig is annotated as part of a
+// pair.
+func isPaired(cloudPrivateIPConfig *cloudnetworkv1.CloudPrivateIPConfig) bool {
+	return cloudPrivateIPConfig.Annotations[DualStackPairAnnotation] != ""
+}
+
+// getPartner returns the partner of a paired CloudPrivateIPConfig from the
+// informer cache. It returns a message describing why the pair is broken
+// instead if the partner doesn't exist, is being deleted, doesn't point back
+// or is of the same IP family.
+func (c *CloudPrivateIPConfigController) getPartner(cloudPrivateIPConfig *cloudnetworkv1.CloudPrivateIPConfig) (*cloudnetworkv1.CloudPrivateIPConfig, string, error) {
+	partnerName := cloudPrivateIPConfig.Annotations[DualStackPairAnnotation]
+	partner, err := c.cloudPrivateIPConfigLister.Get(partnerName)
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Sprintf("Waiting for the paired CloudPrivateIPConfig %s to be created", partnerName), nil
+	} else if err != nil {
+		return nil, "", err
+	}
+	switch {
+	case !partner.DeletionTimestamp.IsZero():
+		return nil, fmt.Sprintf("The paired CloudPrivateIPConfig %s is being deleted", partnerName), nil
+	case partner.Annotations[DualStackPairAnnotation] != cloudPrivateIPConfig.Name:
+		return nil, fmt.Sprintf("The paired CloudPrivateIPConfig %s is not paired with this one, its annotation %s must be set to %s", partnerName, DualStackPairAnnotation, cloudPrivateIPConfig.Name), nil
+	case utilnet.IsIPv6(CloudPrivateIPConfigNameToIP(partner.Name)) == utilnet.IsIPv6(CloudPrivateIPConfigNameToIP(cloudPrivateIPConfig.Name)):
+		return nil, fmt.Sprintf("The paired CloudPrivateIPConfig %s is of the same IP family, pairs must be made of an IPv4 and an IPv6 address", partnerName), nil
+	}
+	return partner, "", nil
+}
+
+// syncPair decides whether the operation computed for a paired
+// CloudPrivateIPConfig proceeds. It returns true if the sync must stop there:
+// while the pair is broken or the partners don't agree on the node, or if the
+// CloudPrivateIPConfig is the IPv6 partner, whose assignment is carried out by
+// the IPv4 partner. Otherwise, it returns the partner to carry out the
+// operation with, fresh from the API server, or nil if the operation is carried
+// out on the CloudPrivateIPConfig alone: if it isn't paired, is being deleted,
+// or to release it if the pair is broken.
+func (c *CloudPrivateIPConfigController) syncPair(ctx context.Context, cloudPrivateIPConfig *cloudnetworkv1.CloudPrivateIPConfig, nodeNameToAdd, nodeNameToDel string) (*cloudnetworkv1.CloudPrivateIPConfig, bool, error) {
+	if !isPaired(cloudPrivateIPConfig) || !cloudPrivateIPConfig.DeletionTimestamp.IsZero() {
+		return nil, false, nil
+	}
+	partner, pending, err := c.getPartner(cloudPrivateIPConfig)
+	if err != nil {
+		return nil, true, err
+	}
+	if pending != "" && nodeNameToDel != "" {
+		// The pair is broken, there's nothing to keep together anymore.
+		return nil, false, nil
+	}
+	if pending == "" && partner.Spec.Node != cloudPrivateIPConfig.Spec.Node {
+		pending = fmt.Sprintf("Waiting for the paired CloudPrivateIPConfig %s to be assigned to node %q as well", partner.Name, cloudPrivateIPConfig.Spec.Node)
+	} else if pending == "" && nodeNameToAdd != "" && partner.Status.Node != "" && partner.Status.Node != nodeNameToAdd {
+		pending = fmt.Sprintf("Waiting for the paired CloudPrivateIPConfig %s to be released from node %q", partner.Name, partner.Status.Node)
+	}
+	if pending != "" {
+		klog.Infof("CloudPrivateIPConfig: %q is paired, %s", cloudPrivateIPConfig.Name, pending)
+		status := newAssignedStatus(cloudPrivateIPConfig, cloudPrivateIPConfig.Status.Node, metav1.ConditionUnknown, conditions.ReasonDualStackPairPending, pending)
+		_, err = c.updateCloudPrivateIPConfigStatus(ctx, cloudPrivateIPConfig, status)
+		return nil, true, err
+	}
+	if utilnet.IsIPv6(CloudPrivateIPConfigNameToIP(cloudPrivateIPConfig.Name)) {
+		if nodeNameToDel != "" && partner.Status.Node != nodeNameToDel {
+			// The IPv4 partner was already released from the node, e.g.
+			// after a failure releasing this one along.
+			return nil, false, nil
+		}
+		// Set a status for consumers to know what's going on on the first
+		// sync, leave any later one to the IPv4 partner.
+		if nodeNameToAdd != "" && meta.FindStatusCondition(cloudPrivateIPConfig.Status.Conditions, conditions.Assigned) == nil {
+			status := newAssignedStatus(cloudPrivateIPConfig, "", metav1.ConditionUnknown, conditions.ReasonDualStackPairPending, fmt.Sprintf("Waiting for the paired CloudPrivateIPConfig %s to assign the pair", partner.Name))
+			if _, err = c.updateCloudPrivateIPConfigStatus(ctx, cloudPrivateIPConfig, status); err != nil {
+				return nil, true, err
+			}
+		}
+		c.enqueue(partner)
+		return nil, true, nil
+	}
+	if partner, err = c.getCloudPrivateIPConfig(ctx, partner.Name); err != nil || partner == nil {
+		return nil, true, err
+	}
+	return partner, false, nil
+}
+
+// assignPartner assigns the IPv6 partner to the node the IPv4 partner was just
+// assigned to. If that fails, the IPv4 address is released again so that
+// either both or none of the pair are assigned.
+func (c *CloudPrivateIPConfigController) assignPartner(ctx context.Context, partner *cloudnetworkv1.CloudPrivateIPConfig, leaderIP net.IP, node *corev1.Node) error {
+	var err error
+	name, ip := partner.Name, CloudPrivateIPConfigNameToIP(partner.Name)
+	status := newAssignedStatus(partner, node.Name, metav1.ConditionUnknown, conditions.ReasonCloudResponsePending, "Adding IP address along with the paired CloudPrivateIPConfig")
+	if partner, err = c.updateCloudPrivateIPConfigStatus(ctx, partner, status); err != nil {
+		return fmt.Errorf("error updating paired CloudPrivateIPConfig: %q, err: %v", name, err)
+	}
+	if !controllerutil.ContainsFinalizer(partner, cloudPrivateIPConfigFinalizer) {
+		controllerutil.AddFinalizer(partner, cloudPrivateIPConfigFinalizer)
+		if partner, err = c.patchCloudPrivateIPConfigFinalizer(ctx, partner); err != nil {
+			return fmt.Errorf("error updating paired CloudPrivateIPConfig: %q, err: %v", name, err)
+		}
+	}
+
+	cloudCtx, span := startCloudSpan(ctx, "AssignPrivateIP", ip, node)
+	assignErr := c.cloudProviderClient.AssignPrivateIP(cloudCtx, ip, node)
+	tracing.End(span, assignErr)
+	if assignErr != nil && !errors.Is(assignErr, cloudprovider.AlreadyExistingIPError) {
+		cloudCtx, span = startCloudSpan(ctx, "ReleasePrivateIP", leaderIP, node)
+		releaseErr := c.cloudProviderClient.ReleasePrivateIP(cloudCtx, leaderIP, node)
+		tracing.End(span, releaseErr)
+		if releaseErr != nil && !errors.Is(releaseErr, cloudprovider.NonExistingIPError) {
+			klog.Errorf("Error rolling back the assignment of IP address %s to node %q after its paired CloudPrivateIPConfig: %q failed, err: %v", leaderIP, node.Name, name, releaseErr)
+		}
+		status = newAssignedStatus(partner, node.Name, metav1.ConditionFalse, conditions.ReasonCloudResponseError, cloudprovider.WithRemediationHint(fmt.Sprintf("Error processing cloud assignment request, err: %v", assignErr), assignErr))
+		if _, err = c.updateCloudPrivateIPConfigStatus(ctx, partner, status); err != nil {
+			klog.Errorf("Error updating paired CloudPrivateIPConfig: %q status for error issuing cloud assignment, err: %v", name, err)
+		}
+		return fmt.Errorf("error assigning paired CloudPrivateIPConfig: %q to node: %q, err: %v", name, node.Name, assignErr)
+	}
+
+	status = newAssignedStatus(partner, node.Name, metav1.ConditionTrue, conditions.ReasonCloudResponseSuccess, "IP address successfully added along with the paired CloudPrivateIPConfig")
+	status = c.verifyAssignment(ctx, partner, status, ip, node)
+	if _, err = c.updateCloudPrivateIPConfigStatus(ctx, partner, status); err != nil {
+		return fmt.Errorf("error updating paired CloudPrivateIPConfig: %q, err: %v", name, err)
+	}
+	c.recordReservation(partner, ip, node)
+	c.recordAssignment(partner, ip, AssignmentOperationAssign, "", node.Name)
+	c.notify(notifier.EventAssigned, partner, ip, node.Name, "IP address assigned along with the paired CloudPrivateIPConfig")
+	klog.Infof("Added IP address to node: %q for paired CloudPrivateIPConfig: %q", node.Name, name)
+	return nil
+}
+
+// releasePartner releases the IPv6 partner from the node the IPv4 partner was
+// just released from, unless it's already released.
+func (c *CloudPrivateIPConfigController) releasePartner(ctx context.Context, partner *cloudnetworkv1.CloudPrivateIPConfig, node *corev1.Node) error {
+	if partner.Status.Node != node.Name {
+		return nil
+	}
+	var err error
+	name, ip := partner.Name, CloudPrivateIPConfigNameToIP(partner.Name)
+	status := newAssignedStatus(partner, node.Name, metav1.ConditionUnknown, conditions.ReasonCloudResponsePending, "Deleting IP address along with the paired CloudPrivateIPConfig")
+	if partner, err = c.updateCloudPrivateIPConfigStatus(ctx, partner, status); err != nil {
+		return fmt.Errorf("error updating paired CloudPrivateIPConfig: %q during delete operation, err: %v", name, err)
+	}
+	cloudCtx, span := startCloudSpan(ctx, "ReleasePrivateIP", ip, node)
+	releaseErr := c.cloudProviderClient.ReleasePrivateIP(cloudCtx, ip, node)
+	tracing.End(span, releaseErr)
+	if releaseErr != nil && !errors.Is(releaseErr, cloudprovider.NonExistingIPError) && !errors.Is(releaseErr, cloudprovider.ReadOnlyError) {
+		status = newAssignedStatus(partner, node.Name, metav1.ConditionFalse, conditions.ReasonCloudResponseError, cloudprovider.WithRemediationHint(fmt.Sprintf("Error processing cloud release request, err: %v", releaseErr), releaseErr))
+		if _, err = c.updateCloudPrivateIPConfigStatus(ctx, partner, status); err != nil {
+			klog.Errorf("Error updating paired CloudPrivateIPConfig: %q status for error releasing cloud assignment, err: %v", name, err)
+		}
+		return fmt.Errorf("error releasing paired CloudPrivateIPConfig: %q from node: %q, err: %v", name, node.Name, releaseErr)
+	}
+	c.deleteReservation(partner)
+	c.recordAssignment(partner, ip, AssignmentOperationRelease, node.Name, "")
+	c.notify(notifier.EventReleased, partner, ip, node.Name, "IP address released along with the paired CloudPrivateIPConfig")
+
+	status = newAssignedStatus(partner, "", metav1.ConditionTrue, conditions.ReasonCloudResponseSuccess, "IP address successfully deleted along with the paired CloudPrivateIPConfig")
+	if _, err = c.updateCloudPrivateIPConfigStatus(ctx, partner, status); err != nil {
+		return fmt.Errorf("error updating paired CloudPrivateIPConfig: %q, err: %v", name, err)
+	}
+	klog.Infof("Deleted IP address from node: %q for paired CloudPrivateIPConfig: %q", node.Name, name)
+	return nil
+}
+
+// enqueuePartner enqueues the partner of a paired CloudPrivateIPConfig, if
+// it exists, for it to re-evaluate the pair.
+func (c *CloudPrivateIPConfigController) enqueuePartner(obj interface{}) {
+	cloudPrivateIPConfig, ok := obj.(*cloudnetworkv1.CloudPrivateIPConfig)
+	if !ok || !isPaired(cloudPrivateIPConfig) {
+		return
+	}
+	if partner, err := c.cloudPrivateIPConfigLister.Get(cloudPrivateIPConfig.Annotations[DualStackPairAnnotation]); err == nil {
+		c.enqueue(partner)
+	}
+}
@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	fakecloudnetworkclientset "github.com/openshift/client-go/cloudnetwork/clientset/versioned/fake"
+	cloudnetworkinformers "github.com/openshift/client-go/cloudnetwork/informers/externalversions"
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	"github.com/openshift/cloud-network-config-controller/pkg/conditions"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	fakekubeclient "k8s.io/client-go/kubernetes/fake"
+)
+
+var (
+	pairedIPv4Name = "192.168.172.12"
+	pairedIPv6Name = "fc00.f853.0ccd.e793.0000.0000.0000.0054"
+)
+
+// newPairedCloudPrivateIPConfig returns a CloudPrivateIPConfig paired with
+// partner, assigned to statusNode with the Assigned condition status.
+func newPairedCloudPrivateIPConfig(name, partner, specNode, statusNode string, assigned v1.ConditionStatus) *cloudnetworkv1.CloudPrivateIPConfig {
+	cloudPrivateIPConfig := &cloudnetworkv1.CloudPrivateIPConfig{
+		ObjectMeta: v1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{DualStackPairAnnotation: partner},
+		},
+		Spec: cloudnetworkv1.CloudPrivateIPConfigSpec{
+			Node: specNode,
+		},
+		Status: cloudnetworkv1.CloudPrivateIPConfigStatus{
+			Node: statusNode,
+		},
+	}
+	if statusNode != "" {
+		cloudPrivateIPConfig.Finalizers = []string{cloudPrivateIPConfigFinalizer}
+		cloudPrivateIPConfig.Status.Conditions = []v1.Condition{conditions.New(conditions.Assigned, assigned, 0, conditions.ReasonCloudResponseSuccess, "")}
+	}
+	return cloudPrivateIPConfig
+}
+
+func TestSyncPairedCloudPrivateIPConfigs(t *testing.T) {
+	tcs := []struct {
+		name     string
+		ipv4     *cloudnetworkv1.CloudPrivateIPConfig
+		ipv6     *cloudnetworkv1.CloudPrivateIPConfig
+		failIPs  map[string]bool
+		syncIPv6 bool
+		// expected status node and Assigned reason of the IPv4 and IPv6 partners
+		expectedIPv4   [2]string
+		expectedIPv6   [2]string
+		expectedState  []string
+		expectSyncFail bool
+	}{
+		{
+			name:          "IPv6 partner waits for the IPv4 partner",
+			ipv4:          newPairedCloudPrivateIPConfig(pairedIPv4Name, pairedIPv6Name, nodeNameA, "", ""),
+			ipv6:          newPairedCloudPrivateIPConfig(pairedIPv6Name, pairedIPv4Name, nodeNameA, "", ""),
+			syncIPv6:      true,
+			expectedIPv4:  [2]string{"", ""},
+			expectedIPv6:  [2]string{"", conditions.ReasonDualStackPairPending},
+			expectedState: []string{},
+		},
+		{
+			name:          "IPv4 partner assigns both",
+			ipv4:          newPairedCloudPrivateIPConfig(pairedIPv4Name, pairedIPv6Name, nodeNameA, "", ""),
+			ipv6:          newPairedCloudPrivateIPConfig(pairedIPv6Name, pairedIPv4Name, nodeNameA, "", ""),
+			expectedIPv4:  [2]string{nodeNameA, conditions.ReasonCloudResponseSuccess},
+			expectedIPv6:  [2]string{nodeNameA, conditions.ReasonCloudResponseSuccess},
+			expectedState: []string{"assign-192.168.172.12-nodeA", "assign-fc00:f853:ccd:e793::54-nodeA"},
+		},
+		{
+			name:           "IPv4 partner is rolled back if the IPv6 partner fails",
+			ipv4:           newPairedCloudPrivateIPConfig(pairedIPv4Name, pairedIPv6Name, nodeNameA, "", ""),
+			ipv6:           newPairedCloudPrivateIPConfig(pairedIPv6Name, pairedIPv4Name, nodeNameA, "", ""),
+			failIPs:        map[string]bool{"fc00:f853:ccd:e793::54": true},
+			expectedIPv4:   [2]string{nodeNameA, conditions.ReasonCloudResponseError},
+			expectedIPv6:   [2]string{nodeNameA, conditions.ReasonCloudResponseError},
+			expectedState:  []string{"assign-192.168.172.12-nodeA", "assign-fc00:f853:ccd:e793::54-nodeA", "release-192.168.172.12-nodeA"},
+			expectSyncFail: true,
+		},
+		{
+			name:          "Pair waits for both partners to agree on the node",
+			ipv4:          newPairedCloudPrivateIPConfig(pairedIPv4Name, pairedIPv6Name, nodeNameA, "", ""),
+			ipv6:          newPairedCloudPrivateIPConfig(pairedIPv6Name, pairedIPv4Name, nodeNameB, "", ""),
+			expectedIPv4:  [2]string{"", conditions.ReasonDualStackPairPending},
+			expectedIPv6:  [2]string{"", ""},
+			expectedState: []string{},
+		},
+		{
+			name:          "Pair isn't released before both partners move",
+			ipv4:          newPairedCloudPrivateIPConfig(pairedIPv4Name, pairedIPv6Name, nodeNameB, nodeNameA, v1.ConditionTrue),
+			ipv6:          newPairedCloudPrivateIPConfig(pairedIPv6Name, pairedIPv4Name, nodeNameA, nodeNameA, v1.ConditionTrue),
+			expectedIPv4:  [2]string{nodeNameA, conditions.ReasonDualStackPairPending},
+			expectedIPv6:  [2]string{nodeNameA, conditions.ReasonCloudResponseSuccess},
+			expectedState: []string{},
+		},
+		{
+			name:          "IPv4 partner releases both",
+			ipv4:          newPairedCloudPrivateIPConfig(pairedIPv4Name, pairedIPv6Name, nodeNameB, nodeNameA, v1.ConditionTrue),
+			ipv6:          newPairedCloudPrivateIPConfig(pairedIPv6Name, pairedIPv4Name, nodeNameB, nodeNameA, v1.ConditionTrue),
+			expectedIPv4:  [2]string{"", conditions.ReasonCloudResponseSuccess},
+			expectedIPv6:  [2]string{"", conditions.ReasonCloudResponseSuccess},
+			expectedState: []string{"release-192.168.172.12-nodeA", "release-fc00:f853:ccd:e793::54-nodeA"},
+		},
+		{
+			name:          "Pairs of the same IP family are refused",
+			ipv4:          newPairedCloudPrivateIPConfig(pairedIPv4Name, "192.168.172.13", nodeNameA, "", ""),
+			ipv6:          newPairedCloudPrivateIPConfig("192.168.172.13", pairedIPv4Name, nodeNameA, "", ""),
+			expectedIPv4:  [2]string{"", conditions.ReasonDualStackPairPending},
+			expectedIPv6:  [2]string{"", ""},
+			expectedState: []string{},
+		},
+	}
+
+	for i, tc := range tcs {
+		fakeCloudNetworkClient := fakecloudnetworkclientset.NewSimpleClientset(tc.ipv4, tc.ipv6)
+		fakeCloudProvider := cloudprovider.NewFakeCloudProvider(false, false, false, false, 0)
+		fakeCloudProvider.MockErrorOnAssignIPs = tc.failIPs
+		kubeInformerFactory := kubeinformers.NewSharedInformerFactory(fakekubeclient.NewSimpleClientset(), 0)
+		cloudNetworkInformerFactory := cloudnetworkinformers.NewSharedInformerFactory(fakeCloudNetworkClient, 0)
+		controller := NewCloudPrivateIPConfigController(
+			context.TODO(),
+			fakeCloudProvider,
+			fakeCloudNetworkClient,
+			cloudNetworkInformerFactory.Cloud().V1().CloudPrivateIPConfigs(),
+			kubeInformerFactory.Core().V1().Nodes(),
+			VerifyConfig{},
+			nil,
+			AuditConfig{},
+			nil,
+			nil,
+			0,
+			nil,
+		)
+		cloudNetworkInformerFactory.Cloud().V1().CloudPrivateIPConfigs().Informer().GetStore().Add(tc.ipv4)
+		cloudNetworkInformerFactory.Cloud().V1().CloudPrivateIPConfigs().Informer().GetStore().Add(tc.ipv6)
+		for _, node := range []interface{}{&nodeA, &nodeB} {
+			kubeInformerFactory.Core().V1().Nodes().Informer().GetStore().Add(node)
+		}
+
+		key := tc.ipv4.Name
+		if tc.syncIPv6 {
+			key = tc.ipv6.Name
+		}
+		if err := controller.SyncHandler(context.TODO(), key); (err != nil) != tc.expectSyncFail {
+			t.Fatalf("TestSyncPairedCloudPrivateIPConfigs(%d): %s: unexpected sync result, err: %v", i, tc.name, err)
+		}
+		for _, expected := range []struct {
+			name   string
+			status [2]string
+		}{{tc.ipv4.Name, tc.expectedIPv4}, {tc.ipv6.Name, tc.expectedIPv6}} {
+			synced, err := fakeCloudNetworkClient.CloudV1().CloudPrivateIPConfigs().Get(context.TODO(), expected.name, v1.GetOptions{})
+			if err != nil {
+				t.Fatalf("TestSyncPairedCloudPrivateIPConfigs(%d): %s: unexpected error, err: %v", i, tc.name, err)
+			}
+			reason := ""
+			if len(synced.Status.Conditions) > 0 {
+				reason = synced.Status.Conditions[0].Reason
+			}
+			if synced.Status.Node != expected.status[0] || reason != expected.status[1] {
+				t.Fatalf("TestSyncPairedCloudPrivateIPConfigs(%d): %s: expected %s to be assigned to %q with reason %q, got %q with reason %q",
+					i, tc.name, expected.name, expected.status[0], expected.status[1], synced.Status.Node, reason)
+			}
+		}
+		if err := assertStateEquals(fakeCloudProvider.StateTracker, tc.expectedState); err != nil {
+			t.Fatalf("TestSyncPairedCloudPrivateIPConfigs(%d): %s: %v", i, tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	"github.com/openshift/cloud-network-config-controller/pkg/conditions"
+	controller "github.com/openshift/cloud-network-config-controller/pkg/controller"
+	"github.com/openshift/cloud-network-config-controller/pkg/tracing"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// reachabilityRecordTimeout is how long a failed reachability probe waits for
+// the assignment it probed to be recorded, before it's dropped.
+const reachabilityRecordTimeout = 30 * time.Second
+
+// errAssignmentNotRecorded is returned while the assignment a reachability
+// probe failed on isn't recorded in the status of its CloudPrivateIPConfig.
+var errAssignmentNotRecorded = errors.New("assignment not recorded yet")
+
+// reachabilityProbe is the probe of the reachability of the IP address of a
+// CloudPrivateIPConfig, at the generation it was assigned to node at.
+type reachabilityProbe struct {
+	name       string
+	generation int64
+	ip         string
+	node       string
+}
+
+// enqueueReachabilityProbe probes the reachability of the IP address of a
+// CloudPrivateIPConfig assigned to node in the background, one at a time:
+// probes change the cloud and may take minutes, they mustn't block the
+// workers. The prober is started on the first probe.
+func (c *CloudPrivateIPConfigController) enqueueReachabilityProbe(name string, generation int64, ip net.IP, node string) {
+	c.reachabilityOnce.Do(func() {
+		c.reachabilityProbes = workqueue.NewNamed("reachability")
+		go func() {
+			<-c.ctx.Done()
+			c.reachabilityProbes.ShutDown()
+		}()
+		go c.runReachabilityProber()
+	})
+	c.reachabilityProbes.Add(reachabilityProbe{name: name, generation: generation, ip: ip.String(), node: node})
+}
+
+func (c *CloudPrivateIPConfigController) runReachabilityProber() {
+	for {
+		item, shutdown := c.reachabilityProbes.Get()
+		if shutdown {
+			return
+		}
+		c.probeReachability(item.(reachabilityProbe))
+		c.reachabilityProbes.Done(item)
+	}
+}
+
+// probeReachability probes the reachability of an IP address, from within
+// the cloud and then from a verifier pod if a probe port is configured, and
+// marks the CloudPrivateIPConfig as not Verified if it's unreachable, unless
+// it has changed since it was enqueued.
+func (c *CloudPrivateIPConfigController) probeReachability(probe reachabilityProbe) {
+	node, err := c.nodesLister.Get(probe.node)
+	if err != nil {
+		klog.V(5).Infof("Not probing the reachability of IP address %s on node %q: %v", probe.ip, probe.node, err)
+		return
+	}
+	ip := net.ParseIP(probe.ip)
+	cloudCtx, span := startCloudSpan(c.ctx, "ProbeReachability", ip, node)
+	probeErr := c.cloudProviderClient.ProbeReachability(cloudCtx, ip, node)
+	tracing.End(span, probeErr)
+	if errors.Is(probeErr, cloudprovider.ReadOnlyError) {
+		klog.V(5).Infof("Not probing the reachability of IP address %s on node %q: %v", probe.ip, probe.node, probeErr)
+		return
+	}
+	if probeErr == nil && c.verifyConfig.ProbePort != 0 {
+		probeErr = c.probeFromVerifierPod(ip, node)
+		if errors.Is(probeErr, errNoVerifierNode) {
+			klog.V(5).Infof("Not probing the reachability of IP address %s on node %q from a verifier pod: %v", probe.ip, probe.node, probeErr)
+			return
+		}
+	}
+	if probeErr == nil {
+		return
+	}
+	if _, ok := c.maintenanceWindows.Active(time.Now()); ok {
+		klog.Infof("IP address %s of CloudPrivateIPConfig: %q is unreachable on node %q during a cloud maintenance window, err: %v", probe.ip, probe.name, probe.node, probeErr)
+		return
+	}
+	klog.Warningf("IP address %s of CloudPrivateIPConfig: %q is unreachable on node %q, err: %v", probe.ip, probe.name, probe.node, probeErr)
+	// The worker which enqueued the probe may not have recorded the
+	// assignment yet.
+	err = wait.PollImmediate(time.Second, reachabilityRecordTimeout, func() (bool, error) {
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			ctx, cancel := context.WithTimeout(c.ctx, controller.ClientTimeout)
+			defer cancel()
+			cloudPrivateIPConfig, err := c.cloudNetworkClient.CloudV1().CloudPrivateIPConfigs().Get(ctx, probe.name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if cloudPrivateIPConfig.Generation != probe.generation {
+				return nil
+			}
+			if cloudPrivateIPConfig.Status.Node != probe.node {
+				return errAssignmentNotRecorded
+			}
+			verified := conditions.New(conditions.Verified, metav1.ConditionFalse, probe.generation, conditions.ReasonProbeFailed, fmt.Sprintf("Error probing IP address from within the cloud, err: %v", probeErr))
+			cloudPrivateIPConfig.Status.Conditions = conditions.Set(conditions.KindCloudPrivateIPConfig, cloudPrivateIPConfig.Status.Conditions, verified)
+			_, err = c.cloudNetworkClient.CloudV1().CloudPrivateIPConfigs().UpdateStatus(ctx, cloudPrivateIPConfig, metav1.UpdateOptions{})
+			return err
+		})
+		if errors.Is(err, errAssignmentNotRecorded) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		klog.Errorf("Error recording the failed reachability probe of CloudPrivateIPConfig: %q, err: %v", probe.name, err)
+	}
+}
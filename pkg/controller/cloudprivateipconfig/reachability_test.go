@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	fakecloudnetworkclientset "github.com/openshift/client-go/cloudnetwork/clientset/versioned/fake"
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	"github.com/openshift/cloud-network-config-controller/pkg/conditions"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	fakekubeclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestProbeReachability(t *testing.T) {
+	ip := "192.168.172.12"
+	tcs := []struct {
+		name        string
+		unreachable bool
+		// generation is the generation the probe was enqueued at.
+		generation     int64
+		expectedReason string
+	}{
+		{
+			name:           "Should keep reachable IP addresses verified",
+			generation:     1,
+			expectedReason: conditions.ReasonVerificationSucceeded,
+		},
+		{
+			name:           "Should mark unreachable IP addresses as not verified",
+			unreachable:    true,
+			generation:     1,
+			expectedReason: conditions.ReasonProbeFailed,
+		},
+		{
+			name:           "Should ignore probes of a previous generation",
+			unreachable:    true,
+			generation:     0,
+			expectedReason: conditions.ReasonVerificationSucceeded,
+		},
+	}
+
+	for i, tc := range tcs {
+		cloudPrivateIPConfig := &cloudnetworkv1.CloudPrivateIPConfig{
+			ObjectMeta: v1.ObjectMeta{
+				Name:       ip,
+				Generation: 1,
+			},
+			Spec: cloudnetworkv1.CloudPrivateIPConfigSpec{
+				Node: nodeNameA,
+			},
+			Status: cloudnetworkv1.CloudPrivateIPConfigStatus{
+				Node: nodeNameA,
+				Conditions: []v1.Condition{
+					conditions.New(conditions.Assigned, v1.ConditionTrue, 1, conditions.ReasonCloudResponseSuccess, ""),
+					conditions.New(conditions.Verified, v1.ConditionTrue, 1, conditions.ReasonVerificationSucceeded, ""),
+				},
+			},
+		}
+		fakeCloudNetworkClient := fakecloudnetworkclientset.NewSimpleClientset(cloudPrivateIPConfig)
+		fakeCloudProvider := cloudprovider.NewFakeCloudProvider(false, false, false, false, 0)
+		if tc.unreachable {
+			fakeCloudProvider.MockUnreachableIPs = map[string]bool{ip: true}
+		}
+		nodeInformer := kubeinformers.NewSharedInformerFactory(fakekubeclient.NewSimpleClientset(), 0).Core().V1().Nodes()
+		nodeInformer.Informer().GetStore().Add(&nodeA)
+		c := &CloudPrivateIPConfigController{
+			cloudNetworkClient:  fakeCloudNetworkClient,
+			nodesLister:         nodeInformer.Lister(),
+			cloudProviderClient: fakeCloudProvider,
+			ctx:                 context.TODO(),
+		}
+
+		c.probeReachability(reachabilityProbe{name: ip, generation: tc.generation, ip: ip, node: nodeNameA})
+		probed, err := fakeCloudNetworkClient.CloudV1().CloudPrivateIPConfigs().Get(context.TODO(), ip, v1.GetOptions{})
+		if err != nil {
+			t.Fatalf("TestProbeReachability(%d): %s: unexpected error, err: %v", i, tc.name, err)
+		}
+		verified := meta.FindStatusCondition(probed.Status.Conditions, string(conditions.Verified))
+		if verified == nil || verified.Reason != tc.expectedReason {
+			t.Fatalf("TestProbeReachability(%d): %s: expected the Verified condition with reason %q, got: %v", i, tc.name, tc.expectedReason, verified)
+		}
+		if err := assertStateEquals(fakeCloudProvider.StateTracker, []string{"probe-" + ip}); err != nil {
+			t.Fatalf("TestProbeReachability(%d): %s: %v", i, tc.name, err)
+		}
+	}
+}
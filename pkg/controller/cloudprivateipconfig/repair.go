@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	"github.com/openshift/cloud-network-config-controller/pkg/conditions"
+	"github.com/openshift/cloud-network-config-controller/pkg/notifier"
+	"github.com/openshift/cloud-network-config-controller/pkg/tracing"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// repairAssignment re-assigns ip to the node cloudPrivateIPConfig is assigned
+// to if the cloud reports it missing, i.e: if it was removed out of band, e.g.
+// in the cloud's console, which would otherwise blackhole the egress traffic
+// while the object still reports success. It's a no-op unless the cloud state
+// resync found the object missing and repairs are enabled, see
+// resyncCloudState, and the object is still assigned, and during cloud
+// maintenance windows, as the cloud may not report assignments accurately
+// then. The assignment is verified again, as it may have been restored since
+// the resync. Verification errors other than a missing IP address are only
+// logged, the next resync tries again.
+func (c *CloudPrivateIPConfigController) repairAssignment(ctx context.Context, cloudPrivateIPConfig *cloudnetworkv1.CloudPrivateIPConfig, ip net.IP) error {
+	nodeName := cloudPrivateIPConfig.Status.Node
+	if !c.repairs.take(cloudPrivateIPConfig.Name) || !c.verifyConfig.ResyncRepair || nodeName == "" || !cloudPrivateIPConfig.DeletionTimestamp.IsZero() {
+		return nil
+	}
+	if _, ok := c.maintenanceWindows.Active(time.Now()); ok {
+		return nil
+	}
+	node, err := c.nodesLister.Get(nodeName)
+	if err != nil {
+		return err
+	}
+	cloudCtx, span := startCloudSpan(ctx, "VerifyPrivateIP", ip, node)
+	verifyErr := c.cloudProviderClient.VerifyPrivateIP(cloudCtx, ip, node)
+	tracing.End(span, verifyErr)
+	if !errors.Is(verifyErr, cloudprovider.MissingIPError) {
+		if verifyErr != nil {
+			klog.Warningf("Could not verify assignment of IP address %s to node %q for CloudPrivateIPConfig: %q, err: %v", ip, nodeName, cloudPrivateIPConfig.Name, verifyErr)
+		}
+		return nil
+	}
+
+	klog.Warningf("IP address %s of CloudPrivateIPConfig: %q went missing on node %q, re-assigning it, err: %v", ip, cloudPrivateIPConfig.Name, nodeName, verifyErr)
+	var status *cloudnetworkv1.CloudPrivateIPConfigStatus
+	assignErr := c.assignPrivateIP(ctx, ip, node)
+	if errors.Is(assignErr, cloudprovider.ReadOnlyError) {
+		klog.Infof("Not re-assigning IP address %s to node %q for CloudPrivateIPConfig: %q: %v", ip, nodeName, cloudPrivateIPConfig.Name, assignErr)
+		return nil
+	}
+	if assignErr != nil && !errors.Is(assignErr, cloudprovider.AlreadyExistingIPError) {
+		// The failed Assigned condition makes the next sync assign it again.
+		status = newAssignedStatus(cloudPrivateIPConfig, nodeName, metav1.ConditionFalse, conditions.ReasonCloudResponseError, cloudprovider.WithRemediationHint(fmt.Sprintf("Error re-assigning IP address removed out of band, err: %v", assignErr), assignErr))
+		c.recordEvent(cloudPrivateIPConfig, corev1.EventTypeWarning, EventReasonAssignFailed, cloudprovider.WithRemediationHint(fmt.Sprintf("Error re-assigning IP address %s removed out of band from node %s, err: %v", ip, nodeName, assignErr), assignErr), nodeName)
+		if _, err := c.updateCloudPrivateIPConfigStatus(ctx, cloudPrivateIPConfig, status); err != nil {
+			return fmt.Errorf("error updating CloudPrivateIPConfig: %q status for error issuing cloud assignment, err: %v", cloudPrivateIPConfig.Name, err)
+		}
+		return fmt.Errorf("error re-assigning CloudPrivateIPConfig: %q to node: %q, err: %v", cloudPrivateIPConfig.Name, nodeName, assignErr)
+	}
+
+	status = newAssignedStatus(cloudPrivateIPConfig, nodeName, metav1.ConditionTrue, conditions.ReasonCloudResponseSuccess, "IP address re-assigned after it was removed out of band")
+	status = c.verifyAssignment(ctx, cloudPrivateIPConfig, status, ip, node)
+	c.recordAssignment(cloudPrivateIPConfig, ip, AssignmentOperationAssign, "", nodeName)
+	c.notify(notifier.EventRepaired, cloudPrivateIPConfig, ip, nodeName, "IP address re-assigned after it was removed out of band")
+	c.recordEvent(cloudPrivateIPConfig, corev1.EventTypeNormal, EventReasonRepaired, fmt.Sprintf("IP address %s re-assigned to node %s after it was removed out of band", ip, nodeName), nodeName)
+	klog.Infof("Re-assigned IP address to node: %q for CloudPrivateIPConfig: %q", nodeName, cloudPrivateIPConfig.Name)
+	_, err = c.updateCloudPrivateIPConfigStatus(ctx, cloudPrivateIPConfig, status)
+	return err
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	fakecloudnetworkclientset "github.com/openshift/client-go/cloudnetwork/clientset/versioned/fake"
+	cloudnetworkinformers "github.com/openshift/client-go/cloudnetwork/informers/externalversions"
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	"github.com/openshift/cloud-network-config-controller/pkg/conditions"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	fakekubeclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRepairAssignment(t *testing.T) {
+	ip := "192.168.172.12"
+	tcs := []struct {
+		name string
+		// pending marks the object as found missing by the cloud state resync.
+		pending        bool
+		missingIPs     map[string]bool
+		failIPs        map[string]bool
+		expectSyncFail bool
+		expectedStatus v1.ConditionStatus
+		expectedReason string
+		expectedState  []string
+	}{
+		{
+			name:           "Should not verify assigned objects the resync didn't find missing",
+			missingIPs:     map[string]bool{ip: true},
+			expectedStatus: v1.ConditionTrue,
+			expectedReason: conditions.ReasonCloudResponseSuccess,
+			expectedState:  []string{},
+		},
+		{
+			name:           "Should not re-assign IP addresses present on the cloud",
+			pending:        true,
+			expectedStatus: v1.ConditionTrue,
+			expectedReason: conditions.ReasonCloudResponseSuccess,
+			expectedState:  []string{"verify-192.168.172.12-nodeA"},
+		},
+		{
+			name:           "Should re-assign IP addresses missing on the cloud",
+			pending:        true,
+			missingIPs:     map[string]bool{ip: true},
+			expectedStatus: v1.ConditionTrue,
+			expectedReason: conditions.ReasonCloudResponseSuccess,
+			expectedState:  []string{"verify-192.168.172.12-nodeA", "assign-192.168.172.12-nodeA"},
+		},
+		{
+			name:           "Should report failed re-assignments",
+			pending:        true,
+			missingIPs:     map[string]bool{ip: true},
+			failIPs:        map[string]bool{ip: true},
+			expectSyncFail: true,
+			expectedStatus: v1.ConditionFalse,
+			expectedReason: conditions.ReasonCloudResponseError,
+			expectedState:  []string{"verify-192.168.172.12-nodeA", "assign-192.168.172.12-nodeA"},
+		},
+	}
+
+	for i, tc := range tcs {
+		cloudPrivateIPConfig := &cloudnetworkv1.CloudPrivateIPConfig{
+			ObjectMeta: v1.ObjectMeta{
+				Name:       ip,
+				Finalizers: []string{cloudPrivateIPConfigFinalizer},
+			},
+			Spec: cloudnetworkv1.CloudPrivateIPConfigSpec{
+				Node: nodeNameA,
+			},
+			Status: cloudnetworkv1.CloudPrivateIPConfigStatus{
+				Node:       nodeNameA,
+				Conditions: []v1.Condition{conditions.New(conditions.Assigned, v1.ConditionTrue, 0, conditions.ReasonCloudResponseSuccess, "")},
+			},
+		}
+		fakeCloudNetworkClient := fakecloudnetworkclientset.NewSimpleClientset(cloudPrivateIPConfig)
+		fakeCloudProvider := cloudprovider.NewFakeCloudProvider(false, false, false, false, 0)
+		fakeCloudProvider.MockMissingIPs = tc.missingIPs
+		fakeCloudProvider.MockErrorOnAssignIPs = tc.failIPs
+		kubeInformerFactory := kubeinformers.NewSharedInformerFactory(fakekubeclient.NewSimpleClientset(), 0)
+		cloudNetworkInformerFactory := cloudnetworkinformers.NewSharedInformerFactory(fakeCloudNetworkClient, 0)
+		controller := NewCloudPrivateIPConfigController(
+			context.TODO(),
+			fakeCloudProvider,
+			fakeCloudNetworkClient,
+			cloudNetworkInformerFactory.Cloud().V1().CloudPrivateIPConfigs(),
+			kubeInformerFactory.Core().V1().Nodes(),
+			VerifyConfig{ResyncRepair: true},
+			nil,
+			AuditConfig{},
+			nil,
+			nil,
+			0,
+			nil,
+		)
+		cloudNetworkInformerFactory.Cloud().V1().CloudPrivateIPConfigs().Informer().GetStore().Add(cloudPrivateIPConfig)
+		kubeInformerFactory.Core().V1().Nodes().Informer().GetStore().Add(&nodeA)
+		if tc.pending {
+			controller.CloudNetworkConfigControllerIntf.(*CloudPrivateIPConfigController).repairs.add(ip)
+		}
+
+		if err := controller.SyncHandler(context.TODO(), ip); (err != nil) != tc.expectSyncFail {
+			t.Fatalf("TestRepairAssignment(%d): %s: unexpected sync result, err: %v", i, tc.name, err)
+		}
+		synced, err := fakeCloudNetworkClient.CloudV1().CloudPrivateIPConfigs().Get(context.TODO(), ip, v1.GetOptions{})
+		if err != nil {
+			t.Fatalf("TestRepairAssignment(%d): %s: unexpected error, err: %v", i, tc.name, err)
+		}
+		if synced.Status.Node != nodeNameA || synced.Status.Conditions[0].Status != tc.expectedStatus || synced.Status.Conditions[0].Reason != tc.expectedReason {
+			t.Fatalf("TestRepairAssignment(%d): %s: expected assignment to %q with status %q and reason %q, got %q with status %q and reason %q",
+				i, tc.name, nodeNameA, tc.expectedStatus, tc.expectedReason, synced.Status.Node, synced.Status.Conditions[0].Status, synced.Status.Conditions[0].Reason)
+		}
+		if err := assertStateEquals(fakeCloudProvider.StateTracker, tc.expectedState); err != nil {
+			t.Fatalf("TestRepairAssignment(%d): %s: %v", i, tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"time"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	controller "github.com/openshift/cloud-network-config-controller/pkg/controller"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+)
+
+// reservationReconcileInterval is the interval at which the CloudIPReservations
+// are reconciled with the assignments of the CloudPrivateIPConfigs.
+const reservationReconcileInterval = 10 * time.Minute
+
+var (
+	// cloudIPReservationResource is the resource of CloudIPReservations, see
+	// manifests/cloudnetworkconfig.openshift.io_cloudipreservations.yaml. They
+	// belong to the controller's own API group, not to the one of the
+	// CloudPrivateIPConfigs, which the controller doesn't own.
+	cloudIPReservationResource = schema.GroupVersionResource{
+		Group:    "cloudnetworkconfig.openshift.io",
+		Version:  "v1alpha1",
+		Resource: "cloudipreservations",
+	}
+	cloudIPReservationKind = "CloudIPReservation"
+)
+
+// recordReservation mirrors the assignment of ip to node and the cloud resources
+// backing it into the CloudIPReservation named after cloudPrivateIPConfig, owned
+// by it. CloudIPReservations are purely informative, failing to record them is
+// logged but doesn't fail the sync.
+func (c *CloudPrivateIPConfigController) recordReservation(cloudPrivateIPConfig *cloudnetworkv1.CloudPrivateIPConfig, ip net.IP, node *corev1.Node) {
+	if c.reservationClient == nil {
+		return
+	}
+	reservations, err := c.cloudProviderClient.GetPrivateIPReservations(c.ctx, ip, node)
+	if err != nil {
+		klog.Warningf("Could not get the cloud reservations of IP address %s for CloudPrivateIPConfig: %q, err: %v", ip, cloudPrivateIPConfig.Name, err)
+		return
+	}
+	resources := make([]interface{}, 0, len(reservations))
+	for _, reservation := range reservations {
+		resource := map[string]interface{}{"id": reservation.ID}
+		if reservation.Subnet != "" {
+			resource["subnet"] = reservation.Subnet
+		}
+		resources = append(resources, resource)
+	}
+	spec := map[string]interface{}{
+		"node":      node.Name,
+		"ip":        ip.String(),
+		"resources": resources,
+	}
+
+	owners := []metav1.OwnerReference{
+		{
+			APIVersion: cloudnetworkv1.SchemeGroupVersion.String(),
+			Kind:       "CloudPrivateIPConfig",
+			Name:       cloudPrivateIPConfig.Name,
+			UID:        cloudPrivateIPConfig.UID,
+			Controller: pointer.Bool(true),
+		},
+	}
+
+	client := c.reservationClient.Resource(cloudIPReservationResource)
+	ctx, cancel := context.WithTimeout(c.ctx, controller.ClientTimeout)
+	defer cancel()
+	existing, err := client.Get(ctx, cloudPrivateIPConfig.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		reservation := &unstructured.Unstructured{}
+		reservation.SetAPIVersion(cloudIPReservationResource.GroupVersion().String())
+		reservation.SetKind(cloudIPReservationKind)
+		reservation.SetName(cloudPrivateIPConfig.Name)
+		reservation.SetOwnerReferences(owners)
+		reservation.Object["spec"] = spec
+		_, err = client.Create(ctx, reservation, metav1.CreateOptions{})
+	case err == nil:
+		// The owner changes if the CloudPrivateIPConfig was re-created
+		// before the previous one's CloudIPReservation was garbage
+		// collected.
+		existing.SetOwnerReferences(owners)
+		existing.Object["spec"] = spec
+		_, err = client.Update(ctx, existing, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		klog.Warningf("Could not record CloudIPReservation for CloudPrivateIPConfig: %q, err: %v", cloudPrivateIPConfig.Name, err)
+	}
+}
+
+// deleteReservation deletes the CloudIPReservation of cloudPrivateIPConfig once
+// its IP address is released. It's garbage collected together with the
+// CloudPrivateIPConfig otherwise.
+func (c *CloudPrivateIPConfigController) deleteReservation(cloudPrivateIPConfig *cloudnetworkv1.CloudPrivateIPConfig) {
+	if c.reservationClient == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, controller.ClientTimeout)
+	defer cancel()
+	err := c.reservationClient.Resource(cloudIPReservationResource).Delete(ctx, cloudPrivateIPConfig.Name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		klog.Warningf("Could not delete CloudIPReservation for CloudPrivateIPConfig: %q, err: %v", cloudPrivateIPConfig.Name, err)
+	}
+}
+
+// runReservationReconciler reconciles the CloudIPReservations periodically
+// once the informers synced, until the controller's context is done.
+func (c *CloudPrivateIPConfigController) runReservationReconciler(informersSynced ...cache.InformerSynced) {
+	if !cache.WaitForCacheSync(c.ctx.Done(), informersSynced...) {
+		return
+	}
+	wait.Until(func() {
+		if err := c.reconcileReservations(); err != nil {
+			klog.Warningf("Could not reconcile CloudIPReservations, err: %v", err)
+		}
+	}, reservationReconcileInterval, c.ctx.Done())
+}
+
+// reconcileReservations brings the CloudIPReservations in line with the
+// settled assignments of the CloudPrivateIPConfigs: recording and deleting
+// them is best effort, they may be missing or left behind when the controller
+// failed or restarted in between, or be changed by anyone. Those of
+// CloudPrivateIPConfigs being assigned, moved or released are left to their
+// sync.
+func (c *CloudPrivateIPConfigController) reconcileReservations() error {
+	client := c.reservationClient.Resource(cloudIPReservationResource)
+	ctx, cancel := context.WithTimeout(c.ctx, controller.ClientTimeout)
+	defer cancel()
+	list, err := client.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	reservations := map[string]*unstructured.Unstructured{}
+	for i := range list.Items {
+		reservations[list.Items[i].GetName()] = &list.Items[i]
+	}
+
+	cloudPrivateIPConfigs, err := c.cloudPrivateIPConfigLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, cloudPrivateIPConfig := range cloudPrivateIPConfigs {
+		reservation := reservations[cloudPrivateIPConfig.Name]
+		delete(reservations, cloudPrivateIPConfig.Name)
+		ip := CloudPrivateIPConfigNameToIP(cloudPrivateIPConfig.Name)
+		if ip == nil {
+			continue
+		}
+		nodeNameToAdd, nodeNameToDel := c.computeOp(cloudPrivateIPConfig)
+		if nodeNameToAdd != "" || nodeNameToDel != "" || !cloudPrivateIPConfig.DeletionTimestamp.IsZero() {
+			continue
+		}
+		nodeName := cloudPrivateIPConfig.Status.Node
+		if nodeName == "" {
+			if reservation != nil {
+				klog.Infof("Deleting the CloudIPReservation of unassigned CloudPrivateIPConfig: %q", cloudPrivateIPConfig.Name)
+				c.deleteReservation(cloudPrivateIPConfig)
+			}
+			continue
+		}
+		if reservationMatches(reservation, cloudPrivateIPConfig, ip) {
+			continue
+		}
+		node, err := c.nodesLister.Get(nodeName)
+		if err != nil {
+			klog.Warningf("Could not reconcile the CloudIPReservation of CloudPrivateIPConfig: %q, err: %v", cloudPrivateIPConfig.Name, err)
+			continue
+		}
+		klog.Infof("Recording the CloudIPReservation of CloudPrivateIPConfig: %q, assigned to node %q", cloudPrivateIPConfig.Name, nodeName)
+		c.recordReservation(cloudPrivateIPConfig, ip, node)
+	}
+
+	// What's left doesn't have a CloudPrivateIPConfig anymore, garbage
+	// collection deletes it unless it's an orphan.
+	for name := range reservations {
+		klog.Infof("Deleting the CloudIPReservation of deleted CloudPrivateIPConfig: %q", name)
+		deleteCtx, cancel := context.WithTimeout(c.ctx, controller.ClientTimeout)
+		err := client.Delete(deleteCtx, name, metav1.DeleteOptions{})
+		cancel()
+		if err != nil && !apierrors.IsNotFound(err) {
+			klog.Warningf("Could not delete CloudIPReservation: %q, err: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// reservationMatches returns whether reservation records the assignment of
+// cloudPrivateIPConfig, i.e. its node and IP address, and is owned by it.
+func reservationMatches(reservation *unstructured.Unstructured, cloudPrivateIPConfig *cloudnetworkv1.CloudPrivateIPConfig, ip net.IP) bool {
+	if reservation == nil {
+		return false
+	}
+	node, _, _ := unstructured.NestedString(reservation.Object, "spec", "node")
+	recordedIP, _, _ := unstructured.NestedString(reservation.Object, "spec", "ip")
+	if node != cloudPrivateIPConfig.Status.Node || recordedIP != ip.String() {
+		return false
+	}
+	owners := reservation.GetOwnerReferences()
+	return len(owners) == 1 && owners[0].UID == cloudPrivateIPConfig.UID
+}
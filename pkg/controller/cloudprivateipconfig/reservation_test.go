@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	fakecloudnetworkclientset "github.com/openshift/client-go/cloudnetwork/clientset/versioned/fake"
+	cloudnetworkinformers "github.com/openshift/client-go/cloudnetwork/informers/externalversions"
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	"github.com/openshift/cloud-network-config-controller/pkg/conditions"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubeinformers "k8s.io/client-go/informers"
+	fakekubeclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRecordReservation(t *testing.T) {
+	reservationClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		cloudIPReservationResource: cloudIPReservationKind + "List",
+	})
+	c := &CloudPrivateIPConfigController{
+		cloudProviderClient: cloudprovider.NewFakeCloudProvider(false, false, false, false, 0),
+		reservationClient:   reservationClient,
+		ctx:                 context.TODO(),
+	}
+
+	cloudPrivateIPConfig := &cloudnetworkv1.CloudPrivateIPConfig{}
+	cloudPrivateIPConfig.Name = "192.168.172.12"
+	cloudPrivateIPConfig.UID = "3ba5a2a1-9d4b-4c3e-8b8e-0a0b2f2c6d31"
+	ip := net.ParseIP(cloudPrivateIPConfig.Name)
+
+	getReservation := func() *unstructured.Unstructured {
+		reservation, err := reservationClient.Resource(cloudIPReservationResource).Get(context.TODO(), cloudPrivateIPConfig.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("TestRecordReservation: could not get CloudIPReservation, err: %v", err)
+		}
+		return reservation
+	}
+
+	for i, nodeName := range []string{"nodeA", "nodeB"} {
+		node := &corev1.Node{}
+		node.Name = nodeName
+		c.recordReservation(cloudPrivateIPConfig, ip, node)
+
+		reservation := getReservation()
+		if recorded, _, _ := unstructured.NestedString(reservation.Object, "spec", "node"); recorded != nodeName {
+			t.Fatalf("TestRecordReservation(%d): expected node %s to be recorded, got %s", i, nodeName, recorded)
+		}
+		if recorded, _, _ := unstructured.NestedString(reservation.Object, "spec", "ip"); recorded != cloudPrivateIPConfig.Name {
+			t.Fatalf("TestRecordReservation(%d): expected IP address %s to be recorded, got %s", i, cloudPrivateIPConfig.Name, recorded)
+		}
+		owners := reservation.GetOwnerReferences()
+		if len(owners) != 1 || owners[0].UID != cloudPrivateIPConfig.UID || owners[0].Controller == nil || !*owners[0].Controller {
+			t.Fatalf("TestRecordReservation(%d): expected CloudIPReservation to be controlled by the CloudPrivateIPConfig, got %v", i, owners)
+		}
+	}
+
+	c.deleteReservation(cloudPrivateIPConfig)
+	list, err := reservationClient.Resource(cloudIPReservationResource).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("TestRecordReservation: could not list CloudIPReservations, err: %v", err)
+	}
+	if len(list.Items) != 0 {
+		t.Fatalf("TestRecordReservation: expected CloudIPReservation to be deleted, got %v", list.Items)
+	}
+	// Deleting it again is a no-op.
+	c.deleteReservation(cloudPrivateIPConfig)
+}
+
+func TestReconcileReservations(t *testing.T) {
+	reservationClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		cloudIPReservationResource: cloudIPReservationKind + "List",
+	})
+	newCloudPrivateIPConfig := func(name, specNode, statusNode string) *cloudnetworkv1.CloudPrivateIPConfig {
+		cloudPrivateIPConfig := &cloudnetworkv1.CloudPrivateIPConfig{}
+		cloudPrivateIPConfig.Name = name
+		cloudPrivateIPConfig.UID = types.UID("uid-" + name)
+		cloudPrivateIPConfig.Spec.Node = specNode
+		cloudPrivateIPConfig.Status.Node = statusNode
+		if statusNode != "" {
+			cloudPrivateIPConfig.Status.Conditions = []metav1.Condition{
+				conditions.New(conditions.Assigned, metav1.ConditionTrue, 0, conditions.ReasonCloudResponseSuccess, ""),
+			}
+		}
+		return cloudPrivateIPConfig
+	}
+	newReservation := func(name, node string) {
+		reservation := &unstructured.Unstructured{}
+		reservation.SetAPIVersion(cloudIPReservationResource.GroupVersion().String())
+		reservation.SetKind(cloudIPReservationKind)
+		reservation.SetName(name)
+		reservation.SetOwnerReferences([]metav1.OwnerReference{{UID: types.UID("uid-" + name)}})
+		reservation.Object["spec"] = map[string]interface{}{"node": node, "ip": name}
+		if _, err := reservationClient.Resource(cloudIPReservationResource).Create(context.TODO(), reservation, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("TestReconcileReservations: could not create CloudIPReservation, err: %v", err)
+		}
+	}
+
+	cloudPrivateIPConfigInformer := cloudnetworkinformers.NewSharedInformerFactory(fakecloudnetworkclientset.NewSimpleClientset(), 0).Cloud().V1().CloudPrivateIPConfigs()
+	for _, cloudPrivateIPConfig := range []*cloudnetworkv1.CloudPrivateIPConfig{
+		// Assigned without CloudIPReservation.
+		newCloudPrivateIPConfig("192.168.172.10", nodeNameA, nodeNameA),
+		// Assigned with a stale CloudIPReservation.
+		newCloudPrivateIPConfig("192.168.172.11", nodeNameA, nodeNameA),
+		// Released with a CloudIPReservation left behind.
+		newCloudPrivateIPConfig("192.168.172.12", "", ""),
+		// Being moved, left to its sync.
+		newCloudPrivateIPConfig("192.168.172.13", nodeNameB, nodeNameA),
+	} {
+		cloudPrivateIPConfigInformer.Informer().GetStore().Add(cloudPrivateIPConfig)
+	}
+	newReservation("192.168.172.11", nodeNameB)
+	newReservation("192.168.172.12", nodeNameA)
+	newReservation("192.168.172.13", nodeNameB)
+	// The CloudPrivateIPConfig is deleted.
+	newReservation("192.168.172.14", nodeNameA)
+
+	nodeInformer := kubeinformers.NewSharedInformerFactory(fakekubeclient.NewSimpleClientset(), 0).Core().V1().Nodes()
+	nodeInformer.Informer().GetStore().Add(&nodeA)
+	c := &CloudPrivateIPConfigController{
+		cloudPrivateIPConfigLister: cloudPrivateIPConfigInformer.Lister(),
+		nodesLister:                nodeInformer.Lister(),
+		cloudProviderClient:        cloudprovider.NewFakeCloudProvider(false, false, false, false, 0),
+		reservationClient:          reservationClient,
+		ctx:                        context.TODO(),
+	}
+	if err := c.reconcileReservations(); err != nil {
+		t.Fatalf("TestReconcileReservations: unexpected error, err: %v", err)
+	}
+
+	list, err := reservationClient.Resource(cloudIPReservationResource).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("TestReconcileReservations: could not list CloudIPReservations, err: %v", err)
+	}
+	recorded := map[string]string{}
+	for _, reservation := range list.Items {
+		recorded[reservation.GetName()], _, _ = unstructured.NestedString(reservation.Object, "spec", "node")
+	}
+	expected := map[string]string{
+		"192.168.172.10": nodeNameA,
+		"192.168.172.11": nodeNameA,
+		"192.168.172.13": nodeNameB,
+	}
+	if !reflect.DeepEqual(recorded, expected) {
+		t.Fatalf("TestReconcileReservations: expected CloudIPReservations %v, got %v", expected, recorded)
+	}
+}
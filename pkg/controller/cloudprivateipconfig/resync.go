@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	"github.com/openshift/cloud-network-config-controller/pkg/metrics"
+	"github.com/openshift/cloud-network-config-controller/pkg/notifier"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// divergenceMissing is an IP address assigned to a node by a
+	// CloudPrivateIPConfig which the cloud neither lists nor verifies for it.
+	divergenceMissing = "missing"
+	// divergenceUnknown is an IP address the cloud lists for a node which
+	// no CloudPrivateIPConfig assigns to it.
+	divergenceUnknown = "unknown"
+)
+
+var cloudStateDivergencesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Name:      "cloud_state_divergences_total",
+	Help:      "Number of divergences between the CloudPrivateIPConfigs and the IP addresses assigned on the cloud found by the cloud state resync.",
+}, []string{"kind"})
+
+func init() {
+	metrics.Registry.MustRegister(cloudStateDivergencesTotal)
+}
+
+// pendingRepairs are the names of the CloudPrivateIPConfigs the cloud state
+// resync found missing on the cloud, to repair on their next sync.
+type pendingRepairs struct {
+	sync.Mutex
+	names map[string]bool
+}
+
+func (r *pendingRepairs) add(name string) {
+	r.Lock()
+	defer r.Unlock()
+	if r.names == nil {
+		r.names = map[string]bool{}
+	}
+	r.names[name] = true
+}
+
+// take returns whether name is pending repair, and forgets it.
+func (r *pendingRepairs) take(name string) bool {
+	r.Lock()
+	defer r.Unlock()
+	pending := r.names[name]
+	delete(r.names, name)
+	return pending
+}
+
+// divergence is a difference between the CloudPrivateIPConfigs and the IP
+// addresses the cloud lists for a node.
+type divergence struct {
+	kind string
+	ip   string
+	node string
+}
+
+// resyncCloudState compares the IP addresses the cloud lists for each node
+// with the CloudPrivateIPConfigs assigned to it, which catches what the event
+// driven syncs can't see: IP addresses removed from or added to the node out
+// of band, e.g. in the cloud's console. Assigned IP addresses which aren't
+// listed are verified on the cloud, and requeued for repairAssignment if that
+// fails too and the repair is enabled. It's the only loop checking the cloud
+// for such changes. Unknown ones are only reported: they may be used by
+// something else than us. All assigned IP addresses of the nodes the cloud
+// can't list the IP addresses of are verified instead. The whole resync is
+// skipped during cloud maintenance windows, and objects which are being
+// processed are, as the cloud is expected to differ from them meanwhile.
+func (c *CloudPrivateIPConfigController) resyncCloudState() []divergence {
+	if end, ok := c.maintenanceWindows.Active(time.Now()); ok {
+		klog.Infof("Skipping the cloud state resync during a cloud maintenance window ending at %s", end.Format(time.RFC3339))
+		return nil
+	}
+	cloudPrivateIPConfigs, err := c.cloudPrivateIPConfigLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Error listing CloudPrivateIPConfigs for the cloud state resync, err: %v", err)
+		return nil
+	}
+	// assigned holds the settled assignments, keyed by node and IP address,
+	// inFlight the IP addresses of all other objects.
+	assigned := map[string]map[string]*cloudnetworkv1.CloudPrivateIPConfig{}
+	inFlight := map[string]bool{}
+	for _, cloudPrivateIPConfig := range cloudPrivateIPConfigs {
+		ip := CloudPrivateIPConfigNameToIP(cloudPrivateIPConfig.Name)
+		if ip == nil {
+			continue
+		}
+		nodeNameToAdd, nodeNameToDel := c.computeOp(cloudPrivateIPConfig)
+		nodeName := cloudPrivateIPConfig.Status.Node
+		if nodeNameToAdd != "" || nodeNameToDel != "" || nodeName == "" || !cloudPrivateIPConfig.DeletionTimestamp.IsZero() {
+			inFlight[ip.String()] = true
+			continue
+		}
+		if assigned[nodeName] == nil {
+			assigned[nodeName] = map[string]*cloudnetworkv1.CloudPrivateIPConfig{}
+		}
+		assigned[nodeName][ip.String()] = cloudPrivateIPConfig
+	}
+
+	nodes, err := c.nodesLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Error listing nodes for the cloud state resync, err: %v", err)
+		return nil
+	}
+	divergences := []divergence{}
+	for _, node := range nodes {
+		ips, err := c.cloudProviderClient.ListPrivateIPs(c.ctx, node)
+		if err != nil {
+			klog.Warningf("Could not list the IP addresses of node %q for the cloud state resync, err: %v", node.Name, err)
+			continue
+		}
+		listed := map[string]bool{}
+		for _, ip := range ips {
+			listed[ip.String()] = true
+		}
+		for _, address := range node.Status.Addresses {
+			if ip := net.ParseIP(address.Address); ip != nil {
+				delete(listed, ip.String())
+			}
+		}
+		for ip, cloudPrivateIPConfig := range assigned[node.Name] {
+			if listed[ip] {
+				continue
+			}
+			// Not all IP addresses can be listed, e.g. those of delegated
+			// prefixes (AWS), or none on some clouds, the cloud has the last
+			// word.
+			verifyErr := c.cloudProviderClient.VerifyPrivateIP(c.ctx, net.ParseIP(ip), node)
+			if verifyErr == nil {
+				continue
+			}
+			if !errors.Is(verifyErr, cloudprovider.MissingIPError) && ips == nil {
+				// The IP address wasn't verified for lack of a listing.
+				klog.Warningf("Could not verify assignment of IP address %s to node %q for CloudPrivateIPConfig: %q, err: %v", ip, node.Name, cloudPrivateIPConfig.Name, verifyErr)
+				continue
+			}
+			divergences = append(divergences, divergence{kind: divergenceMissing, ip: ip, node: node.Name})
+			if c.verifyConfig.ResyncRepair {
+				klog.Warningf("IP address %s of CloudPrivateIPConfig: %q is missing on the cloud for node %q, requeuing it for repair, err: %v", ip, cloudPrivateIPConfig.Name, node.Name, verifyErr)
+				c.repairs.add(cloudPrivateIPConfig.Name)
+				c.enqueue(cloudPrivateIPConfig)
+			} else {
+				klog.Warningf("IP address %s of CloudPrivateIPConfig: %q is missing on the cloud for node %q, err: %v", ip, cloudPrivateIPConfig.Name, node.Name, verifyErr)
+			}
+			c.notify(notifier.EventDiverged, cloudPrivateIPConfig, net.ParseIP(ip), node.Name, fmt.Sprintf("IP address missing on the cloud, err: %v", verifyErr))
+		}
+		for ip := range listed {
+			if assigned[node.Name][ip] != nil || inFlight[ip] {
+				continue
+			}
+			divergences = append(divergences, divergence{kind: divergenceUnknown, ip: ip, node: node.Name})
+			klog.Warningf("IP address %s is assigned to node %q on the cloud without any CloudPrivateIPConfig assigning it to the node", ip, node.Name)
+			c.notifier.Notify(notifier.Event{
+				Type:    notifier.EventDiverged,
+				Object:  node.Name,
+				IP:      ip,
+				Node:    node.Name,
+				Message: "IP address assigned on the cloud without any CloudPrivateIPConfig assigning it to the node",
+			})
+		}
+	}
+	sort.Slice(divergences, func(i, j int) bool {
+		if divergences[i].node != divergences[j].node {
+			return divergences[i].node < divergences[j].node
+		}
+		return divergences[i].ip < divergences[j].ip
+	})
+	for _, d := range divergences {
+		cloudStateDivergencesTotal.WithLabelValues(d.kind).Inc()
+	}
+	klog.Infof("Cloud state resync of %d nodes found %d divergences", len(nodes), len(divergences))
+	return divergences
+}
@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	fakecloudnetworkclientset "github.com/openshift/client-go/cloudnetwork/clientset/versioned/fake"
+	cloudnetworkinformers "github.com/openshift/client-go/cloudnetwork/informers/externalversions"
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	"github.com/openshift/cloud-network-config-controller/pkg/conditions"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	fakekubeclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestResyncCloudState(t *testing.T) {
+	assigned := func(name, node string) *cloudnetworkv1.CloudPrivateIPConfig {
+		return &cloudnetworkv1.CloudPrivateIPConfig{
+			ObjectMeta: v1.ObjectMeta{Name: name, Finalizers: []string{cloudPrivateIPConfigFinalizer}},
+			Spec:       cloudnetworkv1.CloudPrivateIPConfigSpec{Node: node},
+			Status: cloudnetworkv1.CloudPrivateIPConfigStatus{
+				Node:       node,
+				Conditions: []v1.Condition{conditions.New(conditions.Assigned, v1.ConditionTrue, 0, conditions.ReasonCloudResponseSuccess, "")},
+			},
+		}
+	}
+	// 10.0.0.1 and 10.0.0.2 are assigned to node A, 10.0.0.3 is being
+	// assigned to node B and 10.0.0.5 is assigned to node C.
+	cloudPrivateIPConfigs := []*cloudnetworkv1.CloudPrivateIPConfig{
+		assigned("10.0.0.1", nodeNameA),
+		assigned("10.0.0.2", nodeNameA),
+		{
+			ObjectMeta: v1.ObjectMeta{Name: "10.0.0.3"},
+			Spec:       cloudnetworkv1.CloudPrivateIPConfigSpec{Node: nodeNameB},
+		},
+		assigned("10.0.0.5", nodeNameC),
+	}
+	ips := func(addresses ...string) []net.IP {
+		parsed := []net.IP{}
+		for _, address := range addresses {
+			parsed = append(parsed, net.ParseIP(address))
+		}
+		return parsed
+	}
+	tcs := []struct {
+		name                string
+		privateIPs          map[string][]net.IP
+		missingIPs          map[string]bool
+		repair              bool
+		expectedDivergences []divergence
+		expectedEnqueued    []string
+	}{
+		{
+			name:                "Should find no divergence if the cloud lists the assigned IP addresses",
+			privateIPs:          map[string][]net.IP{nodeNameA: ips("10.0.0.1", "10.0.0.2"), nodeNameB: ips()},
+			expectedDivergences: []divergence{},
+		},
+		{
+			name:                "Should not report unlisted IP addresses the cloud verifies",
+			privateIPs:          map[string][]net.IP{nodeNameA: ips("10.0.0.1")},
+			expectedDivergences: []divergence{},
+		},
+		{
+			name:                "Should report missing IP addresses",
+			privateIPs:          map[string][]net.IP{nodeNameA: ips("10.0.0.1")},
+			missingIPs:          map[string]bool{"10.0.0.2": true, "10.0.0.5": true},
+			expectedDivergences: []divergence{{kind: divergenceMissing, ip: "10.0.0.2", node: nodeNameA}, {kind: divergenceMissing, ip: "10.0.0.5", node: nodeNameC}},
+		},
+		{
+			name:                "Should requeue missing IP addresses if the repair is enabled",
+			privateIPs:          map[string][]net.IP{nodeNameA: ips("10.0.0.1")},
+			missingIPs:          map[string]bool{"10.0.0.2": true},
+			repair:              true,
+			expectedDivergences: []divergence{{kind: divergenceMissing, ip: "10.0.0.2", node: nodeNameA}},
+			expectedEnqueued:    []string{"10.0.0.2"},
+		},
+		{
+			name:       "Should report unknown IP addresses, unless they're being assigned",
+			privateIPs: map[string][]net.IP{nodeNameA: ips("10.0.0.1", "10.0.0.2", "10.0.0.5"), nodeNameB: ips("10.0.0.3", "10.0.0.4")},
+			expectedDivergences: []divergence{
+				{kind: divergenceUnknown, ip: "10.0.0.5", node: nodeNameA},
+				{kind: divergenceUnknown, ip: "10.0.0.4", node: nodeNameB},
+			},
+		},
+	}
+
+	for i, tc := range tcs {
+		fakeCloudNetworkClient := fakecloudnetworkclientset.NewSimpleClientset()
+		fakeCloudProvider := cloudprovider.NewFakeCloudProvider(false, false, false, false, 0)
+		fakeCloudProvider.MockPrivateIPs = tc.privateIPs
+		fakeCloudProvider.MockMissingIPs = tc.missingIPs
+		kubeInformerFactory := kubeinformers.NewSharedInformerFactory(fakekubeclient.NewSimpleClientset(), 0)
+		cloudNetworkInformerFactory := cloudnetworkinformers.NewSharedInformerFactory(fakeCloudNetworkClient, 0)
+		controller := NewCloudPrivateIPConfigController(
+			context.TODO(),
+			fakeCloudProvider,
+			fakeCloudNetworkClient,
+			cloudNetworkInformerFactory.Cloud().V1().CloudPrivateIPConfigs(),
+			kubeInformerFactory.Core().V1().Nodes(),
+			VerifyConfig{ResyncRepair: tc.repair},
+			nil,
+			AuditConfig{},
+			nil,
+			nil,
+			0,
+			nil,
+		)
+		for _, cloudPrivateIPConfig := range cloudPrivateIPConfigs {
+			cloudNetworkInformerFactory.Cloud().V1().CloudPrivateIPConfigs().Informer().GetStore().Add(cloudPrivateIPConfig)
+		}
+		for _, node := range []interface{}{&nodeA, &nodeB, &nodeC} {
+			kubeInformerFactory.Core().V1().Nodes().Informer().GetStore().Add(node)
+		}
+		cloudPrivateIPConfigController := controller.CloudNetworkConfigControllerIntf.(*CloudPrivateIPConfigController)
+		enqueued := []string{}
+		cloudPrivateIPConfigController.enqueue = func(obj interface{}) {
+			enqueued = append(enqueued, obj.(*cloudnetworkv1.CloudPrivateIPConfig).Name)
+		}
+
+		divergences := cloudPrivateIPConfigController.resyncCloudState()
+		if fmt.Sprint(divergences) != fmt.Sprint(tc.expectedDivergences) {
+			t.Fatalf("TestResyncCloudState(%d): %s: expected divergences %v, got %v", i, tc.name, tc.expectedDivergences, divergences)
+		}
+		if fmt.Sprint(enqueued) != fmt.Sprint(append([]string{}, tc.expectedEnqueued...)) {
+			t.Fatalf("TestResyncCloudState(%d): %s: expected enqueued objects %v, got %v", i, tc.name, tc.expectedEnqueued, enqueued)
+		}
+	}
+}
+
+// TestRepairAssignmentOnResync verifies that the objects the cloud state
+// resync finds missing are repaired, including on nodes the cloud can't list
+// the IP addresses of.
+func TestRepairAssignmentOnResync(t *testing.T) {
+	ip := "192.168.172.12"
+	cloudPrivateIPConfig := &cloudnetworkv1.CloudPrivateIPConfig{
+		ObjectMeta: v1.ObjectMeta{Name: ip, Finalizers: []string{cloudPrivateIPConfigFinalizer}},
+		Spec:       cloudnetworkv1.CloudPrivateIPConfigSpec{Node: nodeNameA},
+		Status: cloudnetworkv1.CloudPrivateIPConfigStatus{
+			Node:       nodeNameA,
+			Conditions: []v1.Condition{conditions.New(conditions.Assigned, v1.ConditionTrue, 0, conditions.ReasonCloudResponseSuccess, "")},
+		},
+	}
+	fakeCloudNetworkClient := fakecloudnetworkclientset.NewSimpleClientset(cloudPrivateIPConfig)
+	fakeCloudProvider := cloudprovider.NewFakeCloudProvider(false, false, false, false, 0)
+	fakeCloudProvider.MockMissingIPs = map[string]bool{ip: true}
+	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(fakekubeclient.NewSimpleClientset(), 0)
+	cloudNetworkInformerFactory := cloudnetworkinformers.NewSharedInformerFactory(fakeCloudNetworkClient, 0)
+	controller := NewCloudPrivateIPConfigController(
+		context.TODO(),
+		fakeCloudProvider,
+		fakeCloudNetworkClient,
+		cloudNetworkInformerFactory.Cloud().V1().CloudPrivateIPConfigs(),
+		kubeInformerFactory.Core().V1().Nodes(),
+		VerifyConfig{ResyncRepair: true},
+		nil,
+		AuditConfig{},
+		nil,
+		nil,
+		0,
+		nil,
+	)
+	cloudNetworkInformerFactory.Cloud().V1().CloudPrivateIPConfigs().Informer().GetStore().Add(cloudPrivateIPConfig)
+	kubeInformerFactory.Core().V1().Nodes().Informer().GetStore().Add(&nodeA)
+	cloudPrivateIPConfigController := controller.CloudNetworkConfigControllerIntf.(*CloudPrivateIPConfigController)
+	cloudPrivateIPConfigController.enqueue = func(obj interface{}) {
+		if err := controller.SyncHandler(context.TODO(), obj.(*cloudnetworkv1.CloudPrivateIPConfig).Name); err != nil {
+			t.Fatalf("unexpected sync error, err: %v", err)
+		}
+	}
+
+	cloudPrivateIPConfigController.resyncCloudState()
+	if err := assertStateEquals(fakeCloudProvider.StateTracker, []string{"list-nodeA", "verify-192.168.172.12-nodeA", "verify-192.168.172.12-nodeA", "assign-192.168.172.12-nodeA"}); err != nil {
+		t.Fatal(err)
+	}
+}
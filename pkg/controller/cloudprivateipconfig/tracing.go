@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"context"
+	"net"
+
+	"github.com/openshift/cloud-network-config-controller/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// startCloudSpan starts the span of a call of method of the cloud provider
+// for ip, on behalf of the sync of ctx, and returns the context to make the
+// call with, carrying the span for the requests to the cloud to be its
+// children. It includes the time spent waiting for the node batch window and
+// the concurrency limits: that's time the assignment waits on the cloud too.
+// The returned context isn't cancelled along with ctx: the calls in progress
+// when the controller shuts down complete, not to leave the cloud half way
+// through an assignment.
+func startCloudSpan(ctx context.Context, method string, ip net.IP, nodes ...*corev1.Node) (context.Context, trace.Span) {
+	attributes := []attribute.KeyValue{attribute.String("ip", ip.String())}
+	for i, node := range nodes {
+		key := "node"
+		if i > 0 {
+			key = "previous_node"
+		}
+		attributes = append(attributes, attribute.String(key, node.Name))
+	}
+	_, span := tracing.Start(ctx, "cloud "+method, attributes...)
+	return trace.ContextWithSpan(context.Background(), span), span
+}
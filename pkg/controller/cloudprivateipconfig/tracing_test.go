@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/openshift/cloud-network-config-controller/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestStartCloudSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	nodeA, nodeB := &corev1.Node{}, &corev1.Node{}
+	nodeA.Name, nodeB.Name = "nodeA", "nodeB"
+	syncCtx, cancel := context.WithCancel(context.Background())
+	syncCtx, sync := tracing.Start(syncCtx, "sync")
+	ctx, span := startCloudSpan(syncCtx, "MovePrivateIP", net.ParseIP("10.0.0.10"), nodeA, nodeB)
+	cancel()
+
+	if ctx.Err() != nil {
+		t.Fatalf("expected the context of the cloud call not to be cancelled with the sync's, got: %v", ctx.Err())
+	}
+	if trace.SpanFromContext(ctx) != span {
+		t.Fatalf("expected the context of the cloud call to carry its span")
+	}
+	tracing.End(span, nil)
+	tracing.End(sync, nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 || spans[0].Name() != "cloud MovePrivateIP" || spans[0].Parent().SpanID() != sync.SpanContext().SpanID() {
+		t.Fatalf("expected the cloud span as child of the sync span, got: %+v", spans)
+	}
+	attributes := map[string]string{}
+	for _, attribute := range spans[0].Attributes() {
+		attributes[string(attribute.Key)] = attribute.Value.AsString()
+	}
+	if attributes["ip"] != "10.0.0.10" || attributes["node"] != "nodeA" || attributes["previous_node"] != "nodeB" {
+		t.Fatalf("unexpected attributes of the cloud span: %v", attributes)
+	}
+}
@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	controller "github.com/openshift/cloud-network-config-controller/pkg/controller"
+	nodecontroller "github.com/openshift/cloud-network-config-controller/pkg/controller/node"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ProbeReachabilityCommand is the subcommand of the controller's binary
+	// the verifier pods run, which probes an IP address with ProbeTCP.
+	ProbeReachabilityCommand = "probe-reachability"
+
+	// verifierPodLabel labels the verifier pods.
+	verifierPodLabel = "cloud.network.openshift.io/verifier"
+
+	// verifierPodTimeout is how long a verifier pod may take to be scheduled
+	// and to probe the IP address.
+	verifierPodTimeout = 2 * time.Minute
+)
+
+// errNoVerifierNode is returned if no other node than the one an IP address
+// is assigned to is on its network: there's no node to probe it from.
+var errNoVerifierNode = errors.New("no other node on the network of the IP address")
+
+// probeFromVerifierPod probes the reachability of ip, assigned to node, from a
+// verifier pod. The pod runs on the host network of another node which has an
+// IP address on the same subnet, so that the probe crosses the cloud's data
+// plane as the egress traffic does, rather than the cluster's overlay.
+func (c *CloudPrivateIPConfigController) probeFromVerifierPod(ip net.IP, node *corev1.Node) error {
+	verifierNodes, err := c.verifierNodes(ip, node.Name)
+	if err != nil {
+		return err
+	}
+	if len(verifierNodes) == 0 {
+		return errNoVerifierNode
+	}
+	pods := c.verifyConfig.Pods.Pods(c.verifyConfig.Namespace)
+	createCtx, cancel := context.WithTimeout(c.ctx, controller.ClientTimeout)
+	defer cancel()
+	pod, err := pods.Create(createCtx, c.newVerifierPod(ip, verifierNodes), metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("error creating verifier pod, err: %v", err)
+	}
+	// The pod is deleted even if the controller is shutting down.
+	defer func() {
+		deleteCtx, cancel := context.WithTimeout(context.Background(), controller.ClientTimeout)
+		defer cancel()
+		if err := pods.Delete(deleteCtx, pod.Name, metav1.DeleteOptions{}); err != nil {
+			klog.Warningf("Error deleting verifier pod: %s/%s, err: %v", pod.Namespace, pod.Name, err)
+		}
+	}()
+
+	var probeErr error
+	err = wait.PollImmediate(time.Second, verifierPodTimeout, func() (bool, error) {
+		getCtx, cancel := context.WithTimeout(c.ctx, controller.ClientTimeout)
+		defer cancel()
+		pod, err := pods.Get(getCtx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		switch pod.Status.Phase {
+		case corev1.PodSucceeded:
+			return true, nil
+		case corev1.PodFailed:
+			probeErr = fmt.Errorf("verifier pod %s on node %s failed: %s", pod.Name, pod.Spec.NodeName, terminationMessage(pod))
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error waiting for verifier pod: %s/%s, err: %v", pod.Namespace, pod.Name, err)
+	}
+	return probeErr
+}
+
+// verifierNodes returns the nodes, other than node, whose egress IP
+// configuration has a subnet ip is on.
+func (c *CloudPrivateIPConfigController) verifierNodes(ip net.IP, node string) ([]string, error) {
+	nodes, err := c.nodesLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	verifierNodes := []string{}
+	for _, candidate := range nodes {
+		annotation, ok := candidate.Annotations[nodecontroller.NodeEgressIPConfigAnnotationKey]
+		if candidate.Name == node || !ok {
+			continue
+		}
+		configs := []*cloudprovider.NodeEgressIPConfiguration{}
+		if err := json.Unmarshal([]byte(annotation), &configs); err != nil {
+			klog.V(5).Infof("Not probing from node %q with an invalid egress IP configuration, err: %v", candidate.Name, err)
+			continue
+		}
+		for _, config := range configs {
+			if subnetsContain(ip, config.IFAddr.IPv4, config.IFAddr.IPv6) {
+				verifierNodes = append(verifierNodes, candidate.Name)
+				break
+			}
+		}
+	}
+	return verifierNodes, nil
+}
+
+func subnetsContain(ip net.IP, cidrs ...string) bool {
+	for _, cidr := range cidrs {
+		if _, subnet, err := net.ParseCIDR(cidr); err == nil && subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// newVerifierPod returns a verifier pod probing ip, scheduled on one of nodes.
+func (c *CloudPrivateIPConfigController) newVerifierPod(ip net.IP, nodes []string) *corev1.Pod {
+	activeDeadlineSeconds := int64(verifierPodTimeout / time.Second)
+	automountServiceAccountToken := false
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "cloud-network-config-verifier-",
+			Namespace:    c.verifyConfig.Namespace,
+			Labels:       map[string]string{verifierPodLabel: ""},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:  "verifier",
+				Image: c.verifyConfig.ProbeImage,
+				Command: []string{"cloud-network-config-controller", ProbeReachabilityCommand,
+					"-ip", ip.String(),
+					"-port", strconv.Itoa(c.verifyConfig.ProbePort),
+					"-timeout", c.verifyConfig.ProbeTimeout.String(),
+				},
+				TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+			}},
+			// The host network of the node, not the cluster's overlay.
+			HostNetwork: true,
+			Affinity: &corev1.Affinity{
+				NodeAffinity: &corev1.NodeAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+						NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+							MatchFields: []corev1.NodeSelectorRequirement{{
+								Key:      "metadata.name",
+								Operator: corev1.NodeSelectorOpIn,
+								Values:   nodes,
+							}},
+						}},
+					},
+				},
+			},
+			Tolerations:                  []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			RestartPolicy:                corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds:        &activeDeadlineSeconds,
+			AutomountServiceAccountToken: &automountServiceAccountToken,
+		},
+	}
+}
+
+// terminationMessage returns the termination message of the failed container
+// of pod, or the pod's status message if it didn't run, e.g. past its deadline.
+func terminationMessage(pod *corev1.Pod) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Terminated != nil && status.State.Terminated.Message != "" {
+			return status.State.Terminated.Message
+		}
+	}
+	return pod.Status.Message
+}
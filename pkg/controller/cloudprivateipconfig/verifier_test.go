@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	nodecontroller "github.com/openshift/cloud-network-config-controller/pkg/controller/node"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeinformers "k8s.io/client-go/informers"
+	fakekubeclient "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestProbeFromVerifierPod(t *testing.T) {
+	newNode := func(name, annotation string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: v1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{nodecontroller.NodeEgressIPConfigAnnotationKey: annotation},
+		}}
+	}
+	onSubnet := `[{"interface":"eth0","ifaddr":{"ipv4":"192.168.172.0/24"},"capacity":{"ip":10}}]`
+	offSubnet := `[{"interface":"eth0","ifaddr":{"ipv4":"10.0.0.0/24"},"capacity":{"ip":10}}]`
+
+	tcs := []struct {
+		name                  string
+		nodes                 []*corev1.Node
+		phase                 corev1.PodPhase
+		message               string
+		expectedVerifierNodes []string
+		err                   string
+	}{
+		{
+			name:                  "Should succeed if the verifier pod reached the IP address",
+			nodes:                 []*corev1.Node{newNode(nodeNameA, onSubnet), newNode(nodeNameB, onSubnet), newNode(nodeNameC, offSubnet)},
+			phase:                 corev1.PodSucceeded,
+			expectedVerifierNodes: []string{nodeNameB},
+		},
+		{
+			name:                  "Should fail if the verifier pod didn't reach the IP address",
+			nodes:                 []*corev1.Node{newNode(nodeNameA, onSubnet), newNode(nodeNameB, onSubnet)},
+			phase:                 corev1.PodFailed,
+			message:               "IP address 192.168.172.12 is unreachable on port 22",
+			expectedVerifierNodes: []string{nodeNameB},
+			err:                   "IP address 192.168.172.12 is unreachable on port 22",
+		},
+		{
+			name:  "Should not probe without another node on the network",
+			nodes: []*corev1.Node{newNode(nodeNameA, onSubnet), newNode(nodeNameC, offSubnet)},
+			err:   errNoVerifierNode.Error(),
+		},
+	}
+
+	for i, tc := range tcs {
+		kubeClient := fakekubeclient.NewSimpleClientset()
+		var created *corev1.Pod
+		kubeClient.PrependReactor("create", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+			created = action.(clienttesting.CreateAction).GetObject().(*corev1.Pod)
+			created.Name = created.GenerateName + "probe"
+			created.Status.Phase = tc.phase
+			created.Status.ContainerStatuses = []corev1.ContainerStatus{{
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: tc.message}},
+			}}
+			return false, nil, nil
+		})
+		nodeInformer := kubeinformers.NewSharedInformerFactory(kubeClient, 0).Core().V1().Nodes()
+		for _, node := range tc.nodes {
+			nodeInformer.Informer().GetStore().Add(node)
+		}
+		c := &CloudPrivateIPConfigController{
+			nodesLister: nodeInformer.Lister(),
+			verifyConfig: VerifyConfig{
+				ProbePort:    22,
+				ProbeTimeout: time.Second,
+				ProbeImage:   "cloud-network-config-controller",
+				Pods:         kubeClient.CoreV1(),
+				Namespace:    "openshift-cloud-network-config-controller",
+			},
+			ctx: context.TODO(),
+		}
+
+		err := c.probeFromVerifierPod(net.ParseIP("192.168.172.12"), tc.nodes[0])
+		if tc.err == "" && err != nil || tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Fatalf("TestProbeFromVerifierPod(%d): %s: expected error %q, got: %v", i, tc.name, tc.err, err)
+		}
+		if tc.expectedVerifierNodes == nil {
+			if created != nil {
+				t.Fatalf("TestProbeFromVerifierPod(%d): %s: expected no verifier pod, got %s", i, tc.name, created.Name)
+			}
+			continue
+		}
+		if created == nil {
+			t.Fatalf("TestProbeFromVerifierPod(%d): %s: expected a verifier pod", i, tc.name)
+		}
+		if nodes := created.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchFields[0].Values; !reflect.DeepEqual(nodes, tc.expectedVerifierNodes) {
+			t.Fatalf("TestProbeFromVerifierPod(%d): %s: expected the verifier pod on nodes %v, got %v", i, tc.name, tc.expectedVerifierNodes, nodes)
+		}
+		if !created.Spec.HostNetwork {
+			t.Fatalf("TestProbeFromVerifierPod(%d): %s: expected the verifier pod on the host network", i, tc.name)
+		}
+		if pods, _ := kubeClient.CoreV1().Pods(c.verifyConfig.Namespace).List(context.TODO(), v1.ListOptions{}); len(pods.Items) != 0 {
+			t.Fatalf("TestProbeFromVerifierPod(%d): %s: expected the verifier pod to be deleted", i, tc.name)
+		}
+	}
+}
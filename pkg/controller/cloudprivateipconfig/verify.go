@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	"github.com/openshift/cloud-network-config-controller/pkg/conditions"
+	"github.com/openshift/cloud-network-config-controller/pkg/tracing"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// VerifyConfig configures the verification of successful assignments.
+type VerifyConfig struct {
+	// Enabled turns verification on. The cloud is asked whether the
+	// assignment is effective, on top of having been accepted.
+	Enabled bool
+	// ProbePort is the TCP port the IP address is probed on, from a verifier
+	// pod on its network, once the cloud verification succeeded. The probe
+	// is skipped if 0.
+	ProbePort int
+	// ProbeTimeout is the timeout of the TCP probe.
+	ProbeTimeout time.Duration
+	// ProbeImage is the image of the verifier pods, the controller's: they
+	// run its ProbeReachabilityCommand.
+	ProbeImage string
+	// Pods and Namespace are the client and namespace the verifier pods are
+	// created with.
+	Pods      corev1client.PodsGetter
+	Namespace string
+	// ResyncPeriod is the period at which the IP addresses the cloud lists
+	// for each node are compared with the assigned CloudPrivateIPConfigs,
+	// see resyncCloudState. Disabled if 0.
+	ResyncPeriod time.Duration
+	// ResyncRepair re-assigns the IP addresses the resync finds missing,
+	// they're only reported otherwise.
+	ResyncRepair bool
+}
+
+// verifyAssignment verifies the assignment of ip to node if verification is
+// enabled and records the result as the Verified condition of status. The
+// result is purely informative: a failed verification doesn't requeue the
+// object, as re-issuing an assignment the cloud already accepted won't help.
+// The reachability of verified assignments is then probed in the background,
+// see enqueueReachabilityProbe.
+func (c *CloudPrivateIPConfigController) verifyAssignment(ctx context.Context, cloudPrivateIPConfig *cloudnetworkv1.CloudPrivateIPConfig, status *cloudnetworkv1.CloudPrivateIPConfigStatus, ip net.IP, node *corev1.Node) *cloudnetworkv1.CloudPrivateIPConfigStatus {
+	if !c.verifyConfig.Enabled {
+		return status
+	}
+	verified := conditions.New(conditions.Verified, metav1.ConditionTrue, cloudPrivateIPConfig.Generation, conditions.ReasonVerificationSucceeded, "IP address assignment verified")
+	cloudCtx, span := startCloudSpan(ctx, "VerifyPrivateIP", ip, node)
+	err := c.cloudProviderClient.VerifyPrivateIP(cloudCtx, ip, node)
+	tracing.End(span, err)
+	if err != nil {
+		verified = conditions.New(conditions.Verified, metav1.ConditionFalse, cloudPrivateIPConfig.Generation, conditions.ReasonCloudVerificationFailed, fmt.Sprintf("Error verifying assignment on the cloud, err: %v", err))
+	}
+	// The cloud may not report the assignment accurately while under
+	// maintenance, don't raise a failure for it.
+	if end, ok := c.maintenanceWindows.Active(time.Now()); ok && verified.Status == metav1.ConditionFalse {
+		klog.Infof("Could not verify assignment of IP address %s to node %q for CloudPrivateIPConfig: %q during a cloud maintenance window: %s", ip, node.Name, cloudPrivateIPConfig.Name, verified.Message)
+		verified = conditions.New(conditions.Verified, metav1.ConditionUnknown, cloudPrivateIPConfig.Generation, conditions.ReasonMaintenanceWindow,
+			fmt.Sprintf("Verification inconclusive during the cloud maintenance window ending at %s: %s", end.Format(time.RFC3339), verified.Message))
+	}
+	if verified.Status == metav1.ConditionTrue {
+		c.enqueueReachabilityProbe(cloudPrivateIPConfig.Name, cloudPrivateIPConfig.Generation, ip, node.Name)
+	}
+	if verified.Status == metav1.ConditionFalse {
+		klog.Warningf("Could not verify assignment of IP address %s to node %q for CloudPrivateIPConfig: %q: %s", ip, node.Name, cloudPrivateIPConfig.Name, verified.Message)
+	}
+	status.Conditions = conditions.Set(conditions.KindCloudPrivateIPConfig, status.Conditions, verified)
+	return status
+}
+
+// ProbeTCP tries to open a TCP connection to port on ip. A refused
+// connection still proves that the IP address is reachable: something on the
+// other end answered, it just doesn't listen on port. It's run by the
+// verifier pods, see ProbeReachabilityCommand.
+func ProbeTCP(ip net.IP, port int, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port)), timeout)
+	if err != nil {
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return nil
+		}
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProbeTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listeningPort := listener.Addr().(*net.TCPAddr).Port
+
+	// Grab a port, then free it, so that nothing listens on it anymore.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+	defer listener.Close()
+
+	for i, port := range []int{listeningPort, closedPort} {
+		// A refused connection still proves reachability.
+		if err := ProbeTCP(net.ParseIP("127.0.0.1"), port, time.Second); err != nil {
+			t.Fatalf("TestProbeTCP(%d): expected 127.0.0.1:%d to be reachable, err: %q", i, port, err)
+		}
+	}
+}
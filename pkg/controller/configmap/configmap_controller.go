@@ -31,6 +31,9 @@ type ConfigMapController struct {
 	// cancel the global context, stop the leader election and subsequently
 	// initiate a shut down of all control loops
 	controllerCancel context.CancelFunc
+	// validator validates the rotated credentials before the global context
+	// is cancelled, nil if they're not validated
+	validator *controller.CredentialValidator
 }
 
 // NewConfigMapController returns a new ConfigMap controller
@@ -39,11 +42,13 @@ func NewConfigMapController(
 	controllerCancel context.CancelFunc,
 	kubeClientset kubernetes.Interface,
 	configMapInformer coreinformers.ConfigMapInformer,
-	configMapName, configMapNamespace string) *controller.CloudNetworkConfigController {
+	configMapName, configMapNamespace string,
+	validator *controller.CredentialValidator) *controller.CloudNetworkConfigController {
 
 	configMapController := &ConfigMapController{
 		configMapLister:  configMapInformer.Lister(),
 		controllerCancel: controllerCancel,
+		validator:        validator,
 	}
 
 	controller := controller.NewCloudNetworkConfigController(
@@ -94,8 +99,17 @@ func NewConfigMapController(
 
 // syncHandler does *not* compare the actual state with the desired, it's
 // triggered on a configMap.data change or configMap deletion and cancels the global
-// context forcing us to re-initialize the cloud credentials on restart.
-func (s *ConfigMapController) SyncHandler(key string) error {
+// context forcing us to re-initialize the cloud credentials on restart. If a
+// validator is set the context is only cancelled once the rotated credentials
+// are validated, until then the object is requeued and we keep serving with
+// the current ones.
+func (s *ConfigMapController) SyncHandler(_ context.Context, key string) error {
+	if s.validator != nil {
+		if err := s.validator.Validate(); err != nil {
+			klog.Warningf("Keeping the current cloud API credentials, err: %v", err)
+			return err
+		}
+	}
 	s.shutdown()
 	return nil
 }
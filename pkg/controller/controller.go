@@ -1,10 +1,18 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"reflect"
+	"sync"
 	"time"
 
+	"github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	"github.com/openshift/cloud-network-config-controller/pkg/maintenance"
+	"github.com/openshift/cloud-network-config-controller/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
@@ -13,8 +21,8 @@ import (
 )
 
 const (
-	// maxRetries is the number of times a object will be retried before it is dropped out of the queue.
-	// With the current rate-limiter in use (5ms*2^(maxRetries-1)) the following numbers represent the
+	// maxRetries is the default number of times a object will be retried before it is dropped out of the queue.
+	// With the default retry policy (5ms*2^(maxRetries-1)) the following numbers represent the
 	// sequence of delays between successive queueing of an object.
 	//
 	// 5ms, 10ms, 20ms, 40ms, 80ms, 160ms, 320ms, 640ms, 1.3s, 2.6s, 5.1s, 10.2s, 20.4s, 41s, 82s
@@ -34,7 +42,10 @@ const (
 )
 
 type CloudNetworkConfigControllerIntf interface {
-	SyncHandler(key string) error
+	// SyncHandler processes the object of key. ctx carries the span of the
+	// sync, for the handler to trace the operations it performs on behalf
+	// of it; it's never cancelled.
+	SyncHandler(ctx context.Context, key string) error
 }
 
 type CloudNetworkConfigController struct {
@@ -49,6 +60,8 @@ type CloudNetworkConfigController struct {
 	// time, and makes it easy to ensure we are never processing the same item
 	// simultaneously in two different workers.
 	workqueue workqueue.RateLimitingInterface
+	// rateLimiter delays the retries of the workqueue following RetryPolicy
+	rateLimiter *retryRateLimiter
 	// Synced contains all required resource informers for a controller
 	// to run
 	synced []cache.InformerSynced
@@ -57,6 +70,51 @@ type CloudNetworkConfigController struct {
 	controllerKey string
 	// controllerType is the generic type watched for by the controller
 	controllerType reflect.Type
+	// StartupResyncWindow spreads the processing of the objects listed when
+	// the controller starts over that window, instead of processing them all
+	// at once. Each object is delayed by a fixed fraction of the window,
+	// derived from the hash of its key, so that the order is the same on
+	// every start. Disabled if 0.
+	StartupResyncWindow time.Duration
+	// Store, if set, is the store of the informer of the controller's objects.
+	// The objects it holds once the informer synced are the ones listed on
+	// startup: the event handlers may still be handed some of them after
+	// HasSynced returns true, which StartupResyncWindow delays as well.
+	Store cache.KeyLister
+	// startup tracks the objects listed on startup for StartupResyncWindow
+	startup startupList
+	// OnDrop, if set, is called with the last error of a key which is dropped
+	// from the workqueue after failing maxRetries times. The key is only
+	// processed again on the next change of its object.
+	OnDrop func(key string, err error)
+	// MaintenanceWindows are the planned maintenance windows of the cloud.
+	// Keys failing maxRetries times during a window are not dropped, but
+	// processed again once the window ends.
+	MaintenanceWindows maintenance.Windows
+	// Resync, if set, is called every ResyncPeriod once the workers are
+	// started, the first time after a full period. It's meant for periodic
+	// work spanning all objects, which the workqueue can't express, e.g.
+	// comparing them with the actual state of the cloud.
+	Resync       func()
+	ResyncPeriod time.Duration
+	// RetryPolicy configures the retries of keys failing to sync, it's
+	// DefaultRetryPolicy unless set otherwise.
+	RetryPolicy RetryPolicy
+	// progress tracks the keys being processed and when the last one was
+	// done, for the liveness probe to detect stuck workers.
+	progress progress
+}
+
+// DeferredError is returned by sync handlers deferring the processing of a key
+// until a given time. The key is then processed again at that time, without
+// counting as a failure.
+type DeferredError struct {
+	Until  time.Time
+	Reason string
+}
+
+func (e *DeferredError) Error() string {
+	return fmt.Sprintf("%s, deferred until %s", e.Reason, e.Until.Format(time.RFC3339))
 }
 
 func NewCloudNetworkConfigController(
@@ -65,15 +123,17 @@ func NewCloudNetworkConfigController(
 	resourceControllerKey string,
 	resourceControllerType reflect.Type) *CloudNetworkConfigController {
 
-	workqueue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), resourceControllerKey)
-
-	return &CloudNetworkConfigController{
-		workqueue:                        workqueue,
+	c := &CloudNetworkConfigController{
 		synced:                           syncs,
 		CloudNetworkConfigControllerIntf: resourceController,
 		controllerKey:                    resourceControllerKey,
 		controllerType:                   resourceControllerType,
+		RetryPolicy:                      DefaultRetryPolicy(),
 	}
+	c.progress.last = time.Now()
+	c.rateLimiter = newRetryRateLimiter(func() RetryPolicy { return c.RetryPolicy })
+	c.workqueue = workqueue.NewNamedRateLimitingQueue(c.rateLimiter, resourceControllerKey)
+	return c
 }
 
 // Run will set up the event handlers for types we are interested in, as well
@@ -99,6 +159,17 @@ func (c *CloudNetworkConfigController) Run(stopCh <-chan struct{}) error {
 		go wait.Until(c.runWorker, time.Second, stopCh)
 	}
 
+	if c.Resync != nil && c.ResyncPeriod > 0 {
+		go func() {
+			select {
+			case <-time.After(c.ResyncPeriod):
+			case <-stopCh:
+				return
+			}
+			wait.Until(c.Resync, c.ResyncPeriod, stopCh)
+		}()
+	}
+
 	klog.Infof("Started %s workers", c.controllerKey)
 	<-stopCh
 	klog.Infof("Shutting down %s workers", c.controllerKey)
@@ -122,6 +193,8 @@ func (c *CloudNetworkConfigController) processNextWorkItem() bool {
 	if shutdown {
 		return false
 	}
+	c.progress.start()
+	defer c.progress.done()
 
 	// We wrap this block in a func so we can defer c.workqueue.Done.
 	err := func(obj interface{}) error {
@@ -149,12 +222,41 @@ func (c *CloudNetworkConfigController) processNextWorkItem() bool {
 		}
 		// Run the syncHandler, passing it the namespace/name string of the
 		// Foo resource to be synced.
-		if err := c.SyncHandler(key); err != nil && c.workqueue.NumRequeues(key) <= maxRetries {
-			// Put the item back on the workqueue to handle any transient errors.
-			c.workqueue.AddRateLimited(key)
-			return fmt.Errorf("error syncing '%s': %s, requeuing in %s workqueue", key, err.Error(), c.controllerKey)
+		ctx, span := tracing.Start(context.Background(), c.controllerKey+" sync",
+			attribute.String("controller", c.controllerKey),
+			attribute.String("key", key),
+			attribute.Int("requeues", c.workqueue.NumRequeues(key)),
+		)
+		err := c.SyncHandler(ctx, key)
+		tracing.End(span, err)
+		if err != nil {
+			var deferredErr *DeferredError
+			if errors.As(err, &deferredErr) {
+				c.workqueue.Forget(obj)
+				c.workqueue.AddAfter(key, time.Until(deferredErr.Until))
+				klog.Infof("Deferring key '%s' in %s workqueue: %v", key, c.controllerKey, deferredErr)
+				return nil
+			}
+			if c.workqueue.NumRequeues(key) <= c.RetryPolicy.MaxRetries {
+				// Put the item back on the workqueue to handle any transient
+				// errors, later for those needing intervention.
+				c.rateLimiter.classify(key, cloudprovider.NeedsIntervention(err))
+				c.workqueue.AddRateLimited(key)
+				return fmt.Errorf("error syncing '%s': %s, requeuing in %s workqueue", key, err.Error(), c.controllerKey)
+			}
+			// Failures are expected while the cloud is under maintenance,
+			// start over once it's over.
+			if end, ok := c.MaintenanceWindows.Active(time.Now()); ok {
+				c.workqueue.Forget(obj)
+				c.workqueue.AddAfter(key, time.Until(end))
+				klog.Warningf("Error syncing '%s' during a cloud maintenance window: %s, requeuing in %s workqueue once it ends at %s", key, err.Error(), c.controllerKey, end.Format(time.RFC3339))
+				return nil
+			}
+			if c.OnDrop != nil {
+				c.OnDrop(key, err)
+			}
 		}
-		// Finally, if no error occurs or if we supersede maxRetries we Forget
+		// Finally, if no error occurs or if we supersede MaxRetries we Forget
 		// this item so it does not get queued again until another change happens.
 		c.workqueue.Forget(obj)
 		klog.Infof("Dropping key '%s' from the %s workqueue", key, c.controllerKey)
@@ -179,6 +281,12 @@ func (c *CloudNetworkConfigController) Enqueue(obj interface{}) {
 			klog.Error(err)
 			return
 		}
+		if c.StartupResyncWindow > 0 && c.isInInitialList(key) {
+			delay := startupResyncDelay(key, c.StartupResyncWindow)
+			klog.Infof("Assigning key: %s to %s workqueue in %s", key, c.controllerKey, delay)
+			c.workqueue.AddAfter(key, delay)
+			return
+		}
 		klog.Infof("Assigning key: %s to %s workqueue", key, c.controllerKey)
 		c.workqueue.Add(key)
 		return
@@ -200,3 +308,68 @@ func (c *CloudNetworkConfigController) Enqueue(obj interface{}) {
 	klog.Infof("Recovered key: %s and assigning to %s workqueue", key, c.controllerKey)
 	c.workqueue.Add(key)
 }
+
+// hasSynced returns true once all informers of the controller have synced,
+// i.e: the objects listed on startup have been handed over.
+func (c *CloudNetworkConfigController) hasSynced() bool {
+	for _, synced := range c.synced {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// startupList tracks the keys of the objects listed on startup which weren't
+// enqueued yet.
+type startupList struct {
+	sync.Mutex
+	// enqueued are the keys enqueued before the informers synced.
+	enqueued map[string]bool
+	// pending are the keys in the store once the informers synced, minus the
+	// enqueued ones, nil until then.
+	pending map[string]bool
+	done    bool
+}
+
+// isInInitialList returns true if key is of an object listed on startup, until
+// it's first enqueued. Before the informers synced, that's any key. Once they
+// did, it's the keys in Store at the time which weren't enqueued yet, since
+// HasSynced doesn't wait for the event handlers to be handed all objects.
+func (c *CloudNetworkConfigController) isInInitialList(key string) bool {
+	c.startup.Lock()
+	defer c.startup.Unlock()
+	if c.startup.done {
+		return false
+	}
+	if !c.hasSynced() {
+		if c.startup.enqueued == nil {
+			c.startup.enqueued = map[string]bool{}
+		}
+		c.startup.enqueued[key] = true
+		return true
+	}
+	if c.startup.pending == nil {
+		c.startup.pending = map[string]bool{}
+		if c.Store != nil {
+			for _, listed := range c.Store.ListKeys() {
+				if !c.startup.enqueued[listed] {
+					c.startup.pending[listed] = true
+				}
+			}
+		}
+		c.startup.enqueued = nil
+	}
+	pending := c.startup.pending[key]
+	delete(c.startup.pending, key)
+	c.startup.done = len(c.startup.pending) == 0
+	return pending
+}
+
+// startupResyncDelay maps key to a delay within window, uniformly distributed
+// over the keys and always the same for a given key.
+func startupResyncDelay(key string, window time.Duration) time.Duration {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return time.Duration(uint64(h.Sum32()) * uint64(window) >> 32)
+}
@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openshift/cloud-network-config-controller/pkg/maintenance"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestStartupResyncDelay(t *testing.T) {
+	window := 10 * time.Minute
+	for i, key := range []string{"node-a", "node-b", "192.0.2.1", "2001:db8::1"} {
+		delay := startupResyncDelay(key, window)
+		if delay < 0 || delay >= window {
+			t.Fatalf("TestStartupResyncDelay(%d): expected delay of %q within [0, %s), got %s", i, key, window, delay)
+		}
+		if again := startupResyncDelay(key, window); again != delay {
+			t.Fatalf("TestStartupResyncDelay(%d): expected delay of %q to be deterministic, got %s and %s", i, key, delay, again)
+		}
+	}
+	if startupResyncDelay("node-a", window) == startupResyncDelay("node-b", window) {
+		t.Fatalf("TestStartupResyncDelay: expected different keys to be spread over the window")
+	}
+}
+
+func TestIsInInitialList(t *testing.T) {
+	synced := false
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	c := NewCloudNetworkConfigController([]cache.InformerSynced{func() bool { return synced }}, syncHandlerFunc(func(string) error { return nil }), "test", reflect.TypeOf(""))
+	c.Store = store
+	defer c.workqueue.ShutDown()
+
+	// Before the informer synced, any key is of the initial list.
+	for _, name := range []string{"node-a", "node-b"} {
+		store.Add(&metav1.ObjectMeta{Name: name})
+	}
+	if !c.isInInitialList("node-a") {
+		t.Fatalf("TestIsInInitialList: expected node-a to be of the initial list before the informer synced")
+	}
+	// The informer synced, the adds of node-b and node-c weren't handed over
+	// yet.
+	store.Add(&metav1.ObjectMeta{Name: "node-c"})
+	synced = true
+	for _, key := range []string{"node-b", "node-c"} {
+		if !c.isInInitialList(key) {
+			t.Fatalf("TestIsInInitialList: expected %s to be of the initial list once the informer synced", key)
+		}
+	}
+	// Keys already enqueued are not, nor those of objects added since.
+	for _, key := range []string{"node-a", "node-b", "node-d"} {
+		if c.isInInitialList(key) {
+			t.Fatalf("TestIsInInitialList: expected %s not to be of the initial list", key)
+		}
+	}
+	if !c.startup.done {
+		t.Fatalf("TestIsInInitialList: expected the initial list to be done")
+	}
+}
+
+// exhaustedRateLimiter reports every key as having been retried maxRetries
+// times already, until forgotten.
+type exhaustedRateLimiter struct {
+	forgotten map[interface{}]bool
+}
+
+func (r *exhaustedRateLimiter) When(item interface{}) time.Duration {
+	return time.Hour
+}
+
+func (r *exhaustedRateLimiter) Forget(item interface{}) {
+	r.forgotten[item] = true
+}
+
+func (r *exhaustedRateLimiter) NumRequeues(item interface{}) int {
+	if r.forgotten[item] {
+		return 0
+	}
+	return maxRetries + 1
+}
+
+type syncHandlerFunc func(key string) error
+
+func (f syncHandlerFunc) SyncHandler(_ context.Context, key string) error {
+	return f(key)
+}
+
+func TestProcessNextWorkItemMaintenance(t *testing.T) {
+	window, err := maintenance.ParseWindow("* * * * *", "1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alwaysActive := maintenance.Windows{window}
+	tcs := []struct {
+		err     error
+		windows maintenance.Windows
+		dropped bool
+	}{
+		// Deferred keys are requeued without counting as a failure.
+		{err: &DeferredError{Until: time.Now().Add(time.Hour), Reason: "test"}},
+		// Keys failing during a maintenance window are requeued once it ends.
+		{err: errors.New("cloud unavailable"), windows: alwaysActive},
+		// Keys failing otherwise are dropped.
+		{err: errors.New("cloud unavailable"), dropped: true},
+	}
+	for i, tc := range tcs {
+		var dropped bool
+		c := NewCloudNetworkConfigController(nil, syncHandlerFunc(func(string) error { return tc.err }), "test", reflect.TypeOf(""))
+		c.MaintenanceWindows = tc.windows
+		c.OnDrop = func(string, error) { dropped = true }
+		c.workqueue = workqueue.NewRateLimitingQueue(&exhaustedRateLimiter{forgotten: map[interface{}]bool{}})
+		c.workqueue.Add("key")
+		c.processNextWorkItem()
+		if dropped != tc.dropped {
+			t.Fatalf("TestProcessNextWorkItemMaintenance(%d): expected dropped %t, got %t", i, tc.dropped, dropped)
+		}
+		if requeues := c.workqueue.NumRequeues("key"); requeues != 0 {
+			t.Fatalf("TestProcessNextWorkItemMaintenance(%d): expected the failures to be forgotten, got %d requeues", i, requeues)
+		}
+		// Requeued keys are only added back once the window ends.
+		if c.workqueue.Len() != 0 {
+			t.Fatalf("TestProcessNextWorkItemMaintenance(%d): expected the key not to be requeued immediately", i)
+		}
+		c.workqueue.ShutDown()
+	}
+}
+
+func TestRunResync(t *testing.T) {
+	resynced := make(chan struct{}, 2)
+	c := NewCloudNetworkConfigController(nil, syncHandlerFunc(func(string) error { return nil }), "test", reflect.TypeOf(""))
+	c.Resync = func() {
+		select {
+		case resynced <- struct{}{}:
+		default:
+		}
+	}
+	c.ResyncPeriod = 10 * time.Millisecond
+	stopCh := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- c.Run(stopCh) }()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-resynced:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected the resync to be called periodically")
+		}
+	}
+	close(stopCh)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error, err: %v", err)
+	}
+}
+
+func TestProcessNextWorkItemRetryPolicy(t *testing.T) {
+	var dropped bool
+	c := NewCloudNetworkConfigController(nil, syncHandlerFunc(func(string) error { return errors.New("QuotaExceeded: too many addresses") }), "test", reflect.TypeOf(""))
+	c.RetryPolicy.MaxRetries = 1
+	c.RetryPolicy.InterventionBaseDelay = time.Hour
+	c.OnDrop = func(string, error) { dropped = true }
+	defer c.workqueue.ShutDown()
+
+	c.workqueue.Add("key")
+	c.processNextWorkItem()
+	// The key is retried once the delay of errors needing intervention
+	// elapsed, not immediately.
+	if requeues := c.workqueue.NumRequeues("key"); requeues != 1 || !c.rateLimiter.needsIntervention["key"] {
+		t.Fatalf("TestProcessNextWorkItemRetryPolicy: expected a retry of an error needing intervention, got %d requeues", requeues)
+	}
+	if c.workqueue.Len() != 0 {
+		t.Fatalf("TestProcessNextWorkItemRetryPolicy: expected the key not to be requeued immediately")
+	}
+	// Processing it again exhausts the retries.
+	c.workqueue.Add("key")
+	c.processNextWorkItem()
+	c.workqueue.Add("key")
+	c.processNextWorkItem()
+	if !dropped {
+		t.Fatalf("TestProcessNextWorkItemRetryPolicy: expected the key to be dropped after MaxRetries")
+	}
+}
+
+func TestStuck(t *testing.T) {
+	block := make(chan struct{})
+	c := NewCloudNetworkConfigController(nil, syncHandlerFunc(func(string) error { <-block; return nil }), "test", reflect.TypeOf(""))
+	defer c.workqueue.ShutDown()
+
+	// An idle controller is never stuck, however long ago it last made
+	// progress.
+	c.progress.last = time.Now().Add(-time.Hour)
+	if err := c.Stuck(time.Minute); err != nil {
+		t.Fatalf("TestStuck: expected an idle controller not to be stuck, got: %v", err)
+	}
+	c.workqueue.Add("key")
+	done := make(chan bool)
+	go func() { done <- c.processNextWorkItem() }()
+	for c.workqueue.Len() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := c.Stuck(time.Minute); err != nil {
+		t.Fatalf("TestStuck: expected a controller which just picked up work not to be stuck, got: %v", err)
+	}
+	if err := c.Stuck(0); err == nil {
+		t.Fatalf("TestStuck: expected a controller processing a key without progress to be stuck")
+	}
+	close(block)
+	<-done
+	if err := c.Stuck(0); err != nil {
+		t.Fatalf("TestStuck: expected a controller done processing not to be stuck, got: %v", err)
+	}
+}
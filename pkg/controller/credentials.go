@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// CredentialValidator validates the cloud credentials and the CA bundle
+// currently stored on the API server, before the controller restarts to pick
+// them up. Both are validated together, in a side client, so that a CA bundle
+// and credentials rotated near-simultaneously never leave the controller with
+// a pair it can't talk to the cloud with: until validation passes the
+// controller keeps serving with the pair it was started with.
+type CredentialValidator struct {
+	// PlatformCfg is the configuration the controller was started with.
+	PlatformCfg cloudprovider.CloudProviderConfig
+	// SecretLister and SecretName identify the cloud credentials secret,
+	// mounted in PlatformCfg.CredentialDir.
+	SecretLister corelisters.SecretLister
+	SecretName   string
+	// ConfigMapLister and ConfigMapName identify the cloud config map,
+	// mounted in PlatformCfg.ConfigDir. The CA bundle isn't validated if
+	// ConfigMapLister is nil.
+	ConfigMapLister corelisters.ConfigMapLister
+	ConfigMapName   string
+	// Namespace is the namespace of the secret and the config map.
+	Namespace string
+	// NodeLister is used to pick the node the side client is probed on.
+	NodeLister corelisters.NodeLister
+}
+
+// Validate returns nil if the controller can restart with the credentials and
+// CA bundle stored on the API server: a side client built out of them is able
+// to talk to the cloud and the kubelet already updated the mounted copies the
+// controller will read on restart. A deleted secret or config map can't be
+// validated, in that case Validate returns nil as well.
+func (v *CredentialValidator) Validate() error {
+	secret, err := v.SecretLister.Secrets(v.Namespace).Get(v.SecretName)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error retrieving secret %s/%s, err: %v", v.Namespace, v.SecretName, err)
+	}
+	configData := map[string][]byte{}
+	if v.ConfigMapLister != nil {
+		configMap, err := v.ConfigMapLister.ConfigMaps(v.Namespace).Get(v.ConfigMapName)
+		if apierrors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("error retrieving config map %s/%s, err: %v", v.Namespace, v.ConfigMapName, err)
+		}
+		for key, value := range configMap.Data {
+			configData[key] = []byte(value)
+		}
+		for key, value := range configMap.BinaryData {
+			configData[key] = value
+		}
+	}
+
+	if err := v.validateSideClient(secret.Data, configData); err != nil {
+		return fmt.Errorf("error validating rotated cloud credentials, err: %v", err)
+	}
+	if err := mountedDataMatches(v.PlatformCfg.CredentialDir, secret.Data); err != nil {
+		return err
+	}
+	if v.ConfigMapLister != nil {
+		if err := mountedDataMatches(v.PlatformCfg.ConfigDir, configData); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateSideClient authenticates a lightweight, read-only cloud provider
+// client with credentialData and configData and probes it on one node. The
+// client starts no background work, so that failed validations can be retried
+// at will.
+func (v *CredentialValidator) validateSideClient(credentialData, configData map[string][]byte) error {
+	credentialDir, err := writeDataDir(credentialData)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(credentialDir)
+	cfg := v.PlatformCfg
+	cfg.CredentialDir = credentialDir
+	if v.ConfigMapLister != nil {
+		configDir, err := writeDataDir(configData)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(configDir)
+		if cfg.AWSCAOverride != "" && strings.HasPrefix(cfg.AWSCAOverride, filepath.Clean(cfg.ConfigDir)+string(filepath.Separator)) {
+			cfg.AWSCAOverride = filepath.Join(configDir, strings.TrimPrefix(cfg.AWSCAOverride, filepath.Clean(cfg.ConfigDir)))
+		}
+		cfg.ConfigDir = configDir
+	}
+
+	cloudProviderClient, err := cloudprovider.NewCredentialValidationClient(cfg)
+	if err != nil {
+		return err
+	}
+	nodes, err := v.NodeLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("error listing nodes, err: %v", err)
+	}
+	for _, node := range nodes {
+		if node.Spec.ProviderID == "" {
+			continue
+		}
+		if err := cloudProviderClient.CheckHealth(context.Background(), node); err != nil {
+			return fmt.Errorf("error probing the cloud on node %q, err: %v", node.Name, err)
+		}
+		klog.Infof("Validated rotated cloud credentials on node %q", node.Name)
+		return nil
+	}
+	klog.Warning("No node to validate rotated cloud credentials on, only the client initialization was validated")
+	return nil
+}
+
+// writeDataDir writes data into a new temporary directory, one file per key.
+func writeDataDir(data map[string][]byte) (string, error) {
+	dir, err := ioutil.TempDir("", "cloud-credentials-")
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary directory, err: %v", err)
+	}
+	for key, value := range data {
+		if err := ioutil.WriteFile(filepath.Join(dir, key), value, 0600); err != nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("error writing %s, err: %v", key, err)
+		}
+	}
+	return dir, nil
+}
+
+// mountedDataMatches returns an error if the files mounted in dir don't hold
+// data yet. The kubelet updates mounted secrets and config maps with a delay,
+// restarting before it did would just pick up the old data again.
+func mountedDataMatches(dir string, data map[string][]byte) error {
+	for key, value := range data {
+		mounted, err := ioutil.ReadFile(filepath.Join(dir, key))
+		if err != nil || !bytes.Equal(mounted, value) {
+			return fmt.Errorf("mounted %s isn't updated yet", filepath.Join(dir, key))
+		}
+	}
+	return nil
+}
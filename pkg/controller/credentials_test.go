@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestCredentialValidatorValidate(t *testing.T) {
+	secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	validator := &CredentialValidator{
+		PlatformCfg:  cloudprovider.CloudProviderConfig{PlatformType: "unsupported"},
+		SecretLister: corelisters.NewSecretLister(secrets),
+		SecretName:   "cloud-credentials",
+		Namespace:    "openshift-cloud-network-config-controller",
+		NodeLister:   corelisters.NewNodeLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+	}
+
+	// A deleted secret can't be validated, the controller restarts.
+	if err := validator.Validate(); err != nil {
+		t.Fatalf("TestCredentialValidatorValidate(0): expected no error for a deleted secret, err: %q", err)
+	}
+
+	// Credentials a client can't be built out of are refused.
+	secrets.Add(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: validator.SecretName, Namespace: validator.Namespace},
+		Data:       map[string][]byte{"credentials": []byte("rotated")},
+	})
+	if err := validator.Validate(); err == nil {
+		t.Fatalf("TestCredentialValidatorValidate(1): expected an error for an unsupported platform")
+	}
+}
+
+func TestMountedDataMatches(t *testing.T) {
+	data := map[string][]byte{"credentials": []byte("rotated")}
+	dir, err := writeDataDir(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := mountedDataMatches(dir, data); err != nil {
+		t.Fatalf("TestMountedDataMatches(0): expected mounted data to match, err: %q", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "credentials"), []byte("previous"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := mountedDataMatches(dir, data); err == nil {
+		t.Fatalf("TestMountedDataMatches(1): expected an error for outdated mounted data")
+	}
+	if err := mountedDataMatches(dir, map[string][]byte{"ca-bundle.pem": []byte("ca")}); err == nil {
+		t.Fatalf("TestMountedDataMatches(2): expected an error for missing mounted data")
+	}
+}
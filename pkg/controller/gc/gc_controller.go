@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	cloudnetworkinformers "github.com/openshift/client-go/cloudnetwork/informers/externalversions/cloudnetwork/v1"
+	cloudnetworklisters "github.com/openshift/client-go/cloudnetwork/listers/cloudnetwork/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	cloudprivateipconfigcontroller "github.com/openshift/cloud-network-config-controller/pkg/controller/cloudprivateipconfig"
+	"github.com/openshift/cloud-network-config-controller/pkg/maintenance"
+	"github.com/openshift/cloud-network-config-controller/pkg/metrics"
+)
+
+var orphanedResourcesDeletedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Name:      "orphaned_resources_deleted_total",
+	Help:      "Number of cloud resources owned by the controller deleted by the garbage collector because no CloudPrivateIPConfig or node used them anymore.",
+}, []string{"kind"})
+
+func init() {
+	metrics.Registry.MustRegister(orphanedResourcesDeletedTotal)
+}
+
+// GarbageCollector periodically deletes the cloud resources the controller
+// created for assignments which no CloudPrivateIPConfig or node uses
+// anymore, e.g. those left behind by failed rollbacks or by releases which
+// never completed.
+type GarbageCollector struct {
+	// cloudProviderClient is a client interface allowing the garbage
+	// collector access to the cloud API
+	cloudProviderClient        cloudprovider.CloudProviderIntf
+	cloudPrivateIPConfigLister cloudnetworklisters.CloudPrivateIPConfigLister
+	nodesLister                corelisters.NodeLister
+	synced                     []cache.InformerSynced
+	// period is the period at which the owned resources are listed
+	period time.Duration
+	// gracePeriod is how long a resource must be seen orphaned before it's
+	// deleted, so that the assignments being processed meanwhile, whose
+	// objects the listers may not know about yet, aren't raced
+	gracePeriod time.Duration
+	// maintenanceWindows defer the deletions on the cloud
+	maintenanceWindows maintenance.Windows
+	// orphanedSince holds when each orphaned resource was first seen
+	// orphaned, keyed by ID. Only the garbage collector's loop uses it.
+	orphanedSince map[string]time.Time
+}
+
+// NewGarbageCollector returns a new garbage collector of the cloud resources
+// owned by the controller
+func NewGarbageCollector(
+	cloudProviderClient cloudprovider.CloudProviderIntf,
+	cloudPrivateIPConfigInformer cloudnetworkinformers.CloudPrivateIPConfigInformer,
+	nodeInformer coreinformers.NodeInformer,
+	maintenanceWindows maintenance.Windows,
+	period, gracePeriod time.Duration) *GarbageCollector {
+
+	return &GarbageCollector{
+		cloudProviderClient:        cloudProviderClient,
+		cloudPrivateIPConfigLister: cloudPrivateIPConfigInformer.Lister(),
+		nodesLister:                nodeInformer.Lister(),
+		synced: []cache.InformerSynced{
+			cloudPrivateIPConfigInformer.Informer().HasSynced,
+			nodeInformer.Informer().HasSynced,
+		},
+		period:             period,
+		gracePeriod:        gracePeriod,
+		maintenanceWindows: maintenanceWindows,
+		orphanedSince:      map[string]time.Time{},
+	}
+}
+
+// Run collects the orphaned resources at the garbage collector's period until
+// stopCh is closed. It returns immediately if the period is 0.
+func (g *GarbageCollector) Run(stopCh <-chan struct{}) {
+	if g.period == 0 {
+		return
+	}
+	if !cache.WaitForCacheSync(stopCh, g.synced...) {
+		return
+	}
+	klog.Infof("Starting the garbage collector of orphaned cloud resources, every %s with a grace period of %s", g.period, g.gracePeriod)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	wait.Until(func() {
+		// The first collection runs right away, so does this.
+		if _, err := g.collect(time.Now()); errors.Is(err, cloudprovider.OwnedResourcesUnsupportedError) {
+			klog.Warningf("Stopping the garbage collector of orphaned cloud resources, it's unsupported on this cloud: %v", err)
+			cancel()
+		}
+	}, g.period, ctx.Done())
+}
+
+// collect lists the resources the cloud provider owns for the nodes and
+// deletes those orphaned for at least the grace period before now. A resource
+// is orphaned if no CloudPrivateIPConfig exists for its IP address anymore.
+// The node a resource belongs to doesn't tell: the resources of an IP address
+// which moved stay with the node they were created for, which may since have
+// been deleted, while the IP address is in use on the status.node of its
+// CloudPrivateIPConfig. The CloudPrivateIPConfig controller releases those.
+// It returns the deleted resources, and the error listing the resources.
+func (g *GarbageCollector) collect(now time.Time) ([]cloudprovider.OwnedResource, error) {
+	if end, ok := g.maintenanceWindows.Active(now); ok {
+		klog.Infof("Skipping the garbage collection of orphaned cloud resources during a cloud maintenance window ending at %s", end.Format(time.RFC3339))
+		return nil, nil
+	}
+	// List the nodes before the CloudPrivateIPConfigs, so that the resources
+	// of an object created for a node created meanwhile aren't orphaned.
+	nodes, err := g.nodesLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Error listing nodes for the garbage collection of orphaned cloud resources, err: %v", err)
+		return nil, nil
+	}
+	cloudPrivateIPConfigs, err := g.cloudPrivateIPConfigLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Error listing CloudPrivateIPConfigs for the garbage collection of orphaned cloud resources, err: %v", err)
+		return nil, nil
+	}
+	used := map[string]bool{}
+	for _, cloudPrivateIPConfig := range cloudPrivateIPConfigs {
+		if ip := cloudprivateipconfigcontroller.CloudPrivateIPConfigNameToIP(cloudPrivateIPConfig.Name); ip != nil {
+			used[ip.String()] = true
+		}
+	}
+	resources, err := g.cloudProviderClient.ListOwnedResources(context.Background(), nodes)
+	if err != nil {
+		if !errors.Is(err, cloudprovider.OwnedResourcesUnsupportedError) {
+			klog.Warningf("Could not list the cloud resources owned by the controller for the garbage collection, err: %v", err)
+		}
+		return nil, err
+	}
+
+	deleted := []cloudprovider.OwnedResource{}
+	orphanedSince := map[string]time.Time{}
+	for _, resource := range resources {
+		if used[resource.IP.String()] {
+			continue
+		}
+		since, ok := g.orphanedSince[resource.ID]
+		if !ok {
+			klog.Infof("Found orphaned %s %s of IP address %s, deleting it after %s unless it gets used again", resource.Kind, resource.ID, resource.IP, g.gracePeriod)
+			since = now
+		}
+		if now.Sub(since) < g.gracePeriod {
+			orphanedSince[resource.ID] = since
+			continue
+		}
+		err := g.cloudProviderClient.DeleteOwnedResource(context.Background(), resource)
+		switch {
+		case err == nil, errors.Is(err, cloudprovider.NonExistingIPError):
+			klog.Infof("Deleted orphaned %s %s of IP address %s", resource.Kind, resource.ID, resource.IP)
+			orphanedResourcesDeletedTotal.WithLabelValues(resource.Kind).Inc()
+			deleted = append(deleted, resource)
+		case errors.Is(err, cloudprovider.ReadOnlyError):
+			klog.Infof("Not deleting orphaned %s %s of IP address %s in read-only mode", resource.Kind, resource.ID, resource.IP)
+			orphanedSince[resource.ID] = since
+		default:
+			klog.Warningf("Could not delete orphaned %s %s of IP address %s, retrying at the next collection, err: %v", resource.Kind, resource.ID, resource.IP, err)
+			orphanedSince[resource.ID] = since
+		}
+	}
+	// Forget the resources which got deleted or used again meanwhile.
+	g.orphanedSince = orphanedSince
+	return deleted, nil
+}
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	fakecloudnetworkclientset "github.com/openshift/client-go/cloudnetwork/clientset/versioned/fake"
+	cloudnetworkinformers "github.com/openshift/client-go/cloudnetwork/informers/externalversions"
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeinformers "k8s.io/client-go/informers"
+	fakekubeclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCollect(t *testing.T) {
+	resource := func(ip, node string) cloudprovider.OwnedResource {
+		return cloudprovider.OwnedResource{ID: "port-" + ip, Kind: "port", IP: net.ParseIP(ip), Node: node}
+	}
+	cloudPrivateIPConfigInformer := cloudnetworkinformers.NewSharedInformerFactory(fakecloudnetworkclientset.NewSimpleClientset(), 0).Cloud().V1().CloudPrivateIPConfigs()
+	for _, name := range []string{"10.0.0.1", "10.0.0.4"} {
+		cloudPrivateIPConfigInformer.Informer().GetStore().Add(&cloudnetworkv1.CloudPrivateIPConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       cloudnetworkv1.CloudPrivateIPConfigSpec{Node: "nodeA"},
+			Status:     cloudnetworkv1.CloudPrivateIPConfigStatus{Node: "nodeA"},
+		})
+	}
+	nodeInformer := kubeinformers.NewSharedInformerFactory(fakekubeclient.NewSimpleClientset(), 0).Core().V1().Nodes()
+	nodeInformer.Informer().GetStore().Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "nodeA"}})
+	fakeCloudProvider := cloudprovider.NewFakeCloudProvider(false, false, false, false, 0)
+	// 10.0.0.1 is in use, 10.0.0.2 belongs to a deleted node and has no
+	// CloudPrivateIPConfig, neither has 10.0.0.3. 10.0.0.4 moved from a node
+	// which got deleted since to nodeA, its reservation still belongs to the
+	// deleted node.
+	fakeCloudProvider.MockOwnedResources = []cloudprovider.OwnedResource{
+		resource("10.0.0.1", "nodeA"),
+		resource("10.0.0.2", ""),
+		resource("10.0.0.3", "nodeA"),
+		resource("10.0.0.4", ""),
+	}
+	g := NewGarbageCollector(fakeCloudProvider, cloudPrivateIPConfigInformer, nodeInformer, nil, time.Minute, time.Hour)
+	start := time.Now()
+
+	tcs := []struct {
+		name            string
+		after           time.Duration
+		reused          string
+		expectedDeleted []string
+	}{
+		{
+			name:            "Should not delete orphaned resources before the grace period",
+			after:           0,
+			expectedDeleted: []string{},
+		},
+		{
+			name:            "Should not delete orphaned resources within the grace period",
+			after:           30 * time.Minute,
+			reused:          "10.0.0.3",
+			expectedDeleted: []string{},
+		},
+		{
+			name:            "Should delete the resources orphaned for the grace period",
+			after:           time.Hour,
+			expectedDeleted: []string{"port-10.0.0.2"},
+		},
+		{
+			name:            "Should restart the grace period of resources used meanwhile",
+			after:           80 * time.Minute,
+			expectedDeleted: []string{},
+		},
+		{
+			name:            "Should delete resources orphaned again after the grace period",
+			after:           90 * time.Minute,
+			expectedDeleted: []string{"port-10.0.0.3"},
+		},
+	}
+	for i, tc := range tcs {
+		if tc.reused != "" {
+			cloudPrivateIPConfigInformer.Informer().GetStore().Add(&cloudnetworkv1.CloudPrivateIPConfig{ObjectMeta: metav1.ObjectMeta{Name: tc.reused}})
+			g.collect(start.Add(tc.after))
+			cloudPrivateIPConfigInformer.Informer().GetStore().Delete(&cloudnetworkv1.CloudPrivateIPConfig{ObjectMeta: metav1.ObjectMeta{Name: tc.reused}})
+		}
+		deleted := []string{}
+		collected, err := g.collect(start.Add(tc.after))
+		if err != nil {
+			t.Fatalf("TestCollect(%d): %s: unexpected error: %v", i, tc.name, err)
+		}
+		for _, resource := range collected {
+			deleted = append(deleted, resource.ID)
+		}
+		if fmt.Sprint(deleted) != fmt.Sprint(tc.expectedDeleted) {
+			t.Fatalf("TestCollect(%d): %s: expected deleted resources %v, got %v", i, tc.name, tc.expectedDeleted, deleted)
+		}
+	}
+	remaining := []string{}
+	for _, resource := range fakeCloudProvider.MockOwnedResources {
+		remaining = append(remaining, resource.ID)
+	}
+	if fmt.Sprint(remaining) != fmt.Sprint([]string{"port-10.0.0.1", "port-10.0.0.4"}) {
+		t.Fatalf("TestCollect: expected only the used resources to remain, got %v", remaining)
+	}
+}
+
+func TestRunUnsupported(t *testing.T) {
+	cloudPrivateIPConfigInformer := cloudnetworkinformers.NewSharedInformerFactory(fakecloudnetworkclientset.NewSimpleClientset(), 0).Cloud().V1().CloudPrivateIPConfigs()
+	nodeInformer := kubeinformers.NewSharedInformerFactory(fakekubeclient.NewSimpleClientset(), 0).Core().V1().Nodes()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go cloudPrivateIPConfigInformer.Informer().Run(stopCh)
+	go nodeInformer.Informer().Run(stopCh)
+	fakeCloudProvider := cloudprovider.NewFakeCloudProvider(false, false, false, false, 0)
+	fakeCloudProvider.MockOwnedResourcesError = cloudprovider.OwnedResourcesUnsupportedError
+	g := NewGarbageCollector(fakeCloudProvider, cloudPrivateIPConfigInformer, nodeInformer, nil, time.Minute, time.Hour)
+
+	// The garbage collector stops on its own, without waiting for stopCh.
+	done := make(chan struct{})
+	go func() {
+		g.Run(stopCh)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("TestRunUnsupported: expected the garbage collector to stop on a cloud where it's unsupported")
+	}
+}
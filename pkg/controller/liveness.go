@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// progress counts the keys being processed by the workers of a controller and
+// records when the last one was done, or when the workers picked up work after
+// idling.
+type progress struct {
+	sync.Mutex
+	processing int
+	last       time.Time
+}
+
+func (p *progress) start() {
+	p.Lock()
+	defer p.Unlock()
+	// Idle workers made no progress, but weren't stuck either: measure
+	// from the time they picked up work again.
+	if p.processing == 0 {
+		p.last = time.Now()
+	}
+	p.processing++
+}
+
+func (p *progress) done() {
+	p.Lock()
+	defer p.Unlock()
+	p.processing--
+	p.last = time.Now()
+}
+
+// Stuck returns an error if the workers of the controller made no progress
+// for longer than timeout while there's work to do: keys are being processed
+// or wait in the workqueue, but none was done since. An idle controller, or
+// one whose keys are only waiting for their retry, is never stuck. timeout
+// must exceed the longest a single sync may legitimately take, i.e: the
+// deadlines of the cloud operations.
+func (c *CloudNetworkConfigController) Stuck(timeout time.Duration) error {
+	c.progress.Lock()
+	processing, last := c.progress.processing, c.progress.last
+	c.progress.Unlock()
+	queued := c.workqueue.Len()
+	if processing == 0 && queued == 0 {
+		return nil
+	}
+	if since := time.Since(last); since > timeout {
+		return fmt.Errorf("%s workers made no progress for %s, with %d keys being processed and %d queued", c.controllerKey, since.Round(time.Second), processing, queued)
+	}
+	return nil
+}
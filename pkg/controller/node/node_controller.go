@@ -3,11 +3,16 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	corelisters "k8s.io/client-go/listers/core/v1"
@@ -17,6 +22,10 @@ import (
 
 	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
 	controller "github.com/openshift/cloud-network-config-controller/pkg/controller"
+	"github.com/openshift/cloud-network-config-controller/pkg/maintenance"
+	"github.com/openshift/cloud-network-config-controller/pkg/notifier"
+	"github.com/openshift/cloud-network-config-controller/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var (
@@ -24,10 +33,14 @@ var (
 	nodeControllerAgentType = reflect.TypeOf(&corev1.Node{})
 	// nodeControllerAgentName is the controller name for the Node controller
 	nodeControllerAgentName = "node"
-	// nodeEgressIPConfigAnnotationKey is the annotation key used for indicating the node's egress IP configuration
-	nodeEgressIPConfigAnnotationKey = "cloud.network.openshift.io/egress-ipconfig"
+	// NodeEgressIPConfigAnnotationKey is the annotation key used for indicating the node's egress IP configuration
+	NodeEgressIPConfigAnnotationKey = "cloud.network.openshift.io/egress-ipconfig"
 )
 
+// deletedNodeRecheckInterval is the interval at which the cleanup of a deleted
+// node whose instance still exists is retried.
+const deletedNodeRecheckInterval = 5 * time.Minute
+
 // NodeController is the controller implementation for Node resources
 // This controller is used to annotate nodes for the purposes of the
 // cloud network config controller
@@ -38,10 +51,25 @@ type NodeController struct {
 	// cloudProviderClient is a client interface allowing the controller
 	// access to the cloud API
 	cloudProviderClient cloudprovider.CloudProviderIntf
+	// notifier delivers the capacity exhaustion events, nil if disabled
+	notifier *notifier.Dispatcher
+	// maintenanceWindows defer the cleanup of deleted nodes on the cloud
+	maintenanceWindows maintenance.Windows
+	// networkInterfaceResyncPeriod is the period at which the network
+	// interfaces of annotated nodes are checked for changes, disabled if 0
+	networkInterfaceResyncPeriod time.Duration
 	// ctx is the passed-down global context. It's used and passed
 	// down to all API client calls as to make sure all in-flight calls get
 	// cancelled if the main context is
 	ctx context.Context
+	// deletedNodes holds the last known state of deleted nodes, keyed by
+	// name, until they have been cleaned up on the cloud. The lister no
+	// longer knows about them once SyncHandler gets to process them. It's
+	// rebuilt from the cloud on startup, see restoreDeletedNodes.
+	deletedNodes sync.Map
+	// networkInterfaces holds the network interfaces of annotated nodes last
+	// seen on the cloud, joined, keyed by node name.
+	networkInterfaces sync.Map
 }
 
 // NewNodeController returns a new Node controller
@@ -49,13 +77,19 @@ func NewNodeController(
 	controllerContext context.Context,
 	kubeClientset kubernetes.Interface,
 	cloudProviderClient cloudprovider.CloudProviderIntf,
-	nodeInformer coreinformers.NodeInformer) *controller.CloudNetworkConfigController {
+	nodeInformer coreinformers.NodeInformer,
+	notifier *notifier.Dispatcher,
+	maintenanceWindows maintenance.Windows,
+	networkInterfaceResyncPeriod time.Duration) *controller.CloudNetworkConfigController {
 
 	nodeController := &NodeController{
-		nodesLister:         nodeInformer.Lister(),
-		kubeClient:          kubeClientset,
-		cloudProviderClient: cloudProviderClient,
-		ctx:                 controllerContext,
+		nodesLister:                  nodeInformer.Lister(),
+		kubeClient:                   kubeClientset,
+		cloudProviderClient:          cloudProviderClient,
+		notifier:                     notifier,
+		maintenanceWindows:           maintenanceWindows,
+		networkInterfaceResyncPeriod: networkInterfaceResyncPeriod,
+		ctx:                          controllerContext,
 	}
 
 	controller := controller.NewCloudNetworkConfigController(
@@ -64,46 +98,239 @@ func NewNodeController(
 		nodeControllerAgentName,
 		nodeControllerAgentType,
 	)
+	controller.MaintenanceWindows = maintenanceWindows
+	controller.Store = nodeInformer.Informer().GetStore()
 
 	nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: controller.Enqueue,
+		AddFunc: func(obj interface{}) {
+			if node, ok := obj.(*corev1.Node); ok {
+				nodeController.forgetDeletedNode(node)
+			}
+			controller.Enqueue(obj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			node, ok := obj.(*corev1.Node)
+			if !ok {
+				tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+				if !ok {
+					klog.Errorf("error decoding object, invalid type: %#v", obj)
+					return
+				}
+				if node, ok = tombstone.Obj.(*corev1.Node); !ok {
+					klog.Errorf("error decoding object tombstone, invalid type: %#v", tombstone.Obj)
+					return
+				}
+			}
+			nodeController.deletedNodes.Store(node.Name, node)
+			controller.Enqueue(obj)
+		},
 	})
+	if networkInterfaceResyncPeriod > 0 {
+		// Periodic resyncs deliver unchanged nodes as updates, actual
+		// updates are of no interest: the network interfaces of the node's
+		// instance change on the cloud only.
+		nodeInformer.Informer().AddEventHandlerWithResyncPeriod(cache.ResourceEventHandlerFuncs{
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				oldNode, ok := oldObj.(*corev1.Node)
+				if !ok {
+					return
+				}
+				if newNode, ok := newObj.(*corev1.Node); ok && oldNode.ResourceVersion == newNode.ResourceVersion {
+					controller.Enqueue(newObj)
+				}
+			},
+		}, networkInterfaceResyncPeriod)
+	}
+	go nodeController.restoreDeletedNodes(controller.Enqueue, nodeInformer.Informer().HasSynced)
 	return controller
 }
 
+// restoreDeletedNodes queues the cleanup of the deleted nodes whose resources
+// remain on the cloud, once the nodes are synced: the nodes deleted while the
+// controller didn't run, or before their cleanup completed, aren't known
+// otherwise. They're only known by the provider ID of their instance, which
+// names them.
+func (n *NodeController) restoreDeletedNodes(enqueue func(interface{}), nodesSynced cache.InformerSynced) {
+	if !cache.WaitForCacheSync(n.ctx.Done(), nodesSynced) {
+		return
+	}
+	nodes, err := n.nodesLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Error listing nodes to restore the deleted ones, err: %v", err)
+		return
+	}
+	resources, err := n.cloudProviderClient.ListOwnedResources(n.ctx, nodes)
+	if err != nil {
+		klog.Warningf("Could not list the cloud resources of deleted nodes, they're left to the garbage collector, err: %v", err)
+		return
+	}
+	for _, resource := range resources {
+		if resource.Node != "" || resource.ProviderID == "" {
+			continue
+		}
+		if _, ok := n.deletedNodes.Load(resource.ProviderID); ok {
+			continue
+		}
+		klog.Infof("Found %s %s of deleted node %s, cleaning it up", resource.Kind, resource.ID, resource.ProviderID)
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: resource.ProviderID},
+			Spec:       corev1.NodeSpec{ProviderID: resource.ProviderID},
+		}
+		n.deletedNodes.Store(node.Name, node)
+		enqueue(node)
+	}
+}
+
+// forgetDeletedNode drops the deleted nodes node replaces: of the same name,
+// or of the same instance, e.g. those restored from the cloud.
+func (n *NodeController) forgetDeletedNode(node *corev1.Node) {
+	n.deletedNodes.Range(func(key, value interface{}) bool {
+		deleted := value.(*corev1.Node)
+		if deleted.Name == node.Name || node.Spec.ProviderID != "" && deleted.Spec.ProviderID == node.Spec.ProviderID {
+			n.deletedNodes.Delete(key)
+		}
+		return true
+	})
+}
+
 // syncHandler compares the actual state with the desired, and attempts to
 // converge the two. It then updates the Status block of the Node resource
 // with the current status of the resource.
-func (n *NodeController) SyncHandler(key string) error {
+func (n *NodeController) SyncHandler(ctx context.Context, key string) error {
 	node, err := n.nodesLister.Get(key)
 	if err != nil {
 		// // A lister can only return ErrNotFound, which means: the Node
 		// resource no longer exist, in which case we stop processing.
 		klog.Infof("corev1.Node: '%s' in work queue no longer exists", key)
-		return nil
+		n.networkInterfaces.Delete(key)
+		return n.cleanupDeletedNode(ctx, key)
 	}
 	// If the node already has the annotation (ex: if we restart it is expected
 	// that the nodes would) we skip it. Subnets won't change and we are only
 	// interested in conveying the default assignment capacity that the node had
 	// when it started existing. It's up to the network plugin to track how much
-	// capacity it has left depending on the assignments it performs.
-	if _, ok := node.Annotations[nodeEgressIPConfigAnnotationKey]; ok {
+	// capacity it has left depending on the assignments it performs. Only
+	// network interfaces attached or detached since can change it.
+	if annotation, ok := node.Annotations[NodeEgressIPConfigAnnotationKey]; ok {
+		if n.networkInterfaceResyncPeriod > 0 {
+			return n.syncNetworkInterfaces(ctx, node, annotation)
+		}
 		return nil
 	}
-	nodeEgressIPConfigs, err := n.cloudProviderClient.GetNodeEgressIPConfiguration(node)
+	cloudCtx, span := tracing.Start(ctx, "cloud GetNodeEgressIPConfiguration", attribute.String("node", node.Name))
+	nodeEgressIPConfigs, err := n.cloudProviderClient.GetNodeEgressIPConfiguration(cloudCtx, node)
+	tracing.End(span, err)
 	if err != nil {
 		return fmt.Errorf("error retrieving the private IP configuration for node: %s, err: %v", node.Name, err)
 	}
+	if capacityExhausted(nodeEgressIPConfigs) {
+		n.notifier.Notify(notifier.Event{
+			Type:    notifier.EventCapacityExhausted,
+			Object:  node.Name,
+			Node:    node.Name,
+			Message: "no capacity left for egress IP addresses",
+		})
+	}
 	return n.SetNodeEgressIPConfigAnnotation(node, nodeEgressIPConfigs)
 }
 
+// syncNetworkInterfaces updates the egress IP configuration of the annotated
+// node if the network interfaces of its instance changed since they were last
+// seen, which is never for the first time after a restart. The configuration
+// of the interfaces already annotated is kept as is: the egress IPs assigned
+// since would be deducted from their capacity otherwise.
+func (n *NodeController) syncNetworkInterfaces(ctx context.Context, node *corev1.Node, annotation string) error {
+	networkInterfaceIDs, err := n.cloudProviderClient.GetNodeNetworkInterfaces(ctx, node)
+	if err != nil {
+		return fmt.Errorf("error retrieving the network interfaces of node: %s, err: %v", node.Name, err)
+	}
+	if networkInterfaceIDs == nil {
+		return nil
+	}
+	networkInterfaces := strings.Join(networkInterfaceIDs, ",")
+	if seen, ok := n.networkInterfaces.Load(node.Name); ok && seen.(string) == networkInterfaces {
+		return nil
+	}
+	var annotatedConfigs []*cloudprovider.NodeEgressIPConfiguration
+	if err := json.Unmarshal([]byte(annotation), &annotatedConfigs); err != nil {
+		return fmt.Errorf("error parsing annotation %s of node: %s, err: %v", NodeEgressIPConfigAnnotationKey, node.Name, err)
+	}
+	nodeEgressIPConfigs, err := n.cloudProviderClient.GetNodeEgressIPConfiguration(ctx, node)
+	if err != nil {
+		return fmt.Errorf("error retrieving the private IP configuration for node: %s, err: %v", node.Name, err)
+	}
+	annotated := map[string]*cloudprovider.NodeEgressIPConfiguration{}
+	for _, annotatedConfig := range annotatedConfigs {
+		annotated[annotatedConfig.Interface] = annotatedConfig
+	}
+	changed := len(nodeEgressIPConfigs) != len(annotatedConfigs)
+	for i, nodeEgressIPConfig := range nodeEgressIPConfigs {
+		if annotatedConfig, ok := annotated[nodeEgressIPConfig.Interface]; ok {
+			nodeEgressIPConfigs[i] = annotatedConfig
+		} else {
+			changed = true
+		}
+	}
+	if changed {
+		klog.Infof("Network interfaces of node: %s changed to: %s, updating its egress IP configuration", node.Name, networkInterfaces)
+		if err := n.SetNodeEgressIPConfigAnnotation(node, nodeEgressIPConfigs); err != nil {
+			return err
+		}
+	}
+	n.networkInterfaces.Store(node.Name, networkInterfaces)
+	return nil
+}
+
+// capacityExhausted returns true if none of the node's interfaces has any
+// capacity left for egress IP addresses.
+func capacityExhausted(nodeEgressIPConfigs []*cloudprovider.NodeEgressIPConfiguration) bool {
+	if len(nodeEgressIPConfigs) == 0 {
+		return false
+	}
+	for _, nodeEgressIPConfig := range nodeEgressIPConfigs {
+		capacity := nodeEgressIPConfig.Capacity
+		if capacity.IP > 0 || capacity.IPv4 > 0 || capacity.IPv6 > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// cleanupDeletedNode releases all private IPs of a deleted node on the cloud,
+// if we saw it being deleted.
+func (n *NodeController) cleanupDeletedNode(ctx context.Context, key string) error {
+	obj, ok := n.deletedNodes.Load(key)
+	if !ok {
+		return nil
+	}
+	node := obj.(*corev1.Node)
+	// The cleanup isn't urgent, the node is gone already.
+	if end, ok := n.maintenanceWindows.Active(time.Now()); ok {
+		return &controller.DeferredError{Until: end, Reason: fmt.Sprintf("cleanup of deleted node: %s during a cloud maintenance window", node.Name)}
+	}
+	// In read-only mode, the planned cleanup was logged, there's nothing to retry.
+	cloudCtx, span := tracing.Start(ctx, "cloud CleanupNode", attribute.String("node", node.Name))
+	err := n.cloudProviderClient.CleanupNode(cloudCtx, node)
+	tracing.End(span, err)
+	// The node object may be deleted before its instance, or while it keeps
+	// running: check again until it's gone, or the node is re-created.
+	if errors.Is(err, cloudprovider.InstanceExistsError) {
+		return &controller.DeferredError{Until: time.Now().Add(deletedNodeRecheckInterval), Reason: err.Error()}
+	}
+	if err != nil && !errors.Is(err, cloudprovider.ReadOnlyError) {
+		return fmt.Errorf("error cleaning up deleted node: %s, err: %v", node.Name, err)
+	}
+	n.deletedNodes.Delete(key)
+	return nil
+}
+
 // SetCloudPrivateIPConfigAnnotationOnNode annotates the corev1.Node with the cloud subnet information and capacity
 func (n *NodeController) SetNodeEgressIPConfigAnnotation(node *corev1.Node, nodeEgressIPConfigs []*cloudprovider.NodeEgressIPConfiguration) error {
 	annotation, err := n.generateAnnotation(nodeEgressIPConfigs)
 	if err != nil {
 		return err
 	}
-	klog.Infof("Setting annotation: '%s: %s' on node: %s", nodeEgressIPConfigAnnotationKey, annotation, node.Name)
+	klog.Infof("Setting annotation: '%s: %s' on node: %s", NodeEgressIPConfigAnnotationKey, annotation, node.Name)
 	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
 		ctx, cancel := context.WithTimeout(n.ctx, controller.ClientTimeout)
 		defer cancel()
@@ -114,7 +341,7 @@ func (n *NodeController) SetNodeEgressIPConfigAnnotation(node *corev1.Node, node
 			return err
 		}
 		existingAnnotations := nodeLatest.Annotations
-		existingAnnotations[nodeEgressIPConfigAnnotationKey] = annotation
+		existingAnnotations[NodeEgressIPConfigAnnotationKey] = annotation
 		nodeLatest.SetAnnotations(existingAnnotations)
 		_, err = n.kubeClient.CoreV1().Nodes().Update(ctx, nodeLatest, metav1.UpdateOptions{})
 		return err
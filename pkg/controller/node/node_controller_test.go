@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	controller "github.com/openshift/cloud-network-config-controller/pkg/controller"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	fakekubeclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSyncNetworkInterfaces(t *testing.T) {
+	// The egress IPs assigned to eni-1 lowered its annotated capacity.
+	annotated := []*cloudprovider.NodeEgressIPConfiguration{{Interface: "eni-1"}}
+	annotated[0].Capacity.IPv4 = 5
+	annotation, err := json.Marshal(annotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "nodeA",
+			Annotations: map[string]string{NodeEgressIPConfigAnnotationKey: string(annotation)},
+		},
+	}
+	kubeClient := fakekubeclient.NewSimpleClientset(node)
+	nodeInformer := kubeinformers.NewSharedInformerFactory(kubeClient, 0).Core().V1().Nodes()
+	nodeInformer.Informer().GetIndexer().Add(node)
+	fakeCloudProvider := cloudprovider.NewFakeCloudProvider(false, false, false, false, 0)
+	n := &NodeController{
+		kubeClient:                   kubeClient,
+		nodesLister:                  nodeInformer.Lister(),
+		cloudProviderClient:          fakeCloudProvider,
+		networkInterfaceResyncPeriod: 1,
+		ctx:                          context.TODO(),
+	}
+
+	tcs := []struct {
+		networkInterfaces []string
+		// selected is the interface egress IPs are assigned to, expected the
+		// interface and capacity of the annotation once synced.
+		selected          string
+		expectedInterface string
+		expectedCapacity  int
+	}{
+		{
+			networkInterfaces: []string{"eni-1"},
+			selected:          "eni-1",
+			expectedInterface: "eni-1",
+			expectedCapacity:  5,
+		},
+		// Attaching another interface doesn't change the selected one.
+		{
+			networkInterfaces: []string{"eni-1", "eni-2"},
+			selected:          "eni-1",
+			expectedInterface: "eni-1",
+			expectedCapacity:  5,
+		},
+		// Detaching the selected interface selects another one.
+		{
+			networkInterfaces: []string{"eni-2"},
+			selected:          "eni-2",
+			expectedInterface: "eni-2",
+			expectedCapacity:  14,
+		},
+	}
+	for i, tc := range tcs {
+		selected := &cloudprovider.NodeEgressIPConfiguration{Interface: tc.selected}
+		selected.Capacity.IPv4 = 14
+		fakeCloudProvider.MockNetworkInterfaces = map[string][]string{node.Name: tc.networkInterfaces}
+		fakeCloudProvider.MockNodeEgressIPConfigurations = map[string][]*cloudprovider.NodeEgressIPConfiguration{node.Name: {selected}}
+
+		if err := n.SyncHandler(context.TODO(), node.Name); err != nil {
+			t.Fatalf("TestSyncNetworkInterfaces(%d): received unexpected error, err: %v", i, err)
+		}
+		latest, err := kubeClient.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("TestSyncNetworkInterfaces(%d): could not get node, err: %v", i, err)
+		}
+		var configs []*cloudprovider.NodeEgressIPConfiguration
+		if err := json.Unmarshal([]byte(latest.Annotations[NodeEgressIPConfigAnnotationKey]), &configs); err != nil {
+			t.Fatalf("TestSyncNetworkInterfaces(%d): could not parse annotation, err: %v", i, err)
+		}
+		if len(configs) != 1 || configs[0].Interface != tc.expectedInterface || configs[0].Capacity.IPv4 != tc.expectedCapacity {
+			t.Fatalf("TestSyncNetworkInterfaces(%d): expected interface %s with capacity %d, got annotation %s", i, tc.expectedInterface, tc.expectedCapacity, latest.Annotations[NodeEgressIPConfigAnnotationKey])
+		}
+		nodeInformer.Informer().GetIndexer().Update(latest)
+	}
+}
+
+func TestCleanupDeletedNode(t *testing.T) {
+	providerID := "openstack:///9e5476bd-a4ec-4653-93d6-72c93aa682ba"
+	nodeA := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "nodeA"}}
+	nodeInformer := kubeinformers.NewSharedInformerFactory(fakekubeclient.NewSimpleClientset(nodeA), 0).Core().V1().Nodes()
+	nodeInformer.Informer().GetIndexer().Add(nodeA)
+	fakeCloudProvider := cloudprovider.NewFakeCloudProvider(false, false, false, false, 0)
+	fakeCloudProvider.MockOwnedResources = []cloudprovider.OwnedResource{
+		{ID: "port-a", Kind: "neutron port", Node: "nodeA", ProviderID: "openstack:///b5d5889f-76f9-46b1-8af9-bfdf81e96616"},
+		{ID: "port-b", Kind: "neutron port", ProviderID: providerID},
+		{ID: "port-c", Kind: "neutron port", ProviderID: providerID},
+	}
+	fakeCloudProvider.MockExistingInstances = map[string]bool{providerID: true}
+	n := &NodeController{
+		nodesLister:         nodeInformer.Lister(),
+		cloudProviderClient: fakeCloudProvider,
+		ctx:                 context.TODO(),
+	}
+
+	// The node of the orphaned reservation ports is restored from the cloud.
+	enqueued := []string{}
+	n.restoreDeletedNodes(func(obj interface{}) { enqueued = append(enqueued, obj.(*corev1.Node).Name) }, func() bool { return true })
+	if len(enqueued) != 1 || enqueued[0] != providerID {
+		t.Fatalf("TestCleanupDeletedNode: expected the deleted node %s to be restored, got %v", providerID, enqueued)
+	}
+
+	// The cleanup is retried while the instance exists.
+	var deferredErr *controller.DeferredError
+	if err := n.SyncHandler(context.TODO(), providerID); !errors.As(err, &deferredErr) {
+		t.Fatalf("TestCleanupDeletedNode: expected the cleanup to be deferred while the instance exists, got: %v", err)
+	}
+	if _, ok := n.deletedNodes.Load(providerID); !ok {
+		t.Fatalf("TestCleanupDeletedNode: expected the deleted node to be kept while the instance exists")
+	}
+	fakeCloudProvider.MockExistingInstances = nil
+	if err := n.SyncHandler(context.TODO(), providerID); err != nil {
+		t.Fatalf("TestCleanupDeletedNode: unexpected error, err: %v", err)
+	}
+	if _, ok := n.deletedNodes.Load(providerID); ok {
+		t.Fatalf("TestCleanupDeletedNode: expected the deleted node to be dropped once cleaned up")
+	}
+	if len(fakeCloudProvider.StateTracker) != 2 {
+		t.Fatalf("TestCleanupDeletedNode: expected 2 cleanups, got %v", fakeCloudProvider.StateTracker)
+	}
+
+	// A node re-created on the instance drops it.
+	n.restoreDeletedNodes(func(interface{}) {}, func() bool { return true })
+	n.forgetDeletedNode(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "nodeB"}, Spec: corev1.NodeSpec{ProviderID: providerID}})
+	if _, ok := n.deletedNodes.Load(providerID); ok {
+		t.Fatalf("TestCleanupDeletedNode: expected the deleted node to be dropped once re-created")
+	}
+}
@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// RetryPolicy configures the retries of the keys failing to sync. The delay
+// before each retry of a key doubles from the base delay up to the max delay,
+// and the key is dropped once it failed MaxRetries times in a row.
+type RetryPolicy struct {
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	MaxRetries int
+	// InterventionBaseDelay and InterventionMaxDelay replace BaseDelay and
+	// MaxDelay for the keys whose last error retrying won't resolve until
+	// someone acts, i.e: exhausted cloud quotas and missing permissions, see
+	// cloudprovider.NeedsIntervention. Retrying those at the usual pace only
+	// burns through the cloud's API rate and MaxRetries.
+	InterventionBaseDelay time.Duration
+	InterventionMaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy of the controllers unless
+// configured otherwise, the one of workqueue.DefaultControllerRateLimiter
+// with maxRetries, and a class of errors needing intervention retried from
+// every 30s up to every 15m.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		BaseDelay:             5 * time.Millisecond,
+		MaxDelay:              1000 * time.Second,
+		MaxRetries:            maxRetries,
+		InterventionBaseDelay: 30 * time.Second,
+		InterventionMaxDelay:  15 * time.Minute,
+	}
+}
+
+// retryRateLimiter is the workqueue rate limiter of the controllers. It
+// delays the retries of each key exponentially following the RetryPolicy
+// returned by policy, on the scale of the class of the key's last error.
+// Like workqueue.DefaultControllerRateLimiter, it also bounds the overall
+// rate of retries.
+type retryRateLimiter struct {
+	sync.Mutex
+	policy func() RetryPolicy
+	// failures holds the number of failures in a row of each key.
+	failures map[interface{}]int
+	// needsIntervention holds the keys whose last error needs intervention.
+	needsIntervention map[interface{}]bool
+	overall           *workqueue.BucketRateLimiter
+}
+
+func newRetryRateLimiter(policy func() RetryPolicy) *retryRateLimiter {
+	return &retryRateLimiter{
+		policy:            policy,
+		failures:          map[interface{}]int{},
+		needsIntervention: map[interface{}]bool{},
+		overall:           &workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+	}
+}
+
+// classify records whether the last error of item needs intervention, for
+// its next retry to be delayed accordingly.
+func (r *retryRateLimiter) classify(item interface{}, needsIntervention bool) {
+	r.Lock()
+	defer r.Unlock()
+	if needsIntervention {
+		r.needsIntervention[item] = true
+	} else {
+		delete(r.needsIntervention, item)
+	}
+}
+
+func (r *retryRateLimiter) When(item interface{}) time.Duration {
+	policy := r.policy()
+	r.Lock()
+	exp := r.failures[item]
+	r.failures[item]++
+	base, max := policy.BaseDelay, policy.MaxDelay
+	if r.needsIntervention[item] {
+		base, max = policy.InterventionBaseDelay, policy.InterventionMaxDelay
+	}
+	r.Unlock()
+
+	delay := max
+	if backoff := float64(base.Nanoseconds()) * math.Pow(2, float64(exp)); backoff < float64(max.Nanoseconds()) {
+		delay = time.Duration(backoff)
+	}
+	if overall := r.overall.When(item); overall > delay {
+		return overall
+	}
+	return delay
+}
+
+func (r *retryRateLimiter) NumRequeues(item interface{}) int {
+	r.Lock()
+	defer r.Unlock()
+	return r.failures[item]
+}
+
+func (r *retryRateLimiter) Forget(item interface{}) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.failures, item)
+	delete(r.needsIntervention, item)
+}
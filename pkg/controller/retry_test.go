@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryRateLimiter(t *testing.T) {
+	policy := RetryPolicy{
+		BaseDelay:             10 * time.Millisecond,
+		MaxDelay:              50 * time.Millisecond,
+		MaxRetries:            5,
+		InterventionBaseDelay: time.Second,
+		InterventionMaxDelay:  3 * time.Second,
+	}
+	r := newRetryRateLimiter(func() RetryPolicy { return policy })
+
+	expected := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond}
+	for i, delay := range expected {
+		if when := r.When("key"); when != delay {
+			t.Fatalf("TestRetryRateLimiter(%d): expected delay %s, got %s", i, delay, when)
+		}
+	}
+	// Errors needing intervention keep counting failures, on their own scale.
+	r.classify("key", true)
+	if when := r.When("key"); when != 3*time.Second {
+		t.Fatalf("TestRetryRateLimiter: expected the max delay of errors needing intervention, got %s", when)
+	}
+	if requeues := r.NumRequeues("key"); requeues != 5 {
+		t.Fatalf("TestRetryRateLimiter: expected 5 requeues, got %d", requeues)
+	}
+	r.Forget("key")
+	if requeues := r.NumRequeues("key"); requeues != 0 {
+		t.Fatalf("TestRetryRateLimiter: expected the failures to be forgotten, got %d requeues", requeues)
+	}
+	r.classify("key", true)
+	if when := r.When("key"); when != time.Second {
+		t.Fatalf("TestRetryRateLimiter: expected the base delay of errors needing intervention, got %s", when)
+	}
+	// Other keys are unaffected.
+	if when := r.When("other"); when != 10*time.Millisecond {
+		t.Fatalf("TestRetryRateLimiter: expected the base delay for another key, got %s", when)
+	}
+}
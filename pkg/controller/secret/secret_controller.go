@@ -31,6 +31,9 @@ type SecretController struct {
 	// cancel the global context, stop the leader election and subsequently
 	// initiate a shut down of all control loops
 	controllerCancel context.CancelFunc
+	// validator validates the rotated credentials before the global context
+	// is cancelled, nil if they're not validated
+	validator *controller.CredentialValidator
 }
 
 // NewSecretController returns a new Secret controller
@@ -39,11 +42,13 @@ func NewSecretController(
 	controllerCancel context.CancelFunc,
 	kubeClientset kubernetes.Interface,
 	secretInformer coreinformers.SecretInformer,
-	secretName, secretNamespace string) *controller.CloudNetworkConfigController {
+	secretName, secretNamespace string,
+	validator *controller.CredentialValidator) *controller.CloudNetworkConfigController {
 
 	secretController := &SecretController{
 		secretLister:     secretInformer.Lister(),
 		controllerCancel: controllerCancel,
+		validator:        validator,
 	}
 
 	controller := controller.NewCloudNetworkConfigController(
@@ -94,8 +99,17 @@ func NewSecretController(
 
 // syncHandler does *not* compare the actual state with the desired, it's
 // triggered on a secret.data change or secret deletion and cancels the global
-// context forcing us to re-initialize the cloud credentials on restart.
-func (s *SecretController) SyncHandler(key string) error {
+// context forcing us to re-initialize the cloud credentials on restart. If a
+// validator is set the context is only cancelled once the rotated credentials
+// are validated, until then the object is requeued and we keep serving with
+// the current ones.
+func (s *SecretController) SyncHandler(_ context.Context, key string) error {
+	if s.validator != nil {
+		if err := s.validator.Validate(); err != nil {
+			klog.Warningf("Keeping the current cloud API credentials, err: %v", err)
+			return err
+		}
+	}
 	s.shutdown()
 	return nil
 }
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"github.com/openshift/cloud-network-config-controller/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+)
+
+var (
+	workqueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Name:      "workqueue_depth",
+		Help:      "Number of keys waiting in the workqueue, by workqueue.",
+	}, []string{"name"})
+	workqueueAddsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "workqueue_adds_total",
+		Help:      "Number of keys added to the workqueue, by workqueue.",
+	}, []string{"name"})
+	workqueueQueueDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Name:      "workqueue_queue_duration_seconds",
+		Help:      "How long keys wait in the workqueue before being processed, by workqueue.",
+		Buckets:   metrics.DefaultDurationBuckets,
+	}, []string{"name"})
+	workqueueWorkDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Name:      "workqueue_work_duration_seconds",
+		Help:      "How long processing a key takes, by workqueue.",
+		Buckets:   metrics.DefaultDurationBuckets,
+	}, []string{"name"})
+	workqueueUnfinishedWork = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Name:      "workqueue_unfinished_work_seconds",
+		Help:      "Sum of the time the keys being processed have been processed for, by workqueue: a growing value with a stable depth hints at stuck workers.",
+	}, []string{"name"})
+	workqueueLongestRunningProcessor = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Name:      "workqueue_longest_running_processor_seconds",
+		Help:      "How long the key processed for the longest has been processed for, by workqueue.",
+	}, []string{"name"})
+	workqueueRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "workqueue_retries_total",
+		Help:      "Number of keys requeued after failing to sync, by workqueue.",
+	}, []string{"name"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		workqueueDepth,
+		workqueueAddsTotal,
+		workqueueQueueDuration,
+		workqueueWorkDuration,
+		workqueueUnfinishedWork,
+		workqueueLongestRunningProcessor,
+		workqueueRetriesTotal,
+	)
+	workqueue.SetProvider(workqueueMetricsProvider{})
+}
+
+// workqueueMetricsProvider exposes the metrics of the workqueues, named after
+// their controller, through the metrics registry.
+type workqueueMetricsProvider struct{}
+
+func (workqueueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return workqueueDepth.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return workqueueAddsTotal.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return workqueueQueueDuration.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return workqueueWorkDuration.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueUnfinishedWork.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueLongestRunningProcessor.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return workqueueRetriesTotal.WithLabelValues(name)
+}
@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestWorkqueueMetrics(t *testing.T) {
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "TestWorkqueueMetrics")
+	defer queue.ShutDown()
+
+	queue.Add("a")
+	queue.Add("b")
+	if depth := testutil.ToFloat64(workqueueDepth.WithLabelValues("TestWorkqueueMetrics")); depth != 2 {
+		t.Fatalf("expected a depth of 2, got %v", depth)
+	}
+	key, _ := queue.Get()
+	if depth := testutil.ToFloat64(workqueueDepth.WithLabelValues("TestWorkqueueMetrics")); depth != 1 {
+		t.Fatalf("expected a depth of 1, got %v", depth)
+	}
+	queue.Done(key)
+	queue.AddRateLimited(key)
+	if adds := testutil.ToFloat64(workqueueAddsTotal.WithLabelValues("TestWorkqueueMetrics")); adds != 2 {
+		t.Fatalf("expected 2 adds, got %v", adds)
+	}
+	if retries := testutil.ToFloat64(workqueueRetriesTotal.WithLabelValues("TestWorkqueueMetrics")); retries != 1 {
+		t.Fatalf("expected 1 retry, got %v", retries)
+	}
+	if count := histogramCount(workqueueWorkDuration, "TestWorkqueueMetrics"); count != 1 {
+		t.Fatalf("expected the work duration of 1 key, got %d", count)
+	}
+}
+
+// histogramCount returns the number of observations of the histogram for the
+// label values.
+func histogramCount(h *prometheus.HistogramVec, labelValues ...string) uint64 {
+	metric := &dto.Metric{}
+	if err := h.WithLabelValues(labelValues...).(prometheus.Metric).Write(metric); err != nil {
+		return 0
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,56 @@
+package debug
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// mutexProfileFraction samples 1 out of that many contention events on
+	// mutexes, e.g. around the cloud clients, for the mutex profile.
+	mutexProfileFraction = 10
+	// blockProfileRate samples about one blocking event, e.g. on channels,
+	// per that many nanoseconds spent blocked, for the block profile.
+	blockProfileRate = int(time.Millisecond)
+)
+
+// Handler returns the handler of the pprof endpoints under /debug/pprof/,
+// see: https://pkg.go.dev/net/http/pprof
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// Serve serves the pprof endpoints over HTTP on address, e.g.
+// 127.0.0.1:6060, until the stop channel is closed. It enables the sampling
+// of the mutex and block profiles, which have a cost, for as long.
+func Serve(stopCh <-chan struct{}, address string) {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		// No WriteTimeout: CPU profiles and execution traces take as long
+		// as requested.
+	}
+	runtime.SetMutexProfileFraction(mutexProfileFraction)
+	runtime.SetBlockProfileRate(blockProfileRate)
+	go func() {
+		<-stopCh
+		server.Close()
+		runtime.SetMutexProfileFraction(0)
+		runtime.SetBlockProfileRate(0)
+	}()
+	klog.Infof("Serving pprof endpoints on %s", address)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		klog.Exitf("Error serving pprof endpoints: %v", err)
+	}
+}
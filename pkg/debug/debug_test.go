@@ -0,0 +1,36 @@
+package debug
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	tcs := []struct {
+		path         string
+		expectedBody string
+	}{
+		{path: "/debug/pprof/", expectedBody: "goroutine"},
+		{path: "/debug/pprof/goroutine?debug=1", expectedBody: "debug.TestHandler"},
+		{path: "/debug/pprof/mutex?debug=1", expectedBody: "--- mutex:"},
+		{path: "/debug/pprof/cmdline", expectedBody: "debug.test"},
+	}
+	for i, tc := range tcs {
+		recorder := httptest.NewRecorder()
+		Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("TestHandler(%d): %s: expected status %d, got %d", i, tc.path, http.StatusOK, recorder.Code)
+		}
+		if !strings.Contains(recorder.Body.String(), tc.expectedBody) {
+			t.Fatalf("TestHandler(%d): %s: expected the body to contain %q, got: %s", i, tc.path, tc.expectedBody, recorder.Body)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d outside of /debug/pprof/, got %d", http.StatusNotFound, recorder.Code)
+	}
+}
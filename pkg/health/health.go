@@ -0,0 +1,219 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// maxProbeNodes is the number of nodes the cloud is probed on before
+	// the probe fails, so that a single node whose instance is being
+	// deleted doesn't make the controller unready.
+	maxProbeNodes = 3
+	// staleProbePeriods is the number of probe periods after which the last
+	// successful probe is too old for the controller to be ready, e.g. as
+	// the probe hangs.
+	staleProbePeriods = 3
+)
+
+// Checker backs the readiness and liveness probes of the controller.
+//
+// The controller is ready once a recent call to the cloud API, with the
+// credentials it was started with, succeeded. Only the leader talks to the
+// cloud: replicas waiting for the leader election are always ready.
+//
+// The controller is live as long as none of its liveness checks fails, i.e:
+// the workers of its controllers make progress.
+type Checker struct {
+	mu sync.Mutex
+	// probePeriod is the period of the cloud probe, 0 until it's started.
+	probePeriod time.Duration
+	// lastProbe is the time the last probe ended, lastSuccess the time the
+	// last successful one did and lastErr the error of the last one.
+	lastProbe   time.Time
+	lastSuccess time.Time
+	lastErr     error
+	// livenessChecks are the liveness checks by name.
+	livenessChecks map[string]func() error
+}
+
+// NewChecker returns a Checker which is ready and live until the cloud probe
+// and liveness checks are added.
+func NewChecker() *Checker {
+	return &Checker{livenessChecks: map[string]func() error{}}
+}
+
+// AddLivenessCheck adds a check failing when the controller is stuck and
+// needs to be restarted.
+func (c *Checker) AddLivenessCheck(name string, check func() error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.livenessChecks[name] = check
+}
+
+// RunCloudProbe probes the cloud with cloudProvider every period until stopCh
+// is closed, on the nodes of nodeInformer. The controller isn't ready until
+// the first probe succeeds.
+func (c *Checker) RunCloudProbe(stopCh <-chan struct{}, cloudProvider cloudprovider.CloudProviderIntf, nodeInformer coreinformers.NodeInformer, period time.Duration) {
+	c.mu.Lock()
+	c.probePeriod = period
+	c.mu.Unlock()
+
+	if ok := cache.WaitForCacheSync(stopCh, nodeInformer.Informer().HasSynced); !ok {
+		return
+	}
+	wait.Until(func() {
+		err := probeCloud(cloudProvider, nodeInformer)
+		c.recordProbe(err, time.Now())
+	}, period, stopCh)
+}
+
+func (c *Checker) recordProbe(err error, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		klog.Warningf("Cloud health probe failed, the controller isn't ready: %v", err)
+	} else if c.lastErr != nil {
+		klog.Infof("Cloud health probe succeeded again, the controller is ready")
+	}
+	c.lastProbe, c.lastErr = now, err
+	if err == nil {
+		c.lastSuccess = now
+	}
+}
+
+// probeCloud performs the cheapest call to the cloud API on up to
+// maxProbeNodes nodes, those with a providerID first, until one succeeds.
+func probeCloud(cloudProvider cloudprovider.CloudProviderIntf, nodeInformer coreinformers.NodeInformer) error {
+	nodes, err := nodeInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("error listing nodes, err: %v", err)
+	}
+	candidates := []*corev1.Node{}
+	for _, node := range nodes {
+		if node.DeletionTimestamp == nil {
+			candidates = append(candidates, node)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if (candidates[i].Spec.ProviderID != "") != (candidates[j].Spec.ProviderID != "") {
+			return candidates[i].Spec.ProviderID != ""
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+	if len(candidates) == 0 {
+		klog.Warning("No node to probe the cloud on, skipping the cloud health probe")
+		return nil
+	}
+	for i, node := range candidates {
+		if err = cloudProvider.CheckHealth(context.Background(), node); err == nil {
+			return nil
+		}
+		if i+1 == maxProbeNodes {
+			break
+		}
+	}
+	if cloudprovider.ErrorClass(err) == "permission" {
+		return fmt.Errorf("the cloud rejects the credentials, err: %v", err)
+	}
+	return fmt.Errorf("error calling the cloud API, err: %v", err)
+}
+
+// Ready returns an error if the leader's last cloud probe failed, or
+// succeeded too long ago.
+func (c *Checker) Ready() error {
+	return c.ready(time.Now())
+}
+
+func (c *Checker) ready(now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case c.probePeriod == 0:
+		return nil
+	case c.lastProbe.IsZero():
+		return fmt.Errorf("the cloud wasn't probed yet")
+	case c.lastErr != nil:
+		return fmt.Errorf("cloud probe failed (%s): %v", cloudprovider.ErrorClass(c.lastErr), c.lastErr)
+	case now.Sub(c.lastSuccess) > staleProbePeriods*c.probePeriod:
+		return fmt.Errorf("the last successful cloud probe is %s old", now.Sub(c.lastSuccess).Round(time.Second))
+	}
+	return nil
+}
+
+// Live returns the errors of the failing liveness checks, sorted by name.
+func (c *Checker) Live() error {
+	c.mu.Lock()
+	names := make([]string, 0, len(c.livenessChecks))
+	for name := range c.livenessChecks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]func() error, 0, len(names))
+	for _, name := range names {
+		checks = append(checks, c.livenessChecks[name])
+	}
+	c.mu.Unlock()
+	failures := []string{}
+	for i, name := range names {
+		if err := checks[i](); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// Handler returns the handler serving the liveness probe on /healthz and the
+// readiness probe on /readyz.
+func (c *Checker) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", probeHandler(c.Live))
+	mux.Handle("/readyz", probeHandler(c.Ready))
+	return mux
+}
+
+func probeHandler(check func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := check(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, err.Error())
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// Serve serves the probes of checker over HTTP on port until stopCh is
+// closed.
+func Serve(stopCh <-chan struct{}, port int, checker *Checker) {
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           checker.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-stopCh
+		server.Close()
+	}()
+	klog.Infof("Serving health probes on port %d", port)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		klog.Exitf("Error serving health probes: %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	fakekubeclient "k8s.io/client-go/kubernetes/fake"
+)
+
+// probedCloudProvider fails the health checks on the nodes of errs and
+// records the nodes it was probed on.
+type probedCloudProvider struct {
+	*cloudprovider.FakeCloudProvider
+	errs   map[string]error
+	probed []string
+}
+
+func (p *probedCloudProvider) CheckHealth(ctx context.Context, node *corev1.Node) error {
+	p.probed = append(p.probed, node.Name)
+	return p.errs[node.Name]
+}
+
+func TestProbeCloud(t *testing.T) {
+	nodeInformer := kubeinformers.NewSharedInformerFactory(fakekubeclient.NewSimpleClientset(), 0).Core().V1().Nodes()
+	now := metav1.Now()
+	for _, node := range []*corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-b"}, Spec: corev1.NodeSpec{ProviderID: "aws:///us-east-1a/i-b"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-c"}, Spec: corev1.NodeSpec{ProviderID: "aws:///us-east-1a/i-c"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-d", DeletionTimestamp: &now}, Spec: corev1.NodeSpec{ProviderID: "aws:///us-east-1a/i-d"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-e"}, Spec: corev1.NodeSpec{ProviderID: "aws:///us-east-1a/i-e"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-f"}, Spec: corev1.NodeSpec{ProviderID: "aws:///us-east-1a/i-f"}},
+	} {
+		nodeInformer.Informer().GetStore().Add(node)
+	}
+	notFound := errors.New("InvalidInstanceID.NotFound")
+	denied := errors.New("UnauthorizedOperation: You are not authorized to perform this operation")
+
+	tcs := []struct {
+		errs     map[string]error
+		probed   string
+		expected string
+	}{
+		// Nodes with a providerID are probed first, deleted ones never.
+		{probed: "node-b"},
+		// A failure on a single node doesn't fail the probe.
+		{errs: map[string]error{"node-b": notFound}, probed: "node-b node-c"},
+		// The probe fails after maxProbeNodes nodes.
+		{errs: map[string]error{"node-b": denied, "node-c": denied, "node-e": denied}, probed: "node-b node-c node-e", expected: "the cloud rejects the credentials"},
+		{errs: map[string]error{"node-b": notFound, "node-c": notFound, "node-e": notFound}, probed: "node-b node-c node-e", expected: "error calling the cloud API"},
+	}
+	for i, tc := range tcs {
+		provider := &probedCloudProvider{errs: tc.errs}
+		err := probeCloud(provider, nodeInformer)
+		if (err == nil) != (tc.expected == "") || (err != nil && !strings.Contains(err.Error(), tc.expected)) {
+			t.Fatalf("TestProbeCloud(%d): expected error %q, got: %v", i, tc.expected, err)
+		}
+		if probed := strings.Join(provider.probed, " "); probed != tc.probed {
+			t.Fatalf("TestProbeCloud(%d): expected to probe %q, got: %q", i, tc.probed, probed)
+		}
+	}
+}
+
+func TestReady(t *testing.T) {
+	c := NewChecker()
+	now := time.Now()
+	// Replicas which aren't leading are ready.
+	if err := c.ready(now); err != nil {
+		t.Fatalf("expected a replica without cloud probe to be ready, got: %v", err)
+	}
+	c.probePeriod = time.Minute
+	if err := c.ready(now); err == nil {
+		t.Fatalf("expected the leader not to be ready before the first probe")
+	}
+	c.recordProbe(nil, now)
+	if err := c.ready(now.Add(time.Minute)); err != nil {
+		t.Fatalf("expected the leader to be ready after a successful probe, got: %v", err)
+	}
+	if err := c.ready(now.Add(4 * time.Minute)); err == nil || !strings.Contains(err.Error(), "4m0s old") {
+		t.Fatalf("expected the leader not to be ready once the last successful probe is stale, got: %v", err)
+	}
+	c.recordProbe(errors.New("AccessDenied"), now.Add(time.Minute))
+	if err := c.ready(now.Add(time.Minute)); err == nil || !strings.Contains(err.Error(), "(permission)") {
+		t.Fatalf("expected the leader not to be ready after a failed probe, got: %v", err)
+	}
+	c.recordProbe(nil, now.Add(2*time.Minute))
+	if err := c.ready(now.Add(2 * time.Minute)); err != nil {
+		t.Fatalf("expected the leader to be ready again after a successful probe, got: %v", err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	c := NewChecker()
+	var stuck error
+	c.AddLivenessCheck("node", func() error { return nil })
+	c.AddLivenessCheck("cloud-private-ip-config", func() error { return stuck })
+
+	get := func(path string) (int, string) {
+		recorder := httptest.NewRecorder()
+		c.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Code, recorder.Body.String()
+	}
+	for _, path := range []string{"/healthz", "/readyz"} {
+		if code, body := get(path); code != http.StatusOK || body != "ok\n" {
+			t.Fatalf("expected %s to succeed, got %d: %s", path, code, body)
+		}
+	}
+	stuck = errors.New("no progress")
+	if code, body := get("/healthz"); code != http.StatusServiceUnavailable || body != "cloud-private-ip-config: no progress\n" {
+		t.Fatalf("expected /healthz to fail, got %d: %s", code, body)
+	}
+	// Readiness doesn't depend on liveness.
+	if code, _ := get("/readyz"); code != http.StatusOK {
+		t.Fatalf("expected /readyz to succeed, got %d", code)
+	}
+}
@@ -0,0 +1,219 @@
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// snapshotKey and logKey are the keys of the ControllerJournal spec
+	// holding the compacted entries, respectively the operations appended
+	// since.
+	snapshotKey = "snapshot"
+	logKey      = "log"
+
+	// maxLogLength and maxLogAge trigger the compaction of the log into the
+	// snapshot: whichever is reached first.
+	maxLogLength = 100
+	maxLogAge    = 10 * time.Minute
+)
+
+// Store persists the snapshot and the log of a journal.
+type Store interface {
+	// Load returns the persisted snapshot and log, empty if nothing was
+	// persisted yet.
+	Load() (snapshot, log string, err error)
+	// Save persists the snapshot and log, replacing the previous ones.
+	Save(snapshot, log string) error
+}
+
+// operation is an entry of the log: the entry with Key is set to Value, or
+// deleted if Delete is set.
+type operation struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Delete bool   `json:"delete,omitempty"`
+}
+
+// Journal is a key/value set of entries persisted to a Store as a snapshot and
+// a log of the operations applied since. Every change appends one operation to
+// the log, the log is periodically compacted into the snapshot so that it
+// doesn't grow unbounded. It's safe for concurrent use.
+type Journal struct {
+	sync.Mutex
+	store Store
+	// snapshot holds the entries as of the last compaction, entries the
+	// current ones: the snapshot with the log applied.
+	snapshot map[string]string
+	entries  map[string]string
+	log      []string
+	// compacted is the time of the last compaction.
+	compacted time.Time
+}
+
+// Open loads the journal persisted in store, replaying its log onto its
+// snapshot.
+func Open(store Store) (*Journal, error) {
+	snapshot, log, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("error loading journal, err: %v", err)
+	}
+	j := &Journal{store: store, snapshot: map[string]string{}, compacted: time.Now()}
+	if snapshot != "" {
+		if err := json.Unmarshal([]byte(snapshot), &j.snapshot); err != nil {
+			return nil, fmt.Errorf("error parsing journal snapshot, err: %v", err)
+		}
+	}
+	j.entries = copyEntries(j.snapshot)
+	for _, line := range strings.Split(log, "\n") {
+		if line == "" {
+			continue
+		}
+		op := operation{}
+		if err := json.Unmarshal([]byte(line), &op); err != nil {
+			return nil, fmt.Errorf("error parsing journal log entry %q, err: %v", line, err)
+		}
+		j.apply(op)
+		j.log = append(j.log, line)
+	}
+	return j, nil
+}
+
+// Entries returns a copy of the entries of the journal.
+func (j *Journal) Entries() map[string]string {
+	j.Lock()
+	defer j.Unlock()
+	return copyEntries(j.entries)
+}
+
+// Put sets the entry key to value and persists the change.
+func (j *Journal) Put(key, value string) error {
+	return j.append(operation{Key: key, Value: value})
+}
+
+// Delete deletes the entry key and persists the change.
+func (j *Journal) Delete(key string) error {
+	return j.append(operation{Key: key, Delete: true})
+}
+
+// Compact folds the log into the snapshot and persists them.
+func (j *Journal) Compact() error {
+	j.Lock()
+	defer j.Unlock()
+	return j.compact()
+}
+
+func (j *Journal) append(op operation) error {
+	j.Lock()
+	defer j.Unlock()
+	j.apply(op)
+	if len(j.log)+1 >= maxLogLength || time.Since(j.compacted) >= maxLogAge {
+		return j.compact()
+	}
+	line, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	j.log = append(j.log, string(line))
+	return j.save()
+}
+
+func (j *Journal) apply(op operation) {
+	if op.Delete {
+		delete(j.entries, op.Key)
+	} else {
+		j.entries[op.Key] = op.Value
+	}
+}
+
+func (j *Journal) compact() error {
+	snapshot, log := j.snapshot, j.log
+	j.snapshot, j.log = copyEntries(j.entries), nil
+	if err := j.save(); err != nil {
+		j.snapshot, j.log = snapshot, log
+		return err
+	}
+	j.compacted = time.Now()
+	return nil
+}
+
+func (j *Journal) save() error {
+	snapshot, err := json.Marshal(j.snapshot)
+	if err != nil {
+		return err
+	}
+	log := ""
+	if len(j.log) > 0 {
+		log = strings.Join(j.log, "\n") + "\n"
+	}
+	if err := j.store.Save(string(snapshot), log); err != nil {
+		return fmt.Errorf("error persisting journal, err: %v", err)
+	}
+	return nil
+}
+
+func copyEntries(entries map[string]string) map[string]string {
+	copied := make(map[string]string, len(entries))
+	for key, value := range entries {
+		copied[key] = value
+	}
+	return copied
+}
+
+// customResourceJournalResource is the resource of ControllerJournals, see
+// manifests/cloudnetworkconfig.openshift.io_controllerjournals.yaml
+var customResourceJournalResource = schema.GroupVersionResource{
+	Group:    "cloudnetworkconfig.openshift.io",
+	Version:  "v1alpha1",
+	Resource: "controllerjournals",
+}
+
+// CustomResourceStore is a Store persisting the journal in the cluster scoped
+// ControllerJournal Name, which is created on the first save. It outlives the
+// controller, so that the replica taking over the leader election resumes it.
+type CustomResourceStore struct {
+	Client dynamic.Interface
+	Name   string
+}
+
+func (s *CustomResourceStore) Load() (string, string, error) {
+	controllerJournal, err := s.Client.Resource(customResourceJournalResource).Get(context.TODO(), s.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", "", nil
+	} else if err != nil {
+		return "", "", err
+	}
+	snapshot, _, _ := unstructured.NestedString(controllerJournal.Object, "spec", snapshotKey)
+	log, _, _ := unstructured.NestedString(controllerJournal.Object, "spec", logKey)
+	return snapshot, log, nil
+}
+
+func (s *CustomResourceStore) Save(snapshot, log string) error {
+	client := s.Client.Resource(customResourceJournalResource)
+	spec := map[string]interface{}{snapshotKey: snapshot, logKey: log}
+	controllerJournal, err := client.Get(context.TODO(), s.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		controllerJournal = &unstructured.Unstructured{}
+		controllerJournal.SetAPIVersion(customResourceJournalResource.GroupVersion().String())
+		controllerJournal.SetKind("ControllerJournal")
+		controllerJournal.SetName(s.Name)
+		controllerJournal.Object["spec"] = spec
+		_, err = client.Create(context.TODO(), controllerJournal, metav1.CreateOptions{})
+		return err
+	} else if err != nil {
+		return err
+	}
+	controllerJournal.Object["spec"] = spec
+	_, err = client.Update(context.TODO(), controllerJournal, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,85 @@
+package journal
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestJournal(t *testing.T) {
+	store := &CustomResourceStore{Client: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()), Name: "journal"}
+	j, err := Open(store)
+	if err != nil {
+		t.Fatalf("TestJournal: unexpected error opening empty journal, err: %v", err)
+	}
+	if len(j.Entries()) != 0 {
+		t.Fatalf("TestJournal: expected empty journal, got %v", j.Entries())
+	}
+	if err := j.Put("port-a", "server-a"); err != nil {
+		t.Fatalf("TestJournal: unexpected error, err: %v", err)
+	}
+	if err := j.Put("port-b", "server-b"); err != nil {
+		t.Fatalf("TestJournal: unexpected error, err: %v", err)
+	}
+	if err := j.Delete("port-a"); err != nil {
+		t.Fatalf("TestJournal: unexpected error, err: %v", err)
+	}
+
+	// The changes are appended to the log, the snapshot is still empty.
+	snapshot, log, err := store.Load()
+	if err != nil {
+		t.Fatalf("TestJournal: unexpected error, err: %v", err)
+	}
+	if snapshot != "{}" || strings.Count(log, "\n") != 3 {
+		t.Fatalf("TestJournal: expected an empty snapshot and 3 log entries, got snapshot %q and log %q", snapshot, log)
+	}
+
+	// A restart replays the log onto the snapshot.
+	expected := map[string]string{"port-b": "server-b"}
+	if j, err = Open(store); err != nil {
+		t.Fatalf("TestJournal: unexpected error reopening journal, err: %v", err)
+	}
+	if !reflect.DeepEqual(j.Entries(), expected) {
+		t.Fatalf("TestJournal: expected entries %v after restart, got %v", expected, j.Entries())
+	}
+
+	// Compaction folds the log into the snapshot.
+	if err := j.Compact(); err != nil {
+		t.Fatalf("TestJournal: unexpected error compacting, err: %v", err)
+	}
+	if snapshot, log, _ = store.Load(); snapshot != `{"port-b":"server-b"}` || log != "" {
+		t.Fatalf("TestJournal: expected compacted snapshot and empty log, got snapshot %q and log %q", snapshot, log)
+	}
+	if j, _ = Open(store); !reflect.DeepEqual(j.Entries(), expected) {
+		t.Fatalf("TestJournal: expected entries %v after compaction, got %v", expected, j.Entries())
+	}
+
+	// The log doesn't grow beyond its maximum length.
+	for i := 0; i < 2*maxLogLength; i++ {
+		if err := j.Put(fmt.Sprintf("port-%d", i), "server"); err != nil {
+			t.Fatalf("TestJournal: unexpected error, err: %v", err)
+		}
+	}
+	if _, log, _ = store.Load(); strings.Count(log, "\n") >= maxLogLength {
+		t.Fatalf("TestJournal: expected log to be compacted, got %d entries", strings.Count(log, "\n"))
+	}
+	if j, _ = Open(store); len(j.Entries()) != 2*maxLogLength+1 {
+		t.Fatalf("TestJournal: expected %d entries, got %d", 2*maxLogLength+1, len(j.Entries()))
+	}
+}
+
+func TestOpenCorrupted(t *testing.T) {
+	store := &CustomResourceStore{Client: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()), Name: "journal"}
+	for i, data := range [][2]string{{"{", ""}, {"{}", "{\"key\": \"port-a\"}\nnot-json\n"}} {
+		if err := store.Save(data[0], data[1]); err != nil {
+			t.Fatalf("TestOpenCorrupted(%d): unexpected error, err: %v", i, err)
+		}
+		if _, err := Open(store); err == nil {
+			t.Fatalf("TestOpenCorrupted(%d): expected an error", i)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package maintenance
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDuration is the maximum duration of a maintenance window.
+const maxDuration = 7 * 24 * time.Hour
+
+// Window is a recurring maintenance window of the cloud: it starts every time
+// its cron schedule matches, in UTC, and lasts its duration.
+type Window struct {
+	spec     string
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	// anyDay and anyWeekday are set if the day of month, respectively the
+	// day of week, field is "*". As in cron, if both fields are restricted, a
+	// day matches if either of them does.
+	anyDay     bool
+	anyWeekday bool
+	duration   time.Duration
+}
+
+// Windows are the maintenance windows of the cloud. The zero value has no
+// window, it's never active.
+type Windows []*Window
+
+// ParseWindow parses a maintenance window made of a cron schedule - minute,
+// hour, day of month, month, day of week - and a duration, e.g. "0 2 * * 0"
+// and "4h" for every Sunday from 2:00 to 6:00 UTC.
+func ParseWindow(schedule, duration string) (*Window, error) {
+	if len(strings.Fields(schedule)) != 5 {
+		return nil, fmt.Errorf("invalid maintenance window schedule %q, expected <minute> <hour> <day of month> <month> <day of week>", schedule)
+	}
+	spec := strings.TrimSpace(schedule) + " " + strings.TrimSpace(duration)
+	window, err := parseWindow(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maintenance window %q, %v", spec, err)
+	}
+	return window, nil
+}
+
+func parseWindow(spec string) (*Window, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("expected <minute> <hour> <day of month> <month> <day of week> <duration>")
+	}
+	w := &Window{spec: spec, anyDay: fields[2] == "*", anyWeekday: fields[4] == "*"}
+	var err error
+	if w.minutes, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("minute: %v", err)
+	}
+	if w.hours, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("hour: %v", err)
+	}
+	if w.days, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("day of month: %v", err)
+	}
+	if w.months, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("month: %v", err)
+	}
+	if w.weekdays, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("day of week: %v", err)
+	}
+	// Both 0 and 7 are Sunday.
+	if w.weekdays&(1<<7) != 0 {
+		w.weekdays |= 1
+	}
+	if w.duration, err = time.ParseDuration(fields[5]); err != nil || w.duration <= 0 || w.duration > maxDuration {
+		return nil, fmt.Errorf("duration: expected a positive duration of at most %s", maxDuration)
+	}
+	return w, nil
+}
+
+// parseField parses a comma separated list of values, ranges (a-b) or "*",
+// each optionally followed by a step (/n), into the bitmask of the matching
+// values between min and max.
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rangeSpec, stepSpec, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepSpec); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepSpec)
+			}
+		}
+		start, end := min, max
+		if rangeSpec != "*" {
+			startSpec, endSpec, isRange := strings.Cut(rangeSpec, "-")
+			var err error
+			if start, err = strconv.Atoi(startSpec); err != nil {
+				return 0, fmt.Errorf("invalid value %q", startSpec)
+			}
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(endSpec); err != nil {
+					return 0, fmt.Errorf("invalid value %q", endSpec)
+				}
+			} else if hasStep {
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("%q is out of range %d-%d", item, min, max)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// matchesDay returns true if the day of t, in UTC, matches the day of month
+// and day of week fields.
+func (w *Window) matchesDay(t time.Time) bool {
+	day, weekday := w.days&(1<<uint(t.Day())) != 0, w.weekdays&(1<<uint(t.Weekday())) != 0
+	if !w.anyDay && !w.anyWeekday {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+// previousStart returns the latest start of the window at or before now if
+// the window is still running, the zero time otherwise. Like cron computes
+// the next start, it walks back field by field, from the month down to the
+// minute, jumping to the previous matching hour and minute at once.
+func (w *Window) previousStart(now time.Time) time.Time {
+	earliest := now.UTC().Add(-w.duration)
+	t := now.UTC().Truncate(time.Minute)
+	for t.After(earliest) {
+		startOfDay := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		if w.months&(1<<uint(t.Month())) == 0 {
+			// The last minute of the previous month.
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC).Add(-time.Minute)
+			continue
+		}
+		if !w.matchesDay(t) {
+			t = startOfDay.Add(-time.Minute)
+			continue
+		}
+		hours := w.hours & (1<<uint(t.Hour()+1) - 1)
+		if hours == 0 {
+			t = startOfDay.Add(-time.Minute)
+			continue
+		}
+		if hour := bits.Len64(hours) - 1; hour < t.Hour() {
+			t = startOfDay.Add(time.Duration(hour)*time.Hour + 59*time.Minute)
+		}
+		minutes := w.minutes & (1<<uint(t.Minute()+1) - 1)
+		if minutes == 0 {
+			t = t.Truncate(time.Hour).Add(-time.Minute)
+			continue
+		}
+		t = t.Truncate(time.Hour).Add(time.Duration(bits.Len64(minutes)-1) * time.Minute)
+		if t.After(earliest) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Active returns the end of the maintenance window now falls into, and true,
+// or false if none does. If windows overlap, the latest end is returned.
+func (w Windows) Active(now time.Time) (time.Time, bool) {
+	var end time.Time
+	for _, window := range w {
+		// The most recent start of the window ends last.
+		if start := window.previousStart(now); !start.IsZero() {
+			if windowEnd := start.Add(window.duration); windowEnd.After(end) {
+				end = windowEnd
+			}
+		}
+	}
+	return end, !end.IsZero()
+}
+
+// String returns the specs of the windows, as parsed.
+func (w Windows) String() string {
+	specs := make([]string, 0, len(w))
+	for _, window := range w {
+		specs = append(specs, window.spec)
+	}
+	return strings.Join(specs, "; ")
+}
@@ -0,0 +1,145 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tcs := []struct {
+		spec string
+		err  bool
+	}{
+		{spec: "0 2 * * 0 4h"},
+		{spec: "30 22 1,15 * * 90m"},
+		{spec: "*/15 0-6 * 1-12/3 1-5 10m"},
+		{spec: "0 2 * * 7 4h"},
+		{spec: "0 2 * * 0", err: true},
+		{spec: "60 2 * * 0 4h", err: true},
+		{spec: "0 2 0 * * 4h", err: true},
+		{spec: "0 2 * * 0 -4h", err: true},
+		{spec: "0 2 * * 0 192h", err: true},
+		{spec: "0 2 * * 3-1 4h", err: true},
+		{spec: "0 2 * * */0 4h", err: true},
+		{spec: "0 2 * * SUN 4h", err: true},
+	}
+
+	for i, tc := range tcs {
+		_, err := parseWindow(tc.spec)
+		if tc.err && err == nil {
+			t.Fatalf("TestParse(%d): expected an error for %q", i, tc.spec)
+		}
+		if !tc.err && err != nil {
+			t.Fatalf("TestParse(%d): unexpected error, err: %q", i, err)
+		}
+	}
+}
+
+// mustParseWindows returns the windows of the schedule and duration pairs.
+func mustParseWindows(t *testing.T, specs ...[2]string) Windows {
+	var windows Windows
+	for _, spec := range specs {
+		window, err := ParseWindow(spec[0], spec[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		windows = append(windows, window)
+	}
+	return windows
+}
+
+func TestActive(t *testing.T) {
+	// Every Sunday from 2:00 to 6:00, and on the 1st and 15th of every month
+	// from 22:30 to 00:00.
+	windows := mustParseWindows(t, [2]string{"0 2 * * 0", "4h"}, [2]string{"30 22 1,15 * *", "90m"})
+	tcs := []struct {
+		now    string
+		active bool
+		end    string
+	}{
+		// 2022-05-01 is a Sunday, and the 1st.
+		{now: "2022-05-01T01:59:59Z", active: false},
+		{now: "2022-05-01T02:00:00Z", active: true, end: "2022-05-01T06:00:00Z"},
+		{now: "2022-05-01T05:59:59Z", active: true, end: "2022-05-01T06:00:00Z"},
+		{now: "2022-05-01T06:00:00Z", active: false},
+		{now: "2022-05-01T23:59:00Z", active: true, end: "2022-05-02T00:00:00Z"},
+		{now: "2022-05-02T00:00:00Z", active: false},
+		{now: "2022-05-08T03:00:00Z", active: true, end: "2022-05-08T06:00:00Z"},
+		{now: "2022-05-09T03:00:00Z", active: false},
+		// Times in other time zones are converted to UTC.
+		{now: "2022-05-01T04:00:00+02:00", active: true, end: "2022-05-01T06:00:00Z"},
+	}
+	for i, tc := range tcs {
+		now, _ := time.Parse(time.RFC3339, tc.now)
+		end, active := windows.Active(now)
+		if active != tc.active {
+			t.Fatalf("TestActive(%d): expected active %t at %s, got %t", i, tc.active, tc.now, active)
+		}
+		if expected, _ := time.Parse(time.RFC3339, tc.end); active && !end.Equal(expected) {
+			t.Fatalf("TestActive(%d): expected window ending at %s, got %s", i, tc.end, end)
+		}
+	}
+
+	// Without windows, maintenance is never active.
+	if _, active := Windows(nil).Active(time.Now()); active {
+		t.Fatalf("TestActive: expected no window to be active")
+	}
+
+	// Both fields restricted: either the day of month or the day of week
+	// must match, like cron. 2022-05-13 is a Friday.
+	windows = mustParseWindows(t, [2]string{"0 0 13 * 5", "24h"})
+	for i, now := range []string{"2022-05-06T12:00:00Z", "2022-05-13T12:00:00Z", "2022-06-13T12:00:00Z"} {
+		parsed, _ := time.Parse(time.RFC3339, now)
+		if _, active := windows.Active(parsed); !active {
+			t.Fatalf("TestActive(%d): expected window to be active at %s", i, now)
+		}
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	if _, err := ParseWindow("0 2 * * 0", "4h"); err != nil {
+		t.Fatalf("TestParseWindow: unexpected error, err: %q", err)
+	}
+	for i, tc := range [][2]string{{"0 2 * *", "4h"}, {"0 2 * * 0 4h", ""}, {"0 2 * * 0", "0s"}} {
+		if _, err := ParseWindow(tc[0], tc[1]); err == nil {
+			t.Fatalf("TestParseWindow(%d): expected an error for %q and %q", i, tc[0], tc[1])
+		}
+	}
+}
+
+// TestPreviousStart compares previousStart with a scan of every minute of the
+// window's duration before now.
+func TestPreviousStart(t *testing.T) {
+	starts := func(w *Window, t time.Time) bool {
+		return w.minutes&(1<<uint(t.Minute())) != 0 && w.hours&(1<<uint(t.Hour())) != 0 &&
+			w.months&(1<<uint(t.Month())) != 0 && w.matchesDay(t)
+	}
+	specs := []string{
+		"0 2 * * 0 4h",
+		"30 22 1,15 * * 90m",
+		"*/15 0-6 * 1-12/3 1-5 10m",
+		"0 0 13 * 5 24h",
+		"45 23 31 12 * 168h",
+		"0,59 * * * * 2m",
+		"0 0 29 2 * 48h",
+	}
+	begin, _ := time.Parse(time.RFC3339, "2023-12-29T00:00:00Z")
+	for _, spec := range specs {
+		window, err := parseWindow(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for now := begin; now.Before(begin.AddDate(0, 3, 0)); now = now.Add(37*time.Minute + 13*time.Second) {
+			var expected time.Time
+			for start := now.Truncate(time.Minute); now.Before(start.Add(window.duration)); start = start.Add(-time.Minute) {
+				if starts(window, start) {
+					expected = start
+					break
+				}
+			}
+			if start := window.previousStart(now); !start.Equal(expected) {
+				t.Fatalf("TestPreviousStart: expected window %q running at %s to start at %s, got %s", spec, now, expected, start)
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/klog/v2"
+)
+
+// Namespace prefixes the name of every metric exposed by this controller.
+const Namespace = "cloud_network_config_controller"
+
+// Registry holds all metrics of the controller, along with those of the Go
+// runtime and of the process.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// DefaultDurationBuckets are the upper bounds, in seconds, of the buckets of
+// histograms of request durations.
+var DefaultDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Handler renders the metrics of the Registry, for Prometheus to scrape.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{ErrorLog: errorLogger{}})
+}
+
+// Serve serves the metrics of the Registry on /metrics of the port until the
+// stop channel is closed.
+func Serve(stopCh <-chan struct{}, port int) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-stopCh
+		server.Close()
+	}()
+	klog.Infof("Serving metrics on port %d", port)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		klog.Exitf("Error serving metrics: %v", err)
+	}
+}
+
+// errorLogger logs the errors gathering metrics.
+type errorLogger struct{}
+
+func (errorLogger) Println(v ...interface{}) {
+	klog.Error(v...)
+}
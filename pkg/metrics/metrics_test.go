@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHandler(t *testing.T) {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "test_handler_total",
+		Help:      "Handled.",
+	}, []string{"name"})
+	Registry.MustRegister(counter)
+	defer Registry.Unregister(counter)
+	// Only backslashes, double quotes and line feeds are escaped in label
+	// values, tabs and non-ASCII characters are kept as is.
+	counter.WithLabelValues("a\"b\\c\nd\té").Inc()
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, recorder.Code)
+	}
+	expected := "# HELP cloud_network_config_controller_test_handler_total Handled.\n" +
+		"# TYPE cloud_network_config_controller_test_handler_total counter\n" +
+		"cloud_network_config_controller_test_handler_total{name=\"a\\\"b\\\\c\\nd\té\"} 1\n"
+	if !strings.Contains(recorder.Body.String(), expected) {
+		t.Fatalf("expected metrics to contain\n%s\ngot\n%s", expected, recorder.Body.String())
+	}
+	// The metrics of the Go runtime are exposed as well.
+	if !strings.Contains(recorder.Body.String(), "\ngo_goroutines ") {
+		t.Fatalf("expected the metrics of the Go runtime, got\n%s", recorder.Body.String())
+	}
+}
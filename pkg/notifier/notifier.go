@@ -0,0 +1,156 @@
+package notifier
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// EventType is the type of an assignment lifecycle event.
+type EventType string
+
+const (
+	// EventAssigned is fired once an IP address is assigned to, or moved
+	// to, a node.
+	EventAssigned EventType = "Assigned"
+	// EventReleased is fired once an IP address is released from a node.
+	EventReleased EventType = "Released"
+	// EventRepaired is fired once an IP address removed out of band from its
+	// node is assigned again.
+	EventRepaired EventType = "Repaired"
+	// EventQuarantined is fired once the controller gives up on an object
+	// after failing to process it as many times as its retry policy allows.
+	// It's only processed again on its next change.
+	EventQuarantined EventType = "Quarantined"
+	// EventCapacityExhausted is fired if a node has no capacity left for
+	// egress IP addresses.
+	EventCapacityExhausted EventType = "CapacityExhausted"
+	// EventDiverged is fired if the cloud state resync finds an IP address
+	// missing from the node it's assigned to, or assigned on the cloud to a
+	// node without any CloudPrivateIPConfig.
+	EventDiverged EventType = "Diverged"
+	// EventPlanned is fired for every change the controller would perform on
+	// the cloud in read-only or dry-run mode, with the planned change, or why
+	// it would fail, as message.
+	EventPlanned EventType = "Planned"
+
+	// queueSize is the number of events buffered for delivery, events are
+	// dropped once it's full.
+	queueSize = 1024
+	// sinkTimeout is the timeout of the delivery of an event to one sink.
+	sinkTimeout = 5 * time.Second
+)
+
+// Event is an assignment lifecycle event.
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	// Object is the name of the object the event is about, i.e. the
+	// CloudPrivateIPConfig or the Node.
+	Object  string `json:"object"`
+	IP      string `json:"ip,omitempty"`
+	Node    string `json:"node,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// String renders the event as a human readable sentence.
+func (e Event) String() string {
+	s := fmt.Sprintf("%s: %s", e.Type, e.Object)
+	if e.IP != "" && e.IP != e.Object {
+		s += fmt.Sprintf(", IP address %s", e.IP)
+	}
+	if e.Node != "" && e.Node != e.Object {
+		s += fmt.Sprintf(", node %s", e.Node)
+	}
+	if e.Message != "" {
+		s += ": " + e.Message
+	}
+	return s
+}
+
+// Sink delivers events to an external system.
+type Sink interface {
+	// Send delivers the event, returning an error if it couldn't.
+	Send(e Event) error
+	// String identifies the sink in logs.
+	String() string
+}
+
+// Dispatcher delivers events to all its sinks, asynchronously, so that the
+// controllers firing them never wait on a sink. A nil Dispatcher drops all
+// events, which is what the controllers get when no sink is configured.
+type Dispatcher struct {
+	sinks  []Sink
+	events chan Event
+}
+
+// NewDispatcher returns a Dispatcher delivering to sinks, or nil if there's no
+// sink. Run must be called for the events to be delivered.
+func NewDispatcher(sinks ...Sink) *Dispatcher {
+	if len(sinks) == 0 {
+		return nil
+	}
+	return &Dispatcher{
+		sinks:  sinks,
+		events: make(chan Event, queueSize),
+	}
+}
+
+// Notify queues the event for delivery, or drops it if the queue is full.
+func (d *Dispatcher) Notify(e Event) {
+	if d == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	select {
+	case d.events <- e:
+	default:
+		klog.Warningf("Dropping notification %q, the notification queue is full", e)
+	}
+}
+
+// Run delivers the queued events until stopCh is closed. Failed deliveries
+// are logged, not retried: notifications are informative, the state of all
+// assignments stays available on the API server.
+func (d *Dispatcher) Run(stopCh <-chan struct{}) {
+	if d == nil {
+		return
+	}
+	for {
+		select {
+		case e := <-d.events:
+			for _, sink := range d.sinks {
+				if err := sink.Send(e); err != nil {
+					klog.Warningf("Could not deliver notification %q to %s, err: %v", e, sink, err)
+				}
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// NewSink returns a sink of kind, one of: webhook, slack, cloudevents,
+// delivering the events to endpoint, an http(s) URL. source is the source of
+// CloudEvents.
+func NewSink(kind, endpoint, source string) (Sink, error) {
+	u, err := url.Parse(strings.TrimSpace(endpoint))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid %s notification sink, expected an http(s) URL", kind)
+	}
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case "webhook":
+		return newWebhookSink(u.String()), nil
+	case "slack":
+		return newSlackSink(u.String()), nil
+	case "cloudevents":
+		return newCloudEventsSink(u.String(), source), nil
+	default:
+		return nil, fmt.Errorf("invalid notification sink kind %q, expected one of: webhook, slack, cloudevents", kind)
+	}
+}
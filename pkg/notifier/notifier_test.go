@@ -0,0 +1,102 @@
+package notifier
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSink(t *testing.T) {
+	tcs := []struct {
+		kind     string
+		endpoint string
+		err      bool
+	}{
+		{kind: "webhook", endpoint: "https://example.com/hook"},
+		{kind: "slack", endpoint: "https://hooks.slack.com/services/T/B/X"},
+		{kind: "CloudEvents", endpoint: " http://broker.example.com"},
+		{kind: "email", endpoint: "mailto:netops@example.com", err: true},
+		{kind: "email", endpoint: "https://example.com/hook", err: true},
+		{kind: "webhook", endpoint: "example.com/hook", err: true},
+		{kind: "webhook", endpoint: "", err: true},
+	}
+
+	for i, tc := range tcs {
+		sink, err := NewSink(tc.kind, tc.endpoint, "/test")
+		if tc.err {
+			if err == nil {
+				t.Fatalf("TestNewSink(%d): expected an error for %s=%q", i, tc.kind, tc.endpoint)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("TestNewSink(%d): unexpected error, err: %q", i, err)
+		}
+		if strings.Contains(sink.String(), "/services/") {
+			t.Fatalf("TestNewSink(%d): expected the sink not to show the path of its URL, got %q", i, sink)
+		}
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	type request struct {
+		path        string
+		contentType string
+		body        map[string]interface{}
+	}
+	requests := make(chan request, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		decoded := map[string]interface{}{}
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			t.Errorf("TestDispatcher: invalid payload %s, err: %q", body, err)
+		}
+		requests <- request{path: r.URL.Path, contentType: r.Header.Get("Content-Type"), body: decoded}
+	}))
+	defer server.Close()
+
+	var sinks []Sink
+	for _, kind := range []string{"webhook", "slack", "cloudevents"} {
+		sink, err := NewSink(kind, server.URL+"/"+kind, "/test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sinks = append(sinks, sink)
+	}
+	dispatcher := NewDispatcher(sinks...)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go dispatcher.Run(stopCh)
+
+	dispatcher.Notify(Event{Type: EventAssigned, Object: "10.0.0.10", IP: "10.0.0.10", Node: "worker-0"})
+	for i := 0; i < 3; i++ {
+		select {
+		case r := <-requests:
+			switch r.path {
+			case "/webhook":
+				if r.body["type"] != string(EventAssigned) || r.body["node"] != "worker-0" {
+					t.Fatalf("TestDispatcher: unexpected webhook payload %v", r.body)
+				}
+			case "/slack":
+				if r.body["text"] != "Assigned: 10.0.0.10, node worker-0" {
+					t.Fatalf("TestDispatcher: unexpected slack payload %v", r.body)
+				}
+			case "/cloudevents":
+				if r.contentType != "application/cloudevents+json" || r.body["specversion"] != "1.0" ||
+					r.body["type"] != cloudEventsTypePrefix+"assigned" || r.body["source"] != "/test" {
+					t.Fatalf("TestDispatcher: unexpected cloudevents payload %v", r.body)
+				}
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("TestDispatcher: expected 3 notifications, got %d", i)
+		}
+	}
+
+	// Without sinks, events are dropped.
+	disabled := NewDispatcher()
+	disabled.Notify(Event{Type: EventReleased, Object: "10.0.0.10"})
+}
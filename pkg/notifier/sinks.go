@@ -0,0 +1,119 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cloudEventsTypePrefix prefixes the type of all CloudEvents, followed by the
+// event type in lower case.
+const cloudEventsTypePrefix = "com.openshift.cloud-network-config-controller."
+
+// httpSink POSTs a JSON payload built out of every event to url.
+type httpSink struct {
+	kind        string
+	url         string
+	contentType string
+	payload     func(e Event) interface{}
+	client      *http.Client
+}
+
+func (s *httpSink) Send(e Event) error {
+	body, err := json.Marshal(s.payload(e))
+	if err != nil {
+		return fmt.Errorf("error serializing notification, err: %v", err)
+	}
+	resp, err := s.client.Post(s.url, s.contentType, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return nil
+}
+
+// String only shows the scheme and host of the URL: the URLs of incoming
+// webhooks usually embed a token.
+func (s *httpSink) String() string {
+	u, err := url.Parse(s.url)
+	if err != nil {
+		return fmt.Sprintf("%s sink", s.kind)
+	}
+	return fmt.Sprintf("%s sink %s://%s", s.kind, u.Scheme, u.Host)
+}
+
+// newWebhookSink returns a sink POSTing the events, as is, to url.
+func newWebhookSink(url string) Sink {
+	return &httpSink{
+		kind:        "webhook",
+		url:         url,
+		contentType: "application/json",
+		payload:     func(e Event) interface{} { return e },
+		client:      &http.Client{Timeout: sinkTimeout},
+	}
+}
+
+// newSlackSink returns a sink POSTing the events as messages to a Slack
+// compatible incoming webhook.
+func newSlackSink(url string) Sink {
+	return &httpSink{
+		kind:        "slack",
+		url:         url,
+		contentType: "application/json",
+		payload: func(e Event) interface{} {
+			return struct {
+				Text string `json:"text"`
+			}{
+				Text: e.String(),
+			}
+		},
+		client: &http.Client{Timeout: sinkTimeout},
+	}
+}
+
+// cloudEvent is a CloudEvent in the structured content mode, see:
+// https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/formats/json-format.md
+type cloudEvent struct {
+	SpecVersion     string `json:"specversion"`
+	ID              string `json:"id"`
+	Source          string `json:"source"`
+	Type            string `json:"type"`
+	Subject         string `json:"subject,omitempty"`
+	Time            string `json:"time"`
+	DataContentType string `json:"datacontenttype"`
+	Data            Event  `json:"data"`
+}
+
+// newCloudEventsSink returns a sink POSTing the events as CloudEvents, with
+// source as source.
+func newCloudEventsSink(url, source string) Sink {
+	return &httpSink{
+		kind:        "cloudevents",
+		url:         url,
+		contentType: "application/cloudevents+json",
+		payload: func(e Event) interface{} {
+			return cloudEvent{
+				SpecVersion:     "1.0",
+				ID:              e.Object + "-" + strconv.FormatInt(e.Time.UnixNano(), 10),
+				Source:          source,
+				Type:            cloudEventsTypePrefix + strings.ToLower(string(e.Type)),
+				Subject:         e.Object,
+				Time:            e.Time.UTC().Format(time.RFC3339Nano),
+				DataContentType: "application/json",
+				Data:            e,
+			}
+		},
+		client: &http.Client{Timeout: sinkTimeout},
+	}
+}
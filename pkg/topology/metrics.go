@@ -0,0 +1,61 @@
+package topology
+
+import (
+	cloudnetworklisters "github.com/openshift/client-go/cloudnetwork/listers/cloudnetwork/v1"
+	"github.com/openshift/cloud-network-config-controller/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+)
+
+var remainingCapacityDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(metrics.Namespace, "", "node_egress_ip_capacity_remaining"),
+	"Number of egress IPs which can still be assigned to the node, by node and address family: ip if the capacity is family agnostic, ipv4 or ipv6 otherwise.",
+	[]string{"node", "family"},
+	nil,
+)
+
+// RegisterRemainingCapacityMetric registers the gauge of the egress IP
+// capacity left on each node, see RemainingCapacity, built from the informer
+// caches on every scrape.
+func RegisterRemainingCapacityMetric(nodesLister corelisters.NodeLister, cloudPrivateIPConfigLister cloudnetworklisters.CloudPrivateIPConfigLister) {
+	metrics.Registry.MustRegister(&remainingCapacityCollector{
+		nodesLister:                nodesLister,
+		cloudPrivateIPConfigLister: cloudPrivateIPConfigLister,
+	})
+}
+
+// remainingCapacityCollector collects the remaining capacity of the nodes
+// from the informer caches.
+type remainingCapacityCollector struct {
+	nodesLister                corelisters.NodeLister
+	cloudPrivateIPConfigLister cloudnetworklisters.CloudPrivateIPConfigLister
+}
+
+func (c *remainingCapacityCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- remainingCapacityDesc
+}
+
+func (c *remainingCapacityCollector) Collect(ch chan<- prometheus.Metric) {
+	nodes, err := c.nodesLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Error listing nodes for the remaining capacity metric, err: %v", err)
+		return
+	}
+	cloudPrivateIPConfigs, err := c.cloudPrivateIPConfigLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Error listing CloudPrivateIPConfigs for the remaining capacity metric, err: %v", err)
+		return
+	}
+	topology, err := Build(nodes, cloudPrivateIPConfigs)
+	if err != nil {
+		klog.Errorf("Error building the egress IP topology for the remaining capacity metric, err: %v", err)
+		return
+	}
+	for node, byFamily := range topology.RemainingCapacity() {
+		for family, remaining := range byFamily {
+			ch <- prometheus.MustNewConstMetric(remainingCapacityDesc, prometheus.GaugeValue, float64(remaining), node, family)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package topology
+
+import (
+	"strings"
+	"testing"
+
+	cloudnetworklisters "github.com/openshift/client-go/cloudnetwork/listers/cloudnetwork/v1"
+	"github.com/openshift/cloud-network-config-controller/pkg/conditions"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestRemainingCapacityCollector(t *testing.T) {
+	nodes := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	cloudPrivateIPConfigs := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	nodes.Add(newNode("worker-0", `[{"interface":"eni-0","ifaddr":{"ipv4":"10.0.0.0/24"},"capacity":{"ipv4":14}}]`))
+	collector := &remainingCapacityCollector{
+		nodesLister:                corelisters.NewNodeLister(nodes),
+		cloudPrivateIPConfigLister: cloudnetworklisters.NewCloudPrivateIPConfigLister(cloudPrivateIPConfigs),
+	}
+
+	for _, remaining := range []string{"14", "13"} {
+		expected := "# HELP cloud_network_config_controller_node_egress_ip_capacity_remaining Number of egress IPs which can still be assigned to the node, by node and address family: ip if the capacity is family agnostic, ipv4 or ipv6 otherwise.\n" +
+			"# TYPE cloud_network_config_controller_node_egress_ip_capacity_remaining gauge\n" +
+			"cloud_network_config_controller_node_egress_ip_capacity_remaining{family=\"ipv4\",node=\"worker-0\"} " + remaining + "\n" +
+			"cloud_network_config_controller_node_egress_ip_capacity_remaining{family=\"ipv6\",node=\"worker-0\"} 0\n"
+		if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+			t.Fatalf("TestRemainingCapacityCollector: unexpected metrics, err: %v", err)
+		}
+		// The capacity is collected again from the caches on every scrape.
+		cloudPrivateIPConfigs.Add(newCloudPrivateIPConfig("10.0.0.10", "worker-0", metav1.ConditionTrue, conditions.ReasonCloudResponseSuccess))
+	}
+}
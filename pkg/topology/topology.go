@@ -0,0 +1,282 @@
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	cloudprovider "github.com/openshift/cloud-network-config-controller/pkg/cloudprovider"
+	"github.com/openshift/cloud-network-config-controller/pkg/conditions"
+	cloudprivateipconfigcontroller "github.com/openshift/cloud-network-config-controller/pkg/controller/cloudprivateipconfig"
+	nodecontroller "github.com/openshift/cloud-network-config-controller/pkg/controller/node"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Topology is the layout of the egress IPs: nodes -> interfaces -> subnets ->
+// egress IPs, as published by the controller on the nodes' egress IP
+// configuration annotation and the CloudPrivateIPConfigs.
+type Topology struct {
+	Nodes []*Node `json:"nodes"`
+	// Unassigned are the egress IPs not assigned to any node.
+	Unassigned []*EgressIP `json:"unassigned,omitempty"`
+}
+
+type Node struct {
+	Name       string       `json:"name"`
+	Interfaces []*Interface `json:"interfaces,omitempty"`
+	// EgressIPs are the egress IPs assigned to the node outside the subnets
+	// of its interfaces, e.g. if the node is not annotated yet.
+	EgressIPs []*EgressIP `json:"egressIPs,omitempty"`
+}
+
+type Interface struct {
+	Name         string    `json:"name"`
+	MAC          string    `json:"mac,omitempty"`
+	IPv4Capacity int       `json:"ipv4Capacity,omitempty"`
+	IPv6Capacity int       `json:"ipv6Capacity,omitempty"`
+	IPCapacity   int       `json:"ipCapacity,omitempty"`
+	Subnets      []*Subnet `json:"subnets,omitempty"`
+}
+
+type Subnet struct {
+	CIDR string `json:"cidr"`
+	// Secondary is set on the subnets the interface has IP addresses on, but
+	// which egress IPs are not assigned on.
+	Secondary bool        `json:"secondary,omitempty"`
+	EgressIPs []*EgressIP `json:"egressIPs,omitempty"`
+}
+
+type EgressIP struct {
+	IP string `json:"ip"`
+	// Assigned is the status of the Assigned condition: True, False or
+	// Unknown while the assignment is pending.
+	Assigned string `json:"assigned"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Build builds the topology out of the nodes and the CloudPrivateIPConfigs.
+// Nodes without egress IP configuration annotation and without egress IP are
+// skipped.
+func Build(nodes []*corev1.Node, cloudPrivateIPConfigs []*cloudnetworkv1.CloudPrivateIPConfig) (*Topology, error) {
+	topology := &Topology{}
+	byName := map[string]*Node{}
+	for _, node := range nodes {
+		n := &Node{Name: node.Name}
+		if annotation, ok := node.Annotations[nodecontroller.NodeEgressIPConfigAnnotationKey]; ok {
+			configs := []*cloudprovider.NodeEgressIPConfiguration{}
+			if err := json.Unmarshal([]byte(annotation), &configs); err != nil {
+				return nil, fmt.Errorf("error parsing the egress IP configuration of node %s, err: %v", node.Name, err)
+			}
+			for _, config := range configs {
+				n.Interfaces = append(n.Interfaces, newInterface(config))
+			}
+		}
+		byName[node.Name] = n
+	}
+
+	sorted := make([]*cloudnetworkv1.CloudPrivateIPConfig, len(cloudPrivateIPConfigs))
+	copy(sorted, cloudPrivateIPConfigs)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	for _, cloudPrivateIPConfig := range sorted {
+		ip := cloudprivateipconfigcontroller.CloudPrivateIPConfigNameToIP(cloudPrivateIPConfig.Name)
+		egressIP := &EgressIP{IP: ip.String(), Assigned: string(metav1.ConditionUnknown)}
+		if condition := meta.FindStatusCondition(cloudPrivateIPConfig.Status.Conditions, conditions.Assigned); condition != nil {
+			egressIP.Assigned, egressIP.Reason = string(condition.Status), condition.Reason
+		}
+		n, ok := byName[cloudPrivateIPConfig.Status.Node]
+		if cloudPrivateIPConfig.Status.Node == "" {
+			topology.Unassigned = append(topology.Unassigned, egressIP)
+			continue
+		}
+		if !ok {
+			n = &Node{Name: cloudPrivateIPConfig.Status.Node}
+			byName[n.Name] = n
+		}
+		if subnet := n.subnetOf(ip); subnet != nil {
+			subnet.EgressIPs = append(subnet.EgressIPs, egressIP)
+		} else {
+			n.EgressIPs = append(n.EgressIPs, egressIP)
+		}
+	}
+
+	for _, n := range byName {
+		if len(n.Interfaces) > 0 || len(n.EgressIPs) > 0 {
+			topology.Nodes = append(topology.Nodes, n)
+		}
+	}
+	sort.Slice(topology.Nodes, func(i, j int) bool { return topology.Nodes[i].Name < topology.Nodes[j].Name })
+	return topology, nil
+}
+
+func newInterface(config *cloudprovider.NodeEgressIPConfiguration) *Interface {
+	i := &Interface{
+		Name:         config.Interface,
+		MAC:          config.MAC,
+		IPv4Capacity: config.Capacity.IPv4,
+		IPv6Capacity: config.Capacity.IPv6,
+		IPCapacity:   config.Capacity.IP,
+	}
+	for _, cidr := range []string{config.IFAddr.IPv4, config.IFAddr.IPv6} {
+		if cidr != "" {
+			i.Subnets = append(i.Subnets, &Subnet{CIDR: cidr})
+		}
+	}
+	for _, cidr := range config.SecondaryIFAddrs {
+		i.Subnets = append(i.Subnets, &Subnet{CIDR: cidr, Secondary: true})
+	}
+	return i
+}
+
+// subnetOf returns the subnet of the node's interfaces holding ip, preferring
+// the subnets egress IPs are assigned on, or nil if none does.
+func (n *Node) subnetOf(ip net.IP) *Subnet {
+	var secondary *Subnet
+	for _, i := range n.Interfaces {
+		for _, subnet := range i.Subnets {
+			if _, ipNet, err := net.ParseCIDR(subnet.CIDR); err != nil || !ipNet.Contains(ip) {
+				continue
+			}
+			if !subnet.Secondary {
+				return subnet
+			}
+			if secondary == nil {
+				secondary = subnet
+			}
+		}
+	}
+	return secondary
+}
+
+// RemainingCapacity returns the egress IP capacity left on each node, summed
+// over its interfaces, by address family: "ip" on platforms whose capacity is
+// family agnostic, "ipv4" and "ipv6" on the others. It's the capacity
+// annotated on the node minus the egress IPs assigned on the subnets of its
+// interfaces, pending ones included, and never negative.
+func (t *Topology) RemainingCapacity() map[string]map[string]int {
+	remaining := map[string]map[string]int{}
+	for _, n := range t.Nodes {
+		if len(n.Interfaces) == 0 {
+			continue
+		}
+		byFamily := map[string]int{}
+		for _, i := range n.Interfaces {
+			var ipv4, ipv6 int
+			for _, subnet := range i.Subnets {
+				for _, egressIP := range subnet.EgressIPs {
+					if cloudprovider.ParseIP(egressIP.IP).To4() != nil {
+						ipv4++
+					} else {
+						ipv6++
+					}
+				}
+			}
+			if i.IPCapacity > 0 {
+				byFamily["ip"] += nonNegative(i.IPCapacity - ipv4 - ipv6)
+				continue
+			}
+			byFamily["ipv4"] += nonNegative(i.IPv4Capacity - ipv4)
+			byFamily["ipv6"] += nonNegative(i.IPv6Capacity - ipv6)
+		}
+		// Family agnostic platforms don't report per family capacities.
+		if _, ok := byFamily["ip"]; ok {
+			byFamily = map[string]int{"ip": byFamily["ip"]}
+		}
+		remaining[n.Name] = byFamily
+	}
+	return remaining
+}
+
+func nonNegative(v int) int {
+	if v < 0 {
+		return 0
+	}
+	return v
+}
+
+// WriteJSON writes the topology as indented JSON.
+func (t *Topology) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(t)
+}
+
+// WriteDOT writes the topology as a Graphviz graph, laid out from left to
+// right: nodes, interfaces, subnets and egress IPs. Egress IPs whose
+// assignment failed are drawn in red, pending ones dashed.
+func (t *Topology) WriteDOT(w io.Writer) error {
+	b := &strings.Builder{}
+	b.WriteString("digraph egressips {\n\trankdir=LR;\n")
+	for _, n := range t.Nodes {
+		nodeID := "node/" + n.Name
+		fmt.Fprintf(b, "\t%q [shape=box3d, label=%q];\n", nodeID, n.Name)
+		for _, i := range n.Interfaces {
+			interfaceID := nodeID + "/" + i.Name
+			fmt.Fprintf(b, "\t%q [shape=box, label=%q];\n", interfaceID, i.label())
+			fmt.Fprintf(b, "\t%q -> %q;\n", nodeID, interfaceID)
+			for _, subnet := range i.Subnets {
+				subnetID := interfaceID + "/" + subnet.CIDR
+				style := "solid"
+				if subnet.Secondary {
+					style = "dotted"
+				}
+				fmt.Fprintf(b, "\t%q [shape=ellipse, style=%s, label=%q];\n", subnetID, style, subnet.CIDR)
+				fmt.Fprintf(b, "\t%q -> %q;\n", interfaceID, subnetID)
+				writeDOTEgressIPs(b, subnetID, subnet.EgressIPs)
+			}
+		}
+		writeDOTEgressIPs(b, nodeID, n.EgressIPs)
+	}
+	if len(t.Unassigned) > 0 {
+		b.WriteString("\t\"unassigned\" [shape=box3d, style=dashed, label=\"unassigned\"];\n")
+		writeDOTEgressIPs(b, "unassigned", t.Unassigned)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (i *Interface) label() string {
+	label := i.Name
+	if i.MAC != "" {
+		label += "\n" + i.MAC
+	}
+	var capacities []string
+	if i.IPv4Capacity > 0 {
+		capacities = append(capacities, fmt.Sprintf("ipv4=%d", i.IPv4Capacity))
+	}
+	if i.IPv6Capacity > 0 {
+		capacities = append(capacities, fmt.Sprintf("ipv6=%d", i.IPv6Capacity))
+	}
+	if i.IPCapacity > 0 {
+		capacities = append(capacities, fmt.Sprintf("ip=%d", i.IPCapacity))
+	}
+	if len(capacities) > 0 {
+		label += "\ncapacity: " + strings.Join(capacities, ", ")
+	}
+	return label
+}
+
+func writeDOTEgressIPs(b *strings.Builder, parentID string, egressIPs []*EgressIP) {
+	for _, egressIP := range egressIPs {
+		attributes := ""
+		switch metav1.ConditionStatus(egressIP.Assigned) {
+		case metav1.ConditionFalse:
+			attributes = ", color=red, fontcolor=red"
+		case metav1.ConditionUnknown:
+			attributes = ", style=dashed"
+		}
+		label := egressIP.IP
+		if egressIP.Reason != "" && metav1.ConditionStatus(egressIP.Assigned) != metav1.ConditionTrue {
+			label += "\n" + egressIP.Reason
+		}
+		egressIPID := "egressip/" + egressIP.IP
+		fmt.Fprintf(b, "\t%q [shape=note, label=%q%s];\n", egressIPID, label, attributes)
+		fmt.Fprintf(b, "\t%q -> %q;\n", parentID, egressIPID)
+	}
+}
@@ -0,0 +1,117 @@
+package topology
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	"github.com/openshift/cloud-network-config-controller/pkg/conditions"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newNode(name, egressIPConfig string) *corev1.Node {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if egressIPConfig != "" {
+		node.Annotations = map[string]string{"cloud.network.openshift.io/egress-ipconfig": egressIPConfig}
+	}
+	return node
+}
+
+func newCloudPrivateIPConfig(name, node string, status metav1.ConditionStatus, reason string) *cloudnetworkv1.CloudPrivateIPConfig {
+	cloudPrivateIPConfig := &cloudnetworkv1.CloudPrivateIPConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       cloudnetworkv1.CloudPrivateIPConfigSpec{Node: node},
+		Status:     cloudnetworkv1.CloudPrivateIPConfigStatus{Node: node},
+	}
+	if status != "" {
+		cloudPrivateIPConfig.Status.Conditions = []metav1.Condition{conditions.New(conditions.Assigned, status, 0, reason, "")}
+	}
+	return cloudPrivateIPConfig
+}
+
+func TestBuild(t *testing.T) {
+	nodes := []*corev1.Node{
+		newNode("worker-1", `[{"interface":"eni-1","ifaddr":{"ipv4":"10.0.1.0/24","ipv6":"fd00:1::/64"},"capacity":{"ipv4":14,"ipv6":15},"secondaryIfaddrs":["10.0.9.0/24"]}]`),
+		newNode("worker-0", `[{"interface":"eni-0","ifaddr":{"ipv4":"10.0.0.0/24"},"capacity":{"ipv4":14},"mac":"02:00:00:00:00:01"}]`),
+		// Nodes without egress IP configuration nor egress IP are skipped.
+		newNode("master-0", ""),
+		newNode("master-1", ""),
+	}
+	cloudPrivateIPConfigs := []*cloudnetworkv1.CloudPrivateIPConfig{
+		newCloudPrivateIPConfig("10.0.1.10", "worker-1", metav1.ConditionTrue, conditions.ReasonCloudResponseSuccess),
+		newCloudPrivateIPConfig("fd00.0001.0000.0000.0000.0000.0000.0010", "worker-1", metav1.ConditionFalse, conditions.ReasonCloudResponseError),
+		newCloudPrivateIPConfig("10.0.9.10", "worker-1", metav1.ConditionTrue, conditions.ReasonCloudResponseSuccess),
+		newCloudPrivateIPConfig("10.0.0.10", "worker-0", "", ""),
+		newCloudPrivateIPConfig("10.0.5.10", "master-1", metav1.ConditionTrue, conditions.ReasonCloudResponseSuccess),
+		newCloudPrivateIPConfig("10.0.0.11", "", metav1.ConditionFalse, conditions.ReasonCloudResponseError),
+	}
+
+	topology, err := Build(nodes, cloudPrivateIPConfigs)
+	if err != nil {
+		t.Fatalf("TestBuild: received unexpected error, err: %q", err)
+	}
+	actual, _ := json.Marshal(topology)
+	expected := `{"nodes":[` +
+		`{"name":"master-1","egressIPs":[{"ip":"10.0.5.10","assigned":"True","reason":"CloudResponseSuccess"}]},` +
+		`{"name":"worker-0","interfaces":[{"name":"eni-0","mac":"02:00:00:00:00:01","ipv4Capacity":14,"subnets":[{"cidr":"10.0.0.0/24","egressIPs":[{"ip":"10.0.0.10","assigned":"Unknown"}]}]}]},` +
+		`{"name":"worker-1","interfaces":[{"name":"eni-1","ipv4Capacity":14,"ipv6Capacity":15,"subnets":[` +
+		`{"cidr":"10.0.1.0/24","egressIPs":[{"ip":"10.0.1.10","assigned":"True","reason":"CloudResponseSuccess"}]},` +
+		`{"cidr":"fd00:1::/64","egressIPs":[{"ip":"fd00:1::10","assigned":"False","reason":"CloudResponseError"}]},` +
+		`{"cidr":"10.0.9.0/24","secondary":true,"egressIPs":[{"ip":"10.0.9.10","assigned":"True","reason":"CloudResponseSuccess"}]}]}]}],` +
+		`"unassigned":[{"ip":"10.0.0.11","assigned":"False","reason":"CloudResponseError"}]}`
+	if string(actual) != expected {
+		t.Fatalf("TestBuild: expected topology\n%s\ngot\n%s", expected, actual)
+	}
+
+	dot := &bytes.Buffer{}
+	if err := topology.WriteDOT(dot); err != nil {
+		t.Fatalf("TestBuild: received unexpected error, err: %q", err)
+	}
+	for _, line := range []string{
+		`"node/worker-0" -> "node/worker-0/eni-0";`,
+		`"node/worker-0/eni-0" [shape=box, label="eni-0\n02:00:00:00:00:01\ncapacity: ipv4=14"];`,
+		`"node/worker-0/eni-0/10.0.0.0/24" -> "egressip/10.0.0.10";`,
+		`"egressip/fd00:1::10" [shape=note, label="fd00:1::10\nCloudResponseError", color=red, fontcolor=red];`,
+		`"node/master-1" -> "egressip/10.0.5.10";`,
+		`"unassigned" -> "egressip/10.0.0.11";`,
+	} {
+		if !strings.Contains(dot.String(), "\t"+line+"\n") {
+			t.Fatalf("TestBuild: expected graph to contain %s, got\n%s", line, dot)
+		}
+	}
+
+	if _, err := Build([]*corev1.Node{newNode("worker-0", "{")}, nil); err == nil {
+		t.Fatalf("TestBuild: expected an error for an invalid egress IP configuration")
+	}
+}
+
+func TestRemainingCapacity(t *testing.T) {
+	nodes := []*corev1.Node{
+		newNode("worker-0", `[{"interface":"eni-0","ifaddr":{"ipv4":"10.0.0.0/24"},"capacity":{"ipv4":14}}]`),
+		newNode("worker-1", `[{"interface":"eni-1","ifaddr":{"ipv4":"10.0.1.0/24","ipv6":"fd00:1::/64"},"capacity":{"ipv4":14,"ipv6":15},"secondaryIfaddrs":["10.0.9.0/24"]}]`),
+		newNode("worker-2", `[{"interface":"port-2","ifaddr":{"ipv4":"10.0.2.0/24"},"capacity":{"ip":2}}]`),
+		newNode("master-0", ""),
+	}
+	cloudPrivateIPConfigs := []*cloudnetworkv1.CloudPrivateIPConfig{
+		newCloudPrivateIPConfig("10.0.1.10", "worker-1", metav1.ConditionTrue, conditions.ReasonCloudResponseSuccess),
+		newCloudPrivateIPConfig("10.0.9.10", "worker-1", metav1.ConditionTrue, conditions.ReasonCloudResponseSuccess),
+		newCloudPrivateIPConfig("fd00.0001.0000.0000.0000.0000.0000.0010", "worker-1", metav1.ConditionUnknown, conditions.ReasonCloudResponsePending),
+		newCloudPrivateIPConfig("10.0.2.10", "worker-2", metav1.ConditionTrue, conditions.ReasonCloudResponseSuccess),
+		newCloudPrivateIPConfig("10.0.2.11", "worker-2", metav1.ConditionTrue, conditions.ReasonCloudResponseSuccess),
+		newCloudPrivateIPConfig("10.0.2.12", "worker-2", metav1.ConditionFalse, conditions.ReasonCloudResponseError),
+		newCloudPrivateIPConfig("10.0.5.10", "master-0", metav1.ConditionTrue, conditions.ReasonCloudResponseSuccess),
+	}
+
+	topology, err := Build(nodes, cloudPrivateIPConfigs)
+	if err != nil {
+		t.Fatalf("TestRemainingCapacity: received unexpected error, err: %q", err)
+	}
+	actual, _ := json.Marshal(topology.RemainingCapacity())
+	expected := `{"worker-0":{"ipv4":14,"ipv6":0},"worker-1":{"ipv4":12,"ipv6":14},"worker-2":{"ip":0}}`
+	if string(actual) != expected {
+		t.Fatalf("TestRemainingCapacity: expected remaining capacity\n%s\ngot\n%s", expected, actual)
+	}
+}
@@ -0,0 +1,97 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// serviceName identifies the controller in the exported traces.
+	serviceName = "cloud-network-config-controller"
+	// scopeName identifies the instrumentation in the exported traces.
+	scopeName = "github.com/openshift/cloud-network-config-controller"
+
+	// exportTimeout is the timeout of every export request.
+	exportTimeout = 10 * time.Second
+	// shutdownTimeout is how long the spans left are given to be exported
+	// once the stop channel is closed.
+	shutdownTimeout = 5 * time.Second
+)
+
+// Init enables tracing, exporting the spans over OTLP/HTTP to the collector
+// at endpoint, e.g. http://otel-collector:4318, until stopCh is closed. Only a
+// sampleRatio fraction of the traces, between 0 and 1, is recorded: a trace
+// is sampled, or not, when its root span starts.
+func Init(stopCh <-chan struct{}, endpoint string, sampleRatio float64) error {
+	if sampleRatio < 0 || sampleRatio > 1 {
+		return fmt.Errorf("invalid sample ratio %v, must be between 0 and 1", sampleRatio)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid OTLP endpoint %q, must be an http:// or https:// URL", endpoint)
+	}
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(strings.TrimSuffix(u.Path, "/") + "/v1/traces"),
+		otlptracehttp.WithTimeout(exportTimeout),
+	}
+	if u.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	// The exporter's HTTP client isn't traced, not to trace the export of
+	// traces.
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return fmt.Errorf("error creating the OTLP exporter, err: %v", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		klog.Warningf("Error exporting traces to %s, err: %v", endpoint, err)
+	}))
+	otel.SetTracerProvider(provider)
+	go func() {
+		<-stopCh
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			klog.Warningf("Error exporting the traces left, err: %v", err)
+		}
+	}()
+	klog.Infof("Exporting traces to %s, sampling %v of them", endpoint, sampleRatio)
+	return nil
+}
+
+// Start starts a span named name, child of the span of ctx if any, and
+// returns it along with a copy of ctx carrying it. The span is a no-op while
+// tracing is disabled.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	// The tracer is looked up on every span for Init to take effect on the
+	// spans started afterwards.
+	return otel.GetTracerProvider().Tracer(scopeName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End ends the span, with an error status if err isn't nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
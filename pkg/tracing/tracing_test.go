@@ -0,0 +1,173 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// record records the spans ended until the returned function is called,
+// which disables tracing again.
+func record() (*tracetest.SpanRecorder, func()) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	return recorder, func() { otel.SetTracerProvider(trace.NewNoopTracerProvider()) }
+}
+
+// newServer returns a server answering 503 and the channel receiving the
+// traceparent header of its requests.
+func newServer() (*httptest.Server, <-chan string) {
+	traceparents := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents <- r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	return server, traceparents
+}
+
+func TestDisabled(t *testing.T) {
+	ctx, span := Start(context.Background(), "sync")
+	if span.IsRecording() || trace.SpanContextFromContext(ctx).IsValid() {
+		t.Fatalf("expected no span while tracing is disabled, got: %+v", span.SpanContext())
+	}
+	End(span, errors.New("failed"))
+
+	server, traceparents := newServer()
+	defer server.Close()
+	client := &http.Client{Transport: NewTransport(http.DefaultTransport)}
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	resp, err := client.Do(request)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if traceparent := <-traceparents; traceparent != "" {
+		t.Fatalf("expected no traceparent header, got: %s", traceparent)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	recorder, stop := record()
+	defer stop()
+
+	server, traceparents := newServer()
+	defer server.Close()
+	client := &http.Client{Transport: NewTransport(http.DefaultTransport)}
+
+	// Requests outside of any trace aren't traced.
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if traceparent := <-traceparents; traceparent != "" {
+		t.Fatalf("expected no traceparent header outside of a trace, got: %s", traceparent)
+	}
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Fatalf("expected no span outside of a trace, got: %+v", spans)
+	}
+
+	ctx, root := Start(context.Background(), "sync")
+	childCtx, child := Start(ctx, "cloud AssignPrivateIP")
+	request, _ := http.NewRequestWithContext(childCtx, http.MethodPost, server.URL+"/assign?token=secret", nil)
+	resp, err = client.Do(request)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	traceparent := <-traceparents
+	End(child, errors.New("assign failed"))
+	End(root, nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got: %+v", spans)
+	}
+	httpSpan, childSpan, rootSpan := spans[0], spans[1], spans[2]
+	if rootSpan.Name() != "sync" || rootSpan.Parent().IsValid() || rootSpan.Status().Code != codes.Unset {
+		t.Fatalf("unexpected root span: %+v", rootSpan)
+	}
+	if childSpan.Parent().SpanID() != rootSpan.SpanContext().SpanID() || childSpan.Status().Code != codes.Error || childSpan.Status().Description != "assign failed" {
+		t.Fatalf("unexpected child span: %+v", childSpan)
+	}
+	if httpSpan.Name() != "HTTP POST" || httpSpan.SpanKind() != trace.SpanKindClient || httpSpan.Parent().SpanID() != childSpan.SpanContext().SpanID() || httpSpan.Status().Code != codes.Error {
+		t.Fatalf("unexpected HTTP span: %+v", httpSpan)
+	}
+	for _, attribute := range httpSpan.Attributes() {
+		if attribute.Key == "http.url" && attribute.Value.AsString() != server.URL+"/assign" {
+			t.Fatalf("expected the query to be redacted from the URL, got: %s", attribute.Value.AsString())
+		}
+	}
+	if expected := "00-" + rootSpan.SpanContext().TraceID().String() + "-" + httpSpan.SpanContext().SpanID().String() + "-01"; traceparent != expected {
+		t.Fatalf("expected traceparent %s, got: %s", expected, traceparent)
+	}
+}
+
+func TestInit(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err := Init(stopCh, "otel-collector:4318", 1); err == nil {
+		t.Fatalf("expected an error for an endpoint which isn't a URL")
+	}
+	if err := Init(stopCh, "http://otel-collector:4318", 1.5); err == nil {
+		t.Fatalf("expected an error for a sample ratio above 1")
+	}
+}
+
+func TestExport(t *testing.T) {
+	received := make(chan *collectortrace.ExportTraceServiceRequest, 16)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/otlp/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("unexpected export request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		request := &collectortrace.ExportTraceServiceRequest{}
+		if err := proto.Unmarshal(body, request); err != nil {
+			t.Errorf("error decoding the export request, err: %v", err)
+		}
+		received <- request
+	}))
+	defer collector.Close()
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	stopCh := make(chan struct{})
+	if err := Init(stopCh, collector.URL+"/otlp/", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, span := Start(context.Background(), "sync")
+	End(span, nil)
+	// The spans left are exported once the stop channel is closed.
+	close(stopCh)
+
+	select {
+	case request := <-received:
+		resourceSpans := request.ResourceSpans
+		if len(resourceSpans) != 1 || len(resourceSpans[0].ScopeSpans) != 1 || len(resourceSpans[0].ScopeSpans[0].Spans) != 1 {
+			t.Fatalf("expected one span, got: %+v", request)
+		}
+		if name := resourceSpans[0].ScopeSpans[0].Spans[0].Name; name != "sync" {
+			t.Fatalf("expected the sync span, got: %s", name)
+		}
+		found := false
+		for _, attribute := range resourceSpans[0].Resource.Attributes {
+			found = found || (attribute.Key == "service.name" && attribute.Value.GetStringValue() == serviceName)
+		}
+		if !found {
+			t.Fatalf("expected the service name as resource attribute, got: %+v", resourceSpans[0].Resource.Attributes)
+		}
+	case <-time.After(shutdownTimeout):
+		t.Fatalf("timed out waiting for the spans to be exported")
+	}
+}
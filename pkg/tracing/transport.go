@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Transport traces the requests of an HTTP client sent on behalf of a traced
+// operation, i.e. with a span in their context: every such request gets a
+// client span, child of that span, propagated to the server in the
+// traceparent header. The other requests are passed through.
+type Transport struct {
+	// Base is the transport sending the requests.
+	Base http.RoundTripper
+
+	traced http.RoundTripper
+}
+
+// NewTransport returns a Transport tracing the requests of base.
+func NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{
+		Base: base,
+		traced: otelhttp.NewTransport(redactingTransport{base},
+			otelhttp.WithFilter(func(r *http.Request) bool {
+				return trace.SpanContextFromContext(r.Context()).IsValid()
+			}),
+			otelhttp.WithPropagators(propagation.TraceContext{}),
+		),
+	}
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return t.traced.RoundTrip(r)
+}
+
+// redactingTransport overrides the URL of the client span of the request,
+// set by otelhttp, with the URL without its query, which may hold
+// credentials, e.g. signed requests.
+type redactingTransport struct {
+	base http.RoundTripper
+}
+
+func (t redactingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	trace.SpanFromContext(r.Context()).SetAttributes(semconv.HTTPURLKey.String(redactedURL(r)))
+	return t.base.RoundTrip(r)
+}
+
+func redactedURL(r *http.Request) string {
+	u := *r.URL
+	u.RawQuery, u.User, u.Fragment = "", nil, ""
+	return u.String()
+}
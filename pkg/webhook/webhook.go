@@ -0,0 +1,167 @@
+package webhook
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	cloudprivateipconfigcontroller "github.com/openshift/cloud-network-config-controller/pkg/controller/cloudprivateipconfig"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// NormalizePath is the path the CloudPrivateIPConfig normalization is
+	// served on.
+	NormalizePath = "/normalize-cloudprivateipconfig"
+
+	// certFile and keyFile are the names of the serving certificate and key
+	// in the certificate directory, as written by the service CA operator.
+	certFile = "tls.crt"
+	keyFile  = "tls.key"
+
+	// maxRequestSize caps the size of the AdmissionReviews read.
+	maxRequestSize = 1 << 20
+)
+
+// patchOperation is a JSON patch (RFC 6902) operation.
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Serve serves the mutating admission webhook normalizing the names of
+// CloudPrivateIPConfigs over TLS on the port until the stop channel is closed.
+// The certificate and key are read from certDir on every handshake, so that
+// rotated ones are picked up without a restart.
+func Serve(stopCh <-chan struct{}, port int, certDir string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(NormalizePath, Normalize)
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				cert, err := tls.LoadX509KeyPair(filepath.Join(certDir, certFile), filepath.Join(certDir, keyFile))
+				if err != nil {
+					return nil, fmt.Errorf("error loading the webhook serving certificate from %s, err: %v", certDir, err)
+				}
+				return &cert, nil
+			},
+		},
+	}
+	go func() {
+		<-stopCh
+		server.Close()
+	}()
+	klog.Infof("Serving the CloudPrivateIPConfig admission webhook on port %d", port)
+	if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+		klog.Exitf("Error serving the CloudPrivateIPConfig admission webhook: %v", err)
+	}
+}
+
+// Normalize handles the AdmissionReviews of CloudPrivateIPConfigs, see
+// normalize.
+func Normalize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error reading the request, err: %v", err), http.StatusBadRequest)
+		return
+	}
+	review := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(body, review); err != nil || review.Request == nil {
+		http.Error(w, fmt.Sprintf("error decoding the AdmissionReview, err: %v", err), http.StatusBadRequest)
+		return
+	}
+	review.Response = normalize(review.Request)
+	review.Response.UID = review.Request.UID
+	review.Request = nil
+	response, err := json.Marshal(review)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error encoding the AdmissionReview, err: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// normalize canonicalizes the name of a created CloudPrivateIPConfig, which
+// must encode its IP address (see CloudPrivateIPConfigNameToIP): IPv6
+// addresses are fully expanded, lowercase, with dots instead of colons,
+// whatever encoding the user got wrong, e.g. compressed addresses or colons.
+// The parsed IP address is stored in the CloudPrivateIPConfigIPAnnotation, on
+// updates too, for an unambiguous lookup. Objects whose name doesn't encode
+// an IP address are denied.
+func normalize(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	cloudPrivateIPConfig := &cloudnetworkv1.CloudPrivateIPConfig{}
+	if err := json.Unmarshal(request.Object.Raw, cloudPrivateIPConfig); err != nil {
+		return deny(fmt.Sprintf("error decoding the CloudPrivateIPConfig, err: %v", err))
+	}
+	name := cloudPrivateIPConfig.Name
+	if name == "" {
+		name = request.Name
+	}
+	ip := cloudprivateipconfigcontroller.CloudPrivateIPConfigNameToIP(name)
+	if ip == nil {
+		return deny(fmt.Sprintf("the name of CloudPrivateIPConfig %q must be an IPv4 address, or a fully expanded IPv6 address with dots instead of colons, e.g. fc00.f853.0ccd.e793.0000.0000.0000.0054", name))
+	}
+
+	patch := []patchOperation{}
+	if canonicalName := cloudprivateipconfigcontroller.CloudPrivateIPConfigIPToName(ip); request.Operation == admissionv1.Create && name != canonicalName {
+		klog.Infof("Normalizing the name of CloudPrivateIPConfig %q to %q", name, canonicalName)
+		patch = append(patch, patchOperation{Op: "add", Path: "/metadata/name", Value: canonicalName})
+	}
+	switch {
+	case cloudPrivateIPConfig.Annotations == nil:
+		patch = append(patch, patchOperation{
+			Op:    "add",
+			Path:  "/metadata/annotations",
+			Value: map[string]string{cloudprivateipconfigcontroller.CloudPrivateIPConfigIPAnnotation: ip.String()},
+		})
+	case cloudPrivateIPConfig.Annotations[cloudprivateipconfigcontroller.CloudPrivateIPConfigIPAnnotation] != ip.String():
+		patch = append(patch, patchOperation{
+			Op:    "add",
+			Path:  "/metadata/annotations/" + strings.ReplaceAll(cloudprivateipconfigcontroller.CloudPrivateIPConfigIPAnnotation, "/", "~1"),
+			Value: ip.String(),
+		})
+	}
+
+	response := &admissionv1.AdmissionResponse{Allowed: true}
+	if len(patch) == 0 {
+		return response
+	}
+	rawPatch, err := json.Marshal(patch)
+	if err != nil {
+		return deny(fmt.Sprintf("error encoding the patch, err: %v", err))
+	}
+	patchType := admissionv1.PatchTypeJSONPatch
+	response.Patch = rawPatch
+	response.PatchType = &patchType
+	return response
+}
+
+func deny(message string) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: message,
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+		},
+	}
+}
@@ -0,0 +1,135 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cloudnetworkv1 "github.com/openshift/api/cloudnetwork/v1"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestNormalize(t *testing.T) {
+	tcs := []struct {
+		name          string
+		operation     admissionv1.Operation
+		object        cloudnetworkv1.CloudPrivateIPConfig
+		expectAllowed bool
+		expectPatch   string
+	}{
+		{
+			name:          "Should only annotate a canonical IPv4 name",
+			operation:     admissionv1.Create,
+			object:        cloudnetworkv1.CloudPrivateIPConfig{ObjectMeta: metav1.ObjectMeta{Name: "192.168.126.11"}},
+			expectAllowed: true,
+			expectPatch:   `[{"op":"add","path":"/metadata/annotations","value":{"cloud.network.openshift.io/ip":"192.168.126.11"}}]`,
+		},
+		{
+			name:          "Should only annotate a canonical IPv6 name",
+			operation:     admissionv1.Create,
+			object:        cloudnetworkv1.CloudPrivateIPConfig{ObjectMeta: metav1.ObjectMeta{Name: "fc00.f853.0ccd.e793.0000.0000.0000.0054"}},
+			expectAllowed: true,
+			expectPatch:   `[{"op":"add","path":"/metadata/annotations","value":{"cloud.network.openshift.io/ip":"fc00:f853:ccd:e793::54"}}]`,
+		},
+		{
+			name:          "Should expand a compressed IPv6 name",
+			operation:     admissionv1.Create,
+			object:        cloudnetworkv1.CloudPrivateIPConfig{ObjectMeta: metav1.ObjectMeta{Name: "fc00.f853.ccd.e793..54"}},
+			expectAllowed: true,
+			expectPatch:   `[{"op":"add","path":"/metadata/name","value":"fc00.f853.0ccd.e793.0000.0000.0000.0054"},{"op":"add","path":"/metadata/annotations","value":{"cloud.network.openshift.io/ip":"fc00:f853:ccd:e793::54"}}]`,
+		},
+		{
+			name:      "Should replace the colons and lowercase an IPv6 name",
+			operation: admissionv1.Create,
+			object: cloudnetworkv1.CloudPrivateIPConfig{ObjectMeta: metav1.ObjectMeta{
+				Name:        "FC00:F853:CCD:E793::54",
+				Annotations: map[string]string{"foo": "bar"},
+			}},
+			expectAllowed: true,
+			expectPatch:   `[{"op":"add","path":"/metadata/name","value":"fc00.f853.0ccd.e793.0000.0000.0000.0054"},{"op":"add","path":"/metadata/annotations/cloud.network.openshift.io~1ip","value":"fc00:f853:ccd:e793::54"}]`,
+		},
+		{
+			name:      "Should not patch an annotated canonical name",
+			operation: admissionv1.Create,
+			object: cloudnetworkv1.CloudPrivateIPConfig{ObjectMeta: metav1.ObjectMeta{
+				Name:        "192.168.126.11",
+				Annotations: map[string]string{"cloud.network.openshift.io/ip": "192.168.126.11"},
+			}},
+			expectAllowed: true,
+		},
+		{
+			name:      "Should correct the annotation on updates, but not the name",
+			operation: admissionv1.Update,
+			object: cloudnetworkv1.CloudPrivateIPConfig{ObjectMeta: metav1.ObjectMeta{
+				Name:        "fc00.f853.ccd.e793..54",
+				Annotations: map[string]string{"cloud.network.openshift.io/ip": "192.168.126.11"},
+			}},
+			expectAllowed: true,
+			expectPatch:   `[{"op":"add","path":"/metadata/annotations/cloud.network.openshift.io~1ip","value":"fc00:f853:ccd:e793::54"}]`,
+		},
+		{
+			name:      "Should deny a name which isn't an IP address",
+			operation: admissionv1.Create,
+			object:    cloudnetworkv1.CloudPrivateIPConfig{ObjectMeta: metav1.ObjectMeta{Name: "egress-ip"}},
+		},
+	}
+
+	for i, tc := range tcs {
+		raw, err := json.Marshal(tc.object)
+		if err != nil {
+			t.Fatalf("TestNormalize(%d): %s: error encoding the object, err: %v", i, tc.name, err)
+		}
+		response := normalize(&admissionv1.AdmissionRequest{
+			Operation: tc.operation,
+			Name:      tc.object.Name,
+			Object:    runtime.RawExtension{Raw: raw},
+		})
+		if response.Allowed != tc.expectAllowed {
+			t.Fatalf("TestNormalize(%d): %s: expected allowed %v, got %v, result: %v", i, tc.name, tc.expectAllowed, response.Allowed, response.Result)
+		}
+		if string(response.Patch) != tc.expectPatch {
+			t.Fatalf("TestNormalize(%d): %s: expected patch %s, got %s", i, tc.name, tc.expectPatch, response.Patch)
+		}
+	}
+}
+
+func TestNormalizeHandler(t *testing.T) {
+	raw, _ := json.Marshal(cloudnetworkv1.CloudPrivateIPConfig{ObjectMeta: metav1.ObjectMeta{Name: "fc00::54"}})
+	review, _ := json.Marshal(admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "705ab4f5-6393-11e8-b7cc-42010a800002",
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+	recorder := httptest.NewRecorder()
+	Normalize(recorder, httptest.NewRequest(http.MethodPost, NormalizePath, bytes.NewReader(review)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+	response := admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("error decoding the AdmissionReview, err: %v", err)
+	}
+	if response.Response == nil || response.Response.UID != "705ab4f5-6393-11e8-b7cc-42010a800002" || !response.Response.Allowed {
+		t.Fatalf("expected an allowed response to the request, got: %+v", response.Response)
+	}
+	if response.Kind != "AdmissionReview" || response.APIVersion != "admission.k8s.io/v1" || response.Request != nil {
+		t.Fatalf("expected an admission.k8s.io/v1 AdmissionReview without the request, got: %+v", response)
+	}
+	expectedPatch := `[{"op":"add","path":"/metadata/name","value":"fc00.0000.0000.0000.0000.0000.0000.0054"},{"op":"add","path":"/metadata/annotations","value":{"cloud.network.openshift.io/ip":"fc00::54"}}]`
+	if string(response.Response.Patch) != expectedPatch {
+		t.Fatalf("expected patch %s, got %s", expectedPatch, response.Response.Patch)
+	}
+
+	recorder = httptest.NewRecorder()
+	Normalize(recorder, httptest.NewRequest(http.MethodGet, NormalizePath, nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status %d, got %d", http.StatusMethodNotAllowed, recorder.Code)
+	}
+}